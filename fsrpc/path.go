@@ -233,28 +233,7 @@ func (p Path) Join(childName string) (childPath Path, err error) {
 func ParseTlfHandle(
 	ctx context.Context, kbpki libkbfs.KBPKI, name string, public bool) (
 	*libkbfs.TlfHandle, error) {
-	var tlfHandle *libkbfs.TlfHandle
-outer:
-	for {
-		var parseErr error
-		tlfHandle, parseErr = libkbfs.ParseTlfHandle(
-			ctx, kbpki, name, public)
-		switch parseErr := parseErr.(type) {
-		case nil:
-			// No error.
-			break outer
-
-		case libkbfs.TlfNameNotCanonical:
-			// Non-canonical name, so try again.
-			name = parseErr.NameToTry
-
-		default:
-			// Some other error.
-			return nil, parseErr
-		}
-	}
-
-	return tlfHandle, nil
+	return libkbfs.ParseTlfHandleFollowingRedirects(ctx, kbpki, name, public)
 }
 
 // GetNode returns a node
@@ -72,6 +72,10 @@ func start() *libfs.Error {
 		return nil
 	}
 
+	if err := libkbfs.ApplyInitConfig(kbfsParams, flag.CommandLine); err != nil {
+		return libfs.InitError(err.Error())
+	}
+
 	var mountpoint string
 	if len(flag.Args()) < 1 {
 		if !*servicemount {
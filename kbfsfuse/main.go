@@ -10,6 +10,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"bazil.org/fuse"
 
@@ -23,11 +24,20 @@ import (
 var runtimeDir = flag.String("runtime-dir", os.Getenv("KEYBASE_RUNTIME_DIR"), "runtime directory")
 var label = flag.String("label", os.Getenv("KEYBASE_LABEL"), "label to help identify if running as a service")
 var mountType = flag.String("mount-type", defaultMountType, "mount type: default, force, none")
+var remount = flag.Bool("remount", false, "mount again automatically whenever the mount goes away without kbfsfuse being stopped, including after an explicit unmount")
 var version = flag.Bool("version", false, "Print version")
+var installAutostart = flag.Bool("install-autostart", false, "set up the system to run kbfsfuse, with the other given flags and mountpoint, at login; then exit")
+var uninstallAutostart = flag.Bool("uninstall-autostart", false, "undo -install-autostart, then exit")
 
 const usageFormatStr = `Usage:
   kbfsfuse -version
 
+  kbfsfuse -uninstall-autostart
+
+The mountpoint may be omitted if kbfsfuse has run before, to use the
+same one as last time.  Add -install-autostart to any of the below to
+mount KBFS that way at every login instead.
+
 To run against remote KBFS servers:
   kbfsfuse
     [-runtime-dir=path/to/dir] [-label=label] [-mount-type=force]
@@ -67,9 +77,15 @@ func start() *libfs.Error {
 		return nil
 	}
 
-	if len(flag.Args()) < 1 {
-		fmt.Print(getUsageString(ctx))
-		return libfs.InitError("no mount specified")
+	if err := libkbfs.ApplyInitConfig(kbfsParams, flag.CommandLine); err != nil {
+		return libfs.InitError(err.Error())
+	}
+
+	if *uninstallAutostart {
+		if err := libfuse.UninstallAutostart(); err != nil {
+			return libfs.InitError(err.Error())
+		}
+		return nil
 	}
 
 	if len(flag.Args()) > 1 {
@@ -77,6 +93,34 @@ func start() *libfs.Error {
 		return libfs.InitError("extra arguments specified (flags go before the first argument)")
 	}
 
+	var mountpoint string
+	if len(flag.Args()) == 1 {
+		mountpoint = flag.Arg(0)
+	} else if *mountType != "none" {
+		r, err := libfuse.ReadMountpointRecord(ctx.GetDataDir())
+		if err != nil {
+			return libfs.InitError(err.Error())
+		}
+		if r == nil {
+			fmt.Print(getUsageString(ctx))
+			return libfs.InitError("no mount specified")
+		}
+		mountpoint = r.Dir
+	}
+	if mountpoint != "" {
+		// Relative mountpoints would be wrong for autostart, and for
+		// the mountpoint record.
+		abs, err := filepath.Abs(mountpoint)
+		if err != nil {
+			return libfs.InitError(err.Error())
+		}
+		mountpoint = abs
+	}
+
+	if *installAutostart {
+		return doInstallAutostart(mountpoint)
+	}
+
 	if kbfsParams.Debug {
 		fuseLog := logger.NewWithCallDepth("FUSE", 1)
 		fuseLog.Configure("", true, "")
@@ -84,7 +128,6 @@ func start() *libfs.Error {
 			fuseLog, false /* superVerbose */)
 	}
 
-	mountpoint := flag.Arg(0)
 	var mounter libfuse.Mounter
 	if *mountType == "force" {
 		mounter = libfuse.NewForceMounter(mountpoint, *platformParams)
@@ -99,11 +142,36 @@ func start() *libfs.Error {
 		PlatformParams: *platformParams,
 		RuntimeDir:     *runtimeDir,
 		Label:          *label,
+		Remount:        *remount,
 	}
 
 	return libfuse.Start(mounter, options, ctx)
 }
 
+// doInstallAutostart sets up this binary to run at login with the
+// same flags as this run, other than -install-autostart, and the given
+// mountpoint.
+func doInstallAutostart(mountpoint string) *libfs.Error {
+	exe, err := os.Executable()
+	if err != nil {
+		return libfs.InitError(err.Error())
+	}
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "install-autostart" {
+			return
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", f.Name, f.Value))
+	})
+	if mountpoint != "" {
+		args = append(args, mountpoint)
+	}
+	if err := libfuse.InstallAutostart(exe, args); err != nil {
+		return libfs.InitError(err.Error())
+	}
+	return nil
+}
+
 func main() {
 	err := start()
 	if err != nil {
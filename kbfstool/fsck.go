@@ -0,0 +1,111 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+const fsckUsageStr = `Usage:
+  kbfstool fsck /keybase/[public|private]/user1,assertion2 [tlfs...]
+
+Each TLF may also be given as a TLF ID. The whole merged history of
+each TLF is checked, along with every block it references. Orphaned
+blocks can only be found when running against a local block server.
+
+`
+
+func printFsckReport(
+	input string, report libkbfs.TlfVerifyReport, verbose bool) {
+	if report.Head == libkbfs.MetadataRevisionUninitialized {
+		fmt.Printf("%s has no history\n", input)
+		return
+	}
+
+	fmt.Printf("Checked %s up to revision %d (%d block references)\n",
+		input, report.Head, report.NumCheckedBlocks)
+
+	var revs []int
+	for rev := range report.BadRevisions {
+		revs = append(revs, int(rev))
+	}
+	sort.Ints(revs)
+	for _, rev := range revs {
+		fmt.Printf("Bad revision %d: %v\n",
+			rev, report.BadRevisions[libkbfs.MetadataRevision(rev)])
+	}
+
+	for ptr, err := range report.MissingBlocks {
+		if verbose {
+			fmt.Printf("Missing block %v: %v\n", ptr, err)
+		} else {
+			fmt.Printf("Missing block %s: %v\n", ptr.ID, err)
+		}
+	}
+
+	if report.CheckedOrphans {
+		for _, id := range report.OrphanedBlocks {
+			fmt.Printf("Orphaned block %s\n", id)
+		}
+	} else if verbose {
+		fmt.Printf("Skipped checking for orphaned blocks\n")
+	}
+
+	if report.IsConsistent() {
+		fmt.Printf("%s is consistent\n", input)
+	} else {
+		fmt.Printf("%s has %d bad revisions, %d missing blocks, "+
+			"and %d orphaned blocks\n", input,
+			len(report.BadRevisions), len(report.MissingBlocks),
+			len(report.OrphanedBlocks))
+	}
+}
+
+func fsck(ctx context.Context, config libkbfs.Config, args []string) (
+	exitStatus int) {
+	flags := flag.NewFlagSet("kbfs fsck", flag.ContinueOnError)
+	verbose := flags.Bool("v", false, "Print verbose output.")
+	err := flags.Parse(args)
+	if err != nil {
+		printError("fsck", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) < 1 {
+		fmt.Print(fsckUsageStr)
+		return 1
+	}
+
+	verifier := libkbfs.NewTlfVerifier(config)
+	for _, input := range inputs {
+		tlfID, err := getTlfID(ctx, config, input)
+		if err != nil {
+			printError("fsck", err)
+			return 1
+		}
+
+		report, err := verifier.Verify(ctx, tlfID)
+		if err != nil {
+			printError("fsck", err)
+			return 1
+		}
+
+		printFsckReport(
+			getTlfLabel(ctx, config, input), report, *verbose)
+		if !report.IsConsistent() {
+			exitStatus = 1
+		}
+
+		fmt.Print("\n")
+	}
+
+	return exitStatus
+}
@@ -41,6 +41,9 @@ The possible commands are:
   read		Dump file to stdout
   write		Write stdin to file
   md            Operate on metadata objects
+  fsck          Verify folder histories and their blocks
+  usage         Show how much block server space folders use
+  resolve       List and resolve conflicted copies
 
 `
 
@@ -64,6 +67,11 @@ func realMain() (exitStatus int) {
 		return 0
 	}
 
+	if err := libkbfs.ApplyInitConfig(kbfsParams, flag.CommandLine); err != nil {
+		printError("kbfs", err)
+		return 1
+	}
+
 	if len(flag.Args()) < 1 {
 		fmt.Print(getUsageString(kbCtx))
 		return 1
@@ -83,7 +91,7 @@ func realMain() (exitStatus int) {
 		return 1
 	}
 
-	defer libkbfs.Shutdown()
+	defer libkbfs.Shutdown(config)
 
 	// TODO: Make the logging level WARNING instead of INFO, or
 	// figure out some other way to log the full folder-branch
@@ -107,6 +115,12 @@ func realMain() (exitStatus int) {
 		return write(ctx, config, args)
 	case "md":
 		return mdMain(ctx, config, args)
+	case "fsck":
+		return fsck(ctx, config, args)
+	case "usage":
+		return usage(ctx, config, args)
+	case "resolve":
+		return resolve(ctx, config, args)
 	default:
 		printError("kbfs", fmt.Errorf("unknown command '%s'", cmd))
 		return 1
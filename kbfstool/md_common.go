@@ -57,6 +57,24 @@ func getTlfID(
 	return irmd.TlfID(), nil
 }
 
+// getTlfLabel returns a label for the TLF given as tlfStr: tlfStr
+// itself if it's a path, or the current path of the TLF along with
+// its ID if it's an ID.
+func getTlfLabel(
+	ctx context.Context, config libkbfs.Config, tlfStr string) string {
+	tlfID, err := tlf.ParseID(tlfStr)
+	if err != nil {
+		return tlfStr
+	}
+	h, err := config.KBFSOps().GetTLFHandle(ctx, tlfID)
+	if err != nil {
+		// The caller will notice any real problem with the
+		// TLF, so just go without the path.
+		return tlfStr
+	}
+	return fmt.Sprintf("%s (%s)", h.GetCanonicalPath(), tlfID)
+}
+
 func getBranchID(ctx context.Context, config libkbfs.Config,
 	tlfID tlf.ID, branchStr string) (libkbfs.BranchID, error) {
 	if branchStr == "master" {
@@ -0,0 +1,168 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+const mdExportKeysUsageStr = `Usage:
+  kbfstool md export-keys (-kid=<KID> | -paper-key-file=path/to/file) \
+    -o path/to/backup /keybase/private/user1,assertion2
+
+Writes the crypt keys of every key generation of the given private
+folder to a backup file, encrypted for the given public crypt key
+(e.g., an escrow key), or for the crypt key of the paper key whose
+phrase is in the given file. The backup can later be restored with
+'kbfstool md import-keys' on a device that doesn't have access to the
+folder.
+
+`
+
+func mdExportKeys(ctx context.Context, config libkbfs.Config,
+	args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs md export-keys", flag.ContinueOnError)
+	kid := flags.String("kid", "",
+		"KID of the public crypt key to encrypt the keys for.")
+	paperKeyFile := flags.String("paper-key-file", "",
+		"File holding the phrase of the paper key to encrypt the keys for.")
+	output := flags.String("o", "", "File to write the backup to.")
+	err := flags.Parse(args)
+	if err != nil {
+		printError("md export-keys", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) != 1 || *output == "" ||
+		(*kid == "") == (*paperKeyFile == "") {
+		fmt.Print(mdExportKeysUsageStr)
+		return 1
+	}
+
+	var backupKey kbfscrypto.CryptPublicKey
+	if *kid != "" {
+		k, err := keybase1.KIDFromStringChecked(*kid)
+		if err != nil {
+			printError("md export-keys", err)
+			return 1
+		}
+		backupKey = kbfscrypto.MakeCryptPublicKey(k)
+	} else {
+		_, cryptPrivateKey, err := libkbfs.ReadPaperKeyFile(*paperKeyFile)
+		if err != nil {
+			printError("md export-keys", err)
+			return 1
+		}
+		backupKey = cryptPrivateKey.GetPublicKey()
+	}
+
+	tlfID, err := getTlfID(ctx, config, inputs[0])
+	if err != nil {
+		printError("md export-keys", err)
+		return 1
+	}
+
+	backup, err := libkbfs.ExportTLFKeys(ctx, config, tlfID, backupKey)
+	if err != nil {
+		printError("md export-keys", err)
+		return 1
+	}
+
+	buf, err := config.Codec().Encode(backup)
+	if err != nil {
+		printError("md export-keys", err)
+		return 1
+	}
+
+	err = ioutil.WriteFile(*output, buf, 0600)
+	if err != nil {
+		printError("md export-keys", err)
+		return 1
+	}
+
+	fmt.Printf("Wrote the keys of %s to %s\n", inputs[0], *output)
+	return 0
+}
+
+const mdImportKeysUsageStr = `Usage:
+  kbfstool md import-keys -paper-key-file=path/to/file [-rekey] \
+    path/to/backup [backups...]
+
+Decrypts each backup written by 'kbfstool md export-keys' with the
+paper key whose phrase is in the given file. With -rekey, each folder
+is then rekeyed, which gives the current device permanent access to
+it; this only works if the current user is a writer of the folder.
+Without -rekey, this only checks that the backups can be restored.
+
+`
+
+func mdImportKeys(ctx context.Context, config libkbfs.Config,
+	args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs md import-keys", flag.ContinueOnError)
+	paperKeyFile := flags.String("paper-key-file", "",
+		"File holding the phrase of the paper key the keys are encrypted for.")
+	rekey := flags.Bool("rekey", false,
+		"Rekey each folder to give the current device access to it.")
+	err := flags.Parse(args)
+	if err != nil {
+		printError("md import-keys", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) < 1 || *paperKeyFile == "" {
+		fmt.Print(mdImportKeysUsageStr)
+		return 1
+	}
+
+	_, cryptPrivateKey, err := libkbfs.ReadPaperKeyFile(*paperKeyFile)
+	if err != nil {
+		printError("md import-keys", err)
+		return 1
+	}
+
+	for _, input := range inputs {
+		buf, err := ioutil.ReadFile(input)
+		if err != nil {
+			printError("md import-keys", err)
+			return 1
+		}
+
+		var backup libkbfs.TLFKeyBackup
+		err = config.Codec().Decode(buf, &backup)
+		if err != nil {
+			printError("md import-keys", err)
+			return 1
+		}
+
+		n, err := libkbfs.ImportTLFKeys(
+			ctx, config, backup, cryptPrivateKey)
+		if err != nil {
+			printError("md import-keys", err)
+			return 1
+		}
+		fmt.Printf("Imported %d key generations of folder %s from %s\n",
+			n, backup.Tlf, input)
+
+		if *rekey {
+			err = config.KBFSOps().Rekey(ctx, backup.Tlf)
+			if err != nil {
+				printError("md import-keys", err)
+				return 1
+			}
+			fmt.Printf("Rekeyed folder %s\n", backup.Tlf)
+		}
+	}
+
+	return 0
+}
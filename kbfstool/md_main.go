@@ -15,6 +15,9 @@ The possible subcommands are:
   check	      Check metadata objects and their associated blocks for errors
   reset	      Reset a broken top-level folder
   force-qr    Append a fake quota reclamation record to the folder history
+  rotate-key  Add a new key generation to a private folder
+  export-keys Back up the keys of a private folder
+  import-keys Restore the keys of a private folder from a backup
 `
 
 func mdMain(ctx context.Context, config libkbfs.Config, args []string) (exitStatus int) {
@@ -35,6 +38,12 @@ func mdMain(ctx context.Context, config libkbfs.Config, args []string) (exitStat
 		return mdReset(ctx, config, args)
 	case "force-qr":
 		return mdForceQR(ctx, config, args)
+	case "rotate-key":
+		return mdRotateKey(ctx, config, args)
+	case "export-keys":
+		return mdExportKeys(ctx, config, args)
+	case "import-keys":
+		return mdImportKeys(ctx, config, args)
 	default:
 		printError("md", fmt.Errorf("unknown command '%s'", cmd))
 		return 1
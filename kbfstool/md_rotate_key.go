@@ -0,0 +1,84 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+func mdRotateKeyOne(
+	ctx context.Context, config libkbfs.Config, tlfPath string) error {
+	irmd, _, err := mdGetMergedHeadForWriter(ctx, config, tlfPath)
+	if err != nil {
+		return err
+	}
+
+	if irmd == (libkbfs.ImmutableRootMetadata{}) {
+		// Fail, so that a periodic run doesn't silently rotate
+		// nothing.
+		return fmt.Errorf("Can't rotate the key of %s without a head",
+			tlfPath)
+	}
+
+	fmt.Printf("Rotating key generation %d of %s...\n",
+		irmd.LatestKeyGeneration(), tlfPath)
+
+	err = config.KBFSOps().RotateKey(ctx, irmd.TlfID())
+	if err != nil {
+		return err
+	}
+
+	irmd, err = config.MDOps().GetForTLF(ctx, irmd.TlfID())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Revision %d has key generation %d\n",
+		irmd.Revision(), irmd.LatestKeyGeneration())
+
+	return nil
+}
+
+const mdRotateKeyUsageStr = `Usage:
+  kbfstool md rotate-key /keybase/private/user1,assertion2 [tlfs...]
+
+Adds a new key generation to each given private folder, so that
+everything written from then on uses a key that no former reader or
+writer has ever had. To rotate keys on a schedule, run this
+periodically, e.g. from cron.
+
+`
+
+func mdRotateKey(ctx context.Context, config libkbfs.Config,
+	args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs md rotate-key", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		printError("md rotate-key", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) < 1 {
+		fmt.Print(mdRotateKeyUsageStr)
+		return 1
+	}
+
+	for _, input := range inputs {
+		err = mdRotateKeyOne(ctx, config, input)
+		if err != nil {
+			printError("md rotate-key", err)
+			return 1
+		}
+
+		fmt.Print("\n")
+	}
+
+	return 0
+}
@@ -0,0 +1,148 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/keybase/kbfs/fsrpc"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+const resolveUsageStr = `Usage:
+  kbfstool resolve /keybase/[public|private]/path/to/dir
+  kbfstool resolve /keybase/[public|private]/path/to/file
+  kbfstool resolve -keep [local|remote|both] /keybase/[public|private]/path/to/file
+
+Without -keep, lists the unresolved conflicts under a directory, or
+shows both versions of a conflicted file.  With -keep, resolves the
+conflict for the given file, which may be either the original or the
+conflicted copy:
+
+  local   keep the conflicted copy, replacing the original
+  remote  keep the original, removing the conflicted copy
+  both    keep both, renaming the conflicted copy to a plain copy
+
+`
+
+func printConflictVersion(label, name string, ei libkbfs.EntryInfo) {
+	mtimeStr := time.Unix(0, ei.Mtime).Format("Jan 02 15:04")
+	fmt.Printf("  %s:\t%s\t%d\t%s\t%s\n",
+		label, computeModeStr(ei.Type), ei.Size, mtimeStr, name)
+}
+
+func printConflict(c libkbfs.UnresolvedConflict) {
+	fmt.Printf("%s (from %s's %s on %s)\n",
+		c.OriginalPath(), c.Writer, c.Device, c.Date)
+	printConflictVersion("local", c.CopyPath(), c.Local)
+	printConflictVersion("remote", c.OriginalPath(), c.Remote)
+}
+
+func getConflictsForPath(ctx context.Context, config libkbfs.Config,
+	p fsrpc.Path) ([]libkbfs.UnresolvedConflict, error) {
+	if p.PathType != fsrpc.TLFPathType {
+		return nil, fmt.Errorf("%s is not a path within a folder", p)
+	}
+
+	n, ei, err := p.GetNode(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if ei.Type == libkbfs.Dir && len(p.TLFComponents) == 0 {
+		return libkbfs.ListUnresolvedConflicts(ctx, config.KBFSOps(), n)
+	}
+
+	dir, name, err := p.DirAndBasename()
+	if err != nil {
+		return nil, err
+	}
+	dirNode, err := dir.GetDirNode(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	conflicts, err := libkbfs.UnresolvedConflictsForName(
+		ctx, config.KBFSOps(), dirNode, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflicts) == 0 && ei.Type == libkbfs.Dir {
+		// Not itself in conflict, so list what's inside.
+		return libkbfs.ListUnresolvedConflicts(ctx, config.KBFSOps(), n)
+	}
+	return conflicts, nil
+}
+
+func resolve(ctx context.Context, config libkbfs.Config, args []string) (exitStatus int) {
+	flags := flag.NewFlagSet("kbfs resolve", flag.ContinueOnError)
+	keep := flags.String("keep", "",
+		"Which version to keep: local, remote or both.")
+	err := flags.Parse(args)
+	if err != nil {
+		printError("resolve", err)
+		return 1
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Print(resolveUsageStr)
+		return 1
+	}
+
+	p, err := fsrpc.NewPath(flags.Arg(0))
+	if err != nil {
+		printError("resolve", err)
+		return 1
+	}
+
+	conflicts, err := getConflictsForPath(ctx, config, p)
+	if err != nil {
+		printError("resolve", err)
+		return 1
+	}
+
+	if *keep == "" {
+		if len(conflicts) == 0 {
+			fmt.Printf("No unresolved conflicts in %s\n", p)
+			return 0
+		}
+		for _, c := range conflicts {
+			printConflict(c)
+		}
+		return 0
+	}
+
+	choice, err := libkbfs.ParseConflictChoice(*keep)
+	if err != nil {
+		printError("resolve", err)
+		return 1
+	}
+
+	switch len(conflicts) {
+	case 0:
+		printError("resolve", fmt.Errorf("%s is not in conflict", p))
+		return 1
+	case 1:
+	default:
+		for _, c := range conflicts {
+			printConflict(c)
+		}
+		printError("resolve", fmt.Errorf(
+			"%s has %d conflicts; name the conflicted copy to resolve",
+			p, len(conflicts)))
+		return 1
+	}
+
+	err = libkbfs.ResolveConflict(ctx, config.KBFSOps(), conflicts[0], choice)
+	if err != nil {
+		printError("resolve", err)
+		return 1
+	}
+
+	fmt.Printf("Resolved %s by keeping %s\n", conflicts[0].OriginalPath(), choice)
+	return 0
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+const usageUsageStr = `Usage:
+  kbfstool usage /keybase/[public|private]/user1,assertion2 [tlfs...]
+
+Each TLF may also be given as a TLF ID. Prints how many bytes each TLF
+uses on the block server, both live and archived. Local block servers
+only give an estimate.
+
+`
+
+func usage(ctx context.Context, config libkbfs.Config, args []string) (
+	exitStatus int) {
+	flags := flag.NewFlagSet("kbfs usage", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		printError("usage", err)
+		return 1
+	}
+
+	inputs := flags.Args()
+	if len(inputs) < 1 {
+		fmt.Print(usageUsageStr)
+		return 1
+	}
+
+	for _, input := range inputs {
+		tlfID, err := getTlfID(ctx, config, input)
+		if err != nil {
+			printError("usage", err)
+			return 1
+		}
+
+		usage, err := config.BlockServer().GetTLFUsageInfo(ctx, tlfID)
+		if err != nil {
+			printError("usage", err)
+			return 1
+		}
+
+		written := usage.Bytes[kbfsblock.UsageWrite]
+		archived := usage.Bytes[kbfsblock.UsageArchive]
+		fmt.Printf("%s: %d bytes live, %d bytes archived "+
+			"(%d blocks total)\n", getTlfLabel(ctx, config, input),
+			written-archived, archived,
+			usage.Blocks[kbfsblock.UsageWrite])
+	}
+
+	return 0
+}
@@ -470,22 +470,31 @@ func (d *Dir) FindFiles(ctx context.Context, fi *dokan.FileInfo, ignored string,
 	d.folder.fs.logEnter(ctx, "Dir FindFiles")
 	defer func() { d.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
 
-	children, err := d.folder.fs.config.KBFSOps().GetDirChildren(ctx, d.node)
-	if err != nil {
-		return err
-	}
-
+	// Page through the directory, so huge directories don't have to
+	// be listed all at once.
 	empty := true
 	var ns dokan.NamedStat
-	for name, de := range children {
-		empty = false
-		ns.Name = name
-		// TODO perhaps resolve symlinks here?
-		fillStat(&ns.Stat, &de)
-		err = callback(&ns)
+	after := ""
+	for {
+		children, more, err := d.folder.fs.config.KBFSOps().
+			GetDirChildrenPage(ctx, d.node, after, findFilesPageSize)
 		if err != nil {
 			return err
 		}
+		for _, child := range children {
+			empty = false
+			ns.Name = child.Name
+			// TODO perhaps resolve symlinks here?
+			fillStat(&ns.Stat, &child.EntryInfo)
+			err = callback(&ns)
+			if err != nil {
+				return err
+			}
+			after = child.Name
+		}
+		if !more {
+			break
+		}
 	}
 	if empty {
 		return dokan.ErrObjectNameNotFound
@@ -493,13 +502,19 @@ func (d *Dir) FindFiles(ctx context.Context, fi *dokan.FileInfo, ignored string,
 	return nil
 }
 
+// findFilesPageSize is the number of directory entries FindFiles
+// fetches at a time.
+const findFilesPageSize = 1000
+
 // CanDeleteDirectory - return just nil
 // TODO check for permissions here.
 func (d *Dir) CanDeleteDirectory(ctx context.Context, fi *dokan.FileInfo) (err error) {
 	d.folder.fs.logEnterf(ctx, "Dir CanDeleteDirectory %q", d.name)
 	defer func() { d.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 
-	children, err := d.folder.fs.config.KBFSOps().GetDirChildren(ctx, d.node)
+	// One entry is enough to know the directory isn't empty.
+	children, _, err := d.folder.fs.config.KBFSOps().GetDirChildrenPage(
+		ctx, d.node, "", 1)
 	if err != nil {
 		return errToDokan(err)
 	}
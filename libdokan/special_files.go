@@ -17,11 +17,17 @@ func handleTLFSpecialFile(name string, folder *Folder) dokan.File {
 	case libfs.StatusFileName:
 		return NewTLFStatusFile(folder)
 
+	case libfs.SyncStatusFileName:
+		return NewTLFSyncStatusFile(folder)
+
 		// TODO: Port over UpdateHistoryFile.
 
 	case libfs.EditHistoryName:
 		return NewTlfEditHistoryFile(folder)
 
+	case libfs.ActivityLogName:
+		return NewTlfActivityLogFile(folder)
+
 	case libfs.UnstageFileName:
 		return &UnstageFile{
 			folder: folder,
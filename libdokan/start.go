@@ -40,7 +40,7 @@ func Start(mounter Mounter, options StartOptions, kbCtx libkbfs.Context) *libfs.
 		return libfs.InitError(err.Error())
 	}
 
-	defer libkbfs.Shutdown()
+	defer libkbfs.Shutdown(config)
 
 	if options.RuntimeDir != "" {
 		info := libkb.NewServiceInfo(libkbfs.Version, libkbfs.PrereleaseBuild, options.Label, os.Getpid())
@@ -33,3 +33,15 @@ func NewTLFStatusFile(folder *Folder) *SpecialReadFile {
 		fs: folder.fs,
 	}
 }
+
+// NewTLFSyncStatusFile returns a special read file that contains a
+// summary of the sync status of the current TLF.
+func NewTLFSyncStatusFile(folder *Folder) *SpecialReadFile {
+	return &SpecialReadFile{
+		read: func(ctx context.Context) ([]byte, time.Time, error) {
+			return libfs.GetEncodedTlfSyncStatus(
+				ctx, folder.fs.config, folder.getFolderBranch())
+		},
+		fs: folder.fs,
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libdokan
+
+import (
+	"time"
+
+	"github.com/keybase/kbfs/libfs"
+	"golang.org/x/net/context"
+)
+
+// NewTlfActivityLogFile returns a special read file that contains a
+// text representation of the activity log kept on this device for
+// that TLF.
+func NewTlfActivityLogFile(folder *Folder) *SpecialReadFile {
+	return &SpecialReadFile{
+		read: func(ctx context.Context) ([]byte, time.Time, error) {
+			return libfs.GetEncodedTlfActivityLog(
+				ctx, folder.fs.config, folder.getFolderBranch())
+		},
+		fs: folder.fs,
+	}
+}
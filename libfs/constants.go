@@ -20,6 +20,10 @@ const RekeyFileName = ".kbfs_rekey"
 // anywhere within a top-level folder or inside the Keybase root
 const StatusFileName = ".kbfs_status"
 
+// SyncStatusFileName is the name of the KBFS TLF sync status file
+// -- it can be reached anywhere within a top-level folder.
+const SyncStatusFileName = ".kbfs_sync_status"
+
 // SyncFromServerFileName is the name of the KBFS sync-from-server
 // file -- it can be reached anywhere within a top-level folder.
 const SyncFromServerFileName = ".kbfs_sync_from_server"
@@ -82,5 +86,20 @@ const DisableBlockPrefetchingFileName = ".kbfs_disable_block_prefetching"
 // it can be reached anywhere within a top-level folder.
 const EditHistoryName = ".kbfs_edit_history"
 
+// ActivityLogName is the name of the KBFS TLF activity log file --
+// it can be reached anywhere within a top-level folder.
+const ActivityLogName = ".kbfs_activity"
+
+// ArchivedDirName is the name of the KBFS TLF directory through
+// which past revisions of the folder can be browsed, as
+// ArchivedDirName/rev=N/path/to/file.  It can be reached anywhere
+// within a top-level folder, but paths under it always start at the
+// root of the folder.
+const ArchivedDirName = ".kbfs_archived"
+
+// ArchivedRevPrefix is the prefix of the per-revision directories
+// within ArchivedDirName.
+const ArchivedRevPrefix = "rev="
+
 // FileInfoPrefix is the prefix of the per-file metadata files.
 const FileInfoPrefix = ".kbfs_fileinfo_"
@@ -18,7 +18,7 @@ import (
 type JournalAction int
 
 const (
-	// JournalEnable is to turn the journal on.
+	// JournalEnable is to turn the journal on, persistently.
 	JournalEnable JournalAction = iota
 	// JournalFlush is to flush the journal.
 	JournalFlush
@@ -28,7 +28,8 @@ const (
 	// JournalResumeBackgroundWork is to resume journal background
 	// work.
 	JournalResumeBackgroundWork
-	// JournalDisable is to disable the journal.
+	// JournalDisable is to flush and then disable the journal,
+	// persistently.
 	JournalDisable
 	// JournalEnableAuto is to turn on journals for all TLFs, persistently.
 	JournalEnableAuto
@@ -76,8 +77,7 @@ func (a JournalAction) Execute(
 
 	switch a {
 	case JournalEnable:
-		err := jServer.Enable(
-			ctx, tlfID, libkbfs.TLFJournalBackgroundWorkEnabled)
+		err := jServer.SetTLFJournalEnabled(ctx, tlfID, true)
 		if err != nil {
 			return err
 		}
@@ -95,7 +95,7 @@ func (a JournalAction) Execute(
 		jServer.ResumeBackgroundWork(ctx, tlfID)
 
 	case JournalDisable:
-		_, err := jServer.Disable(ctx, tlfID)
+		err := jServer.SetTLFJournalEnabled(ctx, tlfID, false)
 		if err != nil {
 			return err
 		}
@@ -26,6 +26,66 @@ func GetEncodedFolderStatus(ctx context.Context, config libkbfs.Config,
 	return
 }
 
+// TlfSyncStatus is a summary of whether the local state of a folder
+// has made it to the server, and whether the folder has the latest
+// state from the server.  It is a subset of libkbfs.FolderBranchStatus
+// that is easy to check from a script.
+type TlfSyncStatus struct {
+	// InSync is true when there are no local changes waiting to
+	// be flushed or resolved.
+	InSync   bool
+	SyncMode libkbfs.TlfSyncMode
+	Revision libkbfs.MetadataRevision
+	// Staged is true when local changes conflict with the server,
+	// and are waiting for conflict resolution.
+	Staged bool
+	// DirtyPaths are files that have been written, but not yet
+	// flushed to the journal or the server.
+	DirtyPaths []string
+	// UnflushedPaths and UnflushedBytes describe the changes in
+	// the journal that haven't been flushed to the server yet.
+	UnflushedPaths []string
+	UnflushedBytes int64
+	LastFlushErr   string `json:",omitempty"`
+	LastFlushTime  time.Time
+	PermanentErr   string `json:",omitempty"`
+}
+
+// GetEncodedTlfSyncStatus returns serialized JSON containing the sync
+// status for a folder.
+func GetEncodedTlfSyncStatus(ctx context.Context, config libkbfs.Config,
+	folderBranch libkbfs.FolderBranch) (
+	data []byte, t time.Time, err error) {
+	status, _, err := config.KBFSOps().FolderStatus(ctx, folderBranch)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	syncStatus := TlfSyncStatus{
+		SyncMode:     status.SyncMode,
+		Revision:     status.Revision,
+		Staged:       status.Staged,
+		DirtyPaths:   status.DirtyPaths,
+		PermanentErr: status.PermanentErr,
+	}
+	if status.Journal != nil {
+		syncStatus.UnflushedPaths = status.Journal.UnflushedPaths
+		syncStatus.UnflushedBytes = status.Journal.UnflushedBytes
+		syncStatus.LastFlushErr = status.Journal.LastFlushErr
+		syncStatus.LastFlushTime = status.Journal.LastFlushTime
+		if status.Journal.OnConflictBranch {
+			syncStatus.Staged = true
+		}
+	}
+	syncStatus.InSync = !syncStatus.Staged &&
+		len(syncStatus.DirtyPaths) == 0 &&
+		(status.Journal == nil || status.Journal.MDOpCount == 0) &&
+		syncStatus.UnflushedBytes == 0
+
+	data, err = PrettyJSON(syncStatus)
+	return
+}
+
 // GetEncodedStatus returns serialized JSON containing top-level KBFS status
 // information
 func GetEncodedStatus(ctx context.Context, config libkbfs.Config) (
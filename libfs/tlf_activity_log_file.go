@@ -0,0 +1,27 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfs
+
+import (
+	"time"
+
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// GetEncodedTlfActivityLog returns serialized JSON containing the
+// activity log kept on this device for a folder.
+func GetEncodedTlfActivityLog(ctx context.Context, config libkbfs.Config,
+	folderBranch libkbfs.FolderBranch) (
+	data []byte, t time.Time, err error) {
+	entries, err := config.KBFSOps().GetActivityLog(
+		ctx, folderBranch, time.Time{})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	data, err = PrettyJSON(entries)
+	return data, time.Time{}, err
+}
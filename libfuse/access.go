@@ -0,0 +1,161 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+// uidList is a flag.Value holding a comma-separated list of OS user
+// IDs.
+type uidList []uint32
+
+var _ flag.Value = (*uidList)(nil)
+
+func (l *uidList) String() string {
+	if l == nil {
+		return ""
+	}
+	strs := make([]string, 0, len(*l))
+	for _, uid := range *l {
+		strs = append(strs, strconv.FormatUint(uint64(uid), 10))
+	}
+	return strings.Join(strs, ",")
+}
+
+// Set implements the flag.Value interface for uidList.
+func (l *uidList) Set(s string) error {
+	var uids uidList
+	for _, str := range strings.Split(s, ",") {
+		str = strings.TrimSpace(str)
+		if str == "" {
+			continue
+		}
+		uid, err := strconv.ParseUint(str, 10, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid uid %q: %v", str, err)
+		}
+		uids = append(uids, uint32(uid))
+	}
+	*l = uids
+	return nil
+}
+
+// AccessParams control which local users, other than the one running
+// KBFS, may use the mount.
+type AccessParams struct {
+	// AllowOther mounts with allow_other, so that the kernel
+	// passes on requests from other users at all.  On Linux, this
+	// needs user_allow_other in /etc/fuse.conf unless KBFS runs as
+	// root.
+	AllowOther bool
+	// ReaderUIDs are the other users (e.g., 0 for root-run system
+	// services) that may read, but not change, anything in the
+	// mount.  Requests from any other user are refused.
+	ReaderUIDs uidList
+}
+
+func addAccessFlags(flags *flag.FlagSet, params *AccessParams) {
+	flags.BoolVar(&params.AllowOther, "allow-other", false,
+		"Let users other than the current one reach the mount; "+
+			"only those listed in -reader-uids can read it")
+	flags.Var(&params.ReaderUIDs, "reader-uids",
+		"Comma-separated uids of other users allowed read-only access "+
+			"to the mount, when -allow-other is set")
+}
+
+func (p AccessParams) mountOptions() []fuse.MountOption {
+	if !p.AllowOther {
+		return nil
+	}
+	return []fuse.MountOption{fuse.AllowOther()}
+}
+
+// accessLevel says what a local user may do in the mount.
+type accessLevel int
+
+const (
+	accessNone accessLevel = iota
+	accessRead
+	accessFull
+)
+
+// accessFor returns the access level of the given OS user.
+func (p AccessParams) accessFor(uid uint32) accessLevel {
+	if uid == uint32(os.Getuid()) {
+		return accessFull
+	}
+	if !p.AllowOther {
+		// The kernel shouldn't let anyone else in anyway, except
+		// that osxfuse passes on some requests (e.g., GETXATTR)
+		// from root; Finder relies on those.  See KBFS-1733.
+		if uid == 0 {
+			return accessRead
+		}
+		return accessNone
+	}
+	for _, r := range p.ReaderUIDs {
+		if uid == r {
+			return accessRead
+		}
+	}
+	return accessNone
+}
+
+type ctxRequestAccessKeyType int
+
+const ctxRequestAccessKey ctxRequestAccessKeyType = iota
+
+// requestAccess is who made a FUSE request, and what they may do.
+type requestAccess struct {
+	uid   uint32
+	level accessLevel
+}
+
+// withRequestAccess returns a context that remembers which OS user
+// made the given FUSE request, and with what access level, for
+// checkAccess.  Every request gets one before it reaches any node, so
+// that nodes (including those that don't know their FS) can check it.
+func (p AccessParams) withRequestAccess(
+	ctx context.Context, req fuse.Request) context.Context {
+	if req == nil {
+		return ctx
+	}
+	uid := req.Hdr().Uid
+	return context.WithValue(ctx, ctxRequestAccessKey,
+		requestAccess{uid, p.accessFor(uid)})
+}
+
+// checkAccess returns an error if the OS user making the request in
+// ctx may not read the mount, or may not change it when write is
+// true.  Every node entry point that reveals or changes anything must
+// call it: the kernel caches lookups, and the mount doesn't use
+// default_permissions, so a node can be reached without going
+// through its parents again.  Contexts that don't come from a FUSE
+// request (e.g., from tests) are treated as coming from the current
+// user.
+func checkAccess(ctx context.Context, write bool) error {
+	ra, ok := ctx.Value(ctxRequestAccessKey).(requestAccess)
+	if !ok {
+		return nil
+	}
+	switch ra.level {
+	case accessFull:
+		return nil
+	case accessRead:
+		if !write {
+			return nil
+		}
+	}
+	return fuse.Errno(syscall.EACCES)
+}
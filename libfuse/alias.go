@@ -32,5 +32,9 @@ var _ fs.NodeReadlinker = (*Alias)(nil)
 
 // Readlink implements the fs.NodeReadlinker interface for Alias.
 func (a *Alias) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	if err := checkAccess(ctx, false); err != nil {
+		return "", err
+	}
+
 	return a.realPath, nil
 }
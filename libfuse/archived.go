@@ -0,0 +1,305 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/keybase/kbfs/libfs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// ArchivedRoot is the libfs.ArchivedDirName directory of a TLF.  It
+// contains one directory per past revision of the folder, named
+// libfs.ArchivedRevPrefix followed by the revision number.  They
+// aren't listed, since there can be a great many of them, but any of
+// them can be looked up.
+type ArchivedRoot struct {
+	folder *Folder
+}
+
+var _ fs.Node = (*ArchivedRoot)(nil)
+
+// Attr implements the fs.Node interface for ArchivedRoot.
+func (r *ArchivedRoot) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0500
+	a.Uid = uint32(os.Getuid())
+	return nil
+}
+
+var _ fs.NodeRequestLookuper = (*ArchivedRoot)(nil)
+
+// Lookup implements the fs.NodeRequestLookuper interface for
+// ArchivedRoot.
+func (r *ArchivedRoot) Lookup(ctx context.Context,
+	req *fuse.LookupRequest, resp *fuse.LookupResponse) (
+	node fs.Node, err error) {
+	r.folder.fs.log.CDebugf(ctx, "ArchivedRoot Lookup %s", req.Name)
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+	defer func() { r.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+
+	if !strings.HasPrefix(req.Name, libfs.ArchivedRevPrefix) {
+		return nil, fuse.ENOENT
+	}
+	rev, err := strconv.ParseInt(
+		req.Name[len(libfs.ArchivedRevPrefix):], 10, 64)
+	if err != nil {
+		return nil, fuse.ENOENT
+	}
+
+	// Make sure the revision exists before handing out a node for it.
+	d := &ArchivedDir{archivedNode{
+		folder: r.folder,
+		rev:    libkbfs.MetadataRevision(rev),
+	}}
+	_, err = r.folder.fs.config.KBFSOps().GetArchivedEntry(
+		ctx, r.folder.getFolderBranch(), d.rev, nil)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+var _ fs.HandleReadDirAller = (*ArchivedRoot)(nil)
+
+// ReadDirAll implements the fs.HandleReadDirAller interface for
+// ArchivedRoot.
+func (r *ArchivedRoot) ReadDirAll(ctx context.Context) (
+	[]fuse.Dirent, error) {
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+
+	return []fuse.Dirent{}, nil
+}
+
+// archivedNode is the part common to all the nodes below an
+// ArchivedRoot: the folder, the revision being browsed, and the path
+// of the node from the root of the folder.
+type archivedNode struct {
+	folder *Folder
+	rev    libkbfs.MetadataRevision
+	path   []string
+}
+
+func (n archivedNode) childPath(name string) []string {
+	p := make([]string, 0, len(n.path)+1)
+	p = append(p, n.path...)
+	return append(p, name)
+}
+
+func (n archivedNode) fillAttr(ei libkbfs.EntryInfo, a *fuse.Attr) {
+	// Nothing at a past revision ever changes.
+	a.Valid = 1 * time.Minute
+
+	a.Size = ei.Size
+	a.Mtime = time.Unix(0, ei.Mtime)
+	a.Ctime = time.Unix(0, ei.Ctime)
+	a.Uid = uint32(os.Getuid())
+
+	switch ei.Type {
+	case libkbfs.Dir:
+		a.Mode = os.ModeDir | 0500
+	case libkbfs.Exec:
+		a.Mode = 0500
+	case libkbfs.Sym:
+		a.Mode = os.ModeSymlink | 0777
+	default:
+		a.Mode = 0400
+	}
+}
+
+func (n archivedNode) attr(ctx context.Context, a *fuse.Attr) error {
+	ei, err := n.folder.fs.config.KBFSOps().GetArchivedEntry(
+		ctx, n.folder.getFolderBranch(), n.rev, n.path)
+	if err != nil {
+		return err
+	}
+	n.fillAttr(ei, a)
+	return nil
+}
+
+// ArchivedDir is a directory as of a past revision of a TLF.
+type ArchivedDir struct {
+	archivedNode
+}
+
+var _ fs.Node = (*ArchivedDir)(nil)
+
+// Attr implements the fs.Node interface for ArchivedDir.
+func (d *ArchivedDir) Attr(ctx context.Context, a *fuse.Attr) (err error) {
+	d.folder.fs.log.CDebugf(ctx, "ArchivedDir Attr rev=%d", d.rev)
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
+	defer func() { d.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+	return d.attr(ctx, a)
+}
+
+var _ fs.NodeRequestLookuper = (*ArchivedDir)(nil)
+
+// Lookup implements the fs.NodeRequestLookuper interface for
+// ArchivedDir.
+func (d *ArchivedDir) Lookup(ctx context.Context,
+	req *fuse.LookupRequest, resp *fuse.LookupResponse) (
+	node fs.Node, err error) {
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+
+	d.folder.fs.log.CDebugf(ctx, "ArchivedDir Lookup rev=%d %s",
+		d.rev, req.Name)
+	defer func() { d.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+
+	p := d.childPath(req.Name)
+	ei, err := d.folder.fs.config.KBFSOps().GetArchivedEntry(
+		ctx, d.folder.getFolderBranch(), d.rev, p)
+	if err != nil {
+		if _, ok := err.(libkbfs.NoSuchNameError); ok {
+			return nil, fuse.ENOENT
+		}
+		return nil, err
+	}
+
+	// Revisions never change, so the kernel may cache this entry
+	// for as long as it likes.
+	resp.EntryValid = 1 * time.Minute
+
+	switch ei.Type {
+	default:
+		return nil, fmt.Errorf("unhandled entry type: %v", ei.Type)
+	case libkbfs.File, libkbfs.Exec:
+		return &ArchivedFile{archivedNode{d.folder, d.rev, p}}, nil
+	case libkbfs.Dir:
+		return &ArchivedDir{archivedNode{d.folder, d.rev, p}}, nil
+	case libkbfs.Sym:
+		return &ArchivedSymlink{archivedNode{d.folder, d.rev, p}}, nil
+	}
+}
+
+var _ fs.HandleReadDirAller = (*ArchivedDir)(nil)
+
+// ReadDirAll implements the fs.HandleReadDirAller interface for
+// ArchivedDir.
+func (d *ArchivedDir) ReadDirAll(ctx context.Context) (
+	res []fuse.Dirent, err error) {
+	d.folder.fs.log.CDebugf(ctx, "ArchivedDir ReadDirAll rev=%d", d.rev)
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+	defer func() { d.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+
+	children, err := d.folder.fs.config.KBFSOps().GetArchivedDirChildren(
+		ctx, d.folder.getFolderBranch(), d.rev, d.path)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, ei := range children {
+		fde := fuse.Dirent{
+			Name: name,
+		}
+		switch ei.Type {
+		case libkbfs.File, libkbfs.Exec:
+			fde.Type = fuse.DT_File
+		case libkbfs.Dir:
+			fde.Type = fuse.DT_Dir
+		case libkbfs.Sym:
+			fde.Type = fuse.DT_Link
+		}
+		res = append(res, fde)
+	}
+	return res, nil
+}
+
+// ArchivedFile is a read-only file as of a past revision of a TLF.
+type ArchivedFile struct {
+	archivedNode
+}
+
+var _ fs.Node = (*ArchivedFile)(nil)
+
+// Attr implements the fs.Node interface for ArchivedFile.
+func (f *ArchivedFile) Attr(ctx context.Context, a *fuse.Attr) (err error) {
+	f.folder.fs.log.CDebugf(ctx, "ArchivedFile Attr rev=%d", f.rev)
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
+	defer func() { f.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+	return f.attr(ctx, a)
+}
+
+var _ fs.HandleReader = (*ArchivedFile)(nil)
+
+// Read implements the fs.HandleReader interface for ArchivedFile.
+func (f *ArchivedFile) Read(ctx context.Context, req *fuse.ReadRequest,
+	resp *fuse.ReadResponse) (err error) {
+	f.folder.fs.log.CDebugf(ctx, "ArchivedFile Read rev=%d", f.rev)
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
+	defer func() { f.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+
+	n, err := f.folder.fs.config.KBFSOps().ReadArchived(
+		ctx, f.folder.getFolderBranch(), f.rev, f.path,
+		resp.Data[:cap(resp.Data)], req.Offset)
+	if err != nil {
+		return err
+	}
+	resp.Data = resp.Data[:n]
+	return nil
+}
+
+// ArchivedSymlink is a symlink as of a past revision of a TLF.
+type ArchivedSymlink struct {
+	archivedNode
+}
+
+var _ fs.Node = (*ArchivedSymlink)(nil)
+
+// Attr implements the fs.Node interface for ArchivedSymlink.
+func (s *ArchivedSymlink) Attr(ctx context.Context, a *fuse.Attr) (
+	err error) {
+	s.folder.fs.log.CDebugf(ctx, "ArchivedSymlink Attr rev=%d", s.rev)
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
+	defer func() { s.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+	return s.attr(ctx, a)
+}
+
+var _ fs.NodeReadlinker = (*ArchivedSymlink)(nil)
+
+// Readlink implements the fs.NodeReadlinker interface for
+// ArchivedSymlink.
+func (s *ArchivedSymlink) Readlink(ctx context.Context,
+	req *fuse.ReadlinkRequest) (link string, err error) {
+	s.folder.fs.log.CDebugf(ctx, "ArchivedSymlink Readlink rev=%d", s.rev)
+	if err := checkAccess(ctx, false); err != nil {
+		return "", err
+	}
+	defer func() { s.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+
+	ei, err := s.folder.fs.config.KBFSOps().GetArchivedEntry(
+		ctx, s.folder.getFolderBranch(), s.rev, s.path)
+	if err != nil {
+		return "", err
+	}
+	dirPath := path.Join(append([]string{libfs.ArchivedDirName,
+		fmt.Sprintf("%s%d", libfs.ArchivedRevPrefix, s.rev)},
+		s.path[:len(s.path)-1]...)...)
+	return s.folder.fs.applySymlinkPolicy(ctx,
+		s.folder.mountPath(dirPath), ei.SymPath)
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// +build !darwin
+
+package libfuse
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/pkg/errors"
+)
+
+// autostartUnitName is the name of the systemd user unit that mounts
+// KBFS at login.
+const autostartUnitName = "kbfs.service"
+
+func autostartUnitPath() (string, error) {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return "", errors.New("Neither XDG_CONFIG_HOME nor HOME is set")
+		}
+		configDir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configDir, "systemd", "user", autostartUnitName), nil
+}
+
+func systemctlUser(args ...string) error {
+	out, err := exec.Command(
+		"systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "systemctl --user %v: %s", args, out)
+	}
+	return nil
+}
+
+// InstallAutostart installs and enables a systemd user unit that runs
+// the kbfsfuse binary at exe with the given arguments whenever the
+// user logs in.
+func InstallAutostart(exe string, args []string) error {
+	unitPath, err := autostartUnitPath()
+	if err != nil {
+		return err
+	}
+
+	var execStart bytes.Buffer
+	execStart.WriteString(strconv.Quote(exe))
+	for _, arg := range args {
+		execStart.WriteString(" ")
+		execStart.WriteString(strconv.Quote(arg))
+	}
+	unit := fmt.Sprintf(`[Unit]
+Description=Keybase file system
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+
+[Install]
+WantedBy=default.target
+`, execStart.String())
+
+	if err := ioutil.MkdirAll(filepath.Dir(unitPath), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(unitPath, []byte(unit), 0644); err != nil {
+		return err
+	}
+	if err := systemctlUser("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctlUser("enable", autostartUnitName)
+}
+
+// UninstallAutostart disables and removes the unit installed by
+// InstallAutostart.  It doesn't stop a running kbfsfuse.
+func UninstallAutostart() error {
+	unitPath, err := autostartUnitPath()
+	if err != nil {
+		return err
+	}
+	if err := systemctlUser("disable", autostartUnitName); err != nil {
+		return err
+	}
+	if err := ioutil.Remove(unitPath); err != nil &&
+		!ioutil.IsNotExist(err) {
+		return err
+	}
+	return systemctlUser("daemon-reload")
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// +build darwin
+
+package libfuse
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/pkg/errors"
+)
+
+// autostartLabel is the label of the launchd agent that mounts KBFS
+// at login.
+const autostartLabel = "keybase.kbfsfuse"
+
+func autostartPlistPath() (string, error) {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return "", errors.New("HOME is not set")
+	}
+	return filepath.Join(
+		home, "Library", "LaunchAgents", autostartLabel+".plist"), nil
+}
+
+func launchctl(args ...string) error {
+	out, err := exec.Command("/bin/launchctl", args...).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "launchctl %v: %s", args, out)
+	}
+	return nil
+}
+
+// InstallAutostart installs and loads a launchd agent that runs the
+// kbfsfuse binary at exe with the given arguments whenever the user
+// logs in.
+func InstallAutostart(exe string, args []string) error {
+	plistPath, err := autostartPlistPath()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	writeString := func(s string) error {
+		buf.WriteString("\t\t<string>")
+		if err := xml.EscapeText(&buf, []byte(s)); err != nil {
+			return err
+		}
+		buf.WriteString("</string>\n")
+		return nil
+	}
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>` + autostartLabel + `</string>
+	<key>ProgramArguments</key>
+	<array>
+`)
+	for _, arg := range append([]string{exe}, args...) {
+		if err := writeString(arg); err != nil {
+			return err
+		}
+	}
+	buf.WriteString(`	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+</dict>
+</plist>
+`)
+
+	if err := ioutil.MkdirAll(filepath.Dir(plistPath), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(plistPath, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return launchctl("load", "-w", plistPath)
+}
+
+// UninstallAutostart unloads and removes the agent installed by
+// InstallAutostart.  Unloading it also stops a kbfsfuse it started.
+func UninstallAutostart() error {
+	plistPath, err := autostartPlistPath()
+	if err != nil {
+		return err
+	}
+	if err := launchctl("unload", "-w", plistPath); err != nil {
+		return err
+	}
+	if err := ioutil.Remove(plistPath); err != nil &&
+		!ioutil.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -4,6 +4,9 @@
 
 package libfuse
 
+// DefaultVolumeName is the name Finder shows for the mount by default.
+const DefaultVolumeName = "Keybase"
+
 // VolIconFileName is the name of the special icon file in macOS for
 // the mount.
 const VolIconFileName = ".VolumeIcon.icns"
@@ -159,7 +159,7 @@ func (f *Folder) resolve(ctx context.Context) (*libkbfs.TlfHandle, error) {
 	return handle, nil
 }
 
-// invalidateNodeDataRange notifies the kernel to invalidate cached data for node.
+// invalidateNodeDataRange notifies the kernel, through srv, to invalidate cached data for node.
 //
 // The arguments follow KBFS semantics:
 //
@@ -170,7 +170,8 @@ func (f *Folder) resolve(ctx context.Context) (*libkbfs.TlfHandle, error) {
 //
 //     - Len < 0: "forget data in range Off..infinity"
 //     - Len > 0: "forget data in range Off..Off+Len"
-func (f *Folder) invalidateNodeDataRange(node fs.Node, write libkbfs.WriteRange) error {
+func (f *Folder) invalidateNodeDataRange(srv *fs.Server, node fs.Node,
+	write libkbfs.WriteRange) error {
 	if file, ok := node.(*File); ok {
 		file.eiCache.destroy()
 	}
@@ -187,7 +188,7 @@ func (f *Folder) invalidateNodeDataRange(node fs.Node, write libkbfs.WriteRange)
 	}
 	// Off=0 Len=0 is the same as calling InvalidateNodeDataAttr; we
 	// can just let that go through InvalidateNodeDataRange.
-	if err := f.fs.fuse.InvalidateNodeDataRange(node, off, size); err != nil {
+	if err := srv.InvalidateNodeDataRange(node, off, size); err != nil {
 		return err
 	}
 	return nil
@@ -195,8 +196,7 @@ func (f *Folder) invalidateNodeDataRange(node fs.Node, write libkbfs.WriteRange)
 
 // LocalChange is called for changes originating within in this process.
 func (f *Folder) LocalChange(ctx context.Context, node libkbfs.Node, write libkbfs.WriteRange) {
-	if !f.fs.conn.Protocol().HasInvalidate() {
-		// OSXFUSE 2.x does not support notifications
+	if !f.fs.canInvalidate() {
 		return
 	}
 	if origin, ok := ctx.Value(libfs.CtxAppIDKey).(*FS); ok && origin == f.fs {
@@ -217,7 +217,12 @@ func (f *Folder) localChangeInvalidate(ctx context.Context, node libkbfs.Node,
 		return
 	}
 
-	if err := f.invalidateNodeDataRange(n, write); err != nil && err != fuse.ErrNotCached {
+	srv := f.fs.fuseServer()
+	if srv == nil {
+		// Not mounted right now, so nothing is cached.
+		return
+	}
+	if err := f.invalidateNodeDataRange(srv, n, write); err != nil && err != fuse.ErrNotCached {
 		// TODO we have no mechanism to do anything about this
 		f.fs.log.CErrorf(ctx, "FUSE invalidate error: %v", err)
 	}
@@ -226,8 +231,7 @@ func (f *Folder) localChangeInvalidate(ctx context.Context, node libkbfs.Node,
 // BatchChanges is called for changes originating anywhere, including
 // other hosts.
 func (f *Folder) BatchChanges(ctx context.Context, changes []libkbfs.NodeChange) {
-	if !f.fs.conn.Protocol().HasInvalidate() {
-		// OSXFUSE 2.x does not support notifications
+	if !f.fs.canInvalidate() {
 		return
 	}
 	if origin, ok := ctx.Value(libfs.CtxAppIDKey).(*FS); ok && origin == f.fs {
@@ -244,6 +248,11 @@ func (f *Folder) BatchChanges(ctx context.Context, changes []libkbfs.NodeChange)
 
 func (f *Folder) batchChangesInvalidate(ctx context.Context,
 	changes []libkbfs.NodeChange) {
+	srv := f.fs.fuseServer()
+	if srv == nil {
+		// Not mounted right now, so nothing is cached.
+		return
+	}
 	for _, v := range changes {
 		f.nodesMu.Lock()
 		n, ok := f.nodes[v.Node.GetID()]
@@ -255,13 +264,13 @@ func (f *Folder) batchChangesInvalidate(ctx context.Context,
 		switch {
 		case len(v.DirUpdated) > 0:
 			// invalidate potentially cached Readdir contents
-			if err := f.fs.fuse.InvalidateNodeData(n); err != nil && err != fuse.ErrNotCached {
+			if err := srv.InvalidateNodeData(n); err != nil && err != fuse.ErrNotCached {
 				// TODO we have no mechanism to do anything about this
 				f.fs.log.CErrorf(ctx, "FUSE invalidate error: %v", err)
 			}
 			for _, name := range v.DirUpdated {
 				// invalidate the dentry cache
-				if err := f.fs.fuse.InvalidateEntry(n, name); err != nil && err != fuse.ErrNotCached {
+				if err := srv.InvalidateEntry(n, name); err != nil && err != fuse.ErrNotCached {
 					// TODO we have no mechanism to do anything about this
 					f.fs.log.CErrorf(ctx, "FUSE invalidate error: %v", err)
 				}
@@ -269,7 +278,7 @@ func (f *Folder) batchChangesInvalidate(ctx context.Context,
 
 		case len(v.FileUpdated) > 0:
 			for _, write := range v.FileUpdated {
-				if err := f.invalidateNodeDataRange(n, write); err != nil && err != fuse.ErrNotCached {
+				if err := f.invalidateNodeDataRange(srv, n, write); err != nil && err != fuse.ErrNotCached {
 					// TODO we have no mechanism to do anything about this
 					f.fs.log.CErrorf(ctx, "FUSE invalidate error: %v", err)
 				}
@@ -280,7 +289,7 @@ func (f *Folder) batchChangesInvalidate(ctx context.Context,
 				file.eiCache.destroy()
 			}
 			// just the attributes
-			if err := f.fs.fuse.InvalidateNodeAttr(n); err != nil && err != fuse.ErrNotCached {
+			if err := srv.InvalidateNodeAttr(n); err != nil && err != fuse.ErrNotCached {
 				// TODO we have no mechanism to do anything about this
 				f.fs.log.CErrorf(ctx, "FUSE invalidate error: %v", err)
 			}
@@ -364,6 +373,21 @@ func (f *Folder) writePermMode(ctx context.Context,
 	return original, nil
 }
 
+// storedPermMode replaces the permission bits of mode, as computed by
+// fillAttrWithUIDAndWritePerm, with perm, the ones explicitly stored
+// in an entry.  Only writers of the folder keep the write bits.
+// Without -allow-other nobody but the mounting user can reach the
+// mount, so only the user bits are shown.
+func (f *Folder) storedPermMode(perm, mode os.FileMode) os.FileMode {
+	if mode&0200 == 0 {
+		perm &^= 0222
+	}
+	if !f.fs.platformParams.AllowOther {
+		perm &= 0700
+	}
+	return mode&^os.ModePerm | perm
+}
+
 // fillAttrWithUIDAndWritePerm sets attributes based on the entry info, and
 // pops in correct UID and write permissions. It only handles fields common to
 // all entryinfo types.
@@ -457,6 +481,9 @@ func (d *Dir) Access(ctx context.Context, r *fuse.AccessRequest) error {
 // Attr implements the fs.Node interface for Dir.
 func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) (err error) {
 	d.folder.fs.log.CDebugf(ctx, "Dir Attr")
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
 	defer func() { d.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
 
 	// This fits in situation 1 as described in libkbfs/delayed_cancellation.go
@@ -481,13 +508,21 @@ func (d *Dir) attr(ctx context.Context, a *fuse.Attr) (err error) {
 		return err
 	}
 
-	a.Mode |= os.ModeDir | 0500
+	if perm, ok := de.PermMode(); ok {
+		a.Mode = d.folder.storedPermMode(perm, a.Mode)
+	} else {
+		a.Mode |= 0500
+	}
+	a.Mode |= os.ModeDir
 	return nil
 }
 
 // Lookup implements the fs.NodeRequestLookuper interface for Dir.
 func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (node fs.Node, err error) {
 	d.folder.fs.log.CDebugf(ctx, "Dir Lookup %s", req.Name)
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
 	defer func() { d.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
 
 	// This fits in situation 1 as described in libkbfs/delayed_cancellation.go
@@ -580,6 +615,9 @@ func getEXCLFromCreateRequest(req *fuse.CreateRequest) libkbfs.Excl {
 // Create implements the fs.NodeCreater interface for Dir.
 func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (node fs.Node, handle fs.Handle, err error) {
 	d.folder.fs.log.CDebugf(ctx, "Dir Create %s", req.Name)
+	if err := checkAccess(ctx, true); err != nil {
+		return nil, nil, err
+	}
 	defer func() { d.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 
 	isExec := (req.Mode.Perm() & 0100) != 0
@@ -615,6 +653,9 @@ func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.Cr
 func (d *Dir) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (
 	node fs.Node, err error) {
 	d.folder.fs.log.CDebugf(ctx, "Dir Mkdir %s", req.Name)
+	if err := checkAccess(ctx, true); err != nil {
+		return nil, err
+	}
 	defer func() { d.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 
 	// This fits in situation 1 as described in libkbfs/delayed_cancellation.go
@@ -642,6 +683,9 @@ func (d *Dir) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (
 	node fs.Node, err error) {
 	d.folder.fs.log.CDebugf(ctx, "Dir Symlink %s -> %s",
 		req.NewName, req.Target)
+	if err := checkAccess(ctx, true); err != nil {
+		return nil, err
+	}
 	defer func() { d.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 
 	// This fits in situation 1 as described in libkbfs/delayed_cancellation.go
@@ -668,6 +712,9 @@ func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest,
 	newDir fs.Node) (err error) {
 	d.folder.fs.log.CDebugf(ctx, "Dir Rename %s -> %s",
 		req.OldName, req.NewName)
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { d.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 
 	var realNewDir *Dir
@@ -714,6 +761,9 @@ func (d *Dir) Rename(ctx context.Context, req *fuse.RenameRequest,
 // Remove implements the fs.NodeRemover interface for Dir.
 func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) (err error) {
 	d.folder.fs.log.CDebugf(ctx, "Dir Remove %s", req.Name)
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { d.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 
 	// This fits in situation 1 as described in libkbfs/delayed_cancellation.go
@@ -738,33 +788,63 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) (err error) {
 	return nil
 }
 
+var _ fs.NodeOpener = (*Dir)(nil)
+
+// Open implements the fs.NodeOpener interface for Dir.  The Dir is
+// its own handle; Open only makes sure the requesting user may read
+// it.
+func (d *Dir) Open(ctx context.Context, req *fuse.OpenRequest,
+	resp *fuse.OpenResponse) (fs.Handle, error) {
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
 // ReadDirAll implements the fs.NodeReadDirAller interface for Dir.
 func (d *Dir) ReadDirAll(ctx context.Context) (res []fuse.Dirent, err error) {
 	d.folder.fs.log.CDebugf(ctx, "Dir ReadDirAll")
-	defer func() { d.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
-
-	children, err := d.folder.fs.config.KBFSOps().GetDirChildren(ctx, d.node)
-	if err != nil {
+	if err := checkAccess(ctx, false); err != nil {
 		return nil, err
 	}
+	defer func() { d.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+
+	// The fuse library only supports reading a whole directory at
+	// once, but paging through the children at least avoids building
+	// a second full copy of a huge directory's entries.
+	after := ""
+	for {
+		children, more, err := d.folder.fs.config.KBFSOps().
+			GetDirChildrenPage(ctx, d.node, after, readDirPageSize)
+		if err != nil {
+			return nil, err
+		}
 
-	for name, ei := range children {
-		fde := fuse.Dirent{
-			Name: name,
+		for _, child := range children {
+			fde := fuse.Dirent{
+				Name: child.Name,
+			}
+			switch child.Type {
+			case libkbfs.File, libkbfs.Exec:
+				fde.Type = fuse.DT_File
+			case libkbfs.Dir:
+				fde.Type = fuse.DT_Dir
+			case libkbfs.Sym:
+				fde.Type = fuse.DT_Link
+			}
+			res = append(res, fde)
+			after = child.Name
 		}
-		switch ei.Type {
-		case libkbfs.File, libkbfs.Exec:
-			fde.Type = fuse.DT_File
-		case libkbfs.Dir:
-			fde.Type = fuse.DT_Dir
-		case libkbfs.Sym:
-			fde.Type = fuse.DT_Link
+		if !more {
+			return res, nil
 		}
-		res = append(res, fde)
 	}
-	return res, nil
 }
 
+// readDirPageSize is the number of directory entries ReadDirAll
+// fetches at a time.
+const readDirPageSize = 1000
+
 // Forget kernel reference to this node.
 func (d *Dir) Forget() {
 	d.folder.forgetNode(d.node)
@@ -773,18 +853,19 @@ func (d *Dir) Forget() {
 // Setattr implements the fs.NodeSetattrer interface for Dir.
 func (d *Dir) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) (err error) {
 	d.folder.fs.log.CDebugf(ctx, "Dir SetAttr")
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { d.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 
 	valid := req.Valid
 
 	if valid.Mode() {
-		// You can't set the mode on KBFS directories, but we don't
-		// want to return EPERM because that unnecessarily fails some
-		// applications like unzip.  Instead ignore it, print a debug
-		// message, and advertise this behavior on the
-		// "understand_kbfs" doc online.
-		d.folder.fs.log.CDebugf(ctx, "Ignoring unsupported attempt to set "+
-			"the mode on a directory")
+		err := d.folder.fs.config.KBFSOps().SetMode(
+			ctx, d.node, req.Mode.Perm())
+		if err != nil {
+			return err
+		}
 		valid &^= fuse.SetattrMode
 	}
 
@@ -67,6 +67,11 @@ func (f *File) fillAttrWithMode(
 	if err = f.folder.fillAttrWithUIDAndWritePerm(ctx, ei, a); err != nil {
 		return err
 	}
+	if perm, ok := ei.PermMode(); ok {
+		a.Mode = f.folder.storedPermMode(perm, a.Mode)
+		return nil
+	}
+	// Entries without a stored mode get the user bits only.
 	a.Mode |= 0400
 	if ei.Type == libkbfs.Exec {
 		a.Mode |= 0100
@@ -77,6 +82,9 @@ func (f *File) fillAttrWithMode(
 // Attr implements the fs.Node interface for File.
 func (f *File) Attr(ctx context.Context, a *fuse.Attr) (err error) {
 	f.folder.fs.log.CDebugf(ctx, "File Attr")
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
 	defer func() { f.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
 
 	if reqID, ok := ctx.Value(CtxIDKey).(string); ok {
@@ -189,12 +197,29 @@ func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) (err error) {
 
 var _ fs.Handle = (*File)(nil)
 
+var _ fs.NodeOpener = (*File)(nil)
+
+// Open implements the fs.NodeOpener interface for File.  The File
+// is its own handle; Open only makes sure the requesting user may
+// open it in the requested mode.
+func (f *File) Open(ctx context.Context, req *fuse.OpenRequest,
+	resp *fuse.OpenResponse) (fs.Handle, error) {
+	write := req.Flags.IsWriteOnly() || req.Flags.IsReadWrite()
+	if err := checkAccess(ctx, write); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
 var _ fs.HandleReader = (*File)(nil)
 
 // Read implements the fs.HandleReader interface for File.
 func (f *File) Read(ctx context.Context, req *fuse.ReadRequest,
 	resp *fuse.ReadResponse) (err error) {
 	f.folder.fs.log.CDebugf(ctx, "File Read")
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
 	defer func() { f.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
 
 	n, err := f.folder.fs.config.KBFSOps().Read(
@@ -212,6 +237,9 @@ var _ fs.HandleWriter = (*File)(nil)
 func (f *File) Write(ctx context.Context, req *fuse.WriteRequest,
 	resp *fuse.WriteResponse) (err error) {
 	f.folder.fs.log.CDebugf(ctx, "File Write sz=%d ", len(req.Data))
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 
 	f.eiCache.destroy()
@@ -248,6 +276,9 @@ var _ fs.NodeSetattrer = (*File)(nil)
 func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest,
 	resp *fuse.SetattrResponse) (err error) {
 	f.folder.fs.log.CDebugf(ctx, "File SetAttr")
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 
 	f.eiCache.destroy()
@@ -271,10 +302,9 @@ func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest,
 	}
 
 	if valid.Mode() {
-		// Unix has 3 exec bits, KBFS has one; we follow the user-exec bit.
-		exec := req.Mode&0100 != 0
-		err := f.folder.fs.config.KBFSOps().SetEx(
-			ctx, f.node, exec)
+		// KBFS's executable bit follows the user-exec bit.
+		err := f.folder.fs.config.KBFSOps().SetMode(
+			ctx, f.node, req.Mode.Perm())
 		if err != nil {
 			return err
 		}
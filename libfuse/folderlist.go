@@ -144,6 +144,9 @@ func (fl *FolderList) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (_ fs.N
 // Lookup implements the fs.NodeRequestLookuper interface.
 func (fl *FolderList) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (node fs.Node, err error) {
 	fl.fs.log.CDebugf(ctx, "FL Lookup %s", req.Name)
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
 	defer func() {
 		fl.reportErr(ctx, libkbfs.ReadMode,
 			libkbfs.CanonicalTlfName(req.Name), err)
@@ -220,6 +223,9 @@ var _ fs.HandleReadDirAller = (*FolderList)(nil)
 // ReadDirAll implements the ReadDirAll interface.
 func (fl *FolderList) ReadDirAll(ctx context.Context) (res []fuse.Dirent, err error) {
 	fl.fs.log.CDebugf(ctx, "FL ReadDirAll")
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
 	defer func() {
 		fl.fs.reportErr(ctx, libkbfs.ReadMode, err)
 	}()
@@ -258,6 +264,9 @@ var _ fs.NodeRemover = (*FolderList)(nil)
 // Remove implements the fs.NodeRemover interface for FolderList.
 func (fl *FolderList) Remove(ctx context.Context, req *fuse.RemoveRequest) (err error) {
 	fl.fs.log.CDebugf(ctx, "FolderList Remove %s", req.Name)
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { fl.fs.reportErr(ctx, libkbfs.WriteMode, err) }()
 
 	h, err := libkbfs.ParseTlfHandlePreferred(
@@ -315,12 +324,17 @@ func (fl *FolderList) updateTlfName(ctx context.Context, oldName string,
 		return
 	}
 
-	if err := fl.fs.fuse.InvalidateEntry(fl, oldName); err != nil {
+	srv := fl.fs.fuseServer()
+	if srv == nil {
+		// Not mounted right now, so nothing is cached.
+		return
+	}
+	if err := srv.InvalidateEntry(fl, oldName); err != nil {
 		// TODO we have no mechanism to do anything about this
 		fl.fs.log.CErrorf(ctx, "FUSE invalidate error for oldName=%s: %v",
 			oldName, err)
 	}
-	if err := fl.fs.fuse.InvalidateEntry(fl, newName); err != nil {
+	if err := srv.InvalidateEntry(fl, newName); err != nil {
 		// TODO we have no mechanism to do anything about this
 		fl.fs.log.CErrorf(ctx, "FUSE invalidate error for newName=%s: %v",
 			newName, err)
@@ -8,12 +8,14 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/kbfsblock"
 	"github.com/keybase/kbfs/libfs"
 	"github.com/keybase/kbfs/libkbfs"
 	"golang.org/x/net/context"
@@ -22,11 +24,16 @@ import (
 // FS implements the newfuse FS interface for KBFS.
 type FS struct {
 	config libkbfs.Config
-	fuse   *fs.Server
-	conn   *fuse.Conn
 	log    logger.Logger
 	errLog logger.Logger
 
+	// connLock protects fuse and conn, which change on a remount
+	// while notification goroutines use them.  fuse is nil while
+	// no connection is being served.
+	connLock sync.RWMutex
+	fuse     *fs.Server
+	conn     *fuse.Conn
+
 	notifications *libfs.FSNotifications
 
 	// remoteStatus is the current status of remote connections.
@@ -39,6 +46,19 @@ type FS struct {
 	root Root
 
 	platformParams PlatformParams
+
+	// mountDir is where the FS is mounted, for the symlink policy.
+	// If empty, /keybase is assumed.
+	mountDir string
+
+	// quotaLock protects quotaInfo and quotaInfoTime, the quota
+	// last fetched for Statfs and when it was fetched, and
+	// quotaFetchDone, which is non-nil while a fetch is in flight
+	// and closed when it finishes.
+	quotaLock      sync.Mutex
+	quotaInfo      *kbfsblock.UserQuotaInfo
+	quotaInfoTime  time.Time
+	quotaFetchDone chan struct{}
 }
 
 // NewFS creates an FS
@@ -78,10 +98,35 @@ func NewFS(config libkbfs.Config, conn *fuse.Conn, debug bool, platformParams Pl
 
 // SetFuseConn sets fuse connection for this FS.
 func (f *FS) SetFuseConn(fuse *fs.Server, conn *fuse.Conn) {
+	f.connLock.Lock()
+	defer f.connLock.Unlock()
 	f.fuse = fuse
 	f.conn = conn
 }
 
+// fuseServer returns the server for the FUSE connection currently
+// being served, or nil if there isn't one, e.g. during a remount.
+func (f *FS) fuseServer() *fs.Server {
+	f.connLock.RLock()
+	defer f.connLock.RUnlock()
+	return f.fuse
+}
+
+// fuseConn returns the current FUSE connection.
+func (f *FS) fuseConn() *fuse.Conn {
+	f.connLock.RLock()
+	defer f.connLock.RUnlock()
+	return f.conn
+}
+
+// canInvalidate returns true if the current FUSE connection
+// supports invalidation notifications.
+func (f *FS) canInvalidate() bool {
+	conn := f.fuseConn()
+	// OSXFUSE 2.x does not support notifications.
+	return conn != nil && conn.Protocol().HasInvalidate()
+}
+
 // NotificationGroupWait - wait on the notification group.
 func (f *FS) NotificationGroupWait() {
 	f.notifications.Wait()
@@ -149,17 +194,33 @@ func (f *FS) WithContext(ctx context.Context) context.Context {
 
 // Serve FS. Will block.
 func (f *FS) Serve(ctx context.Context) error {
-	srv := fs.New(f.conn, &fs.Config{
-		WithContext: func(ctx context.Context, _ fuse.Request) context.Context {
-			return f.WithContext(ctx)
-		},
-	})
-	f.fuse = srv
-
 	f.notifications.LaunchProcessor(ctx)
 	f.remoteStatus.Init(ctx, f.log, f.config, f)
 	// Blocks forever, unless an interrupt signal is received
 	// (handled by libkbfs.Init).
+	return f.serveConn()
+}
+
+// serveConn serves requests from f's current FUSE connection until
+// it is closed.  It can be called again after SetFuseConn to serve a
+// new mount of the same FS.
+func (f *FS) serveConn() error {
+	f.connLock.Lock()
+	srv := fs.New(f.conn, &fs.Config{
+		WithContext: func(ctx context.Context, req fuse.Request) context.Context {
+			return f.WithContext(
+				f.platformParams.withRequestAccess(ctx, req))
+		},
+	})
+	f.fuse = srv
+	f.connLock.Unlock()
+	defer func() {
+		f.connLock.Lock()
+		defer f.connLock.Unlock()
+		if f.fuse == srv {
+			f.fuse = nil
+		}
+	}()
 	return srv.Serve(f)
 }
 
@@ -197,9 +258,70 @@ func (f *FS) Root() (fs.Node, error) {
 	return &f.root, nil
 }
 
+// quotaCacheTime is how long Statfs reuses the quota it last got from
+// the block server; Finder calls statfs very often.
+const quotaCacheTime = 1 * time.Minute
+
+// getUserQuotaInfo returns the current user's quota info, possibly
+// cached.  It returns nil if the quota isn't available, e.g. because
+// no one is logged in or we're offline.  Concurrent callers share a
+// single fetch, and the lock isn't held while fetching, so a slow
+// server doesn't hold up other statfs calls for longer than it has
+// to.
+func (f *FS) getUserQuotaInfo(ctx context.Context) *kbfsblock.UserQuotaInfo {
+	f.quotaLock.Lock()
+	if f.quotaInfo != nil &&
+		f.config.Clock().Now().Sub(f.quotaInfoTime) < quotaCacheTime {
+		defer f.quotaLock.Unlock()
+		return f.quotaInfo
+	}
+	if done := f.quotaFetchDone; done != nil {
+		// Someone else is already fetching it; use their result.
+		f.quotaLock.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		f.quotaLock.Lock()
+		defer f.quotaLock.Unlock()
+		return f.quotaInfo
+	}
+	done := make(chan struct{})
+	f.quotaFetchDone = done
+	f.quotaLock.Unlock()
+
+	info := f.fetchUserQuotaInfo(ctx)
+
+	f.quotaLock.Lock()
+	defer f.quotaLock.Unlock()
+	f.quotaFetchDone = nil
+	close(done)
+	if info != nil {
+		f.quotaInfo = info
+		f.quotaInfoTime = f.config.Clock().Now()
+	}
+	return f.quotaInfo
+}
+
+// fetchUserQuotaInfo asks the block server for the current user's
+// quota info.  It returns nil if it isn't available.
+func (f *FS) fetchUserQuotaInfo(ctx context.Context) *kbfsblock.UserQuotaInfo {
+	// Like KBFSOps.Status, don't ask for the quota until we're
+	// authenticated, so statfs never prompts for a passphrase.
+	_, _, err := f.config.KBPKI().GetCurrentUserInfo(ctx)
+	if err != nil || !f.config.MDServer().IsConnected() {
+		return nil
+	}
+	info, err := f.config.BlockServer().GetUserQuotaInfo(ctx)
+	if err != nil {
+		f.log.CDebugf(ctx, "Couldn't get quota info for statfs: %+v", err)
+		return nil
+	}
+	return info
+}
+
 // Statfs implements the fs.FSStatfser interface for FS.
 func (f *FS) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.StatfsResponse) error {
-	// TODO: Fill in real values for these.
 	var bsize uint32 = 32 * 1024
 	*resp = fuse.StatfsResponse{
 		Blocks:  ^uint64(0) / uint64(bsize),
@@ -211,6 +333,25 @@ func (f *FS) Statfs(ctx context.Context, req *fuse.StatfsRequest, resp *fuse.Sta
 		Namelen: ^uint32(0),
 		Frsize:  0,
 	}
+
+	// Report the user's quota as the size of the volume, so Finder
+	// and df show real numbers.  Without it, fall back to an
+	// effectively unlimited volume.
+	info := f.getUserQuotaInfo(ctx)
+	if info == nil || info.Limit <= 0 {
+		return nil
+	}
+	var used int64
+	if info.Total != nil {
+		used = info.Total.Bytes[kbfsblock.UsageWrite]
+	}
+	free := info.Limit - used
+	if free < 0 {
+		free = 0
+	}
+	resp.Blocks = uint64(info.Limit) / uint64(bsize)
+	resp.Bfree = uint64(free) / uint64(bsize)
+	resp.Bavail = resp.Bfree
 	return nil
 }
 
@@ -254,6 +395,9 @@ var _ fs.NodeRequestLookuper = (*Root)(nil)
 // Lookup implements the fs.NodeRequestLookuper interface for Root.
 func (r *Root) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (_ fs.Node, err error) {
 	r.log().CDebugf(ctx, "FS Lookup %s", req.Name)
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
 	defer func() { r.private.fs.reportErr(ctx, libkbfs.ReadMode, err) }()
 
 	specialNode := handleNonTLFSpecialFile(
@@ -314,6 +458,9 @@ var _ fs.HandleReadDirAller = (*Root)(nil)
 // ReadDirAll implements the ReadDirAll interface for Root.
 func (r *Root) ReadDirAll(ctx context.Context) (res []fuse.Dirent, err error) {
 	r.log().CDebugf(ctx, "FS ReadDirAll")
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
 	defer func() { r.private.fs.reportErr(ctx, libkbfs.ReadMode, err) }()
 	res = []fuse.Dirent{
 		{
@@ -15,6 +15,7 @@ import (
 	"bazil.org/fuse/fs"
 	"github.com/kardianos/osext"
 	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/kbfs/ioutil"
 	"github.com/keybase/kbfs/libkbfs"
 	"golang.org/x/net/context"
 )
@@ -93,6 +94,12 @@ func newExternalBundleResourceFile(path string) (*SpecialReadFile, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Outside of the app bundle (e.g., a development build), there
+	// is no icon; tell Finder to use the default one rather than
+	// failing the lookup.
+	if _, err := ioutil.Stat(bpath); ioutil.IsNotExist(err) {
+		return nil, fuse.ENOENT
+	}
 	return newExternalFile(bpath)
 }
 
@@ -123,6 +130,10 @@ type Trash struct {
 // Lookup implements the fs.NodeRequestLookuper interface for *Trash
 func (t *Trash) Lookup(ctx context.Context,
 	req *fuse.LookupRequest, resp *fuse.LookupResponse) (fs.Node, error) {
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+
 	if req.Name == strconv.Itoa(os.Getuid()) {
 		return &Alias{
 			realPath: fmt.Sprintf("../private/%s/.trash", t.kbusername),
@@ -140,6 +151,9 @@ func (t *Trash) Attr(ctx context.Context, a *fuse.Attr) error {
 // ReadDirAll implements the fs.NodeReadDirAller interface for *Trash
 func (t *Trash) ReadDirAll(ctx context.Context) (res []fuse.Dirent, err error) {
 	t.fs.log.CDebugf(ctx, "Trash ReadDirAll")
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
 	defer func() { t.fs.reportErr(ctx, libkbfs.ReadMode, err) }()
 
 	return []fuse.Dirent{
@@ -37,6 +37,9 @@ func (f *JournalControlFile) Write(ctx context.Context, req *fuse.WriteRequest,
 	resp *fuse.WriteResponse) (err error) {
 	f.folder.fs.log.CDebugf(ctx, "JournalControlFile (f.action=%s) Write",
 		f.action)
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 	if len(req.Data) == 0 {
 		return nil
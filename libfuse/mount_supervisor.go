@@ -0,0 +1,153 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+	"github.com/cenkalti/backoff"
+	"github.com/keybase/client/go/logger"
+	"golang.org/x/net/context"
+)
+
+const (
+	// How long to wait before the first remount attempt.
+	remountInitialInterval = 1 * time.Second
+	// The longest to wait between remount attempts.
+	remountMaxInterval = 1 * time.Minute
+)
+
+// mountSupervisor serves an FS on a FUSE mount, and mounts it again
+// if the mount goes away without stop being called -- e.g., if the
+// kernel aborts the FUSE connection, or someone runs `fusermount -u`
+// on the mountpoint.  Without it, kbfsfuse would exit (or hang) and
+// leave a dead mountpoint until the user restarted it.
+//
+// The same FS is served on every new mount, so the KBFS nodes it has
+// already looked up, and all the cached data behind them, are
+// reused.  The kernel's open file handles can't survive losing the
+// connection, though, so processes have to reopen their files.
+type mountSupervisor struct {
+	mounter Mounter
+	log     logger.Logger
+	// unmount cleanly unmounts the current mount, for stop.
+	unmount func() error
+
+	// lock makes sure stop can't run while a remount is under way,
+	// so stop always unmounts the latest mount.
+	lock     sync.Mutex
+	stopping bool
+	stopCh   chan struct{}
+}
+
+func newMountSupervisor(mounter Mounter, log logger.Logger,
+	unmount func() error) *mountSupervisor {
+	return &mountSupervisor{
+		mounter: mounter,
+		log:     log,
+		unmount: unmount,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// stop unmounts the current mount, and makes serve return instead of
+// remounting.
+func (ms *mountSupervisor) stop() error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if !ms.stopping {
+		ms.stopping = true
+		close(ms.stopCh)
+	}
+	return ms.unmount()
+}
+
+func (ms *mountSupervisor) isStopping() bool {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	return ms.stopping
+}
+
+// remount cleans up whatever is left of the old mount, and mounts the
+// directory again.  It returns a nil connection if stop was called
+// first.
+func (ms *mountSupervisor) remount() (*fuse.Conn, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if ms.stopping {
+		return nil, nil
+	}
+	// A crashed FUSE connection leaves the mountpoint in place,
+	// returning ENOTCONN for everything, so unmount it first.
+	// This fails if the mount is already gone, which is fine.
+	_ = ms.mounter.Unmount()
+	c, err := ms.mounter.Mount()
+	if err != nil {
+		return nil, err
+	}
+	<-c.Ready
+	if err := c.MountError; err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// serve serves fs on its current connection, and on a new mount each
+// time the previous one goes away, until stop is called.  It returns
+// the error from the last connection, if any.
+func (ms *mountSupervisor) serve(ctx context.Context, fs *FS) error {
+	expBackoff := backoff.NewExponentialBackOff()
+	expBackoff.InitialInterval = remountInitialInterval
+	expBackoff.MaxInterval = remountMaxInterval
+	// Keep trying for as long as we're running.
+	expBackoff.MaxElapsedTime = 0
+
+	start := time.Now()
+	err := fs.Serve(ctx)
+	for {
+		fs.fuseConn().Close()
+		if ms.isStopping() {
+			return err
+		}
+		ms.log.CWarningf(ctx, "FUSE mount at %s went away (err=%v); "+
+			"remounting", ms.mounter.Dir(), err)
+		// Only back off further if the last mount didn't last long;
+		// otherwise this is a fresh failure.
+		if time.Since(start) > remountMaxInterval {
+			expBackoff.Reset()
+		}
+
+		var c *fuse.Conn
+		for c == nil {
+			wait := expBackoff.NextBackOff()
+			select {
+			case <-time.After(wait):
+			case <-ms.stopCh:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			var mountErr error
+			c, mountErr = ms.remount()
+			if mountErr != nil {
+				ms.log.CWarningf(ctx, "Couldn't remount %s: %v; "+
+					"trying again", ms.mounter.Dir(), mountErr)
+				continue
+			}
+			if c == nil {
+				// stop was called.
+				return err
+			}
+		}
+
+		ms.log.CDebugf(ctx, "Remounted %s", ms.mounter.Dir())
+		fs.SetFuseConn(nil, c)
+		start = time.Now()
+		err = fs.serveConn()
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"path"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -23,6 +24,7 @@ import (
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/client/go/logger"
 	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfsblock"
 	"github.com/keybase/kbfs/libfs"
 	"github.com/keybase/kbfs/libkbfs"
 	"github.com/pkg/errors"
@@ -31,6 +33,16 @@ import (
 )
 
 func makeFS(t testing.TB, ctx context.Context, config *libkbfs.ConfigLocal) (
+	*fstestutil.Mount, *FS, func()) {
+	return makeFSWithRequestHook(t, ctx, config, nil)
+}
+
+// makeFSWithRequestHook is like makeFS, but every FUSE request's
+// context is passed through hook, if it's non-nil, before it reaches
+// the FS.
+func makeFSWithRequestHook(t testing.TB, ctx context.Context,
+	config *libkbfs.ConfigLocal,
+	hook func(context.Context, fuse.Request) context.Context) (
 	*fstestutil.Mount, *FS, func()) {
 	log := logger.NewTestLogger(t)
 	debugLog := log.CloneWithAddedDepth(1)
@@ -63,6 +75,9 @@ func makeFS(t testing.TB, ctx context.Context, config *libkbfs.ConfigLocal) (
 	options := GetPlatformSpecificMountOptionsForTest()
 	mnt, err := fstestutil.MountedFuncT(t, fn, &fs.Config{
 		WithContext: func(ctx context.Context, req fuse.Request) context.Context {
+			if hook != nil {
+				ctx = hook(ctx, req)
+			}
 			return filesys.WithContext(ctx)
 		},
 	}, options...)
@@ -151,6 +166,85 @@ func TestStatRoot(t *testing.T) {
 	}
 }
 
+func TestStatfsQuota(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	mnt, _, cancelFn := makeFS(t, ctx, config)
+	defer mnt.Close()
+	defer cancelFn()
+
+	info, err := config.BlockServer().GetUserQuotaInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(mnt.Dir, &st); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := uint64(st.Blocks), uint64(info.Limit)/(32*1024); g != e {
+		t.Errorf("wrong block count: %d != %d", g, e)
+	}
+	if st.Bavail > st.Blocks {
+		t.Errorf("more blocks available than total: %d > %d",
+			st.Bavail, st.Blocks)
+	}
+}
+
+// blockingQuotaBServer counts quota fetches, and holds each one
+// until release is closed.
+type blockingQuotaBServer struct {
+	libkbfs.BlockServer
+	calls   int32
+	release chan struct{}
+}
+
+func (b *blockingQuotaBServer) GetUserQuotaInfo(ctx context.Context) (
+	*kbfsblock.UserQuotaInfo, error) {
+	atomic.AddInt32(&b.calls, 1)
+	<-b.release
+	return b.BlockServer.GetUserQuotaInfo(ctx)
+}
+
+func TestGetUserQuotaInfoSharesFetch(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	bserver := &blockingQuotaBServer{
+		BlockServer: config.BlockServer(),
+		release:     make(chan struct{}),
+	}
+	config.SetBlockServer(bserver)
+	filesys := &FS{config: config, log: logger.NewTestLogger(t)}
+
+	infoCh := make(chan *kbfsblock.UserQuotaInfo, 2)
+	go func() { infoCh <- filesys.getUserQuotaInfo(ctx) }()
+	for atomic.LoadInt32(&bserver.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The fetch in flight doesn't hold the lock, so a caller that
+	// gives up gets the (empty) cached info right away.
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if info := filesys.getUserQuotaInfo(canceledCtx); info != nil {
+		t.Errorf("Unexpected quota info while fetching: %+v", info)
+	}
+
+	go func() { infoCh <- filesys.getUserQuotaInfo(ctx) }()
+	close(bserver.release)
+	for i := 0; i < 2; i++ {
+		if info := <-infoCh; info == nil {
+			t.Error("No quota info")
+		}
+	}
+	if g, e := atomic.LoadInt32(&bserver.calls), int32(1); g != e {
+		t.Errorf("Wrong number of quota fetches: %d != %d", g, e)
+	}
+}
+
 func TestStatPrivate(t *testing.T) {
 	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
 	defer libkbfs.CleanupCancellationDelayer(ctx)
@@ -1627,6 +1721,110 @@ func TestChmodDirIgnored(t *testing.T) {
 	}
 }
 
+func TestChmodDir(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	mnt, _, cancelFn := makeFS(t, ctx, config)
+	defer mnt.Close()
+	defer cancelFn()
+
+	p := path.Join(mnt.Dir, PrivateName, "jdoe", "mydir")
+	if err := ioutil.Mkdir(p, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := ioutil.Lstat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := fi.Mode().String(), `drwx------`; g != e {
+		t.Errorf("wrong mode before chmod: %q != %q", g, e)
+	}
+
+	// Only the user bits show without -allow-other.
+	if err := os.Chmod(p, 0551); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err = ioutil.Lstat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := fi.Mode().String(), `dr-x------`; g != e {
+		t.Errorf("wrong mode: %q != %q", g, e)
+	}
+}
+
+func TestChmodNoPerms(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	mnt, _, cancelFn := makeFS(t, ctx, config)
+	defer mnt.Close()
+	defer cancelFn()
+
+	p := path.Join(mnt.Dir, PrivateName, "jdoe", "myfile")
+	const input = "hello, world\n"
+	if err := ioutil.WriteFile(p, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A mode of 0000 is stored, not mistaken for an unset mode.
+	if err := os.Chmod(p, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := ioutil.Lstat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := fi.Mode().String(), `----------`; g != e {
+		t.Errorf("wrong mode: %q != %q", g, e)
+	}
+}
+
+func TestStoredPermMode(t *testing.T) {
+	folder := &Folder{fs: &FS{}}
+	checks := []struct {
+		allowOther bool
+		perm, mode os.FileMode
+		expected   os.FileMode
+	}{
+		// Only the user bits show when nobody else can get in.
+		{false, 0751, 0700, 0700},
+		{true, 0751, 0700, 0751},
+		{true, 0000, 0700, 0000},
+		// Readers of the folder never see write bits.
+		{true, 0664, 0500, 0444},
+	}
+	for i, c := range checks {
+		folder.fs.platformParams.AllowOther = c.allowOther
+		mode := folder.storedPermMode(c.perm, os.ModeDir|c.mode)
+		if g, e := mode, os.ModeDir|c.expected; g != e {
+			t.Errorf("Check %d: wrong mode: %v != %v", i, g, e)
+		}
+	}
+}
+
+func TestChmodTLFRootIgnored(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	mnt, _, cancelFn := makeFS(t, ctx, config)
+	defer mnt.Close()
+	defer cancelFn()
+
+	p := path.Join(mnt.Dir, PrivateName, "jdoe")
+	if err := os.Chmod(p, 0755); err != nil {
+		t.Fatalf("Expecting the TLF root chmod to get swallowed silently, "+
+			"but got: %v", err)
+	}
+}
+
 func TestChownDirIgnored(t *testing.T) {
 	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
 	defer libkbfs.CleanupCancellationDelayer(ctx)
@@ -1744,6 +1942,46 @@ func TestSetattrFileMtimeAfterWrite(t *testing.T) {
 	}
 }
 
+func TestSetattrFileMtimeBeforeSync(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	mnt, _, cancelFn := makeFS(t, ctx, config)
+	defer mnt.Close()
+	defer cancelFn()
+
+	p := path.Join(mnt.Dir, PrivateName, "jdoe", "myfile")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	const input = "hello, world\n"
+	if _, err := io.WriteString(f, input); err != nil {
+		t.Fatal(err)
+	}
+
+	// Like `cp -p`, set the mtime before the file is closed; the
+	// sync on close must not overwrite it.
+	mtime := time.Date(2015, 1, 2, 3, 4, 5, 6, time.Local)
+	atime := time.Date(2015, 7, 8, 9, 10, 11, 12, time.Local)
+	if err := os.Chtimes(p, atime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := ioutil.Lstat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := fi.ModTime(), mtime; !libfs.TimeEqual(g, e) {
+		t.Errorf("wrong mtime: %v !~= %v", g, e)
+	}
+}
+
 func TestSetattrFileMtimeNow(t *testing.T) {
 	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
 	defer libkbfs.CleanupCancellationDelayer(ctx)
@@ -2811,6 +3049,97 @@ func TestStatusFile(t *testing.T) {
 	}
 }
 
+func TestSyncStatusFile(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	mnt, fs, cancelFn := makeFS(t, ctx, config)
+	defer mnt.Close()
+	defer cancelFn()
+
+	p := path.Join(mnt.Dir, PrivateName, "jdoe", "myfile")
+	if err := ioutil.WriteFile(p, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	syncFolderToServer(t, "jdoe", fs)
+
+	buf, err := ioutil.ReadFile(path.Join(mnt.Dir, PrivateName, "jdoe",
+		libfs.SyncStatusFileName))
+	if err != nil {
+		t.Fatalf("Couldn't read KBFS sync status file: %v", err)
+	}
+	var status libfs.TlfSyncStatus
+	if err := json.Unmarshal(buf, &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.InSync || status.Staged || len(status.DirtyPaths) != 0 {
+		t.Errorf("Unexpected sync status: %s", buf)
+	}
+	if status.Revision < libkbfs.MetadataRevisionInitial {
+		t.Errorf("Unexpected revision: %s", buf)
+	}
+}
+
+func TestArchivedRevision(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+	mnt, fs, cancelFn := makeFS(t, ctx, config)
+	defer mnt.Close()
+	defer cancelFn()
+
+	tlfDir := path.Join(mnt.Dir, PrivateName, "jdoe")
+	p := path.Join(tlfDir, "myfile")
+	if err := ioutil.WriteFile(p, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	syncFolderToServer(t, "jdoe", fs)
+
+	buf, err := ioutil.ReadFile(path.Join(tlfDir, libfs.SyncStatusFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status libfs.TlfSyncStatus
+	if err := json.Unmarshal(buf, &status); err != nil {
+		t.Fatal(err)
+	}
+	oldRev := status.Revision
+
+	if err := ioutil.WriteFile(p, []byte("new data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(
+		path.Join(tlfDir, "other"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	syncFolderToServer(t, "jdoe", fs)
+
+	revDir := path.Join(tlfDir, libfs.ArchivedDirName,
+		fmt.Sprintf("%s%d", libfs.ArchivedRevPrefix, oldRev))
+	buf, err = ioutil.ReadFile(path.Join(revDir, "myfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := string(buf), "old"; g != e {
+		t.Errorf("wrong archived content: %q != %q", g, e)
+	}
+	checkDir(t, revDir, map[string]fileInfoCheck{
+		"myfile": nil,
+	})
+
+	if err := ioutil.WriteFile(
+		path.Join(revDir, "myfile"), []byte("x"), 0644); err == nil {
+		t.Errorf("Writing an archived file unexpectedly succeeded")
+	}
+	_, err = ioutil.ReadFile(path.Join(tlfDir, libfs.ArchivedDirName,
+		fmt.Sprintf("%s%d", libfs.ArchivedRevPrefix, oldRev+100), "myfile"))
+	if !ioutil.IsNotExist(err) {
+		t.Errorf("Expected ENOENT for a future revision, got %v", err)
+	}
+}
+
 // TODO: remove once we have automatic conflict resolution tests
 func TestUnstageFile(t *testing.T) {
 	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
@@ -3536,3 +3865,346 @@ func TestKbfsFileInfo(t *testing.T) {
 		t.Fatalf("Expected user1, %v raw %X", dst, bs)
 	}
 }
+
+func TestRemountAfterUnmount(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+
+	dir, err := ioutil.TempDir(os.TempDir(), "kbfs_remount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ioutil.RemoveAll(dir)
+
+	mounter := NewDefaultMounter(dir, PlatformParams{})
+	c, err := mounter.Mount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-c.Ready
+	if err := c.MountError; err != nil {
+		t.Fatal(err)
+	}
+	filesys := NewFS(config, c, false, PlatformParams{})
+	supervisor := newMountSupervisor(
+		mounter, logger.NewTestLogger(t), mounter.Unmount)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = context.WithValue(ctx, libfs.CtxAppIDKey, filesys)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- supervisor.serve(ctx, filesys)
+	}()
+
+	checkDir(t, dir, map[string]fileInfoCheck{
+		PrivateName: mustBeDir,
+		PublicName:  mustBeDir,
+	})
+
+	// Pull the mount out from under the supervisor, and wait for it
+	// to come back.
+	if err := mounter.Unmount(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		fis, err := ioutil.ReadDir(dir)
+		if err == nil && len(fis) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Mount didn't come back: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	checkDir(t, dir, map[string]fileInfoCheck{
+		PrivateName: mustBeDir,
+		PublicName:  mustBeDir,
+	})
+
+	if err := supervisor.stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Supervisor didn't stop")
+	}
+}
+
+func TestUnmountGracefullyWaitsForOpenFiles(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+
+	dir, err := ioutil.TempDir(os.TempDir(), "kbfs_unmount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ioutil.RemoveAll(dir)
+
+	mounter := NewDefaultMounter(dir, PlatformParams{})
+	c, err := mounter.Mount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-c.Ready
+	if err := c.MountError; err != nil {
+		t.Fatal(err)
+	}
+	filesys := NewFS(config, c, false, PlatformParams{})
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = context.WithValue(ctx, libfs.CtxAppIDKey, filesys)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- filesys.Serve(ctx)
+	}()
+
+	// Keep the mount busy for a bit.
+	f, err := os.Open(path.Join(dir, PublicName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(time.Second, func() { f.Close() })
+
+	err = unmountGracefully(ctx, logger.NewTestLogger(t), config, mounter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Serve didn't return after unmounting")
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	var readers uidList
+	if err := readers.Set("0, 1234"); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := readers.String(), "0,1234"; g != e {
+		t.Errorf("wrong uid list: %q != %q", g, e)
+	}
+	if err := readers.Set("root"); err == nil {
+		t.Error("Expected an error for a non-numeric uid")
+	}
+
+	params := AccessParams{
+		AllowOther: true,
+		ReaderUIDs: uidList{0, 1234},
+	}
+	ctxFor := func(uid uint32) context.Context {
+		return params.withRequestAccess(context.Background(),
+			&fuse.ReadRequest{
+				Header: fuse.Header{Uid: uid},
+			})
+	}
+	me := uint32(os.Getuid())
+	other := uint32(4321)
+	if me == other {
+		other++
+	}
+
+	checks := []struct {
+		ctx   context.Context
+		write bool
+		ok    bool
+	}{
+		{context.Background(), true, true},
+		{ctxFor(me), true, true},
+		{ctxFor(1234), false, true},
+		{ctxFor(1234), true, me == 1234},
+		{ctxFor(other), false, false},
+	}
+	for i, c := range checks {
+		err := checkAccess(c.ctx, c.write)
+		if c.ok && err != nil {
+			t.Errorf("Check %d: unexpected error %v", i, err)
+		} else if !c.ok && err == nil {
+			t.Errorf("Check %d: expected an error", i)
+		}
+	}
+
+	// Without allow_other, only the current user gets in.
+	params.AllowOther = false
+	if err := checkAccess(ctxFor(other), false); err == nil {
+		t.Error("Expected an error without allow_other")
+	}
+}
+
+// Test that a user who isn't allowed in can't read a file below a
+// TLF, even after the owner has looked it up, so that the kernel
+// has cached the path.
+func TestAccessDeniedBelowRoot(t *testing.T) {
+	ctx := libkbfs.BackgroundContextWithCancellationDelayer()
+	defer libkbfs.CleanupCancellationDelayer(ctx)
+	config := libkbfs.MakeTestConfigOrBust(t, "jdoe")
+	defer libkbfs.CheckConfigAndShutdown(ctx, t, config)
+
+	me := uint32(os.Getuid())
+	other := uint32(4321)
+	if me == other {
+		other++
+	}
+	params := AccessParams{
+		AllowOther: true,
+		ReaderUIDs: uidList{other + 1},
+	}
+	// Pretend requests come from other while this is set.
+	var asOther int32
+	hook := func(ctx context.Context, req fuse.Request) context.Context {
+		if atomic.LoadInt32(&asOther) == 0 {
+			return params.withRequestAccess(ctx, req)
+		}
+		return params.withRequestAccess(ctx, &fuse.ReadRequest{
+			Header: fuse.Header{Uid: other},
+		})
+	}
+	mnt, _, cancelFn := makeFSWithRequestHook(t, ctx, config, hook)
+	defer mnt.Close()
+	defer cancelFn()
+
+	tlfDir := path.Join(mnt.Dir, PrivateName, "jdoe")
+	p := path.Join(tlfDir, "secret")
+	if err := ioutil.WriteFile(p, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadFile(p); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&asOther, 1)
+	checkDenied := func(what string, err error) {
+		if !os.IsPermission(errors.Cause(err)) {
+			t.Errorf("%s: expected a permission error, got %v", what, err)
+		}
+	}
+	_, err := ioutil.ReadFile(p)
+	checkDenied("ReadFile", err)
+	_, err = ioutil.ReadDir(tlfDir)
+	checkDenied("ReadDir", err)
+	checkDenied("WriteFile", ioutil.WriteFile(p, []byte("x"), 0644))
+
+	atomic.StoreInt32(&asOther, 0)
+	buf, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := string(buf), "data"; g != e {
+		t.Errorf("wrong content: %q != %q", g, e)
+	}
+}
+
+func TestApplySymlinkPolicy(t *testing.T) {
+	var policy SymlinkPolicy
+	if err := policy.Set("rewrite"); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := policy, SymlinkRewrite; g != e {
+		t.Errorf("wrong policy: %s != %s", g, e)
+	}
+	if err := policy.Set("ignore"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+
+	ctx := context.Background()
+	filesys := &FS{
+		log:      logger.NewTestLogger(t),
+		mountDir: "/mnt/kb",
+	}
+	dir := "/private/jdoe/a"
+	checks := []struct {
+		target  string
+		rewrite string
+		escapes bool
+	}{
+		{"b", "b", false},
+		{"../../../public/jdoe", "../../../public/jdoe", false},
+		{"/mnt/kb/private/jdoe/b", "/mnt/kb/private/jdoe/b", false},
+		{"../../../../etc/passwd", "/mnt/kb/etc/passwd", true},
+		{"/etc/passwd", "/mnt/kb/etc/passwd", true},
+		{"/keybase/private/jdoe/b", "/mnt/kb/private/jdoe/b", true},
+	}
+	for _, c := range checks {
+		filesys.platformParams.SymlinkPolicy = SymlinkFollow
+		got, err := filesys.applySymlinkPolicy(ctx, dir, c.target)
+		if err != nil || got != c.target {
+			t.Errorf("follow %s: got %q, %v", c.target, got, err)
+		}
+
+		filesys.platformParams.SymlinkPolicy = SymlinkDeny
+		got, err = filesys.applySymlinkPolicy(ctx, dir, c.target)
+		if c.escapes {
+			if err == nil {
+				t.Errorf("deny %s: unexpectedly got %q", c.target, got)
+			}
+		} else if err != nil || got != c.target {
+			t.Errorf("deny %s: got %q, %v", c.target, got, err)
+		}
+
+		filesys.platformParams.SymlinkPolicy = SymlinkRewrite
+		got, err = filesys.applySymlinkPolicy(ctx, dir, c.target)
+		if err != nil || got != c.rewrite {
+			t.Errorf("rewrite %s: got %q, %v (expected %q)",
+				c.target, got, err, c.rewrite)
+		}
+	}
+}
+
+func TestPrepareMountpoint(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "kbfs_mountpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		if err != nil {
+			t.Errorf("Couldn't remove %s: %v", tempdir, err)
+		}
+	}()
+	log := logger.NewTestLogger(t)
+	dataDir := path.Join(tempdir, "data")
+
+	r, err := ReadMountpointRecord(dataDir)
+	if err != nil || r != nil {
+		t.Fatalf("Unexpected record before the first mount: %v, %v", r, err)
+	}
+
+	dir := path.Join(tempdir, "mnt", "keybase")
+	if err := PrepareMountpoint(log, dataDir, dir); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := ioutil.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.IsDir() {
+		t.Errorf("Mountpoint %s is not a directory", dir)
+	}
+	r, err = ReadMountpointRecord(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r == nil || r.Dir != dir || r.Pid != os.Getpid() {
+		t.Errorf("Unexpected record: %+v", r)
+	}
+
+	file := path.Join(tempdir, "file")
+	if err := ioutil.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := PrepareMountpoint(log, dataDir, file); err == nil {
+		t.Error("Unexpectedly prepared a file as a mountpoint")
+	}
+}
@@ -10,8 +10,20 @@ import (
 	"os/exec"
 	"path"
 	"runtime"
+	"time"
 
 	"bazil.org/fuse"
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+const (
+	// How long to wait for processes to close their files under
+	// the mount before forcing an unmount.
+	unmountDrainTimeout = 10 * time.Second
+	// How often to retry a clean unmount while waiting.
+	unmountRetryInterval = 500 * time.Millisecond
 )
 
 // Mounter defines interface for different mounting strategies
@@ -94,7 +106,9 @@ func doUnmount(dir string, force bool) (err error) {
 		}
 	case "linux":
 		if force {
-			_, err = exec.Command("fusermount", "-ul", dir).Output()
+			// A lazy unmount detaches the mount even while
+			// it's busy, or its server is gone.
+			_, err = exec.Command("fusermount", "-uz", dir).Output()
 		} else {
 			_, err = exec.Command("fusermount", "-u", dir).Output()
 		}
@@ -108,6 +122,51 @@ func doUnmount(dir string, force bool) (err error) {
 	return err
 }
 
+// unmountGracefully unmounts mounter's directory cleanly if it can.
+// A clean unmount fails while any process has a file open (or its
+// working directory) under the mount, so it keeps trying for up to
+// unmountDrainTimeout.  If the mount is still busy after that, it
+// syncs all dirty files, so nothing written so far is lost, and then
+// forces the unmount.
+//
+// On Linux, the forced unmount is lazy: the mountpoint is released
+// right away, but the FUSE connection, and so FS.Serve, lasts until
+// the last open file is closed.
+func unmountGracefully(ctx context.Context, log logger.Logger,
+	config libkbfs.Config, mounter Mounter) error {
+	dir := mounter.Dir()
+	deadline := time.Now().Add(unmountDrainTimeout)
+	for i := 0; ; i++ {
+		err := doUnmount(dir, false)
+		if err == nil {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
+		if i == 0 {
+			log.CDebugf(ctx, "Couldn't unmount %s (%v), probably "+
+				"because it's busy; waiting up to %s for open files "+
+				"to be closed", dir, err, unmountDrainTimeout)
+		}
+		select {
+		case <-time.After(unmountRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	log.CWarningf(ctx, "%s is still busy after %s; syncing dirty "+
+		"files and forcing the unmount", dir, unmountDrainTimeout)
+	err := libkbfs.SyncAllDirtyFiles(ctx, config)
+	if err != nil {
+		// Force the unmount anyway; libkbfs.Shutdown will try
+		// to sync again.
+		log.CWarningf(ctx, "Couldn't sync all dirty files: %+v", err)
+	}
+	return doUnmount(dir, true)
+}
+
 // Dir returns mount directory.
 func (m ForceMounter) Dir() string {
 	return m.dir
@@ -118,6 +177,7 @@ func fuseMountDir(dir string, platformParams PlatformParams) (*fuse.Conn, error)
 	if err != nil {
 		return nil, err
 	}
+	options = append(options, platformParams.mountOptions()...)
 	c, err := fuse.Mount(dir, options...)
 	if err != nil {
 		err = translatePlatformSpecificError(err, platformParams)
@@ -33,9 +33,13 @@ func getPlatformSpecificMountOptions(dir string, platformParams PlatformParams)
 	options = append(options, locationOption)
 
 	// Volume name option is only used on OSX (ignored on other platforms).
-	volName, err := volumeName(dir)
-	if err != nil {
-		return nil, err
+	volName := platformParams.VolumeName
+	if volName == "" {
+		var err error
+		volName, err = volumeName(dir)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	options = append(options, fuse.VolumeName(volName))
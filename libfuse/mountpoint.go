@@ -0,0 +1,129 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/pkg/errors"
+)
+
+// mountpointRecordFile is the name of the file, in the KBFS data
+// directory, that records where kbfsfuse last mounted KBFS.
+const mountpointRecordFile = "kbfs_mountpoint.json"
+
+// MountpointRecord is what's recorded about the last mount, so that
+// the next kbfsfuse run can use the same mountpoint by default, and
+// clean it up if that run crashed.
+type MountpointRecord struct {
+	Dir       string    `json:"dir"`
+	Pid       int       `json:"pid"`
+	MountTime time.Time `json:"mount_time"`
+}
+
+func mountpointRecordPath(dataDir string) string {
+	return filepath.Join(dataDir, mountpointRecordFile)
+}
+
+// ReadMountpointRecord returns the mountpoint recorded in the given
+// KBFS data directory, or nil if there isn't one.
+func ReadMountpointRecord(dataDir string) (*MountpointRecord, error) {
+	var r MountpointRecord
+	err := ioutil.DeserializeFromJSONFile(mountpointRecordPath(dataDir), &r)
+	if ioutil.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// writeMountpointRecord records dir as the mountpoint in use by this
+// process.
+func writeMountpointRecord(dataDir, dir string) error {
+	return ioutil.SerializeToJSONFile(MountpointRecord{
+		Dir:       dir,
+		Pid:       os.Getpid(),
+		MountTime: time.Now(),
+	}, mountpointRecordPath(dataDir))
+}
+
+// isStaleMountError returns whether err, from stat'ing a mountpoint,
+// means that a FUSE file system is still mounted there, but the
+// process serving it is gone.
+func isStaleMountError(err error) bool {
+	pathErr, ok := errors.Cause(err).(*os.PathError)
+	if !ok {
+		return false
+	}
+	// Linux returns ENOTCONN for a mount whose FUSE connection is
+	// gone; macOS returns ENXIO.
+	return pathErr.Err == syscall.ENOTCONN || pathErr.Err == syscall.ENXIO
+}
+
+// cleanStaleMount unmounts dir if it holds a FUSE mount left behind by
+// a kbfsfuse that crashed.  Such a mount fails every access, including
+// a new mount on top of it.
+func cleanStaleMount(log logger.Logger, dir string) error {
+	_, err := ioutil.Stat(dir)
+	if !isStaleMountError(err) {
+		return nil
+	}
+	log.Info("Unmounting stale mount at %s (%v)", dir, err)
+	if err := doUnmount(dir, true); err != nil {
+		return errors.Wrapf(err, "couldn't unmount stale mount %s", dir)
+	}
+	return nil
+}
+
+// PrepareMountpoint makes dir ready to be mounted on: it unmounts any
+// stale mount left there by a crashed kbfsfuse, and creates the
+// directory if it doesn't exist.  If dataDir is non-empty, it also
+// cleans up the mountpoint recorded there by the last run, if that
+// was somewhere else, and then records dir in its place.
+func PrepareMountpoint(log logger.Logger, dataDir, dir string) error {
+	if dataDir != "" {
+		r, err := ReadMountpointRecord(dataDir)
+		if err != nil {
+			// A bad record shouldn't stop us from mounting; it'll
+			// be overwritten below.
+			log.Warning("Couldn't read the recorded mountpoint: %v", err)
+		} else if r != nil && r.Dir != dir {
+			if err := cleanStaleMount(log, r.Dir); err != nil {
+				log.Warning("%v", err)
+			}
+		}
+	}
+
+	if err := cleanStaleMount(log, dir); err != nil {
+		return err
+	}
+
+	fi, err := ioutil.Stat(dir)
+	switch {
+	case ioutil.IsNotExist(err):
+		log.Info("Creating mountpoint %s", dir)
+		if err := ioutil.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case !fi.IsDir():
+		return fmt.Errorf("Mountpoint %s is not a directory", dir)
+	}
+
+	if dataDir != "" {
+		if err := writeMountpointRecord(dataDir, dir); err != nil {
+			log.Warning("Couldn't record the mountpoint: %v", err)
+		}
+	}
+	return nil
+}
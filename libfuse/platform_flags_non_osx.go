@@ -10,7 +10,12 @@ import "flag"
 
 // PlatformParams contains all platform-specific parameters to be
 // passed to New{Default,Force}Mounter.
-type PlatformParams struct{}
+type PlatformParams struct {
+	// SymlinkPolicy says what to do with symlinks that lead
+	// outside the mount.
+	SymlinkPolicy SymlinkPolicy
+	AccessParams
+}
 
 func (p PlatformParams) shouldAppendPlatformRootDirs() bool {
 	return false
@@ -19,7 +24,8 @@ func (p PlatformParams) shouldAppendPlatformRootDirs() bool {
 // GetPlatformUsageString returns a string to be included in a usage
 // string corresponding to the flags added by AddPlatformFlags.
 func GetPlatformUsageString() string {
-	return ""
+	return "[--symlink-policy=follow|deny|rewrite]\n    " +
+		"[--allow-other [--reader-uids=uid,...]]\n    "
 }
 
 // AddPlatformFlags adds platform-specific flags to the given FlagSet
@@ -27,5 +33,7 @@ func GetPlatformUsageString() string {
 // given FlagSet is parsed.
 func AddPlatformFlags(flags *flag.FlagSet) *PlatformParams {
 	var params PlatformParams
+	addSymlinkPolicyFlag(flags, &params.SymlinkPolicy)
+	addAccessFlags(flags, &params.AccessParams)
 	return &params
 }
@@ -13,6 +13,13 @@ import "flag"
 type PlatformParams struct {
 	UseSystemFuse bool
 	UseLocal      bool
+	// VolumeName is the name Finder shows for the mount.  If
+	// empty, the base name of the mountpoint is used.
+	VolumeName string
+	// SymlinkPolicy says what to do with symlinks that lead
+	// outside the mount.
+	SymlinkPolicy SymlinkPolicy
+	AccessParams
 }
 
 func (p PlatformParams) shouldAppendPlatformRootDirs() bool {
@@ -22,7 +29,9 @@ func (p PlatformParams) shouldAppendPlatformRootDirs() bool {
 // GetPlatformUsageString returns a string to be included in a usage
 // string corresponding to the flags added by AddPlatformFlags.
 func GetPlatformUsageString() string {
-	return "[--use-system-fuse] [--local-experimental]\n    "
+	return "[--use-system-fuse] [--local-experimental] [--volume-name=name]\n    " +
+		"[--symlink-policy=follow|deny|rewrite]\n    " +
+		"[--allow-other [--reader-uids=uid,...]]\n    "
 }
 
 // AddPlatformFlags adds platform-specific flags to the given FlagSet
@@ -37,5 +46,10 @@ func AddPlatformFlags(flags *flag.FlagSet) *PlatformParams {
 			"apps. The \"hacky stuff\" includes a Trash implementation that only "+
 			"works for the user's own private TLF, so if you enable this please "+
 			"only work under your own private TLF.")
+	flags.StringVar(&params.VolumeName, "volume-name", DefaultVolumeName,
+		"The name Finder shows for the mount; if empty, use the "+
+			"base name of the mountpoint")
+	addSymlinkPolicyFlag(flags, &params.SymlinkPolicy)
+	addAccessFlags(flags, &params.AccessParams)
 	return &params
 }
@@ -36,6 +36,9 @@ var _ fs.HandleWriter = (*PrefetchFile)(nil)
 func (f *PrefetchFile) Write(ctx context.Context, req *fuse.WriteRequest,
 	resp *fuse.WriteResponse) (err error) {
 	f.fs.log.CDebugf(ctx, "PrefetchFile (enable: %t) Write", f.enable)
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { f.fs.reportErr(ctx, libkbfs.WriteMode, err) }()
 	if len(req.Data) == 0 {
 		return nil
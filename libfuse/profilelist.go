@@ -31,7 +31,11 @@ func (ProfileList) Attr(_ context.Context, a *fuse.Attr) error {
 var _ fs.NodeRequestLookuper = ProfileList{}
 
 // Lookup implements the fs.NodeRequestLookuper interface.
-func (pl ProfileList) Lookup(_ context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (node fs.Node, err error) {
+func (pl ProfileList) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (node fs.Node, err error) {
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+
 	f := libfs.ProfileGet(req.Name)
 	if f == nil {
 		return nil, fuse.ENOENT
@@ -45,7 +49,11 @@ var _ fs.Handle = ProfileList{}
 var _ fs.HandleReadDirAller = ProfileList{}
 
 // ReadDirAll implements the ReadDirAll interface.
-func (pl ProfileList) ReadDirAll(_ context.Context) (res []fuse.Dirent, err error) {
+func (pl ProfileList) ReadDirAll(ctx context.Context) (res []fuse.Dirent, err error) {
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+
 	profiles := pprof.Profiles()
 	res = make([]fuse.Dirent, 0, len(profiles))
 	for _, p := range profiles {
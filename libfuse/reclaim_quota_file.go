@@ -37,6 +37,9 @@ var _ fs.HandleWriter = (*ReclaimQuotaFile)(nil)
 func (f *ReclaimQuotaFile) Write(ctx context.Context, req *fuse.WriteRequest,
 	resp *fuse.WriteResponse) (err error) {
 	f.folder.fs.log.CDebugf(ctx, "ReclaimQuotaFile Write")
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 	if len(req.Data) == 0 {
 		return nil
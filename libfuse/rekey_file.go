@@ -34,6 +34,9 @@ var _ fs.HandleWriter = (*RekeyFile)(nil)
 func (f *RekeyFile) Write(ctx context.Context, req *fuse.WriteRequest,
 	resp *fuse.WriteResponse) (err error) {
 	f.folder.fs.log.CDebugf(ctx, "RekeyFile Write")
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 	if len(req.Data) == 0 {
 		return nil
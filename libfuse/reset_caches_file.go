@@ -39,6 +39,9 @@ var _ fs.HandleWriter = (*ResetCachesFile)(nil)
 func (f *ResetCachesFile) Write(ctx context.Context, req *fuse.WriteRequest,
 	resp *fuse.WriteResponse) (err error) {
 	f.fs.log.CDebugf(ctx, "ResetCachesFile Write")
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { f.fs.reportErr(ctx, libkbfs.WriteMode, err) }()
 	if len(req.Data) == 0 {
 		return nil
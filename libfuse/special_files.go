@@ -76,12 +76,24 @@ func handleTLFSpecialFile(
 	case libfs.StatusFileName:
 		return NewTLFStatusFile(folder, entryValid)
 
+	case libfs.SyncStatusFileName:
+		return NewTLFSyncStatusFile(folder, entryValid)
+
 	case UpdateHistoryFileName:
 		return NewUpdateHistoryFile(folder, entryValid)
 
+	case UnmergedHistoryFileName:
+		return NewUnmergedHistoryFile(folder, entryValid)
+
 	case libfs.EditHistoryName:
 		return NewTlfEditHistoryFile(folder, entryValid)
 
+	case libfs.ActivityLogName:
+		return NewTlfActivityLogFile(folder, entryValid)
+
+	case libfs.ArchivedDirName:
+		return &ArchivedRoot{folder: folder}
+
 	case libfs.UnstageFileName:
 		return &UnstageFile{
 			folder: folder,
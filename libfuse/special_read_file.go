@@ -22,6 +22,10 @@ var _ fs.Node = (*SpecialReadFile)(nil)
 
 // Attr implements the fs.Node interface for SpecialReadFile.
 func (f *SpecialReadFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
+
 	data, t, err := f.read(ctx)
 	if err != nil {
 		return err
@@ -47,6 +51,10 @@ var _ fs.NodeOpener = (*SpecialReadFile)(nil)
 // Open implements the fs.NodeOpener interface for SpecialReadFile.
 func (f *SpecialReadFile) Open(ctx context.Context, req *fuse.OpenRequest,
 	resp *fuse.OpenResponse) (fs.Handle, error) {
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+
 	data, _, err := f.read(ctx)
 	if err != nil {
 		return nil, err
@@ -7,6 +7,7 @@ package libfuse
 import (
 	"os"
 	"path"
+	"path/filepath"
 
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/kbfs/libfs"
@@ -20,6 +21,9 @@ type StartOptions struct {
 	PlatformParams PlatformParams
 	RuntimeDir     string
 	Label          string
+	// Remount, if true, mounts the filesystem again whenever the
+	// mount goes away without kbfsfuse being asked to stop.
+	Remount bool
 }
 
 // Start the filesystem
@@ -44,7 +48,14 @@ func Start(mounter Mounter, options StartOptions, kbCtx libkbfs.Context) *libfs.
 	if err != nil {
 		return libfs.InitError(err.Error())
 	}
-	defer libkbfs.Shutdown()
+	defer libkbfs.Shutdown(config)
+
+	if dir := mounter.Dir(); dir != "" {
+		err := PrepareMountpoint(log, kbCtx.GetDataDir(), dir)
+		if err != nil {
+			return libfs.MountError(err.Error())
+		}
+	}
 
 	log.Debug("Mounting: %s", mounter.Dir())
 	c, err := mounter.Mount()
@@ -54,9 +65,19 @@ func Start(mounter Mounter, options StartOptions, kbCtx libkbfs.Context) *libfs.
 	defer mounter.Unmount()
 
 	done := make(chan struct{})
-	if c != nil { // c can be nil for NoopMounter
+	unmount := func() error {
+		return unmountGracefully(
+			context.Background(), log, config, mounter)
+	}
+	var supervisor *mountSupervisor
+	if c != nil && options.Remount {
+		supervisor = newMountSupervisor(mounter, log, unmount)
 		interruptFn = func() {
-			mounter.Unmount()
+			supervisor.stop()
+		}
+	} else if c != nil { // c can be nil for NoopMounter
+		interruptFn = func() {
+			unmount()
 		}
 	} else {
 		interruptFn = func() {
@@ -73,11 +94,19 @@ func Start(mounter Mounter, options StartOptions, kbCtx libkbfs.Context) *libfs.
 
 		log.Debug("Creating filesystem")
 		fs := NewFS(config, c, options.KbfsParams.Debug, options.PlatformParams)
+		if dir, err := filepath.Abs(mounter.Dir()); err == nil {
+			fs.mountDir = dir
+		}
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 		ctx = context.WithValue(ctx, libfs.CtxAppIDKey, fs)
 		log.Debug("Serving filesystem")
-		if err = fs.Serve(ctx); err != nil {
+		if supervisor != nil {
+			err = supervisor.serve(ctx, fs)
+		} else {
+			err = fs.Serve(ctx)
+		}
+		if err != nil {
 			return libfs.MountError(err.Error())
 		}
 	} else {
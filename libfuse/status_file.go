@@ -35,3 +35,16 @@ func NewTLFStatusFile(
 		},
 	}
 }
+
+// NewTLFSyncStatusFile returns a special read file that contains a
+// summary of the sync status of the current TLF.
+func NewTLFSyncStatusFile(
+	folder *Folder, entryValid *time.Duration) *SpecialReadFile {
+	*entryValid = 0
+	return &SpecialReadFile{
+		read: func(ctx context.Context) ([]byte, time.Time, error) {
+			return libfs.GetEncodedTlfSyncStatus(
+				ctx, folder.fs.config, folder.getFolderBranch())
+		},
+	}
+}
@@ -31,6 +31,9 @@ var _ fs.Node = (*Symlink)(nil)
 // Attr implements the fs.Node interface for Symlink
 func (s *Symlink) Attr(ctx context.Context, a *fuse.Attr) (err error) {
 	s.parent.folder.fs.log.CDebugf(ctx, "Symlink Attr")
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
 	defer func() { s.parent.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
 
 	_, de, err := s.parent.folder.fs.config.KBFSOps().Lookup(ctx, s.parent.node, s.name)
@@ -51,6 +54,9 @@ var _ fs.NodeReadlinker = (*Symlink)(nil)
 // Readlink implements the fs.NodeReadlinker interface for Symlink
 func (s *Symlink) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (link string, err error) {
 	s.parent.folder.fs.log.CDebugf(ctx, "Symlink Readlink")
+	if err := checkAccess(ctx, false); err != nil {
+		return "", err
+	}
 	defer func() { s.parent.folder.reportErr(ctx, libkbfs.ReadMode, err) }()
 
 	_, de, err := s.parent.folder.fs.config.KBFSOps().Lookup(ctx, s.parent.node, s.name)
@@ -61,5 +67,14 @@ func (s *Symlink) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (link
 	if de.Type != libkbfs.Sym {
 		return "", fuse.Errno(syscall.EINVAL)
 	}
-	return de.SymPath, nil
+	if s.parent.folder.fs.platformParams.SymlinkPolicy == SymlinkFollow {
+		return de.SymPath, nil
+	}
+
+	dirPath, ok := s.parent.node.GetPathPlaintextSansTlf()
+	if !ok {
+		return "", fuse.ESTALE
+	}
+	return s.parent.folder.fs.applySymlinkPolicy(ctx,
+		s.parent.folder.mountPath(dirPath), de.SymPath)
 }
@@ -0,0 +1,133 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"strings"
+	"syscall"
+
+	"bazil.org/fuse"
+	"golang.org/x/net/context"
+)
+
+// SymlinkPolicy says what the mount does with symlinks whose targets
+// lead outside of it.  KBFS symlinks are written by any writer of a
+// folder, on any device, so a target like /etc/passwd or
+// ../../../../home/me/.ssh would otherwise make local programs that
+// follow it read local files they never meant to.
+type SymlinkPolicy int
+
+const (
+	// SymlinkFollow returns every symlink target unchanged.
+	SymlinkFollow SymlinkPolicy = iota
+	// SymlinkDeny makes reading a symlink that leads outside the
+	// mount fail with EACCES, so it can't be followed.
+	SymlinkDeny
+	// SymlinkRewrite re-roots symlinks that lead outside the mount
+	// at the mountpoint, as if the mount were the root of the file
+	// system.  Absolute targets under /keybase are translated to the
+	// actual mountpoint, so links made on devices that mount KBFS in
+	// the usual place keep working.
+	SymlinkRewrite
+)
+
+var _ flag.Value = (*SymlinkPolicy)(nil)
+
+func (p SymlinkPolicy) String() string {
+	switch p {
+	case SymlinkFollow:
+		return "follow"
+	case SymlinkDeny:
+		return "deny"
+	case SymlinkRewrite:
+		return "rewrite"
+	default:
+		return fmt.Sprintf("SymlinkPolicy(%d)", int(p))
+	}
+}
+
+// Set implements the flag.Value interface for SymlinkPolicy.
+func (p *SymlinkPolicy) Set(s string) error {
+	switch s {
+	case "follow":
+		*p = SymlinkFollow
+	case "deny":
+		*p = SymlinkDeny
+	case "rewrite":
+		*p = SymlinkRewrite
+	default:
+		return fmt.Errorf("Unknown symlink policy %q; "+
+			"must be follow, deny or rewrite", s)
+	}
+	return nil
+}
+
+func addSymlinkPolicyFlag(flags *flag.FlagSet, policy *SymlinkPolicy) {
+	flags.Var(policy, "symlink-policy",
+		"What to do with symlinks that lead outside the mount: "+
+			"follow, deny or rewrite")
+}
+
+// canonicalMountDir is where KBFS is mounted on most systems, and so
+// where absolute symlinks made on other devices most likely point.
+const canonicalMountDir = "/keybase"
+
+// mountPath returns the path, relative to the mountpoint, of the
+// given path below the root of this folder.
+func (f *Folder) mountPath(p string) string {
+	listName := PrivateName
+	if f.list.public {
+		listName = PublicName
+	}
+	return path.Join("/", listName, string(f.name()), p)
+}
+
+// applySymlinkPolicy returns what should be reported as the target of
+// a symlink in the directory at dirPath (relative to the mountpoint),
+// given its stored target.
+func (f *FS) applySymlinkPolicy(ctx context.Context, dirPath string,
+	target string) (string, error) {
+	policy := f.platformParams.SymlinkPolicy
+	if policy == SymlinkFollow {
+		return target, nil
+	}
+
+	mountDir := f.mountDir
+	if mountDir == "" {
+		mountDir = canonicalMountDir
+	}
+	var resolved string
+	if path.IsAbs(target) {
+		resolved = path.Clean(target)
+	} else {
+		resolved = path.Join(mountDir, dirPath, target)
+	}
+	if resolved == mountDir || strings.HasPrefix(resolved, mountDir+"/") {
+		return target, nil
+	}
+
+	f.log.CDebugf(ctx, "Symlink in %s to %s leads outside the mount (%s)",
+		dirPath, target, policy)
+	switch policy {
+	case SymlinkRewrite:
+		var inMount string
+		if !path.IsAbs(target) {
+			// Cleaning a rooted path drops any ".." that would
+			// climb above the root.
+			inMount = path.Join("/", dirPath, target)
+		} else if resolved == canonicalMountDir ||
+			strings.HasPrefix(resolved, canonicalMountDir+"/") {
+			inMount = strings.TrimPrefix(resolved, canonicalMountDir)
+		} else {
+			inMount = resolved
+		}
+		return path.Join(mountDir, inMount), nil
+	default:
+		return "", fuse.Errno(syscall.EACCES)
+	}
+}
@@ -44,6 +44,9 @@ var _ fs.HandleWriter = (*SyncFromServerFile)(nil)
 func (f *SyncFromServerFile) Write(ctx context.Context, req *fuse.WriteRequest,
 	resp *fuse.WriteResponse) (err error) {
 	f.folder.fs.log.CDebugf(ctx, "SyncFromServerFile Write")
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 	if len(req.Data) == 0 {
 		return nil
@@ -138,6 +138,10 @@ func (tlf *TLF) Access(ctx context.Context, r *fuse.AccessRequest) error {
 
 // Attr implements the fs.Node interface for TLF.
 func (tlf *TLF) Attr(ctx context.Context, a *fuse.Attr) error {
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
+
 	dir := tlf.getStoredDir()
 	if dir == nil {
 		tlf.log().CDebugf(
@@ -156,6 +160,10 @@ func (tlf *TLF) Attr(ctx context.Context, a *fuse.Attr) error {
 
 // Lookup implements the fs.NodeRequestLookuper interface for TLF.
 func (tlf *TLF) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.LookupResponse) (fs.Node, error) {
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+
 	dir, exitEarly, err := tlf.loadDirAllowNonexistent(ctx)
 	if err != nil {
 		return nil, err
@@ -219,6 +227,10 @@ func (tlf *TLF) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 
 // ReadDirAll implements the fs.NodeReadDirAller interface for TLF.
 func (tlf *TLF) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+
 	dir, exitEarly, err := tlf.loadDirAllowNonexistent(ctx)
 	if err != nil || exitEarly {
 		return nil, err
@@ -250,6 +262,10 @@ var _ fs.NodeOpener = (*TLF)(nil)
 // Open implements the fs.NodeOpener interface for TLF.
 func (tlf *TLF) Open(ctx context.Context, req *fuse.OpenRequest,
 	resp *fuse.OpenResponse) (fs.Handle, error) {
+	if err := checkAccess(ctx, false); err != nil {
+		return nil, err
+	}
+
 	// Explicitly load the directory when a TLF is opened, because
 	// some OSX programs like ls have a bug that doesn't report errors
 	// on a ReadDirAll.
@@ -35,6 +35,9 @@ var _ fs.HandleWriter = (*UnstageFile)(nil)
 // Write implements the fs.HandleWriter interface for UnstageFile.
 func (f *UnstageFile) Write(ctx context.Context, req *fuse.WriteRequest,
 	resp *fuse.WriteResponse) (err error) {
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
 	defer func() { f.folder.reportErr(ctx, libkbfs.WriteMode, err) }()
 	size, err := libfs.UnstageForTesting(
 		ctx, f.folder.fs.log, f.folder.fs.config,
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/keybase/kbfs/libkbfs"
 	"golang.org/x/net/context"
 )
 
@@ -15,11 +16,22 @@ import (
 // can be reached anywhere within a top-level folder.
 const UpdateHistoryFileName = ".kbfs_update_history"
 
-func getEncodedUpdateHistory(ctx context.Context, folder *Folder) (
-	data []byte, t time.Time, err error) {
+// UnmergedHistoryFileName is the name of the file listing the
+// revisions on this device's unmerged branch of a top-level folder,
+// if any -- it can be reached anywhere within a top-level folder.
+const UnmergedHistoryFileName = ".kbfs_unmerged_history"
+
+func getEncodedUpdateHistory(ctx context.Context, folder *Folder,
+	unmerged bool) (data []byte, t time.Time, err error) {
 	folderBranch := folder.getFolderBranch()
-	history, err := folder.fs.config.KBFSOps().GetUpdateHistory(
-		ctx, folderBranch)
+	var history libkbfs.TLFUpdateHistory
+	if unmerged {
+		history, err = folder.fs.config.KBFSOps().GetUnmergedHistory(
+			ctx, folderBranch)
+	} else {
+		history, err = folder.fs.config.KBFSOps().GetUpdateHistory(
+			ctx, folderBranch)
+	}
 	if err != nil {
 		return nil, time.Time{}, err
 	}
@@ -40,7 +52,20 @@ func NewUpdateHistoryFile(
 	*entryValid = 0
 	return &SpecialReadFile{
 		read: func(ctx context.Context) ([]byte, time.Time, error) {
-			return getEncodedUpdateHistory(ctx, folder)
+			return getEncodedUpdateHistory(ctx, folder, false)
+		},
+	}
+}
+
+// NewUnmergedHistoryFile returns a special read file that contains a
+// text representation of the local unmerged revisions of the current
+// TLF.
+func NewUnmergedHistoryFile(
+	folder *Folder, entryValid *time.Duration) *SpecialReadFile {
+	*entryValid = 0
+	return &SpecialReadFile{
+		read: func(ctx context.Context) ([]byte, time.Time, error) {
+			return getEncodedUpdateHistory(ctx, folder, true)
 		},
 	}
 }
@@ -0,0 +1,145 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libfuse
+
+import (
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/keybase/kbfs/libkbfs"
+	"golang.org/x/net/context"
+)
+
+// The helpers below implement the xattr requests for both files and
+// directories. TLF roots don't support xattrs, since KBFS keeps them
+// in the parent directory's entry.
+
+func getxattr(ctx context.Context, folder *Folder, node libkbfs.Node,
+	req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) (err error) {
+	folder.fs.log.CDebugf(ctx, "Getxattr %s", req.Name)
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
+	defer func() { folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+
+	if req.Position != 0 {
+		// Only used for the resource fork on OS X, which we
+		// don't support.
+		return fuse.ENOTSUP
+	}
+	value, err := folder.fs.config.KBFSOps().GetXattr(ctx, node, req.Name)
+	if err != nil {
+		return err
+	}
+	resp.Xattr = value
+	return nil
+}
+
+func listxattr(ctx context.Context, folder *Folder, node libkbfs.Node,
+	req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) (err error) {
+	folder.fs.log.CDebugf(ctx, "Listxattr")
+	if err := checkAccess(ctx, false); err != nil {
+		return err
+	}
+	defer func() { folder.reportErr(ctx, libkbfs.ReadMode, err) }()
+
+	names, err := folder.fs.config.KBFSOps().ListXattrs(ctx, node)
+	if err != nil {
+		return err
+	}
+	resp.Append(names...)
+	return nil
+}
+
+func setxattr(ctx context.Context, folder *Folder, node libkbfs.Node,
+	req *fuse.SetxattrRequest) (err error) {
+	folder.fs.log.CDebugf(ctx, "Setxattr %s", req.Name)
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
+	defer func() { folder.reportErr(ctx, libkbfs.WriteMode, err) }()
+
+	if req.Position != 0 {
+		return fuse.ENOTSUP
+	}
+	return folder.fs.config.KBFSOps().SetXattr(
+		ctx, node, req.Name, req.Xattr)
+}
+
+func removexattr(ctx context.Context, folder *Folder, node libkbfs.Node,
+	req *fuse.RemovexattrRequest) (err error) {
+	folder.fs.log.CDebugf(ctx, "Removexattr %s", req.Name)
+	if err := checkAccess(ctx, true); err != nil {
+		return err
+	}
+	defer func() { folder.reportErr(ctx, libkbfs.WriteMode, err) }()
+
+	return folder.fs.config.KBFSOps().RemoveXattr(ctx, node, req.Name)
+}
+
+var _ fs.NodeGetxattrer = (*File)(nil)
+
+// Getxattr implements the fs.NodeGetxattrer interface for File.
+func (f *File) Getxattr(ctx context.Context, req *fuse.GetxattrRequest,
+	resp *fuse.GetxattrResponse) error {
+	return getxattr(ctx, f.folder, f.node, req, resp)
+}
+
+var _ fs.NodeListxattrer = (*File)(nil)
+
+// Listxattr implements the fs.NodeListxattrer interface for File.
+func (f *File) Listxattr(ctx context.Context, req *fuse.ListxattrRequest,
+	resp *fuse.ListxattrResponse) error {
+	return listxattr(ctx, f.folder, f.node, req, resp)
+}
+
+var _ fs.NodeSetxattrer = (*File)(nil)
+
+// Setxattr implements the fs.NodeSetxattrer interface for File.
+func (f *File) Setxattr(
+	ctx context.Context, req *fuse.SetxattrRequest) error {
+	f.eiCache.destroy()
+	return setxattr(ctx, f.folder, f.node, req)
+}
+
+var _ fs.NodeRemovexattrer = (*File)(nil)
+
+// Removexattr implements the fs.NodeRemovexattrer interface for File.
+func (f *File) Removexattr(
+	ctx context.Context, req *fuse.RemovexattrRequest) error {
+	f.eiCache.destroy()
+	return removexattr(ctx, f.folder, f.node, req)
+}
+
+var _ fs.NodeGetxattrer = (*Dir)(nil)
+
+// Getxattr implements the fs.NodeGetxattrer interface for Dir.
+func (d *Dir) Getxattr(ctx context.Context, req *fuse.GetxattrRequest,
+	resp *fuse.GetxattrResponse) error {
+	return getxattr(ctx, d.folder, d.node, req, resp)
+}
+
+var _ fs.NodeListxattrer = (*Dir)(nil)
+
+// Listxattr implements the fs.NodeListxattrer interface for Dir.
+func (d *Dir) Listxattr(ctx context.Context, req *fuse.ListxattrRequest,
+	resp *fuse.ListxattrResponse) error {
+	return listxattr(ctx, d.folder, d.node, req, resp)
+}
+
+var _ fs.NodeSetxattrer = (*Dir)(nil)
+
+// Setxattr implements the fs.NodeSetxattrer interface for Dir.
+func (d *Dir) Setxattr(
+	ctx context.Context, req *fuse.SetxattrRequest) error {
+	return setxattr(ctx, d.folder, d.node, req)
+}
+
+var _ fs.NodeRemovexattrer = (*Dir)(nil)
+
+// Removexattr implements the fs.NodeRemovexattrer interface for Dir.
+func (d *Dir) Removexattr(
+	ctx context.Context, req *fuse.RemovexattrRequest) error {
+	return removexattr(ctx, d.folder, d.node, req)
+}
@@ -116,7 +116,7 @@ func newBackpressureDiskLimiterWithFunctions(
 
 // defaultDoDelay uses a timer to delay by the given duration.
 func defaultDoDelay(ctx context.Context, delay time.Duration) error {
-	if delay == 0 {
+	if delay <= 0 {
 		return nil
 	}
 
@@ -40,9 +40,7 @@ func TestBackpressureConstructorError(t *testing.T) {
 // TestBackpressureDiskLimiterCounters checks that various counters
 // are updated properly for each public method.
 func TestBackpressureDiskLimiterCounters(t *testing.T) {
-	var lastDelay time.Duration
 	delayFn := func(ctx context.Context, delay time.Duration) error {
-		lastDelay = delay
 		return nil
 	}
 
@@ -0,0 +1,82 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// BlockBandwidthLimits caps the average rate at which block data is
+// sent to and received from a remote block server, in bytes per
+// second. A limit of zero or less means no limit.
+type BlockBandwidthLimits struct {
+	Upload   int64
+	Download int64
+}
+
+type blockBandwidthLimitsGetter interface {
+	// BlockBandwidthLimits returns the current limits on block
+	// server traffic.
+	BlockBandwidthLimits() BlockBandwidthLimits
+}
+
+// bandwidthLimiter delays callers so that the bytes they transfer
+// average out to at most a given rate. The rate is passed in on each
+// call, so it can be changed at any time.
+type bandwidthLimiter struct {
+	clock Clock
+
+	lock sync.Mutex
+	// free is when all the bytes reserved so far will have been
+	// transferred at the limited rate.
+	free time.Time
+}
+
+func newBandwidthLimiter(clock Clock) *bandwidthLimiter {
+	return &bandwidthLimiter{clock: clock}
+}
+
+// reserve accounts for n bytes about to be transferred at
+// bytesPerSec, and returns how long the caller must wait before
+// transferring them.
+func (bl *bandwidthLimiter) reserve(n int, bytesPerSec int64) time.Duration {
+	if bytesPerSec <= 0 || n <= 0 {
+		return 0
+	}
+	bl.lock.Lock()
+	defer bl.lock.Unlock()
+	now := bl.clock.Now()
+	if bl.free.Before(now) {
+		// We've been idle, so there's no backlog to wait for.
+		bl.free = now
+	}
+	delay := bl.free.Sub(now)
+	bl.free = bl.free.Add(
+		time.Duration(int64(n) * int64(time.Second) / bytesPerSec))
+	return delay
+}
+
+// wait blocks until n bytes may be transferred at bytesPerSec, or
+// until ctx is done. The bytes stay reserved even if ctx is done
+// first. The wait doesn't count against the timeout of any block
+// server attempt ctx belongs to.
+func (bl *bandwidthLimiter) wait(
+	ctx context.Context, n int, bytesPerSec int64) error {
+	delay := bl.reserve(n, bytesPerSec)
+	if delay <= 0 {
+		return nil
+	}
+	resume := pauseBlockServerAttempt(ctx)
+	defer resume()
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
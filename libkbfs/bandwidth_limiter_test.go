@@ -0,0 +1,45 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestBandwidthLimiterReserve(t *testing.T) {
+	clock := newTestClockNow()
+	bl := newBandwidthLimiter(clock)
+
+	// No limit means no waiting.
+	require.Equal(t, time.Duration(0), bl.reserve(1000, 0))
+
+	// The first transfer goes right away, and the next ones wait
+	// for the earlier ones at 100 bytes/sec.
+	require.Equal(t, time.Duration(0), bl.reserve(100, 100))
+	require.Equal(t, time.Second, bl.reserve(50, 100))
+	require.Equal(t, 1500*time.Millisecond, bl.reserve(100, 100))
+
+	// Time passing eats into the backlog.
+	clock.Add(2 * time.Second)
+	require.Equal(t, 500*time.Millisecond, bl.reserve(100, 100))
+
+	// ...and an idle period doesn't bank any credit.
+	clock.Add(time.Minute)
+	require.Equal(t, time.Duration(0), bl.reserve(100, 100))
+	require.Equal(t, time.Second, bl.reserve(100, 100))
+}
+
+func TestBandwidthLimiterWaitCanceled(t *testing.T) {
+	bl := newBandwidthLimiter(wallClock{})
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, bl.wait(ctx, 100, 1))
+	cancel()
+	err := bl.wait(ctx, 100, 1)
+	require.Equal(t, context.Canceled, err)
+}
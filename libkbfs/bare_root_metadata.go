@@ -8,8 +8,10 @@ import (
 	"fmt"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfscodec"
 	"github.com/keybase/kbfs/tlf"
+	"golang.org/x/net/context"
 )
 
 // TODO: Wrap errors coming from BareRootMetadata.
@@ -36,6 +38,45 @@ func MakeInitialBareRootMetadata(
 	return MakeInitialBareRootMetadataV3(tlfID, h)
 }
 
+// isHandleWriter returns whether the given user may write to the TLF
+// with the given handle. The writers of a team TLF aren't in its
+// handle, so they're looked up with teamGetter, which may be nil only
+// when checking MD this device made itself, in which case any user
+// is taken to be a writer of a team TLF.
+func isHandleWriter(ctx context.Context, teamGetter teamInfoGetter,
+	h tlf.Handle, uid keybase1.UID) (bool, error) {
+	tid, ok := h.TeamID()
+	if !ok {
+		return h.IsWriter(uid), nil
+	}
+	if teamGetter == nil {
+		return true, nil
+	}
+	info, err := teamGetter.GetTeamInfo(ctx, tid)
+	if err != nil {
+		return false, err
+	}
+	return info.Writers[uid], nil
+}
+
+// isHandleReader is like isHandleWriter, but for readers, which
+// include all writers.
+func isHandleReader(ctx context.Context, teamGetter teamInfoGetter,
+	h tlf.Handle, uid keybase1.UID) (bool, error) {
+	tid, ok := h.TeamID()
+	if !ok || h.IsPublic() {
+		return h.IsReader(uid), nil
+	}
+	if teamGetter == nil {
+		return true, nil
+	}
+	info, err := teamGetter.GetTeamInfo(ctx, tid)
+	if err != nil {
+		return false, err
+	}
+	return info.Writers[uid] || info.Readers[uid], nil
+}
+
 func dumpConfig() *spew.ConfigState {
 	c := spew.NewDefaultConfig()
 	c.Indent = "  "
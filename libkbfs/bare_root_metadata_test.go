@@ -5,7 +5,6 @@
 package libkbfs
 
 import (
-	"context"
 	"reflect"
 	"runtime"
 	"strings"
@@ -17,6 +16,7 @@ import (
 	"github.com/keybase/kbfs/kbfscrypto"
 	"github.com/keybase/kbfs/tlf"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
 )
 
 var testMetadataVers = []MetadataVer{
@@ -137,7 +137,7 @@ func testRootMetadataFinalVerify(t *testing.T, ver MetadataVer) {
 	require.NoError(t, err)
 
 	// verify it
-	err = rmds.IsValidAndSigned(codec, crypto, extra)
+	err = rmds.IsValidAndSigned(ctx, codec, crypto, nil, extra)
 	require.NoError(t, err)
 
 	ext, err := tlf.NewHandleExtension(
@@ -149,7 +149,7 @@ func testRootMetadataFinalVerify(t *testing.T, ver MetadataVer) {
 	require.NoError(t, err)
 
 	// verify the finalized copy
-	err = rmds2.IsValidAndSigned(codec, crypto, extra)
+	err = rmds2.IsValidAndSigned(ctx, codec, crypto, nil, extra)
 	require.NoError(t, err)
 
 	// touch something the server shouldn't be allowed to edit for
@@ -159,6 +159,74 @@ func testRootMetadataFinalVerify(t *testing.T, ver MetadataVer) {
 	md3.SetRekeyBit()
 	rmds3 := rmds2
 	rmds2.MD = md3
-	err = rmds3.IsValidAndSigned(codec, crypto, extra)
+	err = rmds3.IsValidAndSigned(ctx, codec, crypto, nil, extra)
 	require.NotNil(t, err)
 }
+
+// fakeTeamInfoGetter looks teams up in a map.
+type fakeTeamInfoGetter map[keybase1.UID]TeamInfo
+
+func (g fakeTeamInfoGetter) GetTeamInfo(
+	ctx context.Context, tid keybase1.UID) (TeamInfo, error) {
+	info, ok := g[tid]
+	if !ok {
+		return TeamInfo{}, NoSuchTeamError{tid.String()}
+	}
+	return info, nil
+}
+
+// Test that the modifiers of team TLFs are checked against the
+// membership of the team.
+func TestRootMetadataTeamVerify(t *testing.T) {
+	runTestOverMetadataVers(t, testRootMetadataTeamVerify)
+}
+
+func testRootMetadataTeamVerify(t *testing.T, ver MetadataVer) {
+	tlfID := tlf.FakeID(1, false)
+
+	tid := tlf.FakeTeamID(1)
+	writer := keybase1.MakeTestUID(1)
+	reader := keybase1.MakeTestUID(2)
+	outsider := keybase1.MakeTestUID(3)
+	teams := fakeTeamInfoGetter{
+		tid: MakeTeamInfo("t1", tid, map[keybase1.UID]TeamRole{
+			writer: TeamRoleWriter,
+			reader: TeamRoleReader,
+		}),
+	}
+
+	bh, err := tlf.MakeHandle([]keybase1.UID{tid}, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	brmd, err := MakeInitialBareRootMetadata(ver, tlfID, bh)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	codec := kbfscodec.NewMsgpack()
+	crypto := MakeCryptoCommon(kbfscodec.NewMsgpack())
+	signer := kbfscrypto.SigningKeySigner{
+		Key: kbfscrypto.MakeFakeSigningKeyOrBust("key"),
+	}
+
+	extra := FakeInitialRekey(brmd, bh, kbfscrypto.TLFPublicKey{})
+	brmd.SetSerializedPrivateMetadata([]byte{42})
+
+	checkModifiers := func(lastWriter, lastUser keybase1.UID) error {
+		brmd.SetLastModifyingWriter(lastWriter)
+		brmd.SetLastModifyingUser(lastUser)
+		err := brmd.SignWriterMetadataInternally(ctx, codec, signer)
+		require.NoError(t, err)
+		return brmd.IsValidAndSigned(ctx, codec, crypto, teams, extra)
+	}
+
+	require.NoError(t, checkModifiers(writer, writer))
+	require.NoError(t, checkModifiers(writer, reader))
+	require.Error(t, checkModifiers(reader, reader))
+	require.Error(t, checkModifiers(writer, outsider))
+	require.Error(t, checkModifiers(outsider, writer))
+
+	// Without a way to look up the team, nothing can be verified.
+	err = brmd.IsValidAndSigned(
+		ctx, codec, crypto, fakeTeamInfoGetter{}, extra)
+	require.Equal(t, NoSuchTeamError{tid.String()}, err)
+}
@@ -734,7 +734,8 @@ func (md *BareRootMetadataV2) GetTLFCryptKeyParams(
 
 // IsValidAndSigned implements the BareRootMetadata interface for BareRootMetadataV2.
 func (md *BareRootMetadataV2) IsValidAndSigned(
-	codec kbfscodec.Codec, crypto cryptoPure, extra ExtraMetadata) error {
+	ctx context.Context, codec kbfscodec.Codec, crypto cryptoPure,
+	teamGetter teamInfoGetter, extra ExtraMetadata) error {
 	// Optimization -- if the WriterMetadata signature is nil, it
 	// will fail verification.
 	if md.WriterMetadataSigInfo.IsNil() {
@@ -787,13 +788,21 @@ func (md *BareRootMetadataV2) IsValidAndSigned(
 
 	// Make sure the last writer is valid.
 	writer := md.LastModifyingWriter()
-	if !handle.IsWriter(writer) {
+	ok, err := isHandleWriter(ctx, teamGetter, handle, writer)
+	if err != nil {
+		return err
+	}
+	if !ok {
 		return fmt.Errorf("Invalid modifying writer %s", writer)
 	}
 
 	// Make sure the last modifier is valid.
 	user := md.LastModifyingUser
-	if !handle.IsReader(user) {
+	ok, err = isHandleReader(ctx, teamGetter, handle, user)
+	if err != nil {
+		return err
+	}
+	if !ok {
 		return fmt.Errorf("Invalid modifying user %s", user)
 	}
 
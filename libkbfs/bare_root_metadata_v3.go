@@ -741,7 +741,8 @@ func checkRKBID(crypto cryptoPure,
 
 // IsValidAndSigned implements the BareRootMetadata interface for BareRootMetadataV3.
 func (md *BareRootMetadataV3) IsValidAndSigned(
-	codec kbfscodec.Codec, crypto cryptoPure, extra ExtraMetadata) error {
+	ctx context.Context, codec kbfscodec.Codec, crypto cryptoPure,
+	teamGetter teamInfoGetter, extra ExtraMetadata) error {
 	if md.TlfID().IsPublic() {
 		err := md.checkPublicExtra(extra)
 		if err != nil {
@@ -810,13 +811,21 @@ func (md *BareRootMetadataV3) IsValidAndSigned(
 
 	// Make sure the last writer is valid.
 	writer := md.LastModifyingWriter()
-	if !handle.IsWriter(writer) {
+	ok, err := isHandleWriter(ctx, teamGetter, handle, writer)
+	if err != nil {
+		return err
+	}
+	if !ok {
 		return errors.Errorf("Invalid modifying writer %s", writer)
 	}
 
 	// Make sure the last modifier is valid.
 	user := md.LastModifyingUser
-	if !handle.IsReader(user) {
+	ok, err = isHandleReader(ctx, teamGetter, handle, user)
+	if err != nil {
+		return err
+	}
+	if !ok {
 		return errors.Errorf("Invalid modifying user %s", user)
 	}
 
@@ -18,6 +18,9 @@ import (
 type blockContainer struct {
 	block         Block
 	hasPrefetched bool
+	// fromPrefetch is true if the block was cached by a prefetch,
+	// and hasn't been requested on demand since.
+	fromPrefetch bool
 }
 
 type idCacheKey struct {
@@ -30,11 +33,20 @@ type idCacheKey struct {
 // internally by just their block ID (since blocks are immutable and
 // content-addressable).
 type BlockCacheStandard struct {
+	// Keep the atomically-accessed fields first, so they're
+	// 64-bit aligned on 32-bit platforms.
 	cleanBytesCapacity uint64
 
+	// Statistics, only accessed atomically.
+	hits             uint64
+	misses           uint64
+	evictions        uint64
+	prefetchedBlocks uint64
+	prefetchHits     uint64
+
 	ids *lru.Cache
 
-	cleanTransient *lru.Cache
+	cleanTransient evictingCache
 
 	cleanLock      sync.RWMutex
 	cleanPermanent map[kbfsblock.ID]Block
@@ -43,6 +55,27 @@ type BlockCacheStandard struct {
 	cleanTotalBytes uint64
 }
 
+// BlockCacheStatus represents the status of the block cache, for
+// display in diagnostics. It is suitable for encoding directly as
+// JSON.
+type BlockCacheStatus struct {
+	// Hits and Misses count lookups of clean blocks.
+	Hits   uint64
+	Misses uint64
+	// Evictions counts transient blocks dropped to make room for
+	// others.
+	Evictions          uint64
+	TransientEntries   int
+	PermanentEntries   int
+	CleanBytes         uint64
+	CleanBytesCapacity uint64
+	// PrefetchedBlocks counts blocks cached by prefetches, and
+	// PrefetchHits how many of those were later requested on
+	// demand before being evicted.
+	PrefetchedBlocks uint64
+	PrefetchHits     uint64
+}
+
 // NewBlockCacheStandard constructs a new BlockCacheStandard instance
 // with the given transient capacity (in number of entries) and the
 // clean bytes capacity, which is the total of number of bytes allowed
@@ -51,6 +84,16 @@ type BlockCacheStandard struct {
 // evicted until the block will fit in capacity.
 func NewBlockCacheStandard(transientCapacity int,
 	cleanBytesCapacity uint64) *BlockCacheStandard {
+	return NewBlockCacheStandardWithPolicy(
+		transientCapacity, cleanBytesCapacity, LRUCacheEviction)
+}
+
+// NewBlockCacheStandardWithPolicy is like NewBlockCacheStandard, but
+// the transient clean cache evicts entries according to the given
+// policy.
+func NewBlockCacheStandardWithPolicy(transientCapacity int,
+	cleanBytesCapacity uint64,
+	policy CacheEvictionPolicy) *BlockCacheStandard {
 	b := &BlockCacheStandard{
 		cleanBytesCapacity: cleanBytesCapacity,
 		cleanPermanent:     make(map[kbfsblock.ID]Block),
@@ -64,7 +107,8 @@ func NewBlockCacheStandard(transientCapacity int,
 			return nil
 		}
 
-		b.cleanTransient, err = lru.NewWithEvict(transientCapacity, b.onEvict)
+		b.cleanTransient, err = newEvictingCache(
+			policy, transientCapacity, b.onEvict)
 		if err != nil {
 			return nil
 		}
@@ -81,6 +125,7 @@ func (b *BlockCacheStandard) GetWithPrefetch(ptr BlockPointer) (
 			if !ok {
 				return nil, false, NoCacheEntry, BadDataError{ptr.ID}
 			}
+			atomic.AddUint64(&b.hits, 1)
 			return bc.block, bc.hasPrefetched, TransientEntry, nil
 		}
 	}
@@ -95,9 +140,11 @@ func (b *BlockCacheStandard) GetWithPrefetch(ptr BlockPointer) (
 		// write. Since the client is writing, it knows what goes into it,
 		// including any potential directory entries or indirect blocks.
 		// Thus, it is treated as already prefetched.
+		atomic.AddUint64(&b.hits, 1)
 		return block, true, PermanentEntry, nil
 	}
 
+	atomic.AddUint64(&b.misses, 1)
 	return nil, false, NoCacheEntry, NoSuchBlockError{ptr.ID}
 }
 
@@ -129,6 +176,10 @@ func (b *BlockCacheStandard) onEvict(key interface{}, value interface{}) {
 	}
 	block := bc.block
 
+	// Explicit removals also end up here; DeleteTransient takes
+	// those back out of the eviction count.
+	atomic.AddUint64(&b.evictions, 1)
+
 	b.bytesLock.Lock()
 	defer b.bytesLock.Unlock()
 	b.cleanTotalBytes -= uint64(getCachedBlockSize(block))
@@ -231,7 +282,7 @@ func (b *BlockCacheStandard) PutWithPrefetch(
 	ptr BlockPointer, tlf tlf.ID, block Block, lifetime BlockCacheLifetime,
 	hasPrefetched bool) (err error) {
 
-	var wasInCache bool
+	var wasInCache, fromPrefetch bool
 
 	switch lifetime {
 	case NoCacheEntry:
@@ -255,7 +306,18 @@ func (b *BlockCacheStandard) PutWithPrefetch(
 		var block interface{}
 		block, wasInCache = b.cleanTransient.Get(ptr.ID)
 		if wasInCache {
-			hasPrefetched = (hasPrefetched || block.(blockContainer).hasPrefetched)
+			bc := block.(blockContainer)
+			// Only on-demand requests set hasPrefetched, so
+			// that tells us whether a prefetched block was
+			// actually needed.
+			if bc.fromPrefetch && hasPrefetched {
+				atomic.AddUint64(&b.prefetchHits, 1)
+			} else {
+				fromPrefetch = bc.fromPrefetch
+			}
+			hasPrefetched = (hasPrefetched || bc.hasPrefetched)
+		} else {
+			fromPrefetch = !hasPrefetched
 		}
 		// Cache it later, once we know there's room
 
@@ -286,7 +348,11 @@ func (b *BlockCacheStandard) PutWithPrefetch(
 		if !transientCacheHasRoom {
 			return cachePutCacheFullError{ptr}
 		}
-		b.cleanTransient.Add(ptr.ID, blockContainer{block, hasPrefetched})
+		b.cleanTransient.Add(
+			ptr.ID, blockContainer{block, hasPrefetched, fromPrefetch})
+		if fromPrefetch && !wasInCache {
+			atomic.AddUint64(&b.prefetchedBlocks, 1)
+		}
 	}
 
 	return nil
@@ -340,6 +406,8 @@ func (b *BlockCacheStandard) DeleteTransient(
 		}
 
 		b.cleanTransient.Remove(ptr.ID)
+		// Undo the eviction counted by onEvict.
+		atomic.AddUint64(&b.evictions, ^uint64(0))
 	}
 	return nil
 }
@@ -359,3 +427,27 @@ func (b *BlockCacheStandard) DeleteKnownPtr(tlf tlf.ID, block *FileBlock) error
 	b.ids.Remove(key)
 	return nil
 }
+
+// Status implements the BlockCache interface for BlockCacheStandard.
+func (b *BlockCacheStandard) Status() BlockCacheStatus {
+	status := BlockCacheStatus{
+		Hits:               atomic.LoadUint64(&b.hits),
+		Misses:             atomic.LoadUint64(&b.misses),
+		Evictions:          atomic.LoadUint64(&b.evictions),
+		CleanBytesCapacity: b.GetCleanBytesCapacity(),
+		PrefetchedBlocks:   atomic.LoadUint64(&b.prefetchedBlocks),
+		PrefetchHits:       atomic.LoadUint64(&b.prefetchHits),
+	}
+	if b.cleanTransient != nil {
+		status.TransientEntries = b.cleanTransient.Len()
+	}
+	func() {
+		b.cleanLock.RLock()
+		defer b.cleanLock.RUnlock()
+		status.PermanentEntries = len(b.cleanPermanent)
+	}()
+	b.bytesLock.Lock()
+	defer b.bytesLock.Unlock()
+	status.CleanBytes = b.cleanTotalBytes
+	return status
+}
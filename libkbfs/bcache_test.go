@@ -378,3 +378,53 @@ func TestBlockCacheDoublePut(t *testing.T) {
 	testBcachePutWithBlock(t, id2, cache, TransientEntry, block)
 	require.Equal(t, bytes, cache.cleanTotalBytes)
 }
+
+func TestBlockCacheStatus(t *testing.T) {
+	bcache := NewBlockCacheStandard(2, 1<<30)
+	tlfID := tlf.FakeID(1, false)
+	ptr1 := BlockPointer{ID: kbfsblock.FakeID(1)}
+	ptr2 := BlockPointer{ID: kbfsblock.FakeID(2)}
+	ptr3 := BlockPointer{ID: kbfsblock.FakeID(3)}
+	block := NewFileBlock().(*FileBlock)
+	block.Contents = []byte{1, 2, 3}
+
+	// Block 1 comes in through a prefetch, block 2 on demand.
+	err := bcache.PutWithPrefetch(ptr1, tlfID, block, TransientEntry, false)
+	require.NoError(t, err)
+	err = bcache.Put(ptr2, tlfID, block, TransientEntry)
+	require.NoError(t, err)
+	err = bcache.Put(
+		BlockPointer{ID: kbfsblock.FakeID(4)}, tlfID, block, PermanentEntry)
+	require.NoError(t, err)
+
+	_, err = bcache.Get(ptr1)
+	require.NoError(t, err)
+	_, err = bcache.Get(ptr3)
+	require.Error(t, err)
+
+	// An on-demand request for the prefetched block counts as a
+	// prefetch hit, but only once.
+	err = bcache.PutWithPrefetch(ptr1, tlfID, block, TransientEntry, true)
+	require.NoError(t, err)
+	err = bcache.PutWithPrefetch(ptr1, tlfID, block, TransientEntry, true)
+	require.NoError(t, err)
+
+	// Block 2 is now the oldest, so block 3 evicts it.
+	err = bcache.Put(ptr3, tlfID, block, TransientEntry)
+	require.NoError(t, err)
+	// Explicit deletes aren't evictions.
+	err = bcache.DeleteTransient(ptr3, tlfID)
+	require.NoError(t, err)
+
+	require.Equal(t, BlockCacheStatus{
+		Hits:               1,
+		Misses:             1,
+		Evictions:          1,
+		TransientEntries:   1,
+		PermanentEntries:   1,
+		CleanBytes:         6,
+		CleanBytesCapacity: 1 << 30,
+		PrefetchedBlocks:   1,
+		PrefetchHits:       1,
+	}, bcache.Status())
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/pkg/errors"
+)
+
+// BlockCompressionType is the type of compression applied to the
+// encoded contents of a block, before it is padded and encrypted.
+type BlockCompressionType byte
+
+const (
+	// NoBlockCompression means block contents are not compressed.
+	NoBlockCompression BlockCompressionType = 0
+	// FlateBlockCompression means block contents are compressed
+	// with DEFLATE.
+	FlateBlockCompression BlockCompressionType = 1
+)
+
+func (c BlockCompressionType) String() string {
+	switch c {
+	case NoBlockCompression:
+		return "none"
+	case FlateBlockCompression:
+		return "flate"
+	default:
+		return fmt.Sprintf("BlockCompressionType(%d)", c)
+	}
+}
+
+// ParseBlockCompressionType parses the string representation of a
+// BlockCompressionType, as returned by its String method.
+func ParseBlockCompressionType(s string) (BlockCompressionType, error) {
+	switch s {
+	case "", "none":
+		return NoBlockCompression, nil
+	case "flate":
+		return FlateBlockCompression, nil
+	default:
+		return NoBlockCompression, errors.Errorf(
+			"Unknown block compression type %q", s)
+	}
+}
+
+// maxDecompressedBlockSize bounds how much memory decompressing a
+// single block may use, to protect against maliciously-crafted
+// blocks. It is much larger than any block we'd write, since
+// directory blocks are not yet split.
+const maxDecompressedBlockSize = 64 * 1024 * 1024
+
+// UnknownBlockCompressionError indicates that a block was compressed
+// with a method this client doesn't know about.
+type UnknownBlockCompressionError struct {
+	Compression BlockCompressionType
+}
+
+// Error implements the error interface for
+// UnknownBlockCompressionError.
+func (e UnknownBlockCompressionError) Error() string {
+	return fmt.Sprintf("Unknown block compression: %s", e.Compression)
+}
+
+// compressBlockData compresses the given encoded block with the given
+// method. If compression doesn't make the data smaller, the data is
+// returned as-is along with NoBlockCompression, so readers never pay
+// for decompressing incompressible (e.g., already-compressed) data.
+func compressBlockData(compression BlockCompressionType, data []byte) (
+	[]byte, BlockCompressionType, error) {
+	switch compression {
+	case NoBlockCompression:
+		return data, NoBlockCompression, nil
+	case FlateBlockCompression:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, NoBlockCompression, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, NoBlockCompression, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, NoBlockCompression, err
+		}
+		if buf.Len() >= len(data) {
+			return data, NoBlockCompression, nil
+		}
+		return buf.Bytes(), FlateBlockCompression, nil
+	default:
+		return nil, NoBlockCompression, errors.WithStack(
+			UnknownBlockCompressionError{compression})
+	}
+}
+
+// decompressBlockData reverses compressBlockData.
+func decompressBlockData(compression BlockCompressionType, data []byte) (
+	[]byte, error) {
+	switch compression {
+	case NoBlockCompression:
+		return data, nil
+	case FlateBlockCompression:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		decompressed, err := ioutil.ReadAll(
+			io.LimitReader(r, maxDecompressedBlockSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(decompressed) > maxDecompressedBlockSize {
+			return nil, errors.Errorf(
+				"Decompressed block is larger than %d bytes",
+				maxDecompressedBlockSize)
+		}
+		return decompressed, nil
+	default:
+		return nil, errors.WithStack(
+			UnknownBlockCompressionError{compression})
+	}
+}
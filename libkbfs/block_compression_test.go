@@ -0,0 +1,45 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockCompressionRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible "), 100)
+	compressed, compression, err := compressBlockData(
+		FlateBlockCompression, data)
+	require.NoError(t, err)
+	require.Equal(t, FlateBlockCompression, compression)
+	require.True(t, len(compressed) < len(data))
+
+	decompressed, err := decompressBlockData(compression, compressed)
+	require.NoError(t, err)
+	require.Equal(t, data, decompressed)
+}
+
+func TestBlockCompressionIncompressible(t *testing.T) {
+	// Too short for flate to make any smaller.
+	data := []byte{1, 2, 3}
+	compressed, compression, err := compressBlockData(
+		FlateBlockCompression, data)
+	require.NoError(t, err)
+	require.Equal(t, NoBlockCompression, compression)
+	require.Equal(t, data, compressed)
+}
+
+func TestBlockCompressionUnknown(t *testing.T) {
+	_, err := decompressBlockData(BlockCompressionType(100), []byte{1})
+	require.IsType(t, UnknownBlockCompressionError{},
+		errors.Cause(err))
+
+	_, err = ParseBlockCompressionType("zstd")
+	require.Error(t, err)
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
+)
+
+// defaultBlockCryptKeyCacheCapacity is the number of block
+// references whose crypt keys are remembered by default.
+const defaultBlockCryptKeyCacheCapacity = 10000
+
+type blockCryptKeyCacheKey struct {
+	tlfID    tlf.ID
+	id       kbfsblock.ID
+	refNonce kbfsblock.RefNonce
+}
+
+type blockCryptKeyCacheEntry struct {
+	serverHalf    kbfscrypto.BlockCryptKeyServerHalf
+	blockCryptKey kbfscrypto.BlockCryptKey
+}
+
+// blockCryptKeyCache is an LRU cache of the server halves returned
+// by the block server for block references, along with the block
+// crypt keys derived from them, so that repeated fetches of the same
+// block (e.g., after it's been evicted from the block cache) don't
+// have to look up the TLF crypt key and derive the block crypt key
+// again.
+type blockCryptKeyCache struct {
+	lru *lru.Cache
+}
+
+func newBlockCryptKeyCache(capacity int) *blockCryptKeyCache {
+	cache, err := lru.New(capacity)
+	if err != nil {
+		panic(err.Error())
+	}
+	return &blockCryptKeyCache{cache}
+}
+
+// get returns the cached block crypt key for the given block
+// reference, if there is one and it was derived from the given
+// server half.
+func (c *blockCryptKeyCache) get(tlfID tlf.ID, ptr BlockPointer,
+	serverHalf kbfscrypto.BlockCryptKeyServerHalf) (
+	kbfscrypto.BlockCryptKey, bool) {
+	if c == nil {
+		return kbfscrypto.BlockCryptKey{}, false
+	}
+	cacheKey := blockCryptKeyCacheKey{tlfID, ptr.ID, ptr.RefNonce}
+	entry, ok := c.lru.Get(cacheKey)
+	if !ok {
+		return kbfscrypto.BlockCryptKey{}, false
+	}
+	cached := entry.(blockCryptKeyCacheEntry)
+	if cached.serverHalf != serverHalf {
+		return kbfscrypto.BlockCryptKey{}, false
+	}
+	return cached.blockCryptKey, true
+}
+
+// put remembers the server half and derived block crypt key for the
+// given block reference.
+func (c *blockCryptKeyCache) put(tlfID tlf.ID, ptr BlockPointer,
+	serverHalf kbfscrypto.BlockCryptKeyServerHalf,
+	blockCryptKey kbfscrypto.BlockCryptKey) {
+	if c == nil {
+		return
+	}
+	cacheKey := blockCryptKeyCacheKey{tlfID, ptr.ID, ptr.RefNonce}
+	c.lru.Add(cacheKey, blockCryptKeyCacheEntry{serverHalf, blockCryptKey})
+}
@@ -325,7 +325,8 @@ func (s *blockDiskStore) getDataWithContext(id kbfsblock.ID, context kbfsblock.C
 	return s.getData(id)
 }
 
-func (s *blockDiskStore) getAllRefsForTest() (map[kbfsblock.ID]blockRefMap, error) {
+// getAllRefs returns the references of every block in the store.
+func (s *blockDiskStore) getAllRefs() (map[kbfsblock.ID]blockRefMap, error) {
 	res := make(map[kbfsblock.ID]blockRefMap)
 
 	fileInfos, err := ioutil.ReadDir(s.dir)
@@ -385,6 +386,10 @@ func (s *blockDiskStore) getAllRefsForTest() (map[kbfsblock.ID]blockRefMap, erro
 	return res, nil
 }
 
+func (s *blockDiskStore) getAllRefsForTest() (map[kbfsblock.ID]blockRefMap, error) {
+	return s.getAllRefs()
+}
+
 // put puts the given data for the block, which may already exist, and
 // adds a reference for the given context. If err is nil, putData
 // indicates whether the data didn't already exist and was put; if
@@ -7,8 +7,10 @@ package libkbfs
 import (
 	"fmt"
 
+	"github.com/keybase/client/go/logger"
 	"github.com/keybase/kbfs/kbfsblock"
 	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/pkg/errors"
 
 	"golang.org/x/net/context"
 )
@@ -21,13 +23,41 @@ type blockGetter interface {
 // realBlockGetter obtains real blocks using the APIs available in Config.
 type realBlockGetter struct {
 	config blockOpsConfig
+	log    logger.Logger
+	// keyCache, if non-nil, remembers the block crypt keys of
+	// blocks that were fetched recently.
+	keyCache *blockCryptKeyCache
 }
 
-// getBlock implements the interface for realBlockGetter.
-func (bg *realBlockGetter) getBlock(ctx context.Context, kmd KeyMetadata, blockPtr BlockPointer, block Block) error {
+// getBlockData returns the encrypted data and server half of the
+// given block, from disk if the block's TLF is synced to this device
+// and the block is there, or from the block server otherwise. Blocks
+// of synced TLFs fetched from the block server are saved to disk.
+func (bg *realBlockGetter) getBlockData(ctx context.Context,
+	kmd KeyMetadata, blockPtr BlockPointer) (
+	[]byte, kbfscrypto.BlockCryptKeyServerHalf, error) {
+	syncCache := bg.config.tlfSyncCache()
+	buf, blockServerHalf, onDisk, err := syncCache.get(kmd.TlfID(), blockPtr)
+	if err != nil {
+		// Fall back to the block server.
+		bg.log.CWarningf(ctx, "Couldn't read synced block %s from disk: %+v",
+			blockPtr.ID, err)
+	} else if onDisk {
+		return buf, blockServerHalf, nil
+	}
+
 	bserv := bg.config.BlockServer()
-	buf, blockServerHalf, err := bserv.Get(
-		ctx, kmd.TlfID(), blockPtr.ID, blockPtr.Context)
+	getCtx := ctx
+	if blockTransferFromContext(ctx) == nil {
+		// Not part of a bigger download, like a file read, so
+		// track this block on its own.
+		transfer := bg.config.blockTransferTracker().start(
+			ctx, BlockDownload, kmd.TlfID(), unknownBlockTransferSize)
+		defer transfer.finish(ctx)
+		getCtx = contextWithBlockTransfer(ctx, transfer)
+	}
+	buf, blockServerHalf, err = bserv.Get(
+		getCtx, kmd.TlfID(), blockPtr.ID, blockPtr.Context)
 	if err != nil {
 		// Temporary code to track down bad block
 		// requests. Remove when not needed anymore.
@@ -36,22 +66,29 @@ func (bg *realBlockGetter) getBlock(ctx context.Context, kmd KeyMetadata, blockP
 				err, blockPtr))
 		}
 
-		return err
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
 	}
 
 	if err := kbfsblock.VerifyID(buf, blockPtr.ID); err != nil {
-		return err
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
 	}
 
-	tlfCryptKey, err := bg.config.keyGetter().
-		GetTLFCryptKeyForBlockDecryption(ctx, kmd, blockPtr)
+	err = syncCache.put(kmd.TlfID(), blockPtr, buf, blockServerHalf)
 	if err != nil {
-		return err
+		// The block is still good, so don't fail the read; the
+		// next sync pass will try to save it again.
+		bg.log.CWarningf(ctx, "Couldn't save synced block %s to disk: %+v",
+			blockPtr.ID, err)
 	}
+	return buf, blockServerHalf, nil
+}
 
-	// construct the block crypt key
-	blockCryptKey := kbfscrypto.UnmaskBlockCryptKey(
-		blockServerHalf, tlfCryptKey)
+// getBlock implements the interface for realBlockGetter.
+func (bg *realBlockGetter) getBlock(ctx context.Context, kmd KeyMetadata, blockPtr BlockPointer, block Block) error {
+	buf, blockServerHalf, err := bg.getBlockData(ctx, kmd, blockPtr)
+	if err != nil {
+		return err
+	}
 
 	var encryptedBlock EncryptedBlock
 	err = bg.config.Codec().Decode(buf, &encryptedBlock)
@@ -59,12 +96,46 @@ func (bg *realBlockGetter) getBlock(ctx context.Context, kmd KeyMetadata, blockP
 		return err
 	}
 
+	if encryptedBlock.Version == EncryptionNone {
+		// Only public blocks may skip encryption; the block ID
+		// already guarantees the data is what was uploaded.
+		if !kmd.TlfID().IsPublic() {
+			return errors.WithStack(
+				UnencryptedPrivateBlockError{kmd.TlfID(), blockPtr})
+		}
+		err = bg.config.cryptoPure().DecryptBlock(
+			encryptedBlock, kbfscrypto.BlockCryptKey{}, block)
+		if err != nil {
+			return err
+		}
+		block.SetEncodedSize(uint32(len(buf)))
+		return nil
+	}
+
+	blockCryptKey, cached := bg.keyCache.get(
+		kmd.TlfID(), blockPtr, blockServerHalf)
+	if !cached {
+		tlfCryptKey, err := bg.config.keyGetter().
+			GetTLFCryptKeyForBlockDecryption(ctx, kmd, blockPtr)
+		if err != nil {
+			return err
+		}
+
+		// construct the block crypt key
+		blockCryptKey = kbfscrypto.UnmaskBlockCryptKey(
+			blockServerHalf, tlfCryptKey)
+	}
+
 	// decrypt the block
 	err = bg.config.cryptoPure().DecryptBlock(
 		encryptedBlock, blockCryptKey, block)
 	if err != nil {
 		return err
 	}
+	if !cached {
+		// Only remember keys that decrypted the block.
+		bg.keyCache.put(kmd.TlfID(), blockPtr, blockServerHalf, blockCryptKey)
+	}
 
 	block.SetEncodedSize(uint32(len(buf)))
 	return nil
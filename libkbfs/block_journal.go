@@ -660,7 +660,7 @@ func (j *blockJournal) getNextEntriesToFlush(
 			entries.puts.addNewBlock(
 				BlockPointer{ID: id, Context: bctx},
 				nil, /* only used by folderBranchOps */
-				ReadyBlockData{data, serverHalf}, nil)
+				ReadyBlockData{buf: data, serverHalf: serverHalf}, nil)
 
 		case addRefOp:
 			id, bctx, err := entry.getSingleContext()
@@ -732,7 +732,8 @@ func flushNonBPSBlockJournalEntry(
 
 func flushBlockEntries(ctx context.Context, log logger.Logger,
 	bserver BlockServer, bcache BlockCache, reporter Reporter, tlfID tlf.ID,
-	tlfName CanonicalTlfName, entries blockEntriesToFlush) error {
+	tlfName CanonicalTlfName, entries blockEntriesToFlush,
+	maxParallel int, transfers *blockTransferTracker) error {
 	if !entries.flushNeeded() {
 		// Avoid logging anything when there's nothing to flush.
 		return nil
@@ -743,7 +744,8 @@ func flushBlockEntries(ctx context.Context, log logger.Logger,
 	// reference the former.
 	log.CDebugf(ctx, "Putting %d blocks", len(entries.puts.blockStates))
 	blocksToRemove, err := doBlockPuts(ctx, bserver, bcache, reporter,
-		log, tlfID, tlfName, *entries.puts)
+		log, tlfID, tlfName, *entries.puts, maxParallel,
+		transfers)
 	if err != nil {
 		if isRecoverableBlockError(err) {
 			log.CWarningf(ctx,
@@ -757,7 +759,8 @@ func flushBlockEntries(ctx context.Context, log logger.Logger,
 	log.CDebugf(ctx, "Adding %d block references",
 		len(entries.adds.blockStates))
 	blocksToRemove, err = doBlockPuts(ctx, bserver, bcache, reporter,
-		log, tlfID, tlfName, *entries.adds)
+		log, tlfID, tlfName, *entries.adds, maxParallel,
+		transfers)
 	if err != nil {
 		if isRecoverableBlockError(err) {
 			log.CWarningf(ctx,
@@ -453,7 +453,8 @@ func TestBlockJournalFlush(t *testing.T) {
 
 		err = flushBlockEntries(
 			ctx, j.log, blockServer, bcache, reporter,
-			tlfID, CanonicalTlfName("fake TLF"), entries)
+			tlfID, CanonicalTlfName("fake TLF"), entries,
+			maxParallelBlockPuts, nil)
 		require.NoError(t, err)
 
 		removedBytes, removedFiles, err := j.removeFlushedEntries(
@@ -526,7 +527,7 @@ func flushBlockJournalOne(ctx context.Context, t *testing.T,
 	require.Equal(t, 1, entries.length())
 	err = flushBlockEntries(ctx, j.log, blockServer,
 		bcache, reporter, tlfID, CanonicalTlfName("fake TLF"),
-		entries)
+		entries, maxParallelBlockPuts, nil)
 	require.NoError(t, err)
 	removedBytes, removedFiles, err = j.removeFlushedEntries(
 		ctx, entries, tlfID, reporter)
@@ -700,7 +701,7 @@ func TestBlockJournalFlushMDRevMarker(t *testing.T) {
 	require.Equal(t, 2, entries.length())
 	err = flushBlockEntries(ctx, j.log, blockServer,
 		bcache, reporter, tlfID, CanonicalTlfName("fake TLF"),
-		entries)
+		entries, maxParallelBlockPuts, nil)
 	require.NoError(t, err)
 	removedBytes, removedFiles, err := j.removeFlushedEntries(
 		ctx, entries, tlfID, reporter)
@@ -761,7 +762,7 @@ func TestBlockJournalFlushMDRevMarkerForPendingLocalSquash(t *testing.T) {
 
 	err = flushBlockEntries(ctx, j.log, blockServer,
 		bcache, reporter, tlfID, CanonicalTlfName("fake TLF"),
-		entries)
+		entries, maxParallelBlockPuts, nil)
 	require.NoError(t, err)
 	removedBytes, removedFiles, err := j.removeFlushedEntries(
 		ctx, entries, tlfID, reporter)
@@ -835,7 +836,7 @@ func TestBlockJournalIgnoreBlocks(t *testing.T) {
 	require.Equal(t, bID4, entries.puts.blockStates[1].blockPtr.ID)
 	err = flushBlockEntries(ctx, j.log, blockServer,
 		bcache, reporter, tlfID, CanonicalTlfName("fake TLF"),
-		entries)
+		entries, maxParallelBlockPuts, nil)
 	require.NoError(t, err)
 	removedBytes, removedFiles, err := j.removeFlushedEntries(
 		ctx, entries, tlfID, reporter)
@@ -901,7 +902,7 @@ func TestBlockJournalSaveUntilMDFlush(t *testing.T) {
 		require.NoError(t, err)
 		err = flushBlockEntries(ctx, j.log, blockServer,
 			bcache, reporter, tlfID, CanonicalTlfName("fake TLF"),
-			entries)
+			entries, maxParallelBlockPuts, nil)
 		require.NoError(t, err)
 		removedBytes, removedFiles, err := j.removeFlushedEntries(
 			ctx, entries, tlfID, reporter)
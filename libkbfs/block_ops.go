@@ -19,6 +19,10 @@ type blockOpsConfig interface {
 	codecGetter
 	cryptoPureGetter
 	keyGetterGetter
+	blockCompressionGetter
+	publicBlocksUnencryptedGetter
+	blockTransferTrackerGetter
+	tlfSyncCacheGetter
 }
 
 // BlockOpsStandard implements the BlockOps interface by relaying
@@ -33,7 +37,11 @@ var _ BlockOps = (*BlockOpsStandard)(nil)
 // NewBlockOpsStandard creates a new BlockOpsStandard
 func NewBlockOpsStandard(config blockOpsConfig,
 	queueSize int) *BlockOpsStandard {
-	bg := &realBlockGetter{config: config}
+	bg := &realBlockGetter{
+		config:   config,
+		log:      config.MakeLogger(""),
+		keyCache: newBlockCryptKeyCache(defaultBlockCryptKeyCacheCapacity),
+	}
 	qConfig := &realBlockRetrievalConfig{
 		blockRetrievalPartialConfig: config,
 		bg: bg,
@@ -67,22 +75,40 @@ func (b *BlockOpsStandard) Ready(ctx context.Context, kmd KeyMetadata,
 
 	crypto := b.config.cryptoPure()
 
-	tlfCryptKey, err := b.config.keyGetter().
-		GetTLFCryptKeyForEncryption(ctx, kmd)
-	if err != nil {
-		return
-	}
-
-	// New server key half for the block.
+	// New server key half for the block. The block server
+	// expects one even for blocks that aren't encrypted.
 	serverHalf, err := crypto.MakeRandomBlockCryptKeyServerHalf()
 	if err != nil {
 		return
 	}
 
-	blockKey := kbfscrypto.UnmaskBlockCryptKey(serverHalf, tlfCryptKey)
-	plainSize, encryptedBlock, err := crypto.EncryptBlock(block, blockKey)
-	if err != nil {
-		return
+	var encryptedBlock EncryptedBlock
+	compression := b.config.BlockCompression()
+	if kmd.TlfID().IsPublic() && b.config.PublicBlocksUnencrypted() {
+		plainSize, encryptedBlock, err = crypto.MakeUnencryptedBlock(
+			block, compression)
+		if err != nil {
+			return
+		}
+	} else {
+		var tlfCryptKey kbfscrypto.TLFCryptKey
+		tlfCryptKey, err = b.config.keyGetter().
+			GetTLFCryptKeyForEncryption(ctx, kmd)
+		if err != nil {
+			return
+		}
+
+		blockKey := kbfscrypto.UnmaskBlockCryptKey(serverHalf, tlfCryptKey)
+		if compression == NoBlockCompression {
+			plainSize, encryptedBlock, err = crypto.EncryptBlock(
+				block, blockKey)
+		} else {
+			plainSize, encryptedBlock, err = crypto.EncryptCompressedBlock(
+				block, blockKey, compression)
+		}
+		if err != nil {
+			return
+		}
 	}
 
 	buf, err := b.config.Codec().Encode(encryptedBlock)
@@ -93,10 +119,12 @@ func (b *BlockOpsStandard) Ready(ctx context.Context, kmd KeyMetadata,
 	readyBlockData = ReadyBlockData{
 		buf:        buf,
 		serverHalf: serverHalf,
+		compressed: encryptedBlock.Compression != NoBlockCompression,
 	}
 
+	// A compressed block may well be smaller than its plain size.
 	encodedSize := readyBlockData.GetEncodedSize()
-	if encodedSize < plainSize {
+	if !readyBlockData.compressed && encodedSize < plainSize {
 		err = TooLowByteCountError{
 			ExpectedMinByteCount: plainSize,
 			ByteCount:            encodedSize,
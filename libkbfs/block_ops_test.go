@@ -5,13 +5,16 @@
 package libkbfs
 
 import (
+	"bytes"
 	"fmt"
+	"os"
 	"sync"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/keybase/client/go/logger"
 	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/ioutil"
 	"github.com/keybase/kbfs/kbfsblock"
 	"github.com/keybase/kbfs/kbfscodec"
 	"github.com/keybase/kbfs/kbfscrypto"
@@ -79,11 +82,14 @@ func (kg fakeBlockKeyGetter) GetTLFCryptKeyForBlockDecryption(
 }
 
 type testBlockOpsConfig struct {
-	bserver   BlockServer
-	testCodec kbfscodec.Codec
-	cp        cryptoPure
-	cache     BlockCache
-	t         *testing.T
+	bserver     BlockServer
+	testCodec   kbfscodec.Codec
+	cp          cryptoPure
+	cache       BlockCache
+	t           *testing.T
+	compression BlockCompressionType
+	syncCache   *tlfSyncCache
+	unencrypted bool
 }
 
 var _ blockOpsConfig = (*testBlockOpsConfig)(nil)
@@ -116,12 +122,29 @@ func (config testBlockOpsConfig) DataVersion() DataVer {
 	return ChildHolesDataVer
 }
 
+func (config testBlockOpsConfig) BlockCompression() BlockCompressionType {
+	return config.compression
+}
+
+func (config testBlockOpsConfig) PublicBlocksUnencrypted() bool {
+	return config.unencrypted
+}
+
+func (config testBlockOpsConfig) blockTransferTracker() *blockTransferTracker {
+	return nil
+}
+
+func (config testBlockOpsConfig) tlfSyncCache() *tlfSyncCache {
+	return config.syncCache
+}
+
 func makeTestBlockOpsConfig(t *testing.T) testBlockOpsConfig {
 	bserver := NewBlockServerMemory(logger.NewTestLogger(t))
 	codec := kbfscodec.NewMsgpack()
 	crypto := MakeCryptoCommon(codec)
 	cache := NewBlockCacheStandard(10, getDefaultCleanBlockCacheCapacity())
-	return testBlockOpsConfig{bserver, codec, crypto, cache, t}
+	return testBlockOpsConfig{
+		bserver, codec, crypto, cache, t, NoBlockCompression, nil, false}
 }
 
 // TestBlockOpsReadySuccess checks that BlockOpsStandard.Ready()
@@ -332,6 +355,219 @@ func TestBlockOpsGetSuccess(t *testing.T) {
 	require.Equal(t, block, decryptedBlock)
 }
 
+// TestBlockOpsGetUnencryptedPublic checks that blocks of public TLFs
+// can be uploaded and fetched without being encrypted, and without
+// any TLF keys, and that unencrypted blocks of private TLFs are
+// rejected.
+func TestBlockOpsGetUnencryptedPublic(t *testing.T) {
+	config := makeTestBlockOpsConfig(t)
+	config.unencrypted = true
+	bops := NewBlockOpsStandard(config, testBlockRetrievalWorkerQueueSize)
+	defer bops.Shutdown()
+
+	publicID := tlf.FakeID(0, true)
+	noKeysKmd := makeFakeKeyMetadata(publicID, FirstValidKeyGen-1)
+
+	block := &FileBlock{
+		Contents: []byte{1, 2, 3, 4, 5},
+	}
+
+	ctx := context.Background()
+	id, _, readyBlockData, err := bops.Ready(ctx, noKeysKmd, block)
+	require.NoError(t, err)
+	var encryptedBlock EncryptedBlock
+	err = config.testCodec.Decode(readyBlockData.buf, &encryptedBlock)
+	require.NoError(t, err)
+	require.Equal(t, EncryptionNone, encryptedBlock.Version)
+
+	bCtx := kbfsblock.MakeFirstContext(keybase1.MakeTestUID(1))
+	err = config.bserver.Put(ctx, publicID, id, bCtx,
+		readyBlockData.buf, readyBlockData.serverHalf)
+	require.NoError(t, err)
+
+	ptr := BlockPointer{ID: id, KeyGen: PublicKeyGen, Context: bCtx}
+	decryptedBlock := &FileBlock{}
+	err = bops.Get(ctx, noKeysKmd, ptr, decryptedBlock, NoCacheEntry)
+	require.NoError(t, err)
+	require.Equal(t, block, decryptedBlock)
+
+	// Private blocks are still encrypted...
+	privateID := tlf.FakeID(1, false)
+	_, _, _, err = bops.Ready(ctx,
+		makeFakeKeyMetadata(privateID, FirstValidKeyGen-1), block)
+	require.EqualError(t, err, "no keys for encryption")
+
+	// ...and mustn't be accepted if they aren't.
+	err = config.bserver.Put(ctx, privateID, id, bCtx,
+		readyBlockData.buf, readyBlockData.serverHalf)
+	require.NoError(t, err)
+	err = bops.Get(ctx, makeFakeKeyMetadata(privateID, FirstValidKeyGen),
+		BlockPointer{ID: id, KeyGen: FirstValidKeyGen, Context: bCtx},
+		&FileBlock{}, NoCacheEntry)
+	require.IsType(t, UnencryptedPrivateBlockError{}, errors.Cause(err))
+}
+
+// TestBlockOpsGetCachedCryptKey checks that BlockOpsStandard.Get()
+// remembers the crypt keys of blocks it has decrypted, and doesn't
+// need the TLF crypt key to decrypt them again.
+func TestBlockOpsGetCachedCryptKey(t *testing.T) {
+	config := makeTestBlockOpsConfig(t)
+	bops := NewBlockOpsStandard(config, testBlockRetrievalWorkerQueueSize)
+	defer bops.Shutdown()
+
+	tlfID := tlf.FakeID(0, false)
+	var keyGen KeyGen = 3
+	kmd := makeFakeKeyMetadata(tlfID, keyGen)
+
+	block := &FileBlock{
+		Contents: []byte{1, 2, 3, 4, 5},
+	}
+
+	ctx := context.Background()
+	id, _, readyBlockData, err := bops.Ready(ctx, kmd, block)
+	require.NoError(t, err)
+
+	bCtx := kbfsblock.MakeFirstContext(keybase1.MakeTestUID(1))
+	err = config.bserver.Put(ctx, tlfID, id, bCtx,
+		readyBlockData.buf, readyBlockData.serverHalf)
+	require.NoError(t, err)
+
+	// The block isn't in the block cache, so both gets go to
+	// the block server, but only the first needs the TLF key.
+	ptr := BlockPointer{ID: id, KeyGen: keyGen, Context: bCtx}
+	decryptedBlock := &FileBlock{}
+	err = bops.Get(ctx, kmd, ptr, decryptedBlock, NoCacheEntry)
+	require.NoError(t, err)
+	require.Equal(t, block, decryptedBlock)
+
+	noKeysKmd := makeFakeKeyMetadata(tlfID, FirstValidKeyGen-1)
+	decryptedBlock = &FileBlock{}
+	err = bops.Get(ctx, noKeysKmd, ptr, decryptedBlock, NoCacheEntry)
+	require.NoError(t, err)
+	require.Equal(t, block, decryptedBlock)
+
+	// A different reference to the same block isn't cached.
+	refNonce, err := kbfsblock.MakeRefNonce()
+	require.NoError(t, err)
+	ptr.Context = kbfsblock.MakeContext(bCtx.GetCreator(),
+		keybase1.MakeTestUID(2), refNonce)
+	err = config.bserver.AddBlockReference(ctx, tlfID, id, ptr.Context)
+	require.NoError(t, err)
+	err = bops.Get(ctx, noKeysKmd, ptr, &FileBlock{}, NoCacheEntry)
+	require.EqualError(t, err, fmt.Sprintf(
+		"no key for block decryption (keygen=%d)", keyGen))
+}
+
+// TestBlockOpsGetCompressed checks that a block compressed by
+// BlockOpsStandard.Ready() is smaller than an uncompressed one but
+// keeps its uncompressed plain size, and is transparently
+// decompressed by BlockOpsStandard.Get().
+func TestBlockOpsGetCompressed(t *testing.T) {
+	config := makeTestBlockOpsConfig(t)
+	config.compression = FlateBlockCompression
+	bops := NewBlockOpsStandard(config, testBlockRetrievalWorkerQueueSize)
+	defer bops.Shutdown()
+
+	tlfID := tlf.FakeID(0, false)
+	kmd := makeFakeKeyMetadata(tlfID, FirstValidKeyGen)
+
+	block := &FileBlock{
+		Contents: bytes.Repeat([]byte("compress me "), 1000),
+	}
+
+	encodedBlock, err := config.testCodec.Encode(block)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	id, plainSize, readyBlockData, err := bops.Ready(ctx, kmd, block)
+	require.NoError(t, err)
+	require.Equal(t, len(encodedBlock), plainSize)
+	require.True(t, readyBlockData.GetEncodedSize() < plainSize)
+	require.True(t, readyBlockData.compressed)
+
+	var encryptedBlock EncryptedBlock
+	err = config.testCodec.Decode(readyBlockData.buf, &encryptedBlock)
+	require.NoError(t, err)
+	require.Equal(t, FlateBlockCompression, encryptedBlock.Compression)
+
+	bCtx := kbfsblock.MakeFirstContext(keybase1.MakeTestUID(1))
+	err = config.bserver.Put(ctx, tlfID, id, bCtx,
+		readyBlockData.buf, readyBlockData.serverHalf)
+	require.NoError(t, err)
+
+	decryptedBlock := &FileBlock{}
+	err = bops.Get(ctx, kmd,
+		BlockPointer{ID: id, KeyGen: FirstValidKeyGen, Context: bCtx},
+		decryptedBlock, NoCacheEntry)
+	require.NoError(t, err)
+	require.Equal(t, block.Contents, decryptedBlock.Contents)
+
+	// Older clients must refuse to read the compressed block.
+	info, _, _, err := ReadyBlock(ctx, config.cache, bops, config.cp, kmd,
+		block, keybase1.MakeTestUID(1))
+	require.NoError(t, err)
+	require.Equal(t, CompressedBlocksDataVer, info.DataVer)
+}
+
+// TestBlockOpsGetSyncedTlf checks that BlockOpsStandard.Get() saves
+// the blocks of synced TLFs to disk, and reads them from there once
+// they're no longer on the server.
+func TestBlockOpsGetSyncedTlf(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "block_ops_sync")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	config := makeTestBlockOpsConfig(t)
+	config.syncCache, err = makeTlfSyncCache(
+		config.testCodec, logger.NewTestLogger(t), tempdir)
+	require.NoError(t, err)
+	bops := NewBlockOpsStandard(config, testBlockRetrievalWorkerQueueSize)
+	defer bops.Shutdown()
+
+	tlfID := tlf.FakeID(0, false)
+	err = config.syncCache.setMode(tlfID, TlfSyncModeFull)
+	require.NoError(t, err)
+	kmd := makeFakeKeyMetadata(tlfID, FirstValidKeyGen)
+
+	block := &FileBlock{
+		Contents: []byte{1, 2, 3, 4, 5},
+	}
+
+	ctx := context.Background()
+	id, _, readyBlockData, err := bops.Ready(ctx, kmd, block)
+	require.NoError(t, err)
+
+	bCtx := kbfsblock.MakeFirstContext(keybase1.MakeTestUID(1))
+	err = config.bserver.Put(ctx, tlfID, id, bCtx,
+		readyBlockData.buf, readyBlockData.serverHalf)
+	require.NoError(t, err)
+
+	ptr := BlockPointer{ID: id, KeyGen: FirstValidKeyGen, Context: bCtx}
+	err = bops.Get(ctx, kmd, ptr, &FileBlock{}, NoCacheEntry)
+	require.NoError(t, err)
+
+	// Now read it with an empty block server.
+	offlineConfig := config
+	offlineConfig.bserver = NewBlockServerMemory(logger.NewTestLogger(t))
+	offlineBops := NewBlockOpsStandard(
+		offlineConfig, testBlockRetrievalWorkerQueueSize)
+	defer offlineBops.Shutdown()
+
+	decryptedBlock := &FileBlock{}
+	err = offlineBops.Get(ctx, kmd, ptr, decryptedBlock, NoCacheEntry)
+	require.NoError(t, err)
+	require.Equal(t, block, decryptedBlock)
+
+	// Unsyncing the TLF deletes its blocks from disk.
+	err = config.syncCache.setMode(tlfID, TlfSyncModeCached)
+	require.NoError(t, err)
+	err = offlineBops.Get(ctx, kmd, ptr, &FileBlock{}, NoCacheEntry)
+	require.IsType(t, kbfsblock.BServerErrorBlockNonExistent{}, err)
+}
+
 // TestBlockOpsReadySuccess checks that BlockOpsStandard.Get() fails
 // if it can't retrieve the block from the server.
 func TestBlockOpsGetFailServerGet(t *testing.T) {
@@ -58,6 +58,19 @@ func (refs blockRefMap) hasNonArchivedRef() bool {
 	return false
 }
 
+// accumUsage records the usage of a block with these references and
+// the given size in usage. Every referenced block counts as written,
+// and a block with only archived references also counts as archived.
+func (refs blockRefMap) accumUsage(usage *kbfsblock.UsageStat, size int) {
+	if len(refs) == 0 {
+		return
+	}
+	usage.AccumOne(size, kbfsblock.UsageWrite)
+	if !refs.hasNonArchivedRef() {
+		usage.AccumOne(size, kbfsblock.UsageArchive)
+	}
+}
+
 func (refs blockRefMap) checkExists(context kbfsblock.Context) (bool, error) {
 	refEntry, ok := refs[context.GetRefNonce()]
 	if !ok {
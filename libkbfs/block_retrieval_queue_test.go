@@ -20,6 +20,7 @@ type testBlockRetrievalConfig struct {
 	testCodec kbfscodec.Codec
 	testCache BlockCache
 	bg        blockGetter
+	syncCache *tlfSyncCache
 	t         *testing.T
 }
 
@@ -28,6 +29,7 @@ func newTestBlockRetrievalConfig(t *testing.T, bg blockGetter) *testBlockRetriev
 		kbfscodec.NewMsgpack(),
 		NewBlockCacheStandard(10, getDefaultCleanBlockCacheCapacity()),
 		bg,
+		nil,
 		t,
 	}
 }
@@ -52,6 +54,10 @@ func (c testBlockRetrievalConfig) blockGetter() blockGetter {
 	return c.bg
 }
 
+func (c testBlockRetrievalConfig) tlfSyncCache() *tlfSyncCache {
+	return c.syncCache
+}
+
 func makeRandomBlockPointer(t *testing.T) BlockPointer {
 	id, err := kbfsblock.MakeTemporaryID()
 	require.NoError(t, err)
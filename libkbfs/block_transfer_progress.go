@@ -0,0 +1,279 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"sync"
+
+	"github.com/keybase/kbfs/tlf"
+	"golang.org/x/net/context"
+)
+
+// BlockTransferDirection says whether a block transfer is an upload
+// or a download.
+type BlockTransferDirection int
+
+const (
+	// BlockUpload is a transfer of blocks to the block server.
+	BlockUpload BlockTransferDirection = iota
+	// BlockDownload is a transfer of blocks from the block server.
+	BlockDownload
+)
+
+func (d BlockTransferDirection) String() string {
+	switch d {
+	case BlockUpload:
+		return "upload"
+	case BlockDownload:
+		return "download"
+	default:
+		return "unknown"
+	}
+}
+
+// BlockTransferProgress is passed to a BlockTransferObserver each
+// time some bytes have been transferred. The counts only cover
+// transfers in progress, i.e. they start over from zero once all the
+// outstanding transfers in a given direction for a TLF (or file) are
+// done. The size of a block isn't known until it has been
+// downloaded, so for downloads the totals grow as blocks arrive.
+type BlockTransferProgress struct {
+	Direction BlockTransferDirection
+	TlfID     tlf.ID
+	// File is the path of the file the blocks belong to, if known.
+	File string
+
+	// FileBytesDone and FileBytesTotal are only set if File is
+	// non-empty.
+	FileBytesDone  int64
+	FileBytesTotal int64
+	TlfBytesDone   int64
+	TlfBytesTotal  int64
+}
+
+// unknownBlockTransferSize can be passed to
+// blockTransferTracker.start when the size of a transfer isn't known
+// up front.
+const unknownBlockTransferSize = -1
+
+type blockTransferKey struct {
+	dir   BlockTransferDirection
+	tlfID tlf.ID
+	file  string
+}
+
+type blockTransferCounts struct {
+	done, total int64
+	// active is the number of unfinished transfers counted here.
+	active int
+}
+
+// blockTransferTracker keeps the byte counts of in-progress block
+// transfers, and passes them on to a BlockTransferObserver. A nil
+// *blockTransferTracker is valid and tracks nothing.
+type blockTransferTracker struct {
+	lock     sync.Mutex
+	observer BlockTransferObserver
+	counts   map[blockTransferKey]*blockTransferCounts
+}
+
+func newBlockTransferTracker() *blockTransferTracker {
+	return &blockTransferTracker{
+		counts: make(map[blockTransferKey]*blockTransferCounts),
+	}
+}
+
+func (btt *blockTransferTracker) getObserver() BlockTransferObserver {
+	if btt == nil {
+		return nil
+	}
+	btt.lock.Lock()
+	defer btt.lock.Unlock()
+	return btt.observer
+}
+
+func (btt *blockTransferTracker) setObserver(o BlockTransferObserver) {
+	btt.lock.Lock()
+	defer btt.lock.Unlock()
+	btt.observer = o
+}
+
+// blockTransfer is a set of blocks being transferred together, for
+// example all the blocks put by a single sync.
+type blockTransfer struct {
+	tracker     *blockTransferTracker
+	dir         BlockTransferDirection
+	tlfID       tlf.ID
+	file        string
+	sizeUnknown bool
+
+	lock        sync.Mutex
+	done, total int64
+	finished    bool
+}
+
+// keys returns the keys whose counts t contributes to.
+func (t *blockTransfer) keys() []blockTransferKey {
+	keys := []blockTransferKey{{dir: t.dir, tlfID: t.tlfID}}
+	if t.file != "" {
+		keys = append(keys, blockTransferKey{t.dir, t.tlfID, t.file})
+	}
+	return keys
+}
+
+// start begins tracking a transfer of the given number of bytes (or
+// unknownBlockTransferSize) for tlfID. The file is taken from ctx, if
+// it was set by contextWithBlockTransferFile. Returns nil if there's
+// nobody to report progress to, or nothing to report. Every non-nil
+// transfer must be finished.
+func (btt *blockTransferTracker) start(ctx context.Context,
+	dir BlockTransferDirection, tlfID tlf.ID, total int64) *blockTransfer {
+	if total == 0 || btt.getObserver() == nil {
+		return nil
+	}
+	file, _ := ctx.Value(blockTransferFileKey).(string)
+	t := &blockTransfer{
+		tracker: btt,
+		dir:     dir,
+		tlfID:   tlfID,
+		file:    file,
+	}
+	if total == unknownBlockTransferSize {
+		t.sizeUnknown = true
+	} else {
+		t.total = total
+	}
+	btt.lock.Lock()
+	defer btt.lock.Unlock()
+	for _, key := range t.keys() {
+		c, ok := btt.counts[key]
+		if !ok {
+			c = &blockTransferCounts{}
+			btt.counts[key] = c
+		}
+		c.total += t.total
+		c.active++
+	}
+	return t
+}
+
+// update adds doneDelta to the done count and totalDelta to the
+// total count of t and everything it belongs to. If finished is
+// true, t is no longer counted as active. The observer is notified
+// if notify is true.
+func (btt *blockTransferTracker) update(ctx context.Context,
+	t *blockTransfer, doneDelta, totalDelta int64, finished, notify bool) {
+	progress := BlockTransferProgress{
+		Direction: t.dir,
+		TlfID:     t.tlfID,
+		File:      t.file,
+	}
+	btt.lock.Lock()
+	for _, key := range t.keys() {
+		c := btt.counts[key]
+		c.done += doneDelta
+		c.total += totalDelta
+		if key.file == "" {
+			progress.TlfBytesDone, progress.TlfBytesTotal = c.done, c.total
+		} else {
+			progress.FileBytesDone, progress.FileBytesTotal = c.done, c.total
+		}
+		if finished {
+			c.active--
+			if c.active == 0 {
+				delete(btt.counts, key)
+			}
+		}
+	}
+	observer := btt.observer
+	btt.lock.Unlock()
+
+	if observer != nil && notify {
+		observer.BlockTransferProgress(ctx, progress)
+	}
+}
+
+// transferred records that n more bytes of t have been transferred.
+func (t *blockTransfer) transferred(ctx context.Context, n int64) {
+	if t == nil || n <= 0 {
+		return
+	}
+	var totalDelta int64
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.finished {
+		// E.g., the read this belongs to was canceled, but
+		// the block fetch went on.
+		return
+	}
+	if t.sizeUnknown {
+		totalDelta = n
+		t.total += n
+	} else if t.done+n > t.total {
+		// Don't let a bad estimate of the total push the
+		// counts of other transfers around.
+		n = t.total - t.done
+	}
+	t.done += n
+	if n > 0 {
+		t.tracker.update(ctx, t, n, totalDelta, false, true)
+	}
+}
+
+// finish marks t as complete. Any bytes that weren't reported as
+// transferred, because the transfer failed or because the block
+// server doesn't talk to the network (e.g., a journal or local
+// server), are dropped from the totals. That way only bytes that
+// actually go over the network are reported.
+func (t *blockTransfer) finish(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.finished {
+		return
+	}
+	t.finished = true
+	remaining := t.total - t.done
+	t.total = t.done
+	// Only let the observer know about the new totals if it
+	// heard about this transfer and they changed.
+	t.tracker.update(ctx, t, 0, -remaining, true,
+		remaining > 0 && t.done > 0)
+}
+
+type blockTransferCtxKeyType int
+
+const (
+	// blockTransferCtxKey is the context key for the *blockTransfer
+	// that block server operations should report progress to.
+	blockTransferCtxKey blockTransferCtxKeyType = iota
+	// blockTransferFileKey is the context key for the path of the
+	// file whose blocks are being transferred.
+	blockTransferFileKey
+)
+
+// contextWithBlockTransferFile returns a context that attributes any
+// block transfers done with it to the given file.
+func contextWithBlockTransferFile(
+	ctx context.Context, file string) context.Context {
+	return context.WithValue(ctx, blockTransferFileKey, file)
+}
+
+func contextWithBlockTransfer(
+	ctx context.Context, t *blockTransfer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, blockTransferCtxKey, t)
+}
+
+// blockTransferFromContext returns the transfer that ctx belongs to,
+// or nil if there isn't one.
+func blockTransferFromContext(ctx context.Context) *blockTransfer {
+	t, _ := ctx.Value(blockTransferCtxKey).(*blockTransfer)
+	return t
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+type testBlockTransferObserver struct {
+	lock     sync.Mutex
+	progress []BlockTransferProgress
+}
+
+func (o *testBlockTransferObserver) BlockTransferProgress(
+	_ context.Context, progress BlockTransferProgress) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.progress = append(o.progress, progress)
+}
+
+func (o *testBlockTransferObserver) last() BlockTransferProgress {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.progress[len(o.progress)-1]
+}
+
+func TestBlockTransferTrackerUpload(t *testing.T) {
+	btt := newBlockTransferTracker()
+	ctx := context.Background()
+	tlfID := tlf.FakeID(1, false)
+
+	// Nothing is tracked without an observer.
+	require.Nil(t, btt.start(ctx, BlockUpload, tlfID, 10))
+
+	o := &testBlockTransferObserver{}
+	btt.setObserver(o)
+	fileCtx := contextWithBlockTransferFile(ctx, "a/b")
+	t1 := btt.start(fileCtx, BlockUpload, tlfID, 10)
+	t2 := btt.start(ctx, BlockUpload, tlfID, 20)
+
+	t1.transferred(ctx, 4)
+	require.Equal(t, BlockTransferProgress{
+		Direction:      BlockUpload,
+		TlfID:          tlfID,
+		File:           "a/b",
+		FileBytesDone:  4,
+		FileBytesTotal: 10,
+		TlfBytesDone:   4,
+		TlfBytesTotal:  30,
+	}, o.last())
+
+	t2.transferred(ctx, 20)
+	require.Equal(t, BlockTransferProgress{
+		Direction:     BlockUpload,
+		TlfID:         tlfID,
+		TlfBytesDone:  24,
+		TlfBytesTotal: 30,
+	}, o.last())
+	t2.finish(ctx)
+
+	// A failed transfer drops its remaining bytes from the totals.
+	t1.finish(ctx)
+	require.Equal(t, BlockTransferProgress{
+		Direction:      BlockUpload,
+		TlfID:          tlfID,
+		File:           "a/b",
+		FileBytesDone:  4,
+		FileBytesTotal: 4,
+		TlfBytesDone:   24,
+		TlfBytesTotal:  24,
+	}, o.last())
+	require.Len(t, btt.counts, 0)
+
+	// Nothing more is reported after a transfer is finished.
+	numProgress := len(o.progress)
+	t1.transferred(ctx, 1)
+	require.Len(t, o.progress, numProgress)
+}
+
+func TestBlockTransferTrackerDownload(t *testing.T) {
+	btt := newBlockTransferTracker()
+	o := &testBlockTransferObserver{}
+	btt.setObserver(o)
+	ctx := context.Background()
+	tlfID := tlf.FakeID(1, false)
+
+	tr := btt.start(ctx, BlockDownload, tlfID, unknownBlockTransferSize)
+	tr.transferred(ctx, 5)
+	tr.transferred(ctx, 7)
+	require.Equal(t, BlockTransferProgress{
+		Direction:     BlockDownload,
+		TlfID:         tlfID,
+		TlfBytesDone:  12,
+		TlfBytesTotal: 12,
+	}, o.last())
+	tr.finish(ctx)
+	require.Len(t, btt.counts, 0)
+}
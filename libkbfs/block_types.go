@@ -143,18 +143,29 @@ func (db *DirBlock) Set(other Block) {
 	db.ToCommonBlock().Set(dbCopy.ToCommonBlock())
 }
 
+// DataVersion returns data version for this block.
+func (db *DirBlock) DataVersion() DataVer {
+	if db.IsInd {
+		return IndirectDirsDataVer
+	}
+	return FirstValidDataVer
+}
+
 // DeepCopy makes a complete copy of a DirBlock
 func (db *DirBlock) DeepCopy() *DirBlock {
 	childrenCopy := make(map[string]DirEntry, len(db.Children))
 	for k, v := range db.Children {
 		childrenCopy[k] = v
 	}
-	// TODO KBFS-3: add a copy for IPtrs too once we support indirect dir
-	// blocks
+	var iptrsCopy []IndirectDirPtr
+	if db.IPtrs != nil {
+		iptrsCopy = make([]IndirectDirPtr, len(db.IPtrs))
+		copy(iptrsCopy, db.IPtrs)
+	}
 	return &DirBlock{
 		CommonBlock: db.CommonBlock.DeepCopy(),
 		Children:    childrenCopy,
-		IPtrs:       db.IPtrs,
+		IPtrs:       iptrsCopy,
 	}
 }
 
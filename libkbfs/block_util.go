@@ -75,18 +75,35 @@ func doOneBlockPut(ctx context.Context, bserv BlockServer, reporter Reporter,
 // isRecoverableBlockError(err), the caller should retry its entire
 // operation, starting from when the MD successor was created.
 //
+// At most maxParallel puts are in flight at once; if maxParallel is
+// not positive, maxParallelBlockPuts is used. Upload progress is
+// reported to transfers, which may be nil.
+//
 // Returns a slice of block pointers that resulted in recoverable
 // errors and should be removed by the caller from any saved state.
 func doBlockPuts(ctx context.Context, bserv BlockServer, bcache BlockCache,
 	reporter Reporter, log logger.Logger, tlfID tlf.ID, tlfName CanonicalTlfName,
-	bps blockPutState) ([]BlockPointer, error) {
-	eg, groupCtx := errgroup.WithContext(ctx)
+	bps blockPutState, maxParallel int,
+	transfers *blockTransferTracker) ([]BlockPointer, error) {
+	var totalBytes int64
+	for _, bs := range bps.blockStates {
+		if bs.blockPtr.RefNonce == kbfsblock.ZeroRefNonce {
+			totalBytes += int64(len(bs.readyBlockData.buf))
+		}
+	}
+	transfer := transfers.start(ctx, BlockUpload, tlfID, totalBytes)
+	defer transfer.finish(ctx)
+	eg, groupCtx := errgroup.WithContext(
+		contextWithBlockTransfer(ctx, transfer))
 
 	blocks := make(chan blockState, len(bps.blockStates))
 
+	if maxParallel <= 0 {
+		maxParallel = maxParallelBlockPuts
+	}
 	numWorkers := len(bps.blockStates)
-	if numWorkers > maxParallelBlockPuts {
-		numWorkers = maxParallelBlockPuts
+	if numWorkers > maxParallel {
+		numWorkers = maxParallel
 	}
 	// A channel to list any blocks that have been archived or
 	// deleted.  Any of these will result in an error, so the maximum
@@ -2,10 +2,13 @@ package libkbfs
 
 import (
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscrypto"
 	"github.com/keybase/kbfs/tlf"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
@@ -99,3 +102,41 @@ func TestBlockUtilPutFail(t *testing.T) {
 	err := putBlockToServer(ctx, bserver, tlfID, blockPtr, readyBlockData)
 	require.Equal(t, expectedErr, err)
 }
+
+func TestBlockUtilPutsMaxParallel(t *testing.T) {
+	mockCtrl, ctr, bserver, ctx := blockUtilInit(t)
+	defer blockUtilShutdown(mockCtrl, ctr)
+
+	const numBlocks = 20
+	const maxParallel = 3
+	tlfID := tlf.FakeID(1, false)
+	bps := newBlockPutState(numBlocks)
+	for i := 0; i < numBlocks; i++ {
+		bps.addNewBlock(BlockPointer{ID: kbfsblock.FakeID(byte(i))},
+			NewFileBlock(), ReadyBlockData{buf: []byte{byte(i)}}, nil)
+	}
+
+	var lock sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	bserver.EXPECT().Put(gomock.Any(), tlfID, gomock.Any(), gomock.Any(),
+		gomock.Any(), gomock.Any()).Times(numBlocks).Do(
+		func(context.Context, tlf.ID, kbfsblock.ID, kbfsblock.Context,
+			[]byte, kbfscrypto.BlockCryptKeyServerHalf) {
+			lock.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			lock.Unlock()
+			time.Sleep(time.Millisecond)
+			lock.Lock()
+			inFlight--
+			lock.Unlock()
+		}).Return(nil)
+
+	_, err := doBlockPuts(ctx, bserver, nil, nil, nil, tlfID,
+		CanonicalTlfName("fake TLF"), *bps, maxParallel, nil)
+	require.NoError(t, err)
+	require.True(t, maxInFlight <= maxParallel,
+		"%d puts in flight at once", maxInFlight)
+}
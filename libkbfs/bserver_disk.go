@@ -33,6 +33,7 @@ type BlockServerDisk struct {
 	log          logger.Logger
 	dirPath      string
 	shutdownFunc func(logger.Logger)
+	unlockDir    func() error
 
 	tlfStorageLock sync.RWMutex
 	// tlfStorage is nil after Shutdown() is called.
@@ -42,21 +43,27 @@ type BlockServerDisk struct {
 var _ blockServerLocal = (*BlockServerDisk)(nil)
 
 // newBlockServerDisk constructs a new BlockServerDisk that stores
-// its data in the given directory.
+// its data in the given directory, which it locks until shutdown.
 func newBlockServerDisk(
 	codec kbfscodec.Codec, log logger.Logger,
-	dirPath string, shutdownFunc func(logger.Logger)) *BlockServerDisk {
+	dirPath string, shutdownFunc func(logger.Logger)) (
+	*BlockServerDisk, error) {
+	unlockDir, err := lockDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
 	bserv := &BlockServerDisk{
-		codec, log, dirPath, shutdownFunc, sync.RWMutex{},
+		codec, log, dirPath, shutdownFunc, unlockDir, sync.RWMutex{},
 		make(map[tlf.ID]*blockServerDiskTlfStorage),
 	}
-	return bserv
+	return bserv, nil
 }
 
 // NewBlockServerDir constructs a new BlockServerDisk that stores
-// its data in the given directory.
+// its data in the given directory. It returns a DirInUseError if
+// another process is already using that directory.
 func NewBlockServerDir(codec kbfscodec.Codec,
-	log logger.Logger, dirPath string) *BlockServerDisk {
+	log logger.Logger, dirPath string) (*BlockServerDisk, error) {
 	return newBlockServerDisk(codec, log, dirPath, nil)
 }
 
@@ -73,7 +80,7 @@ func NewBlockServerTempDir(codec kbfscodec.Codec,
 		if err != nil {
 			log.Warning("error removing %s: %s", tempdir, err)
 		}
-	}), nil
+	})
 }
 
 var errBlockServerDiskShutdown = errors.New("BlockServerDisk is shutdown")
@@ -365,6 +372,12 @@ func (b *BlockServerDisk) Shutdown(ctx context.Context) {
 		defer b.tlfStorageLock.Unlock()
 		// Make further accesses error out.
 		tlfStorage := b.tlfStorage
+		if tlfStorage != nil {
+			if err := b.unlockDir(); err != nil {
+				b.log.CWarningf(ctx, "Couldn't unlock %s: %+v",
+					b.dirPath, err)
+			}
+		}
 		b.tlfStorage = nil
 		return tlfStorage
 	}()
@@ -400,3 +413,37 @@ func (b *BlockServerDisk) GetUserQuotaInfo(ctx context.Context) (info *kbfsblock
 	// Return a dummy value here.
 	return &kbfsblock.UserQuotaInfo{Limit: 0x7FFFFFFFFFFFFFFF}, nil
 }
+
+// GetTLFUsageInfo implements the BlockServer interface for
+// BlockServerDisk.
+func (b *BlockServerDisk) GetTLFUsageInfo(
+	ctx context.Context, tlfID tlf.ID) (*kbfsblock.UsageStat, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	tlfStorage, err := b.getStorage(tlfID)
+	if err != nil {
+		return nil, err
+	}
+
+	tlfStorage.lock.RLock()
+	defer tlfStorage.lock.RUnlock()
+	if tlfStorage.store == nil {
+		return nil, errBlockServerDiskShutdown
+	}
+
+	refs, err := tlfStorage.store.getAllRefs()
+	if err != nil {
+		return nil, err
+	}
+	usage := kbfsblock.NewUsageStat()
+	for id, idRefs := range refs {
+		size, err := tlfStorage.store.getDataSize(id)
+		if err != nil {
+			return nil, err
+		}
+		idRefs.accumUsage(usage, int(size))
+	}
+	return usage, nil
+}
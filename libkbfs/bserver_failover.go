@@ -0,0 +1,400 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
+	"golang.org/x/net/context"
+)
+
+const (
+	// bserverHealthCheckInterval is how often an unhealthy block
+	// server endpoint is checked to see whether it's back.
+	bserverHealthCheckInterval = 30 * time.Second
+	// bserverHealthCheckTimeout bounds each health check.
+	bserverHealthCheckTimeout = 10 * time.Second
+	// bserverAttemptTimeout bounds each attempt at a request on a
+	// single endpoint, so that an endpoint that stops answering
+	// without dropping the connection doesn't hang the request.
+	bserverAttemptTimeout = 1 * time.Minute
+)
+
+// blockServerEndpoint is one of the block servers used by
+// BlockServerFailover.
+type blockServerEndpoint struct {
+	addr   string
+	server BlockServer
+
+	// healthy is protected by BlockServerFailover.lock.
+	healthy bool
+}
+
+// BlockServerFailover implements the BlockServer interface by
+// spreading requests round-robin over several equivalent block
+// servers. When a request to one of them fails in a way that
+// suggests the server itself is in trouble (see
+// isRetriableBlockServerError), that server is marked unhealthy and
+// the request moves on to the next one. Unhealthy servers are only
+// used as a last resort until a periodic health check finds them
+// working again.
+type BlockServerFailover struct {
+	log            logger.Logger
+	endpoints      []*blockServerEndpoint
+	attemptTimeout time.Duration
+
+	lock sync.Mutex
+	next int
+
+	shutdownChan chan struct{}
+	shutdownOnce sync.Once
+}
+
+var _ BlockServer = (*BlockServerFailover)(nil)
+
+// NewBlockServerFailover returns a BlockServerFailover for the given
+// remote block servers, which must all front the same storage.
+func NewBlockServerFailover(log logger.Logger,
+	servers []*BlockServerRemote) *BlockServerFailover {
+	addrs := make([]string, 0, len(servers))
+	bservers := make([]BlockServer, 0, len(servers))
+	for _, s := range servers {
+		addrs = append(addrs, s.RemoteAddress())
+		bservers = append(bservers, s)
+	}
+	return newBlockServerFailover(log, addrs, bservers,
+		bserverAttemptTimeout, bserverHealthCheckInterval)
+}
+
+func newBlockServerFailover(log logger.Logger, addrs []string,
+	servers []BlockServer, attemptTimeout time.Duration,
+	healthCheckInterval time.Duration) *BlockServerFailover {
+	b := &BlockServerFailover{
+		log:            log,
+		attemptTimeout: attemptTimeout,
+		shutdownChan:   make(chan struct{}),
+	}
+	for i, s := range servers {
+		b.endpoints = append(b.endpoints, &blockServerEndpoint{
+			addr:    addrs[i],
+			server:  s,
+			healthy: true,
+		})
+	}
+	go b.healthCheckLoop(healthCheckInterval)
+	return b
+}
+
+// order returns the endpoints in the order they should be tried for
+// the next request: the healthy ones, starting from the next one in
+// round-robin order, followed by the unhealthy ones.
+func (b *BlockServerFailover) order() []*blockServerEndpoint {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	n := len(b.endpoints)
+	healthy := make([]*blockServerEndpoint, 0, n)
+	var unhealthy []*blockServerEndpoint
+	for i := 0; i < n; i++ {
+		e := b.endpoints[(b.next+i)%n]
+		if e.healthy {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+	b.next = (b.next + 1) % n
+	return append(healthy, unhealthy...)
+}
+
+func (b *BlockServerFailover) setHealthy(
+	ctx context.Context, e *blockServerEndpoint, healthy bool, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if e.healthy == healthy {
+		return
+	}
+	e.healthy = healthy
+	if healthy {
+		b.log.CDebugf(ctx, "Block server %s is healthy again", e.addr)
+	} else {
+		b.log.CWarningf(ctx, "Block server %s is unhealthy: %+v", e.addr, err)
+	}
+}
+
+type attemptTimerKey struct{}
+
+// attemptTimer cancels a block server attempt once it has run for
+// its timeout, not counting the time it spends paused (e.g., waiting
+// on a bandwidth limit, which says nothing about the endpoint's
+// health).
+type attemptTimer struct {
+	cancel context.CancelFunc
+
+	lock      sync.Mutex
+	remaining time.Duration
+	started   time.Time
+	timer     *time.Timer
+	paused    int
+	expired   bool
+}
+
+func newAttemptTimer(ctx context.Context, timeout time.Duration) (
+	context.Context, *attemptTimer) {
+	ctx, cancel := context.WithCancel(ctx)
+	t := &attemptTimer{cancel: cancel, remaining: timeout}
+	t.startLocked()
+	return context.WithValue(ctx, attemptTimerKey{}, t), t
+}
+
+func (t *attemptTimer) startLocked() {
+	t.started = time.Now()
+	t.timer = time.AfterFunc(t.remaining, t.expire)
+}
+
+func (t *attemptTimer) expire() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.paused > 0 {
+		// Raced with a pause, which now owns the expiry.
+		return
+	}
+	t.expired = true
+	t.cancel()
+}
+
+func (t *attemptTimer) pause() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.paused++
+	if t.paused > 1 {
+		return
+	}
+	if t.timer.Stop() {
+		t.remaining -= time.Since(t.started)
+	} else {
+		t.remaining = 0
+	}
+}
+
+func (t *attemptTimer) resume() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.paused--
+	if t.paused > 0 {
+		return
+	}
+	if t.remaining <= 0 {
+		t.expired = true
+		t.cancel()
+		return
+	}
+	t.startLocked()
+}
+
+// stop ends the attempt, and returns whether it ran out of time.
+func (t *attemptTimer) stop() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.timer.Stop()
+	t.cancel()
+	return t.expired
+}
+
+// pauseBlockServerAttempt stops the clock on the block server
+// attempt that ctx belongs to, if any, until the returned function
+// is called.
+func pauseBlockServerAttempt(ctx context.Context) (resume func()) {
+	t, ok := ctx.Value(attemptTimerKey{}).(*attemptTimer)
+	if !ok {
+		return func() {}
+	}
+	t.pause()
+	return t.resume
+}
+
+// do calls op on each endpoint in turn until one of them succeeds or
+// fails with an error that isn't the endpoint's fault. Each call
+// gets its own deadline, and running out of time counts as the
+// endpoint's fault; time spent paused by
+// pauseBlockServerAttempt doesn't count towards the deadline.
+func (b *BlockServerFailover) do(ctx context.Context, name string,
+	op func(context.Context, BlockServer) error) (err error) {
+	for _, e := range b.order() {
+		attemptCtx, timer := newAttemptTimer(ctx, b.attemptTimeout)
+		err = op(attemptCtx, e.server)
+		timedOut := timer.stop() && ctx.Err() == nil
+		if err == nil {
+			b.setHealthy(ctx, e, true, nil)
+			return nil
+		}
+		if !timedOut && !isRetriableBlockServerError(err) {
+			// This is an answer about the request itself,
+			// which another server would give too.
+			return err
+		}
+		b.setHealthy(ctx, e, false, err)
+		select {
+		case <-ctx.Done():
+			return err
+		default:
+		}
+		b.log.CDebugf(ctx, "%s failed on %s; trying the next block server",
+			name, e.addr)
+	}
+	return err
+}
+
+func (b *BlockServerFailover) checkHealth() {
+	for _, e := range b.endpoints {
+		b.lock.Lock()
+		healthy := e.healthy
+		b.lock.Unlock()
+		if healthy {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(
+			context.Background(), bserverHealthCheckTimeout)
+		_, err := e.server.GetUserQuotaInfo(ctx)
+		cancel()
+		// Any answer from the server itself means it's up.
+		if err == nil || !isRetriableBlockServerError(err) {
+			b.setHealthy(ctx, e, true, nil)
+		}
+	}
+}
+
+func (b *BlockServerFailover) healthCheckLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.checkHealth()
+		case <-b.shutdownChan:
+			return
+		}
+	}
+}
+
+// RemoteAddress returns the addresses of the block servers, separated
+// by commas.
+func (b *BlockServerFailover) RemoteAddress() string {
+	addrs := make([]string, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		addrs = append(addrs, e.addr)
+	}
+	return strings.Join(addrs, ",")
+}
+
+// Get implements the BlockServer interface for BlockServerFailover.
+func (b *BlockServerFailover) Get(ctx context.Context, tlfID tlf.ID,
+	id kbfsblock.ID, bctx kbfsblock.Context) (
+	buf []byte, serverHalf kbfscrypto.BlockCryptKeyServerHalf, err error) {
+	err = b.do(ctx, "Get",
+		func(ctx context.Context, s BlockServer) (err error) {
+			buf, serverHalf, err = s.Get(ctx, tlfID, id, bctx)
+			return err
+		})
+	return buf, serverHalf, err
+}
+
+// Put implements the BlockServer interface for BlockServerFailover.
+func (b *BlockServerFailover) Put(ctx context.Context, tlfID tlf.ID,
+	id kbfsblock.ID, bctx kbfsblock.Context, buf []byte,
+	serverHalf kbfscrypto.BlockCryptKeyServerHalf) error {
+	return b.do(ctx, "Put",
+		func(ctx context.Context, s BlockServer) error {
+			return s.Put(ctx, tlfID, id, bctx, buf, serverHalf)
+		})
+}
+
+// AddBlockReference implements the BlockServer interface for
+// BlockServerFailover.
+func (b *BlockServerFailover) AddBlockReference(ctx context.Context,
+	tlfID tlf.ID, id kbfsblock.ID, bctx kbfsblock.Context) error {
+	return b.do(ctx, "AddBlockReference",
+		func(ctx context.Context, s BlockServer) error {
+			return s.AddBlockReference(ctx, tlfID, id, bctx)
+		})
+}
+
+// RemoveBlockReferences implements the BlockServer interface for
+// BlockServerFailover.
+func (b *BlockServerFailover) RemoveBlockReferences(ctx context.Context,
+	tlfID tlf.ID, contexts kbfsblock.ContextMap) (
+	liveCounts map[kbfsblock.ID]int, err error) {
+	err = b.do(ctx, "RemoveBlockReferences",
+		func(ctx context.Context, s BlockServer) (err error) {
+			liveCounts, err = s.RemoveBlockReferences(ctx, tlfID, contexts)
+			return err
+		})
+	return liveCounts, err
+}
+
+// ArchiveBlockReferences implements the BlockServer interface for
+// BlockServerFailover.
+func (b *BlockServerFailover) ArchiveBlockReferences(ctx context.Context,
+	tlfID tlf.ID, contexts kbfsblock.ContextMap) error {
+	return b.do(ctx, "ArchiveBlockReferences",
+		func(ctx context.Context, s BlockServer) error {
+			return s.ArchiveBlockReferences(ctx, tlfID, contexts)
+		})
+}
+
+// IsUnflushed implements the BlockServer interface for
+// BlockServerFailover.
+func (b *BlockServerFailover) IsUnflushed(
+	_ context.Context, _ tlf.ID, _ kbfsblock.ID) (bool, error) {
+	return false, nil
+}
+
+// RefreshAuthToken implements the BlockServer interface for
+// BlockServerFailover.
+func (b *BlockServerFailover) RefreshAuthToken(ctx context.Context) {
+	for _, e := range b.endpoints {
+		e.server.RefreshAuthToken(ctx)
+	}
+}
+
+// GetUserQuotaInfo implements the BlockServer interface for
+// BlockServerFailover.
+func (b *BlockServerFailover) GetUserQuotaInfo(ctx context.Context) (
+	info *kbfsblock.UserQuotaInfo, err error) {
+	err = b.do(ctx, "GetUserQuotaInfo",
+		func(ctx context.Context, s BlockServer) (err error) {
+			info, err = s.GetUserQuotaInfo(ctx)
+			return err
+		})
+	return info, err
+}
+
+// GetTLFUsageInfo implements the BlockServer interface for
+// BlockServerFailover.
+func (b *BlockServerFailover) GetTLFUsageInfo(ctx context.Context,
+	tlfID tlf.ID) (usage *kbfsblock.UsageStat, err error) {
+	err = b.do(ctx, "GetTLFUsageInfo",
+		func(ctx context.Context, s BlockServer) (err error) {
+			usage, err = s.GetTLFUsageInfo(ctx, tlfID)
+			return err
+		})
+	return usage, err
+}
+
+// Shutdown implements the BlockServer interface for
+// BlockServerFailover.
+func (b *BlockServerFailover) Shutdown(ctx context.Context) {
+	b.shutdownOnce.Do(func() {
+		close(b.shutdownChan)
+	})
+	for _, e := range b.endpoints {
+		e.server.Shutdown(ctx)
+	}
+}
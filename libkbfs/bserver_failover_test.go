@@ -0,0 +1,153 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// failoverTestBServer is a BlockServer whose Put and
+// GetUserQuotaInfo fail with err, if set. If hang is set, Put
+// doesn't return until its context is done. If limiter is set, Put
+// first waits on it for one byte at 100 bytes per second.
+type failoverTestBServer struct {
+	BlockServer
+	err     error
+	hang    bool
+	limiter *bandwidthLimiter
+	puts    int
+}
+
+func (s *failoverTestBServer) Put(ctx context.Context, _ tlf.ID,
+	_ kbfsblock.ID, _ kbfsblock.Context, _ []byte,
+	_ kbfscrypto.BlockCryptKeyServerHalf) error {
+	s.puts++
+	if s.limiter != nil {
+		err := s.limiter.wait(ctx, 1, 100)
+		if err != nil {
+			return err
+		}
+	}
+	if s.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return s.err
+}
+
+func (s *failoverTestBServer) GetUserQuotaInfo(_ context.Context) (
+	*kbfsblock.UserQuotaInfo, error) {
+	return nil, s.err
+}
+
+func (s *failoverTestBServer) Shutdown(_ context.Context) {}
+
+func TestBlockServerFailover(t *testing.T) {
+	s1 := &failoverTestBServer{}
+	s2 := &failoverTestBServer{}
+	b := newBlockServerFailover(logger.NewTestLogger(t),
+		[]string{"a", "b"}, []BlockServer{s1, s2}, time.Hour, time.Hour)
+	ctx := context.Background()
+	defer b.Shutdown(ctx)
+	put := func() error {
+		return b.Put(ctx, tlf.FakeID(1, false), kbfsblock.FakeID(1),
+			kbfsblock.Context{}, nil,
+			kbfscrypto.BlockCryptKeyServerHalf{})
+	}
+
+	// Requests alternate between healthy servers.
+	require.NoError(t, put())
+	require.NoError(t, put())
+	require.Equal(t, 1, s1.puts)
+	require.Equal(t, 1, s2.puts)
+
+	// A server-side failure moves the request to the other server,
+	// and the failed one is skipped afterwards.
+	s1.err = io.EOF
+	require.NoError(t, put())
+	require.NoError(t, put())
+	require.NoError(t, put())
+	require.Equal(t, 2, s1.puts)
+	require.Equal(t, 4, s2.puts)
+
+	// Errors about the request itself aren't failed over.
+	s2.err = kbfsblock.BServerErrorOverQuota{}
+	require.Equal(t, s2.err, put())
+	require.Equal(t, 2, s1.puts)
+
+	// With every server unhealthy, all of them are still tried.
+	s2.err = io.EOF
+	require.Equal(t, io.EOF, put())
+	require.Equal(t, 3, s1.puts)
+
+	// The health check brings a recovered server back.
+	s1.err = nil
+	s2.err = nil
+	b.checkHealth()
+	require.NoError(t, put())
+	require.NoError(t, put())
+	require.Equal(t, 4, s1.puts)
+}
+
+func TestBlockServerFailoverAttemptTimeout(t *testing.T) {
+	s1 := &failoverTestBServer{hang: true}
+	s2 := &failoverTestBServer{}
+	b := newBlockServerFailover(logger.NewTestLogger(t),
+		[]string{"a", "b"}, []BlockServer{s1, s2}, 10*time.Millisecond,
+		time.Hour)
+	ctx := context.Background()
+	defer b.Shutdown(ctx)
+	put := func() error {
+		return b.Put(ctx, tlf.FakeID(1, false), kbfsblock.FakeID(1),
+			kbfsblock.Context{}, nil,
+			kbfscrypto.BlockCryptKeyServerHalf{})
+	}
+
+	// A server that stops answering is given up on, and skipped
+	// afterwards.
+	require.NoError(t, put())
+	require.Equal(t, 1, s1.puts)
+	require.Equal(t, 1, s2.puts)
+	require.NoError(t, put())
+	require.Equal(t, 1, s1.puts)
+	require.Equal(t, 2, s2.puts)
+}
+
+func TestBlockServerFailoverAttemptTimeoutExcludesBandwidthWait(t *testing.T) {
+	limiter := newBandwidthLimiter(wallClock{})
+	s1 := &failoverTestBServer{limiter: limiter}
+	s2 := &failoverTestBServer{}
+	b := newBlockServerFailover(logger.NewTestLogger(t),
+		[]string{"a", "b"}, []BlockServer{s1, s2}, 10*time.Millisecond,
+		time.Hour)
+	ctx := context.Background()
+	defer b.Shutdown(ctx)
+	put := func() error {
+		return b.Put(ctx, tlf.FakeID(1, false), kbfsblock.FakeID(1),
+			kbfsblock.Context{}, nil,
+			kbfscrypto.BlockCryptKeyServerHalf{})
+	}
+
+	// Build up a backlog of 50ms, well past the attempt timeout;
+	// waiting it out neither fails the attempt nor marks the
+	// server unhealthy.
+	limiter.reserve(5, 100)
+	require.NoError(t, put())
+	require.Equal(t, 1, s1.puts)
+	require.Equal(t, 0, s2.puts)
+	require.NoError(t, put())
+	require.NoError(t, put())
+	require.Equal(t, 2, s1.puts)
+	require.Equal(t, 1, s2.puts)
+}
@@ -15,13 +15,15 @@ import (
 // BlockServerMeasured delegates to another BlockServer instance but
 // also keeps track of stats.
 type BlockServerMeasured struct {
-	delegate                    BlockServer
-	getTimer                    metrics.Timer
-	putTimer                    metrics.Timer
-	addBlockReferenceTimer      metrics.Timer
-	removeBlockReferencesTimer  metrics.Timer
-	archiveBlockReferencesTimer metrics.Timer
-	isUnflushedTimer            metrics.Timer
+	delegate                   BlockServer
+	getCall                    measuredCall
+	putCall                    measuredCall
+	addBlockReferenceCall      measuredCall
+	removeBlockReferencesCall  measuredCall
+	archiveBlockReferencesCall measuredCall
+	isUnflushedCall            measuredCall
+	getUserQuotaInfoCall       measuredCall
+	getTLFUsageInfoCall        measuredCall
 }
 
 var _ BlockServer = BlockServerMeasured{}
@@ -29,20 +31,24 @@ var _ BlockServer = BlockServerMeasured{}
 // NewBlockServerMeasured creates and returns a new
 // BlockServerMeasured instance with the given delegate and registry.
 func NewBlockServerMeasured(delegate BlockServer, r metrics.Registry) BlockServerMeasured {
-	getTimer := metrics.GetOrRegisterTimer("BlockServer.Get", r)
-	putTimer := metrics.GetOrRegisterTimer("BlockServer.Put", r)
-	addBlockReferenceTimer := metrics.GetOrRegisterTimer("BlockServer.AddBlockReference", r)
-	removeBlockReferencesTimer := metrics.GetOrRegisterTimer("BlockServer.RemoveBlockReferences", r)
-	archiveBlockReferencesTimer := metrics.GetOrRegisterTimer("BlockServer.ArchiveBlockReferences", r)
-	isUnflushedTimer := metrics.GetOrRegisterTimer("BlockServer.IsUnflushed", r)
+	getCall := makeMeasuredCall("BlockServer.Get", r)
+	putCall := makeMeasuredCall("BlockServer.Put", r)
+	addBlockReferenceCall := makeMeasuredCall("BlockServer.AddBlockReference", r)
+	removeBlockReferencesCall := makeMeasuredCall("BlockServer.RemoveBlockReferences", r)
+	archiveBlockReferencesCall := makeMeasuredCall("BlockServer.ArchiveBlockReferences", r)
+	isUnflushedCall := makeMeasuredCall("BlockServer.IsUnflushed", r)
+	getUserQuotaInfoCall := makeMeasuredCall("BlockServer.GetUserQuotaInfo", r)
+	getTLFUsageInfoCall := makeMeasuredCall("BlockServer.GetTLFUsageInfo", r)
 	return BlockServerMeasured{
-		delegate:                    delegate,
-		getTimer:                    getTimer,
-		putTimer:                    putTimer,
-		addBlockReferenceTimer:      addBlockReferenceTimer,
-		removeBlockReferencesTimer:  removeBlockReferencesTimer,
-		archiveBlockReferencesTimer: archiveBlockReferencesTimer,
-		isUnflushedTimer:            isUnflushedTimer,
+		delegate:                   delegate,
+		getCall:                    getCall,
+		putCall:                    putCall,
+		addBlockReferenceCall:      addBlockReferenceCall,
+		removeBlockReferencesCall:  removeBlockReferencesCall,
+		archiveBlockReferencesCall: archiveBlockReferencesCall,
+		isUnflushedCall:            isUnflushedCall,
+		getUserQuotaInfoCall:       getUserQuotaInfoCall,
+		getTLFUsageInfoCall:        getTLFUsageInfoCall,
 	}
 }
 
@@ -50,8 +56,9 @@ func NewBlockServerMeasured(delegate BlockServer, r metrics.Registry) BlockServe
 func (b BlockServerMeasured) Get(ctx context.Context, tlfID tlf.ID, id kbfsblock.ID,
 	context kbfsblock.Context) (
 	buf []byte, serverHalf kbfscrypto.BlockCryptKeyServerHalf, err error) {
-	b.getTimer.Time(func() {
+	b.getCall.time(func() error {
 		buf, serverHalf, err = b.delegate.Get(ctx, tlfID, id, context)
+		return err
 	})
 	return buf, serverHalf, err
 }
@@ -60,8 +67,9 @@ func (b BlockServerMeasured) Get(ctx context.Context, tlfID tlf.ID, id kbfsblock
 func (b BlockServerMeasured) Put(ctx context.Context, tlfID tlf.ID, id kbfsblock.ID,
 	context kbfsblock.Context, buf []byte,
 	serverHalf kbfscrypto.BlockCryptKeyServerHalf) (err error) {
-	b.putTimer.Time(func() {
+	b.putCall.time(func() error {
 		err = b.delegate.Put(ctx, tlfID, id, context, buf, serverHalf)
+		return err
 	})
 	return err
 }
@@ -70,8 +78,9 @@ func (b BlockServerMeasured) Put(ctx context.Context, tlfID tlf.ID, id kbfsblock
 // BlockServerMeasured.
 func (b BlockServerMeasured) AddBlockReference(ctx context.Context, tlfID tlf.ID,
 	id kbfsblock.ID, context kbfsblock.Context) (err error) {
-	b.addBlockReferenceTimer.Time(func() {
+	b.addBlockReferenceCall.time(func() error {
 		err = b.delegate.AddBlockReference(ctx, tlfID, id, context)
+		return err
 	})
 	return err
 }
@@ -81,9 +90,10 @@ func (b BlockServerMeasured) AddBlockReference(ctx context.Context, tlfID tlf.ID
 func (b BlockServerMeasured) RemoveBlockReferences(ctx context.Context,
 	tlfID tlf.ID, contexts kbfsblock.ContextMap) (
 	liveCounts map[kbfsblock.ID]int, err error) {
-	b.removeBlockReferencesTimer.Time(func() {
+	b.removeBlockReferencesCall.time(func() error {
 		liveCounts, err = b.delegate.RemoveBlockReferences(
 			ctx, tlfID, contexts)
+		return err
 	})
 	return liveCounts, err
 }
@@ -92,8 +102,9 @@ func (b BlockServerMeasured) RemoveBlockReferences(ctx context.Context,
 // BlockServerRemote
 func (b BlockServerMeasured) ArchiveBlockReferences(ctx context.Context,
 	tlfID tlf.ID, contexts kbfsblock.ContextMap) (err error) {
-	b.archiveBlockReferencesTimer.Time(func() {
+	b.archiveBlockReferencesCall.time(func() error {
 		err = b.delegate.ArchiveBlockReferences(ctx, tlfID, contexts)
+		return err
 	})
 	return err
 }
@@ -101,8 +112,9 @@ func (b BlockServerMeasured) ArchiveBlockReferences(ctx context.Context,
 // IsUnflushed implements the BlockServer interface for BlockServerMeasured.
 func (b BlockServerMeasured) IsUnflushed(ctx context.Context, tlfID tlf.ID,
 	id kbfsblock.ID) (isUnflushed bool, err error) {
-	b.isUnflushedTimer.Time(func() {
+	b.isUnflushedCall.time(func() error {
 		isUnflushed, err = b.delegate.IsUnflushed(ctx, tlfID, id)
+		return err
 	})
 	return isUnflushed, err
 
@@ -122,5 +134,20 @@ func (b BlockServerMeasured) RefreshAuthToken(ctx context.Context) {
 
 // GetUserQuotaInfo implements the BlockServer interface for BlockServerMeasured
 func (b BlockServerMeasured) GetUserQuotaInfo(ctx context.Context) (info *kbfsblock.UserQuotaInfo, err error) {
-	return b.delegate.GetUserQuotaInfo(ctx)
+	b.getUserQuotaInfoCall.time(func() error {
+		info, err = b.delegate.GetUserQuotaInfo(ctx)
+		return err
+	})
+	return info, err
+}
+
+// GetTLFUsageInfo implements the BlockServer interface for
+// BlockServerMeasured.
+func (b BlockServerMeasured) GetTLFUsageInfo(ctx context.Context,
+	tlfID tlf.ID) (usage *kbfsblock.UsageStat, err error) {
+	b.getTLFUsageInfoCall.time(func() error {
+		usage, err = b.delegate.GetTLFUsageInfo(ctx, tlfID)
+		return err
+	})
+	return usage, err
 }
@@ -392,3 +392,28 @@ func (b *BlockServerMemory) GetUserQuotaInfo(ctx context.Context) (info *kbfsblo
 	// Return a dummy value here.
 	return &kbfsblock.UserQuotaInfo{Limit: 0x7FFFFFFFFFFFFFFF}, nil
 }
+
+// GetTLFUsageInfo implements the BlockServer interface for
+// BlockServerMemory.
+func (b *BlockServerMemory) GetTLFUsageInfo(
+	ctx context.Context, tlfID tlf.ID) (*kbfsblock.UsageStat, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	if b.m == nil {
+		return nil, errBlockServerMemoryShutdown
+	}
+
+	usage := kbfsblock.NewUsageStat()
+	for _, entry := range b.m {
+		if entry.tlfID != tlfID {
+			continue
+		}
+		entry.refs.accumUsage(usage, len(entry.blockData))
+	}
+	return usage, nil
+}
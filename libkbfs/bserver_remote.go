@@ -5,6 +5,7 @@
 package libkbfs
 
 import (
+	"crypto/tls"
 	"errors"
 	"time"
 
@@ -32,6 +33,7 @@ const (
 type BlockServerRemote struct {
 	codec      kbfscodec.Codec
 	cig        currentInfoGetter
+	config     blockServerRemoteConfig
 	shutdownFn func()
 	putClient  keybase1.BlockInterface
 	getClient  keybase1.BlockInterface
@@ -41,6 +43,20 @@ type BlockServerRemote struct {
 
 	putAuthToken *kbfscrypto.AuthToken
 	getAuthToken *kbfscrypto.AuthToken
+
+	putLimiter *bandwidthLimiter
+	getLimiter *bandwidthLimiter
+}
+
+// blockServerRemoteConfig is the subset of Config that
+// BlockServerRemote consults on every operation, so that changes
+// take effect right away. The exception is the TLS configuration,
+// which is only read when the connections are made.
+type blockServerRemoteConfig interface {
+	blockRetryPolicyGetter
+	blockBandwidthLimitsGetter
+	serverTLSConfigGetter
+	userAlerterGetter
 }
 
 // Test that BlockServerRemote fully implements the BlockServer interface.
@@ -85,8 +101,7 @@ func (b *blockServerRemoteClientHandler) OnConnectError(err error, wait time.Dur
 	if b.authToken != nil {
 		b.authToken.Shutdown()
 	}
-	// TODO: it might make sense to show something to the user if this is
-	// due to authentication, for example.
+	alertUserOnConnectError(b.bs.config, BServiceName, err)
 }
 
 // OnDoCommandError implements the ConnectionHandler interface.
@@ -136,17 +151,22 @@ func (b *blockServerRemoteClientHandler) ShouldRetryOnConnect(err error) bool {
 var _ rpc.ConnectionHandler = (*blockServerRemoteClientHandler)(nil)
 
 // NewBlockServerRemote constructs a new BlockServerRemote for the
-// given address.
+// given address. Failed operations are retried, and traffic is
+// limited, according to config.
 func NewBlockServerRemote(codec kbfscodec.Codec, signer kbfscrypto.Signer,
-	cig currentInfoGetter, log logger.Logger, blkSrvAddr string,
+	cig currentInfoGetter, config blockServerRemoteConfig,
+	log logger.Logger, blkSrvAddr string,
 	rpcLogFactory *libkb.RPCLogFactory) *BlockServerRemote {
 	deferLog := log.CloneWithAddedDepth(1)
 	bs := &BlockServerRemote{
 		codec:      codec,
 		cig:        cig,
+		config:     config,
 		log:        log,
 		deferLog:   deferLog,
 		blkSrvAddr: blkSrvAddr,
+		putLimiter: newBandwidthLimiter(wallClock{}),
+		getLimiter: newBandwidthLimiter(wallClock{}),
 	}
 	bs.log.Debug("new instance server addr %s", blkSrvAddr)
 
@@ -181,14 +201,16 @@ func NewBlockServerRemote(codec kbfscodec.Codec, signer kbfscrypto.Signer,
 		// shouldn't be shared.
 		ReconnectBackoff: backoff.NewConstantBackOff(RPCReconnectInterval),
 	}
-	putConn := rpc.NewTLSConnection(blkSrvAddr,
-		kbfscrypto.GetRootCerts(blkSrvAddr),
+	var tlsConfig *tls.Config
+	if config != nil {
+		tlsConfig = config.ServerTLSConfig()
+	}
+	putConn := newServerTLSConnection(blkSrvAddr, tlsConfig,
 		kbfsblock.BServerErrorUnwrapper{}, putClientHandler,
 		rpcLogFactory, log, opts)
 	bs.putClient = keybase1.BlockClient{Cli: putConn.GetClient()}
 	putClientHandler.client = bs.putClient
-	getConn := rpc.NewTLSConnection(blkSrvAddr,
-		kbfscrypto.GetRootCerts(blkSrvAddr),
+	getConn := newServerTLSConnection(blkSrvAddr, tlsConfig,
 		kbfsblock.BServerErrorUnwrapper{}, getClientHandler,
 		rpcLogFactory, log, opts)
 	bs.getClient = keybase1.BlockClient{Cli: getConn.GetClient()}
@@ -201,22 +223,44 @@ func NewBlockServerRemote(codec kbfscodec.Codec, signer kbfscrypto.Signer,
 	return bs
 }
 
-// For testing.
+// For testing. If config is nil, operations aren't retried or
+// limited.
 func newBlockServerRemoteWithClient(codec kbfscodec.Codec,
-	cig currentInfoGetter, log logger.Logger,
-	client keybase1.BlockInterface) *BlockServerRemote {
+	cig currentInfoGetter, config blockServerRemoteConfig,
+	log logger.Logger, client keybase1.BlockInterface) *BlockServerRemote {
 	deferLog := log.CloneWithAddedDepth(1)
 	bs := &BlockServerRemote{
-		codec:     codec,
-		cig:       cig,
-		putClient: client,
-		getClient: client,
-		log:       log,
-		deferLog:  deferLog,
+		codec:      codec,
+		cig:        cig,
+		config:     config,
+		putLimiter: newBandwidthLimiter(wallClock{}),
+		getLimiter: newBandwidthLimiter(wallClock{}),
+		putClient:  client,
+		getClient:  client,
+		log:        log,
+		deferLog:   deferLog,
 	}
 	return bs
 }
 
+// retry calls op, retrying it according to the configured retry
+// policy, and returns the number of attempts made.
+func (b *BlockServerRemote) retry(
+	ctx context.Context, op func() error) (int, error) {
+	policy := BlockRetryPolicy{MaxAttempts: 1}
+	if b.config != nil {
+		policy = b.config.BlockRetryPolicy()
+	}
+	return retryBlockOp(ctx, policy, op)
+}
+
+func (b *BlockServerRemote) bandwidthLimits() BlockBandwidthLimits {
+	if b.config == nil {
+		return BlockBandwidthLimits{}
+	}
+	return b.config.BlockBandwidthLimits()
+}
+
 // RemoteAddress returns the remote bserver this client is talking to
 func (b *BlockServerRemote) RemoteAddress() string {
 	return b.blkSrvAddr
@@ -300,15 +344,16 @@ func (b *BlockServerRemote) Get(ctx context.Context, tlfID tlf.ID, id kbfsblock.
 	context kbfsblock.Context) (
 	buf []byte, serverHalf kbfscrypto.BlockCryptKeyServerHalf, err error) {
 	size := -1
+	attempts := 0
 	defer func() {
 		if err != nil {
 			b.deferLog.CWarningf(
-				ctx, "Get id=%s tlf=%s context=%s sz=%d err=%v",
-				id, tlfID, context, size, err)
+				ctx, "Get id=%s tlf=%s context=%s sz=%d attempts=%d err=%v",
+				id, tlfID, context, size, attempts, err)
 		} else {
 			b.deferLog.CDebugf(
-				ctx, "Get id=%s tlf=%s context=%s sz=%d",
-				id, tlfID, context, size)
+				ctx, "Get id=%s tlf=%s context=%s sz=%d attempts=%d",
+				id, tlfID, context, size, attempts)
 		}
 	}()
 
@@ -317,12 +362,24 @@ func (b *BlockServerRemote) Get(ctx context.Context, tlfID tlf.ID, id kbfsblock.
 		Folder: tlfID.String(),
 	}
 
-	res, err := b.getClient.GetBlock(ctx, arg)
+	var res keybase1.GetBlockRes
+	attempts, err = b.retry(ctx, func() (err error) {
+		res, err = b.getClient.GetBlock(ctx, arg)
+		if err != nil {
+			return err
+		}
+		// The size of a block isn't known until it's been
+		// received, so account for it afterwards; this still
+		// keeps the average rate under the limit.
+		return b.getLimiter.wait(
+			ctx, len(res.Buf), b.bandwidthLimits().Download)
+	})
 	if err != nil {
 		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
 	}
 
 	size = len(res.Buf)
+	blockTransferFromContext(ctx).transferred(ctx, int64(size))
 	serverHalf, err = kbfscrypto.ParseBlockCryptKeyServerHalf(res.BlockKey)
 	if err != nil {
 		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
@@ -335,15 +392,16 @@ func (b *BlockServerRemote) Put(ctx context.Context, tlfID tlf.ID, id kbfsblock.
 	context kbfsblock.Context, buf []byte,
 	serverHalf kbfscrypto.BlockCryptKeyServerHalf) (err error) {
 	size := len(buf)
+	attempts := 0
 	defer func() {
 		if err != nil {
 			b.deferLog.CWarningf(
-				ctx, "Put id=%s tlf=%s context=%s sz=%d err=%v",
-				id, tlfID, context, size, err)
+				ctx, "Put id=%s tlf=%s context=%s sz=%d attempts=%d err=%v",
+				id, tlfID, context, size, attempts, err)
 		} else {
 			b.deferLog.CDebugf(
-				ctx, "Put id=%s tlf=%s context=%s sz=%d",
-				id, tlfID, context, size)
+				ctx, "Put id=%s tlf=%s context=%s sz=%d attempts=%d",
+				id, tlfID, context, size, attempts)
 		}
 	}()
 
@@ -357,29 +415,43 @@ func (b *BlockServerRemote) Put(ctx context.Context, tlfID tlf.ID, id kbfsblock.
 	}
 
 	// Handle OverQuota errors at the caller
-	return b.putClient.PutBlock(ctx, arg)
+	attempts, err = b.retry(ctx, func() error {
+		err := b.putLimiter.wait(ctx, size, b.bandwidthLimits().Upload)
+		if err != nil {
+			return err
+		}
+		return b.putClient.PutBlock(ctx, arg)
+	})
+	if err == nil {
+		blockTransferFromContext(ctx).transferred(ctx, int64(size))
+	}
+	return err
 }
 
 // AddBlockReference implements the BlockServer interface for BlockServerRemote
 func (b *BlockServerRemote) AddBlockReference(ctx context.Context, tlfID tlf.ID,
 	id kbfsblock.ID, context kbfsblock.Context) (err error) {
+	attempts := 0
 	defer func() {
 		if err != nil {
 			b.deferLog.CWarningf(
-				ctx, "AddBlockReference id=%s tlf=%s context=%s err=%v",
-				id, tlfID, context, err)
+				ctx, "AddBlockReference id=%s tlf=%s context=%s attempts=%d err=%v",
+				id, tlfID, context, attempts, err)
 		} else {
 			b.deferLog.CDebugf(
-				ctx, "AddBlockReference id=%s tlf=%s context=%s",
-				id, tlfID, context)
+				ctx, "AddBlockReference id=%s tlf=%s context=%s attempts=%d",
+				id, tlfID, context, attempts)
 		}
 	}()
 
 	// Handle OverQuota errors at the caller
-	return b.putClient.AddReference(ctx, keybase1.AddReferenceArg{
-		Ref:    makeBlockReference(id, context),
-		Folder: tlfID.String(),
+	attempts, err = b.retry(ctx, func() error {
+		return b.putClient.AddReference(ctx, keybase1.AddReferenceArg{
+			Ref:    makeBlockReference(id, context),
+			Folder: tlfID.String(),
+		})
 	})
+	return err
 }
 
 // RemoveBlockReferences implements the BlockServer interface for
@@ -531,13 +603,43 @@ func (b *BlockServerRemote) getNotDone(all kbfsblock.ContextMap, doneRefs map[kb
 
 // GetUserQuotaInfo implements the BlockServer interface for BlockServerRemote
 func (b *BlockServerRemote) GetUserQuotaInfo(ctx context.Context) (info *kbfsblock.UserQuotaInfo, err error) {
-	res, err := b.getClient.GetUserQuotaInfo(ctx)
+	attempts := 0
+	defer func() {
+		if err != nil {
+			b.deferLog.CWarningf(
+				ctx, "GetUserQuotaInfo attempts=%d err=%v", attempts, err)
+		} else {
+			b.deferLog.CDebugf(
+				ctx, "GetUserQuotaInfo attempts=%d", attempts)
+		}
+	}()
+
+	var res []byte
+	attempts, err = b.retry(ctx, func() (err error) {
+		res, err = b.getClient.GetUserQuotaInfo(ctx)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	return kbfsblock.UserQuotaInfoDecode(res, b.codec)
 }
 
+// GetTLFUsageInfo implements the BlockServer interface for
+// BlockServerRemote. The bserver already breaks the user's quota
+// usage down by folder, so this just picks out the given TLF.
+func (b *BlockServerRemote) GetTLFUsageInfo(
+	ctx context.Context, tlfID tlf.ID) (*kbfsblock.UsageStat, error) {
+	info, err := b.GetUserQuotaInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if usage, ok := info.Folders[tlfID.String()]; ok && usage != nil {
+		return usage, nil
+	}
+	return kbfsblock.NewUsageStat(), nil
+}
+
 // Shutdown implements the BlockServer interface for BlockServerRemote.
 func (b *BlockServerRemote) Shutdown(ctx context.Context) {
 	if b.shutdownFn != nil {
@@ -0,0 +1,132 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// BlockRetryPolicy describes how BlockServerRemote retries a block
+// operation that failed with a retriable error (see
+// isRetriableBlockServerError). This is on top of the retries done
+// by the underlying RPC connection when it reconnects.
+type BlockRetryPolicy struct {
+	// MaxAttempts is the maximum number of times to try an
+	// operation, including the first try. A value less than 2
+	// turns off retries.
+	MaxAttempts int
+	// InitialInterval is how long to wait before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between two retries.
+	MaxInterval time.Duration
+	// Multiplier is what the wait is multiplied by after each
+	// retry.
+	Multiplier float64
+	// Jitter is the randomization factor applied to each wait,
+	// which is picked uniformly from [wait*(1-Jitter),
+	// wait*(1+Jitter)]. It must be between 0 and 1.
+	Jitter float64
+}
+
+// DefaultBlockRetryPolicy returns the retry policy used for remote
+// block operations if none is configured.
+func DefaultBlockRetryPolicy() BlockRetryPolicy {
+	return BlockRetryPolicy{
+		MaxAttempts:     4,
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.5,
+	}
+}
+
+// checkBlockRetryPolicy returns an error if p can't be used.
+func checkBlockRetryPolicy(p BlockRetryPolicy) error {
+	switch {
+	case p.InitialInterval < 0 || p.MaxInterval < 0:
+		return errors.Errorf("Negative block retry interval in %+v", p)
+	case p.Multiplier < 1:
+		return errors.Errorf("Block retry multiplier %v is less than 1",
+			p.Multiplier)
+	case p.Jitter < 0 || p.Jitter > 1:
+		return errors.Errorf("Block retry jitter %v is not between 0 and 1",
+			p.Jitter)
+	}
+	return nil
+}
+
+// newBackOff returns a backoff.BackOff that follows p. It doesn't
+// enforce MaxAttempts, which is up to the caller.
+func (p BlockRetryPolicy) newBackOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = p.InitialInterval
+	b.MaxInterval = p.MaxInterval
+	b.Multiplier = p.Multiplier
+	b.RandomizationFactor = p.Jitter
+	// Attempts, not elapsed time, bound the retries.
+	b.MaxElapsedTime = 0
+	b.Reset()
+	return b
+}
+
+// isRetriableBlockServerError returns whether a block operation that
+// failed with err may succeed if it is tried again unchanged. Only
+// errors that indicate a transient network or server problem
+// qualify; errors about the block or the request itself, including
+// context cancellation, don't.
+func isRetriableBlockServerError(err error) bool {
+	switch e := err.(type) {
+	case kbfsblock.BServerErrorThrottle:
+		return true
+	case kbfsblock.BServerErrorOverQuota:
+		return e.Throttled
+	case kbfsblock.BServerError:
+		// A generic server-side failure.
+		return true
+	case net.Error:
+		return e.Temporary() || e.Timeout()
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// blockRetryPolicyGetter is the subset of Config needed by
+// BlockServerRemote to retry operations.
+type blockRetryPolicyGetter interface {
+	// BlockRetryPolicy returns the retry policy for remote block
+	// operations.
+	BlockRetryPolicy() BlockRetryPolicy
+}
+
+// retryBlockOp calls op until it succeeds, fails with an error that
+// isn't retriable, the attempts allowed by policy run out, or ctx is
+// done. It returns the number of attempts made along with the
+// result of the last one.
+func retryBlockOp(ctx context.Context, policy BlockRetryPolicy,
+	op func() error) (attempts int, err error) {
+	var b backoff.BackOff
+	for {
+		attempts++
+		err = op()
+		if err == nil || attempts >= policy.MaxAttempts ||
+			!isRetriableBlockServerError(err) {
+			return attempts, err
+		}
+		if b == nil {
+			b = policy.newBackOff()
+		}
+		select {
+		case <-time.After(b.NextBackOff()):
+		case <-ctx.Done():
+			return attempts, err
+		}
+	}
+}
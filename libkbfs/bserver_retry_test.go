@@ -0,0 +1,212 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestIsRetriableBlockServerError(t *testing.T) {
+	require.True(t, isRetriableBlockServerError(
+		kbfsblock.BServerErrorThrottle{}))
+	require.True(t, isRetriableBlockServerError(
+		kbfsblock.BServerErrorOverQuota{Throttled: true}))
+	require.True(t, isRetriableBlockServerError(kbfsblock.BServerError{}))
+	require.True(t, isRetriableBlockServerError(io.EOF))
+
+	require.False(t, isRetriableBlockServerError(
+		kbfsblock.BServerErrorOverQuota{}))
+	require.False(t, isRetriableBlockServerError(
+		kbfsblock.BServerErrorBlockNonExistent{}))
+	require.False(t, isRetriableBlockServerError(context.Canceled))
+	require.False(t, isRetriableBlockServerError(errors.New("nope")))
+}
+
+func testBlockRetryPolicy(maxAttempts int) BlockRetryPolicy {
+	return BlockRetryPolicy{MaxAttempts: maxAttempts, Multiplier: 1}
+}
+
+func TestRetryBlockOp(t *testing.T) {
+	ctx := context.Background()
+
+	// Retriable errors are retried until success.
+	calls := 0
+	attempts, err := retryBlockOp(ctx, testBlockRetryPolicy(5),
+		func() error {
+			calls++
+			if calls < 3 {
+				return io.EOF
+			}
+			return nil
+		})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+
+	// ...but only up to MaxAttempts.
+	calls = 0
+	attempts, err = retryBlockOp(ctx, testBlockRetryPolicy(2),
+		func() error {
+			calls++
+			return io.EOF
+		})
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 2, attempts)
+	require.Equal(t, 2, calls)
+
+	// Other errors aren't retried.
+	attempts, err = retryBlockOp(ctx, testBlockRetryPolicy(5),
+		func() error {
+			return kbfsblock.BServerErrorBlockNonExistent{}
+		})
+	require.Equal(t, kbfsblock.BServerErrorBlockNonExistent{}, err)
+	require.Equal(t, 1, attempts)
+}
+
+func TestCheckBlockRetryPolicy(t *testing.T) {
+	require.NoError(t, checkBlockRetryPolicy(DefaultBlockRetryPolicy()))
+	p := DefaultBlockRetryPolicy()
+	p.Jitter = 2
+	require.Error(t, checkBlockRetryPolicy(p))
+	p = DefaultBlockRetryPolicy()
+	p.Multiplier = 0.5
+	require.Error(t, checkBlockRetryPolicy(p))
+}
+
+type flakyBServerClient struct {
+	fakeBServerClient
+	failuresLeft int
+	quota        []byte
+}
+
+func (fc *flakyBServerClient) GetBlock(ctx context.Context,
+	arg keybase1.GetBlockArg) (keybase1.GetBlockRes, error) {
+	if fc.failuresLeft > 0 {
+		fc.failuresLeft--
+		return keybase1.GetBlockRes{}, io.ErrUnexpectedEOF
+	}
+	return fc.fakeBServerClient.GetBlock(ctx, arg)
+}
+
+func (fc *flakyBServerClient) GetUserQuotaInfo(
+	ctx context.Context) ([]byte, error) {
+	if fc.failuresLeft > 0 {
+		fc.failuresLeft--
+		return nil, io.ErrUnexpectedEOF
+	}
+	return fc.quota, nil
+}
+
+type testBlockRetryPolicyGetter BlockRetryPolicy
+
+func (g testBlockRetryPolicyGetter) BlockRetryPolicy() BlockRetryPolicy {
+	return BlockRetryPolicy(g)
+}
+
+func (g testBlockRetryPolicyGetter) BlockBandwidthLimits() BlockBandwidthLimits {
+	return BlockBandwidthLimits{}
+}
+
+func (g testBlockRetryPolicyGetter) ServerTLSConfig() *tls.Config {
+	return nil
+}
+
+func (g testBlockRetryPolicyGetter) UserAlerter() UserAlerter {
+	return NewUserAlerterLog(logger.NewNull())
+}
+
+func TestBServerRemoteGetRetries(t *testing.T) {
+	codec := kbfscodec.NewMsgpack()
+	log := logger.NewTestLogger(t)
+	fc := &flakyBServerClient{
+		fakeBServerClient: fakeBServerClient{
+			entries: make(map[keybase1.BlockIdCombo]fakeBlockEntry),
+		},
+	}
+	b := newBlockServerRemoteWithClient(codec, nil,
+		testBlockRetryPolicyGetter(testBlockRetryPolicy(3)), log, fc)
+
+	tlfID := tlf.FakeID(2, false)
+	bCtx := kbfsblock.MakeFirstContext(keybase1.MakeTestUID(1))
+	data := []byte{1, 2, 3, 4}
+	bID, err := kbfsblock.MakePermanentID(data)
+	require.NoError(t, err)
+	serverHalf, err := kbfscrypto.MakeRandomBlockCryptKeyServerHalf()
+	require.NoError(t, err)
+	ctx := context.Background()
+	err = b.Put(ctx, tlfID, bID, bCtx, data, serverHalf)
+	require.NoError(t, err)
+
+	fc.failuresLeft = 2
+	buf, _, err := b.Get(ctx, tlfID, bID, bCtx)
+	require.NoError(t, err)
+	require.Equal(t, data, buf)
+
+	fc.failuresLeft = 3
+	_, _, err = b.Get(ctx, tlfID, bID, bCtx)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestBServerRemoteGetUserQuotaInfoRetries(t *testing.T) {
+	codec := kbfscodec.NewMsgpack()
+	log := logger.NewTestLogger(t)
+	info := kbfsblock.NewUserQuotaInfo()
+	info.Limit = 1000
+	info.AccumOne(100, "folder", kbfsblock.UsageWrite)
+	info.AccumOne(40, "folder", kbfsblock.UsageArchive)
+	quota, err := codec.Encode(info)
+	require.NoError(t, err)
+	fc := &flakyBServerClient{quota: quota, failuresLeft: 1}
+	b := newBlockServerRemoteWithClient(codec, nil,
+		testBlockRetryPolicyGetter(testBlockRetryPolicy(2)), log, fc)
+
+	ctx := context.Background()
+	got, err := b.GetUserQuotaInfo(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), got.Limit)
+	require.Equal(t, int64(100), got.Total.Bytes[kbfsblock.UsageWrite])
+	require.Equal(t, int64(40), got.Total.Bytes[kbfsblock.UsageArchive])
+
+	fc.failuresLeft = 2
+	_, err = b.GetUserQuotaInfo(ctx)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestBServerRemoteGetTLFUsageInfo(t *testing.T) {
+	codec := kbfscodec.NewMsgpack()
+	log := logger.NewTestLogger(t)
+	tlfID := tlf.FakeID(1, false)
+	info := kbfsblock.NewUserQuotaInfo()
+	info.AccumOne(100, tlfID.String(), kbfsblock.UsageWrite)
+	info.AccumOne(40, tlfID.String(), kbfsblock.UsageArchive)
+	info.AccumOne(50, tlf.FakeID(2, false).String(), kbfsblock.UsageWrite)
+	quota, err := codec.Encode(info)
+	require.NoError(t, err)
+	fc := &flakyBServerClient{quota: quota}
+	b := newBlockServerRemoteWithClient(codec, nil,
+		testBlockRetryPolicyGetter(testBlockRetryPolicy(1)), log, fc)
+
+	ctx := context.Background()
+	usage, err := b.GetTLFUsageInfo(ctx, tlfID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), usage.Bytes[kbfsblock.UsageWrite])
+	require.Equal(t, int64(40), usage.Bytes[kbfsblock.UsageArchive])
+
+	// A TLF the bserver doesn't know about uses nothing.
+	usage, err = b.GetTLFUsageInfo(ctx, tlf.FakeID(3, false))
+	require.NoError(t, err)
+	require.False(t, usage.NonZero())
+}
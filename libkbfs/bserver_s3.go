@@ -0,0 +1,523 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
+	"golang.org/x/net/context"
+)
+
+// BlockServerS3 implements the BlockServer interface by storing
+// blocks in an S3-compatible bucket, so that the server itself keeps
+// no state.
+//
+// The object layout looks like:
+//
+// <TLF ID>/<block ID>/data
+// <TLF ID>/<block ID>/ksh
+// <TLF ID>/<block ID>/refs
+//
+// which mirrors the files of a blockDiskStore: refs holds a
+// serialized blockJournalInfo, and a block exists exactly when it
+// has any references. The data is always written before the first
+// reference, and the references are deleted before the data, so a
+// crash can leave unreferenced data behind, but never references to
+// missing data.
+//
+// Changing references is a read-modify-write, so only one server may
+// use a given bucket prefix at a time; a lease object under the
+// prefix (see lockS3Prefix) enforces that.
+type BlockServerS3 struct {
+	codec  kbfscodec.Codec
+	log    logger.Logger
+	bucket *s3Bucket
+	unlock func() error
+
+	// lock serializes all changes to the bucket, and protects
+	// shutdown.
+	lock     sync.RWMutex
+	shutdown bool
+}
+
+var _ blockServerLocal = (*BlockServerS3)(nil)
+
+// newBlockServerS3 constructs a new BlockServerS3 that stores its
+// data in the given bucket, which it leases until shutdown. It
+// returns an S3PrefixInUseError if another server holds the lease.
+func newBlockServerS3(codec kbfscodec.Codec, log logger.Logger,
+	bucket *s3Bucket) (*BlockServerS3, error) {
+	unlock, err := lockS3Prefix(log, bucket, s3LeaseDuration)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockServerS3{
+		codec: codec, log: log, bucket: bucket, unlock: unlock,
+	}, nil
+}
+
+var errBlockServerS3Shutdown = errors.New("BlockServerS3 is shutdown")
+
+func blockS3Key(tlfID tlf.ID, id kbfsblock.ID, name string) string {
+	return tlfID.String() + "/" + id.String() + "/" + name
+}
+
+func (b *BlockServerS3) getInfoLocked(ctx context.Context, tlfID tlf.ID,
+	id kbfsblock.ID) (blockJournalInfo, error) {
+	var info blockJournalInfo
+	buf, err := b.bucket.get(ctx, blockS3Key(tlfID, id, "refs"))
+	if err == nil {
+		err = b.codec.Decode(buf, &info)
+		if err != nil {
+			return blockJournalInfo{}, err
+		}
+	} else if !isS3NoSuchKey(err) {
+		return blockJournalInfo{}, err
+	}
+
+	if info.Refs == nil {
+		info.Refs = make(blockRefMap)
+	}
+	return info, nil
+}
+
+// putInfoLocked stores the given references for the given block, or
+// deletes the block if there are none left.
+func (b *BlockServerS3) putInfoLocked(ctx context.Context, tlfID tlf.ID,
+	id kbfsblock.ID, info blockJournalInfo) error {
+	if len(info.Refs) == 0 {
+		for _, name := range []string{"refs", "data", "ksh"} {
+			err := b.bucket.delete(ctx, blockS3Key(tlfID, id, name))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	buf, err := b.codec.Encode(info)
+	if err != nil {
+		return err
+	}
+	return b.bucket.put(ctx, blockS3Key(tlfID, id, "refs"), buf)
+}
+
+func (b *BlockServerS3) getKeyServerHalfLocked(ctx context.Context,
+	tlfID tlf.ID, id kbfsblock.ID) (
+	kbfscrypto.BlockCryptKeyServerHalf, error) {
+	buf, err := b.bucket.get(ctx, blockS3Key(tlfID, id, "ksh"))
+	if isS3NoSuchKey(err) {
+		return kbfscrypto.BlockCryptKeyServerHalf{},
+			blockNonExistentError{id}
+	} else if err != nil {
+		return kbfscrypto.BlockCryptKeyServerHalf{}, err
+	}
+
+	var serverHalf kbfscrypto.BlockCryptKeyServerHalf
+	err = serverHalf.UnmarshalBinary(buf)
+	if err != nil {
+		return kbfscrypto.BlockCryptKeyServerHalf{}, err
+	}
+	return serverHalf, nil
+}
+
+// Get implements the BlockServer interface for BlockServerS3.
+func (b *BlockServerS3) Get(ctx context.Context, tlfID tlf.ID,
+	id kbfsblock.ID, context kbfsblock.Context) (
+	data []byte, serverHalf kbfscrypto.BlockCryptKeyServerHalf, err error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
+	}
+
+	defer func() {
+		err = translateToBlockServerError(err)
+	}()
+	b.log.CDebugf(ctx, "BlockServerS3.Get id=%s tlfID=%s context=%s",
+		id, tlfID, context)
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.shutdown {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{},
+			errBlockServerS3Shutdown
+	}
+
+	info, err := b.getInfoLocked(ctx, tlfID, id)
+	if err != nil {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
+	}
+	exists, err := info.Refs.checkExists(context)
+	if err != nil {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
+	}
+	if !exists {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{},
+			blockNonExistentError{id}
+	}
+
+	data, err = b.bucket.get(ctx, blockS3Key(tlfID, id, "data"))
+	if isS3NoSuchKey(err) {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{},
+			blockNonExistentError{id}
+	} else if err != nil {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
+	}
+
+	// Check integrity.
+	err = kbfsblock.VerifyID(data, id)
+	if err != nil {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
+	}
+
+	serverHalf, err = b.getKeyServerHalfLocked(ctx, tlfID, id)
+	if err != nil {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, err
+	}
+	return data, serverHalf, nil
+}
+
+// Put implements the BlockServer interface for BlockServerS3.
+func (b *BlockServerS3) Put(ctx context.Context, tlfID tlf.ID,
+	id kbfsblock.ID, context kbfsblock.Context, buf []byte,
+	serverHalf kbfscrypto.BlockCryptKeyServerHalf) (err error) {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+
+	defer func() {
+		err = translateToBlockServerError(err)
+	}()
+	b.log.CDebugf(ctx, "BlockServerS3.Put id=%s tlfID=%s context=%s size=%d",
+		id, tlfID, context, len(buf))
+
+	err = validateBlockPut(id, context, buf)
+	if err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.shutdown {
+		return errBlockServerS3Shutdown
+	}
+
+	info, err := b.getInfoLocked(ctx, tlfID, id)
+	if err != nil {
+		return err
+	}
+
+	if len(info.Refs) > 0 {
+		// If the block already exists, everything should be
+		// the same, except for possibly additional
+		// references. We checked that buf hashes to id, so
+		// no need to check the data itself.
+		existingServerHalf, err :=
+			b.getKeyServerHalfLocked(ctx, tlfID, id)
+		if err != nil {
+			return err
+		}
+		if existingServerHalf != serverHalf {
+			return fmt.Errorf(
+				"key server half mismatch: expected %s, got %s",
+				existingServerHalf, serverHalf)
+		}
+	} else {
+		err = b.bucket.put(ctx, blockS3Key(tlfID, id, "data"), buf)
+		if err != nil {
+			return err
+		}
+		serverHalfBuf, err := serverHalf.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		err = b.bucket.put(
+			ctx, blockS3Key(tlfID, id, "ksh"), serverHalfBuf)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = info.Refs.put(context, liveBlockRef, "")
+	if err != nil {
+		return err
+	}
+	return b.putInfoLocked(ctx, tlfID, id, info)
+}
+
+// AddBlockReference implements the BlockServer interface for
+// BlockServerS3.
+func (b *BlockServerS3) AddBlockReference(ctx context.Context, tlfID tlf.ID,
+	id kbfsblock.ID, context kbfsblock.Context) (err error) {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+
+	defer func() {
+		err = translateToBlockServerError(err)
+	}()
+	b.log.CDebugf(ctx, "BlockServerS3.AddBlockReference id=%s "+
+		"tlfID=%s context=%s", id, tlfID, context)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.shutdown {
+		return errBlockServerS3Shutdown
+	}
+
+	info, err := b.getInfoLocked(ctx, tlfID, id)
+	if err != nil {
+		return err
+	}
+	if len(info.Refs) == 0 {
+		return kbfsblock.BServerErrorBlockNonExistent{Msg: fmt.Sprintf(
+			"Block ID %s doesn't exist and cannot be referenced.", id)}
+	}
+	// Only add it if there's a non-archived reference.
+	if !info.Refs.hasNonArchivedRef() {
+		return kbfsblock.BServerErrorBlockArchived{Msg: fmt.Sprintf(
+			"Block ID %s has been archived and cannot be referenced.",
+			id)}
+	}
+
+	err = info.Refs.put(context, liveBlockRef, "")
+	if err != nil {
+		return err
+	}
+	return b.putInfoLocked(ctx, tlfID, id, info)
+}
+
+// RemoveBlockReferences implements the BlockServer interface for
+// BlockServerS3.
+func (b *BlockServerS3) RemoveBlockReferences(ctx context.Context,
+	tlfID tlf.ID, contexts kbfsblock.ContextMap) (
+	liveCounts map[kbfsblock.ID]int, err error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = translateToBlockServerError(err)
+	}()
+	b.log.CDebugf(ctx, "BlockServerS3.RemoveBlockReference "+
+		"tlfID=%s contexts=%v", tlfID, contexts)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.shutdown {
+		return nil, errBlockServerS3Shutdown
+	}
+
+	liveCounts = make(map[kbfsblock.ID]int)
+	for id, idContexts := range contexts {
+		info, err := b.getInfoLocked(ctx, tlfID, id)
+		if err != nil {
+			return nil, err
+		}
+		if len(info.Refs) == 0 {
+			// This block is already gone; no error.
+			liveCounts[id] = 0
+			continue
+		}
+
+		for _, context := range idContexts {
+			err := info.Refs.remove(context, "")
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = b.putInfoLocked(ctx, tlfID, id, info)
+		if err != nil {
+			return nil, err
+		}
+		liveCounts[id] = len(info.Refs)
+	}
+	return liveCounts, nil
+}
+
+// ArchiveBlockReferences implements the BlockServer interface for
+// BlockServerS3.
+func (b *BlockServerS3) ArchiveBlockReferences(ctx context.Context,
+	tlfID tlf.ID, contexts kbfsblock.ContextMap) (err error) {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+
+	defer func() {
+		err = translateToBlockServerError(err)
+	}()
+	b.log.CDebugf(ctx, "BlockServerS3.ArchiveBlockReferences "+
+		"tlfID=%s contexts=%v", tlfID, contexts)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.shutdown {
+		return errBlockServerS3Shutdown
+	}
+
+	// Check all the references first, so that nothing is
+	// archived if any of them is missing.
+	infos := make(map[kbfsblock.ID]blockJournalInfo)
+	for id, idContexts := range contexts {
+		info, err := b.getInfoLocked(ctx, tlfID, id)
+		if err != nil {
+			return err
+		}
+		for _, context := range idContexts {
+			exists, err := info.Refs.checkExists(context)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return kbfsblock.BServerErrorBlockNonExistent{
+					Msg: fmt.Sprintf(
+						"Block ID %s (context %s) doesn't "+
+							"exist and cannot be archived.",
+						id, context),
+				}
+			}
+		}
+		infos[id] = info
+	}
+
+	for id, idContexts := range contexts {
+		info := infos[id]
+		for _, context := range idContexts {
+			err := info.Refs.put(context, archivedBlockRef, "")
+			if err != nil {
+				return err
+			}
+		}
+		err := b.putInfoLocked(ctx, tlfID, id, info)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getAllRefsForTest implements the blockServerLocal interface for
+// BlockServerS3.
+func (b *BlockServerS3) getAllRefsForTest(ctx context.Context, tlfID tlf.ID) (
+	map[kbfsblock.ID]blockRefMap, error) {
+	return b.getAllRefs(ctx, tlfID)
+}
+
+// getAllRefs returns the references of every block of the given TLF
+// in the bucket.
+func (b *BlockServerS3) getAllRefs(ctx context.Context, tlfID tlf.ID) (
+	map[kbfsblock.ID]blockRefMap, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.shutdown {
+		return nil, errBlockServerS3Shutdown
+	}
+
+	keys, err := b.bucket.list(ctx, tlfID.String()+"/")
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[kbfsblock.ID]blockRefMap)
+	for _, key := range keys {
+		parts := strings.Split(key, "/")
+		if len(parts) != 3 || parts[2] != "refs" {
+			continue
+		}
+		id, err := kbfsblock.IDFromString(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		info, err := b.getInfoLocked(ctx, tlfID, id)
+		if err != nil {
+			return nil, err
+		}
+		res[id] = info.Refs
+	}
+	return res, nil
+}
+
+// IsUnflushed implements the BlockServer interface for BlockServerS3.
+func (b *BlockServerS3) IsUnflushed(ctx context.Context, tlfID tlf.ID,
+	_ kbfsblock.ID) (bool, error) {
+	if err := checkContext(ctx); err != nil {
+		return false, err
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.shutdown {
+		return false, errBlockServerS3Shutdown
+	}
+	return false, nil
+}
+
+// Shutdown implements the BlockServer interface for BlockServerS3.
+func (b *BlockServerS3) Shutdown(ctx context.Context) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !b.shutdown {
+		if err := b.unlock(); err != nil {
+			b.log.CWarningf(ctx, "Couldn't release the lease on %s: %+v",
+				b.bucket, err)
+		}
+	}
+	// Make further accesses error out.
+	b.shutdown = true
+}
+
+// RefreshAuthToken implements the BlockServer interface for
+// BlockServerS3.
+func (b *BlockServerS3) RefreshAuthToken(_ context.Context) {}
+
+// GetUserQuotaInfo implements the BlockServer interface for
+// BlockServerS3.
+func (b *BlockServerS3) GetUserQuotaInfo(ctx context.Context) (
+	info *kbfsblock.UserQuotaInfo, err error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	// Return a dummy value here.
+	return &kbfsblock.UserQuotaInfo{Limit: 0x7FFFFFFFFFFFFFFF}, nil
+}
+
+// GetTLFUsageInfo implements the BlockServer interface for
+// BlockServerS3. Since the bucket doesn't keep block sizes with the
+// references, this has to fetch every block of the TLF.
+func (b *BlockServerS3) GetTLFUsageInfo(
+	ctx context.Context, tlfID tlf.ID) (*kbfsblock.UsageStat, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	refs, err := b.getAllRefs(ctx, tlfID)
+	if err != nil {
+		return nil, err
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.shutdown {
+		return nil, errBlockServerS3Shutdown
+	}
+
+	usage := kbfsblock.NewUsageStat()
+	for id, idRefs := range refs {
+		buf, err := b.bucket.get(ctx, blockS3Key(tlfID, id, "data"))
+		if isS3NoSuchKey(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		idRefs.accumUsage(usage, len(buf))
+	}
+	return usage, nil
+}
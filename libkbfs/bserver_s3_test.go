@@ -0,0 +1,104 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestBlockServerS3References(t *testing.T) {
+	bucket, _, server := makeFakeS3BucketForTest(t)
+	defer server.Close()
+	b, err := newBlockServerS3(
+		kbfscodec.NewMsgpack(), logger.NewTestLogger(t), bucket)
+	require.NoError(t, err)
+	ctx := context.Background()
+	defer b.Shutdown(ctx)
+	tlfID := tlf.FakeID(1, false)
+
+	data := []byte{1, 2, 3, 4}
+	bID, bCtx := putBlockForUsageTest(ctx, t, b, tlfID, data)
+	buf, _, err := b.Get(ctx, tlfID, bID, bCtx)
+	require.NoError(t, err)
+	require.Equal(t, data, buf)
+
+	uid := keybase1.MakeTestUID(1)
+	nonce, err := kbfsblock.MakeRefNonce()
+	require.NoError(t, err)
+	bCtx2 := kbfsblock.MakeContext(uid, uid, nonce)
+	err = b.AddBlockReference(ctx, tlfID, bID, bCtx2)
+	require.NoError(t, err)
+	buf, _, err = b.Get(ctx, tlfID, bID, bCtx2)
+	require.NoError(t, err)
+	require.Equal(t, data, buf)
+
+	refs, err := b.getAllRefsForTest(ctx, tlfID)
+	require.NoError(t, err)
+	require.Len(t, refs[bID], 2)
+
+	liveCounts, err := b.RemoveBlockReferences(ctx, tlfID,
+		kbfsblock.ContextMap{bID: {bCtx}})
+	require.NoError(t, err)
+	require.Equal(t, map[kbfsblock.ID]int{bID: 1}, liveCounts)
+
+	// Once the last reference is gone, so is the block.
+	liveCounts, err = b.RemoveBlockReferences(ctx, tlfID,
+		kbfsblock.ContextMap{bID: {bCtx2}})
+	require.NoError(t, err)
+	require.Equal(t, map[kbfsblock.ID]int{bID: 0}, liveCounts)
+	_, _, err = b.Get(ctx, tlfID, bID, bCtx2)
+	require.IsType(t, kbfsblock.BServerErrorBlockNonExistent{}, err)
+}
+
+func TestBlockServerS3PrefixInUse(t *testing.T) {
+	bucket, _, server := makeFakeS3BucketForTest(t)
+	defer server.Close()
+	codec := kbfscodec.NewMsgpack()
+	log := logger.NewTestLogger(t)
+	b, err := newBlockServerS3(codec, log, bucket)
+	require.NoError(t, err)
+
+	_, err = newBlockServerS3(codec, log, bucket)
+	require.IsType(t, S3PrefixInUseError{}, errors.Cause(err))
+
+	b.Shutdown(context.Background())
+
+	b, err = newBlockServerS3(codec, log, bucket)
+	require.NoError(t, err)
+	b.Shutdown(context.Background())
+}
+
+func TestLockS3PrefixExpired(t *testing.T) {
+	bucket, _, server := makeFakeS3BucketForTest(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	// A lease left behind by a server that died can be taken
+	// over once it expires.
+	err := writeS3Lease(ctx, bucket, "dead", -time.Second)
+	require.NoError(t, err)
+	unlock, err := lockS3Prefix(logger.NewTestLogger(t), bucket, time.Hour)
+	require.NoError(t, err)
+	lease, ok, err := readS3Lease(ctx, bucket)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotEqual(t, "dead", lease.Owner)
+
+	err = unlock()
+	require.NoError(t, err)
+	_, ok, err = readS3Lease(ctx, bucket)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func putBlockForUsageTest(ctx context.Context, t *testing.T, b BlockServer,
+	tlfID tlf.ID, data []byte) (kbfsblock.ID, kbfsblock.Context) {
+	bID, err := kbfsblock.MakePermanentID(data)
+	require.NoError(t, err)
+	bCtx := kbfsblock.MakeFirstContext(keybase1.MakeTestUID(1))
+	serverHalf, err := kbfscrypto.MakeRandomBlockCryptKeyServerHalf()
+	require.NoError(t, err)
+	err = b.Put(ctx, tlfID, bID, bCtx, data, serverHalf)
+	require.NoError(t, err)
+	return bID, bCtx
+}
+
+func testBlockServerLocalGetTLFUsageInfo(t *testing.T, b BlockServer) {
+	ctx := context.Background()
+	tlfID := tlf.FakeID(1, false)
+	otherTlfID := tlf.FakeID(2, false)
+
+	usage, err := b.GetTLFUsageInfo(ctx, tlfID)
+	require.NoError(t, err)
+	require.False(t, usage.NonZero())
+
+	putBlockForUsageTest(ctx, t, b, tlfID, []byte{1, 2, 3, 4})
+	archivedID, archivedCtx := putBlockForUsageTest(
+		ctx, t, b, tlfID, []byte{5, 6})
+	putBlockForUsageTest(ctx, t, b, otherTlfID, []byte{7, 8, 9})
+	err = b.ArchiveBlockReferences(ctx, tlfID, kbfsblock.ContextMap{
+		archivedID: {archivedCtx},
+	})
+	require.NoError(t, err)
+
+	usage, err = b.GetTLFUsageInfo(ctx, tlfID)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), usage.Bytes[kbfsblock.UsageWrite])
+	require.Equal(t, int64(2), usage.Blocks[kbfsblock.UsageWrite])
+	require.Equal(t, int64(2), usage.Bytes[kbfsblock.UsageArchive])
+	require.Equal(t, int64(1), usage.Blocks[kbfsblock.UsageArchive])
+
+	usage, err = b.GetTLFUsageInfo(ctx, otherTlfID)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), usage.Bytes[kbfsblock.UsageWrite])
+	require.Equal(t, int64(0), usage.Bytes[kbfsblock.UsageArchive])
+}
+
+func TestBlockServerMemoryGetTLFUsageInfo(t *testing.T) {
+	b := NewBlockServerMemory(logger.NewTestLogger(t))
+	defer b.Shutdown(context.Background())
+	testBlockServerLocalGetTLFUsageInfo(t, b)
+}
+
+func TestBlockServerDiskGetTLFUsageInfo(t *testing.T) {
+	b, err := NewBlockServerTempDir(
+		kbfscodec.NewMsgpack(), logger.NewTestLogger(t))
+	require.NoError(t, err)
+	defer b.Shutdown(context.Background())
+	testBlockServerLocalGetTLFUsageInfo(t, b)
+}
+
+func TestBlockServerS3GetTLFUsageInfo(t *testing.T) {
+	bucket, _, server := makeFakeS3BucketForTest(t)
+	defer server.Close()
+	b, err := newBlockServerS3(
+		kbfscodec.NewMsgpack(), logger.NewTestLogger(t), bucket)
+	require.NoError(t, err)
+	defer b.Shutdown(context.Background())
+	testBlockServerLocalGetTLFUsageInfo(t, b)
+}
@@ -0,0 +1,266 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/pkg/errors"
+)
+
+// CacheEvictionPolicy is the policy an in-memory cache uses to pick
+// which entry to evict when it's full.
+type CacheEvictionPolicy byte
+
+const (
+	// LRUCacheEviction evicts the least recently used entry.
+	LRUCacheEviction CacheEvictionPolicy = 0
+	// SegmentedLRUCacheEviction keeps entries that have been used
+	// more than once in a protected segment, and evicts the least
+	// recently used entry among those that have been used only
+	// once (if any). This keeps a large one-off scan, like reading
+	// a big file once, from flushing out the working set.
+	SegmentedLRUCacheEviction CacheEvictionPolicy = 1
+)
+
+func (p CacheEvictionPolicy) String() string {
+	switch p {
+	case LRUCacheEviction:
+		return "lru"
+	case SegmentedLRUCacheEviction:
+		return "slru"
+	default:
+		return fmt.Sprintf("CacheEvictionPolicy(%d)", p)
+	}
+}
+
+// ParseCacheEvictionPolicy parses the string representation of a
+// CacheEvictionPolicy, as returned by its String method.
+func ParseCacheEvictionPolicy(s string) (CacheEvictionPolicy, error) {
+	switch s {
+	case "", "lru":
+		return LRUCacheEviction, nil
+	case "slru":
+		return SegmentedLRUCacheEviction, nil
+	default:
+		return LRUCacheEviction, errors.Errorf(
+			"Unknown cache eviction policy %q", s)
+	}
+}
+
+// CacheLimits holds the entry capacities and the eviction policy of
+// the clean block cache and the MD cache, and the byte capacity of
+// the dirty block cache. The byte capacity of the clean block cache
+// is set through BlockCache.SetCleanBytesCapacity.
+type CacheLimits struct {
+	// BlockCacheEntries is the maximum number of transient clean
+	// blocks to cache.
+	BlockCacheEntries int
+	// MDCacheEntries is the maximum number of MD objects to cache.
+	MDCacheEntries int
+	// Policy is the eviction policy of both caches.
+	Policy CacheEvictionPolicy
+	// DirtyBytes, if positive, is roughly the most bytes of dirty
+	// blocks to hold in memory; once it's reached, writes block
+	// until syncs to the servers catch up. If zero, it's twice the
+	// clean block cache byte capacity.
+	DirtyBytes int64
+}
+
+const defaultBlockCacheEntries = 10000
+
+// DefaultCacheLimits returns the cache limits used unless others are
+// set explicitly.
+func DefaultCacheLimits() CacheLimits {
+	return CacheLimits{
+		BlockCacheEntries: defaultBlockCacheEntries,
+		MDCacheEntries:    defaultMDCacheCapacity,
+		Policy:            LRUCacheEviction,
+	}
+}
+
+// evictingCache is a goroutine-safe, fixed-size cache. Like
+// lru.Cache, it calls its eviction callback (if any) for every entry
+// that's evicted or removed, while holding its internal lock.
+type evictingCache interface {
+	Add(key, value interface{}) (evicted bool)
+	Get(key interface{}) (value interface{}, ok bool)
+	Remove(key interface{})
+	RemoveOldest()
+	Len() int
+}
+
+var _ evictingCache = (*lru.Cache)(nil)
+
+// newEvictingCache returns a cache of the given size that uses the
+// given eviction policy. onEvict may be nil.
+func newEvictingCache(policy CacheEvictionPolicy, size int,
+	onEvict func(key interface{}, value interface{})) (evictingCache, error) {
+	switch policy {
+	case LRUCacheEviction:
+		return lru.NewWithEvict(size, onEvict)
+	case SegmentedLRUCacheEviction:
+		return newSegmentedLRU(size, onEvict)
+	default:
+		return nil, errors.Errorf("Unknown cache eviction policy %s", policy)
+	}
+}
+
+// segmentedLRUProtectedRatio is the fraction of a segmentedLRU's
+// capacity that is reserved for entries that have been used more
+// than once.
+const segmentedLRUProtectedRatio = 0.8
+
+// minSegmentedLRUSize is the smallest size a segmentedLRU can have,
+// with one entry in each segment.
+const minSegmentedLRUSize = 2
+
+// segmentedLRU is an evictingCache with a probationary segment, into
+// which new entries are added, and a protected segment, into which
+// probationary entries are promoted when they are used again. When
+// the protected segment is full, its least recently used entry is
+// moved back to probation. Entries are only evicted from probation,
+// which may use any room the protected segment isn't using.
+type segmentedLRU struct {
+	onEvict func(key interface{}, value interface{})
+
+	size          int
+	protectedSize int
+
+	lock sync.Mutex
+	// probation and protected are created with the whole size of
+	// the cache, so that they never evict on their own.
+	probation *simplelru.LRU
+	protected *simplelru.LRU
+}
+
+var _ evictingCache = (*segmentedLRU)(nil)
+
+func newSegmentedLRU(size int,
+	onEvict func(key interface{}, value interface{})) (*segmentedLRU, error) {
+	if size < minSegmentedLRUSize {
+		return nil, errors.Errorf(
+			"A segmented LRU cache needs a size of at least %d, not %d",
+			minSegmentedLRUSize, size)
+	}
+	protectedSize := int(float64(size) * segmentedLRUProtectedRatio)
+	if protectedSize < 1 {
+		protectedSize = 1
+	} else if protectedSize > size-1 {
+		protectedSize = size - 1
+	}
+	probation, err := simplelru.NewLRU(size, nil)
+	if err != nil {
+		return nil, err
+	}
+	protected, err := simplelru.NewLRU(size, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &segmentedLRU{
+		onEvict:       onEvict,
+		size:          size,
+		protectedSize: protectedSize,
+		probation:     probation,
+		protected:     protected,
+	}, nil
+}
+
+func (c *segmentedLRU) evicted(key, value interface{}) {
+	if c.onEvict != nil {
+		c.onEvict(key, value)
+	}
+}
+
+// evictProbationLocked evicts probationary entries until the cache
+// fits in its size. It returns whether anything was evicted.
+func (c *segmentedLRU) evictProbationLocked() (evicted bool) {
+	for c.probation.Len()+c.protected.Len() > c.size {
+		key, value, ok := c.probation.RemoveOldest()
+		if !ok {
+			break
+		}
+		c.evicted(key, value)
+		evicted = true
+	}
+	return evicted
+}
+
+// promoteLocked moves key from probation to the protected segment,
+// demoting the least recently used protected entry if needed.
+func (c *segmentedLRU) promoteLocked(key, value interface{}) bool {
+	c.probation.Remove(key)
+	c.protected.Add(key, value)
+	if c.protected.Len() > c.protectedSize {
+		demotedKey, demotedValue, _ := c.protected.RemoveOldest()
+		c.probation.Add(demotedKey, demotedValue)
+	}
+	return c.evictProbationLocked()
+}
+
+// Add implements the evictingCache interface for segmentedLRU.
+func (c *segmentedLRU) Add(key, value interface{}) (evicted bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.protected.Contains(key) {
+		c.protected.Add(key, value)
+		return false
+	}
+	if c.probation.Contains(key) {
+		return c.promoteLocked(key, value)
+	}
+	c.probation.Add(key, value)
+	return c.evictProbationLocked()
+}
+
+// Get implements the evictingCache interface for segmentedLRU.
+func (c *segmentedLRU) Get(key interface{}) (value interface{}, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if value, ok := c.protected.Get(key); ok {
+		return value, true
+	}
+	if value, ok := c.probation.Peek(key); ok {
+		c.promoteLocked(key, value)
+		return value, true
+	}
+	return nil, false
+}
+
+// Remove implements the evictingCache interface for segmentedLRU.
+func (c *segmentedLRU) Remove(key interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, segment := range []*simplelru.LRU{c.probation, c.protected} {
+		if value, ok := segment.Peek(key); ok {
+			segment.Remove(key)
+			c.evicted(key, value)
+			return
+		}
+	}
+}
+
+// RemoveOldest implements the evictingCache interface for
+// segmentedLRU.
+func (c *segmentedLRU) RemoveOldest() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, segment := range []*simplelru.LRU{c.probation, c.protected} {
+		if key, value, ok := segment.RemoveOldest(); ok {
+			c.evicted(key, value)
+			return
+		}
+	}
+}
+
+// Len implements the evictingCache interface for segmentedLRU.
+func (c *segmentedLRU) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.probation.Len() + c.protected.Len()
+}
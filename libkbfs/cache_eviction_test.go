@@ -0,0 +1,147 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestParseCacheEvictionPolicy(t *testing.T) {
+	for _, p := range []CacheEvictionPolicy{
+		LRUCacheEviction, SegmentedLRUCacheEviction} {
+		parsed, err := ParseCacheEvictionPolicy(p.String())
+		require.NoError(t, err)
+		require.Equal(t, p, parsed)
+	}
+	parsed, err := ParseCacheEvictionPolicy("")
+	require.NoError(t, err)
+	require.Equal(t, LRUCacheEviction, parsed)
+	_, err = ParseCacheEvictionPolicy("arc")
+	require.Error(t, err)
+}
+
+func TestCacheLimitsFromParamsSegmentedLRUSize(t *testing.T) {
+	params := InitParams{
+		CacheEvictionPolicy: "slru",
+		BlockCacheEntries:   2,
+		MDCacheEntries:      2,
+	}
+	limits, err := cacheLimitsFromParams(params)
+	require.NoError(t, err)
+	require.Equal(t, SegmentedLRUCacheEviction, limits.Policy)
+
+	// A segmented LRU cache can't have just one entry.
+	params.MDCacheEntries = 1
+	_, err = cacheLimitsFromParams(params)
+	require.Error(t, err)
+	params.CacheEvictionPolicy = "lru"
+	_, err = cacheLimitsFromParams(params)
+	require.NoError(t, err)
+}
+
+func TestSegmentedLRUScanResistance(t *testing.T) {
+	var evicted []interface{}
+	c, err := newEvictingCache(SegmentedLRUCacheEviction, 10,
+		func(key interface{}, _ interface{}) {
+			evicted = append(evicted, key)
+		})
+	require.NoError(t, err)
+
+	// Use a few entries twice, so they are protected.
+	for i := 0; i < 3; i++ {
+		c.Add(i, i)
+		_, ok := c.Get(i)
+		require.True(t, ok)
+	}
+
+	// A long scan only evicts entries from the scan itself.
+	for i := 100; i < 200; i++ {
+		c.Add(i, i)
+	}
+	require.Equal(t, 10, c.Len())
+	require.Len(t, evicted, 93)
+	for i := 0; i < 3; i++ {
+		v, ok := c.Get(i)
+		require.True(t, ok)
+		require.Equal(t, i, v)
+	}
+	for i := 193; i < 200; i++ {
+		_, ok := c.Get(i)
+		require.True(t, ok)
+	}
+	_, ok := c.Get(100)
+	require.False(t, ok)
+}
+
+func TestSegmentedLRUDemotion(t *testing.T) {
+	c, err := newSegmentedLRU(10, nil)
+	require.NoError(t, err)
+	require.Equal(t, 8, c.protectedSize)
+
+	// Promote more entries than fit in the protected segment; the
+	// least recently used ones go back to probation, not away.
+	for i := 0; i < 10; i++ {
+		c.Add(i, i)
+		c.Get(i)
+	}
+	require.Equal(t, 10, c.Len())
+	require.Equal(t, 8, c.protected.Len())
+	require.True(t, c.probation.Contains(0))
+	require.True(t, c.probation.Contains(1))
+
+	// New entries now evict the demoted ones first.
+	c.Add(10, 10)
+	require.Equal(t, 10, c.Len())
+	require.False(t, c.probation.Contains(0))
+	require.True(t, c.protected.Contains(9))
+}
+
+func TestSegmentedLRURemove(t *testing.T) {
+	var evicted []interface{}
+	c, err := newSegmentedLRU(4, func(key interface{}, _ interface{}) {
+		evicted = append(evicted, key)
+	})
+	require.NoError(t, err)
+	c.Add(1, 1)
+	c.Add(2, 2)
+	c.Get(2)
+
+	c.RemoveOldest()
+	require.Equal(t, []interface{}{1}, evicted)
+	c.Remove(2)
+	require.Equal(t, []interface{}{1, 2}, evicted)
+	require.Equal(t, 0, c.Len())
+	c.RemoveOldest()
+	c.Remove(3)
+	require.Len(t, evicted, 2)
+
+	_, err = newSegmentedLRU(1, nil)
+	require.Error(t, err)
+}
+
+func TestConfigResetCachesWithLimits(t *testing.T) {
+	ctx := context.Background()
+	config := MakeTestConfigOrBust(t, "test")
+	defer CheckConfigAndShutdown(ctx, t, config)
+
+	config.SetCacheLimits(CacheLimits{
+		BlockCacheEntries: 100,
+		MDCacheEntries:    10,
+		Policy:            SegmentedLRUCacheEviction,
+		DirtyBytes:        8 * MaxBlockSizeBytesDefault,
+	})
+	config.ResetCaches()
+
+	bcache := config.BlockCache().(*BlockCacheStandard)
+	require.IsType(t, &segmentedLRU{}, bcache.cleanTransient)
+	mdcache := config.MDCache().(*MDCacheStandard)
+	require.IsType(t, &segmentedLRU{}, mdcache.lru)
+	dirtyBcache := config.DirtyBlockCache().(*DirtyBlockCacheStandard)
+	require.Equal(t, int64(4*MaxBlockSizeBytesDefault),
+		dirtyBcache.maxSyncBufCap)
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"github.com/keybase/client/go/protocol/keybase1"
+	"golang.org/x/net/context"
+)
+
+// changeEventReporter is a ChangeSubscriber that turns every change
+// to a folder into a file edit FSNotification, sent via the
+// Reporter.  The keybase service relays those to every local client
+// registered for keybase.1.NotifyFS, so other processes (the GUI,
+// indexers, and so on) can follow changes to KBFS over the service
+// socket without linking libkbfs.
+type changeEventReporter struct {
+	config    Config
+	nodeCache NodeCache
+}
+
+var _ ChangeSubscriber = changeEventReporter{}
+
+func (r changeEventReporter) childPath(dir Node, name string) (path, bool) {
+	if dir == nil {
+		return path{}, false
+	}
+	p := r.nodeCache.PathFromNode(dir)
+	if !p.isValid() {
+		return path{}, false
+	}
+	return p.ChildPathNoPtr(name), true
+}
+
+func (r changeEventReporter) notification(e ChangeEvent) (
+	n *keybase1.FSNotification) {
+	oldPath, oldOk := r.childPath(e.Dir, e.Name)
+	switch e.Type {
+	case ChangeEventCreate:
+		if oldOk {
+			n = fileCreateNotification(oldPath, e.Writer, e.LocalTime)
+		}
+	case ChangeEventDelete:
+		if oldOk {
+			n = fileDeleteNotification(oldPath, e.Writer, e.LocalTime)
+		}
+	case ChangeEventAttr:
+		if oldOk {
+			n = fileModifyNotification(oldPath, e.Writer, e.LocalTime)
+		}
+	case ChangeEventWrite:
+		if e.Entry != nil {
+			p := r.nodeCache.PathFromNode(e.Entry)
+			if p.isValid() {
+				n = fileModifyNotification(p, e.Writer, e.LocalTime)
+			}
+		}
+	case ChangeEventRename:
+		newPath, newOk := r.childPath(e.NewDir, e.NewName)
+		switch {
+		case oldOk && newOk:
+			n = fileRenameNotification(
+				oldPath, newPath, e.Writer, e.LocalTime)
+		case newOk:
+			// Moved in from a directory this device doesn't know.
+			n = fileCreateNotification(newPath, e.Writer, e.LocalTime)
+		case oldOk:
+			// Moved out to a directory this device doesn't know.
+			n = fileDeleteNotification(oldPath, e.Writer, e.LocalTime)
+		}
+	}
+	return n
+}
+
+// ChangeEvents implements the ChangeSubscriber interface for
+// changeEventReporter.
+func (r changeEventReporter) ChangeEvents(events []ChangeEvent) {
+	ctx := context.Background()
+	for _, e := range events {
+		if n := r.notification(e); n != nil {
+			r.config.Reporter().Notify(ctx, n)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+type notifyRecordingReporter struct {
+	*ReporterSimple
+	c chan *keybase1.FSNotification
+}
+
+func (r notifyRecordingReporter) Notify(
+	_ context.Context, n *keybase1.FSNotification) {
+	// Only keep the file edit notifications, and never block the
+	// caller.
+	switch n.NotificationType {
+	case keybase1.FSNotificationType_FILE_CREATED,
+		keybase1.FSNotificationType_FILE_MODIFIED,
+		keybase1.FSNotificationType_FILE_DELETED,
+		keybase1.FSNotificationType_FILE_RENAMED:
+		select {
+		case r.c <- n:
+		default:
+		}
+	}
+}
+
+func TestChangeEventReporter(t *testing.T) {
+	config, uid, ctx, cancel := kbfsOpsInitNoMocks(t, "alice")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+	reporter := notifyRecordingReporter{
+		NewReporterSimple(config.Clock(), 10),
+		make(chan *keybase1.FSNotification, 10),
+	}
+	config.SetReporter(reporter)
+	config.KBFSOps().(*KBFSOpsStandard).EnableChangeNotifications()
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "alice", false)
+	kbfsOps := config.KBFSOps()
+	fileNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+	require.NoError(t, kbfsOps.Write(ctx, fileNode, []byte{1, 2, 3}, 0))
+	require.NoError(t, kbfsOps.Sync(ctx, fileNode))
+	require.NoError(t, kbfsOps.Rename(ctx, rootNode, "a", rootNode, "b"))
+	require.NoError(t, kbfsOps.RemoveEntry(ctx, rootNode, "b"))
+
+	expected := []struct {
+		nType    keybase1.FSNotificationType
+		filename string
+	}{
+		{keybase1.FSNotificationType_FILE_CREATED, "/keybase/private/alice/a"},
+		{keybase1.FSNotificationType_FILE_MODIFIED, "/keybase/private/alice/a"},
+		{keybase1.FSNotificationType_FILE_RENAMED, "/keybase/private/alice/b"},
+		{keybase1.FSNotificationType_FILE_DELETED, "/keybase/private/alice/b"},
+	}
+	for _, e := range expected {
+		select {
+		case n := <-reporter.c:
+			require.Equal(t, e.nType, n.NotificationType)
+			require.Equal(t, e.filename, n.Filename)
+			require.Equal(t, uid, n.WriterUid)
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	stdpath "path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/pkg/errors"
+)
+
+// ChangeEventType says what kind of change a ChangeEvent describes.
+type ChangeEventType int
+
+const (
+	// ChangeEventCreate means an entry was created in a directory.
+	ChangeEventCreate ChangeEventType = iota
+	// ChangeEventWrite means a file's contents changed.
+	ChangeEventWrite
+	// ChangeEventRename means an entry was renamed or moved.
+	ChangeEventRename
+	// ChangeEventDelete means an entry was removed from a
+	// directory.
+	ChangeEventDelete
+	// ChangeEventAttr means an entry's attributes (e.g., its
+	// mtime or exec bit) changed.
+	ChangeEventAttr
+)
+
+func (t ChangeEventType) String() string {
+	switch t {
+	case ChangeEventCreate:
+		return "create"
+	case ChangeEventWrite:
+		return "write"
+	case ChangeEventRename:
+		return "rename"
+	case ChangeEventDelete:
+		return "delete"
+	case ChangeEventAttr:
+		return "attr"
+	default:
+		return fmt.Sprintf("ChangeEventType(%d)", int(t))
+	}
+}
+
+// ChangeEvent describes a single change to a TLF, made either by
+// this device or by another one.
+type ChangeEvent struct {
+	Type ChangeEventType
+	// Dir is the directory holding the changed entry, and Name is
+	// the entry's name in it.  For renames, they are the old
+	// directory and name, and Dir is nil if the old directory
+	// isn't known to this device.  For writes, Dir is nil.
+	Dir  Node
+	Name string
+	// NewDir and NewName are the new directory and name of a
+	// renamed entry.  NewDir is nil if the new directory isn't
+	// known to this device.
+	NewDir  Node
+	NewName string
+	// Entry is the changed file or directory itself, if known to
+	// this device.  It is always set for writes.
+	Entry Node
+	// Writes are the ranges written, for writes.
+	Writes []WriteRange
+	// Path is the slash-separated path of the changed entry,
+	// relative to the root of the TLF (e.g., "src/main.go"), and
+	// NewPath is its new path, for renames.  Either is empty if
+	// the corresponding directory isn't known to this device.
+	Path    string
+	NewPath string
+	// Writer is the user who made the change, and LocalTime is
+	// when the revision containing it was made, by the local
+	// clock.
+	Writer    keybase1.UID
+	LocalTime time.Time
+}
+
+// setChangeEventPaths fills in the Path and NewPath of each event.
+func setChangeEventPaths(nc NodeCache, events []ChangeEvent) {
+	for i, e := range events {
+		switch {
+		case e.Dir != nil:
+			events[i].Path = changeEventPath(nc, e.Dir, e.Name)
+		case e.Type == ChangeEventWrite:
+			events[i].Path = changeEventPath(nc, e.Entry, "")
+		}
+		if e.Type == ChangeEventRename {
+			events[i].NewPath = changeEventPath(nc, e.NewDir, e.NewName)
+		}
+	}
+}
+
+// ChangeFilter limits a subscription made via
+// KBFSOps.SubscribeToFilteredChanges to the events whose Path or
+// NewPath matches it.  The zero ChangeFilter matches everything.
+type ChangeFilter struct {
+	// Dir, if non-empty, is the slash-separated path of a
+	// directory relative to the root of the TLF (e.g., "src/lib").
+	// Only changes to entries anywhere under it are matched.
+	Dir string
+	// Pattern, if non-empty, is a glob in the syntax accepted by
+	// path.Match.  If it contains a slash, it is matched against
+	// the whole path of an entry relative to Dir (or to the root
+	// of the TLF); otherwise it is matched against just the
+	// entry's name, so that "*.go" matches Go files at any depth.
+	Pattern string
+}
+
+// normalize returns a copy of f with a cleaned-up Dir, or an error
+// if Pattern is malformed.
+func (f ChangeFilter) normalize() (ChangeFilter, error) {
+	if f.Dir != "" {
+		f.Dir = strings.Trim(stdpath.Clean("/"+f.Dir), "/")
+	}
+	if f.Pattern != "" {
+		if _, err := stdpath.Match(f.Pattern, ""); err != nil {
+			return ChangeFilter{}, errors.Wrapf(
+				err, "Bad change filter pattern %q", f.Pattern)
+		}
+	}
+	return f, nil
+}
+
+// matchesPath returns whether p, a path relative to the root of the
+// TLF, matches f.  f must be normalized.
+func (f ChangeFilter) matchesPath(p string) bool {
+	if p == "" {
+		return false
+	}
+	if f.Dir != "" {
+		if !strings.HasPrefix(p, f.Dir+"/") {
+			return false
+		}
+		p = p[len(f.Dir)+1:]
+	}
+	if f.Pattern == "" {
+		return true
+	}
+	if !strings.Contains(f.Pattern, "/") {
+		p = stdpath.Base(p)
+	}
+	// The pattern was checked by normalize.
+	matched, _ := stdpath.Match(f.Pattern, p)
+	return matched
+}
+
+func (f ChangeFilter) matches(e ChangeEvent) bool {
+	return f.matchesPath(e.Path) || f.matchesPath(e.NewPath)
+}
+
+// changeEventPath returns the path of the entry called name in dir
+// (or of dir itself, if name is empty), relative to the root of the
+// TLF, or the empty string if dir is nil or no longer in nc.
+func changeEventPath(nc NodeCache, dir Node, name string) string {
+	if dir == nil {
+		return ""
+	}
+	p := nc.PathFromNode(dir)
+	if !p.isValid() {
+		return ""
+	}
+	names := make([]string, 0, len(p.path))
+	for _, pn := range p.path[1:] {
+		names = append(names, pn.Name)
+	}
+	return stdpath.Join(append(names, name)...)
+}
+
+// ChangeSubscriber gets batches of ChangeEvents for the nodes or TLFs
+// it subscribed to via KBFSOps.SubscribeToChanges.  ChangeEvents is
+// called from its own goroutine, one batch at a time, so it may
+// block and make KBFSOps calls; but Nodes in the events should not
+// be held past the end of the call.
+type ChangeSubscriber interface {
+	ChangeEvents(events []ChangeEvent)
+}
+
+// changeEventBatchDelay is how long events are collected before
+// being delivered to subscribers, so that a burst of changes (e.g.,
+// from a large sync or an untar) arrives as a single batch.
+const changeEventBatchDelay = 100 * time.Millisecond
+
+type changeSubscription struct {
+	subscriber ChangeSubscriber
+	// nodeID is nil for subscriptions to the whole TLF.
+	nodeID NodeID
+	// filter is nil for subscriptions without path filtering.
+	filter *ChangeFilter
+}
+
+func (s changeSubscription) matches(e ChangeEvent) bool {
+	if s.filter != nil {
+		return s.filter.matches(e)
+	}
+	if s.nodeID == nil {
+		return true
+	}
+	for _, n := range []Node{e.Dir, e.NewDir, e.Entry} {
+		if n != nil && n.GetID() == s.nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// changeSubscriptions keeps track of the ChangeSubscribers for a
+// single folder-branch, and batches up the events for each of them.
+type changeSubscriptions struct {
+	delay time.Duration
+
+	lock    sync.Mutex
+	subs    []changeSubscription
+	pending map[ChangeSubscriber][]ChangeEvent
+	order   []ChangeSubscriber
+	timer   *time.Timer
+
+	// deliverLock makes sure batches are delivered one at a time,
+	// in order.
+	deliverLock sync.Mutex
+}
+
+func newChangeSubscriptions(delay time.Duration) *changeSubscriptions {
+	return &changeSubscriptions{
+		delay:   delay,
+		pending: make(map[ChangeSubscriber][]ChangeEvent),
+	}
+}
+
+// subscribe adds a subscription for node, or for the whole TLF if
+// node is nil.
+func (cs *changeSubscriptions) subscribe(
+	node Node, subscriber ChangeSubscriber) {
+	var nodeID NodeID
+	if node != nil {
+		nodeID = node.GetID()
+	}
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cs.subs = append(cs.subs, changeSubscription{subscriber, nodeID, nil})
+}
+
+// subscribeFiltered adds a subscription for the events matching
+// filter, which must be normalized.
+func (cs *changeSubscriptions) subscribeFiltered(
+	filter ChangeFilter, subscriber ChangeSubscriber) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cs.subs = append(cs.subs, changeSubscription{subscriber, nil, &filter})
+}
+
+// unsubscribe removes all of subscriber's subscriptions, and drops
+// any events not yet delivered to it.
+func (cs *changeSubscriptions) unsubscribe(subscriber ChangeSubscriber) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	subs := cs.subs[:0]
+	for _, s := range cs.subs {
+		if s.subscriber != subscriber {
+			subs = append(subs, s)
+		}
+	}
+	cs.subs = subs
+	if _, ok := cs.pending[subscriber]; ok {
+		delete(cs.pending, subscriber)
+		order := cs.order[:0]
+		for _, o := range cs.order {
+			if o != subscriber {
+				order = append(order, o)
+			}
+		}
+		cs.order = order
+	}
+}
+
+// hasSubscribers returns whether there are any subscriptions at
+// all, so callers can skip building events nobody will see.
+func (cs *changeSubscriptions) hasSubscribers() bool {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	return len(cs.subs) > 0
+}
+
+// notify queues up the given events for every subscriber they
+// match, to be delivered once the batch delay passes.  It never
+// blocks on subscribers, so it's safe to call while holding fbo
+// locks.
+func (cs *changeSubscriptions) notify(events []ChangeEvent) {
+	if len(events) == 0 {
+		return
+	}
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	for _, e := range events {
+		// A subscriber with several matching subscriptions
+		// should only see each event once.
+		matched := make(map[ChangeSubscriber]bool)
+		for _, s := range cs.subs {
+			if matched[s.subscriber] || !s.matches(e) {
+				continue
+			}
+			matched[s.subscriber] = true
+			if _, ok := cs.pending[s.subscriber]; !ok {
+				cs.order = append(cs.order, s.subscriber)
+			}
+			cs.pending[s.subscriber] = append(cs.pending[s.subscriber], e)
+		}
+	}
+	if len(cs.order) > 0 && cs.timer == nil {
+		cs.timer = time.AfterFunc(cs.delay, cs.deliver)
+	}
+}
+
+func (cs *changeSubscriptions) deliver() {
+	cs.deliverLock.Lock()
+	defer cs.deliverLock.Unlock()
+
+	cs.lock.Lock()
+	pending, order := cs.pending, cs.order
+	cs.pending = make(map[ChangeSubscriber][]ChangeEvent)
+	cs.order = nil
+	cs.timer = nil
+	cs.lock.Unlock()
+
+	for _, subscriber := range order {
+		subscriber.ChangeEvents(pending[subscriber])
+	}
+}
+
+// shutdown stops any pending delivery.
+func (cs *changeSubscriptions) shutdown() {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if cs.timer != nil {
+		cs.timer.Stop()
+		cs.timer = nil
+	}
+	cs.subs = nil
+	cs.pending = make(map[ChangeSubscriber][]ChangeEvent)
+	cs.order = nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testChangeSubscriber struct {
+	c chan []ChangeEvent
+}
+
+func (s testChangeSubscriber) ChangeEvents(events []ChangeEvent) {
+	s.c <- events
+}
+
+func TestChangeSubscriptionsBatching(t *testing.T) {
+	cs := newChangeSubscriptions(time.Hour)
+	all := testChangeSubscriber{make(chan []ChangeEvent, 1)}
+	cs.subscribe(nil, all)
+
+	cs.notify([]ChangeEvent{{Type: ChangeEventCreate, Name: "a"}})
+	cs.notify([]ChangeEvent{{Type: ChangeEventDelete, Name: "b"}})
+	cs.deliver()
+	events := <-all.c
+	require.Len(t, events, 2)
+	require.Equal(t, ChangeEventCreate, events[0].Type)
+	require.Equal(t, ChangeEventDelete, events[1].Type)
+
+	// Nothing is delivered after unsubscribing.
+	cs.notify([]ChangeEvent{{Type: ChangeEventCreate, Name: "c"}})
+	cs.unsubscribe(all)
+	cs.deliver()
+	select {
+	case events := <-all.c:
+		t.Fatalf("Unexpected events after unsubscribing: %v", events)
+	default:
+	}
+	cs.shutdown()
+}
+
+func TestSubscribeToChanges(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "alice", false)
+	kbfsOps := config.KBFSOps()
+	fb := rootNode.GetFolderBranch()
+
+	dirNode, _, err := kbfsOps.CreateDir(ctx, rootNode, "dir")
+	require.NoError(t, err)
+
+	all := testChangeSubscriber{make(chan []ChangeEvent, 10)}
+	inDir := testChangeSubscriber{make(chan []ChangeEvent, 10)}
+	require.NoError(t, kbfsOps.SubscribeToChanges(ctx, fb, nil, all))
+	require.NoError(t, kbfsOps.SubscribeToChanges(ctx, fb, dirNode, inDir))
+
+	fileNode, _, err := kbfsOps.CreateFile(ctx, dirNode, "a", false, NoExcl)
+	require.NoError(t, err)
+	require.NoError(t, kbfsOps.Write(ctx, fileNode, []byte{1, 2, 3}, 0))
+	require.NoError(t, kbfsOps.Sync(ctx, fileNode))
+	require.NoError(t, kbfsOps.SetEx(ctx, fileNode, true))
+	require.NoError(t, kbfsOps.Rename(ctx, dirNode, "a", rootNode, "b"))
+	_, _, err = kbfsOps.CreateFile(ctx, rootNode, "c", false, NoExcl)
+	require.NoError(t, err)
+	require.NoError(t, kbfsOps.RemoveEntry(ctx, rootNode, "c"))
+
+	getEvents := func(s testChangeSubscriber, n int) (types []ChangeEventType) {
+		for len(types) < n {
+			select {
+			case events := <-s.c:
+				for _, e := range events {
+					types = append(types, e.Type)
+				}
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			}
+		}
+		return types
+	}
+	require.Equal(t, []ChangeEventType{
+		ChangeEventCreate, ChangeEventWrite, ChangeEventAttr,
+		ChangeEventRename, ChangeEventCreate, ChangeEventDelete,
+	}, getEvents(all, 6))
+	// The subscriber to dir doesn't hear about "c".
+	require.Equal(t, []ChangeEventType{
+		ChangeEventCreate, ChangeEventAttr, ChangeEventRename,
+	}, getEvents(inDir, 3))
+
+	require.NoError(t, kbfsOps.UnsubscribeFromChanges(ctx, fb, all))
+	require.NoError(t, kbfsOps.UnsubscribeFromChanges(ctx, fb, inDir))
+}
+
+func TestChangeFilterMatches(t *testing.T) {
+	_, err := ChangeFilter{Pattern: "[a-"}.normalize()
+	require.Error(t, err)
+
+	f, err := ChangeFilter{Dir: "/src/lib/", Pattern: "*.go"}.normalize()
+	require.NoError(t, err)
+	require.Equal(t, "src/lib", f.Dir)
+	require.True(t, f.matchesPath("src/lib/a.go"))
+	require.True(t, f.matchesPath("src/lib/x/y/b.go"))
+	require.False(t, f.matchesPath("src/lib/a.c"))
+	require.False(t, f.matchesPath("src/library/a.go"))
+	require.False(t, f.matchesPath("src/lib"))
+	require.False(t, f.matchesPath(""))
+
+	f, err = ChangeFilter{Pattern: "docs/*.md"}.normalize()
+	require.NoError(t, err)
+	require.True(t, f.matchesPath("docs/a.md"))
+	require.False(t, f.matchesPath("docs/x/a.md"))
+	require.False(t, f.matchesPath("a.md"))
+
+	// A rename matches if either of its paths does.
+	f, err = ChangeFilter{Dir: "out"}.normalize()
+	require.NoError(t, err)
+	require.True(t, f.matches(ChangeEvent{
+		Type: ChangeEventRename, Path: "tmp/a", NewPath: "out/a"}))
+	require.False(t, f.matches(ChangeEvent{
+		Type: ChangeEventRename, Path: "tmp/a", NewPath: "tmp/b"}))
+}
+
+func TestSubscribeToFilteredChanges(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "alice", false)
+	kbfsOps := config.KBFSOps()
+	fb := rootNode.GetFolderBranch()
+
+	inDir := testChangeSubscriber{make(chan []ChangeEvent, 10)}
+	goFiles := testChangeSubscriber{make(chan []ChangeEvent, 10)}
+	require.NoError(t, kbfsOps.SubscribeToFilteredChanges(
+		ctx, fb, ChangeFilter{Dir: "dir"}, inDir))
+	require.NoError(t, kbfsOps.SubscribeToFilteredChanges(
+		ctx, fb, ChangeFilter{Pattern: "*.go"}, goFiles))
+	require.Error(t, kbfsOps.SubscribeToFilteredChanges(
+		ctx, fb, ChangeFilter{Pattern: "["}, goFiles))
+
+	dirNode, _, err := kbfsOps.CreateDir(ctx, rootNode, "dir")
+	require.NoError(t, err)
+	subNode, _, err := kbfsOps.CreateDir(ctx, dirNode, "sub")
+	require.NoError(t, err)
+	fileNode, _, err := kbfsOps.CreateFile(ctx, subNode, "a.go", false, NoExcl)
+	require.NoError(t, err)
+	require.NoError(t, kbfsOps.Write(ctx, fileNode, []byte{1, 2, 3}, 0))
+	require.NoError(t, kbfsOps.Sync(ctx, fileNode))
+	_, _, err = kbfsOps.CreateFile(ctx, rootNode, "b.txt", false, NoExcl)
+	require.NoError(t, err)
+	require.NoError(t, kbfsOps.Rename(ctx, rootNode, "b.txt", rootNode, "b.go"))
+
+	getPaths := func(s testChangeSubscriber, n int) (paths []string) {
+		for len(paths) < n {
+			select {
+			case events := <-s.c:
+				for _, e := range events {
+					paths = append(paths, e.Path+">"+e.NewPath)
+				}
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			}
+		}
+		return paths
+	}
+	// "dir" itself isn't under "dir", and "b.txt" isn't either.
+	require.Equal(t, []string{
+		"dir/sub>", "dir/sub/a.go>", "dir/sub/a.go>",
+	}, getPaths(inDir, 3))
+	require.Equal(t, []string{
+		"dir/sub/a.go>", "dir/sub/a.go>", "b.txt>b.go",
+	}, getPaths(goFiles, 3))
+
+	require.NoError(t, kbfsOps.UnsubscribeFromChanges(ctx, fb, inDir))
+	require.NoError(t, kbfsOps.UnsubscribeFromChanges(ctx, fb, goFiles))
+}
@@ -5,6 +5,7 @@
 package libkbfs
 
 import (
+	"crypto/tls"
 	"sync"
 	"time"
 
@@ -40,6 +41,13 @@ const (
 	qrMinHeadAgeDefault = 5 * time.Minute
 	// tlfValidDurationDefault is the default for tlf validity before redoing identify.
 	tlfValidDurationDefault = 6 * time.Hour
+	// identityCacheTTLDefault is the default for how long the
+	// results of user lookups are cached.
+	identityCacheTTLDefault = 1 * time.Hour
+	// notificationDebounceDefault is the default for how long
+	// notifications of remote changes are held back when running
+	// for real. ConfigLocal itself doesn't debounce by default.
+	notificationDebounceDefault = 200 * time.Millisecond
 )
 
 // ConfigLocal implements the Config interface using purely local
@@ -49,6 +57,7 @@ type ConfigLocal struct {
 	kbfs        KBFSOps
 	keyman      KeyManager
 	rep         Reporter
+	alerter     UserAlerter
 	kcache      KeyCache
 	kbcache     KeyBundleCache
 	bcache      BlockCache
@@ -89,8 +98,63 @@ type ConfigLocal struct {
 	// tlfValidDuration is the time TLFs are valid before redoing identification.
 	tlfValidDuration time.Duration
 
+	// identityCacheTTL is how long the results of user lookups
+	// are cached.
+	identityCacheTTL time.Duration
+
+	// notificationDebounce is how long remote changes are
+	// collected before observers are notified of them.
+	notificationDebounce time.Duration
+
 	// metadataVersion is the version to use when creating new metadata.
 	metadataVersion MetadataVer
+
+	// blockCompression is the compression to apply to new blocks.
+	blockCompression BlockCompressionType
+
+	// publicBlocksUnencrypted is whether new blocks of public
+	// TLFs are left unencrypted.
+	publicBlocksUnencrypted bool
+
+	// maxParallelBlockPuts is the maximum number of blocks to
+	// send to the block server at once.
+	maxParallelBlockPuts int
+
+	// blockRetryPolicy is how to retry failed remote block
+	// operations.
+	blockRetryPolicy BlockRetryPolicy
+
+	// blockBandwidthLimits caps the rate of traffic to and from
+	// a remote block server.
+	blockBandwidthLimits BlockBandwidthLimits
+
+	// serverTLSConfig, if non-nil, is used for connections to
+	// remote servers.
+	serverTLSConfig *tls.Config
+
+	// readAhead is how far ahead of file reads to prefetch.
+	readAhead ReadAheadConfig
+
+	// cacheLimits is used whenever the caches are reset.
+	cacheLimits CacheLimits
+	// journalLimits is used whenever journaling is enabled.
+	journalLimits JournalLimits
+
+	// transfers tracks block transfer progress for the
+	// BlockTransferObserver.
+	transfers *blockTransferTracker
+
+	// syncCache, if non-nil, keeps the blocks of TLFs synced to
+	// this device on disk.
+	syncCache *tlfSyncCache
+
+	// activityLog, if non-nil, logs the operations in every
+	// revision of every loaded TLF on disk.
+	activityLog *tlfActivityLog
+
+	// debugServer, if non-nil, serves profiling and status
+	// information over HTTP.
+	debugServer *debugServer
 }
 
 var _ Config = (*ConfigLocal)(nil)
@@ -182,27 +246,22 @@ func MakeLocalUserCryptPublicKeyOrBust(
 }
 
 // MakeLocalUsers is a helper function to generate a list of
-// LocalUsers suitable to use with KBPKILocal.
+// LocalUsers suitable to use with KBPKILocal. Use a
+// LocalUserFixture for users with more than one device.
 func MakeLocalUsers(users []libkb.NormalizedUsername) []LocalUser {
-	localUsers := make([]LocalUser, len(users))
-	for i := 0; i < len(users); i++ {
-		verifyingKey := MakeLocalUserVerifyingKeyOrBust(users[i])
-		cryptPublicKey := MakeLocalUserCryptPublicKeyOrBust(users[i])
-		localUsers[i] = LocalUser{
-			UserInfo: UserInfo{
-				Name:            users[i],
-				UID:             keybase1.MakeTestUID(uint32(i + 1)),
-				VerifyingKeys:   []kbfscrypto.VerifyingKey{verifyingKey},
-				CryptPublicKeys: []kbfscrypto.CryptPublicKey{cryptPublicKey},
-				KIDNames: map[keybase1.KID]string{
-					verifyingKey.KID(): "dev1",
-				},
-			},
-			CurrentCryptPublicKeyIndex: 0,
-			CurrentVerifyingKeyIndex:   0,
-		}
+	f := NewLocalUserFixture()
+	for _, name := range users {
+		f.AddUser(name)
 	}
-	return localUsers
+	return f.Users()
+}
+
+// MakeLocalUsersFromSpecs is like MakeLocalUsers, but also fills in
+// the assertions for each user from the given specs.
+func MakeLocalUsersFromSpecs(specs []LocalUserSpec) []LocalUser {
+	f := NewLocalUserFixture()
+	f.AddUsersFromSpecs(specs)
+	return f.Users()
 }
 
 // getDefaultCleanBlockCacheCapacity returns the default clean block cache
@@ -233,6 +292,7 @@ func NewConfigLocal(loggerFn func(module string) logger.Logger) *ConfigLocal {
 	}
 	config.SetClock(wallClock{})
 	config.SetReporter(NewReporterSimple(config.Clock(), 10))
+	config.SetUserAlerter(NewUserAlerterLog(config.MakeLogger("ALR")))
 	config.SetConflictRenamer(WriterDeviceDateConflictRenamer{config})
 	config.ResetCaches()
 	config.SetCodec(kbfscodec.NewMsgpack())
@@ -255,7 +315,14 @@ func NewConfigLocal(loggerFn func(module string) logger.Logger) *ConfigLocal {
 	}
 
 	config.tlfValidDuration = tlfValidDurationDefault
+	config.identityCacheTTL = identityCacheTTLDefault
 	config.metadataVersion = defaultClientMetadataVer
+	config.maxParallelBlockPuts = maxParallelBlockPuts
+	config.blockRetryPolicy = DefaultBlockRetryPolicy()
+	config.readAhead = DefaultReadAheadConfig()
+	config.cacheLimits = DefaultCacheLimits()
+	config.journalLimits = DefaultJournalLimits()
+	config.transfers = newBlockTransferTracker()
 
 	return config
 }
@@ -323,6 +390,20 @@ func (c *ConfigLocal) SetReporter(r Reporter) {
 	c.rep = r
 }
 
+// UserAlerter implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) UserAlerter() UserAlerter {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.alerter
+}
+
+// SetUserAlerter implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetUserAlerter(u UserAlerter) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.alerter = u
+}
+
 // KeyCache implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) KeyCache() KeyCache {
 	c.lock.RLock()
@@ -599,7 +680,7 @@ func (c *ConfigLocal) SetMetadataVersion(mdVer MetadataVer) {
 
 // DataVersion implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) DataVersion() DataVer {
-	return AtLeastTwoLevelsOfChildrenDataVer
+	return CompressedBlocksDataVer
 }
 
 // DoBackgroundFlushes implements the Config interface for ConfigLocal.
@@ -675,7 +756,15 @@ func (c *ConfigLocal) MaxDirBytes() uint64 {
 func (c *ConfigLocal) resetCachesWithoutShutdown() DirtyBlockCache {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	c.mdcache = NewMDCacheStandard(defaultMDCacheCapacity)
+	limits := c.cacheLimits
+	if limits.BlockCacheEntries <= 0 {
+		limits.BlockCacheEntries = defaultBlockCacheEntries
+	}
+	if limits.MDCacheEntries <= 0 {
+		limits.MDCacheEntries = defaultMDCacheCapacity
+	}
+	c.mdcache = NewMDCacheStandardWithPolicy(
+		limits.MDCacheEntries, limits.Policy)
 	c.kcache = NewKeyCacheStandard(defaultMDCacheCapacity)
 	c.kbcache = NewKeyBundleCacheStandard(defaultMDCacheCapacity * 2)
 
@@ -690,7 +779,8 @@ func (c *ConfigLocal) resetCachesWithoutShutdown() DirtyBlockCache {
 		log.Debug("setting clean block cache capacity based on existing value %d",
 			capacity)
 	}
-	c.bcache = NewBlockCacheStandard(10000, capacity)
+	c.bcache = NewBlockCacheStandardWithPolicy(
+		limits.BlockCacheEntries, capacity, limits.Policy)
 
 	oldDirtyBcache := c.dirtyBcache
 
@@ -707,8 +797,16 @@ func (c *ConfigLocal) resetCachesWithoutShutdown() DirtyBlockCache {
 
 	// The maximum number of bytes we can try to sync at once (also limits the
 	// amount of memory used by dirty blocks). We use the same value from clean
-	// block cache capacity here.
+	// block cache capacity here, unless the dirty bytes are capped
+	// explicitly. The dirty block cache accepts writes until about
+	// twice this many bytes are dirty.
 	maxSyncBufferSize := int64(capacity)
+	if limits.DirtyBytes > 0 {
+		maxSyncBufferSize = limits.DirtyBytes / 2
+		if maxSyncBufferSize < minSyncBufferSize {
+			maxSyncBufferSize = minSyncBufferSize
+		}
+	}
 
 	// Start off conservatively to avoid getting immediate timeouts on
 	// slow connections.
@@ -770,16 +868,243 @@ func (c *ConfigLocal) SetMetricsRegistry(r metrics.Registry) {
 	c.registry = r
 }
 
+// BlockCompression implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) BlockCompression() BlockCompressionType {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.blockCompression
+}
+
+// SetBlockCompression implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetBlockCompression(compression BlockCompressionType) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.blockCompression = compression
+}
+
+// PublicBlocksUnencrypted implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) PublicBlocksUnencrypted() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.publicBlocksUnencrypted
+}
+
+// SetPublicBlocksUnencrypted implements the Config interface for
+// ConfigLocal.
+func (c *ConfigLocal) SetPublicBlocksUnencrypted(unencrypted bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.publicBlocksUnencrypted = unencrypted
+}
+
+// BlockRetryPolicy implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) BlockRetryPolicy() BlockRetryPolicy {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.blockRetryPolicy
+}
+
+// SetBlockRetryPolicy implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetBlockRetryPolicy(policy BlockRetryPolicy) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.blockRetryPolicy = policy
+}
+
+// BlockBandwidthLimits implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) BlockBandwidthLimits() BlockBandwidthLimits {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.blockBandwidthLimits
+}
+
+// SetBlockBandwidthLimits implements the Config interface for
+// ConfigLocal.
+func (c *ConfigLocal) SetBlockBandwidthLimits(limits BlockBandwidthLimits) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.blockBandwidthLimits = limits
+}
+
+// ServerTLSConfig implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) ServerTLSConfig() *tls.Config {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.serverTLSConfig
+}
+
+// SetServerTLSConfig implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetServerTLSConfig(tlsConfig *tls.Config) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.serverTLSConfig = tlsConfig
+}
+
+// ReadAhead implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) ReadAhead() ReadAheadConfig {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.readAhead
+}
+
+// SetReadAhead implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetReadAhead(readAhead ReadAheadConfig) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.readAhead = readAhead
+}
+
+// CacheLimits implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) CacheLimits() CacheLimits {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cacheLimits
+}
+
+// SetCacheLimits implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetCacheLimits(limits CacheLimits) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cacheLimits = limits
+}
+
+// JournalLimits implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) JournalLimits() JournalLimits {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.journalLimits
+}
+
+// SetJournalLimits implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetJournalLimits(limits JournalLimits) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.journalLimits = limits
+}
+
+// BlockTransferObserver implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) BlockTransferObserver() BlockTransferObserver {
+	return c.transfers.getObserver()
+}
+
+// SetBlockTransferObserver implements the Config interface for
+// ConfigLocal.
+func (c *ConfigLocal) SetBlockTransferObserver(o BlockTransferObserver) {
+	c.transfers.setObserver(o)
+}
+
+func (c *ConfigLocal) blockTransferTracker() *blockTransferTracker {
+	return c.transfers
+}
+
+func (c *ConfigLocal) tlfSyncCache() *tlfSyncCache {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.syncCache
+}
+
+// EnableTlfSync allows TLFs to be synced to this device (see
+// KBFSOps.SetTlfSyncMode), keeping their blocks under the given
+// directory. Any TLFs synced by a previous run stay synced.
+func (c *ConfigLocal) EnableTlfSync(syncRoot string) error {
+	syncCache, err := makeTlfSyncCache(
+		c.Codec(), c.MakeLogger("TSC"), syncRoot)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.syncCache != nil {
+		return errors.New("Trying to enable TLF syncing twice")
+	}
+	c.syncCache = syncCache
+	return nil
+}
+
+func (c *ConfigLocal) tlfActivityLog() *tlfActivityLog {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.activityLog
+}
+
+// EnableTlfActivityLog makes every TLF loaded from now on log the
+// operations in each of its revisions (see KBFSOps.GetActivityLog)
+// under the given directory. Logs from previous runs are kept.
+func (c *ConfigLocal) EnableTlfActivityLog(activityRoot string) error {
+	activityLog, err := makeTlfActivityLog(c, c.MakeLogger("TAL"),
+		activityRoot, tlfActivityLogMaxEntries)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.activityLog != nil {
+		activityLog.shutdown()
+		return errors.New("Trying to enable the TLF activity log twice")
+	}
+	c.activityLog = activityLog
+	return nil
+}
+
+// MaxParallelBlockPuts implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) MaxParallelBlockPuts() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.maxParallelBlockPuts
+}
+
+// SetMaxParallelBlockPuts implements the Config interface for
+// ConfigLocal.
+func (c *ConfigLocal) SetMaxParallelBlockPuts(n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.maxParallelBlockPuts = n
+}
+
 // SetTLFValidDuration implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) SetTLFValidDuration(r time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	c.tlfValidDuration = r
 }
 
 // TLFValidDuration implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) TLFValidDuration() time.Duration {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.tlfValidDuration
 }
 
+// SetIdentityCacheTTL implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) SetIdentityCacheTTL(ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.identityCacheTTL = ttl
+}
+
+// IdentityCacheTTL implements the Config interface for ConfigLocal.
+func (c *ConfigLocal) IdentityCacheTTL() time.Duration {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.identityCacheTTL
+}
+
+// SetNotificationDebounce implements the Config interface for
+// ConfigLocal.
+func (c *ConfigLocal) SetNotificationDebounce(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.notificationDebounce = d
+}
+
+// NotificationDebounce implements the Config interface for
+// ConfigLocal.
+func (c *ConfigLocal) NotificationDebounce() time.Duration {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.notificationDebounce
+}
+
 // Shutdown implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) Shutdown(ctx context.Context) error {
 	c.RekeyQueue().Clear()
@@ -823,6 +1148,9 @@ func (c *ConfigLocal) Shutdown(ctx context.Context) error {
 	}
 
 	var errorList []error
+	// Finish logging activity while the folders can still fetch
+	// the blocks needed to describe their revisions.
+	c.tlfActivityLog().shutdown()
 	err := c.KBFSOps().Shutdown(ctx)
 	if err != nil {
 		errorList = append(errorList, err)
@@ -835,6 +1163,12 @@ func (c *ConfigLocal) Shutdown(ctx context.Context) error {
 	c.BlockServer().Shutdown(ctx)
 	c.Crypto().Shutdown()
 	c.Reporter().Shutdown()
+	if c.debugServer != nil {
+		err = c.debugServer.Shutdown(ctx)
+		if err != nil {
+			errorList = append(errorList, err)
+		}
+	}
 	err = c.DirtyBlockCache().Shutdown()
 	if err != nil {
 		errorList = append(errorList, err)
@@ -851,6 +1185,12 @@ func (c *ConfigLocal) Shutdown(ctx context.Context) error {
 
 // CheckStateOnShutdown implements the Config interface for ConfigLocal.
 func (c *ConfigLocal) CheckStateOnShutdown() bool {
+	// The state check looks at every config made by a test, and
+	// there are none outside of tests, even with a local MD server
+	// (e.g., -mdserver=memory).
+	if c.allKnownConfigsForTesting == nil {
+		return false
+	}
 	if md, ok := c.MDServer().(mdServerLocal); ok {
 		return !md.isShutdown()
 	}
@@ -912,20 +1252,17 @@ func (c *ConfigLocal) EnableJournaling(
 
 	const backpressureMinThreshold = 0.5
 	const backpressureMaxThreshold = 0.95
-	// Cap journal usage to a quarter of the free space.
-	const journalByteLimitFrac = 0.25
-	// Set the absolute journal byte limit to 50 GiB for now.
-	const journalByteLimit int64 = 50 * 1024 * 1024 * 1024
+	limits := c.JournalLimits()
 	// TODO: Also limit the inode count.
 	bdl, err := newBackpressureDiskLimiter(
 		log, backpressureMinThreshold, backpressureMaxThreshold,
-		journalByteLimitFrac, journalByteLimit,
+		limits.ByteLimitFrac, limits.ByteLimit,
 		defaultDiskLimitMaxDelay, journalRoot)
 	if err != nil {
 		return err
 	}
 
-	log.Debug("Setting journal byte limit to %v", journalByteLimit)
+	log.Debug("Setting journal limits to %+v", limits)
 	jServer = makeJournalServer(c, log, journalRoot, c.BlockCache(),
 		c.DirtyBlockCache(), c.BlockServer(), c.MDOps(), branchListener,
 		flushListener, bdl)
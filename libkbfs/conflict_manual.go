@@ -0,0 +1,247 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	stdpath "path"
+	"regexp"
+	"sort"
+
+	"golang.org/x/net/context"
+)
+
+// ConflictChoice says which version of a conflicted file to keep
+// when resolving a conflict by hand.
+type ConflictChoice int
+
+const (
+	// ConflictKeepLocal keeps the version in the conflicted copy,
+	// i.e. the one written by the device named in the copy's
+	// name, and moves it over the original name.
+	ConflictKeepLocal ConflictChoice = iota
+	// ConflictKeepRemote keeps the version under the original
+	// name, and removes the conflicted copy.
+	ConflictKeepRemote
+	// ConflictKeepBoth keeps both versions, renaming the
+	// conflicted copy so that it is no longer listed as a
+	// conflict.
+	ConflictKeepBoth
+)
+
+func (c ConflictChoice) String() string {
+	switch c {
+	case ConflictKeepLocal:
+		return "local"
+	case ConflictKeepRemote:
+		return "remote"
+	case ConflictKeepBoth:
+		return "both"
+	default:
+		return fmt.Sprintf("ConflictChoice(%d)", int(c))
+	}
+}
+
+// ParseConflictChoice parses "local", "remote" or "both" into a
+// ConflictChoice.
+func ParseConflictChoice(s string) (ConflictChoice, error) {
+	switch s {
+	case "local":
+		return ConflictKeepLocal, nil
+	case "remote":
+		return ConflictKeepRemote, nil
+	case "both":
+		return ConflictKeepBoth, nil
+	default:
+		return 0, fmt.Errorf(
+			"unknown conflict choice %q (want local, remote or both)", s)
+	}
+}
+
+// conflictedCopyRegexp matches the names made by
+// WriterDeviceDateConflictRenamer.ConflictRenameHelper.  Usernames
+// can't contain an apostrophe, so the first one ends the writer.
+var conflictedCopyRegexp = regexp.MustCompile(
+	`^(.*) \(conflicted copy from ([^']+)'s (.+) on ` +
+		`(\d{4}-\d{2}-\d{2})\)(.*)$`)
+
+// ParseConflictedCopyName undoes
+// WriterDeviceDateConflictRenamer.ConflictRenameHelper, returning
+// the original name along with the writer, device and date that
+// were encoded into the conflicted copy's name.  ok is false if
+// name is not a conflicted copy.
+func ParseConflictedCopyName(name string) (
+	original, writer, device, date string, ok bool) {
+	m := conflictedCopyRegexp.FindStringSubmatch(name)
+	if m == nil {
+		return "", "", "", "", false
+	}
+	return m[1] + m[5], m[2], m[3], m[4], true
+}
+
+// UnresolvedConflict describes a conflicted copy that automatic
+// conflict resolution left next to the entry it conflicted with.
+type UnresolvedConflict struct {
+	// Dir is the directory holding both versions, and DirPath is
+	// its path relative to the directory passed to
+	// ListUnresolvedConflicts ("" for that directory itself).
+	Dir     Node
+	DirPath string
+	// Original is the name that kept the remote version, and Copy
+	// is the name of the conflicted copy holding the local one.
+	Original string
+	Copy     string
+	// Writer, Device and Date are parsed out of Copy.
+	Writer string
+	Device string
+	Date   string
+	// Local and Remote describe the two versions.
+	Local  EntryInfo
+	Remote EntryInfo
+}
+
+// OriginalPath returns the path of the remote version, relative to
+// the directory the conflict was listed from.
+func (c UnresolvedConflict) OriginalPath() string {
+	return stdpath.Join(c.DirPath, c.Original)
+}
+
+// CopyPath returns the path of the local version, relative to the
+// directory the conflict was listed from.
+func (c UnresolvedConflict) CopyPath() string {
+	return stdpath.Join(c.DirPath, c.Copy)
+}
+
+type conflictsByCopyPath []UnresolvedConflict
+
+func (c conflictsByCopyPath) Len() int      { return len(c) }
+func (c conflictsByCopyPath) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c conflictsByCopyPath) Less(i, j int) bool {
+	return c[i].CopyPath() < c[j].CopyPath()
+}
+
+// ListUnresolvedConflicts returns every conflicted copy under dir,
+// recursively, whose original entry still exists.  Conflicts are
+// sorted by the path of the copy.
+func ListUnresolvedConflicts(
+	ctx context.Context, kbfsOps KBFSOps, dir Node) (
+	[]UnresolvedConflict, error) {
+	var conflicts []UnresolvedConflict
+	err := listUnresolvedConflicts(ctx, kbfsOps, dir, "", &conflicts)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(conflictsByCopyPath(conflicts))
+	return conflicts, nil
+}
+
+func listUnresolvedConflicts(ctx context.Context, kbfsOps KBFSOps,
+	dir Node, dirPath string, conflicts *[]UnresolvedConflict) error {
+	children, err := kbfsOps.GetDirChildren(ctx, dir)
+	if err != nil {
+		return err
+	}
+	*conflicts = append(*conflicts, conflictsInChildren(dir, dirPath, children)...)
+	for name, ei := range children {
+		if ei.Type != Dir {
+			continue
+		}
+		child, _, err := kbfsOps.Lookup(ctx, dir, name)
+		if err != nil {
+			return err
+		}
+		err = listUnresolvedConflicts(
+			ctx, kbfsOps, child, stdpath.Join(dirPath, name), conflicts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// conflictsInChildren returns the conflicts among the given
+// children of dir.
+func conflictsInChildren(dir Node, dirPath string,
+	children map[string]EntryInfo) (conflicts []UnresolvedConflict) {
+	for name, ei := range children {
+		original, writer, device, date, ok := ParseConflictedCopyName(name)
+		if !ok {
+			continue
+		}
+		remote, ok := children[original]
+		if !ok {
+			continue
+		}
+		conflicts = append(conflicts, UnresolvedConflict{
+			Dir:      dir,
+			DirPath:  dirPath,
+			Original: original,
+			Copy:     name,
+			Writer:   writer,
+			Device:   device,
+			Date:     date,
+			Local:    ei,
+			Remote:   remote,
+		})
+	}
+	return conflicts
+}
+
+// UnresolvedConflictsForName returns the conflicts directly in dir
+// that involve name, either as the original or as the conflicted
+// copy.  Conflicts are sorted by the name of the copy.
+func UnresolvedConflictsForName(ctx context.Context, kbfsOps KBFSOps,
+	dir Node, name string) ([]UnresolvedConflict, error) {
+	children, err := kbfsOps.GetDirChildren(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []UnresolvedConflict
+	for _, c := range conflictsInChildren(dir, "", children) {
+		if c.Original == name || c.Copy == name {
+			conflicts = append(conflicts, c)
+		}
+	}
+	sort.Sort(conflictsByCopyPath(conflicts))
+	return conflicts, nil
+}
+
+// keptCopyName is the name a conflicted copy is given when both
+// versions are kept, like `notes (copy from alice's laptop on
+// 2017-01-02).txt`.
+func keptCopyName(c UnresolvedConflict) string {
+	base, ext := splitExtension(c.Original)
+	return fmt.Sprintf("%s (copy from %s's %s on %s)%s",
+		base, c.Writer, c.Device, c.Date, ext)
+}
+
+// ResolveConflict resolves c by keeping the version(s) named by
+// choice.  Keeping both versions fails with NameExistsError if the
+// name the copy would be renamed to is already taken.
+func ResolveConflict(ctx context.Context, kbfsOps KBFSOps,
+	c UnresolvedConflict, choice ConflictChoice) error {
+	switch choice {
+	case ConflictKeepLocal:
+		return kbfsOps.Rename(ctx, c.Dir, c.Copy, c.Dir, c.Original)
+	case ConflictKeepRemote:
+		if c.Local.Type == Dir {
+			return kbfsOps.RemoveDir(ctx, c.Dir, c.Copy)
+		}
+		return kbfsOps.RemoveEntry(ctx, c.Dir, c.Copy)
+	case ConflictKeepBoth:
+		newName := keptCopyName(c)
+		_, _, err := kbfsOps.Lookup(ctx, c.Dir, newName)
+		switch err.(type) {
+		case nil:
+			return NameExistsError{newName}
+		case NoSuchNameError:
+		default:
+			return err
+		}
+		return kbfsOps.Rename(ctx, c.Dir, c.Copy, c.Dir, newName)
+	default:
+		return fmt.Errorf("unknown conflict choice %s", choice)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConflictedCopyName(t *testing.T) {
+	var cr WriterDeviceDateConflictRenamer
+	date := time.Date(2017, 1, 2, 12, 0, 0, 0, time.UTC)
+	for _, original := range []string{
+		"notes.txt", "notes", "a.tar.gz", ".bashrc", "it's mine.txt",
+	} {
+		name := cr.ConflictRenameHelper(
+			date, "alice", "bob's laptop", original)
+		o, writer, device, d, ok := ParseConflictedCopyName(name)
+		require.True(t, ok, name)
+		require.Equal(t, original, o)
+		require.Equal(t, "alice", writer)
+		require.Equal(t, "bob's laptop", device)
+		require.Equal(t, "2017-01-02", d)
+	}
+
+	_, _, _, _, ok := ParseConflictedCopyName("notes.txt")
+	require.False(t, ok)
+}
+
+func TestResolveConflict(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "alice", false)
+	kbfsOps := config.KBFSOps()
+	var cr WriterDeviceDateConflictRenamer
+	date := time.Date(2017, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	makeConflict := func(original string) {
+		copyName := cr.ConflictRenameHelper(date, "alice", "dev", original)
+		for name, data := range map[string]string{
+			original: "remote", copyName: "local!",
+		} {
+			n, _, err := kbfsOps.CreateFile(
+				ctx, rootNode, name, false, NoExcl)
+			require.NoError(t, err)
+			require.NoError(t, kbfsOps.Write(ctx, n, []byte(data), 0))
+			require.NoError(t, kbfsOps.Sync(ctx, n))
+		}
+	}
+	makeConflict("a.txt")
+	makeConflict("b.txt")
+	makeConflict("c.txt")
+
+	conflicts, err := ListUnresolvedConflicts(ctx, kbfsOps, rootNode)
+	require.NoError(t, err)
+	require.Len(t, conflicts, 3)
+	for i, original := range []string{"a.txt", "b.txt", "c.txt"} {
+		require.Equal(t, original, conflicts[i].Original)
+		require.Equal(t, uint64(6), conflicts[i].Local.Size)
+		require.Equal(t, uint64(6), conflicts[i].Remote.Size)
+	}
+
+	require.NoError(t, ResolveConflict(
+		ctx, kbfsOps, conflicts[0], ConflictKeepLocal))
+	require.NoError(t, ResolveConflict(
+		ctx, kbfsOps, conflicts[1], ConflictKeepRemote))
+	require.NoError(t, ResolveConflict(
+		ctx, kbfsOps, conflicts[2], ConflictKeepBoth))
+
+	conflicts, err = ListUnresolvedConflicts(ctx, kbfsOps, rootNode)
+	require.NoError(t, err)
+	require.Len(t, conflicts, 0)
+
+	children, err := kbfsOps.GetDirChildren(ctx, rootNode)
+	require.NoError(t, err)
+	require.Len(t, children, 4)
+	read := func(name string) string {
+		n, _, err := kbfsOps.Lookup(ctx, rootNode, name)
+		require.NoError(t, err)
+		buf := make([]byte, 10)
+		nr, err := kbfsOps.Read(ctx, n, buf, 0)
+		require.NoError(t, err)
+		return string(buf[:nr])
+	}
+	require.Equal(t, "local!", read("a.txt"))
+	require.Equal(t, "remote", read("b.txt"))
+	require.Equal(t, "remote", read("c.txt"))
+	require.Equal(t, "local!",
+		read("c (copy from alice's dev on 2017-01-02).txt"))
+}
@@ -14,7 +14,8 @@ import (
 )
 
 // WriterDeviceDateConflictRenamer renames a file using
-// a username, device name, and date.
+// a username, device name, and date, like
+// `notes (conflicted copy from alice's laptop on 2017-01-02).txt`.
 type WriterDeviceDateConflictRenamer struct {
 	config Config
 }
@@ -42,7 +43,7 @@ func (WriterDeviceDateConflictRenamer) ConflictRenameHelper(t time.Time, user, d
 	}
 	base, ext := splitExtension(original)
 	date := t.Format("2006-01-02")
-	return fmt.Sprintf("%s.conflicted (%s's %s copy %s)%s",
+	return fmt.Sprintf("%s (conflicted copy from %s's %s on %s)%s",
 		base, user, device, date, ext)
 }
 
@@ -1915,8 +1915,9 @@ func collapseActions(unmergedChains *crChains, unmergedPaths []path,
 
 		fileActions := actionMap[p.tailPointer()]
 
-		// If this is a directory with setAttr(mtime)-related actions,
-		// just those action should be collapsed into the parent.
+		// If this is a directory with setAttr(mtime, xattr or
+		// mode)-related actions, just those action should be
+		// collapsed into the parent.
 		if !chain.isFile() {
 			var parentActions crActionList
 			var otherDirActions crActionList
@@ -1924,7 +1925,10 @@ func collapseActions(unmergedChains *crChains, unmergedPaths []path,
 				moved := false
 				switch realAction := action.(type) {
 				case *copyUnmergedAttrAction:
-					if realAction.attr[0] == mtimeAttr && !realAction.moved {
+					if (realAction.attr[0] == mtimeAttr ||
+						realAction.attr[0] == xattrAttr ||
+						realAction.attr[0] == modeAttr) &&
+						!realAction.moved {
 						realAction.moved = true
 						parentActions = append(parentActions, realAction)
 						moved = true
@@ -2086,7 +2090,7 @@ func (cr *ConflictResolver) makeFileBlockDeepCopy(ctx context.Context,
 	}
 
 	newPtr, allChildPtrs, err := cr.fbo.blocks.DeepCopyFile(
-		ctx, lState, kmd, file, dirtyBcache, cr.config.DataVersion())
+		ctx, lState, kmd, file, dirtyBcache, maxFileDataVer)
 	if err != nil {
 		return BlockPointer{}, err
 	}
@@ -3722,7 +3726,8 @@ func (cr *ConflictResolver) completeResolution(ctx context.Context,
 	// Put all the blocks.  TODO: deal with recoverable block errors?
 	_, err = doBlockPuts(ctx, cr.config.BlockServer(), cr.config.BlockCache(),
 		cr.config.Reporter(), cr.log, md.TlfID(),
-		md.GetTlfHandle().GetCanonicalName(), *bps)
+		md.GetTlfHandle().GetCanonicalName(), *bps,
+		cr.config.MaxParallelBlockPuts(), cr.config.blockTransferTracker())
 	if err != nil {
 		return err
 	}
@@ -3787,6 +3792,74 @@ func (e CRWrapError) Error() string {
 	return "Conflict resolution error: " + e.err.Error()
 }
 
+// reportConflictedCopies tells the user about every file that
+// couldn't be merged, and was instead given a conflicted copy by the
+// executed actions in `actionMap`.  Each copy is sent out as a
+// notification, and listed in the folder's status.
+func (cr *ConflictResolver) reportConflictedCopies(ctx context.Context,
+	actionMap map[BlockPointer]crActionList,
+	mergedPaths map[BlockPointer]path) {
+	_, uid, err := cr.config.KBPKI().GetCurrentUserInfo(ctx)
+	if err != nil {
+		cr.log.CDebugf(ctx, "Couldn't get current user for conflict "+
+			"notifications: %+v", err)
+	}
+	now := cr.config.Clock().Now()
+
+	// `mergedPaths` is keyed by unmerged pointers, while
+	// `actionMap` is keyed by merged ones.
+	dirs := make(map[BlockPointer]path, len(mergedPaths))
+	for _, p := range mergedPaths {
+		dirs[p.tailPointer()] = p
+	}
+
+	var copies []string
+	for ptr, actions := range actionMap {
+		dir, ok := dirs[ptr]
+		if !ok {
+			continue
+		}
+		for _, action := range actions {
+			var fromName, toName string
+			switch realAction := action.(type) {
+			case *renameUnmergedAction:
+				// A symPath means a directory conflict, which
+				// leaves a symlink instead of a copy.
+				if realAction.symPath != "" {
+					continue
+				}
+				fromName, toName = realAction.fromName, realAction.toName
+			case *renameMergedAction:
+				fromName, toName = realAction.fromName, realAction.toName
+			default:
+				continue
+			}
+			if fromName == toName {
+				continue
+			}
+
+			original := dir.ChildPathNoPtr(fromName)
+			copyPath := dir.ChildPathNoPtr(toName)
+			cr.log.CDebugf(ctx, "Made conflicted copy %s of %s",
+				copyPath, original)
+			cr.config.Reporter().Notify(ctx, conflictedCopyNotification(
+				original, copyPath, uid, now))
+			cr.config.UserAlerter().AlertUser(ctx, UserAlert{
+				Type:     UserAlertConflictCreated,
+				TlfName:  CanonicalTlfName(dir.path[0].Name),
+				Public:   dir.Tlf.IsPublic(),
+				Filename: copyPath.CanonicalPathString(),
+				Original: original.CanonicalPathString(),
+			})
+			copies = append(copies, fmt.Sprintf("%s -> %s",
+				original.CanonicalPathString(),
+				copyPath.CanonicalPathString()))
+		}
+	}
+	sort.Strings(copies)
+	cr.fbo.status.addConflictedCopies(copies)
+}
+
 func (cr *ConflictResolver) doResolve(ctx context.Context, ci conflictInput) {
 	cr.log.CDebugf(ctx, "Starting conflict resolution with input %v", ci)
 	var err error
@@ -3999,6 +4072,8 @@ func (cr *ConflictResolver) doResolve(ctx context.Context, ci conflictInput) {
 		return
 	}
 
+	cr.reportConflictedCopies(ctx, actionMap, mergedPaths)
+
 	// TODO: If conflict resolution fails after some blocks were put,
 	// remember these and include them in the later resolution so they
 	// don't count against the quota forever.  (Though of course if we
@@ -6,12 +6,16 @@ package libkbfs
 
 import (
 	"sync"
+
+	"github.com/keybase/kbfs/tlf"
+	"golang.org/x/net/context"
 )
 
 // Service names used in ConnectionStatus.
 const (
 	KeybaseServiceName     = "keybase-service"
 	MDServiceName          = "md-server"
+	BServiceName           = "block-server"
 	LoginStatusUpdateName  = "login"
 	LogoutStatusUpdateName = "logout"
 )
@@ -24,12 +28,71 @@ type kbfsCurrentStatus struct {
 	lock            sync.Mutex
 	failingServices map[string]error
 	invalidateChan  chan StatusUpdate
+
+	observersLock sync.Mutex
+	observers     map[SyncStateObserver]bool
 }
 
 // Init inits the kbfsCurrentStatus.
 func (kcs *kbfsCurrentStatus) Init() {
 	kcs.failingServices = map[string]error{}
 	kcs.invalidateChan = make(chan StatusUpdate)
+	kcs.observers = make(map[SyncStateObserver]bool)
+}
+
+func (kcs *kbfsCurrentStatus) registerForSyncStateChanges(
+	obs SyncStateObserver) {
+	kcs.observersLock.Lock()
+	defer kcs.observersLock.Unlock()
+	kcs.observers[obs] = true
+}
+
+func (kcs *kbfsCurrentStatus) unregisterFromSyncStateChanges(
+	obs SyncStateObserver) {
+	kcs.observersLock.Lock()
+	defer kcs.observersLock.Unlock()
+	delete(kcs.observers, obs)
+}
+
+func (kcs *kbfsCurrentStatus) notifySyncState(events ...SyncStateEvent) {
+	kcs.observersLock.Lock()
+	defer kcs.observersLock.Unlock()
+	for _, e := range events {
+		for obs := range kcs.observers {
+			obs.SyncStateChanged(context.Background(), e)
+		}
+	}
+}
+
+// pushTLFCatchingUp tells the observers that the given TLF started
+// applying remote updates up to the given revision.  kcs may be nil,
+// in which case nothing happens.
+func (kcs *kbfsCurrentStatus) pushTLFCatchingUp(
+	tlfID tlf.ID, rev MetadataRevision) {
+	if kcs == nil {
+		return
+	}
+	kcs.notifySyncState(SyncStateEvent{
+		Type:     SyncStateCatchingUp,
+		TlfID:    tlfID,
+		Revision: rev,
+	})
+}
+
+// pushTLFCaughtUp tells the observers that the given TLF finished
+// applying remote updates, with the given head revision and error.
+// kcs may be nil, in which case nothing happens.
+func (kcs *kbfsCurrentStatus) pushTLFCaughtUp(
+	tlfID tlf.ID, rev MetadataRevision, err error) {
+	if kcs == nil {
+		return
+	}
+	kcs.notifySyncState(SyncStateEvent{
+		Type:     SyncStateCaughtUp,
+		TlfID:    tlfID,
+		Revision: rev,
+		Err:      errString(err),
+	})
 }
 
 // CurrentStatus returns a copy of the current status.
@@ -46,22 +109,54 @@ func (kcs *kbfsCurrentStatus) CurrentStatus() (map[string]error, chan StatusUpda
 
 // PushConnectionStatusChange pushes a change to the connection status of one of the services.
 func (kcs *kbfsCurrentStatus) PushConnectionStatusChange(service string, err error) {
-	kcs.lock.Lock()
-	defer kcs.lock.Unlock()
+	events := func() []SyncStateEvent {
+		kcs.lock.Lock()
+		defer kcs.lock.Unlock()
 
-	if err != nil {
-		kcs.failingServices[service] = err
-	} else {
-		// Potentially exit early if nothing changes.
-		_, exist := kcs.failingServices[service]
-		if !exist {
-			return
+		_, wasFailing := kcs.failingServices[service]
+		wasOnline := len(kcs.failingServices) == 0
+		if err != nil {
+			kcs.failingServices[service] = err
+		} else {
+			// Potentially exit early if nothing changes.
+			if !wasFailing {
+				return nil
+			}
+			delete(kcs.failingServices, service)
 		}
-		delete(kcs.failingServices, service)
-	}
 
-	close(kcs.invalidateChan)
-	kcs.invalidateChan = make(chan StatusUpdate)
+		close(kcs.invalidateChan)
+		kcs.invalidateChan = make(chan StatusUpdate)
+
+		var events []SyncStateEvent
+		switch {
+		case err != nil && !wasFailing:
+			events = append(events, SyncStateEvent{
+				Type:    SyncStateReconnecting,
+				Service: service,
+				Err:     err.Error(),
+			})
+			if wasOnline {
+				events = append(events, SyncStateEvent{
+					Type:    SyncStateOffline,
+					Service: service,
+					Err:     err.Error(),
+				})
+			}
+		case err == nil:
+			events = append(events, SyncStateEvent{
+				Type:    SyncStateReconnected,
+				Service: service,
+			})
+			if len(kcs.failingServices) == 0 {
+				events = append(events, SyncStateEvent{
+					Type: SyncStateOnline,
+				})
+			}
+		}
+		return events
+	}()
+	kcs.notifySyncState(events...)
 }
 
 // PushStatusChange forces a new status be fetched by status listeners.
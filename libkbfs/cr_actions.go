@@ -188,8 +188,14 @@ func (cuea *copyUnmergedEntryAction) do(ctx context.Context,
 			switch a {
 			case exAttr:
 				unmergedEntry.Type = cuea.unmergedEntry.Type
+				unmergedEntry.Mode = cuea.unmergedEntry.Mode
 			case mtimeAttr:
 				unmergedEntry.Mtime = cuea.unmergedEntry.Mtime
+			case xattrAttr:
+				unmergedEntry.Xattrs = cuea.unmergedEntry.Xattrs
+			case modeAttr:
+				unmergedEntry.Type = cuea.unmergedEntry.Type
+				unmergedEntry.Mode = cuea.unmergedEntry.Mode
 			}
 		}
 	}
@@ -384,8 +390,14 @@ func (cuaa *copyUnmergedAttrAction) do(ctx context.Context,
 		switch attr {
 		case exAttr:
 			mergedEntry.Type = unmergedEntry.Type
+			mergedEntry.Mode = unmergedEntry.Mode
 		case mtimeAttr:
 			mergedEntry.Mtime = unmergedEntry.Mtime
+		case xattrAttr:
+			mergedEntry.Xattrs = unmergedEntry.Xattrs
+		case modeAttr:
+			mergedEntry.Type = unmergedEntry.Type
+			mergedEntry.Mode = unmergedEntry.Mode
 		case sizeAttr:
 			mergedEntry.Size = unmergedEntry.Size
 			mergedEntry.EncodedSize = unmergedEntry.EncodedSize
@@ -210,9 +210,10 @@ func (cc *crChain) identifyType(ctx context.Context, fbo *folderBlockOps,
 	}
 
 	// If any op is setAttr (ex or size) or sync, this is a file
-	// chain.  If it only has a setAttr/mtime, we don't know what it
-	// is, so fall through and fetch the block unless we come across
-	// another op that can determine the type.
+	// chain.  If it only has a setAttr/mtime, setAttr/xattr or
+	// setAttr/mode, we don't know what it is, so fall through and
+	// fetch the block unless we come across another op that can
+	// determine the type.
 	var parentDir BlockPointer
 	for _, op := range cc.ops {
 		switch realOp := op.(type) {
@@ -220,11 +221,13 @@ func (cc *crChain) identifyType(ctx context.Context, fbo *folderBlockOps,
 			cc.file = true
 			return nil
 		case *setAttrOp:
-			if realOp.Attr != mtimeAttr {
+			if realOp.Attr != mtimeAttr && realOp.Attr != xattrAttr &&
+				realOp.Attr != modeAttr {
 				cc.file = true
 				return nil
 			}
-			// We can't tell the file type from an mtimeAttr, so we
+			// We can't tell the file type from an mtimeAttr,
+			// xattrAttr or modeAttr, so we
 			// may have to actually fetch the block to figure it out.
 			parentDir = realOp.Dir.Ref
 		default:
@@ -582,6 +585,8 @@ func (ccs *crChains) makeChainForOp(op op) error {
 		// ignore rekey op
 	case *GCOp:
 		// ignore gc op
+	case *settingsOp:
+		// ignore settings op
 	}
 
 	return nil
@@ -945,6 +950,9 @@ func (ccs *crChains) copyOpAndRevertUnrefsToOriginals(currOp op) op {
 	case *GCOp:
 		// No need to copy a GCOp, it won't be modified
 		newOp = realOp
+	case *settingsOp:
+		// No need to copy a settingsOp, it won't be modified
+		newOp = realOp
 	}
 	for _, unref := range unrefs {
 		original, ok := ccs.originals[*unref]
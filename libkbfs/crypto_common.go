@@ -19,20 +19,22 @@ import (
 	"github.com/keybase/kbfs/tlf"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/nacl/box"
-	"golang.org/x/crypto/nacl/secretbox"
 )
 
 // CryptoCommon contains many of the function implementations need for
 // the Crypto interface, which can be reused by other implementations.
 type CryptoCommon struct {
 	codec kbfscodec.Codec
+	// encryptionVer is the version of the symmetric cipher used
+	// to encrypt new data.
+	encryptionVer EncryptionVer
 }
 
 var _ cryptoPure = (*CryptoCommon)(nil)
 
 // MakeCryptoCommon returns a default CryptoCommon object.
 func MakeCryptoCommon(codec kbfscodec.Codec) CryptoCommon {
-	return CryptoCommon{codec}
+	return CryptoCommon{codec, defaultEncryptionVer}
 }
 
 // MakeRandomTlfID implements the Crypto interface for CryptoCommon.
@@ -220,17 +222,22 @@ func (c CryptoCommon) EncryptTLFCryptKeyClientHalf(
 }
 
 func (c CryptoCommon) encryptData(data []byte, key [32]byte) (encryptedData, error) {
-	var nonce [24]byte
-	err := kbfscrypto.RandRead(nonce[:])
+	cipher, err := getSymmetricCipher(c.encryptionVer)
+	if err != nil {
+		return encryptedData{}, errors.WithStack(err)
+	}
+
+	nonce := make([]byte, cipher.nonceSize())
+	err = kbfscrypto.RandRead(nonce)
 	if err != nil {
 		return encryptedData{}, err
 	}
 
-	sealedData := secretbox.Seal(nil, data, &nonce, &key)
+	sealedData := cipher.seal(data, nonce, key)
 
 	return encryptedData{
-		Version:       EncryptionSecretbox,
-		Nonce:         nonce[:],
+		Version:       c.encryptionVer,
+		Nonce:         nonce,
 		EncryptedData: sealedData,
 	}, nil
 }
@@ -253,20 +260,18 @@ func (c CryptoCommon) EncryptPrivateMetadata(
 }
 
 func (c CryptoCommon) decryptData(encryptedData encryptedData, key [32]byte) ([]byte, error) {
-	if encryptedData.Version != EncryptionSecretbox {
-		return nil, errors.WithStack(
-			UnknownEncryptionVer{encryptedData.Version})
+	cipher, err := getSymmetricCipher(encryptedData.Version)
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
 
-	var nonce [24]byte
-	if len(encryptedData.Nonce) != len(nonce) {
+	if len(encryptedData.Nonce) != cipher.nonceSize() {
 		return nil, errors.WithStack(
 			InvalidNonceError{encryptedData.Nonce})
 	}
-	copy(nonce[:], encryptedData.Nonce)
 
-	decryptedData, ok := secretbox.Open(
-		nil, encryptedData.EncryptedData, &nonce, &key)
+	decryptedData, ok := cipher.open(
+		encryptedData.EncryptedData, encryptedData.Nonce, key)
 	if !ok {
 		return nil, errors.WithStack(libkb.DecryptionError{})
 	}
@@ -366,11 +371,27 @@ func (c CryptoCommon) depadBlock(paddedBlock []byte) ([]byte, error) {
 
 // EncryptBlock implements the Crypto interface for CryptoCommon.
 func (c CryptoCommon) EncryptBlock(block Block, key kbfscrypto.BlockCryptKey) (
+	plainSize int, encryptedBlock EncryptedBlock, err error) {
+	return c.EncryptCompressedBlock(block, key, NoBlockCompression)
+}
+
+// EncryptCompressedBlock implements the Crypto interface for
+// CryptoCommon.
+func (c CryptoCommon) EncryptCompressedBlock(
+	block Block, key kbfscrypto.BlockCryptKey,
+	compression BlockCompressionType) (
 	plainSize int, encryptedBlock EncryptedBlock, err error) {
 	encodedBlock, err := c.codec.Encode(block)
 	if err != nil {
 		return -1, EncryptedBlock{}, err
 	}
+	plainSize = len(encodedBlock)
+
+	encodedBlock, compression, err = compressBlockData(
+		compression, encodedBlock)
+	if err != nil {
+		return -1, EncryptedBlock{}, err
+	}
 
 	paddedBlock, err := c.padBlock(encodedBlock)
 	if err != nil {
@@ -382,22 +403,75 @@ func (c CryptoCommon) EncryptBlock(block Block, key kbfscrypto.BlockCryptKey) (
 		return -1, EncryptedBlock{}, err
 	}
 
-	plainSize = len(encodedBlock)
-	encryptedBlock = EncryptedBlock{encryptedData}
+	encryptedBlock = EncryptedBlock{
+		encryptedData: encryptedData,
+		Compression:   compression,
+	}
 	return plainSize, encryptedBlock, nil
 }
 
+// MakeUnencryptedBlock implements the Crypto interface for
+// CryptoCommon.
+func (c CryptoCommon) MakeUnencryptedBlock(
+	block Block, compression BlockCompressionType) (
+	plainSize int, unencryptedBlock EncryptedBlock, err error) {
+	encodedBlock, err := c.codec.Encode(block)
+	if err != nil {
+		return -1, EncryptedBlock{}, err
+	}
+	plainSize = len(encodedBlock)
+
+	encodedBlock, compression, err = compressBlockData(
+		compression, encodedBlock)
+	if err != nil {
+		return -1, EncryptedBlock{}, err
+	}
+
+	// The nonce isn't used for anything but making the block ID
+	// unique.  Deriving the ID from the contents alone would let
+	// the block server deduplicate identical blocks, but then two
+	// new blocks with the same contents would share a reference
+	// (and a random key server half), and removing one of them
+	// would delete the other.
+	nonce := make([]byte, 24)
+	err = kbfscrypto.RandRead(nonce)
+	if err != nil {
+		return -1, EncryptedBlock{}, err
+	}
+
+	unencryptedBlock = EncryptedBlock{
+		encryptedData: encryptedData{
+			Version:       EncryptionNone,
+			EncryptedData: encodedBlock,
+			Nonce:         nonce,
+		},
+		Compression: compression,
+	}
+	return plainSize, unencryptedBlock, nil
+}
+
 // DecryptBlock implements the Crypto interface for CryptoCommon.
 func (c CryptoCommon) DecryptBlock(
 	encryptedBlock EncryptedBlock, key kbfscrypto.BlockCryptKey,
 	block Block) error {
-	paddedBlock, err := c.decryptData(
-		encryptedBlock.encryptedData, key.Data())
-	if err != nil {
-		return err
+	var encodedBlock []byte
+	if encryptedBlock.Version == EncryptionNone {
+		encodedBlock = encryptedBlock.EncryptedData
+	} else {
+		paddedBlock, err := c.decryptData(
+			encryptedBlock.encryptedData, key.Data())
+		if err != nil {
+			return err
+		}
+
+		encodedBlock, err = c.depadBlock(paddedBlock)
+		if err != nil {
+			return err
+		}
 	}
 
-	encodedBlock, err := c.depadBlock(paddedBlock)
+	encodedBlock, err := decompressBlockData(
+		encryptedBlock.Compression, encodedBlock)
 	if err != nil {
 		return err
 	}
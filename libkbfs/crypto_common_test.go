@@ -377,7 +377,7 @@ func TestDecryptBlockSecretboxSeal(t *testing.T) {
 	paddedBlock, err := c.padBlock(encodedBlock)
 	require.NoError(t, err)
 
-	encryptedBlock := EncryptedBlock{secretboxSealEncoded(t, &c, paddedBlock, cryptKey.Data())}
+	encryptedBlock := EncryptedBlock{encryptedData: secretboxSealEncoded(t, &c, paddedBlock, cryptKey.Data())}
 
 	var decryptedBlock TestBlock
 	err = c.DecryptBlock(encryptedBlock, cryptKey, &decryptedBlock)
@@ -403,6 +403,90 @@ func TestDecryptEncryptedBlock(t *testing.T) {
 	require.Equal(t, block, decryptedBlock)
 }
 
+// Test that blocks made by MakeUnencryptedBlock() can be read back
+// by DecryptBlock() with any key, and that identical blocks still
+// get different encodings.
+func TestMakeUnencryptedBlock(t *testing.T) {
+	c := MakeCryptoCommon(kbfscodec.NewMsgpack())
+
+	block := TestBlock{50}
+	expectedEncodedBlock, err := c.codec.Encode(block)
+	require.NoError(t, err)
+
+	plainSize, unencryptedBlock, err := c.MakeUnencryptedBlock(
+		&block, NoBlockCompression)
+	require.NoError(t, err)
+	require.Equal(t, len(expectedEncodedBlock), plainSize)
+	require.Equal(t, EncryptionNone, unencryptedBlock.Version)
+	require.Equal(t, expectedEncodedBlock, unencryptedBlock.EncryptedData)
+
+	var decryptedBlock TestBlock
+	err = c.DecryptBlock(unencryptedBlock, kbfscrypto.BlockCryptKey{},
+		&decryptedBlock)
+	require.NoError(t, err)
+	require.Equal(t, block, decryptedBlock)
+
+	_, unencryptedBlock2, err := c.MakeUnencryptedBlock(
+		&block, NoBlockCompression)
+	require.NoError(t, err)
+	require.NotEqual(t, unencryptedBlock.Nonce, unencryptedBlock2.Nonce)
+}
+
+// testSymmetricCipher is a symmetricCipher with a different nonce
+// size than nacl/secretbox, which it otherwise just wraps.
+type testSymmetricCipher struct{}
+
+func (testSymmetricCipher) nonceSize() int {
+	return 12
+}
+
+func (testSymmetricCipher) seal(data, nonce []byte, key [32]byte) []byte {
+	return secretboxCipher{}.seal(data, nonce, key)
+}
+
+func (testSymmetricCipher) open(
+	sealedData, nonce []byte, key [32]byte) ([]byte, bool) {
+	return secretboxCipher{}.open(sealedData, nonce, key)
+}
+
+// Test that data encrypted with any registered cipher can be
+// decrypted, regardless of the cipher used for encryption.
+func TestDecryptBlockOtherCipher(t *testing.T) {
+	const testVer EncryptionVer = 100
+	symmetricCiphers[testVer] = testSymmetricCipher{}
+	defer delete(symmetricCiphers, testVer)
+
+	cNew := MakeCryptoCommon(kbfscodec.NewMsgpack())
+	cNew.encryptionVer = testVer
+	cryptKey := makeFakeBlockCryptKey(t)
+	block := TestBlock{50}
+	_, encryptedBlock, err := cNew.EncryptBlock(&block, cryptKey)
+	require.NoError(t, err)
+	require.Equal(t, testVer, encryptedBlock.Version)
+	require.Len(t, encryptedBlock.Nonce, 12)
+
+	c := MakeCryptoCommon(kbfscodec.NewMsgpack())
+	var decryptedBlock TestBlock
+	err = c.DecryptBlock(encryptedBlock, cryptKey, &decryptedBlock)
+	require.NoError(t, err)
+	require.Equal(t, block, decryptedBlock)
+
+	// Blocks encrypted with the default cipher are still readable.
+	_, encryptedBlock2, err := c.EncryptBlock(&block, cryptKey)
+	require.NoError(t, err)
+	require.Equal(t, EncryptionSecretbox, encryptedBlock2.Version)
+	decryptedBlock = TestBlock{}
+	err = cNew.DecryptBlock(encryptedBlock2, cryptKey, &decryptedBlock)
+	require.NoError(t, err)
+	require.Equal(t, block, decryptedBlock)
+
+	delete(symmetricCiphers, testVer)
+	err = c.DecryptBlock(encryptedBlock, cryptKey, &decryptedBlock)
+	require.Equal(t, UnknownEncryptionVer{testVer}, errors.Cause(err))
+	_, _, err = cNew.EncryptBlock(&block, cryptKey)
+	require.Equal(t, UnknownEncryptionVer{testVer}, errors.Cause(err))
+}
+
 // Test various failure cases for crypto.DecryptBlock().
 func TestDecryptBlockFailures(t *testing.T) {
 	c := MakeCryptoCommon(kbfscodec.NewMsgpack())
@@ -418,7 +502,7 @@ func TestDecryptBlockFailures(t *testing.T) {
 		func(encryptedData encryptedData, key interface{}) error {
 			var dummy TestBlock
 			return c.DecryptBlock(
-				EncryptedBlock{encryptedData},
+				EncryptedBlock{encryptedData: encryptedData},
 				key.(kbfscrypto.BlockCryptKey), &dummy)
 		},
 		func(key interface{}) interface{} {
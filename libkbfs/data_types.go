@@ -7,6 +7,7 @@ package libkbfs
 import (
 	"encoding/hex"
 	"fmt"
+	"os"
 	"reflect"
 	"strings"
 	"time"
@@ -44,6 +45,12 @@ type UserInfo struct {
 	// Revoked keys, and the time at which they were revoked.
 	RevokedVerifyingKeys   map[kbfscrypto.VerifyingKey]keybase1.KeybaseTime
 	RevokedCryptPublicKeys map[kbfscrypto.CryptPublicKey]keybase1.KeybaseTime
+
+	// LastKnownGoodAt is zero unless this info was read from the
+	// offline identity cache because the keybase service was
+	// unreachable, in which case it's when the service last
+	// verified it.
+	LastKnownGoodAt time.Time
 }
 
 // SessionInfo contains all the info about the keybase session that
@@ -56,6 +63,59 @@ type SessionInfo struct {
 	VerifyingKey   kbfscrypto.VerifyingKey
 }
 
+// TeamRole is the role of a member of a keybase team.
+type TeamRole int
+
+const (
+	// TeamRoleReader members can only read the team's TLFs.
+	TeamRoleReader TeamRole = iota + 1
+	// TeamRoleWriter members can read and write the team's TLFs.
+	TeamRoleWriter
+	// TeamRoleAdmin members can write the team's TLFs, and
+	// manage the team.
+	TeamRoleAdmin
+	// TeamRoleOwner members can do everything admins can.
+	TeamRoleOwner
+)
+
+// IsWriter returns whether or not members with this role can write
+// to the team's TLFs.
+func (r TeamRole) IsWriter() bool {
+	return r >= TeamRoleWriter
+}
+
+// TeamInfo contains all the info about a keybase team that kbfs
+// cares about.
+type TeamInfo struct {
+	Name libkb.NormalizedUsername
+	TID  keybase1.UID
+	// Writers and Readers hold the members of the team that can
+	// write to the team's TLFs, and the ones that can only read
+	// them, respectively.
+	Writers map[keybase1.UID]bool
+	Readers map[keybase1.UID]bool
+}
+
+// MakeTeamInfo returns a TeamInfo for the given team, whose TLF
+// access is derived from the given roles of its members.
+func MakeTeamInfo(name libkb.NormalizedUsername, tid keybase1.UID,
+	members map[keybase1.UID]TeamRole) TeamInfo {
+	info := TeamInfo{
+		Name:    name,
+		TID:     tid,
+		Writers: make(map[keybase1.UID]bool),
+		Readers: make(map[keybase1.UID]bool),
+	}
+	for uid, role := range members {
+		if role.IsWriter() {
+			info.Writers[uid] = true
+		} else {
+			info.Readers[uid] = true
+		}
+	}
+	return info
+}
+
 // EncryptionVer denotes a version for the encryption method.
 type EncryptionVer int
 
@@ -63,12 +123,19 @@ const (
 	// EncryptionSecretbox is the encryption version that uses
 	// nacl/secretbox or nacl/box.
 	EncryptionSecretbox EncryptionVer = 1
+	// EncryptionNone is the version for block data that isn't
+	// encrypted at all. It's only allowed for blocks of public
+	// TLFs, whose contents are readable by anyone anyway, and
+	// whose integrity comes from their block IDs.
+	EncryptionNone EncryptionVer = 2
 )
 
 func (v EncryptionVer) String() string {
 	switch v {
 	case EncryptionSecretbox:
 		return "EncryptionSecretbox"
+	case EncryptionNone:
+		return "EncryptionNone"
 	default:
 		return fmt.Sprintf("EncryptionVer(%d)", v)
 	}
@@ -106,6 +173,10 @@ type EncryptedPrivateMetadata struct {
 // EncryptedBlock is an encrypted Block.
 type EncryptedBlock struct {
 	encryptedData
+	// Compression is how the encoded block was compressed before
+	// it was padded and encrypted. It is omitted for uncompressed
+	// blocks, so that their encoding is unchanged.
+	Compression BlockCompressionType `codec:"z,omitempty"`
 }
 
 // EncryptedTLFCryptKeys is an encrypted TLFCryptKey array.
@@ -216,6 +287,11 @@ func (v MetadataVer) String() string {
 // one indirect pointer with an indirect DirectType [although if it
 // holds for one, it should hold for all], and all of its indirect
 // pointers must have DataVer 3, by c).
+// e) Indirect directory blocks are always v4, and have exactly one
+// level of direct children, which are v1 by a).
+// f) Any block that was compressed before it was encrypted is v5,
+// whatever its place in the tree, so that older clients refuse to
+// read it instead of failing to decode it.
 type DataVer int
 
 const (
@@ -230,8 +306,22 @@ const (
 	// blocks that have multiple levels of indirection below them
 	// (i.e., indirect blocks that point to other indirect blocks).
 	AtLeastTwoLevelsOfChildrenDataVer DataVer = 3
+	// IndirectDirsDataVer is the data version for directory blocks
+	// that are split across multiple child blocks.
+	IndirectDirsDataVer DataVer = 4
+	// CompressedBlocksDataVer is the data version for blocks that
+	// were compressed before being encrypted.
+	CompressedBlocksDataVer DataVer = 5
 )
 
+// maxFileDataVer is the data version stamped on file pointers that
+// aren't readied from their own block, like deep-copied files and
+// unembedded block change lists.  It is deliberately separate from
+// Config.DataVersion(), the highest version this client can read,
+// since the versions above it only apply to directories and
+// compressed blocks, which are stamped when they're readied.
+const maxFileDataVer = AtLeastTwoLevelsOfChildrenDataVer
+
 // BlockRef is a block ID/ref nonce pair, which defines a unique
 // reference to a block.
 type BlockRef struct {
@@ -357,6 +447,11 @@ type ReadyBlockData struct {
 	// These fields should not be used outside of putBlockToServer.
 	buf        []byte
 	serverHalf kbfscrypto.BlockCryptKeyServerHalf
+
+	// compressed is whether the block was compressed before it
+	// was encrypted, in which case its pointer needs
+	// CompressedBlocksDataVer.
+	compressed bool
 }
 
 // GetEncodedSize returns the size of the encoded (and encrypted)
@@ -411,6 +506,11 @@ const (
 	MasterBranch BranchName = ""
 )
 
+// LockID identifies an advisory lock within a top-level folder.  The
+// server doesn't interpret it; applications sharing a folder just
+// need to agree on which IDs protect which resources.
+type LockID string
+
 // FolderBranch represents a unique pair of top-level folder and a
 // branch of that folder.
 type FolderBranch struct {
@@ -576,6 +676,34 @@ type EntryInfo struct {
 	Mtime int64
 	// Ctime is in unix nanoseconds
 	Ctime int64
+	// Mode holds the POSIX permission bits (0777) of the entry,
+	// along with entryModeSet once they have been set.  Zero
+	// means they were never set (e.g., by an old client), in
+	// which case they should be derived from Type.  For files,
+	// the user-exec bit always agrees with Type.  Use PermMode to
+	// read it.
+	Mode uint32 `codec:"pm,omitempty"`
+}
+
+// entryModeSet is or'd into EntryInfo.Mode whenever permission bits
+// are stored, so that a mode of 0000 isn't mistaken for one that was
+// never set.
+const entryModeSet uint32 = 010000
+
+// PermMode returns the permission bits stored for this entry, and
+// whether any were stored at all.
+func (ei EntryInfo) PermMode() (perm os.FileMode, ok bool) {
+	if ei.Mode&entryModeSet == 0 {
+		return 0, false
+	}
+	return os.FileMode(ei.Mode).Perm(), true
+}
+
+// DirChild is a named entry of a directory, as returned in pages by
+// KBFSOps.GetDirChildrenPage.
+type DirChild struct {
+	Name string
+	EntryInfo
 }
 
 // ReportedError represents an error reported by KBFS.
@@ -631,9 +759,11 @@ type UpdateSummary struct {
 // TLFUpdateHistory gives all the summaries of all updates in a TLF's
 // history.
 type TLFUpdateHistory struct {
-	ID      string
-	Name    string
-	Updates []UpdateSummary
+	ID   string
+	Name string
+	// BranchID is set only for the history of an unmerged branch.
+	BranchID string `json:",omitempty"`
+	Updates  []UpdateSummary
 }
 
 // writerInfo is the keybase UID and device (represented by its
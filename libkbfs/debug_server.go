@@ -0,0 +1,175 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/metricsutil"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// debugServer is an optional HTTP listener that lets operators
+// capture profiles, goroutine dumps, and KBFS status from a
+// long-running process without restarting it.
+type debugServer struct {
+	config   Config
+	log      logger.Logger
+	listener net.Listener
+	server   *http.Server
+}
+
+// debugServerPostHeader must be set on POST requests to the debug
+// server. Browsers won't send a custom header cross-origin without a
+// CORS preflight, which the debug server never allows, so this keeps
+// web pages from changing settings through a local debug server.
+const debugServerPostHeader = "X-KBFS-Debug"
+
+// blockCacheDebugStatus is what the debug server reports for the
+// block cache.
+type blockCacheDebugStatus struct {
+	CleanBytesCapacity uint64
+}
+
+// newDebugServer starts a debug server listening on addr, which must
+// resolve to a loopback address unless allowRemote is true.
+func newDebugServer(config Config, addr string, allowRemote bool) (
+	*debugServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tcpAddr, ok := listener.Addr().(*net.TCPAddr); !allowRemote &&
+		(!ok || !tcpAddr.IP.IsLoopback()) {
+		listener.Close()
+		return nil, errors.Errorf("Debug server address %s is not a "+
+			"loopback address; use -debug-allow-remote to allow it",
+			listener.Addr())
+	}
+
+	s := &debugServer{
+		config:   config,
+		log:      config.MakeLogger("DBG"),
+		listener: listener,
+	}
+
+	mux := http.NewServeMux()
+	// Set up the same handlers as net/http/pprof does for the
+	// default mux, which we don't want to use.
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.HandleFunc("/kbfs/status", s.serveStatus)
+	mux.HandleFunc("/kbfs/metrics", s.serveMetrics)
+	mux.HandleFunc("/kbfs/bcache", s.serveBlockCache)
+	mux.HandleFunc("/kbfs/loglevels", s.serveLogLevels)
+	// For scraping by Prometheus, which expects this path.
+	mux.HandleFunc("/metrics", s.servePrometheusMetrics)
+
+	s.server = &http.Server{Handler: mux}
+	go func() {
+		err := s.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			s.log.Warning("Debug server on %s stopped: %+v", addr, err)
+		}
+	}()
+	s.log.Debug("Debug server listening on %s", listener.Addr())
+	return s, nil
+}
+
+func (s *debugServer) writeJSON(w http.ResponseWriter, value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		s.log.Debug("Couldn't write debug server response: %+v", err)
+	}
+}
+
+func (s *debugServer) serveStatus(w http.ResponseWriter, r *http.Request) {
+	status, _, err := s.config.KBFSOps().Status(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, status)
+}
+
+func (s *debugServer) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	registry := s.config.MetricsRegistry()
+	if registry == nil {
+		http.Error(w, "Metrics have been turned off.",
+			http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	metricsutil.WriteMetrics(registry, w)
+}
+
+func (s *debugServer) servePrometheusMetrics(
+	w http.ResponseWriter, r *http.Request) {
+	registry := s.config.MetricsRegistry()
+	if registry == nil {
+		http.Error(w, "Metrics have been turned off.",
+			http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", metricsutil.PrometheusContentType)
+	metricsutil.WritePrometheus(registry, "kbfs", w)
+}
+
+func (s *debugServer) serveBlockCache(
+	w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, blockCacheDebugStatus{
+		CleanBytesCapacity: s.config.BlockCache().GetCleanBytesCapacity(),
+	})
+}
+
+// serveLogLevels reports the current level of every log module. A
+// POST with "module" and "level" form values, and the
+// debugServerPostHeader header, first sets the level of the given
+// module, e.g.:
+//
+//   curl -H 'X-KBFS-Debug: 1' -d module='kbfs(BSR)' -d level=debug localhost:6060/kbfs/loglevels
+func (s *debugServer) serveLogLevels(
+	w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if r.Header.Get(debugServerPostHeader) == "" {
+			http.Error(w, "Missing "+debugServerPostHeader+" header",
+				http.StatusForbidden)
+			return
+		}
+		module := r.FormValue("module")
+		level := r.FormValue("level")
+		if err := setLogModuleLevel(module, level); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.log.Info("Set log level for %s to %s", module, level)
+	}
+	s.writeJSON(w, getLogModuleLevels())
+}
+
+// Addr returns the address the debug server is listening on.
+func (s *debugServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Shutdown stops the debug server, waiting for in-flight requests
+// to finish until ctx is done.
+func (s *debugServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
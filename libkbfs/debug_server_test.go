@@ -0,0 +1,104 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestDebugServer(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "test_user")
+	ctx := context.Background()
+	defer CheckConfigAndShutdown(ctx, t, config)
+
+	ds, err := newDebugServer(config, "localhost:0", false)
+	require.NoError(t, err)
+	config.debugServer = ds
+
+	url := fmt.Sprintf("http://%s", ds.Addr())
+
+	resp, err := http.Get(url + "/debug/pprof/goroutine?debug=1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(url + "/metrics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	if config.MetricsRegistry() == nil {
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	} else {
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// Without the header, a POST (e.g., from a web page) is
+	// refused.
+	resp, err = http.PostForm(url+"/kbfs/loglevels", neturl.Values{
+		"module": {"kbfs(debugtest)"},
+		"level":  {"warning"},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	postLevel := func(level string) *http.Response {
+		form := neturl.Values{
+			"module": {"kbfs(debugtest)"},
+			"level":  {level},
+		}
+		req, err := http.NewRequest(http.MethodPost, url+"/kbfs/loglevels",
+			strings.NewReader(form.Encode()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(debugServerPostHeader, "1")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp = postLevel("warning")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var levels map[string]string
+	err = json.NewDecoder(resp.Body).Decode(&levels)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "WARNING", levels["kbfs(debugtest)"])
+
+	resp = postLevel("loud")
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(url + "/kbfs/bcache")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var status blockCacheDebugStatus
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	require.NoError(t, err)
+	require.Equal(t,
+		config.BlockCache().GetCleanBytesCapacity(),
+		status.CleanBytesCapacity)
+}
+
+func TestDebugServerRemote(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "test_user")
+	defer CheckConfigAndShutdown(context.Background(), t, config)
+
+	// Listening on every interface needs an explicit opt-in.
+	_, err := newDebugServer(config, ":0", false)
+	require.Error(t, err)
+
+	ds, err := newDebugServer(config, ":0", true)
+	require.NoError(t, err)
+	config.debugServer = ds
+}
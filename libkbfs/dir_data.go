@@ -0,0 +1,123 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// maxDirEntriesPerBlockDefault is the default number of entries a
+// directory can have before it's split into multiple child blocks
+// under an indirect top block.
+const maxDirEntriesPerBlockDefault = 1024
+
+// dirBlockRange is the set of entries, sorted by name, that goes into
+// one child block of an indirect directory block.
+type dirBlockRange struct {
+	// The first name covered by this range (inclusive).  The first
+	// range always starts at "", so that it covers every name before
+	// the second range.
+	off   string
+	names []string
+}
+
+// splitDirEntries partitions the given directory entries into ranges
+// of at most `maxEntries` entries each.  The range boundaries of the
+// directory's previous version, given by `oldPtrs`, are kept where
+// possible, so that the child blocks whose entries didn't change can
+// be reused; a range that outgrew `maxEntries` is split into
+// half-full pieces, to leave room for new entries.  Ranges that end
+// up empty are dropped.
+func splitDirEntries(children map[string]DirEntry,
+	oldPtrs []IndirectDirPtr, maxEntries int) []dirBlockRange {
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	offs := []string{""}
+	for _, iptr := range oldPtrs {
+		if iptr.Off != "" {
+			offs = append(offs, iptr.Off)
+		}
+	}
+	sort.Strings(offs)
+
+	pieceSize := maxEntries / 2
+	if pieceSize < 1 {
+		pieceSize = 1
+	}
+
+	var ranges []dirBlockRange
+	for i, off := range offs {
+		// Find the names belonging to [off, offs[i+1]).
+		start := sort.SearchStrings(names, off)
+		end := len(names)
+		if i+1 < len(offs) {
+			end = sort.SearchStrings(names, offs[i+1])
+		}
+		rangeNames := names[start:end]
+		if len(rangeNames) == 0 {
+			continue
+		}
+		if len(rangeNames) <= maxEntries {
+			ranges = append(ranges, dirBlockRange{off, rangeNames})
+			continue
+		}
+		for j := 0; j < len(rangeNames); j += pieceSize {
+			pieceEnd := j + pieceSize
+			if pieceEnd > len(rangeNames) {
+				pieceEnd = len(rangeNames)
+			}
+			pieceOff := off
+			if j > 0 {
+				pieceOff = rangeNames[j]
+			}
+			ranges = append(ranges,
+				dirBlockRange{pieceOff, rangeNames[j:pieceEnd]})
+		}
+	}
+	if len(ranges) > 0 {
+		ranges[0].off = ""
+	}
+	return ranges
+}
+
+// assembleIndirectDirBlock merges the entries of the child blocks of
+// the indirect directory block `top` into a single block, which is
+// how the rest of KBFS sees a directory.  The returned block keeps
+// the indirect pointers of `top`, so that a later sync can tell
+// which child blocks it can reuse.
+func assembleIndirectDirBlock(
+	top *DirBlock, children []*DirBlock) (*DirBlock, error) {
+	if len(children) != len(top.IPtrs) {
+		return nil, errors.Errorf("Got %d child blocks for %d pointers",
+			len(children), len(top.IPtrs))
+	}
+	numEntries := 0
+	for _, child := range children {
+		if child.IsInd {
+			return nil, errors.New(
+				"Multiple levels of indirect directory blocks")
+		}
+		numEntries += len(child.Children)
+	}
+
+	assembled := &DirBlock{
+		Children: make(map[string]DirEntry, numEntries),
+		IPtrs:    make([]IndirectDirPtr, len(top.IPtrs)),
+	}
+	copy(assembled.IPtrs, top.IPtrs)
+	for _, child := range children {
+		for name, de := range child.Children {
+			assembled.Children[name] = de
+		}
+	}
+	assembled.SetEncodedSize(top.GetEncodedSize())
+	return assembled, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func makeDirChildrenForTest(names ...string) map[string]DirEntry {
+	children := make(map[string]DirEntry, len(names))
+	for _, name := range names {
+		children[name] = DirEntry{}
+	}
+	return children
+}
+
+func TestSplitDirEntriesNew(t *testing.T) {
+	children := makeDirChildrenForTest("a", "b", "c", "d", "e")
+	ranges := splitDirEntries(children, nil, 4)
+	require.Equal(t, []dirBlockRange{
+		{"", []string{"a", "b"}},
+		{"c", []string{"c", "d"}},
+		{"e", []string{"e"}},
+	}, ranges)
+}
+
+func TestSplitDirEntriesKeepsOldBoundaries(t *testing.T) {
+	oldPtrs := []IndirectDirPtr{{Off: ""}, {Off: "c"}, {Off: "x"}}
+
+	// "b" was added to the first range, and the last range became
+	// empty, so it gets dropped.
+	children := makeDirChildrenForTest("a", "b", "c", "d")
+	ranges := splitDirEntries(children, oldPtrs, 4)
+	require.Equal(t, []dirBlockRange{
+		{"", []string{"a", "b"}},
+		{"c", []string{"c", "d"}},
+	}, ranges)
+
+	// The first range became empty, so the next one must start at
+	// the beginning.
+	children = makeDirChildrenForTest("c", "d", "x")
+	ranges = splitDirEntries(children, oldPtrs, 4)
+	require.Equal(t, []dirBlockRange{
+		{"", []string{"c", "d"}},
+		{"x", []string{"x"}},
+	}, ranges)
+
+	// A range that grew too big gets split.
+	children = makeDirChildrenForTest("a", "c", "d", "e", "f", "g", "x")
+	ranges = splitDirEntries(children, oldPtrs, 4)
+	require.Equal(t, []dirBlockRange{
+		{"", []string{"a"}},
+		{"c", []string{"c", "d"}},
+		{"e", []string{"e", "f"}},
+		{"g", []string{"g"}},
+		{"x", []string{"x"}},
+	}, ranges)
+}
+
+func TestAssembleIndirectDirBlock(t *testing.T) {
+	top := &DirBlock{
+		CommonBlock: CommonBlock{IsInd: true},
+		IPtrs:       []IndirectDirPtr{{Off: ""}, {Off: "c"}},
+	}
+	top.SetEncodedSize(10)
+	child1 := &DirBlock{Children: makeDirChildrenForTest("a", "b")}
+	child2 := &DirBlock{Children: makeDirChildrenForTest("c")}
+
+	dblock, err := assembleIndirectDirBlock(
+		top, []*DirBlock{child1, child2})
+	require.NoError(t, err)
+	require.False(t, dblock.IsInd)
+	require.Equal(t, makeDirChildrenForTest("a", "b", "c"), dblock.Children)
+	require.Equal(t, top.IPtrs, dblock.IPtrs)
+	require.Equal(t, uint32(10), dblock.GetEncodedSize())
+
+	_, err = assembleIndirectDirBlock(top, []*DirBlock{child1})
+	require.Error(t, err)
+}
@@ -4,16 +4,80 @@
 
 package libkbfs
 
-import "github.com/keybase/go-codec/codec"
+import (
+	"sort"
+
+	"github.com/keybase/go-codec/codec"
+)
+
+const (
+	// maxXattrNameBytes is the longest supported extended
+	// attribute name, matching XATTR_NAME_MAX on Linux.
+	maxXattrNameBytes = 255
+	// maxXattrValueBytes is the biggest supported extended
+	// attribute value, matching XATTR_SIZE_MAX on Linux.
+	maxXattrValueBytes = 64 * 1024
+)
 
 // DirEntry is all the data info a directory know about its child.
 type DirEntry struct {
 	BlockInfo
 	EntryInfo
 
+	// Xattrs holds the extended attributes of the child, by name.
+	// Copies of a DirBlock share these maps, so never modify one
+	// in place; use withXattr and withoutXattr instead.
+	Xattrs map[string][]byte `codec:"xa,omitempty"`
+
 	codec.UnknownFieldSetHandler
 }
 
+// withXattr returns a copy of de with the xattr called name set to
+// value.
+func (de DirEntry) withXattr(name string, value []byte) DirEntry {
+	xattrs := make(map[string][]byte, len(de.Xattrs)+1)
+	for k, v := range de.Xattrs {
+		xattrs[k] = v
+	}
+	xattrs[name] = value
+	de.Xattrs = xattrs
+	return de
+}
+
+// withoutXattr returns a copy of de without the xattr called name.
+func (de DirEntry) withoutXattr(name string) DirEntry {
+	var xattrs map[string][]byte
+	if len(de.Xattrs) > 1 {
+		xattrs = make(map[string][]byte, len(de.Xattrs)-1)
+		for k, v := range de.Xattrs {
+			if k != name {
+				xattrs[k] = v
+			}
+		}
+	}
+	de.Xattrs = xattrs
+	return de
+}
+
+// xattrNames returns the sorted names of de's xattrs.
+func (de DirEntry) xattrNames() []string {
+	names := make([]string, 0, len(de.Xattrs))
+	for name := range de.Xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// modeWithEx returns the permission bits mode, with the exec bits
+// turned on (for everyone who can read) or off according to ex.
+func modeWithEx(mode uint32, ex bool) uint32 {
+	if ex {
+		return mode | (mode&0444)>>2 | 0100
+	}
+	return mode &^ 0111
+}
+
 // IsInitialized returns true if this DirEntry has been initialized.
 func (de *DirEntry) IsInitialized() bool {
 	return de.BlockPointer.IsInitialized()
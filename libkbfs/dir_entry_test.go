@@ -33,7 +33,9 @@ func makeFakeDirEntry(t *testing.T, typ EntryType, size uint64) DirEntry {
 			"fake sym path",
 			101,
 			102,
+			0640,
 		},
+		map[string][]byte{"user.fake": []byte("fake value")},
 		codec.UnknownFieldSetHandler{},
 	}
 }
@@ -0,0 +1,28 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"path/filepath"
+
+	"github.com/keybase/kbfs/ioutil"
+)
+
+// dirLockFileName is the name of the lock file that lockDir creates
+// in each locked directory.
+const dirLockFileName = "LOCK"
+
+// lockDir creates dir if needed, and takes an exclusive lock on it,
+// so that two processes can't use the same local server storage at
+// once. It returns a DirInUseError right away if another process
+// holds the lock. The lock is released by calling unlock, or when
+// the process exits.
+func lockDir(dir string) (unlock func() error, err error) {
+	err = ioutil.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return lockFile(dir, filepath.Join(dir, dirLockFileName))
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestLockDir(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "dir_lock")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	dir := filepath.Join(tempdir, "server")
+	unlock, err := lockDir(dir)
+	require.NoError(t, err)
+
+	_, err = lockDir(dir)
+	require.Equal(t, DirInUseError{dir}, errors.Cause(err))
+
+	err = unlock()
+	require.NoError(t, err)
+
+	unlock, err = lockDir(dir)
+	require.NoError(t, err)
+	err = unlock()
+	require.NoError(t, err)
+}
+
+func TestBlockServerDirInUse(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "dir_lock")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	codec := kbfscodec.NewMsgpack()
+	log := logger.NewTestLogger(t)
+	bserv, err := NewBlockServerDir(codec, log, tempdir)
+	require.NoError(t, err)
+
+	_, err = NewBlockServerDir(codec, log, tempdir)
+	require.Equal(t, DirInUseError{tempdir}, errors.Cause(err))
+
+	bserv.Shutdown(context.Background())
+	bserv, err = NewBlockServerDir(codec, log, tempdir)
+	require.NoError(t, err)
+	bserv.Shutdown(context.Background())
+}
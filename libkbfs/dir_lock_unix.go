@@ -0,0 +1,33 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package libkbfs
+
+import (
+	"os"
+
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// lockFile takes an exclusive flock on the file at path, creating
+// it if needed.
+func lockFile(dir, path string) (unlock func() error, err error) {
+	f, err := ioutil.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if err == unix.EWOULDBLOCK {
+		f.Close()
+		return nil, errors.WithStack(DirInUseError{dir})
+	} else if err != nil {
+		f.Close()
+		return nil, errors.WithStack(err)
+	}
+	return f.Close, nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// errorSharingViolation is ERROR_SHARING_VIOLATION, which isn't
+// defined by the windows package.
+const errorSharingViolation syscall.Errno = 32
+
+// lockFile opens the file at path with no sharing allowed, creating
+// it if needed. Windows keeps anyone else from opening it until the
+// handle is closed.
+func lockFile(dir, path string) (unlock func() error, err error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	h, err := windows.CreateFile(pathPtr,
+		windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil,
+		windows.OPEN_ALWAYS, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err == errorSharingViolation {
+		return nil, errors.WithStack(DirInUseError{dir})
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return func() error {
+		return windows.CloseHandle(h)
+	}, nil
+}
@@ -39,6 +39,9 @@ type dirtyBlockState struct {
 	// indirect file block under its new, permanent block ID.  Once a
 	// block is orphaned, it is no longer re-dirtiable.
 	orphaned bool
+	// A "streaming" block has been readied to be put to the server
+	// ahead of the next sync, and hasn't been written to since.
+	streaming bool
 }
 
 // dirtyFile represents a particular file that's been written to, but
@@ -115,6 +118,7 @@ func (df *dirtyFile) setBlockDirty(ptr BlockPointer) (
 	state := df.fileBlockStates[ptr]
 	needsCaching = state.copy == blockNeedsCopy
 	state.copy = blockAlreadyCopied
+	state.streaming = false
 	isSyncing = state.sync != blockNotSyncing
 	df.fileBlockStates[ptr] = state
 	return needsCaching, isSyncing
@@ -317,6 +321,32 @@ func (df *dirtyFile) setBlockOrphaned(ptr BlockPointer, orphaned bool) {
 	df.fileBlockStates[ptr] = state
 }
 
+func (df *dirtyFile) setBlockStreaming(ptr BlockPointer) {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+	state, ok := df.fileBlockStates[ptr]
+	if !ok {
+		return
+	}
+	state.streaming = true
+	df.fileBlockStates[ptr] = state
+}
+
+// finishBlockStreaming clears the streaming state of the given block,
+// and returns whether it was still set, i.e., whether the block
+// hasn't been written to since it started streaming.
+func (df *dirtyFile) finishBlockStreaming(ptr BlockPointer) bool {
+	df.lock.Lock()
+	defer df.lock.Unlock()
+	state, ok := df.fileBlockStates[ptr]
+	if !ok || !state.streaming {
+		return false
+	}
+	state.streaming = false
+	df.fileBlockStates[ptr] = state
+	return true
+}
+
 func (df *dirtyFile) addDeferredNewBytes(bytes int64) {
 	df.lock.Lock()
 	defer df.lock.Unlock()
@@ -50,6 +50,18 @@ func (e NoSuchNameError) Error() string {
 	return fmt.Sprintf("%s doesn't exist", e.Name)
 }
 
+// NoSuchRevisionError indicates that a folder has no merged revision
+// with the given number.
+type NoSuchRevisionError struct {
+	Tlf tlf.ID
+	Rev MetadataRevision
+}
+
+// Error implements the error interface for NoSuchRevisionError
+func (e NoSuchRevisionError) Error() string {
+	return fmt.Sprintf("Folder %s has no revision %d", e.Tlf, e.Rev)
+}
+
 // NoSuchUserError indicates that the given user couldn't be resolved.
 type NoSuchUserError struct {
 	Input string
@@ -69,6 +81,29 @@ func (e NoSuchUserError) ToStatus() keybase1.Status {
 	}
 }
 
+// NoSuchTeamError indicates that the given team doesn't exist.
+type NoSuchTeamError struct {
+	Input string
+}
+
+// Error implements the error interface for NoSuchTeamError
+func (e NoSuchTeamError) Error() string {
+	return fmt.Sprintf("%s is not a Keybase team", e.Input)
+}
+
+// TeamLoadUnsupportedError indicates that the membership of a team
+// can't be loaded, because the keybase service has no verified team
+// loader.
+type TeamLoadUnsupportedError struct {
+	Tid keybase1.UID
+}
+
+// Error implements the error interface for TeamLoadUnsupportedError.
+func (e TeamLoadUnsupportedError) Error() string {
+	return fmt.Sprintf("Can't load team %s: the keybase service "+
+		"doesn't support verified team loading", e.Tid)
+}
+
 // BadTLFNameError indicates a top-level folder name that has an
 // incorrect format.
 type BadTLFNameError struct {
@@ -1221,3 +1256,79 @@ type NoMergedMDError struct {
 func (e NoMergedMDError) Error() string {
 	return fmt.Sprintf("No MD yet for TLF %s", e.tlf)
 }
+
+// DirInUseError indicates that a local server directory is already
+// locked by another KBFS process.
+type DirInUseError struct {
+	Dir string
+}
+
+// Error implements the error interface for DirInUseError.
+func (e DirInUseError) Error() string {
+	return fmt.Sprintf("%s is already in use by another KBFS process", e.Dir)
+}
+
+// S3PrefixInUseError indicates that a local server's bucket prefix
+// is already leased by another KBFS server.
+type S3PrefixInUseError struct {
+	Prefix string
+	Owner  string
+}
+
+// Error implements the error interface for S3PrefixInUseError.
+func (e S3PrefixInUseError) Error() string {
+	return fmt.Sprintf("%s is already in use by another KBFS server (%s)",
+		e.Prefix, e.Owner)
+}
+
+// UnencryptedPrivateBlockError indicates that a block of a private
+// TLF wasn't encrypted, which is only allowed for public TLFs.
+type UnencryptedPrivateBlockError struct {
+	tlfID tlf.ID
+	ptr   BlockPointer
+}
+
+// Error implements the error interface for UnencryptedPrivateBlockError.
+func (e UnencryptedPrivateBlockError) Error() string {
+	return fmt.Sprintf("Block %v of private TLF %s isn't encrypted",
+		e.ptr, e.tlfID)
+}
+
+// NoSuchXattrError indicates that a file or directory has no extended
+// attribute with the given name.
+type NoSuchXattrError struct {
+	Name string
+}
+
+// Error implements the error interface for NoSuchXattrError.
+func (e NoSuchXattrError) Error() string {
+	return fmt.Sprintf("No extended attribute named %q", e.Name)
+}
+
+// XattrNameTooLongError indicates that the user tried to set an
+// extended attribute with a name longer than KBFS supports.
+type XattrNameTooLongError struct {
+	name            string
+	maxAllowedBytes int
+}
+
+// Error implements the error interface for XattrNameTooLongError.
+func (e XattrNameTooLongError) Error() string {
+	return fmt.Sprintf("Extended attribute name %q has more than the "+
+		"maximum allowed number of bytes (%d)", e.name, e.maxAllowedBytes)
+}
+
+// XattrTooBigError indicates that the user tried to set an extended
+// attribute to a value bigger than KBFS supports.
+type XattrTooBigError struct {
+	name            string
+	size            int
+	maxAllowedBytes int
+}
+
+// Error implements the error interface for XattrTooBigError.
+func (e XattrTooBigError) Error() string {
+	return fmt.Sprintf("Extended attribute %q would be %d bytes, which is "+
+		"over the supported limit of %d bytes", e.name, e.size,
+		e.maxAllowedBytes)
+}
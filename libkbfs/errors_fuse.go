@@ -133,3 +133,35 @@ var _ fuse.ErrorNumber = NoSuchFolderListError{}
 func (e NoSuchFolderListError) Errno() fuse.Errno {
 	return fuse.Errno(syscall.ENOENT)
 }
+
+var _ fuse.ErrorNumber = NoSuchXattrError{}
+
+// Errno implements the fuse.ErrorNumber interface for
+// NoSuchXattrError.
+func (e NoSuchXattrError) Errno() fuse.Errno {
+	return fuse.ErrNoXattr
+}
+
+var _ fuse.ErrorNumber = XattrNameTooLongError{}
+
+// Errno implements the fuse.ErrorNumber interface for
+// XattrNameTooLongError.
+func (e XattrNameTooLongError) Errno() fuse.Errno {
+	return fuse.Errno(syscall.ERANGE)
+}
+
+var _ fuse.ErrorNumber = XattrTooBigError{}
+
+// Errno implements the fuse.ErrorNumber interface for
+// XattrTooBigError.
+func (e XattrTooBigError) Errno() fuse.Errno {
+	return fuse.Errno(syscall.E2BIG)
+}
+
+var _ fuse.ErrorNumber = NoSuchRevisionError{}
+
+// Errno implements the fuse.ErrorNumber interface for
+// NoSuchRevisionError.
+func (e NoSuchRevisionError) Errno() fuse.Errno {
+	return fuse.Errno(syscall.ENOENT)
+}
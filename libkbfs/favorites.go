@@ -65,6 +65,9 @@ type Favorites struct {
 	inFlightLock sync.Mutex
 	inFlightAdds map[favToAdd]*favReq
 
+	observersLock sync.Mutex
+	observers     map[FavoritesObserver]bool
+
 	muShutdown sync.RWMutex
 	shutdown   bool
 }
@@ -74,6 +77,7 @@ func newFavoritesWithChan(config Config, reqChan chan *favReq) *Favorites {
 		config:       config,
 		reqChan:      reqChan,
 		inFlightAdds: make(map[favToAdd]*favReq),
+		observers:    make(map[FavoritesObserver]bool),
 	}
 	go f.loop()
 	return f
@@ -94,8 +98,75 @@ func (f *Favorites) closeReq(req *favReq, err error) {
 	}
 }
 
+func (f *Favorites) registerForChanges(obs FavoritesObserver) {
+	f.observersLock.Lock()
+	defer f.observersLock.Unlock()
+	f.observers[obs] = true
+}
+
+func (f *Favorites) unregisterFromChanges(obs FavoritesObserver) {
+	f.observersLock.Lock()
+	defer f.observersLock.Unlock()
+	delete(f.observers, obs)
+}
+
+// notifyChanged tells all the observers that the favorites list has
+// changed. The observers are called in the background, since they
+// may well want to fetch the new list.
+func (f *Favorites) notifyChanged() {
+	f.observersLock.Lock()
+	defer f.observersLock.Unlock()
+	for obs := range f.observers {
+		go obs.FavoritesChanged(context.Background())
+	}
+}
+
+// refresh replaces the cached favorites with the server's list, and
+// returns whether the list changed. If the server can't be reached
+// and there is a cached list, the cached list is kept.
+func (f *Favorites) refresh(ctx context.Context) (changed bool, err error) {
+	folders, err := f.config.KBPKI().FavoriteList(ctx)
+	if err != nil {
+		if f.cache == nil || ctx.Err() != nil {
+			return false, err
+		}
+		f.config.MakeLogger("").CWarningf(ctx, "Couldn't fetch the "+
+			"favorites list, using the cached one: %+v", err)
+		return false, nil
+	}
+
+	cache := make(map[Favorite]bool)
+	for _, folder := range folders {
+		cache[*NewFavoriteFromFolder(folder)] = true
+	}
+	username, _, err := f.config.KBPKI().GetCurrentUserInfo(ctx)
+	if err == nil {
+		// Add favorites for the current user, that cannot be deleted.
+		cache[Favorite{string(username), true}] = true
+		cache[Favorite{string(username), false}] = true
+	}
+
+	changed = f.cache != nil && len(cache) != len(f.cache)
+	if f.cache != nil && !changed {
+		for fav := range cache {
+			if !f.cache[fav] {
+				changed = true
+				break
+			}
+		}
+	}
+	f.cache = cache
+	return changed, nil
+}
+
 func (f *Favorites) handleReq(req *favReq) (err error) {
-	defer func() { f.closeReq(req, err) }()
+	changed := false
+	defer func() {
+		f.closeReq(req, err)
+		if changed {
+			f.notifyChanged()
+		}
+	}()
 
 	kbpki := f.config.KBPKI()
 	// Fetch a new list if:
@@ -104,21 +175,10 @@ func (f *Favorites) handleReq(req *favReq) (err error) {
 	//  * The user wants the list of favorites.  TODO: use the cached list
 	//    once we have proper invalidation from the server.
 	if req.refresh || f.cache == nil || req.favs != nil {
-		folders, err := kbpki.FavoriteList(req.ctx)
+		changed, err = f.refresh(req.ctx)
 		if err != nil {
 			return err
 		}
-
-		f.cache = make(map[Favorite]bool)
-		for _, folder := range folders {
-			f.cache[*NewFavoriteFromFolder(folder)] = true
-		}
-		username, _, err := f.config.KBPKI().GetCurrentUserInfo(req.ctx)
-		if err == nil {
-			// Add favorites for the current user, that cannot be deleted.
-			f.cache[Favorite{string(username), true}] = true
-			f.cache[Favorite{string(username), false}] = true
-		}
 	}
 
 	for _, fav := range req.toAdd {
@@ -131,6 +191,9 @@ func (f *Favorites) handleReq(req *favReq) (err error) {
 				"Failure adding favorite %v: %v", fav, err)
 			return err
 		}
+		if !f.cache[fav.Favorite] {
+			changed = true
+		}
 		f.cache[fav.Favorite] = true
 	}
 
@@ -142,6 +205,9 @@ func (f *Favorites) handleReq(req *favReq) (err error) {
 		if err != nil {
 			return err
 		}
+		if f.cache[fav] {
+			changed = true
+		}
 		delete(f.cache, fav)
 	}
 
@@ -311,8 +377,8 @@ func (f *Favorites) RefreshCache(ctx context.Context) {
 	}
 }
 
-// Get returns the logged-in users list of favorites. It
-// doesn't use the cache.
+// Get returns the logged-in users list of favorites. It only uses
+// the cache if the server can't be reached.
 func (f *Favorites) Get(ctx context.Context) ([]Favorite, error) {
 	if f.hasShutdown() {
 		return nil, ShutdownHappenedError{}
@@ -10,6 +10,8 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 )
 
@@ -187,3 +189,72 @@ func TestFavoritesListFailsDuringAddAsync(t *testing.T) {
 	f.AddAsync(ctx, fav1) // should work
 	<-c
 }
+
+type testFavoritesObserver struct {
+	c chan struct{}
+}
+
+func (o testFavoritesObserver) FavoritesChanged(_ context.Context) {
+	o.c <- struct{}{}
+}
+
+func TestFavoritesListOffline(t *testing.T) {
+	mockCtrl, config, ctx := favTestInit(t)
+	f := NewFavorites(config)
+	defer favTestShutdown(t, mockCtrl, config, f)
+
+	folders := []keybase1.Folder{{Name: "test", Private: true}}
+	config.mockKbpki.EXPECT().FavoriteList(gomock.Any()).Return(folders, nil)
+	favs, err := f.Get(ctx)
+	require.NoError(t, err)
+	require.Len(t, favs, 3)
+
+	// While the service is unreachable, the cached list is used.
+	config.mockKbpki.EXPECT().FavoriteList(gomock.Any()).
+		Return(nil, errors.New("Fake disconnection"))
+	offlineFavs, err := f.Get(ctx)
+	require.NoError(t, err)
+	require.Len(t, offlineFavs, 3)
+	require.Contains(t, offlineFavs, Favorite{"test", false})
+}
+
+func TestFavoritesChangedNotification(t *testing.T) {
+	mockCtrl, config, ctx := favTestInit(t)
+	f := NewFavorites(config)
+	defer favTestShutdown(t, mockCtrl, config, f)
+
+	obs := testFavoritesObserver{make(chan struct{}, 10)}
+	f.registerForChanges(obs)
+
+	// The initial fetch isn't a change, but the add is.
+	fav1 := favToAdd{Favorite{"test", true}, false}
+	config.mockKbpki.EXPECT().FavoriteList(gomock.Any()).Return(nil, nil)
+	config.mockKbpki.EXPECT().FavoriteAdd(gomock.Any(), fav1.toKBFolder()).
+		Return(nil)
+	err := f.Add(ctx, fav1)
+	require.NoError(t, err)
+	<-obs.c
+
+	// A refresh that finds a new favorite is a change; one that
+	// doesn't isn't.
+	folders := []keybase1.Folder{
+		fav1.toKBFolder(),
+		{Name: "test2", Private: true},
+	}
+	config.mockKbpki.EXPECT().FavoriteList(gomock.Any()).Return(folders, nil)
+	f.RefreshCache(ctx)
+	<-obs.c
+	config.mockKbpki.EXPECT().FavoriteList(gomock.Any()).Return(folders, nil)
+	f.RefreshCache(ctx)
+
+	config.mockKbpki.EXPECT().FavoriteDelete(gomock.Any(), gomock.Any()).
+		Return(nil)
+	err = f.Delete(ctx, Favorite{"test2", false})
+	require.NoError(t, err)
+	<-obs.c
+
+	err = f.wg.Wait(ctx)
+	require.NoError(t, err)
+	f.unregisterFromChanges(obs)
+	require.Len(t, obs.c, 0)
+}
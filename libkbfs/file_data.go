@@ -417,6 +417,52 @@ func (fd *fileData) getIndirectBlocksForOffsetRange(ctx context.Context,
 	return pfr, nil
 }
 
+// getReadAheadPtrs returns, in file order, the pointers of up to `n`
+// blocks that follow the leaf block containing offset `off`, for
+// prefetching ahead of a sequential read. If the parent of that leaf
+// runs out of children first, it adds the next indirect block at the
+// nearest level that has one, so that the read after that finds the
+// next set of children cached. The indirect blocks down to `off`
+// should already be cached by the read that's being followed.
+func (fd *fileData) getReadAheadPtrs(ctx context.Context, off int64,
+	n int) ([]BlockPointer, error) {
+	topBlock, _, err := fd.getter(ctx, fd.kmd, fd.rootBlockPointer(),
+		fd.file, blockRead)
+	if err != nil {
+		return nil, err
+	}
+	if !topBlock.IsInd || n <= 0 {
+		return nil, nil
+	}
+
+	pfr, err := fd.getIndirectBlocksForOffsetRange(ctx, topBlock, off, off+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(pfr) == 0 || len(pfr[len(pfr)-1]) == 0 {
+		return nil, nil
+	}
+	p := pfr[len(pfr)-1]
+
+	lowest := p[len(p)-1]
+	var ptrs []BlockPointer
+	for _, iptr := range lowest.pblock.IPtrs[lowest.childIndex+1:] {
+		if len(ptrs) == n {
+			return ptrs, nil
+		}
+		ptrs = append(ptrs, iptr.BlockPointer)
+	}
+	for level := len(p) - 2; level >= 0 && len(ptrs) < n; level-- {
+		pbci := p[level]
+		if pbci.childIndex+1 < len(pbci.pblock.IPtrs) {
+			ptrs = append(ptrs,
+				pbci.pblock.IPtrs[pbci.childIndex+1].BlockPointer)
+			break
+		}
+	}
+	return ptrs, nil
+}
+
 // getByteSlicesInOffsetRange returns an ordered, continuous slice of
 // byte ranges for the data described by the half-inclusive offset
 // range `[startOff, endOff)`.  If `endOff` == -1, it returns data to
@@ -1643,6 +1689,103 @@ func (fd *fileData) ready(ctx context.Context, id tlf.ID, bcache BlockCache,
 	return fd.readyHelper(ctx, id, bcache, bops, bps, dirtyLeafPaths, df)
 }
 
+// streamedBlock is a completed dirty leaf block of a file, readied
+// so that it can be put to the server ahead of the file's next sync.
+type streamedBlock struct {
+	// The offset of the block within the file.
+	off int64
+	// The (dirty) pointer the file currently uses for the block.
+	oldPtr BlockPointer
+	// The info of the readied block, to replace oldPtr.
+	newInfo        BlockInfo
+	readyBlockData ReadyBlockData
+	// Whether the put of the readied block succeeded.
+	put bool
+}
+
+// readyCompletedBlocks, if given an indirect top-block, readies the
+// dirty leaf blocks that end at or before `off`, i.e., those that a
+// sequential writer is done with.  The file's last block is never
+// included, since it may still grow, and neither are blocks that a
+// sync would split differently.  Unlike `ready`, this doesn't update
+// the parent blocks; see `setLeafPointer`.
+func (fd *fileData) readyCompletedBlocks(ctx context.Context,
+	bcache BlockCache, dirtyBcache DirtyBlockCache, bops BlockOps,
+	topBlock *FileBlock, off int64) ([]streamedBlock, error) {
+	if !topBlock.IsInd {
+		return nil, nil
+	}
+
+	var blocks []streamedBlock
+	for currOff := int64(0); currOff >= 0; {
+		ptr, _, block, nextBlockOff, startOff, err :=
+			fd.getNextDirtyFileBlockAtOffset(
+				ctx, topBlock, currOff, blockWrite, dirtyBcache)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil || nextBlockOff < 0 ||
+			startOff+int64(len(block.Contents)) > off {
+			// No more completed blocks.
+			break
+		}
+		currOff = nextBlockOff
+
+		if len(block.Contents) == 0 || fd.bsplit.CheckSplit(block) != 0 {
+			continue
+		}
+
+		newInfo, _, readyBlockData, err := ReadyBlock(
+			ctx, bcache, bops, fd.crypto, fd.kmd, block, fd.uid)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, streamedBlock{
+			off:            startOff,
+			oldPtr:         ptr,
+			newInfo:        newInfo,
+			readyBlockData: readyBlockData,
+		})
+	}
+	return blocks, nil
+}
+
+// setLeafPointer points the parent of the leaf block at `off` to
+// `newInfo` instead, as long as that leaf block is still `oldPtr`.
+// It returns whether the leaf block was found.
+func (fd *fileData) setLeafPointer(ctx context.Context, topBlock *FileBlock,
+	off int64, oldPtr BlockPointer, newInfo BlockInfo) (bool, error) {
+	block := topBlock
+	for block.IsInd {
+		index := len(block.IPtrs) - 1
+		for i, iptr := range block.IPtrs {
+			if iptr.Off == off {
+				index = i
+				break
+			} else if iptr.Off > off {
+				index = i - 1
+				break
+			}
+		}
+
+		iptr := block.IPtrs[index]
+		if iptr.BlockPointer == oldPtr {
+			block.IPtrs[index].BlockInfo = newInfo
+			return true, nil
+		} else if iptr.DirectType == DirectBlock {
+			return false, nil
+		}
+
+		var err error
+		block, _, err = fd.getter(
+			ctx, fd.kmd, iptr.BlockPointer, fd.file, blockWrite)
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
 func (fd *fileData) getIndirectFileBlockInfosWithTopBlock(ctx context.Context,
 	topBlock *FileBlock) ([]BlockInfo, error) {
 	if !topBlock.IsInd {
@@ -858,3 +858,36 @@ func TestFileDataWriteExtendExistingFileWithGap(t *testing.T) {
 		})
 	}
 }
+
+func TestFileDataGetReadAheadPtrs(t *testing.T) {
+	// 16 leaf blocks, under 4 parents, under one top block.
+	fd, cleanBcache, _, _ := setupFileDataTest(t, 2, 4)
+	data := make([]byte, 32)
+	topBlock, levels := testFileDataLevelExistingBlocks(
+		t, fd, 2, 4, data, nil, cleanBcache)
+	require.Equal(t, 3, levels)
+	parentPtr := func(i int) BlockPointer {
+		return topBlock.IPtrs[i].BlockPointer
+	}
+	leafPtr := func(i int) BlockPointer {
+		block, err := cleanBcache.Get(parentPtr(i / 4))
+		require.NoError(t, err)
+		return block.(*FileBlock).IPtrs[i%4].BlockPointer
+	}
+	ctx := context.Background()
+
+	// The siblings following the block containing the offset.
+	ptrs, err := fd.getReadAheadPtrs(ctx, 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, []BlockPointer{leafPtr(1), leafPtr(2)}, ptrs)
+
+	// Running out of siblings moves on to the next parent.
+	ptrs, err = fd.getReadAheadPtrs(ctx, 4, 5)
+	require.NoError(t, err)
+	require.Equal(t, []BlockPointer{leafPtr(3), parentPtr(1)}, ptrs)
+
+	// Nothing follows the last block.
+	ptrs, err = fd.getReadAheadPtrs(ctx, 31, 5)
+	require.NoError(t, err)
+	require.Len(t, ptrs, 0)
+}
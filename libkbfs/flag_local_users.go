@@ -0,0 +1,111 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/keybase/client/go/libkb"
+)
+
+// LocalUserSpec describes a fake local user, to be used when running
+// against a local KeybaseService. Keys for the user are generated
+// deterministically from its name.
+type LocalUserSpec struct {
+	Name    libkb.NormalizedUsername
+	Asserts []string
+}
+
+// String returns spec in the format accepted by ParseLocalUserSpecs.
+func (spec LocalUserSpec) String() string {
+	if len(spec.Asserts) == 0 {
+		return string(spec.Name)
+	}
+	return fmt.Sprintf("%s=%s", spec.Name, strings.Join(spec.Asserts, "+"))
+}
+
+// defaultLocalUserSpecs is the list of local users to use when none
+// are specified explicitly.
+var defaultLocalUserSpecs = []LocalUserSpec{
+	{"strib", []string{"github:strib"}},
+	{"max", []string{"twitter:maxtaco"}},
+	{"chris", []string{"twitter:malgorithms"}},
+	{"akalin", []string{"twitter:fakalin"}},
+	{"jzila", []string{"twitter:jzila"}},
+	{"alness", []string{"github:aalness"}},
+	{"jinyang", []string{"github:jinyangli"}},
+	{"songgao", []string{"github:songgao"}},
+	{"taru", nil},
+	{"zanderz", []string{"github:zanderz"}},
+}
+
+// ParseLocalUserSpecs parses a comma-separated list of local users,
+// each of the form name[=assertion[+assertion...]], e.g.
+// "alice=github:alice+twitter:alice,bob".
+func ParseLocalUserSpecs(raw string) ([]LocalUserSpec, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var specs []LocalUserSpec
+	seen := make(map[libkb.NormalizedUsername]bool)
+	for _, entry := range strings.Split(raw, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		name := libkb.NewNormalizedUsername(strings.TrimSpace(parts[0]))
+		if name == "" {
+			return nil, fmt.Errorf("Empty local user name in %q", raw)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("Duplicate local user %s", name)
+		}
+		seen[name] = true
+		spec := LocalUserSpec{Name: name}
+		if len(parts) == 2 {
+			for _, assert := range strings.Split(parts[1], "+") {
+				assert = strings.TrimSpace(assert)
+				if assert == "" {
+					return nil, fmt.Errorf(
+						"Empty assertion for local user %s", name)
+				}
+				spec.Asserts = append(spec.Asserts, assert)
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// LocalUsersFlag is for specifying a list of local users with the
+// flag package.
+type LocalUsersFlag struct {
+	v *[]LocalUserSpec
+}
+
+// Get for flag interface.
+func (lf LocalUsersFlag) Get() interface{} { return *lf.v }
+
+// String for flag interface.
+func (lf LocalUsersFlag) String() string {
+	// This happens when isZeroValue() from flag.go makes a zero
+	// value from the type of a flag.
+	if lf.v == nil {
+		return ""
+	}
+	strs := make([]string, 0, len(*lf.v))
+	for _, spec := range *lf.v {
+		strs = append(strs, spec.String())
+	}
+	return strings.Join(strs, ",")
+}
+
+// Set for flag interface.
+func (lf LocalUsersFlag) Set(raw string) error {
+	specs, err := ParseLocalUserSpecs(raw)
+	if err != nil {
+		return err
+	}
+	*lf.v = specs
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestParseLocalUserSpecs(t *testing.T) {
+	specs, err := ParseLocalUserSpecs(
+		"Alice=github:alice+twitter:alice,bob")
+	require.NoError(t, err)
+	require.Equal(t, []LocalUserSpec{
+		{"alice", []string{"github:alice", "twitter:alice"}},
+		{"bob", nil},
+	}, specs)
+
+	specs, err = ParseLocalUserSpecs("")
+	require.NoError(t, err)
+	require.Nil(t, specs)
+
+	for _, bad := range []string{",bob", "bob,bob", "bob=", "bob=a++b"} {
+		_, err = ParseLocalUserSpecs(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestLocalUsersFlag(t *testing.T) {
+	var specs []LocalUserSpec
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(LocalUsersFlag{&specs}, "localusers", "")
+	err := fs.Parse([]string{"-localusers", "alice=github:alice,bob"})
+	require.NoError(t, err)
+	require.Equal(t, "alice=github:alice,bob",
+		LocalUsersFlag{&specs}.String())
+}
+
+func TestKeybaseDaemonArbitraryLocalUsers(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "test_user")
+	defer config.Shutdown(context.Background())
+
+	params := InitParams{
+		LocalUser: "carol",
+		LocalUsers: []LocalUserSpec{
+			{"alice", nil},
+			{"carol", []string{"github:carol"}},
+		},
+		LocalFavoriteStorage: memoryAddr,
+	}
+	service, err := (&keybaseDaemon{}).NewKeybaseService(
+		config, params, nil, config.MakeLogger(""))
+	require.NoError(t, err)
+	defer service.Shutdown()
+
+	session, err := service.CurrentSession(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, "carol", string(session.Name))
+
+	name, _, err := service.Resolve(context.Background(), "github:carol")
+	require.NoError(t, err)
+	require.Equal(t, "carol", string(name))
+
+	params.LocalUser = "strib"
+	_, err = (&keybaseDaemon{}).NewKeybaseService(
+		config, params, nil, config.MakeLogger(""))
+	require.Error(t, err)
+}
@@ -406,8 +406,9 @@ func (fbm *folderBlockManager) doChunkedDowngrades(ctx context.Context,
 	numChunks := (len(ptrs) + numPointersToDowngradePerChunk - 1) /
 		numPointersToDowngradePerChunk
 	numWorkers := numChunks
-	if numWorkers > maxParallelBlockPuts {
-		numWorkers = maxParallelBlockPuts
+	if maxParallel := fbm.config.MaxParallelBlockPuts(); maxParallel > 0 &&
+		numWorkers > maxParallel {
+		numWorkers = maxParallel
 	}
 	chunks := make(chan []BlockPointer, numChunks)
 
@@ -8,12 +8,14 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/keybase/client/go/logger"
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfsblock"
 	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/kbfssync"
 	"github.com/keybase/kbfs/tlf"
 	"golang.org/x/net/context"
 	"golang.org/x/sync/errgroup"
@@ -188,6 +190,11 @@ type folderBlockOps struct {
 	// Sync().  It is a blocking channel.
 	forceSyncChan chan<- struct{}
 
+	// Tracks writes that are putting completed blocks to the server
+	// ahead of a sync (see StartStreaming); syncs wait for them, so
+	// that they can rely on those blocks being on the server.
+	streamingPuts kbfssync.RepeatedWaitGroup
+
 	// protects access to blocks in this folder and all fields
 	// below.
 	blockLock blockLock
@@ -466,6 +473,57 @@ func (fbo *folderBlockOps) getDirBlockHelperLocked(ctx context.Context,
 		return nil, NotDirBlockError{ptr, branch, p}
 	}
 
+	if dblock.IsInd {
+		return fbo.assembleIndirectDirBlockLocked(
+			ctx, lState, kmd, ptr, branch, dblock)
+	}
+	return dblock, nil
+}
+
+// assembleIndirectDirBlockLocked fetches all the child blocks of the
+// given indirect directory block in parallel, and merges them into
+// one block, which then replaces the indirect block in the cache.
+func (fbo *folderBlockOps) assembleIndirectDirBlockLocked(
+	ctx context.Context, lState *lockState, kmd KeyMetadata,
+	ptr BlockPointer, branch BranchName, top *DirBlock) (*DirBlock, error) {
+	if lState != nil {
+		fbo.blockLock.AssertAnyLocked(lState)
+	}
+
+	children := make([]*DirBlock, len(top.IPtrs))
+	eg, groupCtx := errgroup.WithContext(ctx)
+	for i, iptr := range top.IPtrs {
+		i, iptr := i, iptr
+		eg.Go(func() error {
+			block, err := fbo.getBlockHelperLocked(groupCtx, nil, kmd,
+				iptr.BlockPointer, branch, NewDirBlock, TransientEntry,
+				path{}, blockReadParallel)
+			if err != nil {
+				return err
+			}
+			child, ok := block.(*DirBlock)
+			if !ok {
+				return NotDirBlockError{iptr.BlockPointer, branch, path{}}
+			}
+			children[i] = child
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	dblock, err := assembleIndirectDirBlock(top, children)
+	if err != nil {
+		return nil, err
+	}
+	// Cache the assembled block so it doesn't need to be put
+	// together again on every access.
+	if err := fbo.config.BlockCache().Put(
+		ptr, fbo.id(), dblock, TransientEntry); err != nil {
+		fbo.log.CDebugf(ctx, "Couldn't cache assembled dir block %v: %+v",
+			ptr, err)
+	}
 	return dblock, nil
 }
 
@@ -817,6 +875,113 @@ func (fbo *folderBlockOps) GetDirtyDirChildren(
 	return children, nil
 }
 
+// dirChildrenPage returns, sorted by name, up to `maxEntries`
+// children of dblock whose names sort after `after`, and whether
+// there are more children after those.
+func dirChildrenPage(dblock *DirBlock, after string, maxEntries int) (
+	[]DirChild, bool) {
+	names := make([]string, 0, len(dblock.Children))
+	for name := range dblock.Children {
+		if name > after {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	more := len(names) > maxEntries
+	if more {
+		names = names[:maxEntries]
+	}
+
+	children := make([]DirChild, 0, len(names))
+	for _, name := range names {
+		children = append(children,
+			DirChild{name, dblock.Children[name].EntryInfo})
+	}
+	return children, more
+}
+
+// GetDirtyDirChildrenPage returns, sorted by name, up to `maxEntries`
+// EntryInfos for the (possibly dirty) children entries of the given
+// directory whose names sort after `after`.  It also returns whether
+// there are more children after those.  For an indirect directory,
+// only the child blocks covering the page are fetched and sorted.
+func (fbo *folderBlockOps) GetDirtyDirChildrenPage(
+	ctx context.Context, lState *lockState, kmd KeyMetadata, dir path,
+	after string, maxEntries int) ([]DirChild, bool, error) {
+	fbo.blockLock.RLock(lState)
+	defer fbo.blockLock.RUnlock(lState)
+
+	// The entries of a dirty directory may have moved between its
+	// child blocks, so read it as a whole.
+	var iptrs []IndirectDirPtr
+	if !fbo.config.DirtyBlockCache().IsDirty(
+		fbo.id(), dir.tailPointer(), dir.Branch) {
+		// This is either the indirect top block, or the assembled
+		// block that replaced it in the cache; both keep the
+		// pointers to the child blocks.
+		block, err := fbo.getBlockHelperLocked(ctx, lState, kmd,
+			dir.tailPointer(), dir.Branch, NewDirBlock, TransientEntry,
+			path{}, blockRead)
+		if err != nil {
+			return nil, false, err
+		}
+		dblock, ok := block.(*DirBlock)
+		if !ok {
+			return nil, false, NotDirBlockError{
+				dir.tailPointer(), dir.Branch, dir}
+		}
+		iptrs = dblock.IPtrs
+	}
+	if len(iptrs) == 0 {
+		dblock, err := fbo.getDirtyDirLocked(
+			ctx, lState, kmd, dir, blockRead)
+		if err != nil {
+			return nil, false, err
+		}
+		children, more := dirChildrenPage(dblock, after, maxEntries)
+		return children, more, nil
+	}
+
+	// Start with the last child block whose range begins at or
+	// before `after`; the ranges are sorted, and cover every name.
+	i := sort.Search(len(iptrs), func(i int) bool {
+		return iptrs[i].Off > after
+	}) - 1
+	if i < 0 {
+		i = 0
+	}
+	children := make([]DirChild, 0, maxEntries)
+	for ; i < len(iptrs); i++ {
+		if len(children) == maxEntries {
+			// Empty child blocks are dropped on sync, so the
+			// next one has at least one more entry.
+			return children, true, nil
+		}
+		block, err := fbo.getBlockHelperLocked(ctx, lState, kmd,
+			iptrs[i].BlockPointer, dir.Branch, NewDirBlock, TransientEntry,
+			path{}, blockRead)
+		if err != nil {
+			return nil, false, err
+		}
+		child, ok := block.(*DirBlock)
+		if !ok {
+			return nil, false, NotDirBlockError{
+				iptrs[i].BlockPointer, dir.Branch, dir}
+		}
+		child, err = fbo.updateWithDirtyEntriesLocked(ctx, lState, child)
+		if err != nil {
+			return nil, false, err
+		}
+		page, more := dirChildrenPage(
+			child, after, maxEntries-len(children))
+		children = append(children, page...)
+		if more {
+			return children, true, nil
+		}
+	}
+	return children, false, nil
+}
+
 // file must have a valid parent.
 func (fbo *folderBlockOps) getDirtyParentAndEntryLocked(ctx context.Context,
 	lState *lockState, kmd KeyMetadata, file path, rtype blockReqType) (
@@ -1062,6 +1227,17 @@ func (fbo *folderBlockOps) nowUnixNano() int64 {
 	return fbo.config.Clock().Now().UnixNano()
 }
 
+// stampDirtyEntryTimes sets the mtime and ctime of a file's
+// dirty directory entry at the time its contents change.  The times
+// then stick with the entry until the file is synced, so that an
+// explicit SetMtime made between a write and the sync (e.g., by
+// `cp -p` or rsync) isn't lost.
+func (fbo *folderBlockOps) stampDirtyEntryTimes(de *DirEntry) {
+	now := fbo.nowUnixNano()
+	de.Mtime = now
+	de.Ctime = now
+}
+
 // PrepRename prepares the given rename operation. It returns copies
 // of the old and new parent block (which may be the same), what is to
 // be the new DirEntry, and a local block cache. It also modifies md,
@@ -1195,7 +1371,43 @@ func (fbo *folderBlockOps) Read(
 
 	var uid keybase1.UID // Data reads don't depend on the uid.
 	fd := fbo.newFileData(lState, file, uid, kmd)
-	return fd.read(ctx, dest, off)
+	n, err := fd.read(ctx, dest, off)
+	if err == nil && n > 0 {
+		fbo.readAheadLocked(ctx, lState, kmd, file, fd, off+n-1)
+	}
+	return n, err
+}
+
+// readAheadLocked asks the prefetcher for the blocks that follow the
+// one containing offset `off` of `file`, as configured by
+// Config.ReadAhead, so a reader moving through the file sequentially
+// doesn't wait on a round trip for every block.
+func (fbo *folderBlockOps) readAheadLocked(ctx context.Context,
+	lState *lockState, kmd KeyMetadata, file path, fd *fileData,
+	off int64) {
+	fbo.blockLock.AssertRLocked(lState)
+	readAhead := fbo.config.ReadAhead()
+	if readAhead.Blocks <= 0 {
+		return
+	}
+	// The pointers of a file being written may not be on the
+	// server yet.
+	if fbo.config.DirtyBlockCache().IsDirty(
+		fbo.id(), file.tailPointer(), file.Branch) {
+		return
+	}
+
+	ptrs, err := fd.getReadAheadPtrs(ctx, off, readAhead.Blocks)
+	if err != nil {
+		fbo.log.CDebugf(ctx, "Couldn't find blocks to read ahead: %+v", err)
+		return
+	}
+	prefetcher := fbo.config.BlockOps().Prefetcher()
+	for _, ptr := range ptrs {
+		// An error only means the prefetcher is shut down.
+		_ = prefetcher.PrefetchBlock(
+			&FileBlock{}, ptr, kmd, readAhead.Priority)
+	}
 }
 
 func (fbo *folderBlockOps) maybeWaitOnDeferredWrites(
@@ -1349,6 +1561,7 @@ func (fbo *folderBlockOps) writeDataLocked(
 	// the `deCache` is used to determine whether there are any dirty
 	// files.  TODO: combine `deCache` with `dirtyFiles` and
 	// `unrefCache`.
+	fbo.stampDirtyEntryTimes(&newDe)
 	fbo.deCache[file.tailPointer().Ref()] = newDe
 
 	if fbo.doDeferWrite {
@@ -1435,6 +1648,172 @@ func (fbo *folderBlockOps) Write(
 	return nil
 }
 
+// StartStreaming readies the completed dirty blocks of the given
+// file that end at or before `off`, so that the caller can put them
+// to the server ahead of the file's next sync, instead of keeping
+// them in memory until then.  If any blocks are returned, the caller
+// must pass them to FinishStreaming once the given puts are done,
+// whether or not they succeeded.
+func (fbo *folderBlockOps) StartStreaming(
+	ctx context.Context, lState *lockState, kmd KeyMetadata,
+	file Node, off int64) (blocks []streamedBlock, bps *blockPutState,
+	err error) {
+	fbo.blockLock.Lock(lState)
+	defer fbo.blockLock.Unlock(lState)
+
+	filePath, err := fbo.pathFromNodeForBlockWriteLocked(lState, file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Leave everything to an ongoing sync; any writes made during it
+	// will be redone afterward anyway.
+	df := fbo.dirtyFiles[filePath.tailPointer()]
+	if df == nil || df.isBlockSyncing(filePath.tailPointer()) {
+		return nil, nil, nil
+	}
+
+	fblock, uid, err := fbo.writeGetFileLocked(ctx, lState, kmd, filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fd := fbo.newFileData(lState, filePath, uid, kmd)
+	blocks, err = fd.readyCompletedBlocks(ctx, fbo.config.BlockCache(),
+		fbo.config.DirtyBlockCache(), fbo.config.BlockOps(), fblock, off)
+	if err != nil || len(blocks) == 0 {
+		return nil, nil, err
+	}
+
+	bps = newBlockPutState(len(blocks))
+	for i := range blocks {
+		b := &blocks[i]
+		df.setBlockStreaming(b.oldPtr)
+		// Leave out the block itself, since writes may modify it
+		// while it's being put.
+		bps.addNewBlock(b.newInfo.BlockPointer, nil, b.readyBlockData,
+			func() error {
+				b.put = true
+				return nil
+			})
+		b.readyBlockData = ReadyBlockData{}
+	}
+	fbo.streamingPuts.Add(1)
+	return blocks, bps, nil
+}
+
+// FinishStreaming replaces the dirty versions of the given streamed
+// blocks with the ones that were put to the server, so the file's
+// next sync just references them.  Blocks that were written to, or
+// synced, since StartStreaming are left alone, and are returned if
+// they made it to the server; the caller should delete those.
+func (fbo *folderBlockOps) FinishStreaming(
+	ctx context.Context, lState *lockState, md ReadOnlyRootMetadata,
+	file Node, blocks []streamedBlock) (unused *blockPutState, err error) {
+	defer fbo.streamingPuts.Done()
+
+	fbo.blockLock.Lock(lState)
+	defer fbo.blockLock.Unlock(lState)
+
+	unused = newBlockPutState(0)
+	used := make(map[BlockPointer]bool)
+	defer func() {
+		for _, b := range blocks {
+			if b.put && !used[b.oldPtr] {
+				unused.addNewBlock(
+					b.newInfo.BlockPointer, nil, ReadyBlockData{}, nil)
+			}
+		}
+	}()
+
+	filePath, err := fbo.pathFromNodeForBlockWriteLocked(lState, file)
+	if err != nil {
+		return unused, err
+	}
+	fileRef := filePath.tailPointer().Ref()
+	df := fbo.dirtyFiles[filePath.tailPointer()]
+	si := fbo.unrefCache[fileRef]
+	if df == nil || si == nil || df.isBlockSyncing(filePath.tailPointer()) {
+		// The file is being (or was) synced, which uses its own
+		// versions of these blocks.
+		return unused, nil
+	}
+
+	fblock, uid, err := fbo.writeGetFileLocked(ctx, lState, md, filePath)
+	if err != nil {
+		return unused, err
+	}
+
+	fd := fbo.newFileData(lState, filePath, uid, md)
+	dirtyBcache := fbo.config.DirtyBlockCache()
+	streamed := newBlockPutState(len(blocks))
+	for _, b := range blocks {
+		if !df.finishBlockStreaming(b.oldPtr) || !b.put {
+			continue
+		}
+
+		block, err := dirtyBcache.Get(fbo.id(), b.oldPtr, fbo.branch())
+		if err != nil {
+			return unused, err
+		}
+		found, err := fd.setLeafPointer(
+			ctx, fblock, b.off, b.oldPtr, b.newInfo)
+		if err != nil {
+			return unused, err
+		} else if !found {
+			continue
+		}
+		used[b.oldPtr] = true
+
+		err = fbo.config.BlockCache().Put(
+			b.newInfo.BlockPointer, fbo.id(), block, TransientEntry)
+		if err != nil {
+			return unused, err
+		}
+
+		// The dirty version is now done with, just like after a
+		// sync.
+		err = df.setBlockSyncing(b.oldPtr)
+		if err != nil {
+			return unused, err
+		}
+		df.setBlockOrphaned(b.oldPtr, true)
+		err = df.setBlockSynced(b.oldPtr)
+		if err != nil {
+			return unused, err
+		}
+		err = dirtyBcache.Delete(fbo.id(), b.oldPtr, fbo.branch())
+		if err != nil {
+			return unused, err
+		}
+
+		si.op.AddRefBlock(b.newInfo.BlockPointer)
+		si.refBytes += uint64(b.newInfo.EncodedSize)
+		streamed.addNewBlock(b.newInfo.BlockPointer, nil, ReadyBlockData{}, nil)
+	}
+
+	if len(streamed.blockStates) == 0 {
+		return unused, nil
+	}
+
+	// With a non-nil bps, the next sync picks up the byte accounting
+	// from `si`.
+	if si.bps == nil {
+		si.bps = newBlockPutState(1)
+	}
+	// If a later write replaces any of these blocks before the
+	// sync, the sync will leave them unreferenced, so clean them up
+	// then.
+	if n := len(si.toCleanIfUnused); n > 0 &&
+		si.toCleanIfUnused[n-1].md.RootMetadata == md.RootMetadata {
+		si.toCleanIfUnused[n-1].bps.mergeOtherBps(streamed)
+	} else {
+		si.toCleanIfUnused = append(si.toCleanIfUnused,
+			mdToCleanIfUnused{md, streamed})
+	}
+	return unused, nil
+}
+
 // truncateExtendLocked is called by truncateLocked to extend a file and
 // creates a hole.
 func (fbo *folderBlockOps) truncateExtendLocked(
@@ -1458,6 +1837,7 @@ func (fbo *folderBlockOps) truncateExtendLocked(
 	if err != nil {
 		return WriteRange{}, nil, err
 	}
+	fbo.stampDirtyEntryTimes(&newDe)
 	fbo.deCache[file.tailPointer().Ref()] = newDe
 
 	si, err := fbo.getOrCreateSyncInfoLocked(lState, de)
@@ -1481,9 +1861,19 @@ func (fbo *folderBlockOps) truncateExtendLocked(
 }
 
 // truncateExtendCutoffPoint is the amount of data in extending
-// truncate that will trigger the extending with a hole algorithm.
+// truncate of a direct file that will trigger the extending with a
+// hole algorithm.  Indirect files are always extended with a hole,
+// since that only adds an empty block to the pointer list instead of
+// uploading zeroes.
 const truncateExtendCutoffPoint = 128 * 1024
 
+// truncateMaxDirtyBytes bounds the number of bytes a single truncate
+// can dirty: a shrink only rewrites the block where the file now
+// ends, and an extension only writes zeroes into a direct file, up to
+// truncateExtendCutoffPoint past its end.
+const truncateMaxDirtyBytes = MaxBlockSizeBytesDefault +
+	truncateExtendCutoffPoint
+
 // Returns the set of newly-ID'd blocks created during this truncate
 // that might need to be cleaned up if the truncate is deferred.
 func (fbo *folderBlockOps) truncateLocked(
@@ -1510,7 +1900,8 @@ func (fbo *folderBlockOps) truncateLocked(
 	}
 
 	currLen := int64(startOff) + int64(len(block.Contents))
-	if currLen+truncateExtendCutoffPoint < iSize {
+	if currLen < iSize &&
+		(fblock.IsInd || currLen+truncateExtendCutoffPoint < iSize) {
 		latestWrite, dirtyPtrs, err := fbo.truncateExtendLocked(
 			ctx, lState, kmd, file, uint64(iSize), parentBlocks)
 		if err != nil {
@@ -1556,6 +1947,7 @@ func (fbo *folderBlockOps) truncateLocked(
 	df.updateNotYetSyncingBytes(newlyDirtiedChildBytes)
 
 	latestWrite := si.op.addTruncate(size)
+	fbo.stampDirtyEntryTimes(&newDe)
 	fbo.deCache[file.tailPointer().Ref()] = newDe
 
 	return &latestWrite, dirtyPtrs, newlyDirtiedChildBytes, nil
@@ -1571,16 +1963,20 @@ func (fbo *folderBlockOps) Truncate(
 	// of it gets flush so our memory usage doesn't grow without
 	// bound.
 	//
-	// Assume the whole remaining file will be dirty after this
-	// truncate.  TODO: try to figure out how many bytes actually will
-	// be dirtied ahead of time?
+	// Only the block where the file ends gets dirtied (or, for a
+	// small extension of a direct file, some zeroes), so there's no
+	// need to ask for the whole file size.
+	estimatedDirtyBytes := int64(size)
+	if estimatedDirtyBytes > truncateMaxDirtyBytes {
+		estimatedDirtyBytes = truncateMaxDirtyBytes
+	}
 	c, err := fbo.config.DirtyBlockCache().RequestPermissionToDirty(ctx,
-		fbo.id(), int64(size))
+		fbo.id(), estimatedDirtyBytes)
 	if err != nil {
 		return err
 	}
 	defer fbo.config.DirtyBlockCache().UpdateUnsyncedBytes(fbo.id(),
-		-int64(size), false)
+		-estimatedDirtyBytes, false)
 	err = fbo.maybeWaitOnDeferredWrites(ctx, lState, file, c)
 	if err != nil {
 		return err
@@ -1746,11 +2142,7 @@ func ReadyBlock(ctx context.Context, bcache BlockCache, bops BlockOps,
 		if err != nil {
 			return
 		}
-	} else if dBlock, ok := block.(*DirBlock); ok {
-		if dBlock.IsInd {
-			panic("Indirect directory blocks aren't supported yet")
-		}
-		// TODO: support indirect directory blocks.
+	} else if dBlock, ok := block.(*DirBlock); ok && !dBlock.IsInd {
 		directType = DirectBlock
 	}
 
@@ -1781,6 +2173,9 @@ func ReadyBlock(ctx context.Context, bcache BlockCache, bops BlockOps,
 				RefNonce: kbfsblock.ZeroRefNonce,
 			},
 		}
+		if readyBlockData.compressed {
+			ptr.DataVer = CompressedBlocksDataVer
+		}
 	}
 
 	info = BlockInfo{
@@ -1827,6 +2222,12 @@ type fileSyncState struct {
 	//
 	// TODO: This can be a list of IDs instead.
 	newIndirectFileBlockPtrs []BlockPointer
+
+	// timesSet is true if the synced directory entry came from the
+	// dirty entry cache, in which case it already carries the mtime
+	// and ctime of the last write or attribute change, and the sync
+	// must not overwrite them.
+	timesSet bool
 }
 
 // startSyncWrite contains the portion of StartSync() that's done
@@ -1954,6 +2355,7 @@ func (fbo *folderBlockOps) startSyncWrite(ctx context.Context,
 	// other deferred writes don't slip in.
 	if de, ok := fbo.deCache[fileRef]; ok {
 		dirtyDe = &de
+		syncState.timesSet = true
 	}
 
 	// Leave a copy of the syncOp in `unrefCache`, since it may be
@@ -2031,6 +2433,11 @@ func (fbo *folderBlockOps) StartSync(ctx context.Context,
 		jServer.dirtyOpStart(fbo.id())
 	}
 
+	err = fbo.streamingPuts.Wait(ctx)
+	if err != nil {
+		return nil, nil, nil, syncState, err
+	}
+
 	fblock, bps, syncState, dirtyDe, err := fbo.startSyncWrite(
 		ctx, lState, md, uid, file)
 	if err != nil {
@@ -2612,8 +3019,14 @@ func (fbo *folderBlockOps) setCachedAttr(
 	switch op.Attr {
 	case exAttr:
 		fileEntry.Type = realEntry.Type
+		fileEntry.Mode = realEntry.Mode
 	case mtimeAttr:
 		fileEntry.Mtime = realEntry.Mtime
+	case xattrAttr:
+		fileEntry.Xattrs = realEntry.Xattrs
+	case modeAttr:
+		fileEntry.Type = realEntry.Type
+		fileEntry.Mode = realEntry.Mode
 	}
 	fileEntry.Ctime = realEntry.Ctime
 	fbo.deCache[ref] = fileEntry
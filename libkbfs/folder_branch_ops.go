@@ -68,7 +68,8 @@ const (
 	// Total history size for 2097152-byte blocks: 1134341128192 bytes
 	// Total history size for 4194304-byte blocks: 2216672886784 bytes
 	MaxBlockSizeBytesDefault = 512 << 10
-	// Maximum number of blocks that can be sent in parallel
+	// Default maximum number of blocks that can be sent in
+	// parallel; see Config.MaxParallelBlockPuts.
 	maxParallelBlockPuts = 100
 	// Maximum number of blocks that can be fetched in parallel
 	maxParallelBlockGets = 10
@@ -77,6 +78,12 @@ const (
 	// Time between checks for dirty files to flush, in case Sync is
 	// never called.
 	secondsBetweenBackgroundFlushes = 10
+	// How often to renew the leases on the advisory locks held by
+	// this device; well within the server's lease duration.
+	tlfLockRefreshPeriod = 20 * time.Second
+	// How long to wait between attempts to take an advisory lock
+	// that's held by another device.
+	tlfLockRetryPeriod = 1 * time.Second
 	// Cap the number of times we retry after a recoverable error
 	maxRetriesOnRecoverableErrors = 10
 	// When the number of dirty bytes exceeds this level, force a sync.
@@ -225,6 +232,13 @@ type folderBranchOps struct {
 	bid          BranchID // protected by mdWriterLock
 	bType        branchType
 	observers    *observerList
+	changeSubs   *changeSubscriptions
+	// syncState, if non-nil, is told when this folder-branch
+	// starts and finishes catching up on remote updates.
+	syncState *kbfsCurrentStatus
+	// webhook, if non-nil, posts every new revision of this
+	// folder-branch to a configured URL.
+	webhook *webhookNotifier
 
 	// these locks, when locked concurrently by the same goroutine,
 	// should only be taken in the following order to avoid deadlock:
@@ -294,6 +308,16 @@ type folderBranchOps struct {
 	// to know when it should sync immediately.
 	forceSyncChan <-chan struct{}
 
+	// tlfSyncChan is written to (without blocking) whenever the
+	// blocks of this TLF should be synced to disk, if it's synced
+	// to this device.
+	tlfSyncChan chan struct{}
+	// tlfSyncUnrefs holds the pointers unreferenced by the merged
+	// heads set since the TLF syncer last ran, whose blocks it
+	// should delete from disk.
+	tlfSyncUnrefsLock sync.Mutex
+	tlfSyncUnrefs     []BlockPointer
+
 	// How to resolve conflicts
 	cr *ConflictResolver
 
@@ -307,11 +331,47 @@ type folderBranchOps struct {
 
 	editHistory *TlfEditHistory
 
+	// The number of entries a directory can have before its block
+	// gets split into multiple child blocks.  Only changed by tests.
+	maxDirEntriesPerBlock int
+
+	// conflictBranches are the unmerged branches of this TLF that
+	// conflict resolution gave up on, each readable as a
+	// conflicted copy of the TLF until it's cleared.
+	conflictLock     sync.Mutex
+	conflictBranches []conflictBranch
+
+	// Protects heldLocks and refreshingLocks.
+	heldLocksLock sync.Mutex
+	// The advisory locks this device holds for this TLF, whose
+	// leases get renewed in the background until they're unlocked.
+	heldLocks map[LockID]*heldAdvisoryLock
+	// Whether the background lease refresher is running.
+	refreshingLocks bool
+
 	branchChanges      kbfssync.RepeatedWaitGroup
 	mdFlushes          kbfssync.RepeatedWaitGroup
 	forcedFastForwards kbfssync.RepeatedWaitGroup
 }
 
+// conflictBranch is an unmerged branch that conflict resolution gave
+// up on, whose last state is kept around as a read-only conflicted
+// copy of the TLF, named with a conflict extension.
+type conflictBranch struct {
+	handle *TlfHandle
+	head   ImmutableRootMetadata
+	// unrefs are the blocks referenced only by the branch, which
+	// stay live until the conflicted copy is cleared.  Blocks the
+	// branch shares with the merged branch are still deleted once
+	// the merged branch stops using them.
+	unrefs []BlockPointer
+}
+
+// branchName is the name of the read-only branch showing cb.
+func (cb conflictBranch) branchName() BranchName {
+	return BranchName(cb.handle.ConflictInfo().String())
+}
+
 var _ KBFSOps = (*folderBranchOps)(nil)
 
 var _ fbmHelper = (*folderBranchOps)(nil)
@@ -334,7 +394,7 @@ func newFolderBranchOps(config Config, fb FolderBranch,
 	// But print it out once in full, just in case.
 	log.CInfof(nil, "Created new folder-branch for %s", tlfStringFull)
 
-	observers := newObserverList()
+	observers := newObserverList(config.NotificationDebounce)
 
 	mdWriterLock := makeLeveledMutex(mutexLevel(fboMDWriter), &sync.Mutex{})
 	headLock := makeLeveledRWMutex(mutexLevel(fboHead), &sync.RWMutex{})
@@ -348,6 +408,7 @@ func newFolderBranchOps(config Config, fb FolderBranch,
 		bid:          BranchID{},
 		bType:        bType,
 		observers:    observers,
+		changeSubs:   newChangeSubscriptions(changeEventBatchDelay),
 		status:       newFolderBranchStatusKeeper(config, nodeCache),
 		mdWriterLock: mdWriterLock,
 		headLock:     headLock,
@@ -371,6 +432,10 @@ func newFolderBranchOps(config Config, fb FolderBranch,
 		shutdownChan:    make(chan struct{}),
 		updatePauseChan: make(chan (<-chan struct{})),
 		forceSyncChan:   forceSyncChan,
+		tlfSyncChan:     make(chan struct{}, 1),
+		heldLocks:       make(map[LockID]*heldAdvisoryLock),
+
+		maxDirEntriesPerBlock: maxDirEntriesPerBlockDefault,
 	}
 	fbo.cr = NewConflictResolver(config, fbo)
 	fbo.fbm = newFolderBlockManager(config, fb, fbo)
@@ -378,6 +443,9 @@ func newFolderBranchOps(config Config, fb FolderBranch,
 	if config.DoBackgroundFlushes() {
 		go fbo.backgroundFlusher(secondsBetweenBackgroundFlushes * time.Second)
 	}
+	if fb.Branch == MasterBranch {
+		go fbo.backgroundTlfSyncer()
+	}
 
 	return fbo
 }
@@ -418,6 +486,8 @@ func (fbo *folderBranchOps) Shutdown(ctx context.Context) error {
 	}
 
 	close(fbo.shutdownChan)
+	fbo.changeSubs.shutdown()
+	fbo.observers.dropPendingChanges()
 	fbo.cr.Shutdown()
 	fbo.fbm.shutdown()
 	fbo.editHistory.Shutdown()
@@ -433,6 +503,19 @@ func (fbo *folderBranchOps) id() tlf.ID {
 	return fbo.folderBranch.Tlf
 }
 
+// logOpFields returns the structured log fields for the given
+// operation on this TLF, which started at startTime. The message
+// they're logged with should be at info level, so that the op
+// records are there even when debug logging is off.
+func (fbo *folderBranchOps) logOpFields(
+	op string, startTime time.Time) logOpFields {
+	return logOpFields{
+		TLF:     fbo.id(),
+		Op:      op,
+		Latency: fbo.config.Clock().Now().Sub(startTime),
+	}
+}
+
 func (fbo *folderBranchOps) branch() BranchName {
 	return fbo.folderBranch.Branch
 }
@@ -451,6 +534,12 @@ func (fbo *folderBranchOps) DeleteFavorite(ctx context.Context,
 	return errors.New("DeleteFavorite is not supported by folderBranchOps")
 }
 
+func (fbo *folderBranchOps) GetAllTLFHandles(ctx context.Context) (
+	[]*TlfHandle, error) {
+	return nil, errors.New(
+		"GetAllTLFHandles is not supported by folderBranchOps")
+}
+
 func (fbo *folderBranchOps) AddFavorite(ctx context.Context,
 	fav Favorite) error {
 	return errors.New("AddFavorite is not supported by folderBranchOps")
@@ -594,8 +683,11 @@ func (fbo *folderBranchOps) setHeadLocked(
 	if isFirstHead && md.MergedStatus() == Unmerged {
 		fbo.setBranchIDLocked(lState, md.BID())
 		// Use uninitialized for the merged branch; the unmerged
-		// revision is enough to trigger conflict resolution.
-		fbo.cr.Resolve(md.Revision(), MetadataRevisionUninitialized)
+		// revision is enough to trigger conflict resolution.  A
+		// read-only branch only shows the unmerged data.
+		if fbo.bType == standard {
+			fbo.cr.Resolve(md.Revision(), MetadataRevisionUninitialized)
+		}
 	} else if md.MergedStatus() == Merged {
 		journalEnabled := TLFJournalEnabled(fbo.config, fbo.id())
 		var key kbfscrypto.VerifyingKey
@@ -675,6 +767,14 @@ func (fbo *folderBranchOps) setHeadLocked(
 		fbo.config.Reporter().Notify(ctx, mdReadSuccessNotification(
 			md.GetTlfHandle(), md.TlfID().IsPublic()))
 	}
+	if fbo.config.tlfSyncCache().isSynced(fbo.id()) {
+		// Keep the disk copy up to date with the new head, and
+		// drop the blocks it no longer uses.
+		if md.MergedStatus() == Merged {
+			fbo.queueTlfSyncUnrefs(md)
+		}
+		fbo.kickOffTlfSync()
+	}
 	return nil
 }
 
@@ -1049,6 +1149,10 @@ func (fbo *folderBranchOps) getMDForWriteLockedForFilename(
 	ctx context.Context, lState *lockState, filename string) (*RootMetadata, error) {
 	fbo.mdWriterLock.AssertLocked(lState)
 
+	if fbo.bType != standard {
+		return nil, NewWriteUnsupportedError(filename)
+	}
+
 	md, err := fbo.getMDLocked(ctx, lState, mdWrite)
 	if err != nil {
 		return nil, err
@@ -1144,7 +1248,9 @@ func (fbo *folderBranchOps) maybeUnembedAndPutBlocks(ctx context.Context,
 
 	ptrsToDelete, err := doBlockPuts(ctx, fbo.config.BlockServer(),
 		fbo.config.BlockCache(), fbo.config.Reporter(), fbo.log, md.TlfID(),
-		md.GetTlfHandle().GetCanonicalName(), *bps)
+		md.GetTlfHandle().GetCanonicalName(), *bps,
+		fbo.config.MaxParallelBlockPuts(),
+		fbo.config.blockTransferTracker())
 	if err != nil {
 		return nil, err
 	}
@@ -1307,6 +1413,11 @@ func (fbo *folderBranchOps) GetTLFCryptKeys(ctx context.Context,
 	return nil, tlf.ID{}, errors.New("GetTLFCryptKeys is not supported by folderBranchOps")
 }
 
+func (fbo *folderBranchOps) GetTLFHandle(ctx context.Context, id tlf.ID) (
+	*TlfHandle, error) {
+	return nil, errors.New("GetTLFHandle is not supported by folderBranchOps")
+}
+
 func (fbo *folderBranchOps) GetTLFID(ctx context.Context, h *TlfHandle) (tlf.ID, error) {
 	return tlf.ID{}, errors.New("GetTLFID is not supported by folderBranchOps")
 }
@@ -1331,6 +1442,20 @@ func (fbo *folderBranchOps) checkNode(node Node) error {
 	return nil
 }
 
+// checkNodeForWrite is like checkNode, but also fails if this branch
+// is read-only.  Writes that don't make a new MD right away must
+// check this, since getMDForWriteLocked catches the rest.
+func (fbo *folderBranchOps) checkNodeForWrite(node Node) error {
+	if err := fbo.checkNode(node); err != nil {
+		return err
+	}
+	if fbo.bType != standard {
+		return NewWriteUnsupportedError(
+			fbo.nodeCache.PathFromNode(node).String())
+	}
+	return nil
+}
+
 // SetInitialHeadFromServer sets the head to the given
 // ImmutableRootMetadata, which must be retrieved from the MD server.
 func (fbo *folderBranchOps) SetInitialHeadFromServer(
@@ -1550,10 +1675,12 @@ func (fbo *folderBranchOps) pathFromNodeForMDWriteLocked(
 
 func (fbo *folderBranchOps) GetDirChildren(ctx context.Context, dir Node) (
 	children map[string]EntryInfo, err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "GetDirChildren %s", getNodeIDStr(dir))
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "GetDirChildren %s done: %+v",
-			getNodeIDStr(dir), err)
+		fbo.deferLog.CInfof(ctx, "GetDirChildren %s done: %+v %s",
+			getNodeIDStr(dir), err,
+			fbo.logOpFields("GetDirChildren", startTime))
 	}()
 
 	err = fbo.checkNode(dir)
@@ -1601,12 +1728,64 @@ func (fbo *folderBranchOps) GetDirChildren(ctx context.Context, dir Node) (
 	return children, nil
 }
 
+func (fbo *folderBranchOps) GetDirChildrenPage(ctx context.Context,
+	dir Node, after string, maxEntries int) (
+	children []DirChild, more bool, err error) {
+	fbo.log.CDebugf(ctx, "GetDirChildrenPage %s after %q (max %d)",
+		getNodeIDStr(dir), after, maxEntries)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "GetDirChildrenPage %s done: %d %t %+v",
+			getNodeIDStr(dir), len(children), more, err)
+	}()
+
+	err = fbo.checkNode(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	if maxEntries <= 0 {
+		return nil, false, errors.Errorf(
+			"Invalid maximum number of entries: %d", maxEntries)
+	}
+
+	err = runUnlessCanceled(ctx, func() error {
+		var err error
+		lState := makeFBOLockState()
+
+		md, err := fbo.getMDForReadNeedIdentify(ctx, lState)
+		if err != nil {
+			return err
+		}
+
+		dirPath, err := fbo.pathFromNodeForRead(dir)
+		if err != nil {
+			return err
+		}
+
+		// See the comment in GetDirChildren.
+		if md.data.Dir.BlockPointer.ID != dirPath.path[0].BlockPointer.ID {
+			fbo.log.CDebugf(ctx, "Returning an empty children set for "+
+				"unlinked directory %v", dirPath.tailPointer())
+			return nil
+		}
+
+		children, more, err = fbo.blocks.GetDirtyDirChildrenPage(
+			ctx, lState, md.ReadOnly(), dirPath, after, maxEntries)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return children, more, nil
+}
+
 func (fbo *folderBranchOps) Lookup(ctx context.Context, dir Node, name string) (
 	node Node, ei EntryInfo, err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "Lookup %s %s", getNodeIDStr(dir), name)
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "Lookup %s %s done: %v %+v",
-			getNodeIDStr(dir), name, getNodeIDStr(node), err)
+		fbo.deferLog.CInfof(ctx, "Lookup %s %s done: %v %+v %s",
+			getNodeIDStr(dir), name, getNodeIDStr(node), err,
+			fbo.logOpFields("Lookup", startTime))
 	}()
 
 	err = fbo.checkNode(dir)
@@ -1689,10 +1868,12 @@ type blockState struct {
 
 func (fbo *folderBranchOps) Stat(ctx context.Context, node Node) (
 	ei EntryInfo, err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "Stat %s", getNodeIDStr(node))
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "Stat %s done: %+v",
-			getNodeIDStr(node), err)
+		fbo.deferLog.CInfof(ctx, "Stat %s done: %+v %s",
+			getNodeIDStr(node), err,
+			fbo.logOpFields("Stat", startTime))
 	}()
 
 	var de DirEntry
@@ -1783,6 +1964,123 @@ func (fbo *folderBranchOps) readyBlockMultiple(ctx context.Context,
 	return
 }
 
+// readyDirBlockMultiple readies the given directory block, adding all
+// readied blocks to `bps`.  A directory with more than
+// `maxDirEntriesPerBlock` entries is split into child blocks under a
+// new indirect top block, and any child block of the directory's
+// previous version that still holds exactly the same entries is
+// reused instead of readied again.  The refs of the new child blocks
+// and the unrefs of the replaced ones are added to `md`; the top
+// block itself is left to the caller.  The returned plain size covers
+// all of the directory's blocks.
+func (fbo *folderBranchOps) readyDirBlockMultiple(ctx context.Context,
+	md *RootMetadata, dblock *DirBlock, uid keybase1.UID,
+	bps *blockPutState) (info BlockInfo, plainSize int, err error) {
+	oldPtrs := dblock.IPtrs
+	if len(dblock.Children) <= fbo.maxDirEntriesPerBlock {
+		for _, iptr := range oldPtrs {
+			md.AddUnrefBlock(iptr.BlockInfo)
+		}
+		// Make sure the old indirect pointers don't get encoded
+		// into the new direct block.
+		direct := dblock
+		if len(oldPtrs) > 0 {
+			direct = &DirBlock{Children: dblock.Children}
+		}
+		return fbo.readyBlockMultiple(ctx, md.ReadOnly(), direct, uid, bps)
+	}
+
+	oldPtrsByOff := make(map[string]IndirectDirPtr, len(oldPtrs))
+	for _, iptr := range oldPtrs {
+		oldPtrsByOff[iptr.Off] = iptr
+	}
+	reused := make(map[BlockPointer]bool)
+	ranges := splitDirEntries(
+		dblock.Children, oldPtrs, fbo.maxDirEntriesPerBlock)
+	top := &DirBlock{
+		CommonBlock: CommonBlock{IsInd: true},
+		IPtrs:       make([]IndirectDirPtr, 0, len(ranges)),
+	}
+	for _, r := range ranges {
+		child := NewDirBlock().(*DirBlock)
+		for _, name := range r.names {
+			child.Children[name] = dblock.Children[name]
+		}
+
+		if oldPtr, ok := oldPtrsByOff[r.off]; ok &&
+			fbo.isDirChildBlockUnchanged(oldPtr.BlockPointer, child) {
+			top.IPtrs = append(top.IPtrs, oldPtr)
+			reused[oldPtr.BlockPointer] = true
+			// Approximate the size of a reused block by its
+			// encoded size.
+			plainSize += int(oldPtr.EncodedSize)
+			continue
+		}
+
+		childInfo, childPlainSize, childData, err := ReadyBlock(
+			ctx, fbo.config.BlockCache(), fbo.config.BlockOps(),
+			fbo.config.Crypto(), md.ReadOnly(), child, uid)
+		if err != nil {
+			return BlockInfo{}, 0, err
+		}
+		// A child block is only readable as part of an indirect
+		// directory, so it needs at least the data version of the
+		// top.
+		if childInfo.DataVer < IndirectDirsDataVer {
+			childInfo.DataVer = IndirectDirsDataVer
+		}
+		bps.addNewBlock(childInfo.BlockPointer, child, childData, nil)
+		md.AddRefBlock(childInfo)
+		top.IPtrs = append(top.IPtrs, IndirectDirPtr{
+			BlockInfo: childInfo,
+			Off:       r.off,
+		})
+		plainSize += childPlainSize
+	}
+	for _, iptr := range oldPtrs {
+		if !reused[iptr.BlockPointer] {
+			md.AddUnrefBlock(iptr.BlockInfo)
+		}
+	}
+	fbo.log.CDebugf(ctx, "Split directory with %d entries into %d "+
+		"blocks (%d reused)", len(dblock.Children), len(top.IPtrs),
+		len(reused))
+
+	info, topPlainSize, readyBlockData, err := ReadyBlock(
+		ctx, fbo.config.BlockCache(), fbo.config.BlockOps(),
+		fbo.config.Crypto(), md.ReadOnly(), top, uid)
+	if err != nil {
+		return BlockInfo{}, 0, err
+	}
+
+	// Cache the assembled form of the directory under the new top
+	// pointer, just like the assembled form fetched from the server.
+	assembled := &DirBlock{
+		Children: dblock.Children,
+		IPtrs:    top.IPtrs,
+	}
+	assembled.SetEncodedSize(top.GetEncodedSize())
+	bps.addNewBlock(info.BlockPointer, assembled, readyBlockData, nil)
+	return info, plainSize + topPlainSize, nil
+}
+
+// isDirChildBlockUnchanged returns true if the cached version of the
+// given child block of an indirect directory holds exactly the same
+// entries as `newChild`.  If the old block isn't cached, it's
+// considered changed.
+func (fbo *folderBranchOps) isDirChildBlockUnchanged(
+	oldPtr BlockPointer, newChild *DirBlock) bool {
+	block, err := fbo.config.BlockCache().Get(oldPtr)
+	if err != nil {
+		return false
+	}
+	oldChild, ok := block.(*DirBlock)
+	if !ok || oldChild.IsInd {
+		return false
+	}
+	return reflect.DeepEqual(oldChild.Children, newChild.Children)
+}
+
 func (fbo *folderBranchOps) unembedBlockChanges(
 	ctx context.Context, bps *blockPutState, md *RootMetadata,
 	changes *BlockChanges, uid keybase1.UID) error {
@@ -1801,7 +2099,7 @@ func (fbo *folderBranchOps) unembedBlockChanges(
 	ptr := BlockPointer{
 		ID:         bid,
 		KeyGen:     md.LatestKeyGeneration(),
-		DataVer:    fbo.config.DataVersion(),
+		DataVer:    maxFileDataVer,
 		DirectType: DirectBlock,
 		Context: kbfsblock.Context{
 			Creator:  uid,
@@ -1924,8 +2222,16 @@ func (fbo *folderBranchOps) syncBlock(
 	doSetTime := true
 	now := fbo.nowUnixNano()
 	for len(newPath.path) < len(dir.path)+1 {
-		info, plainSize, err := fbo.readyBlockMultiple(
-			ctx, md.ReadOnly(), currBlock, uid, bps)
+		var info BlockInfo
+		var plainSize int
+		var err error
+		if dblock, ok := currBlock.(*DirBlock); ok {
+			info, plainSize, err = fbo.readyDirBlockMultiple(
+				ctx, md, dblock, uid, bps)
+		} else {
+			info, plainSize, err = fbo.readyBlockMultiple(
+				ctx, md.ReadOnly(), currBlock, uid, bps)
+		}
 		if err != nil {
 			return path{}, DirEntry{}, nil, err
 		}
@@ -2002,9 +2308,6 @@ func (fbo *folderBranchOps) syncBlock(
 		}
 
 		if de.Type == Dir {
-			// TODO: When we use indirect dir blocks,
-			// we'll have to calculate the size some other
-			// way.
 			de.Size = uint64(plainSize)
 		}
 
@@ -2448,6 +2751,20 @@ func (fbo *folderBranchOps) finalizeGCOp(ctx context.Context, gco *GCOp) (
 	// `gco.LatestRev+1`.
 	md.SetLastGCRevision(gco.LatestRev)
 
+	// Don't allow garbage collection to put us into a conflicting
+	// state; just wait for the next period.
+	return fbo.finalizeMergedOnlyMDWriteLocked(ctx, lState, md)
+}
+
+// finalizeMergedOnlyMDWriteLocked puts md, which must have been
+// gotten from getMDForWriteLocked on the merged branch, to the
+// mdserver as the next merged revision, and makes it the new
+// head. Unlike finalizeMDWriteLocked, it never switches to an
+// unmerged branch; if the put conflicts, it just returns the error.
+func (fbo *folderBranchOps) finalizeMergedOnlyMDWriteLocked(
+	ctx context.Context, lState *lockState, md *RootMetadata) error {
+	fbo.mdWriterLock.AssertLocked(lState)
+
 	bps, err := fbo.maybeUnembedAndPutBlocks(ctx, md)
 	if err != nil {
 		return err
@@ -2457,8 +2774,6 @@ func (fbo *folderBranchOps) finalizeGCOp(ctx context.Context, gco *GCOp) (
 	// finally, write out the new metadata
 	mdID, err := fbo.config.MDOps().Put(ctx, md)
 	if err != nil {
-		// Don't allow garbage collection to put us into a conflicting
-		// state; just wait for the next period.
 		return err
 	}
 
@@ -2515,7 +2830,9 @@ func (fbo *folderBranchOps) syncBlockAndFinalizeLocked(ctx context.Context,
 
 	_, err = doBlockPuts(ctx, fbo.config.BlockServer(),
 		fbo.config.BlockCache(), fbo.config.Reporter(), fbo.log, md.TlfID(),
-		md.GetTlfHandle().GetCanonicalName(), *bps)
+		md.GetTlfHandle().GetCanonicalName(), *bps,
+		fbo.config.MaxParallelBlockPuts(),
+		fbo.config.blockTransferTracker())
 	if err != nil {
 		return DirEntry{}, err
 	}
@@ -2728,10 +3045,12 @@ func (fbo *folderBranchOps) doMDWriteWithRetryUnlessCanceled(
 func (fbo *folderBranchOps) CreateDir(
 	ctx context.Context, dir Node, path string) (
 	n Node, ei EntryInfo, err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "CreateDir %s %s", getNodeIDStr(dir), path)
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "CreateDir %s %s done: %v %+v",
-			getNodeIDStr(dir), path, getNodeIDStr(n), err)
+		fbo.deferLog.CInfof(ctx, "CreateDir %s %s done: %v %+v %s",
+			getNodeIDStr(dir), path, getNodeIDStr(n), err,
+			fbo.logOpFields("CreateDir", startTime))
 	}()
 
 	err = fbo.checkNode(dir)
@@ -2886,11 +3205,13 @@ func (fbo *folderBranchOps) createLinkLocked(
 func (fbo *folderBranchOps) CreateLink(
 	ctx context.Context, dir Node, fromName string, toPath string) (
 	ei EntryInfo, err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "CreateLink %s %s -> %s",
 		getNodeIDStr(dir), fromName, toPath)
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "CreateLink %s %s -> %s done: %+v",
-			getNodeIDStr(dir), fromName, toPath, err)
+		fbo.deferLog.CInfof(ctx, "CreateLink %s %s -> %s done: %+v %s",
+			getNodeIDStr(dir), fromName, toPath, err,
+			fbo.logOpFields("CreateLink", startTime))
 	}()
 
 	err = fbo.checkNode(dir)
@@ -3025,10 +3346,12 @@ func (fbo *folderBranchOps) removeDirLocked(ctx context.Context,
 
 func (fbo *folderBranchOps) RemoveDir(
 	ctx context.Context, dir Node, dirName string) (err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "RemoveDir %s %s", getNodeIDStr(dir), dirName)
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "RemoveDir %s %s done: %+v",
-			getNodeIDStr(dir), dirName, err)
+		fbo.deferLog.CInfof(ctx, "RemoveDir %s %s done: %+v %s",
+			getNodeIDStr(dir), dirName, err,
+			fbo.logOpFields("RemoveDir", startTime))
 	}()
 
 	err = fbo.checkNode(dir)
@@ -3044,10 +3367,12 @@ func (fbo *folderBranchOps) RemoveDir(
 
 func (fbo *folderBranchOps) RemoveEntry(ctx context.Context, dir Node,
 	name string) (err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "RemoveEntry %s %s", getNodeIDStr(dir), name)
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "RemoveEntry %s %s done: %+v",
-			getNodeIDStr(dir), name, err)
+		fbo.deferLog.CInfof(ctx, "RemoveEntry %s %s done: %+v %s",
+			getNodeIDStr(dir), name, err,
+			fbo.logOpFields("RemoveEntry", startTime))
 	}()
 
 	err = fbo.checkNode(dir)
@@ -3207,7 +3532,9 @@ func (fbo *folderBranchOps) renameLocked(
 
 	_, err = doBlockPuts(ctx, fbo.config.BlockServer(), fbo.config.BlockCache(),
 		fbo.config.Reporter(), fbo.log, md.TlfID(),
-		md.GetTlfHandle().GetCanonicalName(), *newBps)
+		md.GetTlfHandle().GetCanonicalName(), *newBps,
+		fbo.config.MaxParallelBlockPuts(),
+		fbo.config.blockTransferTracker())
 	if err != nil {
 		return err
 	}
@@ -3218,12 +3545,14 @@ func (fbo *folderBranchOps) renameLocked(
 func (fbo *folderBranchOps) Rename(
 	ctx context.Context, oldParent Node, oldName string, newParent Node,
 	newName string) (err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "Rename %s/%s -> %s/%s", getNodeIDStr(oldParent),
 		oldName, getNodeIDStr(newParent), newName)
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "Rename %s/%s -> %s/%s done: %+v",
+		fbo.deferLog.CInfof(ctx, "Rename %s/%s -> %s/%s done: %+v %s",
 			getNodeIDStr(oldParent), oldName,
-			getNodeIDStr(newParent), newName, err)
+			getNodeIDStr(newParent), newName, err,
+			fbo.logOpFields("Rename", startTime))
 	}()
 
 	err = fbo.checkNode(newParent)
@@ -3256,11 +3585,13 @@ func (fbo *folderBranchOps) Rename(
 func (fbo *folderBranchOps) Read(
 	ctx context.Context, file Node, dest []byte, off int64) (
 	n int64, err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "Read %s %d %d", getNodeIDStr(file),
 		len(dest), off)
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "Read %s %d %d done: %+v",
-			getNodeIDStr(file), len(dest), off, err)
+		fbo.deferLog.CInfof(ctx, "Read %s %d %d done: %+v %s",
+			getNodeIDStr(file), len(dest), off, err,
+			fbo.logOpFields("Read", startTime))
 	}()
 
 	err = fbo.checkNode(file)
@@ -3299,6 +3630,11 @@ func (fbo *folderBranchOps) Read(
 	// outlast this function call, and end up in a read/write race
 	// with the caller.
 	var bytesRead int64
+	ctx = contextWithBlockTransferFile(ctx, filePath.String())
+	transfer := fbo.config.blockTransferTracker().start(
+		ctx, BlockDownload, fbo.id(), unknownBlockTransferSize)
+	defer transfer.finish(ctx)
+	ctx = contextWithBlockTransfer(ctx, transfer)
 	err = runUnlessCanceled(ctx, func() error {
 		lState := makeFBOLockState()
 
@@ -3320,14 +3656,16 @@ func (fbo *folderBranchOps) Read(
 
 func (fbo *folderBranchOps) Write(
 	ctx context.Context, file Node, data []byte, off int64) (err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "Write %s %d %d", getNodeIDStr(file),
 		len(data), off)
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "Write %s %d %d done: %+v",
-			getNodeIDStr(file), len(data), off, err)
+		fbo.deferLog.CInfof(ctx, "Write %s %d %d done: %+v %s",
+			getNodeIDStr(file), len(data), off, err,
+			fbo.logOpFields("Write", startTime))
 	}()
 
-	err = fbo.checkNode(file)
+	err = fbo.checkNodeForWrite(file)
 	if err != nil {
 		return err
 	}
@@ -3350,19 +3688,63 @@ func (fbo *folderBranchOps) Write(
 		}
 
 		fbo.status.addDirtyNode(file)
+
+		if fbo.config.DoBackgroundFlushes() {
+			fbo.streamCompletedBlocks(ctx, lState, md, file, off)
+		}
 		return nil
 	})
 }
 
+// streamCompletedBlocks puts the completed dirty blocks of the given
+// file that end at or before `off` to the server, so that large
+// sequential writes don't have to keep all their data in memory until
+// the next sync.  Errors are only logged, since any blocks that don't
+// make it will just get put by the sync as usual.
+func (fbo *folderBranchOps) streamCompletedBlocks(ctx context.Context,
+	lState *lockState, md ImmutableRootMetadata, file Node, off int64) {
+	blocks, bps, err := fbo.blocks.StartStreaming(
+		ctx, lState, md.ReadOnly(), file, off)
+	if err != nil {
+		fbo.log.CDebugf(ctx, "Couldn't ready completed blocks: %+v", err)
+		return
+	}
+	if len(blocks) == 0 {
+		return
+	}
+
+	fbo.log.CDebugf(ctx, "Streaming %d completed blocks", len(blocks))
+	_, err = doBlockPuts(ctx, fbo.config.BlockServer(),
+		fbo.config.BlockCache(), fbo.config.Reporter(), fbo.log, md.TlfID(),
+		md.GetTlfHandle().GetCanonicalName(), *bps,
+		fbo.config.MaxParallelBlockPuts(),
+		fbo.config.blockTransferTracker())
+	if err != nil {
+		fbo.log.CDebugf(ctx, "Couldn't put completed blocks: %+v", err)
+	}
+
+	unused, err := fbo.blocks.FinishStreaming(
+		ctx, lState, md.ReadOnly(), file, blocks)
+	if err != nil {
+		fbo.log.CDebugf(ctx, "Couldn't finish streaming blocks: %+v", err)
+	}
+	if len(unused.blockStates) > 0 {
+		// Nothing references these blocks.
+		fbo.fbm.cleanUpBlockState(md.ReadOnly(), unused, blockDeleteAlways)
+	}
+}
+
 func (fbo *folderBranchOps) Truncate(
 	ctx context.Context, file Node, size uint64) (err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "Truncate %s %d", getNodeIDStr(file), size)
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "Truncate %s %d done: %+v",
-			getNodeIDStr(file), size, err)
+		fbo.deferLog.CInfof(ctx, "Truncate %s %d done: %+v %s",
+			getNodeIDStr(file), size, err,
+			fbo.logOpFields("Truncate", startTime))
 	}()
 
-	err = fbo.checkNode(file)
+	err = fbo.checkNodeForWrite(file)
 	if err != nil {
 		return err
 	}
@@ -3424,6 +3806,10 @@ func (fbo *folderBranchOps) setExLocked(
 		fbo.log.CDebugf(ctx, "Ignoring no-op setex")
 		return nil
 	}
+	if _, ok := de.PermMode(); ok {
+		// Keep any explicitly-set permission bits in sync.
+		de.Mode = modeWithEx(de.Mode, ex)
+	}
 
 	de.Ctime = fbo.nowUnixNano()
 
@@ -3457,10 +3843,12 @@ func (fbo *folderBranchOps) setExLocked(
 
 func (fbo *folderBranchOps) SetEx(
 	ctx context.Context, file Node, ex bool) (err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "SetEx %s %t", getNodeIDStr(file), ex)
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "SetEx %s %t done: %+v",
-			getNodeIDStr(file), ex, err)
+		fbo.deferLog.CInfof(ctx, "SetEx %s %t done: %+v %s",
+			getNodeIDStr(file), ex, err,
+			fbo.logOpFields("SetEx", startTime))
 	}()
 
 	err = fbo.checkNode(file)
@@ -3479,6 +3867,113 @@ func (fbo *folderBranchOps) SetEx(
 		})
 }
 
+func (fbo *folderBranchOps) setModeLocked(
+	ctx context.Context, lState *lockState, file path,
+	mode os.FileMode) error {
+	fbo.mdWriterLock.AssertLocked(lState)
+
+	// The root directory has no parent entry to keep the mode in.
+	// Ignore it rather than fail, since tools like rsync try to
+	// set it on the destination directory.
+	if !file.hasValidParent() {
+		fbo.log.CDebugf(ctx, "Ignoring setmode on the root directory")
+		return nil
+	}
+
+	// verify we have permission to write
+	md, err := fbo.getMDForWriteLocked(ctx, lState)
+	if err != nil {
+		return err
+	}
+
+	dblock, de, err := fbo.blocks.GetDirtyParentAndEntry(
+		ctx, lState, md.ReadOnly(), file)
+	if err != nil {
+		return err
+	}
+
+	// Symlinks have no permissions of their own (to match ext4
+	// behavior).
+	if de.Type == Sym {
+		fbo.log.CDebugf(ctx, "Ignoring setmode on type %s", de.Type)
+		return nil
+	}
+
+	perm := uint32(mode.Perm()) | entryModeSet
+	entryType := de.Type
+	if entryType != Dir {
+		if perm&0100 != 0 {
+			entryType = Exec
+		} else {
+			entryType = File
+		}
+	}
+	if perm == de.Mode && entryType == de.Type {
+		// As with setex, skip the no-op to keep
+		// permissions-preserving rsyncs fast.
+		fbo.log.CDebugf(ctx, "Ignoring no-op setmode")
+		return nil
+	}
+	de.Mode = perm
+	de.Type = entryType
+	// changing the mode counts as changing the file MD, so must set
+	// ctime too
+	de.Ctime = fbo.nowUnixNano()
+
+	parentPath := file.parentPath()
+	sao, err := newSetAttrOp(file.tailName(), parentPath.tailPointer(),
+		modeAttr, file.tailPointer())
+	if err != nil {
+		return err
+	}
+
+	// If the MD doesn't match the MD expected by the path, that
+	// implies we are using a cached path, which implies the node has
+	// been unlinked.  In that case, we can safely ignore this
+	// setmode.
+	if md.data.Dir.BlockPointer.ID != file.path[0].BlockPointer.ID {
+		fbo.log.CDebugf(ctx, "Skipping setmode for a removed file %v",
+			file.tailPointer())
+		fbo.blocks.UpdateCachedEntryAttributesOnRemovedFile(
+			ctx, lState, sao, de)
+		return nil
+	}
+
+	sao.setFinalPath(file)
+	md.AddOp(sao)
+
+	dblock.Children[file.tailName()] = de
+	_, err = fbo.syncBlockAndFinalizeLocked(
+		ctx, lState, md, dblock, *parentPath.parentPath(), parentPath.tailName(),
+		Dir, false, false, zeroPtr, NoExcl)
+	return err
+}
+
+// SetMode implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) SetMode(
+	ctx context.Context, node Node, mode os.FileMode) (err error) {
+	fbo.log.CDebugf(ctx, "SetMode %s %v", getNodeIDStr(node), mode)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "SetMode %s %v done: %+v",
+			getNodeIDStr(node), mode, err)
+	}()
+
+	err = fbo.checkNode(node)
+	if err != nil {
+		return
+	}
+
+	return fbo.doMDWriteWithRetryUnlessCanceled(ctx,
+		func(lState *lockState) error {
+			filePath, err := fbo.pathFromNodeForMDWriteLocked(lState, node)
+			if err != nil {
+				return err
+			}
+
+			return fbo.setModeLocked(ctx, lState, filePath, mode)
+		})
+}
+
 func (fbo *folderBranchOps) setMtimeLocked(
 	ctx context.Context, lState *lockState, file path,
 	mtime *time.Time) error {
@@ -3530,10 +4025,12 @@ func (fbo *folderBranchOps) setMtimeLocked(
 
 func (fbo *folderBranchOps) SetMtime(
 	ctx context.Context, file Node, mtime *time.Time) (err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "SetMtime %s %v", getNodeIDStr(file), mtime)
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "SetMtime %s %v done: %+v",
-			getNodeIDStr(file), mtime, err)
+		fbo.deferLog.CInfof(ctx, "SetMtime %s %v done: %+v %s",
+			getNodeIDStr(file), mtime, err,
+			fbo.logOpFields("SetMtime", startTime))
 	}()
 
 	if mtime == nil {
@@ -3557,37 +4054,196 @@ func (fbo *folderBranchOps) SetMtime(
 		})
 }
 
-func (fbo *folderBranchOps) syncLocked(ctx context.Context,
-	lState *lockState, file path) (stillDirty bool, err error) {
+// GetXattr implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) GetXattr(
+	ctx context.Context, node Node, name string) (value []byte, err error) {
+	fbo.log.CDebugf(ctx, "GetXattr %s %s", getNodeIDStr(node), name)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "GetXattr %s %s done: %+v",
+			getNodeIDStr(node), name, err)
+	}()
+
+	var de DirEntry
+	err = runUnlessCanceled(ctx, func() error {
+		de, err = fbo.statEntry(ctx, node)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	value, ok := de.Xattrs[name]
+	if !ok {
+		return nil, NoSuchXattrError{name}
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// ListXattrs implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) ListXattrs(
+	ctx context.Context, node Node) (names []string, err error) {
+	fbo.log.CDebugf(ctx, "ListXattrs %s", getNodeIDStr(node))
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "ListXattrs %s done: %+v",
+			getNodeIDStr(node), err)
+	}()
+
+	var de DirEntry
+	err = runUnlessCanceled(ctx, func() error {
+		de, err = fbo.statEntry(ctx, node)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return de.xattrNames(), nil
+}
+
+// setXattrLocked sets the xattr called name on file to value, or
+// removes it if value is nil.
+func (fbo *folderBranchOps) setXattrLocked(
+	ctx context.Context, lState *lockState, file path, name string,
+	value []byte) error {
 	fbo.mdWriterLock.AssertLocked(lState)
 
-	// if the cache for this file isn't dirty, we're done
-	if !fbo.blocks.IsDirty(lState, file) {
-		return false, nil
+	// The root directory has no parent entry to keep xattrs in.
+	if !file.hasValidParent() {
+		return InvalidParentPathError{file}
 	}
 
-	// Verify we have permission to write.  We do this after the dirty
-	// check because otherwise readers who sync clean files on close
-	// would get an error.
+	// verify we have permission to write
 	md, err := fbo.getMDForWriteLocked(ctx, lState)
 	if err != nil {
-		return true, err
+		return err
+	}
+
+	dblock, de, err := fbo.blocks.GetDirtyParentAndEntry(
+		ctx, lState, md.ReadOnly(), file)
+	if err != nil {
+		return err
+	}
+
+	if value != nil {
+		de = de.withXattr(name, value)
+	} else if _, ok := de.Xattrs[name]; ok {
+		de = de.withoutXattr(name)
+	} else {
+		return NoSuchXattrError{name}
+	}
+	// changing xattrs counts as changing the file MD, so must set ctime
+	de.Ctime = fbo.nowUnixNano()
+
+	parentPath := file.parentPath()
+	sao, err := newSetAttrOp(file.tailName(), parentPath.tailPointer(),
+		xattrAttr, file.tailPointer())
+	if err != nil {
+		return err
 	}
 
 	// If the MD doesn't match the MD expected by the path, that
 	// implies we are using a cached path, which implies the node has
-	// been unlinked.  In that case, we can safely ignore this sync.
+	// been unlinked.  In that case, we can safely ignore this
+	// setxattr.
 	if md.data.Dir.BlockPointer.ID != file.path[0].BlockPointer.ID {
-		fbo.log.CDebugf(ctx, "Skipping sync for a removed file %v",
+		fbo.log.CDebugf(ctx, "Skipping setxattr for a removed file %v",
 			file.tailPointer())
-		// Removing the cached info here is a little sketchy,
-		// since there's no guarantee that this sync comes
-		// from closing the file, and we still want to serve
-		// stat calls accurately if the user still has an open
-		// handle to this file.
-		//
-		// Note in particular that if a file just had a dirty
-		// directory entry cached (due to an attribute change on a
+		fbo.blocks.UpdateCachedEntryAttributesOnRemovedFile(
+			ctx, lState, sao, de)
+		return nil
+	}
+
+	sao.setFinalPath(file)
+	md.AddOp(sao)
+
+	dblock.Children[file.tailName()] = de
+	_, err = fbo.syncBlockAndFinalizeLocked(
+		ctx, lState, md, dblock, *parentPath.parentPath(), parentPath.tailName(),
+		Dir, false, false, zeroPtr, NoExcl)
+	return err
+}
+
+func (fbo *folderBranchOps) doSetXattr(
+	ctx context.Context, node Node, name string, value []byte) error {
+	err := fbo.checkNode(node)
+	if err != nil {
+		return err
+	}
+
+	return fbo.doMDWriteWithRetryUnlessCanceled(ctx,
+		func(lState *lockState) error {
+			filePath, err := fbo.pathFromNodeForMDWriteLocked(lState, node)
+			if err != nil {
+				return err
+			}
+
+			return fbo.setXattrLocked(ctx, lState, filePath, name, value)
+		})
+}
+
+// SetXattr implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) SetXattr(
+	ctx context.Context, node Node, name string, value []byte) (err error) {
+	fbo.log.CDebugf(ctx, "SetXattr %s %s (%d bytes)",
+		getNodeIDStr(node), name, len(value))
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "SetXattr %s %s done: %+v",
+			getNodeIDStr(node), name, err)
+	}()
+
+	if len(name) > maxXattrNameBytes {
+		return XattrNameTooLongError{name, maxXattrNameBytes}
+	}
+	if len(value) > maxXattrValueBytes {
+		return XattrTooBigError{name, len(value), maxXattrValueBytes}
+	}
+
+	// Copy the value, both so the caller can reuse its buffer, and
+	// so that an empty value isn't mistaken for a removal.
+	return fbo.doSetXattr(ctx, node, name, append([]byte{}, value...))
+}
+
+// RemoveXattr implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) RemoveXattr(
+	ctx context.Context, node Node, name string) (err error) {
+	fbo.log.CDebugf(ctx, "RemoveXattr %s %s", getNodeIDStr(node), name)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "RemoveXattr %s %s done: %+v",
+			getNodeIDStr(node), name, err)
+	}()
+
+	return fbo.doSetXattr(ctx, node, name, nil)
+}
+
+func (fbo *folderBranchOps) syncLocked(ctx context.Context,
+	lState *lockState, file path) (stillDirty bool, err error) {
+	fbo.mdWriterLock.AssertLocked(lState)
+
+	// if the cache for this file isn't dirty, we're done
+	if !fbo.blocks.IsDirty(lState, file) {
+		return false, nil
+	}
+
+	// Verify we have permission to write.  We do this after the dirty
+	// check because otherwise readers who sync clean files on close
+	// would get an error.
+	md, err := fbo.getMDForWriteLocked(ctx, lState)
+	if err != nil {
+		return true, err
+	}
+
+	// If the MD doesn't match the MD expected by the path, that
+	// implies we are using a cached path, which implies the node has
+	// been unlinked.  In that case, we can safely ignore this sync.
+	if md.data.Dir.BlockPointer.ID != file.path[0].BlockPointer.ID {
+		fbo.log.CDebugf(ctx, "Skipping sync for a removed file %v",
+			file.tailPointer())
+		// Removing the cached info here is a little sketchy,
+		// since there's no guarantee that this sync comes
+		// from closing the file, and we still want to serve
+		// stat calls accurately if the user still has an open
+		// handle to this file.
+		//
+		// Note in particular that if a file just had a dirty
+		// directory entry cached (due to an attribute change on a
 		// removed file, for example), this will clear that attribute
 		// change.  If there's still an open file handle, the user
 		// won't be able to see the change anymore.
@@ -3620,10 +4276,13 @@ func (fbo *folderBranchOps) syncLocked(ctx context.Context,
 		return true, err
 	}
 
+	// The times were already stamped into the dirty entry, if there
+	// is one, when the file was last written.
+	setTimes := !syncState.timesSet
 	newPath, _, newBps, err :=
 		fbo.syncBlockAndCheckEmbedLocked(
 			ctx, lState, md, fblock, *file.parentPath(),
-			file.tailName(), File, true, true, zeroPtr, lbc)
+			file.tailName(), File, setTimes, setTimes, zeroPtr, lbc)
 	if err != nil {
 		return true, err
 	}
@@ -3638,7 +4297,9 @@ func (fbo *folderBranchOps) syncLocked(ctx context.Context,
 
 	blocksToRemove, err = doBlockPuts(ctx, fbo.config.BlockServer(),
 		fbo.config.BlockCache(), fbo.config.Reporter(), fbo.log, md.TlfID(),
-		md.GetTlfHandle().GetCanonicalName(), *bps)
+		md.GetTlfHandle().GetCanonicalName(), *bps,
+		fbo.config.MaxParallelBlockPuts(),
+		fbo.config.blockTransferTracker())
 	if err != nil {
 		return true, err
 	}
@@ -3664,10 +4325,12 @@ func (fbo *folderBranchOps) syncLocked(ctx context.Context,
 }
 
 func (fbo *folderBranchOps) Sync(ctx context.Context, file Node) (err error) {
+	startTime := fbo.config.Clock().Now()
 	fbo.log.CDebugf(ctx, "Sync %s", getNodeIDStr(file))
 	defer func() {
-		fbo.deferLog.CDebugf(ctx, "Sync %s done: %+v",
-			getNodeIDStr(file), err)
+		fbo.deferLog.CInfof(ctx, "Sync %s done: %+v %s",
+			getNodeIDStr(file), err,
+			fbo.logOpFields("Sync", startTime))
 	}()
 
 	err = fbo.checkNode(file)
@@ -3683,6 +4346,7 @@ func (fbo *folderBranchOps) Sync(ctx context.Context, file Node) (err error) {
 				return err
 			}
 
+			ctx := contextWithBlockTransferFile(ctx, filePath.String())
 			stillDirty, err = fbo.syncLocked(ctx, lState, filePath)
 			return err
 		})
@@ -3697,6 +4361,37 @@ func (fbo *folderBranchOps) Sync(ctx context.Context, file Node) (err error) {
 	return nil
 }
 
+// syncAllDirtyFiles syncs every file that is currently dirty in
+// this folder, e.g. before the process exits. It keeps going after
+// individual failures, and returns the first error it saw.
+func (fbo *folderBranchOps) syncAllDirtyFiles(ctx context.Context) error {
+	lState := makeFBOLockState()
+	dirtyRefs := fbo.blocks.GetDirtyRefs(lState)
+	if len(dirtyRefs) == 0 {
+		return nil
+	}
+	fbo.log.CDebugf(ctx, "Syncing %d dirty files", len(dirtyRefs))
+
+	var firstErr error
+	for _, ref := range dirtyRefs {
+		node := fbo.nodeCache.Get(ref)
+		if node == nil {
+			continue
+		}
+		err := fbo.Sync(ctx, node)
+		if err != nil {
+			p := fbo.nodeCache.PathFromNode(node)
+			fbo.log.CWarningf(ctx, "Couldn't sync dirty file with "+
+				"ref=%v, nodeID=%s, and path=%v: %v",
+				ref, getNodeIDStr(node), p, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
 func (fbo *folderBranchOps) FolderStatus(
 	ctx context.Context, folderBranch FolderBranch) (
 	fbs FolderBranchStatus, updateChan <-chan StatusUpdate, err error) {
@@ -3733,6 +4428,74 @@ func (fbo *folderBranchOps) UnregisterFromChanges(obs Observer) error {
 	return nil
 }
 
+// SubscribeToChanges implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) SubscribeToChanges(ctx context.Context,
+	folderBranch FolderBranch, node Node, subscriber ChangeSubscriber) (
+	err error) {
+	fbo.log.CDebugf(ctx, "SubscribeToChanges %s", getNodeIDStr(node))
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "SubscribeToChanges %s done: %+v",
+			getNodeIDStr(node), err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+	if node != nil {
+		err = fbo.checkNode(node)
+		if err != nil {
+			return err
+		}
+	}
+
+	fbo.changeSubs.subscribe(node, subscriber)
+	return nil
+}
+
+// SubscribeToFilteredChanges implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) SubscribeToFilteredChanges(ctx context.Context,
+	folderBranch FolderBranch, filter ChangeFilter,
+	subscriber ChangeSubscriber) (err error) {
+	fbo.log.CDebugf(ctx, "SubscribeToFilteredChanges %+v", filter)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "SubscribeToFilteredChanges %+v done: %+v",
+			filter, err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+	filter, err = filter.normalize()
+	if err != nil {
+		return err
+	}
+
+	fbo.changeSubs.subscribeFiltered(filter, subscriber)
+	return nil
+}
+
+// UnsubscribeFromChanges implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) UnsubscribeFromChanges(ctx context.Context,
+	folderBranch FolderBranch, subscriber ChangeSubscriber) error {
+	if folderBranch != fbo.folderBranch {
+		return WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+	fbo.changeSubs.unsubscribe(subscriber)
+	return nil
+}
+
+// revisionsApplied hands the given newly-applied revisions to
+// everything that keeps track of the folder's history.
+func (fbo *folderBranchOps) revisionsApplied(
+	ctx context.Context, rmds []ImmutableRootMetadata) {
+	fbo.editHistory.UpdateHistory(ctx, rmds)
+	fbo.webhook.revisionsApplied(ctx, fbo, rmds)
+	fbo.config.tlfActivityLog().revisionsApplied(ctx, fbo, rmds)
+}
+
 // notifyBatchLocked sends out a notification for the most recent op
 // in md.
 func (fbo *folderBranchOps) notifyBatchLocked(
@@ -3741,7 +4504,7 @@ func (fbo *folderBranchOps) notifyBatchLocked(
 
 	lastOp := md.data.Changes.Ops[len(md.data.Changes.Ops)-1]
 	fbo.notifyOneOpLocked(ctx, lState, lastOp, md, false)
-	fbo.editHistory.UpdateHistory(ctx, []ImmutableRootMetadata{md})
+	fbo.revisionsApplied(ctx, []ImmutableRootMetadata{md})
 }
 
 // searchForNode tries to figure out the path to the given
@@ -3810,6 +4573,7 @@ func (fbo *folderBranchOps) notifyOneOpLocked(ctx context.Context,
 	fbo.blocks.UpdatePointers(md, lState, op, shouldPrefetch)
 
 	var changes []NodeChange
+	var events []ChangeEvent
 	switch realOp := op.(type) {
 	default:
 		return
@@ -3824,6 +4588,11 @@ func (fbo *folderBranchOps) notifyOneOpLocked(ctx context.Context,
 			Node:       node,
 			DirUpdated: []string{realOp.NewName},
 		})
+		events = append(events, ChangeEvent{
+			Type: ChangeEventCreate,
+			Dir:  node,
+			Name: realOp.NewName,
+		})
 	case *rmOp:
 		node := fbo.nodeCache.Get(realOp.Dir.Ref.Ref())
 		if node == nil {
@@ -3835,6 +4604,11 @@ func (fbo *folderBranchOps) notifyOneOpLocked(ctx context.Context,
 			Node:       node,
 			DirUpdated: []string{realOp.OldName},
 		})
+		events = append(events, ChangeEvent{
+			Type: ChangeEventDelete,
+			Dir:  node,
+			Name: realOp.OldName,
+		})
 
 		// If this node exists, then the child node might exist too,
 		// and we need to unlink it in the node cache.
@@ -3914,6 +4688,17 @@ func (fbo *folderBranchOps) notifyOneOpLocked(ctx context.Context,
 				}
 			}
 		}
+
+		if oldNode != nil || newNode != nil {
+			events = append(events, ChangeEvent{
+				Type:    ChangeEventRename,
+				Dir:     oldNode,
+				Name:    realOp.OldName,
+				NewDir:  newNode,
+				NewName: realOp.NewName,
+				Entry:   fbo.nodeCache.Get(realOp.Renamed.Ref()),
+			})
+		}
 	case *syncOp:
 		node := fbo.nodeCache.Get(realOp.File.Ref.Ref())
 		if node == nil {
@@ -3926,6 +4711,12 @@ func (fbo *folderBranchOps) notifyOneOpLocked(ctx context.Context,
 			Node:        node,
 			FileUpdated: realOp.Writes,
 		})
+		events = append(events, ChangeEvent{
+			Type:   ChangeEventWrite,
+			Name:   node.GetBasename(),
+			Entry:  node,
+			Writes: realOp.Writes,
+		})
 	case *setAttrOp:
 		node := fbo.nodeCache.Get(realOp.Dir.Ref.Ref())
 		if node == nil {
@@ -3952,6 +4743,12 @@ func (fbo *folderBranchOps) notifyOneOpLocked(ctx context.Context,
 		changes = append(changes, NodeChange{
 			Node: childNode,
 		})
+		events = append(events, ChangeEvent{
+			Type:  ChangeEventAttr,
+			Dir:   node,
+			Name:  realOp.Name,
+			Entry: childNode,
+		})
 	case *GCOp:
 		// Unreferenced blocks in a GCOp mean that we shouldn't cache
 		// them anymore
@@ -3994,6 +4791,11 @@ func (fbo *folderBranchOps) notifyOneOpLocked(ctx context.Context,
 					Node:       parentNode,
 					DirUpdated: []string{p.tailName()},
 				})
+				events = append(events, ChangeEvent{
+					Type: ChangeEventDelete,
+					Dir:  parentNode,
+					Name: p.tailName(),
+				})
 			}
 
 			fbo.log.CDebugf(ctx, "resolutionOp: remove %s, node %s",
@@ -4017,7 +4819,21 @@ func (fbo *folderBranchOps) notifyOneOpLocked(ctx context.Context,
 		}
 	}
 
-	fbo.observers.batchChanges(ctx, changes)
+	if shouldPrefetch {
+		// Only ops from other devices are prefetched, and
+		// those are the ones that can come in bursts.
+		fbo.observers.batchRemoteChanges(ctx, changes)
+	} else {
+		fbo.observers.batchChanges(ctx, changes)
+	}
+	if fbo.changeSubs.hasSubscribers() {
+		setChangeEventPaths(fbo.nodeCache, events)
+		for i := range events {
+			events[i].Writer = md.LastModifyingWriter()
+			events[i].LocalTime = md.localTimestamp
+		}
+		fbo.changeSubs.notify(events)
+	}
 }
 
 func (fbo *folderBranchOps) getCurrMDRevisionLocked(lState *lockState) MetadataRevision {
@@ -4134,7 +4950,7 @@ func (fbo *folderBranchOps) applyMDUpdatesLocked(ctx context.Context,
 		appliedRevs = append(appliedRevs, rmd)
 	}
 	if len(appliedRevs) > 0 {
-		fbo.editHistory.UpdateHistory(ctx, appliedRevs)
+		fbo.revisionsApplied(ctx, appliedRevs)
 	}
 	return nil
 }
@@ -4231,7 +5047,7 @@ func (fbo *folderBranchOps) setLatestMergedRevisionLocked(ctx context.Context, l
 // Assumes all necessary locking is either already done by caller, or
 // is done by applyFunc.
 func (fbo *folderBranchOps) getAndApplyMDUpdates(ctx context.Context,
-	lState *lockState, applyFunc applyMDUpdatesFunc) error {
+	lState *lockState, applyFunc applyMDUpdatesFunc) (err error) {
 	// first look up all MD revisions newer than my current head
 	start := fbo.getLatestMergedRevision(lState) + 1
 	rmds, err := getMergedMDUpdates(ctx, fbo.config, fbo.id(), start)
@@ -4239,6 +5055,15 @@ func (fbo *folderBranchOps) getAndApplyMDUpdates(ctx context.Context,
 		return err
 	}
 
+	if len(rmds) > 0 {
+		fbo.syncState.pushTLFCatchingUp(
+			fbo.id(), rmds[len(rmds)-1].Revision())
+		defer func() {
+			fbo.syncState.pushTLFCaughtUp(
+				fbo.id(), fbo.getLatestMergedRevision(lState), err)
+		}()
+	}
+
 	err = applyFunc(ctx, lState, rmds)
 	if err != nil {
 		return err
@@ -4378,12 +5203,26 @@ func (fbo *folderBranchOps) undoUnmergedMDUpdatesLocked(
 	return unmergedPtrs, nil
 }
 
+// unstageLocked throws away this device's unmerged branch and goes
+// back to the merged branch.  If keepConflictedCopy is true, the
+// last state of the unmerged branch is kept as a read-only
+// conflicted copy of the TLF.
 func (fbo *folderBranchOps) unstageLocked(ctx context.Context,
-	lState *lockState) error {
+	lState *lockState, keepConflictedCopy bool) error {
 	fbo.mdWriterLock.AssertLocked(lState)
 
 	// fetch all of my unstaged updates, and undo them one at a time
 	bid, wasMasterBranch := fbo.bid, fbo.isMasterBranchLocked(lState)
+	var conflictHandle *TlfHandle
+	unmergedHead := fbo.getHead(lState)
+	if keepConflictedCopy && !wasMasterBranch {
+		var err error
+		conflictHandle, err = fbo.makeConflictHandle(unmergedHead)
+		if err != nil {
+			fbo.log.CWarningf(ctx,
+				"Can't keep a conflicted copy of branch %s: %+v", bid, err)
+		}
+	}
 	unmergedPtrs, err := fbo.undoUnmergedMDUpdatesLocked(ctx, lState)
 	if err != nil {
 		return err
@@ -4409,10 +5248,13 @@ func (fbo *folderBranchOps) unstageLocked(ctx context.Context,
 		return err
 	}
 
-	// Finally, create a resolutionOp with the newly-unref'd pointers.
+	// Finally, create a resolutionOp with the newly-unref'd
+	// pointers, unless a conflicted copy still needs them.
 	resOp := newResolutionOp()
-	for _, ptr := range unmergedPtrs {
-		resOp.AddUnrefBlock(ptr)
+	if conflictHandle == nil {
+		for _, ptr := range unmergedPtrs {
+			resOp.AddUnrefBlock(ptr)
+		}
 	}
 	md.AddOp(resOp)
 
@@ -4421,7 +5263,155 @@ func (fbo *folderBranchOps) unstageLocked(ctx context.Context,
 		return err
 	}
 
-	return fbo.finalizeMDWriteLocked(ctx, lState, md, bps, NoExcl)
+	err = fbo.finalizeMDWriteLocked(ctx, lState, md, bps, NoExcl)
+	if err != nil {
+		return err
+	}
+
+	if conflictHandle != nil {
+		fbo.log.CDebugf(ctx, "Keeping branch %s as %s", bid,
+			conflictHandle.GetCanonicalPath())
+		fbo.conflictLock.Lock()
+		defer fbo.conflictLock.Unlock()
+		fbo.conflictBranches = append(fbo.conflictBranches, conflictBranch{
+			handle: conflictHandle,
+			head:   unmergedHead,
+			unrefs: unmergedPtrs,
+		})
+	}
+	return nil
+}
+
+// makeConflictHandle returns the handle naming a new conflicted copy
+// of the TLF with the given unmerged head, dated today and numbered
+// after any other conflicted copies from the same day.
+func (fbo *folderBranchOps) makeConflictHandle(
+	head ImmutableRootMetadata) (*TlfHandle, error) {
+	handle := head.GetTlfHandle()
+	if handle.ConflictInfo() != nil {
+		return nil, errors.Errorf(
+			"%s is already a conflicted TLF", handle.GetCanonicalPath())
+	}
+
+	fbo.conflictLock.Lock()
+	defer fbo.conflictLock.Unlock()
+	info, err := tlf.NewHandleExtension(
+		tlf.HandleExtensionConflict, 1, "", fbo.config.Clock().Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, cb := range fbo.conflictBranches {
+		if cb.handle.ConflictInfo().Date == info.Date {
+			info.Number++
+		}
+	}
+	return handle.WithUpdatedConflictInfo(fbo.config.Codec(), info)
+}
+
+// getConflictBranch returns the conflict branch whose conflicted copy
+// has the given favorite, if any.
+func (fbo *folderBranchOps) getConflictBranch(
+	fav Favorite) (conflictBranch, bool) {
+	fbo.conflictLock.Lock()
+	defer fbo.conflictLock.Unlock()
+	for _, cb := range fbo.conflictBranches {
+		if cb.handle.ToFavorite() == fav {
+			return cb, true
+		}
+	}
+	return conflictBranch{}, false
+}
+
+// getConflictedCopyFavorites returns a favorite for each conflicted
+// copy of this TLF.
+func (fbo *folderBranchOps) getConflictedCopyFavorites() []Favorite {
+	fbo.conflictLock.Lock()
+	defer fbo.conflictLock.Unlock()
+	favs := make([]Favorite, 0, len(fbo.conflictBranches))
+	for _, cb := range fbo.conflictBranches {
+		favs = append(favs, cb.handle.ToFavorite())
+	}
+	return favs
+}
+
+// clearConflictBranch forgets the given conflict branch, and
+// unreferences the blocks that only its conflicted copy still
+// needed.
+func (fbo *folderBranchOps) clearConflictBranch(
+	ctx context.Context, cb conflictBranch) (err error) {
+	fbo.log.CDebugf(ctx, "clearConflictBranch %s",
+		cb.handle.GetCanonicalPath())
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "clearConflictBranch %s done: %+v",
+			cb.handle.GetCanonicalPath(), err)
+	}()
+
+	return runUnlessCanceled(ctx, func() error {
+		lState := makeFBOLockState()
+		fbo.mdWriterLock.Lock(lState)
+		defer fbo.mdWriterLock.Unlock(lState)
+
+		if !fbo.isMasterBranchLocked(lState) {
+			// The unrefs would have to survive conflict
+			// resolution of the current branch.
+			return errors.Errorf("Can't clear %s while %s is unmerged",
+				cb.handle.GetCanonicalPath(),
+				fbo.getHead(lState).GetTlfHandle().GetCanonicalPath())
+		}
+
+		if len(cb.unrefs) > 0 {
+			md, err := fbo.getMDForWriteLocked(ctx, lState)
+			if err != nil {
+				return err
+			}
+			resOp := newResolutionOp()
+			for _, ptr := range cb.unrefs {
+				resOp.AddUnrefBlock(ptr)
+			}
+			md.AddOp(resOp)
+
+			bps, err := fbo.maybeUnembedAndPutBlocks(ctx, md)
+			if err != nil {
+				return err
+			}
+			err = fbo.finalizeMDWriteLocked(ctx, lState, md, bps, NoExcl)
+			if err != nil {
+				return err
+			}
+		}
+
+		fbo.conflictLock.Lock()
+		defer fbo.conflictLock.Unlock()
+		for i, other := range fbo.conflictBranches {
+			if other.handle == cb.handle {
+				fbo.conflictBranches = append(fbo.conflictBranches[:i],
+					fbo.conflictBranches[i+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// setConflictedCopyHead sets the head of this read-only branch to
+// the last unmerged head of the conflict branch it shows.
+func (fbo *folderBranchOps) setConflictedCopyHead(
+	ctx context.Context, md ImmutableRootMetadata) error {
+	if fbo.bType == standard {
+		return errors.Errorf(
+			"Can't show a conflicted copy on read-write branch %s",
+			fbo.folderBranch)
+	}
+
+	lState := makeFBOLockState()
+	fbo.mdWriterLock.Lock(lState)
+	defer fbo.mdWriterLock.Unlock(lState)
+	fbo.headLock.Lock(lState)
+	defer fbo.headLock.Unlock(lState)
+	if fbo.head != (ImmutableRootMetadata{}) {
+		return nil
+	}
+	return fbo.setInitialHeadTrustedLocked(ctx, lState, md)
 }
 
 // TODO: remove once we have automatic conflict resolution
@@ -4460,7 +5450,7 @@ func (fbo *folderBranchOps) UnstageForTesting(
 			lState := makeFBOLockState()
 			c <- fbo.doMDWriteWithRetry(ctx, lState,
 				func(lState *lockState) error {
-					return fbo.unstageLocked(freshCtx, lState)
+					return fbo.unstageLocked(freshCtx, lState, false)
 				})
 		}()
 
@@ -4475,7 +5465,7 @@ func (fbo *folderBranchOps) UnstageForTesting(
 
 // mdWriterLock must be taken by the caller.
 func (fbo *folderBranchOps) rekeyLocked(ctx context.Context,
-	lState *lockState, promptPaper bool) (err error) {
+	lState *lockState, promptPaper, rotate bool) (err error) {
 	fbo.log.CDebugf(ctx, "rekeyLocked")
 	defer func() {
 		fbo.deferLog.CDebugf(ctx, "rekeyLocked done: %+v", err)
@@ -4528,8 +5518,15 @@ func (fbo *folderBranchOps) rekeyLocked(ctx context.Context,
 	}
 
 	currKeyGen := md.LatestKeyGeneration()
-	rekeyDone, tlfCryptKey, err := fbo.config.KeyManager().
-		Rekey(ctx, md, promptPaper)
+	var rekeyDone bool
+	var tlfCryptKey *kbfscrypto.TLFCryptKey
+	if rotate {
+		rekeyDone, tlfCryptKey, err = fbo.config.KeyManager().
+			RotateKey(ctx, md)
+	} else {
+		rekeyDone, tlfCryptKey, err = fbo.config.KeyManager().
+			Rekey(ctx, md, promptPaper)
+	}
 
 	stillNeedsRekey := false
 	switch err.(type) {
@@ -4660,7 +5657,7 @@ func (fbo *folderBranchOps) rekeyWithPrompt() {
 
 	err = fbo.doMDWriteWithRetryUnlessCanceled(ctx,
 		func(lState *lockState) error {
-			return fbo.rekeyLocked(ctx, lState, true)
+			return fbo.rekeyLocked(ctx, lState, true, false)
 		})
 }
 
@@ -4673,7 +5670,26 @@ func (fbo *folderBranchOps) Rekey(ctx context.Context, tlf tlf.ID) (err error) {
 
 	return fbo.doMDWriteWithRetryUnlessCanceled(ctx,
 		func(lState *lockState) error {
-			return fbo.rekeyLocked(ctx, lState, false)
+			return fbo.rekeyLocked(ctx, lState, false, false)
+		})
+}
+
+// RotateKey rekeys the given folder with a new key generation.
+func (fbo *folderBranchOps) RotateKey(ctx context.Context, tlf tlf.ID) (
+	err error) {
+	fbo.log.CDebugf(ctx, "RotateKey")
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "RotateKey done: %+v", err)
+	}()
+
+	fb := FolderBranch{tlf, MasterBranch}
+	if fb != fbo.folderBranch {
+		return WrongOpsError{fbo.folderBranch, fb}
+	}
+
+	return fbo.doMDWriteWithRetryUnlessCanceled(ctx,
+		func(lState *lockState) error {
+			return fbo.rekeyLocked(ctx, lState, false, true)
 		})
 }
 
@@ -5234,22 +6250,233 @@ func (fbo *folderBranchOps) backgroundFlusher(betweenFlushes time.Duration) {
 	}
 }
 
-func (fbo *folderBranchOps) blockUnmergedWrites(lState *lockState) {
-	fbo.mdWriterLock.Lock(lState)
+// kickOffTlfSync tells the background TLF syncer to make sure all the
+// blocks of the current head are on disk.
+func (fbo *folderBranchOps) kickOffTlfSync() {
+	select {
+	case fbo.tlfSyncChan <- struct{}{}:
+	default:
+		// A sync is already pending, and it will use the latest
+		// head.
+	}
 }
 
-func (fbo *folderBranchOps) unblockUnmergedWrites(lState *lockState) {
-	fbo.mdWriterLock.Unlock(lState)
+// queueTlfSyncUnrefs queues up the blocks unreferenced by md to be
+// deleted from disk by the background TLF syncer.
+func (fbo *folderBranchOps) queueTlfSyncUnrefs(md ImmutableRootMetadata) {
+	var ptrs []BlockPointer
+	for _, op := range md.data.Changes.Ops {
+		for _, ptr := range op.Unrefs() {
+			// Can be zeroPtr in weird failed sync scenarios.
+			if ptr != zeroPtr {
+				ptrs = append(ptrs, ptr)
+			}
+		}
+		for _, update := range op.allUpdates() {
+			if update.Ref != update.Unref {
+				ptrs = append(ptrs, update.Unref)
+			}
+		}
+	}
+	if len(ptrs) == 0 {
+		return
+	}
+	fbo.tlfSyncUnrefsLock.Lock()
+	defer fbo.tlfSyncUnrefsLock.Unlock()
+	fbo.tlfSyncUnrefs = append(fbo.tlfSyncUnrefs, ptrs...)
 }
 
-func (fbo *folderBranchOps) finalizeResolutionLocked(ctx context.Context,
-	lState *lockState, md *RootMetadata, bps *blockPutState,
-	newOps []op, blocksToDelete []kbfsblock.ID) error {
-	fbo.mdWriterLock.AssertLocked(lState)
+func (fbo *folderBranchOps) takeTlfSyncUnrefs() []BlockPointer {
+	fbo.tlfSyncUnrefsLock.Lock()
+	defer fbo.tlfSyncUnrefsLock.Unlock()
+	ptrs := fbo.tlfSyncUnrefs
+	fbo.tlfSyncUnrefs = nil
+	return ptrs
+}
 
-	// Put the blocks into the cache so that, even if we fail below,
-	// future attempts may reuse the blocks.
-	err := fbo.finalizeBlocks(bps)
+// syncBlocksToDisk makes sure that the block at ptr, and every block
+// reachable from it, is in the on-disk cache of synced TLFs. It
+// records every block whose whole subtree is on disk in done, and
+// skips those, since blocks are immutable.
+func (fbo *folderBranchOps) syncBlocksToDisk(ctx context.Context,
+	bg *realBlockGetter, kmd KeyMetadata, ptr BlockPointer, block Block,
+	done map[kbfsblock.ID]bool) error {
+	if done[ptr.ID] {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	if err := checkDataVersion(fbo.config, path{}, ptr); err != nil {
+		return err
+	}
+	if err := bg.getBlock(ctx, kmd, ptr, block); err != nil {
+		return err
+	}
+
+	switch b := block.(type) {
+	case *DirBlock:
+		if b.IsInd {
+			for _, iptr := range b.IPtrs {
+				err := fbo.syncBlocksToDisk(
+					ctx, bg, kmd, iptr.BlockPointer, NewDirBlock(), done)
+				if err != nil {
+					return err
+				}
+			}
+			break
+		}
+		for name, de := range b.Children {
+			var child Block
+			switch de.Type {
+			case Dir:
+				child = NewDirBlock()
+			case File, Exec:
+				child = NewFileBlock()
+			default:
+				// Symlinks don't have blocks.
+				continue
+			}
+			err := fbo.syncBlocksToDisk(
+				ctx, bg, kmd, de.BlockPointer, child, done)
+			if err != nil {
+				return errors.WithMessage(err, name)
+			}
+		}
+	case *FileBlock:
+		if b.IsInd {
+			for _, iptr := range b.IPtrs {
+				err := fbo.syncBlocksToDisk(
+					ctx, bg, kmd, iptr.BlockPointer, NewFileBlock(), done)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	done[ptr.ID] = true
+	return nil
+}
+
+// backgroundTlfSyncer downloads every block of the current head to
+// disk whenever it's kicked off, as long as this TLF is synced to
+// this device. Blocks that were already synced from earlier heads are
+// skipped, so keeping up with updates only costs the new blocks.
+// Before each sync, it deletes the blocks that the heads set since
+// the last one have unreferenced.
+func (fbo *folderBranchOps) backgroundTlfSyncer() {
+	lState := makeFBOLockState()
+	var generation uint64
+	var done map[kbfsblock.ID]bool
+	for {
+		select {
+		case <-fbo.tlfSyncChan:
+		case <-fbo.shutdownChan:
+			return
+		}
+
+		syncCache := fbo.config.tlfSyncCache()
+		unrefs := fbo.takeTlfSyncUnrefs()
+		if g := syncCache.generation(fbo.id()); g == 0 {
+			continue
+		} else if g != generation {
+			// The TLF was (re-)synced, so nothing is on disk yet.
+			generation = g
+			done = make(map[kbfsblock.ID]bool)
+		}
+
+		removed, err := syncCache.remove(fbo.id(), unrefs)
+		for _, id := range removed {
+			delete(done, id)
+		}
+		if err != nil {
+			// Leaving some unreferenced blocks behind only costs
+			// disk space.
+			fbo.log.CWarningf(nil, "Couldn't delete unreferenced "+
+				"blocks from disk: %+v", err)
+		} else if len(removed) > 0 {
+			fbo.log.CDebugf(nil, "Deleted %d unreferenced blocks from disk",
+				len(removed))
+		}
+
+		md := fbo.getHead(lState)
+		if md == (ImmutableRootMetadata{}) || !md.IsReadable() {
+			continue
+		}
+
+		err = fbo.runUnlessShutdown(func(ctx context.Context) error {
+			ctx = NewContextReplayable(ctx,
+				func(ctx context.Context) context.Context {
+					return context.WithValue(ctx, CtxBackgroundSyncKey, "1")
+				})
+			fbo.log.CDebugf(ctx, "Syncing revision %d to disk", md.Revision())
+			bg := &realBlockGetter{config: fbo.config, log: fbo.log}
+			return fbo.syncBlocksToDisk(ctx, bg, md,
+				md.data.Dir.BlockPointer, NewDirBlock(), done)
+		})
+		switch err.(type) {
+		case nil:
+			fbo.log.CDebugf(nil, "Synced revision %d to disk", md.Revision())
+		case ShutdownHappenedError:
+			return
+		default:
+			// The next head update will try again, and pick up
+			// where this one left off.
+			fbo.log.CWarningf(nil, "Couldn't sync revision %d to disk: %+v",
+				md.Revision(), err)
+		}
+	}
+}
+
+// SetTlfSyncMode implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) SetTlfSyncMode(
+	ctx context.Context, tlfID tlf.ID, mode TlfSyncMode) (err error) {
+	fbo.log.CDebugf(ctx, "SetTlfSyncMode %s", mode)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "SetTlfSyncMode done: %+v", err)
+	}()
+
+	fb := FolderBranch{Tlf: tlfID, Branch: MasterBranch}
+	if fb != fbo.folderBranch {
+		return WrongOpsError{fbo.folderBranch, fb}
+	}
+
+	err = fbo.config.tlfSyncCache().setMode(tlfID, mode)
+	if err != nil {
+		return err
+	}
+	if mode != TlfSyncModeFull {
+		return nil
+	}
+
+	// Make sure there's a head to sync.
+	lState := makeFBOLockState()
+	_, err = fbo.getMDForReadHelper(ctx, lState, mdReadNeedIdentify)
+	if err != nil {
+		return err
+	}
+	fbo.kickOffTlfSync()
+	return nil
+}
+
+func (fbo *folderBranchOps) blockUnmergedWrites(lState *lockState) {
+	fbo.mdWriterLock.Lock(lState)
+}
+
+func (fbo *folderBranchOps) unblockUnmergedWrites(lState *lockState) {
+	fbo.mdWriterLock.Unlock(lState)
+}
+
+func (fbo *folderBranchOps) finalizeResolutionLocked(ctx context.Context,
+	lState *lockState, md *RootMetadata, bps *blockPutState,
+	newOps []op, blocksToDelete []kbfsblock.ID) error {
+	fbo.mdWriterLock.AssertLocked(lState)
+
+	// Put the blocks into the cache so that, even if we fail below,
+	// future attempts may reuse the blocks.
+	err := fbo.finalizeBlocks(bps)
 	if err != nil {
 		return err
 	}
@@ -5310,7 +6537,7 @@ func (fbo *folderBranchOps) finalizeResolutionLocked(ctx context.Context,
 	for _, op := range newOps {
 		fbo.notifyOneOpLocked(ctx, lState, op, irmd, false)
 	}
-	fbo.editHistory.UpdateHistory(ctx, []ImmutableRootMetadata{irmd})
+	fbo.revisionsApplied(ctx, []ImmutableRootMetadata{irmd})
 	return nil
 }
 
@@ -5343,7 +6570,7 @@ func (fbo *folderBranchOps) unstageAfterFailedResolution(ctx context.Context,
 
 	fbo.log.CWarningf(ctx, "Unstaging branch %s after a resolution failure",
 		fbo.bid)
-	return fbo.unstageLocked(ctx, lState)
+	return fbo.unstageLocked(ctx, lState, true)
 }
 
 func (fbo *folderBranchOps) handleTLFBranchChange(ctx context.Context,
@@ -5483,6 +6710,50 @@ func (fbo *folderBranchOps) GetUpdateHistory(ctx context.Context,
 		return TLFUpdateHistory{}, err
 	}
 
+	return fbo.makeUpdateHistory(ctx, rmds)
+}
+
+// GetUnmergedHistory implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) GetUnmergedHistory(ctx context.Context,
+	folderBranch FolderBranch) (history TLFUpdateHistory, err error) {
+	fbo.log.CDebugf(ctx, "GetUnmergedHistory")
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "GetUnmergedHistory done: %+v", err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return TLFUpdateHistory{}, WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+
+	lState := makeFBOLockState()
+	bid := func() BranchID {
+		fbo.mdWriterLock.Lock(lState)
+		defer fbo.mdWriterLock.Unlock(lState)
+		return fbo.bid
+	}()
+	if bid == NullBranchID {
+		return TLFUpdateHistory{Updates: []UpdateSummary{}}, nil
+	}
+
+	_, rmds, err := getUnmergedMDUpdates(ctx, fbo.config, fbo.id(),
+		bid, fbo.getCurrMDRevision(lState))
+	if err != nil {
+		return TLFUpdateHistory{}, err
+	}
+
+	history, err = fbo.makeUpdateHistory(ctx, rmds)
+	if err != nil {
+		return TLFUpdateHistory{}, err
+	}
+	history.BranchID = bid.String()
+	return history, nil
+}
+
+// makeUpdateHistory summarizes the given MD revisions and the ops
+// they contain.
+func (fbo *folderBranchOps) makeUpdateHistory(ctx context.Context,
+	rmds []ImmutableRootMetadata) (history TLFUpdateHistory, err error) {
 	if len(rmds) > 0 {
 		rmd := rmds[len(rmds)-1]
 		history.ID = rmd.TlfID().String()
@@ -5552,6 +6823,393 @@ func (fbo *folderBranchOps) GetEditHistory(ctx context.Context,
 	return fbo.editHistory.GetComplete(ctx, head)
 }
 
+// GetActivityLog implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) GetActivityLog(ctx context.Context,
+	folderBranch FolderBranch, since time.Time) (
+	entries []TlfActivityEntry, err error) {
+	fbo.log.CDebugf(ctx, "GetActivityLog since %s", since)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "GetActivityLog done: %d entries, %+v",
+			len(entries), err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return nil, WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+
+	activityLog := fbo.config.tlfActivityLog()
+	if activityLog == nil {
+		return nil, errors.New("The TLF activity log is not enabled")
+	}
+
+	// Make sure the user can read this folder.
+	lState := makeFBOLockState()
+	_, err = fbo.getMDForReadNeedIdentify(ctx, lState)
+	if err != nil {
+		return nil, err
+	}
+
+	return activityLog.get(fbo.id(), since)
+}
+
+// getArchivedEntry returns the MD of the given past revision of the
+// folder, along with the full path to the entry at the given names
+// below the root, and its DirEntry, as of that revision.
+func (fbo *folderBranchOps) getArchivedEntry(ctx context.Context,
+	lState *lockState, rev MetadataRevision, names []string) (
+	ImmutableRootMetadata, path, DirEntry, error) {
+	// Make sure the user can read this folder now.
+	head, err := fbo.getMDForReadNeedIdentify(ctx, lState)
+	if err != nil {
+		return ImmutableRootMetadata{}, path{}, DirEntry{}, err
+	}
+	if rev < MetadataRevisionInitial || rev > head.Revision() {
+		return ImmutableRootMetadata{}, path{}, DirEntry{},
+			NoSuchRevisionError{fbo.id(), rev}
+	}
+
+	rmd := head
+	if rev != head.Revision() {
+		rmd, err = getSingleMD(
+			ctx, fbo.config, fbo.id(), NullBranchID, rev, Merged)
+		if err != nil {
+			return ImmutableRootMetadata{}, path{}, DirEntry{}, err
+		}
+	}
+
+	p := path{fbo.folderBranch, []pathNode{{
+		rmd.data.Dir.BlockPointer,
+		string(rmd.GetTlfHandle().GetCanonicalName()),
+	}}}
+	de := rmd.data.Dir
+	for _, name := range names {
+		if de.Type != Dir {
+			return ImmutableRootMetadata{}, path{}, DirEntry{},
+				NotDirError{p}
+		}
+		dblock, err := fbo.blocks.GetDirBlockForReading(ctx, lState,
+			rmd.ReadOnly(), p.tailPointer(), p.Branch, p)
+		if err != nil {
+			return ImmutableRootMetadata{}, path{}, DirEntry{}, err
+		}
+		child, ok := dblock.Children[name]
+		if !ok {
+			return ImmutableRootMetadata{}, path{}, DirEntry{},
+				NoSuchNameError{name}
+		}
+		de = child
+		p = p.ChildPath(name, child.BlockPointer)
+	}
+	return rmd, p, de, nil
+}
+
+// GetArchivedEntry implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) GetArchivedEntry(ctx context.Context,
+	folderBranch FolderBranch, rev MetadataRevision, p []string) (
+	ei EntryInfo, err error) {
+	fbo.log.CDebugf(ctx, "GetArchivedEntry rev=%d %v", rev, p)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "GetArchivedEntry rev=%d %v done: %+v",
+			rev, p, err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return EntryInfo{}, WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+
+	var de DirEntry
+	err = runUnlessCanceled(ctx, func() error {
+		lState := makeFBOLockState()
+		var err error
+		_, _, de, err = fbo.getArchivedEntry(ctx, lState, rev, p)
+		return err
+	})
+	if err != nil {
+		return EntryInfo{}, err
+	}
+	return de.EntryInfo, nil
+}
+
+// GetArchivedDirChildren implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) GetArchivedDirChildren(ctx context.Context,
+	folderBranch FolderBranch, rev MetadataRevision, p []string) (
+	children map[string]EntryInfo, err error) {
+	fbo.log.CDebugf(ctx, "GetArchivedDirChildren rev=%d %v", rev, p)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "GetArchivedDirChildren rev=%d %v "+
+			"done: %d children, %+v", rev, p, len(children), err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return nil, WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+
+	err = runUnlessCanceled(ctx, func() error {
+		lState := makeFBOLockState()
+		rmd, dirPath, de, err := fbo.getArchivedEntry(ctx, lState, rev, p)
+		if err != nil {
+			return err
+		}
+		if de.Type != Dir {
+			return NotDirError{dirPath}
+		}
+		dblock, err := fbo.blocks.GetDirBlockForReading(ctx, lState,
+			rmd.ReadOnly(), dirPath.tailPointer(), dirPath.Branch, dirPath)
+		if err != nil {
+			return err
+		}
+		children = make(map[string]EntryInfo, len(dblock.Children))
+		for name, child := range dblock.Children {
+			children[name] = child.EntryInfo
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return children, nil
+}
+
+// ReadArchived implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) ReadArchived(ctx context.Context,
+	folderBranch FolderBranch, rev MetadataRevision, p []string,
+	dest []byte, off int64) (n int64, err error) {
+	fbo.log.CDebugf(ctx, "ReadArchived rev=%d %v %d %d",
+		rev, p, len(dest), off)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "ReadArchived rev=%d %v %d %d done: %+v",
+			rev, p, len(dest), off, err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return 0, WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+
+	// Don't let the goroutine below write directly to the return
+	// variable; see Read.
+	var bytesRead int64
+	err = runUnlessCanceled(ctx, func() error {
+		lState := makeFBOLockState()
+		rmd, filePath, de, err := fbo.getArchivedEntry(ctx, lState, rev, p)
+		if err != nil {
+			return err
+		}
+		if de.Type != File && de.Type != Exec {
+			return NotFileError{filePath}
+		}
+		bytesRead, err = fbo.blocks.Read(
+			ctx, lState, rmd.ReadOnly(), filePath, dest, off)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return bytesRead, nil
+}
+
+// GetTlfSettings implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) GetTlfSettings(ctx context.Context,
+	folderBranch FolderBranch) (settings TlfSettings, err error) {
+	fbo.log.CDebugf(ctx, "GetTlfSettings")
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "GetTlfSettings done: %s %+v",
+			settings, err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return TlfSettings{}, WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+
+	lState := makeFBOLockState()
+	md, err := fbo.getMDForReadNeedIdentify(ctx, lState)
+	if err != nil {
+		return TlfSettings{}, err
+	}
+
+	return md.TlfSettings(), nil
+}
+
+func (fbo *folderBranchOps) setTlfSettingsLocked(ctx context.Context,
+	lState *lockState, settings TlfSettings) error {
+	fbo.mdWriterLock.AssertLocked(lState)
+
+	md, err := fbo.getMDForWriteLocked(ctx, lState)
+	if err != nil {
+		return err
+	}
+
+	// Settings changes don't get replayed by conflict resolution,
+	// so only allow them on the merged branch.
+	if md.MergedStatus() == Unmerged {
+		return UnexpectedUnmergedPutError{}
+	}
+
+	md.AddOp(newSettingsOp(settings))
+	md.SetTlfSettings(settings)
+
+	return fbo.finalizeMergedOnlyMDWriteLocked(ctx, lState, md)
+}
+
+// SetTlfSettings implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) SetTlfSettings(ctx context.Context,
+	folderBranch FolderBranch, settings TlfSettings) (err error) {
+	fbo.log.CDebugf(ctx, "SetTlfSettings %s", settings)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "SetTlfSettings done: %+v", err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+
+	if err := settings.checkValid(); err != nil {
+		return err
+	}
+
+	return fbo.doMDWriteWithRetryUnlessCanceled(ctx,
+		func(lState *lockState) error {
+			return fbo.setTlfSettingsLocked(ctx, lState, settings)
+		})
+}
+
+// heldAdvisoryLock tracks one advisory lock held by this device.  Its
+// mutex serializes lease renewals with the release of the lock.
+type heldAdvisoryLock struct {
+	lock     sync.Mutex
+	released bool // protected by lock
+}
+
+// Lock implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) Lock(ctx context.Context,
+	folderBranch FolderBranch, lockID LockID, wait bool) (err error) {
+	fbo.log.CDebugf(ctx, "Lock %s (wait=%t)", lockID, wait)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "Lock %s done: %+v", lockID, err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+
+	for {
+		err = fbo.config.MDServer().Lock(ctx, fbo.id(), lockID)
+		if _, ok := err.(MDServerErrorLocked); !ok || !wait {
+			break
+		}
+		select {
+		case <-time.After(tlfLockRetryPeriod):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fbo.heldLocksLock.Lock()
+	defer fbo.heldLocksLock.Unlock()
+	if fbo.heldLocks[lockID] == nil {
+		fbo.heldLocks[lockID] = &heldAdvisoryLock{}
+	}
+	if !fbo.refreshingLocks {
+		fbo.refreshingLocks = true
+		go fbo.backgroundLockRefresher()
+	}
+	return nil
+}
+
+// Unlock implements the KBFSOps interface for folderBranchOps.
+func (fbo *folderBranchOps) Unlock(ctx context.Context,
+	folderBranch FolderBranch, lockID LockID) (err error) {
+	fbo.log.CDebugf(ctx, "Unlock %s", lockID)
+	defer func() {
+		fbo.deferLog.CDebugf(ctx, "Unlock %s done: %+v", lockID, err)
+	}()
+
+	if folderBranch != fbo.folderBranch {
+		return WrongOpsError{fbo.folderBranch, folderBranch}
+	}
+
+	// Stop renewing the lease first, and wait out any renewal
+	// that's already under way, so the refresher can't re-take the
+	// lock after it's released.
+	fbo.heldLocksLock.Lock()
+	held := fbo.heldLocks[lockID]
+	delete(fbo.heldLocks, lockID)
+	fbo.heldLocksLock.Unlock()
+	if held != nil {
+		held.lock.Lock()
+		defer held.lock.Unlock()
+		held.released = true
+	}
+
+	return fbo.config.MDServer().ReleaseLock(ctx, fbo.id(), lockID)
+}
+
+// renewLock renews the lease of the given held advisory lock, unless
+// it has been unlocked in the meantime.
+func (fbo *folderBranchOps) renewLock(
+	lockID LockID, held *heldAdvisoryLock) error {
+	held.lock.Lock()
+	defer held.lock.Unlock()
+	if held.released {
+		return nil
+	}
+	return fbo.runUnlessShutdown(func(ctx context.Context) error {
+		return fbo.config.MDServer().Lock(ctx, fbo.id(), lockID)
+	})
+}
+
+// backgroundLockRefresher renews the leases of all the advisory locks
+// held by this device, until none are left or the folder is shut
+// down.
+func (fbo *folderBranchOps) backgroundLockRefresher() {
+	ticker := time.NewTicker(tlfLockRefreshPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-fbo.shutdownChan:
+			return
+		}
+
+		fbo.heldLocksLock.Lock()
+		if len(fbo.heldLocks) == 0 {
+			fbo.refreshingLocks = false
+			fbo.heldLocksLock.Unlock()
+			return
+		}
+		heldLocks := make(map[LockID]*heldAdvisoryLock, len(fbo.heldLocks))
+		for lockID, held := range fbo.heldLocks {
+			heldLocks[lockID] = held
+		}
+		fbo.heldLocksLock.Unlock()
+
+		for lockID, held := range heldLocks {
+			err := fbo.renewLock(lockID, held)
+			switch err.(type) {
+			case nil:
+			case ShutdownHappenedError:
+				return
+			case MDServerErrorLocked:
+				// The lease expired and someone else took
+				// the lock, so it's no longer ours to renew.
+				fbo.log.CWarningf(nil, "Lost advisory lock %s", lockID)
+				fbo.heldLocksLock.Lock()
+				if fbo.heldLocks[lockID] == held {
+					delete(fbo.heldLocks, lockID)
+				}
+				fbo.heldLocksLock.Unlock()
+			default:
+				fbo.log.CDebugf(nil, "Couldn't renew advisory lock %s: %+v",
+					lockID, err)
+			}
+		}
+	}
+}
+
 // PushStatusChange forces a new status be fetched by status listeners.
 func (fbo *folderBranchOps) PushStatusChange() {
 	fbo.config.KBFSOps().PushStatusChange()
@@ -5598,6 +7256,54 @@ func (fbo *folderBranchOps) ClearPrivateFolderMD(ctx context.Context) {
 	fbo.hasBeenCleared = true
 }
 
+// KickoffRekeysForUser implements the KBFSOps interface for
+// folderBranchOps.
+func (fbo *folderBranchOps) KickoffRekeysForUser(
+	ctx context.Context, uid keybase1.UID) {
+	if fbo.id().IsPublic() {
+		// Public folders are never rekeyed.
+		return
+	}
+
+	lState := makeFBOLockState()
+	head := fbo.getHead(lState)
+	if head == (ImmutableRootMetadata{}) {
+		// Nothing to rekey until we know about the folder.
+		return
+	}
+	handle := head.GetTlfHandle()
+	if !handle.IsReader(uid) {
+		// The user might have just proven one of the handle's
+		// unresolved social assertions.
+		if len(handle.UnresolvedWriters())+
+			len(handle.UnresolvedReaders()) == 0 {
+			return
+		}
+		resolvedHandle, err := handle.ResolveAgain(ctx, fbo.config.KBPKI())
+		if err != nil {
+			fbo.log.CDebugf(ctx, "Couldn't resolve %s again: %+v",
+				handle.GetCanonicalPath(), err)
+			return
+		}
+		if !resolvedHandle.IsReader(uid) {
+			return
+		}
+	}
+	_, currentUID, err := fbo.config.KBPKI().GetCurrentUserInfo(ctx)
+	if err != nil {
+		fbo.log.CDebugf(ctx, "Couldn't get the current user: %+v", err)
+		return
+	}
+	// Readers can only rekey for their own devices.
+	if uid != currentUID && !handle.IsWriter(currentUID) {
+		return
+	}
+
+	fbo.log.CDebugf(ctx, "Enqueueing a rekey since the keys for "+
+		"user %s changed", uid)
+	fbo.config.RekeyQueue().Enqueue(fbo.id())
+}
+
 // ForceFastForward implements the KBFSOps interface for
 // folderBranchOps.
 func (fbo *folderBranchOps) ForceFastForward(ctx context.Context) {
@@ -26,6 +26,9 @@ type FolderBranchStatus struct {
 	FolderID            string
 	Revision            MetadataRevision
 	MDVersion           MetadataVer
+	// SyncMode says how much of this folder is kept on this
+	// device (see KBFSOps.SetTlfSyncMode).
+	SyncMode TlfSyncMode
 
 	// DirtyPaths are files that have been written, but not flushed.
 	// They do not represent unstaged changes in your local instance.
@@ -38,6 +41,12 @@ type FolderBranchStatus struct {
 
 	Journal *TLFJournalStatus `json:",omitempty"`
 
+	// ConflictedCopies are the most recent conflicted copies that
+	// conflict resolution on this device made of files it couldn't
+	// merge, each as "original -> copy".  They need to be
+	// reconciled by hand.
+	ConflictedCopies []string `json:",omitempty"`
+
 	PermanentErr string `json:",omitempty"`
 }
 
@@ -50,9 +59,14 @@ type KBFSStatus struct {
 	UsageBytes      int64
 	LimitBytes      int64
 	FailingServices map[string]error
+	BlockCache      BlockCacheStatus
 	JournalServer   *JournalServerStatus `json:",omitempty"`
 }
 
+// maxConflictedCopiesInStatus is how many of the most recent
+// conflicted copies a FolderBranchStatus lists.
+const maxConflictedCopiesInStatus = 100
+
 // StatusUpdate is a dummy type used to indicate status has been updated.
 type StatusUpdate struct{}
 
@@ -68,6 +82,7 @@ type folderBranchStatusKeeper struct {
 	dirtyNodes map[NodeID]Node
 	unmerged   []*crChainSummary
 	merged     []*crChainSummary
+	conflicted []string
 	dataMutex  sync.Mutex
 
 	updateChan  chan StatusUpdate
@@ -117,6 +132,20 @@ func (fbsk *folderBranchStatusKeeper) setCRSummary(unmerged []*crChainSummary,
 	fbsk.signalChangeLocked()
 }
 
+func (fbsk *folderBranchStatusKeeper) addConflictedCopies(copies []string) {
+	fbsk.dataMutex.Lock()
+	defer fbsk.dataMutex.Unlock()
+	if len(copies) == 0 {
+		return
+	}
+	fbsk.conflicted = append(fbsk.conflicted, copies...)
+	if extra := len(fbsk.conflicted) - maxConflictedCopiesInStatus; extra > 0 {
+		fbsk.conflicted = append(
+			[]string(nil), fbsk.conflicted[extra:]...)
+	}
+	fbsk.signalChangeLocked()
+}
+
 func (fbsk *folderBranchStatusKeeper) setPermErr(err error) {
 	fbsk.dataMutex.Lock()
 	defer fbsk.dataMutex.Unlock()
@@ -194,6 +223,7 @@ func (fbsk *folderBranchStatusKeeper) getStatus(ctx context.Context,
 		fbs.FolderID = fbsk.md.TlfID().String()
 		fbs.Revision = fbsk.md.Revision()
 		fbs.MDVersion = fbsk.md.Version()
+		fbs.SyncMode = fbsk.config.tlfSyncCache().mode(fbsk.md.TlfID())
 
 		// TODO: Ideally, the journal would push status
 		// updates to this object instead, so we can notify
@@ -221,6 +251,7 @@ func (fbsk *folderBranchStatusKeeper) getStatus(ctx context.Context,
 
 	fbs.Unmerged = fbsk.unmerged
 	fbs.Merged = fbsk.merged
+	fbs.ConflictedCopies = append([]string(nil), fbsk.conflicted...)
 
 	if fbsk.permErr != nil {
 		fbs.PermanentErr = fbsk.permErr.Error()
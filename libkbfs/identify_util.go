@@ -11,6 +11,7 @@ import (
 
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/tlf"
 	"golang.org/x/net/context"
 	"golang.org/x/sync/errgroup"
 )
@@ -212,6 +213,12 @@ func identifyUserListForTLF(ctx context.Context, nug normalizedUsernameGetter, i
 
 // identifyHandle identifies the canonical names in the given handle.
 func identifyHandle(ctx context.Context, nug normalizedUsernameGetter, identifier identifier, h *TlfHandle) error {
-	uids := append(h.ResolvedWriters(), h.ResolvedReaders()...)
+	var uids []keybase1.UID
+	for _, uid := range append(h.ResolvedWriters(), h.ResolvedReaders()...) {
+		// Teams have no proofs to identify.
+		if !tlf.IsTeamID(uid) {
+			uids = append(uids, uid)
+		}
+	}
 	return identifyUserListForTLF(ctx, nug, identifier, uids, h.IsPublic())
 }
@@ -29,6 +29,11 @@ func (g testNormalizedUsernameGetter) GetNormalizedUsername(
 	return name, nil
 }
 
+func (g testNormalizedUsernameGetter) GetTeamInfo(
+	ctx context.Context, tid keybase1.UID) (TeamInfo, error) {
+	return TeamInfo{}, NoSuchTeamError{tid.String()}
+}
+
 type testIdentifier struct {
 	assertions             map[string]UserInfo
 	assertionsBrokenTracks map[string]UserInfo
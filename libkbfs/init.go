@@ -10,7 +10,6 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"runtime/pprof"
 	"strings"
@@ -18,63 +17,245 @@ import (
 
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/ioutil"
 )
 
 // InitParams contains the initialization parameters for Init(). It is
 // usually filled in by the flags parser passed into AddFlags().
 type InitParams struct {
+	// If non-empty, the path to a JSON config file whose values
+	// override the ones given here, except for those given by
+	// explicitly-set flags. See ApplyInitConfig().
+	ConfigFile string
+
 	// Whether to print debug messages.
 	Debug bool
 	// If non-empty, where to write a CPU profile.
 	CPUProfile string
 
+	// If non-empty, the host:port on which to serve pprof
+	// profiles and KBFS status over HTTP. It must be a loopback
+	// address unless DebugAllowRemote is set, since no
+	// authentication is done.
+	DebugAddr string
+	// Whether the debug server may listen on a non-loopback
+	// address.
+	DebugAllowRemote bool
+
 	// If non-empty, the host:port of the block server. If empty,
 	// a default value is used depending on the run mode. Can also
-	// be "memory" for an in-memory test server or
-	// "dir:/path/to/dir" for an on-disk test server.
+	// be "memory" for an in-memory test server,
+	// "dir:/path/to/dir" for an on-disk test server, or
+	// "s3:<endpoint URL>/<bucket>[/<prefix>]" for a test server
+	// backed by an S3-compatible bucket.
 	BServerAddr string
 
 	// If non-empty the host:port of the metadata server. If
 	// empty, a default value is used depending on the run mode.
-	// Can also be "memory" for an in-memory test server or
-	// "dir:/path/to/dir" for an on-disk test server.
+	// Can also be "memory" for an in-memory test server,
+	// "dir:/path/to/dir" for an on-disk test server, or
+	// "s3:<endpoint URL>/<bucket>[/<prefix>]" for a test server
+	// backed by an S3-compatible bucket.
 	MDServerAddr string
 
 	// If non-zero, specifies the capacity (in bytes) of the block cache. If
 	// zero, the capacity is set using getDefaultBlockCacheCapacity().
 	CleanBlockCacheCapacity uint64
 
+	// If non-zero, specifies roughly how many bytes of dirty
+	// blocks to hold in memory before writes block to wait for
+	// syncs to catch up. If zero, it's twice the clean block
+	// cache capacity.
+	DirtyBlockCacheCapacity uint64
+
 	// Fake local user name.
 	LocalUser string
 
+	// If non-empty, the set of fake local users that LocalUser
+	// must be chosen from. If empty, a default set of users is
+	// used. Has an effect only when LocalUser is non-empty.
+	LocalUsers []LocalUserSpec
+
 	// Where to put favorites. Has an effect only when LocalUser
 	// is non-empty, in which case it must be either "memory" or
 	// "dir:/path/to/dir".
 	LocalFavoriteStorage string
 
+	// PaperKeyFile, if non-empty, is the path to a file holding
+	// the phrase of one of the current user's paper keys. KBFS
+	// then signs and decrypts with the keys derived from it,
+	// instead of asking the keybase service to use its device
+	// keys, so that headless servers can run KBFS without a
+	// provisioned device. The keybase service must still be
+	// logged in as the user. Has no effect when LocalUser is
+	// non-empty.
+	PaperKeyFile string
+
 	// TLFValidDuration is the duration that TLFs are valid
 	// before marked for lazy revalidation.
 	TLFValidDuration time.Duration
 
+	// IdentityCacheTTL is how long the results of user lookups
+	// are cached. A zero TTL disables caching.
+	IdentityCacheTTL time.Duration
+
+	// NotificationDebounce is how long notifications of changes
+	// made by other devices are held back, waiting for more
+	// changes. Zero disables debouncing.
+	NotificationDebounce time.Duration
+
+	// WebhookURL, if non-empty, is an http or https URL to which
+	// a JSON description of every new revision of a loaded TLF is
+	// POSTed.
+	WebhookURL string
+
+	// NotifyFileChanges, if true, makes KBFS report every change
+	// to a loaded TLF to the keybase service, which passes it on
+	// to local clients listening for keybase.1.NotifyFS.
+	NotifyFileChanges bool
+
+	// MDHistoryCompaction, if set, is used to periodically delete
+	// old MD revisions. Has an effect only when MDServerAddr is
+	// of the form "dir:/path/to/dir" or "s3:...".
+	MDHistoryCompaction MDHistoryCompactionPolicy
+
 	// MetadataVersion is the default version of metadata to use
 	// when creating new metadata.
 	MetadataVersion MetadataVer
 
+	// BlockCompression is the compression to apply to new blocks
+	// before they are encrypted: "none" (the default if empty) or
+	// "flate". Compressed blocks can't be read by clients that
+	// predate block compression.
+	BlockCompression string
+
+	// PublicBlocksUnencrypted, if true, uploads new blocks of
+	// public TLFs without encrypting them, which saves CPU.
+	// They're still verified against their IDs, and the MD that
+	// references them is still signed. Each block still gets a
+	// random nonce, so identical blocks are not deduplicated by
+	// the block server. Unencrypted blocks can't be read by
+	// clients that predate this option.
+	PublicBlocksUnencrypted bool
+
+	// MaxConcurrentTransfers, if positive, limits the number of
+	// blocks that are fetched from or sent to the block server at
+	// once. If zero, the defaults are used (100 each way). Users
+	// on fast links may want to raise this, and users on slow or
+	// metered links may want to lower it.
+	MaxConcurrentTransfers int
+
+	// ReadAheadBlocks, if positive, is the number of blocks
+	// following each file read to prefetch, instead of the
+	// default of 10. If negative, read-ahead is turned off.
+	ReadAheadBlocks int
+
+	// BlockCacheEntries and MDCacheEntries, if positive, cap the
+	// number of entries in the clean block cache and the MD
+	// cache, instead of the defaults (10000 and 5000).
+	BlockCacheEntries int
+	MDCacheEntries    int
+
+	// CacheEvictionPolicy is the eviction policy of the clean
+	// block cache and the MD cache: "lru" (the default if empty)
+	// or "slru", a segmented LRU that keeps a one-off scan from
+	// evicting blocks that are used repeatedly.
+	CacheEvictionPolicy string
+
+	// BServerUploadLimit and BServerDownloadLimit, if positive,
+	// cap the average rate in bytes per second at which blocks
+	// are sent to and fetched from a remote block server.
+	BServerUploadLimit   int64
+	BServerDownloadLimit int64
+
+	// ServerRootCertsFile, if non-empty, is the path to a PEM
+	// file of root certificates that remote block and metadata
+	// server certificates must chain to, instead of the built-in
+	// Keybase ones. This is for self-hosted servers with a
+	// private CA.
+	ServerRootCertsFile string
+
+	// ServerCertPins, if non-empty, requires every remote server
+	// certificate chain to include a public key matching one of
+	// these pins, each of the form "sha256/<base64 SHA-256 of the
+	// SubjectPublicKeyInfo>".
+	ServerCertPins []string
+
+	// BlockRetryPolicy, if non-nil, overrides
+	// DefaultBlockRetryPolicy() for operations against a remote
+	// block server.
+	BlockRetryPolicy *BlockRetryPolicy
+
 	// LogToFile if true, logs to a default file location.
 	LogToFile bool
 
 	// LogFileConfig tells us where to log and rotation config.
 	LogFileConfig logger.LogFileConfig
 
+	// LogFormat is the format of log messages, either
+	// LogFormatText (the default if empty) or LogFormatJSON.
+	LogFormat string
+
+	// LogModuleLevels maps go-logging module names (e.g.,
+	// "kbfs(BSR)") to the log level to use for that module
+	// (e.g., "debug" or "warning"), overriding Debug for those
+	// modules. The levels can be changed at runtime through the
+	// debug server.
+	LogModuleLevels map[string]string
+
 	// TLFJournalBackgroundWorkStatus is the status to use to
 	// pass into JournalServer.EnableJournaling. Only has an effect when
 	// WriteJournalRoot is non-empty.
 	TLFJournalBackgroundWorkStatus TLFJournalBackgroundWorkStatus
 
+	// TlfSyncRoot, if non-empty, is the directory in which the
+	// blocks of TLFs synced to this device are kept. If empty,
+	// TLFs can't be synced.
+	TlfSyncRoot string
+
+	// OfflineIdentityRoot, if non-empty, is the directory in which
+	// the identity data last verified by the keybase service is
+	// kept, so that it can be used while the service is
+	// unreachable.
+	OfflineIdentityRoot string
+
+	// TlfActivityRoot, if non-empty, is the directory in which a
+	// log of the operations in each revision of every loaded TLF
+	// is kept. If empty, no activity is logged.
+	TlfActivityRoot string
+
 	// WriteJournalRoot, if non-empty, points to a path to a local
 	// directory to put write journals in. If non-empty, enables
 	// write journaling to be turned on for TLFs.
 	WriteJournalRoot string
+
+	// WriteBack, if true, turns on the write journal for all TLFs
+	// unless the user has turned automatic journaling off, so that
+	// writes return once they're on local disk and are flushed to
+	// the servers in the background. Has an effect only when
+	// WriteJournalRoot is non-empty.
+	WriteBack bool
+
+	// JournalByteLimit, if positive, caps how many bytes all
+	// write journals together may store, and JournalTLFByteLimit,
+	// if positive, caps how many bytes the journal of any single
+	// TLF may store.
+	JournalByteLimit    int64
+	JournalTLFByteLimit int64
+	// JournalFullPolicy is what writes do once a journal byte
+	// limit is reached: "wait" (the default) for background
+	// flushes to free up space, or "fail" right away.
+	JournalFullPolicy string
+
+	// setFlags holds the names of the flags that were explicitly
+	// set, as recorded by ApplyInitConfig(), so that the config
+	// file doesn't override them.
+	setFlags map[string]bool
+	// baseParams, if non-nil, is a copy of these params from
+	// before the config file and environment overrides were
+	// applied, i.e. just the defaults and the flags, for reloads
+	// to start from.
+	baseParams *InitParams
 }
 
 // defaultBServer returns the default value for the -bserver flag.
@@ -126,11 +307,14 @@ func defaultLogPath(ctx Context) string {
 // DefaultInitParams returns default init params
 func DefaultInitParams(ctx Context) InitParams {
 	return InitParams{
-		Debug:            BoolForString(os.Getenv("KBFS_DEBUG")),
+		Debug:            BoolForString(os.Getenv(EnvDebug)),
 		BServerAddr:      defaultBServer(ctx),
 		MDServerAddr:     defaultMDServer(ctx),
 		TLFValidDuration: tlfValidDurationDefault,
+		IdentityCacheTTL: identityCacheTTLDefault,
 		MetadataVersion:  defaultMetadataVersion(ctx),
+
+		NotificationDebounce: notificationDebounceDefault,
 		LogFileConfig: logger.LogFileConfig{
 			MaxAge:       30 * 24 * time.Hour,
 			MaxSize:      128 * 1024 * 1024,
@@ -147,49 +331,99 @@ func AddFlags(flags *flag.FlagSet, ctx Context) *InitParams {
 	defaultParams := DefaultInitParams(ctx)
 
 	var params InitParams
+	flags.StringVar(&params.ConfigFile, "config-file", "", "path to a JSON config file whose values override flags that aren't set explicitly")
 	flags.BoolVar(&params.Debug, "debug", defaultParams.Debug, "Print debug messages")
 	flags.StringVar(&params.CPUProfile, "cpuprofile", "", "write cpu profile to file")
+	flags.StringVar(&params.DebugAddr, "debug-addr", "", "host:port on which to serve pprof and status over HTTP, e.g. localhost:6060")
+	flags.BoolVar(&params.DebugAllowRemote, "debug-allow-remote", false, "Allow -debug-addr to be a non-loopback address, which exposes the unauthenticated debug server to the network")
 
-	flags.StringVar(&params.BServerAddr, "bserver", defaultParams.BServerAddr, "host:port of the block server, 'memory', or 'dir:/path/to/dir'")
-	flags.StringVar(&params.MDServerAddr, "mdserver", defaultParams.MDServerAddr, "host:port of the metadata server, 'memory', or 'dir:/path/to/dir'")
+	flags.StringVar(&params.BServerAddr, "bserver", defaultParams.BServerAddr, "host:port of the block server (or a comma-separated list of host:port to fail over between), 'memory', 'dir:/path/to/dir', or 's3:<endpoint URL>/<bucket>[/<prefix>]'")
+	flags.StringVar(&params.MDServerAddr, "mdserver", defaultParams.MDServerAddr, "host:port of the metadata server, 'memory', 'dir:/path/to/dir', or 's3:<endpoint URL>/<bucket>[/<prefix>]'")
 	flags.StringVar(&params.LocalUser, "localuser", defaultParams.LocalUser, "fake local user")
+	flags.Var(LocalUsersFlag{&params.LocalUsers}, "localusers", "comma-separated list of fake local users, each of the form name[=assertion[+assertion...]]; used only when -localuser is set")
 	flags.StringVar(&params.LocalFavoriteStorage, "local-fav-storage", defaultParams.LocalFavoriteStorage, "where to put favorites; used only when -localuser is set, then must either be 'memory' or 'dir:/path/to/dir'")
+	flags.StringVar(&params.PaperKeyFile, "paper-key-file", defaultParams.PaperKeyFile, "path to a file holding a paper key phrase of the current user, whose keys are used instead of the device keys; ignored when -localuser is set")
+	flags.IntVar(&params.MDHistoryCompaction.KeepRevisions, "md-history-keep", defaultParams.MDHistoryCompaction.KeepRevisions, "If non-zero, periodically delete all but this many of the latest revisions of each TLF; used only when -mdserver is 'dir:/path/to/dir' or 's3:...'")
+	flags.DurationVar(&params.MDHistoryCompaction.MaxAge, "md-history-max-age", defaultParams.MDHistoryCompaction.MaxAge, "If non-zero, periodically delete revisions older than this, except the latest; used only when -mdserver is 'dir:/path/to/dir' or 's3:...'")
 	flags.DurationVar(&params.TLFValidDuration, "tlf-valid", defaultParams.TLFValidDuration, "time tlfs are valid before redoing identification")
+	flags.DurationVar(&params.IdentityCacheTTL, "identity-cache-ttl", defaultParams.IdentityCacheTTL, "time the results of user lookups are cached; 0 disables caching")
+	flags.DurationVar(&params.NotificationDebounce, "notification-debounce", defaultParams.NotificationDebounce, "time to wait for more changes from other devices before notifying the file system of them; 0 notifies right away")
+	flags.StringVar(&params.WebhookURL, "webhook-url", "", "http or https URL to POST a JSON description (TLF, revision, writer and changed paths) of each new revision of a loaded TLF to")
+	flags.BoolVar(&params.NotifyFileChanges, "notify-file-changes", false, "report every file change in a loaded TLF to other local processes via the keybase service's NotifyFS notifications")
 	flags.BoolVar(&params.LogToFile, "log-to-file", false, fmt.Sprintf("Log to default file: %s", defaultLogPath(ctx)))
 	flags.StringVar(&params.LogFileConfig.Path, "log-file", "", "Path to log file")
+	flags.StringVar(&params.LogFormat, "log-format", LogFormatText, "Format of log messages: 'text' or 'json'")
+	flags.Var(LogLevelsFlag{&params.LogModuleLevels}, "log-levels", "Comma-separated per-module log levels, e.g. 'kbfs(BSR)=debug,kbfs=warning'")
 	flags.DurationVar(&params.LogFileConfig.MaxAge, "log-file-max-age", defaultParams.LogFileConfig.MaxAge, "Maximum age of a log file before rotation")
 	params.LogFileConfig.MaxSize = defaultParams.LogFileConfig.MaxSize
 	flags.Var(SizeFlag{&params.LogFileConfig.MaxSize}, "log-file-max-size", "Maximum size of a log file before rotation")
 	// The default is to *DELETE* old log files for kbfs.
 	flags.IntVar(&params.LogFileConfig.MaxKeepFiles, "log-file-max-keep-files", defaultParams.LogFileConfig.MaxKeepFiles, "Maximum number of log files for this service, older ones are deleted. 0 for infinite.")
 	flags.StringVar(&params.WriteJournalRoot, "write-journal-root", defaultParams.WriteJournalRoot, "(EXPERIMENTAL) If non-empty, permits write journals to be turned on for TLFs which will be put in the given directory")
+	flags.BoolVar(&params.WriteBack, "write-back", defaultParams.WriteBack, "Journal writes to all TLFs under -write-journal-root and flush them to the servers in the background, unless automatic journaling was turned off")
+	flags.Var(SizeFlag{&params.JournalByteLimit}, "journal-byte-limit", "If non-zero, the most bytes all write journals together may store, e.g. 20gi")
+	flags.Var(SizeFlag{&params.JournalTLFByteLimit}, "journal-tlf-byte-limit", "If non-zero, the most bytes the write journal of any single TLF may store, e.g. 5gi")
+	flags.StringVar(&params.JournalFullPolicy, "journal-full-policy", defaultParams.JournalFullPolicy, "What writes do once a write journal is full: 'wait' for background flushes to free up space, or 'fail' right away")
+	flags.StringVar(&params.TlfSyncRoot, "tlf-sync-root", defaultParams.TlfSyncRoot, "If non-empty, permits TLFs to be synced to this device for offline use, keeping their blocks in the given directory")
+	flags.StringVar(&params.TlfActivityRoot, "tlf-activity-root", defaultParams.TlfActivityRoot, "If non-empty, keep a log of the operations in each TLF in the given directory, readable through the .kbfs_activity file of the TLF")
+	flags.StringVar(&params.OfflineIdentityRoot, "offline-identity-root", defaultParams.OfflineIdentityRoot, "If non-empty, keep the identity data last verified by the keybase service in the given directory, and fall back to it while the service is unreachable")
 	flags.Uint64Var(&params.CleanBlockCacheCapacity, "clean-bcache-cap", defaultParams.CleanBlockCacheCapacity, "If non-zero, specify the capacity of clean block cache. If zero, the capacity is set based on system RAM.")
+	flags.Uint64Var(&params.DirtyBlockCacheCapacity, "dirty-bcache-cap", defaultParams.DirtyBlockCacheCapacity, "If non-zero, roughly how many bytes of dirty blocks to buffer in memory before writes block. If zero, twice the clean block cache capacity.")
+	flags.IntVar(&params.BlockCacheEntries, "bcache-entries", defaultParams.BlockCacheEntries, "If non-zero, the maximum number of entries in the clean block cache.")
+	flags.IntVar(&params.MDCacheEntries, "mdcache-entries", defaultParams.MDCacheEntries, "If non-zero, the maximum number of entries in the MD cache.")
+	flags.StringVar(&params.CacheEvictionPolicy, "cache-policy", defaultParams.CacheEvictionPolicy, "Eviction policy of the block and MD caches: 'lru' or 'slru' (segmented LRU)")
+	flags.Var(SizeFlag{&params.BServerUploadLimit}, "bserver-upload-limit", "If non-zero, the maximum rate in bytes/sec at which to send blocks to the block server, e.g. 512ki")
+	flags.Var(BlockRetryPolicyFlag{&params.BlockRetryPolicy}, "bserver-retry", "Comma-separated retry policy for failed block server operations, e.g. 'max_attempts=6,initial_interval=1s,max_interval=30s,multiplier=2,jitter=0.5'; unset fields keep their defaults")
+	flags.Var(SizeFlag{&params.BServerDownloadLimit}, "bserver-download-limit", "If non-zero, the maximum rate in bytes/sec at which to fetch blocks from the block server, e.g. 2mi")
+	flags.IntVar(&params.ReadAheadBlocks, "read-ahead-blocks", defaultParams.ReadAheadBlocks, "If positive, the number of blocks following each file read to prefetch; if negative, turns read-ahead off")
+	flags.StringVar(&params.ServerRootCertsFile, "server-root-certs", "", "Path to a PEM file of root certificates to trust for the block and metadata servers, instead of the built-in ones")
+	flags.Var(CertPinsFlag{&params.ServerCertPins}, "server-cert-pins", "Comma-separated public key pins of the form 'sha256/<base64>', one of which must match the block and metadata server certificate chains")
+	flags.IntVar(&params.MaxConcurrentTransfers, "max-concurrent-transfers", defaultParams.MaxConcurrentTransfers, "If non-zero, the maximum number of blocks to fetch from or send to the block server at once.")
 
 	// No real need to enable setting
 	// params.TLFJournalBackgroundWorkStatus via a flag.
 	params.TLFJournalBackgroundWorkStatus = defaultParams.TLFJournalBackgroundWorkStatus
 
 	flags.IntVar((*int)(&params.MetadataVersion), "md-version", int(defaultParams.MetadataVersion), "Metadata version to use when creating new metadata")
+	flags.StringVar(&params.BlockCompression, "block-compression", defaultParams.BlockCompression, "(EXPERIMENTAL) Compression to apply to new blocks: 'none' or 'flate'; older clients can't read compressed blocks")
+	flags.BoolVar(&params.PublicBlocksUnencrypted, "public-blocks-unencrypted", defaultParams.PublicBlocksUnencrypted, "(EXPERIMENTAL) Upload new blocks of public TLFs without encrypting them; older clients can't read unencrypted blocks")
 	return &params
 }
 
 // GetRemoteUsageString returns a string describing the flags to use
 // to run against remote KBFS servers.
 func GetRemoteUsageString() string {
-	return `    [-debug] [-cpuprofile=path/to/dir]
-    [-bserver=host:port] [-mdserver=host:port]
-    [-log-to-file] [-log-file=path/to/file] [-clean-bcache-cap=0]`
+	return `    [-config-file=path/to/file]
+    [-debug] [-cpuprofile=path/to/dir] [-debug-addr=host:port]
+    [-bserver=host:port[,host:port...]] [-mdserver=host:port]
+    [-bserver-upload-limit=0] [-bserver-download-limit=0]
+    [-bserver-retry=key=value,...]
+    [-server-root-certs=path/to/certs.pem] [-server-cert-pins=sha256/...]
+    [-paper-key-file=path/to/file]
+    [-log-to-file] [-log-file=path/to/file] [-log-format=(text | json)]
+    [-log-levels=module=level,...]
+    [-clean-bcache-cap=0] [-dirty-bcache-cap=0]
+    [-bcache-entries=0] [-mdcache-entries=0]
+    [-cache-policy=(lru | slru)] [-max-concurrent-transfers=0]`
 }
 
 // GetLocalUsageString returns a string describing the flags to use to
 // run in a local testing environment.
 func GetLocalUsageString() string {
-	return `    [-debug] [-cpuprofile=path/to/dir]
-    [-bserver=(memory | dir:/path/to/dir | host:port)]
-    [-mdserver=(memory | dir:/path/to/dir | host:port)]
-    [-localuser=<user>]
+	return `    [-config-file=path/to/file]
+    [-debug] [-cpuprofile=path/to/dir] [-debug-addr=host:port]
+    [-bserver=(memory | dir:/path/to/dir | s3:<url>/<bucket>[/<prefix>] |
+               host:port[,host:port...])]
+    [-mdserver=(memory | dir:/path/to/dir | s3:<url>/<bucket>[/<prefix>] |
+                host:port)]
+    [-localuser=<user>] [-localusers=<user>[=<assertion>],...]
     [-local-fav-storage=(memory | dir:/path/to/dir)]
-    [-log-to-file] [-log-file=path/to/file] [-clean-bcache-cap=0]`
+    [-md-history-keep=0] [-md-history-max-age=0]
+    [-log-to-file] [-log-file=path/to/file] [-log-format=(text | json)]
+    [-log-levels=module=level,...]
+    [-clean-bcache-cap=0] [-dirty-bcache-cap=0]
+    [-bcache-entries=0] [-mdcache-entries=0]
+    [-cache-policy=(lru | slru)] [-max-concurrent-transfers=0]`
 }
 
 // GetDefaultsUsageString returns a string describing the default
@@ -206,6 +440,10 @@ func GetDefaultsUsageString(ctx Context) string {
 
 const memoryAddr = "memory"
 
+// mdHistoryCompactionInterval is how often a local MD server deletes
+// old revisions, if InitParams.MDHistoryCompaction is set.
+const mdHistoryCompactionInterval = time.Hour
+
 const dirAddrPrefix = "dir:"
 
 func parseRootDir(addr string) (string, bool) {
@@ -239,6 +477,17 @@ func makeMDServer(config Config, mdserverAddr string,
 		return NewMDServerDir(mdServerLocalConfigAdapter{config}, mdPath)
 	}
 
+	bucket, ok, err := makeS3BucketFromAddr(mdserverAddr)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		log.Debug("Using S3 mdserver at %s", bucket)
+		// local MD server backed by an S3-compatible bucket
+		return newMDServerS3(mdServerLocalConfigAdapter{config},
+			bucket.withPrefix("kbfs_md"))
+	}
+
 	// remote MD server. this can't fail. reconnection attempts
 	// will be automatic.
 	log.Debug("Using remote mdserver %s", mdserverAddr)
@@ -265,6 +514,16 @@ func makeKeyServer(config Config, keyserverAddr string,
 		return NewKeyServerDir(config, keyPath)
 	}
 
+	bucket, ok, err := makeS3BucketFromAddr(keyserverAddr)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		log.Debug("Using S3 keyserver at %s", bucket)
+		// local key server backed by an S3-compatible bucket
+		return newKeyServerS3(config, bucket.withPrefix("kbfs_key"))
+	}
+
 	log.Debug("Using remote keyserver %s (same as mdserver)", keyserverAddr)
 	// currently the MD server also acts as the key server.
 	keyServer, ok := config.MDServer().(KeyServer)
@@ -274,6 +533,73 @@ func makeKeyServer(config Config, keyserverAddr string,
 	return keyServer, nil
 }
 
+// readAheadFromParams returns the read-ahead configuration described
+// by params.ReadAheadBlocks.
+func readAheadFromParams(params InitParams) ReadAheadConfig {
+	readAhead := DefaultReadAheadConfig()
+	if params.ReadAheadBlocks != 0 {
+		readAhead.Blocks = params.ReadAheadBlocks
+	}
+	return readAhead
+}
+
+// cacheLimitsFromParams returns the cache limits described by
+// params.BlockCacheEntries, params.MDCacheEntries,
+// params.CacheEvictionPolicy and params.DirtyBlockCacheCapacity.
+func cacheLimitsFromParams(params InitParams) (CacheLimits, error) {
+	limits := DefaultCacheLimits()
+	if params.BlockCacheEntries < 0 {
+		return CacheLimits{}, fmt.Errorf(
+			"Invalid block cache entries %d", params.BlockCacheEntries)
+	} else if params.BlockCacheEntries > 0 {
+		limits.BlockCacheEntries = params.BlockCacheEntries
+	}
+	if params.MDCacheEntries < 0 {
+		return CacheLimits{}, fmt.Errorf(
+			"Invalid MD cache entries %d", params.MDCacheEntries)
+	} else if params.MDCacheEntries > 0 {
+		limits.MDCacheEntries = params.MDCacheEntries
+	}
+	policy, err := ParseCacheEvictionPolicy(params.CacheEvictionPolicy)
+	if err != nil {
+		return CacheLimits{}, err
+	}
+	limits.Policy = policy
+	if policy == SegmentedLRUCacheEviction &&
+		(limits.BlockCacheEntries < minSegmentedLRUSize ||
+			limits.MDCacheEntries < minSegmentedLRUSize) {
+		return CacheLimits{}, fmt.Errorf(
+			"The %s cache eviction policy needs at least %d block "+
+				"and MD cache entries", policy, minSegmentedLRUSize)
+	}
+	limits.DirtyBytes = int64(params.DirtyBlockCacheCapacity)
+	return limits, nil
+}
+
+// journalLimitsFromParams returns the journal limits described by
+// params.JournalByteLimit, params.JournalTLFByteLimit and
+// params.JournalFullPolicy.
+func journalLimitsFromParams(params InitParams) (JournalLimits, error) {
+	limits := DefaultJournalLimits()
+	if params.JournalByteLimit < 0 {
+		return JournalLimits{}, fmt.Errorf(
+			"Invalid journal byte limit %d", params.JournalByteLimit)
+	} else if params.JournalByteLimit > 0 {
+		limits.ByteLimit = params.JournalByteLimit
+	}
+	if params.JournalTLFByteLimit < 0 {
+		return JournalLimits{}, fmt.Errorf(
+			"Invalid journal TLF byte limit %d", params.JournalTLFByteLimit)
+	}
+	limits.TLFByteLimit = params.JournalTLFByteLimit
+	policy, err := ParseJournalFullPolicy(params.JournalFullPolicy)
+	if err != nil {
+		return JournalLimits{}, err
+	}
+	limits.FullPolicy = policy
+	return limits, nil
+}
+
 func makeBlockServer(config Config, bserverAddr string,
 	rpcLogFactory *libkb.RPCLogFactory,
 	log logger.Logger) (BlockServer, error) {
@@ -293,14 +619,50 @@ func makeBlockServer(config Config, bserverAddr string,
 		// local persistent block server
 		blockPath := filepath.Join(serverRootDir, "kbfs_block")
 		bserverLog := config.MakeLogger("BSD")
-		return NewBlockServerDir(config.Codec(),
-			bserverLog, blockPath), nil
+		bserv, err := NewBlockServerDir(config.Codec(), bserverLog, blockPath)
+		if err != nil {
+			return nil, err
+		}
+		return bserv, nil
 	}
 
-	log.Debug("Using remote bserver %s", bserverAddr)
-	bserverLog := config.MakeLogger("BSR")
-	return NewBlockServerRemote(config.Codec(), config.Crypto(),
-		config.KBPKI(), bserverLog, bserverAddr, rpcLogFactory), nil
+	bucket, ok, err := makeS3BucketFromAddr(bserverAddr)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		log.Debug("Using S3 bserver at %s", bucket)
+		// local block server backed by an S3-compatible bucket
+		bserverLog := config.MakeLogger("BSS3")
+		return newBlockServerS3(config.Codec(), bserverLog,
+			bucket.withPrefix("kbfs_block"))
+	}
+
+	addrs := strings.Split(bserverAddr, ",")
+	if len(addrs) == 1 {
+		log.Debug("Using remote bserver %s", bserverAddr)
+		bserverLog := config.MakeLogger("BSR")
+		return NewBlockServerRemote(config.Codec(), config.Crypto(),
+			config.KBPKI(), config, bserverLog, bserverAddr,
+			rpcLogFactory), nil
+	}
+
+	// Several addresses means several equivalent block servers to
+	// fail over between.
+	log.Debug("Using remote bservers %v with failover", addrs)
+	remotes := make([]*BlockServerRemote, 0, len(addrs))
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if len(addr) == 0 {
+			return nil, fmt.Errorf(
+				"Empty address in block server list %q", bserverAddr)
+		}
+		bserverLog := config.MakeLogger("BSR")
+		remotes = append(remotes, NewBlockServerRemote(config.Codec(),
+			config.Crypto(), config.KBPKI(), config, bserverLog, addr,
+			rpcLogFactory))
+	}
+	return NewBlockServerFailover(config.MakeLogger("BSF"), remotes), nil
 }
 
 // InitLog sets up logging switching to a log file if necessary.
@@ -309,7 +671,7 @@ func makeBlockServer(config Config, bserverAddr string,
 // Possible errors are logged to the logger returned.
 func InitLog(params InitParams, ctx Context) (logger.Logger, error) {
 	var err error
-	log := logger.NewWithCallDepth("kbfs", 1)
+	var log logger.Logger = logger.NewWithCallDepth("kbfs", 1)
 
 	// Set log file to default if log-to-file was specified
 	if params.LogToFile {
@@ -319,11 +681,21 @@ func InitLog(params InitParams, ctx Context) (logger.Logger, error) {
 		params.LogFileConfig.Path = defaultLogPath(ctx)
 	}
 
+	if err := checkLogFormat(params.LogFormat); err != nil {
+		return nil, err
+	}
+	if err := setLogModuleLevels(params.LogModuleLevels); err != nil {
+		return nil, err
+	}
+
 	if params.LogFileConfig.Path != "" {
 		err = logger.SetLogFileConfig(&params.LogFileConfig)
 	}
 
 	log.Configure("", params.Debug, "")
+	applyLogModuleLevel("kbfs")
+	setLogFormat(params.LogFormat)
+	log = wrapLoggerForFormat(log, "kbfs")
 	log.Info("KBFS version %s", VersionString())
 
 	if err != nil {
@@ -333,10 +705,17 @@ func InitLog(params InitParams, ctx Context) (logger.Logger, error) {
 	return log, err
 }
 
-// Init initializes a config and returns it.
+// Init initializes a config and returns it. See also
+// InitWithOptions, for callers that only need to change a few
+// defaults.
+//
+// onInterruptFn is called whenever an interrupt or termination
+// signal is received (e.g., if the user hits Ctrl-C, or the process
+// is sent SIGTERM).
 //
-// onInterruptFn is called whenever an interrupt signal is received
-// (e.g., if the user hits Ctrl-C).
+// Once initialization succeeds, SIGHUP reloads the settings that can
+// be changed at runtime, and SIGUSR1 or SIGUSR2 dumps all goroutine
+// stacks and the current KBFS status to the log.
 //
 // Init should be called at the beginning of main. Shutdown (see
 // below) should then be called at the end of main (usually via
@@ -358,9 +737,10 @@ func Init(ctx Context, params InitParams, keybaseServiceCn KeybaseServiceCn, onI
 
 	done := make(chan struct{})
 	interruptChan := make(chan os.Signal, 1)
-	signal.Notify(interruptChan, os.Interrupt)
+	notifyOnShutdownSignal(interruptChan)
+	var interruptSig os.Signal
 	go func() {
-		_ = <-interruptChan
+		interruptSig = <-interruptChan
 
 		if onInterruptFn != nil {
 			onInterruptFn()
@@ -383,29 +763,69 @@ func Init(ctx Context, params InitParams, keybaseServiceCn KeybaseServiceCn, onI
 
 	select {
 	case <-done:
-		return nil, errors.New(os.Interrupt.String())
+		return nil, errors.New(interruptSig.String())
 	case err = <-errCh:
+		if err == nil {
+			go reloadOnSignal(cfg, params, log)
+			go dumpStateOnSignal(cfg, log)
+		}
 		return cfg, err
 	}
 }
 
+// makeKBPKI returns the KBPKI made by keybaseServiceCn, if it
+// implements KBPKICn, and a KBPKIClient using the service otherwise.
+func makeKBPKI(config Config, params InitParams, ctx Context,
+	keybaseServiceCn KeybaseServiceCn, log logger.Logger) (KBPKI, error) {
+	if kbpkiCn, ok := keybaseServiceCn.(KBPKICn); ok {
+		return kbpkiCn.NewKBPKI(config, params, ctx, log)
+	}
+	return NewKBPKIClient(config, log), nil
+}
+
+// newModuleLogger makes a logger for the given module, with debugging
+// turned on if debug is set.  An explicit level for the module, from
+// -log-levels, overrides both.
+func newModuleLogger(mname string, debug bool) logger.Logger {
+	// Add log depth so that context-based messages get the right
+	// file printed out.
+	lg := wrapLoggerForFormat(logger.NewWithCallDepth(mname, 1), mname)
+	if debug {
+		// Turn on debugging.  TODO: allow a proper log file and
+		// style to be specified.
+		lg.Configure("", true, "")
+	}
+	// Making the first logger for a module resets its level, so
+	// this is needed even without debugging.
+	applyLogModuleLevel(mname)
+	return lg
+}
+
 func doInit(ctx Context, params InitParams, keybaseServiceCn KeybaseServiceCn, log logger.Logger) (Config, error) {
 	config := NewConfigLocal(func(module string) logger.Logger {
 		mname := "kbfs"
 		if module != "" {
 			mname += fmt.Sprintf("(%s)", module)
 		}
-		// Add log depth so that context-based messages get the right
-		// file printed out.
-		lg := logger.NewWithCallDepth(mname, 1)
-		if params.Debug {
-			// Turn on debugging.  TODO: allow a proper log file and
-			// style to be specified.
-			lg.Configure("", true, "")
-		}
-		return lg
+		return newModuleLogger(mname, params.Debug)
 	})
 
+	cacheLimits, err := cacheLimitsFromParams(params)
+	if err != nil {
+		return nil, err
+	}
+	if cacheLimits != config.CacheLimits() {
+		log.Debug("Using cache limits %+v", cacheLimits)
+		config.SetCacheLimits(cacheLimits)
+		config.ResetCaches()
+	}
+
+	journalLimits, err := journalLimitsFromParams(params)
+	if err != nil {
+		return nil, err
+	}
+	config.SetJournalLimits(journalLimits)
+
 	if params.CleanBlockCacheCapacity > 0 {
 		log.Debug("overriding default clean block cache capacity from %d to %d",
 			config.BlockCache().GetCleanBytesCapacity(),
@@ -413,8 +833,18 @@ func doInit(ctx Context, params InitParams, keybaseServiceCn KeybaseServiceCn, l
 		config.BlockCache().SetCleanBytesCapacity(params.CleanBlockCacheCapacity)
 	}
 
-	config.SetBlockOps(NewBlockOpsStandard(config,
-		defaultBlockRetrievalWorkerQueueSize))
+	if params.MaxConcurrentTransfers < 0 {
+		return nil, fmt.Errorf("Invalid max concurrent transfers %d",
+			params.MaxConcurrentTransfers)
+	}
+	numBlockGetWorkers := defaultBlockRetrievalWorkerQueueSize
+	if params.MaxConcurrentTransfers > 0 {
+		log.Debug("Limiting concurrent block transfers to %d",
+			params.MaxConcurrentTransfers)
+		numBlockGetWorkers = params.MaxConcurrentTransfers
+		config.SetMaxParallelBlockPuts(params.MaxConcurrentTransfers)
+	}
+	config.SetBlockOps(NewBlockOpsStandard(config, numBlockGetWorkers))
 
 	bsplitter, err := NewBlockSplitterSimple(MaxBlockSizeBytesDefault, 8*1024,
 		config.Codec())
@@ -435,17 +865,67 @@ func doInit(ctx Context, params InitParams, keybaseServiceCn KeybaseServiceCn, l
 
 	config.SetMetadataVersion(MetadataVer(params.MetadataVersion))
 	config.SetTLFValidDuration(params.TLFValidDuration)
+	config.SetIdentityCacheTTL(params.IdentityCacheTTL)
+	config.SetNotificationDebounce(params.NotificationDebounce)
+
+	blockCompression, err := ParseBlockCompressionType(
+		params.BlockCompression)
+	if err != nil {
+		return nil, err
+	}
+	config.SetBlockCompression(blockCompression)
+	config.SetPublicBlocksUnencrypted(params.PublicBlocksUnencrypted)
+
+	config.SetReadAhead(readAheadFromParams(params))
+
+	config.SetBlockBandwidthLimits(BlockBandwidthLimits{
+		Upload:   params.BServerUploadLimit,
+		Download: params.BServerDownloadLimit,
+	})
+
+	if params.BlockRetryPolicy != nil {
+		err := checkBlockRetryPolicy(*params.BlockRetryPolicy)
+		if err != nil {
+			return nil, err
+		}
+		config.SetBlockRetryPolicy(*params.BlockRetryPolicy)
+	}
+
+	if len(params.ServerRootCertsFile) != 0 || len(params.ServerCertPins) != 0 {
+		var rootCerts []byte
+		if len(params.ServerRootCertsFile) != 0 {
+			rootCerts, err = ioutil.ReadFile(params.ServerRootCertsFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		tlsConfig, err := MakeServerTLSConfig(
+			rootCerts, params.ServerCertPins)
+		if err != nil {
+			return nil, err
+		}
+		log.Debug("Using custom TLS configuration for remote servers")
+		config.SetServerTLSConfig(tlsConfig)
+	}
 
 	kbfsOps := NewKBFSOpsStandard(config)
 	config.SetKBFSOps(kbfsOps)
 	config.SetNotifier(kbfsOps)
+	if params.WebhookURL != "" {
+		if err := kbfsOps.EnableWebhook(params.WebhookURL); err != nil {
+			return nil, err
+		}
+	}
+	if params.NotifyFileChanges {
+		kbfsOps.EnableChangeNotifications()
+	}
 	config.SetKeyManager(NewKeyManagerStandard(config))
 	config.SetMDOps(NewMDOpsStandard(config))
 
 	kbfsLog := config.MakeLogger("")
 
 	if keybaseServiceCn == nil {
-		keybaseServiceCn = keybaseDaemon{}
+		keybaseServiceCn = &keybaseDaemon{}
 	}
 	service, err := keybaseServiceCn.NewKeybaseService(config, params, ctx, kbfsLog)
 	if err != nil {
@@ -458,7 +938,10 @@ func doInit(ctx Context, params InitParams, keybaseServiceCn KeybaseServiceCn, l
 
 	config.SetKeybaseService(service)
 
-	k := NewKBPKIClient(config, kbfsLog)
+	k, err := makeKBPKI(config, params, ctx, keybaseServiceCn, kbfsLog)
+	if err != nil {
+		return nil, fmt.Errorf("problem creating KBPKI: %+v", err)
+	}
 	config.SetKBPKI(k)
 
 	config.SetReporter(NewReporterKBPKI(config, 10, 1000))
@@ -480,6 +963,11 @@ func doInit(ctx Context, params InitParams, keybaseServiceCn KeybaseServiceCn, l
 	if err != nil {
 		return nil, fmt.Errorf("problem creating MD server: %+v", err)
 	}
+	if mdServerDisk, ok := mdServer.(*MDServerDisk); ok &&
+		params.MDHistoryCompaction.IsSet() {
+		mdServerDisk.StartHistoryCompaction(
+			params.MDHistoryCompaction, mdHistoryCompactionInterval)
+	}
 	config.SetMDServer(mdServer)
 
 	// note: the mdserver is the keyserver at the moment.
@@ -490,6 +978,12 @@ func doInit(ctx Context, params InitParams, keybaseServiceCn KeybaseServiceCn, l
 
 	if registry := config.MetricsRegistry(); registry != nil {
 		keyServer = NewKeyServerMeasured(keyServer, registry)
+		// Wrap the MD server only after the key server has
+		// been made from it, and leave local MD servers alone
+		// so that the state checker can still find them.
+		if _, isLocal := mdServer.(mdServerLocal); !isLocal {
+			config.SetMDServer(NewMDServerMeasured(mdServer, registry))
+		}
 	}
 
 	config.SetKeyServer(keyServer)
@@ -505,22 +999,87 @@ func doInit(ctx Context, params InitParams, keybaseServiceCn KeybaseServiceCn, l
 
 	config.SetBlockServer(bserv)
 
+	if params.DebugAddr != "" {
+		ds, err := newDebugServer(
+			config, params.DebugAddr, params.DebugAllowRemote)
+		if err != nil {
+			// Not fatal; the debug server is optional.
+			log.Warning("Could not start debug server on %s: %+v",
+				params.DebugAddr, err)
+		} else {
+			config.debugServer = ds
+		}
+	}
+
 	// TODO: Don't turn on journaling if either -bserver or
 	// -mdserver point to local implementations.
 	if len(params.WriteJournalRoot) != 0 {
+		ctx := context.Background()
 		err := config.EnableJournaling(
-			context.Background(), params.WriteJournalRoot,
+			ctx, params.WriteJournalRoot,
 			params.TLFJournalBackgroundWorkStatus)
 		if err != nil {
 			log.Warning("Could not initialize journal server: %+v", err)
 		}
+		if jServer, err := GetJournalServer(config); err == nil {
+			jServer.SetEnableAutoByDefault(ctx, params.WriteBack)
+		}
+	}
+
+	if len(params.TlfSyncRoot) != 0 {
+		err := config.EnableTlfSync(params.TlfSyncRoot)
+		if err != nil {
+			log.Warning("Could not enable TLF syncing: %+v", err)
+		}
+	}
+
+	if len(params.TlfActivityRoot) != 0 {
+		err := config.EnableTlfActivityLog(params.TlfActivityRoot)
+		if err != nil {
+			log.Warning("Could not enable the TLF activity log: %+v", err)
+		}
 	}
 
 	return config, nil
 }
 
-// Shutdown does any necessary shutdown tasks for libkbfs. Shutdown
-// should be called at the end of main.
-func Shutdown() {
-	pprof.StopCPUProfile()
+// shutdownTimeout bounds how long Shutdown waits for dirty files to
+// be synced and for the config to be torn down.
+const shutdownTimeout = 30 * time.Second
+
+// SyncAllDirtyFiles syncs the dirty files in every folder the given
+// config has loaded, returning the first error encountered.  Mount
+// layers can call it to make sure no written data is lost before
+// forcing an unmount.
+func SyncAllDirtyFiles(ctx context.Context, config Config) error {
+	kbfsOps, ok := config.KBFSOps().(*KBFSOpsStandard)
+	if !ok {
+		return nil
+	}
+	return kbfsOps.syncAllDirtyFiles(ctx)
+}
+
+// Shutdown does any necessary shutdown tasks for libkbfs. It syncs
+// any dirty files, and then shuts down the given config (which was
+// returned by Init), tearing down all of its servers and
+// connections. Shutdown should be called at the end of main.
+func Shutdown(config Config) error {
+	defer pprof.StopCPUProfile()
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), shutdownTimeout)
+	defer cancel()
+
+	log := config.MakeLogger("")
+	if err := SyncAllDirtyFiles(ctx, config); err != nil {
+		// Keep going, so that everything else still gets shut
+		// down cleanly.
+		log.Warning("Couldn't sync all dirty files on shutdown: %+v", err)
+	}
+
+	err := config.Shutdown(ctx)
+	if err != nil {
+		log.Warning("Error shutting down config: %+v", err)
+	}
+	return err
 }
@@ -0,0 +1,500 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	// EnvBServerAddr is the environment variable name that, if
+	// set, overrides the block server address.
+	EnvBServerAddr = "KBFS_BSERVER"
+	// EnvMDServerAddr is the environment variable name that, if
+	// set, overrides the metadata server address.
+	EnvMDServerAddr = "KBFS_MDSERVER"
+	// EnvLocalUser is the environment variable name that, if set,
+	// overrides the fake local user name.
+	EnvLocalUser = "KBFS_LOCALUSER"
+	// EnvLocalUsers is the environment variable name that, if
+	// set, overrides the set of fake local users, in the format
+	// accepted by ParseLocalUserSpecs.
+	EnvLocalUsers = "KBFS_LOCALUSERS"
+	// EnvCleanBlockCacheCapacity is the environment variable name
+	// that, if set, overrides the clean block cache capacity.
+	EnvCleanBlockCacheCapacity = "KBFS_CLEAN_BCACHE_CAP"
+	// EnvDebug is the environment variable name that, if set,
+	// overrides whether debug messages are printed.
+	EnvDebug = "KBFS_DEBUG"
+)
+
+// InitConfigFile is the on-disk JSON representation of a subset of
+// InitParams. Every field is optional; a nil field leaves the
+// corresponding InitParams value untouched.
+type InitConfigFile struct {
+	Debug            *bool   `json:"debug,omitempty"`
+	DebugAddr        *string `json:"debug_addr,omitempty"`
+	DebugAllowRemote *bool   `json:"debug_allow_remote,omitempty"`
+
+	BServerAddr  *string `json:"bserver,omitempty"`
+	MDServerAddr *string `json:"mdserver,omitempty"`
+
+	CleanBlockCacheCapacity *uint64 `json:"clean_bcache_cap,omitempty"`
+	DirtyBlockCacheCapacity *uint64 `json:"dirty_bcache_cap,omitempty"`
+	MaxConcurrentTransfers  *int    `json:"max_concurrent_transfers,omitempty"`
+	ReadAheadBlocks         *int    `json:"read_ahead_blocks,omitempty"`
+	BlockCacheEntries       *int    `json:"bcache_entries,omitempty"`
+	MDCacheEntries          *int    `json:"mdcache_entries,omitempty"`
+	CacheEvictionPolicy     *string `json:"cache_policy,omitempty"`
+
+	LocalUser            *string `json:"localuser,omitempty"`
+	LocalFavoriteStorage *string `json:"local_fav_storage,omitempty"`
+	PaperKeyFile         *string `json:"paper_key_file,omitempty"`
+
+	// LocalUsers is a list of entries in the format accepted by
+	// ParseLocalUserSpecs, e.g. ["alice=github:alice", "bob"].
+	LocalUsers []string `json:"localusers,omitempty"`
+
+	// TLFValidDuration is in the format accepted by
+	// time.ParseDuration, e.g. "6h".
+	TLFValidDuration *string `json:"tlf_valid,omitempty"`
+	// IdentityCacheTTL is in the format accepted by
+	// time.ParseDuration, e.g. "1h".
+	IdentityCacheTTL *string `json:"identity_cache_ttl,omitempty"`
+	// NotificationDebounce is in the format accepted by
+	// time.ParseDuration, e.g. "200ms".
+	NotificationDebounce *string `json:"notification_debounce,omitempty"`
+	WebhookURL           *string `json:"webhook_url,omitempty"`
+	NotifyFileChanges    *bool   `json:"notify_file_changes,omitempty"`
+
+	MDHistoryKeep *int `json:"md_history_keep,omitempty"`
+	// MDHistoryMaxAge is in the format accepted by
+	// time.ParseDuration, e.g. "720h".
+	MDHistoryMaxAge *string `json:"md_history_max_age,omitempty"`
+
+	MetadataVersion  *MetadataVer `json:"md_version,omitempty"`
+	BlockCompression *string      `json:"block_compression,omitempty"`
+
+	PublicBlocksUnencrypted *bool `json:"public_blocks_unencrypted,omitempty"`
+
+	BServerRetry *BlockRetryConfigFile `json:"bserver_retry,omitempty"`
+	// BServerUploadLimit and BServerDownloadLimit are in bytes
+	// per second.
+	BServerUploadLimit   *int64 `json:"bserver_upload_limit,omitempty"`
+	BServerDownloadLimit *int64 `json:"bserver_download_limit,omitempty"`
+
+	ServerRootCertsFile *string  `json:"server_root_certs,omitempty"`
+	ServerCertPins      []string `json:"server_cert_pins,omitempty"`
+
+	LogToFile           *bool   `json:"log_to_file,omitempty"`
+	LogFile             *string `json:"log_file,omitempty"`
+	LogFileMaxAge       *string `json:"log_file_max_age,omitempty"`
+	LogFileMaxSize      *int64  `json:"log_file_max_size,omitempty"`
+	LogFileMaxKeepFiles *int    `json:"log_file_max_keep_files,omitempty"`
+	LogFormat           *string `json:"log_format,omitempty"`
+	// LogLevels maps module names to log levels, e.g.
+	// {"kbfs(BSR)": "debug"}.
+	LogLevels map[string]string `json:"log_levels,omitempty"`
+
+	WriteJournalRoot *string `json:"write_journal_root,omitempty"`
+	WriteBack        *bool   `json:"write_back,omitempty"`
+	TlfSyncRoot      *string `json:"tlf_sync_root,omitempty"`
+
+	// JournalByteLimit and JournalTLFByteLimit are in bytes.
+	JournalByteLimit    *int64  `json:"journal_byte_limit,omitempty"`
+	JournalTLFByteLimit *int64  `json:"journal_tlf_byte_limit,omitempty"`
+	JournalFullPolicy   *string `json:"journal_full_policy,omitempty"`
+
+	OfflineIdentityRoot *string `json:"offline_identity_root,omitempty"`
+	TlfActivityRoot     *string `json:"tlf_activity_root,omitempty"`
+}
+
+// BlockRetryConfigFile is the config file form of BlockRetryPolicy.
+// Unset fields keep their default values.
+type BlockRetryConfigFile struct {
+	MaxAttempts *int `json:"max_attempts,omitempty"`
+	// InitialInterval and MaxInterval are in the format accepted
+	// by time.ParseDuration, e.g. "500ms".
+	InitialInterval *string  `json:"initial_interval,omitempty"`
+	MaxInterval     *string  `json:"max_interval,omitempty"`
+	Multiplier      *float64 `json:"multiplier,omitempty"`
+	Jitter          *float64 `json:"jitter,omitempty"`
+}
+
+// apply overwrites the fields of policy with every field that is set
+// in f.
+func (f BlockRetryConfigFile) apply(policy *BlockRetryPolicy) error {
+	if f.MaxAttempts != nil {
+		policy.MaxAttempts = *f.MaxAttempts
+	}
+	if f.InitialInterval != nil {
+		d, err := parseConfigDuration(
+			"bserver_retry.initial_interval", *f.InitialInterval)
+		if err != nil {
+			return err
+		}
+		policy.InitialInterval = d
+	}
+	if f.MaxInterval != nil {
+		d, err := parseConfigDuration(
+			"bserver_retry.max_interval", *f.MaxInterval)
+		if err != nil {
+			return err
+		}
+		policy.MaxInterval = d
+	}
+	if f.Multiplier != nil {
+		policy.Multiplier = *f.Multiplier
+	}
+	if f.Jitter != nil {
+		policy.Jitter = *f.Jitter
+	}
+	return checkBlockRetryPolicy(*policy)
+}
+
+// BlockRetryPolicyFlag is for specifying a BlockRetryPolicy with the
+// flag package, as a comma-separated list of key=value pairs using
+// the keys of BlockRetryConfigFile, e.g.
+// "max_attempts=6,initial_interval=1s". Unset fields keep their
+// default values.
+type BlockRetryPolicyFlag struct {
+	v **BlockRetryPolicy
+}
+
+// Get for flag interface.
+func (bf BlockRetryPolicyFlag) Get() interface{} { return *bf.v }
+
+// String for flag interface.
+func (bf BlockRetryPolicyFlag) String() string {
+	// This happens when isZeroValue() from flag.go makes a zero
+	// value from the type of a flag.
+	if bf.v == nil || *bf.v == nil {
+		return ""
+	}
+	p := **bf.v
+	return fmt.Sprintf(
+		"max_attempts=%d,initial_interval=%s,max_interval=%s,"+
+			"multiplier=%g,jitter=%g", p.MaxAttempts, p.InitialInterval,
+		p.MaxInterval, p.Multiplier, p.Jitter)
+}
+
+// Set for flag interface.
+func (bf BlockRetryPolicyFlag) Set(raw string) error {
+	var f BlockRetryConfigFile
+	if raw != "" {
+		for _, entry := range strings.Split(raw, ",") {
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) != 2 {
+				return errors.Errorf(
+					"Invalid syntax: %q, expected key=value", entry)
+			}
+			key := strings.TrimSpace(parts[0])
+			value := strings.TrimSpace(parts[1])
+			switch key {
+			case "max_attempts":
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return errors.Wrapf(err, "invalid %s", key)
+				}
+				f.MaxAttempts = &n
+			case "initial_interval":
+				f.InitialInterval = &value
+			case "max_interval":
+				f.MaxInterval = &value
+			case "multiplier", "jitter":
+				x, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return errors.Wrapf(err, "invalid %s", key)
+				}
+				if key == "multiplier" {
+					f.Multiplier = &x
+				} else {
+					f.Jitter = &x
+				}
+			default:
+				return errors.Errorf("Unknown block retry key %q", key)
+			}
+		}
+	}
+	policy := DefaultBlockRetryPolicy()
+	if err := f.apply(&policy); err != nil {
+		return err
+	}
+	*bf.v = &policy
+	return nil
+}
+
+func parseConfigDuration(name, s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid duration for %s", name)
+	}
+	return d, nil
+}
+
+// apply overwrites the fields of params with every field that is set
+// in f, except for those whose flags are in setFlags, since flags
+// given explicitly on the command line take precedence over the
+// config file.
+func (f InitConfigFile) apply(
+	params *InitParams, setFlags map[string]bool) error {
+	if f.Debug != nil && !setFlags["debug"] {
+		params.Debug = *f.Debug
+	}
+	if f.DebugAddr != nil && !setFlags["debug-addr"] {
+		params.DebugAddr = *f.DebugAddr
+	}
+	if f.DebugAllowRemote != nil && !setFlags["debug-allow-remote"] {
+		params.DebugAllowRemote = *f.DebugAllowRemote
+	}
+	if f.BServerAddr != nil && !setFlags["bserver"] {
+		params.BServerAddr = *f.BServerAddr
+	}
+	if f.MDServerAddr != nil && !setFlags["mdserver"] {
+		params.MDServerAddr = *f.MDServerAddr
+	}
+	if f.CleanBlockCacheCapacity != nil && !setFlags["clean-bcache-cap"] {
+		params.CleanBlockCacheCapacity = *f.CleanBlockCacheCapacity
+	}
+	if f.DirtyBlockCacheCapacity != nil && !setFlags["dirty-bcache-cap"] {
+		params.DirtyBlockCacheCapacity = *f.DirtyBlockCacheCapacity
+	}
+	if f.MaxConcurrentTransfers != nil && !setFlags["max-concurrent-transfers"] {
+		params.MaxConcurrentTransfers = *f.MaxConcurrentTransfers
+	}
+	if f.ReadAheadBlocks != nil && !setFlags["read-ahead-blocks"] {
+		params.ReadAheadBlocks = *f.ReadAheadBlocks
+	}
+	if f.BlockCacheEntries != nil && !setFlags["bcache-entries"] {
+		params.BlockCacheEntries = *f.BlockCacheEntries
+	}
+	if f.MDCacheEntries != nil && !setFlags["mdcache-entries"] {
+		params.MDCacheEntries = *f.MDCacheEntries
+	}
+	if f.CacheEvictionPolicy != nil && !setFlags["cache-policy"] {
+		params.CacheEvictionPolicy = *f.CacheEvictionPolicy
+	}
+	if f.LocalUser != nil && !setFlags["localuser"] {
+		params.LocalUser = *f.LocalUser
+	}
+	if f.LocalUsers != nil && !setFlags["localusers"] {
+		specs, err := ParseLocalUserSpecs(strings.Join(f.LocalUsers, ","))
+		if err != nil {
+			return err
+		}
+		params.LocalUsers = specs
+	}
+	if f.LocalFavoriteStorage != nil && !setFlags["local-fav-storage"] {
+		params.LocalFavoriteStorage = *f.LocalFavoriteStorage
+	}
+	if f.PaperKeyFile != nil && !setFlags["paper-key-file"] {
+		params.PaperKeyFile = *f.PaperKeyFile
+	}
+	if f.TLFValidDuration != nil && !setFlags["tlf-valid"] {
+		d, err := parseConfigDuration("tlf_valid", *f.TLFValidDuration)
+		if err != nil {
+			return err
+		}
+		params.TLFValidDuration = d
+	}
+	if f.IdentityCacheTTL != nil && !setFlags["identity-cache-ttl"] {
+		d, err := parseConfigDuration(
+			"identity_cache_ttl", *f.IdentityCacheTTL)
+		if err != nil {
+			return err
+		}
+		params.IdentityCacheTTL = d
+	}
+	if f.NotificationDebounce != nil && !setFlags["notification-debounce"] {
+		d, err := parseConfigDuration(
+			"notification_debounce", *f.NotificationDebounce)
+		if err != nil {
+			return err
+		}
+		params.NotificationDebounce = d
+	}
+	if f.WebhookURL != nil && !setFlags["webhook-url"] {
+		params.WebhookURL = *f.WebhookURL
+	}
+	if f.NotifyFileChanges != nil && !setFlags["notify-file-changes"] {
+		params.NotifyFileChanges = *f.NotifyFileChanges
+	}
+	if f.MDHistoryKeep != nil && !setFlags["md-history-keep"] {
+		params.MDHistoryCompaction.KeepRevisions = *f.MDHistoryKeep
+	}
+	if f.MDHistoryMaxAge != nil && !setFlags["md-history-max-age"] {
+		d, err := parseConfigDuration(
+			"md_history_max_age", *f.MDHistoryMaxAge)
+		if err != nil {
+			return err
+		}
+		params.MDHistoryCompaction.MaxAge = d
+	}
+	if f.MetadataVersion != nil && !setFlags["md-version"] {
+		params.MetadataVersion = *f.MetadataVersion
+	}
+	if f.BlockCompression != nil && !setFlags["block-compression"] {
+		params.BlockCompression = *f.BlockCompression
+	}
+	if f.PublicBlocksUnencrypted != nil && !setFlags["public-blocks-unencrypted"] {
+		params.PublicBlocksUnencrypted = *f.PublicBlocksUnencrypted
+	}
+	if f.BServerUploadLimit != nil && !setFlags["bserver-upload-limit"] {
+		params.BServerUploadLimit = *f.BServerUploadLimit
+	}
+	if f.BServerDownloadLimit != nil && !setFlags["bserver-download-limit"] {
+		params.BServerDownloadLimit = *f.BServerDownloadLimit
+	}
+	if f.ServerRootCertsFile != nil && !setFlags["server-root-certs"] {
+		params.ServerRootCertsFile = *f.ServerRootCertsFile
+	}
+	if f.ServerCertPins != nil && !setFlags["server-cert-pins"] {
+		params.ServerCertPins = f.ServerCertPins
+	}
+	if f.BServerRetry != nil && !setFlags["bserver-retry"] {
+		policy := DefaultBlockRetryPolicy()
+		if params.BlockRetryPolicy != nil {
+			policy = *params.BlockRetryPolicy
+		}
+		if err := f.BServerRetry.apply(&policy); err != nil {
+			return err
+		}
+		params.BlockRetryPolicy = &policy
+	}
+	if f.LogToFile != nil && !setFlags["log-to-file"] {
+		params.LogToFile = *f.LogToFile
+	}
+	if f.LogFile != nil && !setFlags["log-file"] {
+		params.LogFileConfig.Path = *f.LogFile
+	}
+	if f.LogFileMaxAge != nil && !setFlags["log-file-max-age"] {
+		d, err := parseConfigDuration(
+			"log_file_max_age", *f.LogFileMaxAge)
+		if err != nil {
+			return err
+		}
+		params.LogFileConfig.MaxAge = d
+	}
+	if f.LogFileMaxSize != nil && !setFlags["log-file-max-size"] {
+		params.LogFileConfig.MaxSize = *f.LogFileMaxSize
+	}
+	if f.LogFileMaxKeepFiles != nil && !setFlags["log-file-max-keep-files"] {
+		params.LogFileConfig.MaxKeepFiles = *f.LogFileMaxKeepFiles
+	}
+	if f.LogFormat != nil && !setFlags["log-format"] {
+		params.LogFormat = *f.LogFormat
+	}
+	if f.LogLevels != nil && !setFlags["log-levels"] {
+		if _, err := parseLogModuleLevels(f.LogLevels); err != nil {
+			return err
+		}
+		params.LogModuleLevels = f.LogLevels
+	}
+	if f.WriteJournalRoot != nil && !setFlags["write-journal-root"] {
+		params.WriteJournalRoot = *f.WriteJournalRoot
+	}
+	if f.WriteBack != nil && !setFlags["write-back"] {
+		params.WriteBack = *f.WriteBack
+	}
+	if f.JournalByteLimit != nil && !setFlags["journal-byte-limit"] {
+		params.JournalByteLimit = *f.JournalByteLimit
+	}
+	if f.JournalTLFByteLimit != nil && !setFlags["journal-tlf-byte-limit"] {
+		params.JournalTLFByteLimit = *f.JournalTLFByteLimit
+	}
+	if f.JournalFullPolicy != nil && !setFlags["journal-full-policy"] {
+		params.JournalFullPolicy = *f.JournalFullPolicy
+	}
+	if f.TlfSyncRoot != nil && !setFlags["tlf-sync-root"] {
+		params.TlfSyncRoot = *f.TlfSyncRoot
+	}
+	if f.OfflineIdentityRoot != nil && !setFlags["offline-identity-root"] {
+		params.OfflineIdentityRoot = *f.OfflineIdentityRoot
+	}
+	if f.TlfActivityRoot != nil && !setFlags["tlf-activity-root"] {
+		params.TlfActivityRoot = *f.TlfActivityRoot
+	}
+	return nil
+}
+
+// applyEnvOverrides overwrites the fields of params with any of the
+// KBFS_* environment variables above that are set, using getenv to
+// look them up.
+func applyEnvOverrides(params *InitParams, getenv func(string) string) error {
+	if s := getenv(EnvDebug); s != "" {
+		params.Debug = BoolForString(s)
+	}
+	if s := getenv(EnvBServerAddr); s != "" {
+		params.BServerAddr = s
+	}
+	if s := getenv(EnvMDServerAddr); s != "" {
+		params.MDServerAddr = s
+	}
+	if s := getenv(EnvLocalUser); s != "" {
+		params.LocalUser = s
+	}
+	if s := getenv(EnvLocalUsers); s != "" {
+		specs, err := ParseLocalUserSpecs(s)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value for %s", EnvLocalUsers)
+		}
+		params.LocalUsers = specs
+	}
+	if s := getenv(EnvCleanBlockCacheCapacity); s != "" {
+		capacity, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value for %s",
+				EnvCleanBlockCacheCapacity)
+		}
+		params.CleanBlockCacheCapacity = capacity
+	}
+	return nil
+}
+
+// ApplyInitConfig loads the config file named by
+// params.ConfigFile, if any, on top of params, and then applies any
+// environment variable overrides. Values in the config file are
+// used only for the flags that weren't explicitly set in flags
+// (which may be nil, if there are none), so the order of precedence
+// is: environment variables, then explicitly-set flags, then the
+// config file, then the flag defaults. It should be called after
+// the flags passed into AddFlags() have been parsed, and before
+// InitLog() and Init().
+func ApplyInitConfig(params *InitParams, flags *flag.FlagSet) error {
+	params.setFlags = make(map[string]bool)
+	if flags != nil {
+		flags.Visit(func(f *flag.Flag) {
+			params.setFlags[f.Name] = true
+		})
+	}
+	baseParams := *params
+	params.baseParams = &baseParams
+	return applyInitConfig(params)
+}
+
+// applyInitConfig is like ApplyInitConfig, but uses the set of
+// explicitly-set flags already recorded in params.
+func applyInitConfig(params *InitParams) error {
+	if params.ConfigFile != "" {
+		var f InitConfigFile
+		err := ioutil.DeserializeFromJSONFile(params.ConfigFile, &f)
+		if err != nil {
+			return err
+		}
+		err = f.apply(params, params.setFlags)
+		if err != nil {
+			return errors.Wrapf(err, "config file %q", params.ConfigFile)
+		}
+	}
+	return applyEnvOverrides(params, os.Getenv)
+}
@@ -0,0 +1,213 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitConfigFileApply(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "init_config")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		assert.NoError(t, err)
+	}()
+
+	path := filepath.Join(tempdir, "kbfs.json")
+	data := []byte(`{
+  "bserver": "dir:/tmp/kbfs",
+  "clean_bcache_cap": 1024,
+  "dirty_bcache_cap": 4096,
+  "max_concurrent_transfers": 8,
+  "read_ahead_blocks": -1,
+  "bcache_entries": 500,
+  "cache_policy": "slru",
+  "bserver_retry": {"max_attempts": 2, "initial_interval": "1s"},
+  "server_root_certs": "/etc/kbfs/ca.pem",
+  "localuser": "strib",
+  "tlf_valid": "1h",
+  "md_history_keep": 100,
+  "log_file_max_age": "24h"
+}`)
+	err = ioutil.WriteFile(path, data, 0600)
+	require.NoError(t, err)
+
+	params := InitParams{
+		ConfigFile:   path,
+		BServerAddr:  "bserver.example.com:443",
+		MDServerAddr: "mdserver.example.com:443",
+	}
+	var f InitConfigFile
+	err = ioutil.DeserializeFromJSONFile(path, &f)
+	require.NoError(t, err)
+	err = f.apply(&params, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, "dir:/tmp/kbfs", params.BServerAddr)
+	// Unset fields are left alone.
+	require.Equal(t, "mdserver.example.com:443", params.MDServerAddr)
+	require.Equal(t, uint64(1024), params.CleanBlockCacheCapacity)
+	require.Equal(t, uint64(4096), params.DirtyBlockCacheCapacity)
+	require.Equal(t, 8, params.MaxConcurrentTransfers)
+	require.Equal(t, -1, params.ReadAheadBlocks)
+	require.Equal(t, 500, params.BlockCacheEntries)
+	require.Equal(t, 0, params.MDCacheEntries)
+	require.Equal(t, "slru", params.CacheEvictionPolicy)
+	expectedRetryPolicy := DefaultBlockRetryPolicy()
+	expectedRetryPolicy.MaxAttempts = 2
+	expectedRetryPolicy.InitialInterval = time.Second
+	require.Equal(t, &expectedRetryPolicy, params.BlockRetryPolicy)
+	require.Equal(t, "/etc/kbfs/ca.pem", params.ServerRootCertsFile)
+	require.Equal(t, "strib", params.LocalUser)
+	require.Equal(t, time.Hour, params.TLFValidDuration)
+	require.Equal(t, MDHistoryCompactionPolicy{KeepRevisions: 100},
+		params.MDHistoryCompaction)
+	require.Equal(t, 24*time.Hour, params.LogFileConfig.MaxAge)
+}
+
+func TestInitConfigFileBadDuration(t *testing.T) {
+	tlfValid := "forever"
+	f := InitConfigFile{TLFValidDuration: &tlfValid}
+	var params InitParams
+	err := f.apply(&params, nil)
+	require.Error(t, err)
+}
+
+func TestApplyInitConfigExplicitFlags(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "init_config")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		assert.NoError(t, err)
+	}()
+
+	path := filepath.Join(tempdir, "kbfs.json")
+	data := []byte(`{
+  "bserver": "dir:/tmp/kbfs",
+  "mdserver": "dir:/tmp/kbfs",
+  "tlf_valid": "1h"
+}`)
+	err = ioutil.WriteFile(path, data, 0600)
+	require.NoError(t, err)
+
+	var params InitParams
+	flags := flag.NewFlagSet("kbfs", flag.ContinueOnError)
+	flags.StringVar(&params.ConfigFile, "config-file", "", "")
+	flags.StringVar(&params.BServerAddr, "bserver", "", "")
+	flags.StringVar(&params.MDServerAddr, "mdserver", "", "")
+	flags.DurationVar(&params.TLFValidDuration, "tlf-valid", time.Minute, "")
+	err = flags.Parse([]string{
+		"-config-file=" + path, "-bserver=bserver.example.com:443"})
+	require.NoError(t, err)
+
+	err = ApplyInitConfig(&params, flags)
+	require.NoError(t, err)
+	// The explicitly-set flag wins over the config file, which
+	// wins over the flag defaults.
+	require.Equal(t, "bserver.example.com:443", params.BServerAddr)
+	require.Equal(t, "dir:/tmp/kbfs", params.MDServerAddr)
+	require.Equal(t, time.Hour, params.TLFValidDuration)
+}
+
+func TestApplyInitConfigExplicitRetryFlag(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "init_config")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		assert.NoError(t, err)
+	}()
+
+	path := filepath.Join(tempdir, "kbfs.json")
+	data := []byte(`{
+  "bserver_retry": {"max_attempts": 10, "jitter": 0}
+}`)
+	err = ioutil.WriteFile(path, data, 0600)
+	require.NoError(t, err)
+
+	var params InitParams
+	flags := flag.NewFlagSet("kbfs", flag.ContinueOnError)
+	flags.StringVar(&params.ConfigFile, "config-file", "", "")
+	flags.Var(BlockRetryPolicyFlag{&params.BlockRetryPolicy},
+		"bserver-retry", "")
+	err = flags.Parse([]string{
+		"-config-file=" + path, "-bserver-retry=max_attempts=2"})
+	require.NoError(t, err)
+
+	err = ApplyInitConfig(&params, flags)
+	require.NoError(t, err)
+	// The config file must not touch the explicitly-set policy,
+	// not even the fields the flag left unset.
+	expected := DefaultBlockRetryPolicy()
+	expected.MaxAttempts = 2
+	require.Equal(t, &expected, params.BlockRetryPolicy)
+
+	// Without the flag, the config file applies.
+	params = InitParams{}
+	flags = flag.NewFlagSet("kbfs", flag.ContinueOnError)
+	flags.StringVar(&params.ConfigFile, "config-file", "", "")
+	flags.Var(BlockRetryPolicyFlag{&params.BlockRetryPolicy},
+		"bserver-retry", "")
+	err = flags.Parse([]string{"-config-file=" + path})
+	require.NoError(t, err)
+
+	err = ApplyInitConfig(&params, flags)
+	require.NoError(t, err)
+	expected = DefaultBlockRetryPolicy()
+	expected.MaxAttempts = 10
+	expected.Jitter = 0
+	require.Equal(t, &expected, params.BlockRetryPolicy)
+}
+
+func TestBlockRetryPolicyFlag(t *testing.T) {
+	var policy *BlockRetryPolicy
+	f := BlockRetryPolicyFlag{&policy}
+	err := f.Set("max_attempts=3, initial_interval=1s,multiplier=1.5")
+	require.NoError(t, err)
+	expected := DefaultBlockRetryPolicy()
+	expected.MaxAttempts = 3
+	expected.InitialInterval = time.Second
+	expected.Multiplier = 1.5
+	require.Equal(t, &expected, policy)
+
+	require.Error(t, f.Set("max_attempts"))
+	require.Error(t, f.Set("retries=3"))
+	require.Error(t, f.Set("jitter=2"))
+	require.Error(t, f.Set("max_interval=soon"))
+}
+
+func TestInitConfigEnvOverrides(t *testing.T) {
+	env := map[string]string{
+		EnvMDServerAddr:            "memory",
+		EnvCleanBlockCacheCapacity: "2048",
+		EnvDebug:                   "true",
+	}
+	params := InitParams{
+		BServerAddr:  "bserver.example.com:443",
+		MDServerAddr: "mdserver.example.com:443",
+	}
+	err := applyEnvOverrides(&params, func(key string) string {
+		return env[key]
+	})
+	require.NoError(t, err)
+	require.Equal(t, "bserver.example.com:443", params.BServerAddr)
+	require.Equal(t, "memory", params.MDServerAddr)
+	require.Equal(t, uint64(2048), params.CleanBlockCacheCapacity)
+	require.True(t, params.Debug)
+
+	env[EnvCleanBlockCacheCapacity] = "lots"
+	err = applyEnvOverrides(&params, func(key string) string {
+		return env[key]
+	})
+	require.Error(t, err)
+}
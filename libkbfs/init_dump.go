@@ -0,0 +1,74 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"runtime/pprof"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"golang.org/x/net/context"
+)
+
+// dumpStateTimeout bounds how long dumpState waits on status calls,
+// which may themselves be stuck if the process is hung.
+const dumpStateTimeout = 10 * time.Second
+
+// dumpState logs the stacks of all goroutines, along with the
+// current status of KBFS and every known folder branch, which
+// includes any dirty files and unflushed journal entries.
+func dumpState(config Config, log logger.Logger) {
+	var buf bytes.Buffer
+	err := pprof.Lookup("goroutine").WriteTo(&buf, 2)
+	if err != nil {
+		log.Warning("Couldn't dump goroutines: %+v", err)
+	} else {
+		log.Info("Goroutine dump:\n%s", buf.String())
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), dumpStateTimeout)
+	defer cancel()
+
+	status, _, err := config.KBFSOps().Status(ctx)
+	if err != nil {
+		log.Warning("Couldn't get KBFS status: %+v", err)
+	} else if data, err := json.MarshalIndent(status, "", "  "); err == nil {
+		log.Info("KBFS status:\n%s", data)
+	}
+
+	kbfsOps, ok := config.KBFSOps().(*KBFSOpsStandard)
+	if !ok {
+		return
+	}
+	for _, fbo := range kbfsOps.getAllOps() {
+		fbs, _, err := fbo.FolderStatus(ctx, fbo.folderBranch)
+		if err != nil {
+			log.Warning("Couldn't get status for %s: %+v",
+				fbo.folderBranch, err)
+			continue
+		}
+		data, err := json.MarshalIndent(fbs, "", "  ")
+		if err != nil {
+			continue
+		}
+		log.Info("Status for %s:\n%s", fbo.folderBranch, data)
+	}
+}
+
+// dumpStateOnSignal calls dumpState every time a dump signal
+// (SIGUSR1 or SIGUSR2, where supported) is received. It never
+// returns.
+func dumpStateOnSignal(config Config, log logger.Logger) {
+	dumpChan := make(chan os.Signal, 1)
+	notifyOnDumpSignal(dumpChan)
+	for sig := range dumpChan {
+		log.Info("Got %s; dumping state", sig)
+		dumpState(config, log)
+	}
+}
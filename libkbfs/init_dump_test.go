@@ -0,0 +1,22 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestDumpState(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "test_user")
+	ctx := context.Background()
+	defer CheckConfigAndShutdown(ctx, t, config)
+
+	// Make sure there's at least one folder branch to report on.
+	GetRootNodeOrBust(ctx, t, config, "test_user", false)
+
+	dumpState(config, config.MakeLogger(""))
+}
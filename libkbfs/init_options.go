@@ -0,0 +1,186 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"time"
+
+	"github.com/keybase/client/go/logger"
+)
+
+// InitOption sets a single field of InitParams, for callers that
+// would rather not fill in the whole struct themselves. See
+// MakeInitParams and InitWithOptions.
+type InitOption func(*InitParams)
+
+// WithDebug sets whether debug messages are printed.
+func WithDebug(debug bool) InitOption {
+	return func(params *InitParams) {
+		params.Debug = debug
+	}
+}
+
+// WithDebugAddr sets the host:port of the HTTP debug server.
+func WithDebugAddr(addr string) InitOption {
+	return func(params *InitParams) {
+		params.DebugAddr = addr
+	}
+}
+
+// WithCPUProfile sets where to write a CPU profile.
+func WithCPUProfile(path string) InitOption {
+	return func(params *InitParams) {
+		params.CPUProfile = path
+	}
+}
+
+// WithBlockServerAddr sets the block server address, which may also
+// be "memory" or "dir:/path/to/dir".
+func WithBlockServerAddr(addr string) InitOption {
+	return func(params *InitParams) {
+		params.BServerAddr = addr
+	}
+}
+
+// WithMDServerAddr sets the metadata server address, which may also
+// be "memory" or "dir:/path/to/dir".
+func WithMDServerAddr(addr string) InitOption {
+	return func(params *InitParams) {
+		params.MDServerAddr = addr
+	}
+}
+
+// WithCleanBlockCacheCapacity sets the capacity, in bytes, of the
+// clean block cache.
+func WithCleanBlockCacheCapacity(capacity uint64) InitOption {
+	return func(params *InitParams) {
+		params.CleanBlockCacheCapacity = capacity
+	}
+}
+
+// WithLocalUser runs as the given fake local user, storing
+// favorites in favStorage, which must be "memory" or
+// "dir:/path/to/dir".
+func WithLocalUser(user, favStorage string) InitOption {
+	return func(params *InitParams) {
+		params.LocalUser = user
+		params.LocalFavoriteStorage = favStorage
+	}
+}
+
+// WithLocalUsers sets the fake local users that the user given to
+// WithLocalUser must be chosen from.
+func WithLocalUsers(users ...LocalUserSpec) InitOption {
+	return func(params *InitParams) {
+		params.LocalUsers = users
+	}
+}
+
+// WithPaperKeyFile signs and decrypts with the keys of the paper
+// key whose phrase is in the given file, instead of with the device
+// keys held by the keybase service.
+func WithPaperKeyFile(path string) InitOption {
+	return func(params *InitParams) {
+		params.PaperKeyFile = path
+	}
+}
+
+// WithTLFValidDuration sets how long TLFs are valid before being
+// marked for lazy revalidation.
+func WithTLFValidDuration(d time.Duration) InitOption {
+	return func(params *InitParams) {
+		params.TLFValidDuration = d
+	}
+}
+
+// WithIdentityCacheTTL sets how long the results of user lookups
+// are cached.
+func WithIdentityCacheTTL(ttl time.Duration) InitOption {
+	return func(params *InitParams) {
+		params.IdentityCacheTTL = ttl
+	}
+}
+
+// WithNotificationDebounce sets how long notifications of changes
+// made by other devices are held back, waiting for more changes.
+func WithNotificationDebounce(d time.Duration) InitOption {
+	return func(params *InitParams) {
+		params.NotificationDebounce = d
+	}
+}
+
+// WithWebhookURL sets the URL to which new revisions of loaded TLFs
+// are POSTed.
+func WithWebhookURL(rawURL string) InitOption {
+	return func(params *InitParams) {
+		params.WebhookURL = rawURL
+	}
+}
+
+// WithFileChangeNotifications sets whether every change to a loaded
+// TLF is reported to other local processes via the keybase service.
+func WithFileChangeNotifications(enabled bool) InitOption {
+	return func(params *InitParams) {
+		params.NotifyFileChanges = enabled
+	}
+}
+
+// WithMetadataVersion sets the version of metadata to use when
+// creating new metadata.
+func WithMetadataVersion(ver MetadataVer) InitOption {
+	return func(params *InitParams) {
+		params.MetadataVersion = ver
+	}
+}
+
+// WithLogFile sets where and how to log to a file.
+func WithLogFile(config logger.LogFileConfig) InitOption {
+	return func(params *InitParams) {
+		params.LogFileConfig = config
+	}
+}
+
+// WithLogFormat sets the log format, either LogFormatText or
+// LogFormatJSON.
+func WithLogFormat(format string) InitOption {
+	return func(params *InitParams) {
+		params.LogFormat = format
+	}
+}
+
+// WithBlockRetryPolicy sets how operations against a remote block
+// server are retried.
+func WithBlockRetryPolicy(policy BlockRetryPolicy) InitOption {
+	return func(params *InitParams) {
+		params.BlockRetryPolicy = &policy
+	}
+}
+
+// WithWriteJournalRoot sets the directory in which to put write
+// journals. An empty string disables journaling.
+func WithWriteJournalRoot(root string) InitOption {
+	return func(params *InitParams) {
+		params.WriteJournalRoot = root
+	}
+}
+
+// MakeInitParams returns DefaultInitParams(ctx) with the given
+// options applied in order.
+func MakeInitParams(ctx Context, opts ...InitOption) InitParams {
+	params := DefaultInitParams(ctx)
+	for _, opt := range opts {
+		opt(&params)
+	}
+	return params
+}
+
+// InitWithOptions is like Init, but takes a list of options applied
+// on top of DefaultInitParams(ctx) instead of a full InitParams.
+func InitWithOptions(ctx Context, keybaseServiceCn KeybaseServiceCn,
+	onInterruptFn func(), log logger.Logger, opts ...InitOption) (
+	Config, error) {
+	return Init(ctx, MakeInitParams(ctx, opts...), keybaseServiceCn,
+		onInterruptFn, log)
+}
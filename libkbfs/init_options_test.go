@@ -0,0 +1,47 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/stretchr/testify/require"
+)
+
+// testInitContext implements just enough of Context for
+// DefaultInitParams.
+type testInitContext struct {
+	Context
+}
+
+func (testInitContext) GetRunMode() libkb.RunMode { return libkb.DevelRunMode }
+func (testInitContext) GetDataDir() string        { return "/data" }
+func (testInitContext) GetLogDir() string         { return "/log" }
+
+func TestMakeInitParams(t *testing.T) {
+	ctx := testInitContext{}
+	params := MakeInitParams(ctx,
+		WithBlockServerAddr("dir:/tmp/kbfs"),
+		WithLocalUser("alice", memoryAddr),
+		WithLocalUsers(LocalUserSpec{Name: "alice"}),
+		WithTLFValidDuration(time.Minute),
+		WithIdentityCacheTTL(time.Second),
+		WithWriteJournalRoot(""))
+
+	expected := DefaultInitParams(ctx)
+	expected.BServerAddr = "dir:/tmp/kbfs"
+	expected.LocalUser = "alice"
+	expected.LocalFavoriteStorage = memoryAddr
+	expected.LocalUsers = []LocalUserSpec{{Name: "alice"}}
+	expected.TLFValidDuration = time.Minute
+	expected.IdentityCacheTTL = time.Second
+	expected.WriteJournalRoot = ""
+	require.Equal(t, expected, params)
+
+	// With no options, the defaults are used as-is.
+	require.Equal(t, DefaultInitParams(ctx), MakeInitParams(ctx))
+}
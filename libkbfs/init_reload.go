@@ -0,0 +1,164 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"os"
+	"reflect"
+
+	"github.com/keybase/client/go/logger"
+	"golang.org/x/net/context"
+)
+
+// reloadInitParams re-reads the config file and environment
+// overrides on top of the defaults and flags that params was built
+// from, and applies the settings that can be changed at runtime to
+// config: the log levels, the clean block cache capacity, the block
+// compression, whether public blocks are encrypted, the read-ahead,
+// write-back for new TLFs, and the TLF validity duration. Everything
+// else (including the server addresses) is left alone, so the mount
+// and any server connections stay up. Settings that were removed
+// from the config file go back to their flag or default values.
+// Log levels set at runtime through the debug server survive a
+// reload, unless the config file sets a level for the same module.
+// Nothing is changed unless the whole new config is valid. It
+// returns the new params.
+func reloadInitParams(config Config, params InitParams,
+	log logger.Logger) (InitParams, error) {
+	newParams := params
+	if params.baseParams != nil {
+		newParams = *params.baseParams
+		newParams.baseParams = params.baseParams
+	}
+	err := applyInitConfig(&newParams)
+	if err != nil {
+		return params, err
+	}
+
+	// Check everything before changing anything, so that a bad
+	// config leaves all the current settings in place.
+	_, err = parseLogModuleLevels(newParams.LogModuleLevels)
+	if err != nil {
+		return params, err
+	}
+	blockCompression, err := ParseBlockCompressionType(
+		newParams.BlockCompression)
+	if err != nil {
+		return params, err
+	}
+	retryPolicy := DefaultBlockRetryPolicy()
+	if newParams.BlockRetryPolicy != nil {
+		retryPolicy = *newParams.BlockRetryPolicy
+	}
+	err = checkBlockRetryPolicy(retryPolicy)
+	if err != nil {
+		return params, err
+	}
+
+	logLevelsChanged := !reflect.DeepEqual(
+		newParams.LogModuleLevels, params.LogModuleLevels)
+	if logLevelsChanged {
+		log.Info("Setting log levels to %v", newParams.LogModuleLevels)
+		err := updateLogModuleLevels(
+			params.LogModuleLevels, newParams.LogModuleLevels)
+		if err != nil {
+			return params, err
+		}
+	}
+
+	if logLevelsChanged || newParams.Debug != params.Debug {
+		// This also puts any modules that no longer have an
+		// explicit level back to the global one, but leaves
+		// modules whose level was set at runtime alone.
+		log.Info("Setting debug logging to %t", newParams.Debug)
+		setLogDebugForAllModules(newParams.Debug)
+	}
+
+	cleanCapacity := newParams.CleanBlockCacheCapacity
+	if cleanCapacity == 0 {
+		cleanCapacity = getDefaultCleanBlockCacheCapacity()
+	}
+	if cleanCapacity != config.BlockCache().GetCleanBytesCapacity() {
+		log.Info("Setting clean block cache capacity to %d",
+			cleanCapacity)
+		config.BlockCache().SetCleanBytesCapacity(cleanCapacity)
+	}
+
+	if blockCompression != config.BlockCompression() {
+		log.Info("Setting block compression to %s", blockCompression)
+		config.SetBlockCompression(blockCompression)
+	}
+
+	if newParams.PublicBlocksUnencrypted != config.PublicBlocksUnencrypted() {
+		log.Info("Setting unencrypted public blocks to %t",
+			newParams.PublicBlocksUnencrypted)
+		config.SetPublicBlocksUnencrypted(newParams.PublicBlocksUnencrypted)
+	}
+
+	readAhead := readAheadFromParams(newParams)
+	if readAhead != config.ReadAhead() {
+		log.Info("Setting read-ahead to %+v", readAhead)
+		config.SetReadAhead(readAhead)
+	}
+
+	limits := BlockBandwidthLimits{
+		Upload:   newParams.BServerUploadLimit,
+		Download: newParams.BServerDownloadLimit,
+	}
+	if limits != config.BlockBandwidthLimits() {
+		log.Info("Setting block bandwidth limits to %+v", limits)
+		config.SetBlockBandwidthLimits(limits)
+	}
+
+	if retryPolicy != config.BlockRetryPolicy() {
+		log.Info("Setting block retry policy to %+v", retryPolicy)
+		config.SetBlockRetryPolicy(retryPolicy)
+	}
+
+	if newParams.WriteBack != params.WriteBack {
+		// Journals that are already on stay on either way.
+		if jServer, err := GetJournalServer(config); err == nil {
+			log.Info("Setting write-back to %t", newParams.WriteBack)
+			jServer.SetEnableAutoByDefault(
+				context.Background(), newParams.WriteBack)
+		}
+	}
+
+	if newParams.TLFValidDuration != config.TLFValidDuration() {
+		log.Info("Setting TLF valid duration to %s",
+			newParams.TLFValidDuration)
+		config.SetTLFValidDuration(newParams.TLFValidDuration)
+	}
+
+	if newParams.IdentityCacheTTL != config.IdentityCacheTTL() {
+		log.Info("Setting identity cache TTL to %s",
+			newParams.IdentityCacheTTL)
+		config.SetIdentityCacheTTL(newParams.IdentityCacheTTL)
+	}
+
+	if newParams.NotificationDebounce != config.NotificationDebounce() {
+		log.Info("Setting notification debounce to %s",
+			newParams.NotificationDebounce)
+		config.SetNotificationDebounce(newParams.NotificationDebounce)
+	}
+
+	return newParams, nil
+}
+
+// reloadOnSignal calls reloadInitParams every time a reload signal
+// (SIGHUP, where supported) is received. It never returns.
+func reloadOnSignal(config Config, params InitParams, log logger.Logger) {
+	reloadChan := make(chan os.Signal, 1)
+	notifyOnReloadSignal(reloadChan)
+	for sig := range reloadChan {
+		log.Info("Got %s; reloading config", sig)
+		newParams, err := reloadInitParams(config, params, log)
+		if err != nil {
+			log.Warning("Couldn't reload config: %+v", err)
+			continue
+		}
+		params = newParams
+	}
+}
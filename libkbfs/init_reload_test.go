@@ -0,0 +1,121 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	logging "github.com/keybase/go-logging"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestReloadInitParams(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "test_user")
+	defer CheckConfigAndShutdown(context.Background(), t, config)
+
+	tempdir, err := ioutil.TempDir(os.TempDir(), "init_reload")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		assert.NoError(t, err)
+	}()
+
+	path := filepath.Join(tempdir, "kbfs.json")
+	data := []byte(`{"clean_bcache_cap": 4096, "tlf_valid": "2h"}`)
+	err = ioutil.WriteFile(path, data, 0600)
+	require.NoError(t, err)
+
+	params := InitParams{ConfigFile: path, TLFValidDuration: time.Hour}
+	err = ApplyInitConfig(&params, nil)
+	require.NoError(t, err)
+	newParams, err := reloadInitParams(
+		config, params, config.MakeLogger(""))
+	require.NoError(t, err)
+	require.Equal(t, uint64(4096), newParams.CleanBlockCacheCapacity)
+	require.Equal(t, uint64(4096),
+		config.BlockCache().GetCleanBytesCapacity())
+	require.Equal(t, 2*time.Hour, config.TLFValidDuration())
+
+	// A setting removed from the config file goes back to its
+	// original value.
+	err = ioutil.WriteFile(path, []byte(`{"clean_bcache_cap": 4096}`), 0600)
+	require.NoError(t, err)
+	newParams, err = reloadInitParams(
+		config, newParams, config.MakeLogger(""))
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, config.TLFValidDuration())
+
+	// A bad config file leaves everything as it was, even the
+	// settings that are valid.
+	err = ioutil.WriteFile(path, []byte(`{"tlf_valid": "soon"}`), 0600)
+	require.NoError(t, err)
+	_, err = reloadInitParams(config, newParams, config.MakeLogger(""))
+	require.Error(t, err)
+	require.Equal(t, time.Hour, config.TLFValidDuration())
+	err = ioutil.WriteFile(path,
+		[]byte(`{"tlf_valid": "3h", "block_compression": "zip"}`), 0600)
+	require.NoError(t, err)
+	_, err = reloadInitParams(config, newParams, config.MakeLogger(""))
+	require.Error(t, err)
+	require.Equal(t, time.Hour, config.TLFValidDuration())
+}
+
+func TestReloadInitParamsKeepsRuntimeLogLevels(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "test_user")
+	defer CheckConfigAndShutdown(context.Background(), t, config)
+	defer func() {
+		err := setLogModuleLevels(nil)
+		require.NoError(t, err)
+	}()
+
+	tempdir, err := ioutil.TempDir(os.TempDir(), "init_reload")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		assert.NoError(t, err)
+	}()
+
+	const fileModule = "kbfs(reloadfile)"
+	const runtimeModule = "kbfs(reloadruntime)"
+	newModuleLogger(fileModule, false)
+	newModuleLogger(runtimeModule, false)
+	path := filepath.Join(tempdir, "kbfs.json")
+	data := []byte(`{"log_levels": {"kbfs(reloadfile)": "warning"}}`)
+	err = ioutil.WriteFile(path, data, 0600)
+	require.NoError(t, err)
+
+	params := InitParams{ConfigFile: path}
+	err = ApplyInitConfig(&params, nil)
+	require.NoError(t, err)
+	err = setLogModuleLevels(params.LogModuleLevels)
+	require.NoError(t, err)
+
+	// A level set through the debug server survives reloads that
+	// change the file's levels and the global debug setting.
+	err = setLogModuleLevel(runtimeModule, "error")
+	require.NoError(t, err)
+	data = []byte(`{"debug": true, "log_levels": {"kbfs(reloadfile)": "info"}}`)
+	err = ioutil.WriteFile(path, data, 0600)
+	require.NoError(t, err)
+	newParams, err := reloadInitParams(
+		config, params, config.MakeLogger(""))
+	require.NoError(t, err)
+	require.Equal(t, logging.INFO, logging.GetLevel(fileModule))
+	require.Equal(t, logging.ERROR, logging.GetLevel(runtimeModule))
+
+	// A module dropped from the file goes back to the global level.
+	err = ioutil.WriteFile(path, []byte(`{"debug": true}`), 0600)
+	require.NoError(t, err)
+	_, err = reloadInitParams(config, newParams, config.MakeLogger(""))
+	require.NoError(t, err)
+	require.Equal(t, logging.DEBUG, logging.GetLevel(fileModule))
+	require.Equal(t, logging.ERROR, logging.GetLevel(runtimeModule))
+}
@@ -0,0 +1,25 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package libkbfs
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func notifyOnShutdownSignal(c chan<- os.Signal) {
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+}
+
+func notifyOnReloadSignal(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGHUP)
+}
+
+func notifyOnDumpSignal(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+}
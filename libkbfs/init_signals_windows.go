@@ -0,0 +1,21 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"os"
+	"os/signal"
+)
+
+func notifyOnShutdownSignal(c chan<- os.Signal) {
+	signal.Notify(c, os.Interrupt)
+}
+
+// notifyOnReloadSignal does nothing on Windows, which has no SIGHUP.
+func notifyOnReloadSignal(c chan<- os.Signal) {}
+
+// notifyOnDumpSignal does nothing on Windows, which has no SIGUSR1
+// or SIGUSR2.
+func notifyOnDumpSignal(c chan<- os.Signal) {}
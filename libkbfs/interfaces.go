@@ -5,6 +5,8 @@
 package libkbfs
 
 import (
+	"crypto/tls"
+	"os"
 	"time"
 
 	"github.com/keybase/client/go/libkb"
@@ -47,6 +49,43 @@ type cryptoPureGetter interface {
 	cryptoPure() cryptoPure
 }
 
+type blockCompressionGetter interface {
+	// BlockCompression returns the compression to apply to
+	// blocks before they are encrypted and uploaded.
+	BlockCompression() BlockCompressionType
+}
+
+type publicBlocksUnencryptedGetter interface {
+	// PublicBlocksUnencrypted returns whether new blocks of
+	// public TLFs are uploaded without being encrypted.
+	PublicBlocksUnencrypted() bool
+}
+
+type blockTransferTrackerGetter interface {
+	blockTransferTracker() *blockTransferTracker
+}
+
+type tlfSyncCacheGetter interface {
+	// tlfSyncCache returns the on-disk cache of the blocks of
+	// TLFs synced to this device, or nil if syncing isn't enabled.
+	tlfSyncCache() *tlfSyncCache
+}
+
+type tlfActivityLogGetter interface {
+	// tlfActivityLog returns the on-disk log of the operations
+	// in each TLF, or nil if it isn't enabled.
+	tlfActivityLog() *tlfActivityLog
+}
+
+// BlockTransferObserver is notified of the progress of block uploads
+// and downloads, e.g. so that a UI can show it.
+type BlockTransferObserver interface {
+	// BlockTransferProgress is called each time some bytes have
+	// been transferred. It must not block.
+	BlockTransferProgress(ctx context.Context,
+		progress BlockTransferProgress)
+}
+
 // Block just needs to be (de)serialized using msgpack
 type Block interface {
 	dataVersioner
@@ -86,6 +125,12 @@ type Node interface {
 	// GetBasename returns the current basename of the node, or ""
 	// if the node has been unlinked.
 	GetBasename() string
+	// GetPathPlaintextSansTlf returns the current path of the node
+	// below the root of its TLF, e.g. "/a/b" (or "/" for the root
+	// itself), and true; or false if the node has been unlinked.
+	// The path may be out of date as soon as it's returned, if
+	// there are concurrent renames.
+	GetPathPlaintextSansTlf() (string, bool)
 }
 
 // KBFSOps handles all file system operations.  Expands all indirect
@@ -123,7 +168,9 @@ type Node interface {
 // action.
 type KBFSOps interface {
 	// GetFavorites returns the logged-in user's list of favorite
-	// top-level folders.  This is a remote-access operation.
+	// top-level folders, along with any conflicted copies of
+	// folders kept after conflict resolution gave up on an unmerged
+	// branch.  This is a remote-access operation.
 	GetFavorites(ctx context.Context) ([]Favorite, error)
 	// RefreshCachedFavorites tells the instances to forget any cached
 	// favorites list and fetch a new list from the server.  The
@@ -135,9 +182,16 @@ type KBFSOps interface {
 	AddFavorite(ctx context.Context, fav Favorite) error
 	// DeleteFavorite deletes the favorite from both the server and
 	// the local cache.  Idempotent, so it succeeds even if the folder
-	// isn't favorited.
+	// isn't favorited.  Deleting a conflicted copy clears it, after
+	// which it can't be read anymore.
 	DeleteFavorite(ctx context.Context, fav Favorite) error
 
+	// GetAllTLFHandles returns the handles of all the TLFs that
+	// the logged-in user is a writer or private reader of,
+	// whether or not they're favorites, sorted by their canonical
+	// paths.  This is a remote-access operation.
+	GetAllTLFHandles(ctx context.Context) ([]*TlfHandle, error)
+
 	// GetTLFCryptKeys gets crypt key of all generations as well as
 	// TLF ID for tlfHandle. The returned keys (the keys slice) are ordered by
 	// generation, starting with the key for FirstValidKeyGen.
@@ -147,13 +201,21 @@ type KBFSOps interface {
 	// GetTLFID gets the TLF ID for tlfHandle.
 	GetTLFID(ctx context.Context, tlfHandle *TlfHandle) (tlf.ID, error)
 
+	// GetTLFHandle gets the latest handle for the TLF with the
+	// given ID, as the mdserver knows it, resolved against the
+	// current identities of its users. It returns a
+	// NoSuchTlfHandleError if the ID is unknown.  This is a
+	// remote-access operation.
+	GetTLFHandle(ctx context.Context, id tlf.ID) (*TlfHandle, error)
+
 	// GetOrCreateRootNode returns the root node and root entry
 	// info associated with the given TLF handle and branch, if
 	// the logged-in user has read permissions to the top-level
 	// folder. It creates the folder if one doesn't exist yet (and
 	// branch == MasterBranch), and the logged-in user has write
-	// permissions to the top-level folder.  This is a
-	// remote-access operation.
+	// permissions to the top-level folder.  A handle naming a
+	// conflicted copy listed by GetFavorites gets the read-only
+	// root of that copy.  This is a remote-access operation.
 	GetOrCreateRootNode(
 		ctx context.Context, h *TlfHandle, branch BranchName) (
 		node Node, ei EntryInfo, err error)
@@ -167,6 +229,14 @@ type KBFSOps interface {
 	// permission for the top-level folder.  This is a remote-access
 	// operation.
 	GetDirChildren(ctx context.Context, dir Node) (map[string]EntryInfo, error)
+	// GetDirChildrenPage returns up to `maxEntries` children of the
+	// directory, sorted by name, starting with the first name that
+	// sorts after `after` (pass "" to start at the beginning).
+	// `more` is true if the directory has more children after the
+	// returned ones; to get them, call again with the name of the
+	// last returned child.  This is a remote-access operation.
+	GetDirChildrenPage(ctx context.Context, dir Node, after string,
+		maxEntries int) (children []DirChild, more bool, err error)
 	// Lookup returns the Node and entry info associated with a
 	// given name in a directory, if the logged-in user has read
 	// permissions to the top-level folder.  The returned Node is nil
@@ -252,11 +322,39 @@ type KBFSOps interface {
 	// permissions to the top-level folder.  This is a remote-sync
 	// operation.
 	SetEx(ctx context.Context, file Node, ex bool) error
+	// SetMode sets the POSIX permission bits of the file or
+	// directory represented by a given node, if the logged-in user
+	// has write permissions to the top-level folder.  Only the
+	// permission bits of mode are kept, and for files the
+	// user-exec bit also sets the executable bit.  It is a no-op
+	// on symlinks and on the root directory of a folder.  This is
+	// a remote-sync operation.
+	SetMode(ctx context.Context, node Node, mode os.FileMode) error
 	// SetMtime sets the modification time on the file represented by
 	// a given node, if the logged-in user has write permissions to
 	// the top-level folder.  If mtime is nil, it is a noop.  This is
 	// a remote-sync operation.
 	SetMtime(ctx context.Context, file Node, mtime *time.Time) error
+	// GetXattr returns the value of the extended attribute called
+	// name on the file or directory represented by the given node,
+	// or NoSuchXattrError if there isn't one.
+	GetXattr(ctx context.Context, node Node, name string) ([]byte, error)
+	// ListXattrs returns the sorted names of all the extended
+	// attributes on the file or directory represented by the given
+	// node.
+	ListXattrs(ctx context.Context, node Node) ([]string, error)
+	// SetXattr sets the extended attribute called name on the file
+	// or directory represented by the given node, if the logged-in
+	// user has write permissions to the top-level folder.  Extended
+	// attributes are stored with the node's directory entry, so
+	// they can't be set on the root directory of a folder.  This
+	// is a remote-sync operation.
+	SetXattr(ctx context.Context, node Node, name string, value []byte) error
+	// RemoveXattr removes the extended attribute called name from
+	// the file or directory represented by the given node, if the
+	// logged-in user has write permissions to the top-level
+	// folder.  This is a remote-sync operation.
+	RemoveXattr(ctx context.Context, node Node, name string) error
 	// Sync flushes all outstanding writes and truncates for the given
 	// file to the KBFS servers, if the logged-in user has write
 	// permissions to the top-level folder.  If done through a file
@@ -280,6 +378,19 @@ type KBFSOps interface {
 	UnstageForTesting(ctx context.Context, folderBranch FolderBranch) error
 	// Rekey rekeys this folder.
 	Rekey(ctx context.Context, id tlf.ID) error
+	// RotateKey rekeys this folder with a brand new key
+	// generation, so that everything written from now on is
+	// encrypted with a key that no removed reader or writer has
+	// ever had.
+	RotateKey(ctx context.Context, id tlf.ID) error
+	// SetTlfSyncMode sets how much of this folder is kept on this
+	// device, persistently. In TlfSyncModeFull, all of the
+	// folder's blocks are downloaded to local disk, and kept up
+	// to date as the folder changes, so that it can be read while
+	// offline; leaving that mode deletes them from disk. In
+	// TlfSyncModeExcluded, nothing is prefetched or journaled
+	// automatically for the folder.
+	SetTlfSyncMode(ctx context.Context, id tlf.ID, mode TlfSyncMode) error
 	// SyncFromServerForTesting blocks until the local client has
 	// contacted the server and guaranteed that all known updates
 	// for the given top-level folder have been applied locally
@@ -295,12 +406,89 @@ type KBFSOps interface {
 	// outstanding writes from the local device.
 	GetUpdateHistory(ctx context.Context, folderBranch FolderBranch) (
 		history TLFUpdateHistory, err error)
+	// GetUnmergedHistory returns the revisions on this device's
+	// local unmerged branch of the given folder, oldest first,
+	// along with the ops in each of them.  These are what
+	// conflict resolution will replay on top of the merged
+	// branch.  The history has no updates if the folder isn't
+	// unmerged.
+	GetUnmergedHistory(ctx context.Context, folderBranch FolderBranch) (
+		history TLFUpdateHistory, err error)
+	// SubscribeToChanges registers subscriber to get batches of
+	// ChangeEvents about changes to node (the entries in it, if
+	// it's a directory, or its contents and attributes), or about
+	// every change in the given folder if node is nil.  Only
+	// changes involving nodes this device has already looked up
+	// are reported.
+	SubscribeToChanges(ctx context.Context, folderBranch FolderBranch,
+		node Node, subscriber ChangeSubscriber) error
+	// SubscribeToFilteredChanges registers subscriber to get
+	// batches of the ChangeEvents in the given folder that match
+	// filter, which may limit them to a subdirectory's subtree
+	// and/or to paths matching a glob.  Unlike SubscribeToChanges,
+	// the directory doesn't need to have been looked up; but, as
+	// there, only changes involving nodes this device has already
+	// looked up are reported.
+	SubscribeToFilteredChanges(ctx context.Context,
+		folderBranch FolderBranch, filter ChangeFilter,
+		subscriber ChangeSubscriber) error
+	// UnsubscribeFromChanges removes all of subscriber's
+	// subscriptions in the given folder.
+	UnsubscribeFromChanges(ctx context.Context, folderBranch FolderBranch,
+		subscriber ChangeSubscriber) error
 	// GetEditHistory returns a clustered list of the most recent file
 	// edits by each of the valid writers of the given folder.  users
 	// looking to get updates to this list can register as an observer
 	// for the folder.
 	GetEditHistory(ctx context.Context, folderBranch FolderBranch) (
 		edits TlfWriterEdits, err error)
+	// GetActivityLog returns the operations recorded in this
+	// device's activity log for the given folder, made at or after
+	// since (or all of them, if since is zero).  Only revisions
+	// applied while the folder was loaded on this device are
+	// logged, and only the most recent operations are kept.
+	GetActivityLog(ctx context.Context, folderBranch FolderBranch,
+		since time.Time) ([]TlfActivityEntry, error)
+	// GetArchivedEntry returns the EntryInfo of the entry at the
+	// given path, as of the given past (merged) revision of the
+	// folder.  The path is the list of names below the root of the
+	// folder; an empty path means the root itself.  The blocks of
+	// old revisions may have been deleted by quota reclamation, in
+	// which case this returns an error.
+	GetArchivedEntry(ctx context.Context, folderBranch FolderBranch,
+		rev MetadataRevision, p []string) (EntryInfo, error)
+	// GetArchivedDirChildren is like GetDirChildren, for the
+	// directory at the given path as of the given past revision of
+	// the folder.
+	GetArchivedDirChildren(ctx context.Context, folderBranch FolderBranch,
+		rev MetadataRevision, p []string) (map[string]EntryInfo, error)
+	// ReadArchived is like Read, for the file at the given path as
+	// of the given past revision of the folder.
+	ReadArchived(ctx context.Context, folderBranch FolderBranch,
+		rev MetadataRevision, p []string, dest []byte, off int64) (
+		int64, error)
+	// GetTlfSettings returns the settings of the given folder, as of
+	// the latest revision known to this device.
+	GetTlfSettings(ctx context.Context, folderBranch FolderBranch) (
+		TlfSettings, error)
+	// SetTlfSettings replaces the settings of the given folder, by
+	// writing a new revision of its metadata, so that they
+	// propagate to the folder's other devices.  Only writers may
+	// change the settings.
+	SetTlfSettings(ctx context.Context, folderBranch FolderBranch,
+		settings TlfSettings) error
+	// Lock takes the given POSIX-style advisory lock on the given
+	// folder, shared by all devices that can access the folder.
+	// The lock is held, and its lease renewed, until Unlock is
+	// called or the folder is shut down.  If another device holds
+	// the lock, Lock returns MDServerErrorLocked, unless wait is
+	// true, in which case it keeps trying until the lock is free
+	// or ctx is canceled.
+	Lock(ctx context.Context, folderBranch FolderBranch, lockID LockID,
+		wait bool) error
+	// Unlock releases the given advisory lock on the given folder.
+	Unlock(ctx context.Context, folderBranch FolderBranch,
+		lockID LockID) error
 
 	// GetNodeMetadata gets metadata associated with a Node.
 	GetNodeMetadata(ctx context.Context, node Node) (NodeMetadata, error)
@@ -322,6 +510,15 @@ type KBFSOps interface {
 	// newest version.  It works asynchronously, so no error is
 	// returned.
 	ForceFastForward(ctx context.Context)
+	// KickoffRekeysForUser enqueues a rekey for every private folder
+	// with a known head that the given user can read, and that the
+	// current user could rekey for them, e.g. after the given
+	// user's set of devices has changed, or after they've proven
+	// one of the folder's unresolved social assertions.  Folders
+	// that don't actually need a rekey are left untouched by the
+	// rekey queue.  It works asynchronously, so no error is
+	// returned.
+	KickoffRekeysForUser(ctx context.Context, uid keybase1.UID)
 }
 
 // KeybaseService is an interface for communicating with the keybase
@@ -364,6 +561,12 @@ type KeybaseService interface {
 	LoadUnverifiedKeys(ctx context.Context, uid keybase1.UID) (
 		[]keybase1.PublicKey, error)
 
+	// LoadTeam returns a TeamInfo struct, with the current
+	// membership of the team with the given ID. Team names share
+	// a namespace with usernames, so Resolve also resolves team
+	// names, to team IDs.
+	LoadTeam(ctx context.Context, tid keybase1.UID) (TeamInfo, error)
+
 	// CurrentSession returns a SessionInfo struct with all the
 	// information for the current session, or an error otherwise.
 	CurrentSession(ctx context.Context, sessionID int) (SessionInfo, error)
@@ -415,6 +618,19 @@ type KeybaseServiceCn interface {
 	NewCrypto(config Config, params InitParams, ctx Context, log logger.Logger) (Crypto, error)
 }
 
+// KBPKICn is an optional interface that a KeybaseServiceCn can also
+// implement, to supply an identity provider other than the Keybase
+// service (e.g., a directory that maps its own accounts to keys).
+// If it isn't implemented, KBPKI calls go to the KeybaseService
+// made by the KeybaseServiceCn. NewKBPKI is called after
+// config.KeybaseService() is set, and before config.Crypto() is.
+//
+// The behavior that libkbfs relies on from a KBPKI is documented by
+// the tests in kbpki_contract_test.go.
+type KBPKICn interface {
+	NewKBPKI(config Config, params InitParams, ctx Context, log logger.Logger) (KBPKI, error)
+}
+
 type resolver interface {
 	// Resolve, given an assertion, resolves it to a username/UID
 	// pair. The username <-> UID mapping is trusted and
@@ -443,6 +659,19 @@ type normalizedUsernameGetter interface {
 	GetNormalizedUsername(ctx context.Context, uid keybase1.UID) (libkb.NormalizedUsername, error)
 }
 
+type teamInfoGetter interface {
+	// GetTeamInfo returns the name and the current membership of
+	// the team with the given ID.
+	GetTeamInfo(ctx context.Context, tid keybase1.UID) (TeamInfo, error)
+}
+
+// tlfHandleNameGetter looks up the names of the users and teams
+// named in a TLF handle.
+type tlfHandleNameGetter interface {
+	normalizedUsernameGetter
+	teamInfoGetter
+}
+
 type currentInfoGetter interface {
 	// GetCurrentToken gets the current keybase session token.
 	GetCurrentToken(ctx context.Context) (string, error)
@@ -466,6 +695,14 @@ type KBPKI interface {
 	resolver
 	identifier
 	normalizedUsernameGetter
+	teamInfoGetter
+
+	// ResolveUIDs returns the normalized names of the given users
+	// (and teams), looking them up in parallel, and using cached
+	// lookups where possible. UIDs that don't correspond to a user
+	// or team are left out of the result.
+	ResolveUIDs(ctx context.Context, uids []keybase1.UID) (
+		map[keybase1.UID]libkb.NormalizedUsername, error)
 
 	// HasVerifyingKey returns nil if the given user has the given
 	// VerifyingKey, and an error otherwise.
@@ -618,6 +855,13 @@ type KeyManager interface {
 	// promptPaper shouldn't be set if md is for a public TLF.
 	Rekey(ctx context.Context, md *RootMetadata, promptPaper bool) (
 		bool, *kbfscrypto.TLFCryptKey, error)
+
+	// RotateKey is like Rekey, except that it always adds a new
+	// key generation to the given MD object, even if no devices
+	// have been removed.  Only writers of a private TLF may rotate
+	// its key.
+	RotateKey(ctx context.Context, md *RootMetadata) (
+		bool, *kbfscrypto.TLFCryptKey, error)
 }
 
 // Reporter exports events (asynchronously) to any number of sinks
@@ -635,6 +879,19 @@ type Reporter interface {
 	Shutdown()
 }
 
+// UserAlerter raises conditions the user can act on (see
+// UserAlertType), so that frontends can show them, e.g. as desktop
+// notifications.  The same condition may be raised many times, so
+// implementations should rate-limit whatever they show.
+type UserAlerter interface {
+	// AlertUser raises the given alert.  It must not block.
+	AlertUser(ctx context.Context, alert UserAlert)
+}
+
+type userAlerterGetter interface {
+	UserAlerter() UserAlerter
+}
+
 // MDCache gets and puts plaintext top-level metadata into the cache.
 type MDCache interface {
 	// Get gets the metadata object associated with the given TLF ID,
@@ -731,6 +988,10 @@ type BlockCache interface {
 	// GetCleanBytesCapacity atomically gets clean bytes capacity for block
 	// cache.
 	GetCleanBytesCapacity() (capacity uint64)
+
+	// Status returns the current hit, miss, eviction and size
+	// statistics of the cache.
+	Status() BlockCacheStatus
 }
 
 // DirtyPermChan is a channel that gets closed when the holder has
@@ -887,9 +1148,30 @@ type cryptoPure interface {
 	EncryptBlock(block Block, key kbfscrypto.BlockCryptKey) (
 		plainSize int, encryptedBlock EncryptedBlock, err error)
 
-	// DecryptBlock decrypts a block. Similar to EncryptBlock(),
-	// DecryptBlock() must guarantee that (size of the decrypted
-	// block) <= len(encryptedBlock).
+	// EncryptCompressedBlock is like EncryptBlock, but first
+	// compresses the encoded block with the given method, if
+	// that makes it smaller. plainSize is still the size of the
+	// uncompressed encoded block.
+	EncryptCompressedBlock(block Block, key kbfscrypto.BlockCryptKey,
+		compression BlockCompressionType) (
+		plainSize int, encryptedBlock EncryptedBlock, err error)
+
+	// MakeUnencryptedBlock is like EncryptCompressedBlock, but
+	// doesn't encrypt or pad the block, and returns an
+	// EncryptedBlock with version EncryptionNone. It still
+	// includes a random nonce, so that the IDs of identical
+	// blocks differ. This must only be used for blocks of public
+	// TLFs.
+	MakeUnencryptedBlock(block Block, compression BlockCompressionType) (
+		plainSize int, unencryptedBlock EncryptedBlock, err error)
+
+	// DecryptBlock decrypts a block, decompressing it if
+	// necessary. Similar to EncryptBlock(), DecryptBlock() must
+	// guarantee that (size of the decrypted block) <=
+	// len(encryptedBlock), unless the block was compressed.
+	// Blocks with version EncryptionNone are just decoded,
+	// ignoring the key; it's up to the caller to make sure that
+	// the block belongs to a public TLF.
 	DecryptBlock(encryptedBlock EncryptedBlock,
 		key kbfscrypto.BlockCryptKey, block Block) error
 
@@ -1035,11 +1317,25 @@ type KeyOps interface {
 		cryptPublicKey kbfscrypto.CryptPublicKey) (
 		kbfscrypto.TLFCryptKeyServerHalf, error)
 
+	// GetTLFCryptKeyServerHalves gets the server-side key halves for
+	// a device given a batch of key half IDs, in the same order,
+	// using as few round trips to the key server as possible.
+	GetTLFCryptKeyServerHalves(ctx context.Context,
+		serverHalfIDs []TLFCryptKeyServerHalfID,
+		cryptPublicKey kbfscrypto.CryptPublicKey) (
+		[]kbfscrypto.TLFCryptKeyServerHalf, error)
+
 	// PutTLFCryptKeyServerHalves stores a server-side key halves for a
 	// set of users and devices.
 	PutTLFCryptKeyServerHalves(ctx context.Context,
 		keyServerHalves UserDeviceKeyServerHalves) error
 
+	// PutTLFCryptKeyServerHalvesBatch stores the server-side key
+	// halves for a set of users and devices across several key
+	// generations in a single round trip to the key server.
+	PutTLFCryptKeyServerHalvesBatch(ctx context.Context,
+		keyServerHalves []UserDeviceKeyServerHalves) error
+
 	// DeleteTLFCryptKeyServerHalf deletes a server-side key half for a
 	// device given the key half ID.
 	DeleteTLFCryptKeyServerHalf(ctx context.Context,
@@ -1196,6 +1492,18 @@ type MDServer interface {
 	// released.
 	TruncateUnlock(ctx context.Context, id tlf.ID) (bool, error)
 
+	// Lock attempts to take the given advisory lock for this folder
+	// on behalf of the current device, for a lease defined by the
+	// server.  Taking a lock already held by this device renews
+	// its lease.  Returns MDServerErrorLocked if another device
+	// holds the lock.
+	Lock(ctx context.Context, id tlf.ID, lockID LockID) error
+	// ReleaseLock releases the given advisory lock for this
+	// folder.  Releasing a lock that isn't held is a no-op.
+	// Returns MDServerErrorLocked if another device holds the
+	// lock.
+	ReleaseLock(ctx context.Context, id tlf.ID, lockID LockID) error
+
 	// DisableRekeyUpdatesForTesting disables processing rekey updates
 	// received from the mdserver while testing.
 	DisableRekeyUpdatesForTesting()
@@ -1213,6 +1521,12 @@ type MDServer interface {
 	GetLatestHandleForTLF(ctx context.Context, id tlf.ID) (
 		tlf.Handle, error)
 
+	// GetTLFIDsForCurrentUser returns the IDs of all the TLFs that
+	// the logged-in user is a writer or a private reader of, in no
+	// particular order. Public TLFs the user isn't a writer of
+	// aren't included.
+	GetTLFIDsForCurrentUser(ctx context.Context) ([]tlf.ID, error)
+
 	// OffsetFromServerTime is the current estimate for how off our
 	// local clock is from the mdserver clock.  Add this to any
 	// mdserver-provided timestamps to get the "local" time of the
@@ -1238,6 +1552,14 @@ type mdServerLocal interface {
 		rev MetadataRevision, err error)
 	isShutdown() bool
 	copy(config mdServerLocalConfig) mdServerLocal
+
+	// TruncateHistoryAfter deletes every merged revision of the
+	// given TLF after rev, making rev the new head, and forgets
+	// all unmerged branches of the TLF. This is meant for
+	// disaster recovery of self-hosted servers; only writers of
+	// the TLF may do it.
+	TruncateHistoryAfter(ctx context.Context, id tlf.ID,
+		rev MetadataRevision) error
 }
 
 // BlockServer gets and puts opaque data blocks.  The instantiation
@@ -1319,6 +1641,15 @@ type BlockServer interface {
 
 	// GetUserQuotaInfo returns the quota for the user.
 	GetUserQuotaInfo(ctx context.Context) (info *kbfsblock.UserQuotaInfo, err error)
+
+	// GetTLFUsageInfo returns how much the given TLF uses on the
+	// block server. As in kbfsblock.UserQuotaInfo, the
+	// kbfsblock.UsageWrite stats count all referenced blocks,
+	// including the archived ones counted by the
+	// kbfsblock.UsageArchive stats. Local servers may only return
+	// an estimate.
+	GetTLFUsageInfo(ctx context.Context, tlfID tlf.ID) (
+		usage *kbfsblock.UsageStat, err error)
 }
 
 // blockServerLocal is the interface for BlockServer implementations
@@ -1326,7 +1657,8 @@ type BlockServer interface {
 type blockServerLocal interface {
 	BlockServer
 	// getAllRefsForTest returns all the known block references
-	// for the given TLF, and should only be used during testing.
+	// for the given TLF, and should only be used during testing
+	// and by TlfVerifier.
 	getAllRefsForTest(ctx context.Context, tlfID tlf.ID) (
 		map[kbfsblock.ID]blockRefMap, error)
 }
@@ -1366,11 +1698,25 @@ type KeyServer interface {
 		cryptPublicKey kbfscrypto.CryptPublicKey) (
 		kbfscrypto.TLFCryptKeyServerHalf, error)
 
+	// GetTLFCryptKeyServerHalves gets the server-side key halves for
+	// a device given a batch of key half IDs, in the same order,
+	// using as few round trips to the key server as possible.
+	GetTLFCryptKeyServerHalves(ctx context.Context,
+		serverHalfIDs []TLFCryptKeyServerHalfID,
+		cryptPublicKey kbfscrypto.CryptPublicKey) (
+		[]kbfscrypto.TLFCryptKeyServerHalf, error)
+
 	// PutTLFCryptKeyServerHalves stores a server-side key halves for a
 	// set of users and devices.
 	PutTLFCryptKeyServerHalves(ctx context.Context,
 		keyServerHalves UserDeviceKeyServerHalves) error
 
+	// PutTLFCryptKeyServerHalvesBatch stores the server-side key
+	// halves for a set of users and devices across several key
+	// generations in a single round trip to the key server.
+	PutTLFCryptKeyServerHalvesBatch(ctx context.Context,
+		keyServerHalves []UserDeviceKeyServerHalves) error
+
 	// DeleteTLFCryptKeyServerHalf deletes a server-side key half for a
 	// device given the key half ID.
 	DeleteTLFCryptKeyServerHalf(ctx context.Context,
@@ -1414,6 +1760,16 @@ type Observer interface {
 	TlfHandleChange(ctx context.Context, newHandle *TlfHandle)
 }
 
+// FavoritesObserver can be notified when the logged-in user's list
+// of favorites changes.
+type FavoritesObserver interface {
+	// FavoritesChanged announces that favorites were added to or
+	// deleted from the list, either on this device or (as far as
+	// we know) on another one. The new list can be fetched with
+	// KBFSOps.GetFavorites.
+	FavoritesChanged(ctx context.Context)
+}
+
 // Notifier notifies registrants of directory changes
 type Notifier interface {
 	// RegisterForChanges declares that the given Observer wants to
@@ -1423,6 +1779,23 @@ type Notifier interface {
 	// longer wants to subscribe to updates for the given top-level
 	// folders.
 	UnregisterFromChanges(folderBranches []FolderBranch, obs Observer) error
+	// RegisterForFavoritesChanges declares that the given
+	// FavoritesObserver wants to subscribe to changes of the
+	// logged-in user's list of favorites.
+	RegisterForFavoritesChanges(obs FavoritesObserver)
+	// UnregisterFromFavoritesChanges declares that the given
+	// FavoritesObserver no longer wants to subscribe to changes
+	// of the favorites list.
+	UnregisterFromFavoritesChanges(obs FavoritesObserver)
+	// RegisterForSyncStateChanges declares that the given
+	// SyncStateObserver wants to subscribe to changes in the
+	// connection to the servers, and to TLFs catching up on
+	// remote updates.
+	RegisterForSyncStateChanges(obs SyncStateObserver)
+	// UnregisterFromSyncStateChanges declares that the given
+	// SyncStateObserver no longer wants to subscribe to sync
+	// state changes.
+	UnregisterFromSyncStateChanges(obs SyncStateObserver)
 }
 
 // Clock is an interface for getting the current time
@@ -1449,6 +1822,41 @@ type Config interface {
 	codecGetter
 	cryptoPureGetter
 	keyGetterGetter
+	blockCompressionGetter
+	SetBlockCompression(BlockCompressionType)
+	publicBlocksUnencryptedGetter
+	SetPublicBlocksUnencrypted(bool)
+	blockRetryPolicyGetter
+	SetBlockRetryPolicy(BlockRetryPolicy)
+	blockBandwidthLimitsGetter
+	SetBlockBandwidthLimits(BlockBandwidthLimits)
+	serverTLSConfigGetter
+	SetServerTLSConfig(*tls.Config)
+	readAheadConfigGetter
+	SetReadAhead(ReadAheadConfig)
+	// CacheLimits returns the capacities and eviction policy used
+	// the next time the caches are reset.
+	CacheLimits() CacheLimits
+	// SetCacheLimits sets the capacities and eviction policy of
+	// the caches. It takes effect on the next ResetCaches call.
+	SetCacheLimits(CacheLimits)
+	// JournalLimits returns the disk space limits and full policy
+	// used by write journals.
+	JournalLimits() JournalLimits
+	// SetJournalLimits sets the disk space limits and full policy
+	// of write journals. It takes effect when journaling is
+	// enabled.
+	SetJournalLimits(JournalLimits)
+	blockTransferTrackerGetter
+	tlfSyncCacheGetter
+	tlfActivityLogGetter
+	BlockTransferObserver() BlockTransferObserver
+	SetBlockTransferObserver(BlockTransferObserver)
+	// MaxParallelBlockPuts returns the maximum number of blocks
+	// to send to the block server at once for a single sync,
+	// journal flush, or batch of block deletions.
+	MaxParallelBlockPuts() int
+	SetMaxParallelBlockPuts(int)
 	KBFSOps() KBFSOps
 	SetKBFSOps(KBFSOps)
 	KBPKI() KBPKI
@@ -1457,6 +1865,8 @@ type Config interface {
 	SetKeyManager(KeyManager)
 	Reporter() Reporter
 	SetReporter(Reporter)
+	UserAlerter() UserAlerter
+	SetUserAlerter(UserAlerter)
 	MDCache() MDCache
 	SetMDCache(MDCache)
 	KeyCache() KeyCache
@@ -1504,8 +1914,9 @@ type Config interface {
 	// directory in bytes.
 	MaxDirBytes() uint64
 	// DoBackgroundFlushes says whether we should periodically try to
-	// flush dirty files, even without a sync from the user.  Should
-	// be true except for during some testing.
+	// flush dirty files, and put the completed blocks of files being
+	// written ahead of their sync, even without a sync from the user.
+	// Should be true except for during some testing.
 	DoBackgroundFlushes() bool
 	SetDoBackgroundFlushes(bool)
 	// RekeyWithPromptWaitTime indicates how long to wait, after
@@ -1554,6 +1965,21 @@ type Config interface {
 	TLFValidDuration() time.Duration
 	// SetTLFValidDuration sets TLFValidDuration.
 	SetTLFValidDuration(time.Duration)
+	// IdentityCacheTTL is how long the results of user lookups
+	// (e.g., resolving an assertion, or loading a user's keys),
+	// including failed ones, are cached. A zero TTL disables
+	// caching.
+	IdentityCacheTTL() time.Duration
+	// SetIdentityCacheTTL sets IdentityCacheTTL.
+	SetIdentityCacheTTL(time.Duration)
+	// NotificationDebounce is how long observers' notifications
+	// of changes made by other devices are held back, waiting for
+	// more changes, so that a burst of remote revisions results
+	// in a single batch of notifications.  A zero duration
+	// notifies observers right away.
+	NotificationDebounce() time.Duration
+	// SetNotificationDebounce sets NotificationDebounce.
+	SetNotificationDebounce(time.Duration)
 	// Shutdown is called to free config resources.
 	Shutdown(context.Context) error
 	// CheckStateOnShutdown tells the caller whether or not it is safe
@@ -1740,9 +2166,11 @@ type BareRootMetadata interface {
 	// retrieved from an untrusted source, and then the signing
 	// user and key should be validated, either by comparing to
 	// the current device key (using IsLastModifiedBy), or by
-	// checking with KBPKI.
-	IsValidAndSigned(codec kbfscodec.Codec,
-		crypto cryptoPure, extra ExtraMetadata) error
+	// checking with KBPKI. The writers and readers of a team TLF
+	// are looked up with teamGetter.
+	IsValidAndSigned(ctx context.Context, codec kbfscodec.Codec,
+		crypto cryptoPure, teamGetter teamInfoGetter,
+		extra ExtraMetadata) error
 	// IsLastModifiedBy verifies that the BareRootMetadata is
 	// written by the given user and device (identified by the KID
 	// of the device verifying key), and returns an error if not.
@@ -0,0 +1,282 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// JournalFullPolicy says what a write does when it can't be put in
+// the journal without going over a journal byte limit.
+type JournalFullPolicy byte
+
+const (
+	// JournalFullWait makes the write wait for background flushes
+	// to free up space, slowing writes down as the limit nears,
+	// and fail with ErrDiskLimitTimeout if no space frees up in
+	// time.
+	JournalFullWait JournalFullPolicy = 0
+	// JournalFullFail makes the write fail right away with
+	// ErrJournalFull.
+	JournalFullFail JournalFullPolicy = 1
+)
+
+func (p JournalFullPolicy) String() string {
+	switch p {
+	case JournalFullWait:
+		return "wait"
+	case JournalFullFail:
+		return "fail"
+	default:
+		return fmt.Sprintf("JournalFullPolicy(%d)", p)
+	}
+}
+
+// ParseJournalFullPolicy parses the string representation of a
+// JournalFullPolicy, as returned by its String method.
+func ParseJournalFullPolicy(s string) (JournalFullPolicy, error) {
+	switch s {
+	case "", "wait":
+		return JournalFullWait, nil
+	case "fail":
+		return JournalFullFail, nil
+	default:
+		return JournalFullWait, errors.Errorf(
+			"Unknown journal full policy %q", s)
+	}
+}
+
+// JournalLimits holds how much local disk space the write journals
+// may use, and what happens to writes once they've used it up.
+type JournalLimits struct {
+	// ByteLimit is the most bytes all journals together may
+	// store.
+	ByteLimit int64
+	// ByteLimitFrac is the largest fraction of the free disk
+	// space (plus what the journals already use) that all
+	// journals together may store.
+	ByteLimitFrac float64
+	// TLFByteLimit, if positive, is the most bytes the journal of
+	// any single TLF may store, so that one busy TLF can't starve
+	// the others.
+	TLFByteLimit int64
+	// FullPolicy is what writes do once a limit is reached.
+	FullPolicy JournalFullPolicy
+}
+
+const (
+	defaultJournalByteLimit int64 = 50 * 1024 * 1024 * 1024
+	// Cap journal usage to a quarter of the free space.
+	defaultJournalByteLimitFrac = 0.25
+)
+
+// DefaultJournalLimits returns the journal limits used unless others
+// are set explicitly.
+func DefaultJournalLimits() JournalLimits {
+	return JournalLimits{
+		ByteLimit:     defaultJournalByteLimit,
+		ByteLimitFrac: defaultJournalByteLimitFrac,
+		FullPolicy:    JournalFullWait,
+	}
+}
+
+// ErrJournalFull is returned when a block can't be put in a journal
+// without going over its byte limit, and the journal full policy is
+// JournalFullFail.
+type ErrJournalFull struct {
+	requestedBytes int64
+	availableBytes int64
+}
+
+func (e ErrJournalFull) Error() string {
+	return fmt.Sprintf("Journal is full; requested %d bytes, %d bytes available",
+		e.requestedBytes, e.availableBytes)
+}
+
+// tlfDiskLimiter applies a per-TLF byte limit on top of the
+// diskLimiter shared by all journals.
+type tlfDiskLimiter struct {
+	tlfLimiter    semaphoreDiskLimiter
+	globalLimiter diskLimiter
+}
+
+var _ diskLimiter = tlfDiskLimiter{}
+
+func newTLFDiskLimiter(
+	byteLimit int64, globalLimiter diskLimiter) tlfDiskLimiter {
+	return tlfDiskLimiter{newSemaphoreDiskLimiter(byteLimit), globalLimiter}
+}
+
+func (tdl tlfDiskLimiter) onJournalEnable(
+	ctx context.Context, journalBytes, journalFiles int64) (
+	availableBytes, availableFiles int64) {
+	tdl.tlfLimiter.onJournalEnable(ctx, journalBytes, journalFiles)
+	return tdl.globalLimiter.onJournalEnable(ctx, journalBytes, journalFiles)
+}
+
+func (tdl tlfDiskLimiter) onJournalDisable(
+	ctx context.Context, journalBytes, journalFiles int64) {
+	tdl.tlfLimiter.onJournalDisable(ctx, journalBytes, journalFiles)
+	tdl.globalLimiter.onJournalDisable(ctx, journalBytes, journalFiles)
+}
+
+func (tdl tlfDiskLimiter) beforeBlockPut(
+	ctx context.Context, blockBytes, blockFiles int64) (
+	availableBytes, availableFiles int64, err error) {
+	availableBytes, availableFiles, err = tdl.tlfLimiter.beforeBlockPut(
+		ctx, blockBytes, blockFiles)
+	if err != nil {
+		return availableBytes, availableFiles, err
+	}
+
+	globalBytes, globalFiles, err := tdl.globalLimiter.beforeBlockPut(
+		ctx, blockBytes, blockFiles)
+	if err != nil {
+		// Give back what the TLF limiter handed out.
+		tdl.tlfLimiter.afterBlockPut(ctx, blockBytes, blockFiles, false)
+	}
+	if globalBytes < availableBytes {
+		availableBytes = globalBytes
+	}
+	if globalFiles < availableFiles {
+		availableFiles = globalFiles
+	}
+	return availableBytes, availableFiles, err
+}
+
+func (tdl tlfDiskLimiter) afterBlockPut(
+	ctx context.Context, blockBytes, blockFiles int64, putData bool) {
+	tdl.tlfLimiter.afterBlockPut(ctx, blockBytes, blockFiles, putData)
+	tdl.globalLimiter.afterBlockPut(ctx, blockBytes, blockFiles, putData)
+}
+
+func (tdl tlfDiskLimiter) onBlockDelete(
+	ctx context.Context, blockBytes, blockFiles int64) {
+	tdl.tlfLimiter.onBlockDelete(ctx, blockBytes, blockFiles)
+	tdl.globalLimiter.onBlockDelete(ctx, blockBytes, blockFiles)
+}
+
+func (tdl tlfDiskLimiter) getStatus() interface{} {
+	return tdl.globalLimiter.getStatus()
+}
+
+// JournalFlushPriority orders the background flushes of different
+// TLF journals: while a journal is flushing, journals with a lower
+// priority hold off on flushing.
+type JournalFlushPriority int
+
+const (
+	// JournalFlushPriorityLow journals flush only when no other
+	// journal is flushing.
+	JournalFlushPriorityLow JournalFlushPriority = -1
+	// JournalFlushPriorityNormal is the default.
+	JournalFlushPriorityNormal JournalFlushPriority = 0
+	// JournalFlushPriorityHigh journals never wait for other
+	// journals to flush.
+	JournalFlushPriorityHigh JournalFlushPriority = 1
+)
+
+func (p JournalFlushPriority) String() string {
+	switch p {
+	case JournalFlushPriorityLow:
+		return "low"
+	case JournalFlushPriorityNormal:
+		return "normal"
+	case JournalFlushPriorityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("JournalFlushPriority(%d)", p)
+	}
+}
+
+// journalFlushScheduler keeps track of which journals are flushing
+// in the background, so that lower-priority journals can wait for
+// higher-priority ones to finish.
+type journalFlushScheduler struct {
+	lock       sync.Mutex
+	priorities map[tlf.ID]JournalFlushPriority
+	flushing   map[JournalFlushPriority]int
+	// changeCh is closed and replaced whenever a flush finishes.
+	changeCh chan struct{}
+}
+
+func newJournalFlushScheduler() *journalFlushScheduler {
+	return &journalFlushScheduler{
+		priorities: make(map[tlf.ID]JournalFlushPriority),
+		flushing:   make(map[JournalFlushPriority]int),
+		changeCh:   make(chan struct{}),
+	}
+}
+
+func (s *journalFlushScheduler) setPriority(
+	tlfID tlf.ID, p JournalFlushPriority) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if p == JournalFlushPriorityNormal {
+		delete(s.priorities, tlfID)
+	} else {
+		s.priorities[tlfID] = p
+	}
+	close(s.changeCh)
+	s.changeCh = make(chan struct{})
+}
+
+func (s *journalFlushScheduler) getPriority(
+	tlfID tlf.ID) JournalFlushPriority {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.priorities[tlfID]
+}
+
+// tryStartFlush marks a flush of tlfID as started, unless a journal
+// with a higher priority is flushing, in which case it returns a
+// channel that is closed when that may have changed.
+func (s *journalFlushScheduler) tryStartFlush(tlfID tlf.ID) (
+	p JournalFlushPriority, waitCh <-chan struct{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p = s.priorities[tlfID]
+	for q, n := range s.flushing {
+		if q > p && n > 0 {
+			return p, s.changeCh
+		}
+	}
+	s.flushing[p]++
+	return p, nil
+}
+
+// startFlush blocks until no journal with a higher priority than
+// tlfID's is flushing, and then marks a flush of tlfID as started.
+// The caller must call the returned function once the flush is done.
+func (s *journalFlushScheduler) startFlush(
+	ctx context.Context, tlfID tlf.ID) (done func(), err error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	for {
+		p, waitCh := s.tryStartFlush(tlfID)
+		if waitCh == nil {
+			return func() { s.finishFlush(p) }, nil
+		}
+		select {
+		case <-waitCh:
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		}
+	}
+}
+
+func (s *journalFlushScheduler) finishFlush(p JournalFlushPriority) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.flushing[p]--
+	close(s.changeCh)
+	s.changeCh = make(chan struct{})
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestTLFDiskLimiter(t *testing.T) {
+	ctx := context.Background()
+	global := newSemaphoreDiskLimiter(100)
+	tdl1 := newTLFDiskLimiter(10, global)
+	tdl2 := newTLFDiskLimiter(10, global)
+
+	tdl1.onJournalEnable(ctx, 8, 0)
+	availableBytes, _, err := tdl1.beforeBlockPut(ctx, 2, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), availableBytes)
+	tdl1.afterBlockPut(ctx, 2, 1, true)
+
+	// The first TLF is full, but the second one isn't.
+	expiredCtx, cancel := context.WithTimeout(ctx, 0)
+	defer cancel()
+	_, _, err = tdl1.beforeBlockPut(expiredCtx, 1, 1)
+	require.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	availableBytes, _, err = tdl2.beforeBlockPut(ctx, 5, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), availableBytes)
+	tdl2.afterBlockPut(ctx, 5, 1, true)
+	require.Equal(t, int64(85), global.byteSemaphore.Count())
+
+	// Failing the global limit gives the TLF bytes back.
+	global.onJournalEnable(ctx, 85, 0)
+	_, _, err = tdl2.beforeBlockPut(expiredCtx, 1, 1)
+	require.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	require.Equal(t, int64(5), tdl2.tlfLimiter.byteSemaphore.Count())
+
+	tdl1.onBlockDelete(ctx, 10, 0)
+	require.Equal(t, int64(10), tdl1.tlfLimiter.byteSemaphore.Count())
+	require.Equal(t, int64(10), global.byteSemaphore.Count())
+}
+
+func TestJournalFlushScheduler(t *testing.T) {
+	ctx := context.Background()
+	s := newJournalFlushScheduler()
+	lowID := tlf.FakeID(1, false)
+	normalID := tlf.FakeID(2, false)
+	highID := tlf.FakeID(3, false)
+	s.setPriority(lowID, JournalFlushPriorityLow)
+	s.setPriority(highID, JournalFlushPriorityHigh)
+	require.Equal(t, JournalFlushPriorityNormal, s.getPriority(normalID))
+
+	doneNormal, err := s.startFlush(ctx, normalID)
+	require.NoError(t, err)
+
+	// A low-priority flush waits for the normal one...
+	lowStarted := make(chan func())
+	go func() {
+		doneLow, err := s.startFlush(ctx, lowID)
+		if err != nil {
+			close(lowStarted)
+			return
+		}
+		lowStarted <- doneLow
+	}()
+
+	// ...but a high-priority one doesn't.
+	doneHigh, err := s.startFlush(ctx, highID)
+	require.NoError(t, err)
+	doneHigh()
+
+	select {
+	case <-lowStarted:
+		t.Fatal("Low-priority flush started early")
+	default:
+	}
+
+	doneNormal()
+	doneLow, ok := <-lowStarted
+	require.True(t, ok)
+	doneLow()
+
+	// A canceled wait returns an error.
+	doneHigh, err = s.startFlush(ctx, highID)
+	require.NoError(t, err)
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = s.startFlush(canceledCtx, normalID)
+	require.Equal(t, context.Canceled, errors.Cause(err))
+	doneHigh()
+}
+
+func TestParseJournalFullPolicy(t *testing.T) {
+	for _, p := range []JournalFullPolicy{JournalFullWait, JournalFullFail} {
+		parsed, err := ParseJournalFullPolicy(p.String())
+		require.NoError(t, err)
+		require.Equal(t, p, parsed)
+	}
+	_, err := ParseJournalFullPolicy("block")
+	require.Error(t, err)
+}
@@ -50,9 +50,19 @@ type journalServerConfig struct {
 	// EnableAutoSetByUser means the user has explicitly set the
 	// value of EnableAuto (after this field was added).
 	EnableAutoSetByUser bool
+
+	// DisabledTLFs holds the IDs of the TLFs whose journals the
+	// user has turned off, so that writes to them go straight to
+	// the server even when EnableAuto is on.
+	DisabledTLFs map[string]bool `json:",omitempty"`
+}
+
+func (jsc journalServerConfig) isTLFDisabled(tlfID tlf.ID) bool {
+	return jsc.DisabledTLFs[tlfID.String()]
 }
 
-func (jsc journalServerConfig) getEnableAuto(currentUID keybase1.UID) (
+func (jsc journalServerConfig) getEnableAuto(
+	currentUID keybase1.UID, enableAutoByDefault bool) (
 	enableAuto, enableAutoSetByUser bool) {
 	// If EnableAuto is true, the user has explicitly set its value.
 	if jsc.EnableAuto {
@@ -69,9 +79,9 @@ func (jsc journalServerConfig) getEnableAuto(currentUID keybase1.UID) (
 	// Otherwise, either the user turned on journaling and then
 	// turned it off before that field was added, or the user
 	// hasn't touched the field. In either case, determine the
-	// value based on whether the current UID is in the
-	// journaling beta list.
-	return journalingBetaList[currentUID], false
+	// value based on whether write-back is on by default, or the
+	// current UID is in the journaling beta list.
+	return enableAutoByDefault || journalingBetaList[currentUID], false
 }
 
 // JournalServerStatus represents the overall status of the
@@ -93,6 +103,9 @@ type JournalServerStatus struct {
 	UnflushedBytes    int64
 	UnflushedPaths    []string
 	DiskLimiterStatus interface{}
+	// TLFs holds the status of each enabled journal, keyed by
+	// TLF ID. Their UnflushedPaths aren't filled in.
+	TLFs map[string]TLFJournalStatus `json:",omitempty"`
 }
 
 // branchChangeListener describes a caller that will get updates via
@@ -188,7 +201,8 @@ type JournalServer struct {
 	onBranchChange          branchChangeListener
 	onMDFlush               mdFlushListener
 
-	diskLimiter diskLimiter
+	diskLimiter    diskLimiter
+	flushScheduler *journalFlushScheduler
 
 	// Protects all fields below.
 	lock                sync.RWMutex
@@ -198,6 +212,9 @@ type JournalServer struct {
 	dirtyOps            uint
 	dirtyOpsDone        *sync.Cond
 	serverConfig        journalServerConfig
+	// enableAutoByDefault, if true, turns on auto-journaling
+	// unless the user has explicitly turned it off.
+	enableAutoByDefault bool
 }
 
 func makeJournalServer(
@@ -221,6 +238,7 @@ func makeJournalServer(
 		onMDFlush:               onMDFlush,
 		tlfJournals:             make(map[tlf.ID]*tlfJournal),
 		diskLimiter:             diskLimiter,
+		flushScheduler:          newJournalFlushScheduler(),
 	}
 	jServer.dirtyOpsDone = sync.NewCond(&jServer.lock)
 	return &jServer
@@ -273,18 +291,27 @@ func (j *JournalServer) tlfJournalPathLocked(tlfID tlf.ID) string {
 
 func (j *JournalServer) getEnableAutoLocked() (
 	enableAuto, enableAutoSetByUser bool) {
-	return j.serverConfig.getEnableAuto(j.currentUID)
+	return j.serverConfig.getEnableAuto(j.currentUID, j.enableAutoByDefault)
 }
 
 func (j *JournalServer) getTLFJournal(tlfID tlf.ID) (*tlfJournal, bool) {
-	getJournalFn := func() (*tlfJournal, bool, bool, bool) {
+	getJournalFn := func() (*tlfJournal, bool, bool, bool, bool) {
 		j.lock.RLock()
 		defer j.lock.RUnlock()
 		tlfJournal, ok := j.tlfJournals[tlfID]
 		enableAuto, enableAutoSetByUser := j.getEnableAutoLocked()
-		return tlfJournal, enableAuto, enableAutoSetByUser, ok
+		tlfDisabled := j.serverConfig.isTLFDisabled(tlfID)
+		return tlfJournal, enableAuto, enableAutoSetByUser, tlfDisabled, ok
+	}
+	tlfJournal, enableAuto, enableAutoSetByUser, tlfDisabled, ok :=
+		getJournalFn()
+	if !ok && enableAuto && (tlfDisabled ||
+		j.config.tlfSyncCache().mode(tlfID) == TlfSyncModeExcluded) {
+		// Writes to excluded TLFs, or to TLFs whose journal
+		// the user turned off, go straight to the servers,
+		// unless a journal was explicitly enabled for them.
+		return nil, false
 	}
-	tlfJournal, enableAuto, enableAutoSetByUser, ok := getJournalFn()
 	if !ok && enableAuto {
 		ctx := context.TODO() // plumb through from callers
 		j.log.CDebugf(ctx, "Enabling a new journal for %s (enableAuto=%t, set by user=%t)",
@@ -294,7 +321,7 @@ func (j *JournalServer) getTLFJournal(tlfID tlf.ID) (*tlfJournal, bool) {
 			j.log.CWarningf(ctx, "Couldn't enable journal for %s: %+v", tlfID, err)
 			return nil, false
 		}
-		tlfJournal, _, _, ok = getJournalFn()
+		tlfJournal, _, _, _, ok = getJournalFn()
 	}
 	return tlfJournal, ok
 }
@@ -431,6 +458,17 @@ func (j *JournalServer) EnableExistingJournals(
 				tlfID, err)
 			continue
 		}
+
+		if j.serverConfig.isTLFDisabled(tlfID) {
+			// The journal was turned off by the user, so
+			// keep it off, unless it still has something
+			// to flush.
+			_, err := j.tlfJournals[tlfID].disable()
+			if err != nil {
+				j.log.CWarningf(ctx, "Couldn't keep journal "+
+					"for %s disabled: %+v", tlfID, err)
+			}
+		}
 	}
 
 	enableSucceeded = true
@@ -484,7 +522,8 @@ func (j *JournalServer) enableLocked(
 	tlfJournal, err := makeTLFJournal(
 		ctx, j.currentUID, j.currentVerifyingKey, tlfDir,
 		tlfID, tlfJournalConfigAdapter{j.config}, j.delegateBlockServer,
-		bws, nil, j.onBranchChange, j.onMDFlush, j.diskLimiter)
+		bws, nil, j.onBranchChange, j.onMDFlush, j.diskLimiter,
+		j.flushScheduler)
 	if err != nil {
 		return err
 	}
@@ -517,6 +556,21 @@ func (j *JournalServer) EnableAuto(ctx context.Context) error {
 	return j.writeConfig()
 }
 
+// SetEnableAutoByDefault sets whether the write journal is turned on
+// for all TLFs when the user hasn't explicitly called EnableAuto or
+// DisableAuto. With journaling on, writes return once they're in the
+// local journal, and are flushed to the server in the background
+// (i.e., the journal acts as a write-back cache). Unlike EnableAuto,
+// this isn't persisted.
+func (j *JournalServer) SetEnableAutoByDefault(
+	ctx context.Context, enableAutoByDefault bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.log.CDebugf(ctx, "Setting auto-journaling default to %t",
+		enableAutoByDefault)
+	j.enableAutoByDefault = enableAutoByDefault
+}
+
 // DisableAuto turns off automatic write journal for any
 // newly-accessed TLFs.  Existing journaled TLFs need to be disabled
 // manually.
@@ -566,6 +620,17 @@ func (j *JournalServer) PauseBackgroundWork(ctx context.Context, tlfID tlf.ID) {
 		tlfID)
 }
 
+// SetFlushPriority sets the priority with which the journal for the
+// given TLF flushes in the background, relative to the journals of
+// other TLFs. It applies whether or not that journal is currently
+// enabled.
+func (j *JournalServer) SetFlushPriority(
+	ctx context.Context, tlfID tlf.ID, priority JournalFlushPriority) {
+	j.log.CDebugf(ctx, "Setting flush priority of %s to %s",
+		tlfID, priority)
+	j.flushScheduler.setPriority(tlfID, priority)
+}
+
 // ResumeBackgroundWork resumes the background work goroutine, if it's
 // not already resumed.
 func (j *JournalServer) ResumeBackgroundWork(ctx context.Context, tlfID tlf.ID) {
@@ -649,6 +714,86 @@ func (j *JournalServer) Disable(ctx context.Context, tlfID tlf.ID) (
 	return wasEnabled, nil
 }
 
+// SetTLFJournalEnabled turns the write journal for the given TLF on
+// or off, persistently.  Before turning it off, the journal is
+// flushed, and from then on writes to the TLF go straight to the
+// server (i.e., write-through), even if auto-journaling is on.
+// Turning it back on makes the TLF's writes go through the journal
+// again (i.e., write-back).
+func (j *JournalServer) SetTLFJournalEnabled(
+	ctx context.Context, tlfID tlf.ID, enabled bool) (err error) {
+	j.log.CDebugf(ctx, "Setting journal enabled for %s to %t",
+		tlfID, enabled)
+	defer func() {
+		if err != nil {
+			j.deferLog.CDebugf(ctx,
+				"Error when setting journal enabled for %s: %+v",
+				tlfID, err)
+		}
+	}()
+
+	if enabled {
+		j.lock.Lock()
+		defer j.lock.Unlock()
+		err := j.setTLFDisabledLocked(tlfID, false)
+		if err != nil {
+			return err
+		}
+		return j.enableLocked(
+			ctx, tlfID, TLFJournalBackgroundWorkEnabled, false)
+	}
+
+	// Mark the TLF disabled before flushing, so that nothing can
+	// turn its journal back on in the meantime, and undo that if
+	// the journal can't be turned off.
+	wasDisabled, err := func() (bool, error) {
+		j.lock.Lock()
+		defer j.lock.Unlock()
+		wasDisabled := j.serverConfig.isTLFDisabled(tlfID)
+		return wasDisabled, j.setTLFDisabledLocked(tlfID, true)
+	}()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil || wasDisabled {
+			return
+		}
+		j.lock.Lock()
+		defer j.lock.Unlock()
+		rollbackErr := j.setTLFDisabledLocked(tlfID, false)
+		if rollbackErr != nil {
+			j.log.CWarningf(ctx, "Couldn't re-enable the journal "+
+				"for %s: %+v", tlfID, rollbackErr)
+		}
+	}()
+
+	err = j.Flush(ctx, tlfID)
+	if err != nil {
+		return err
+	}
+	_, err = j.Disable(ctx, tlfID)
+	return err
+}
+
+func (j *JournalServer) setTLFDisabledLocked(
+	tlfID tlf.ID, disabled bool) error {
+	if j.serverConfig.isTLFDisabled(tlfID) == disabled {
+		// Nothing to do.
+		return nil
+	}
+
+	if disabled {
+		if j.serverConfig.DisabledTLFs == nil {
+			j.serverConfig.DisabledTLFs = make(map[string]bool)
+		}
+		j.serverConfig.DisabledTLFs[tlfID.String()] = true
+	} else {
+		delete(j.serverConfig.DisabledTLFs, tlfID.String())
+	}
+	return j.writeConfig()
+}
+
 func (j *JournalServer) blockCache() journalBlockCache {
 	return journalBlockCache{j, j.delegateBlockCache}
 }
@@ -675,17 +820,19 @@ func (j *JournalServer) Status(
 	defer j.lock.RUnlock()
 	var totalStoredBytes, totalStoredFiles, totalUnflushedBytes int64
 	tlfIDs := make([]tlf.ID, 0, len(j.tlfJournals))
+	tlfStatuses := make(map[string]TLFJournalStatus, len(j.tlfJournals))
 	for _, tlfJournal := range j.tlfJournals {
-		storedBytes, storedFiles, unflushedBytes, err :=
-			tlfJournal.getByteCounts()
+		tlfStatus, err := tlfJournal.getJournalStatus()
 		if err != nil {
 			j.log.CWarningf(ctx,
-				"Couldn't calculate stored bytes/stored files/unflushed bytes for %s: %+v",
+				"Couldn't get journal status for %s: %+v",
 				tlfJournal.tlfID, err)
+		} else {
+			tlfStatuses[tlfJournal.tlfID.String()] = tlfStatus
 		}
-		totalStoredBytes += storedBytes
-		totalStoredFiles += storedFiles
-		totalUnflushedBytes += unflushedBytes
+		totalStoredBytes += tlfStatus.StoredBytes
+		totalStoredFiles += tlfStatus.StoredFiles
+		totalUnflushedBytes += tlfStatus.UnflushedBytes
 		tlfIDs = append(tlfIDs, tlfJournal.tlfID)
 	}
 	enableAuto, enableAutoSetByUser := j.getEnableAutoLocked()
@@ -701,6 +848,7 @@ func (j *JournalServer) Status(
 		StoredFiles:         totalStoredFiles,
 		UnflushedBytes:      totalUnflushedBytes,
 		DiskLimiterStatus:   j.diskLimiter.getStatus(),
+		TLFs:                tlfStatuses,
 	}, tlfIDs
 }
 
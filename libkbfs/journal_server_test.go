@@ -398,6 +398,40 @@ func TestJournalServerMultiUser(t *testing.T) {
 	require.Equal(t, uid2, head.LastModifyingWriter())
 }
 
+func TestJournalServerEnableAutoByDefault(t *testing.T) {
+	tempdir, ctx, cancel, config, jServer := setupJournalServerTest(t)
+	defer teardownJournalServerTest(t, tempdir, ctx, cancel, config)
+
+	jServer.SetEnableAutoByDefault(ctx, true)
+	status, _ := jServer.Status(ctx)
+	require.True(t, status.EnableAuto)
+	require.False(t, status.EnableAutoSetByUser)
+
+	h, err := ParseTlfHandle(ctx, config.KBPKI(), "test_user1", false)
+	require.NoError(t, err)
+	uid := h.ResolvedWriters()[0]
+
+	// Access a TLF, which should create a journal automatically.
+	tlfID := tlf.FakeID(2, false)
+	bCtx := kbfsblock.MakeFirstContext(uid)
+	data := []byte{1, 2, 3, 4}
+	bID, err := kbfsblock.MakePermanentID(data)
+	require.NoError(t, err)
+	serverHalf, err := kbfscrypto.MakeRandomBlockCryptKeyServerHalf()
+	require.NoError(t, err)
+	err = config.BlockServer().Put(ctx, tlfID, bID, bCtx, data, serverHalf)
+	require.NoError(t, err)
+	status, _ = jServer.Status(ctx)
+	require.Equal(t, 1, status.JournalCount)
+
+	// The user turning it off wins over the default.
+	err = jServer.DisableAuto(ctx)
+	require.NoError(t, err)
+	status, _ = jServer.Status(ctx)
+	require.False(t, status.EnableAuto)
+	require.True(t, status.EnableAutoSetByUser)
+}
+
 func TestJournalServerEnableAuto(t *testing.T) {
 	tempdir, ctx, cancel, config, jServer := setupJournalServerTest(t)
 	defer teardownJournalServerTest(t, tempdir, ctx, cancel, config)
@@ -436,6 +470,15 @@ func TestJournalServerEnableAuto(t *testing.T) {
 	err = jServer.Flush(ctx, tlfID)
 	require.NoError(t, err)
 
+	status, _ = jServer.Status(ctx)
+	tlfStatus, ok := status.TLFs[tlfID.String()]
+	require.True(t, ok)
+	require.Zero(t, tlfStatus.BlockOpCount)
+	require.Zero(t, tlfStatus.MDOpCount)
+	require.Zero(t, tlfStatus.UnflushedBytes)
+	require.False(t, tlfStatus.OnConflictBranch)
+	require.False(t, tlfStatus.LastFlushTime.IsZero())
+
 	// Simulate a restart.
 	jServer = makeJournalServer(
 		config, jServer.log, tempdir, jServer.delegateBlockCache,
@@ -453,3 +496,59 @@ func TestJournalServerEnableAuto(t *testing.T) {
 	require.Equal(t, 1, status.JournalCount)
 	require.Len(t, tlfIDs, 1)
 }
+
+func TestJournalServerSetTLFJournalEnabled(t *testing.T) {
+	tempdir, ctx, cancel, config, jServer := setupJournalServerTest(t)
+	defer teardownJournalServerTest(t, tempdir, ctx, cancel, config)
+
+	tlfID := tlf.FakeID(2, false)
+	err := jServer.EnableAuto(ctx)
+	require.NoError(t, err)
+
+	h, err := ParseTlfHandle(ctx, config.KBPKI(), "test_user1", false)
+	require.NoError(t, err)
+	uid := h.ResolvedWriters()[0]
+
+	// Put a block, which goes into an automatically-created
+	// journal.
+	bCtx := kbfsblock.MakeFirstContext(uid)
+	data := []byte{1, 2, 3, 4}
+	bID, err := kbfsblock.MakePermanentID(data)
+	require.NoError(t, err)
+	serverHalf, err := kbfscrypto.MakeRandomBlockCryptKeyServerHalf()
+	require.NoError(t, err)
+	err = config.BlockServer().Put(ctx, tlfID, bID, bCtx, data, serverHalf)
+	require.NoError(t, err)
+	_, err = jServer.JournalStatus(tlfID)
+	require.NoError(t, err)
+
+	// Turning the journal off flushes it first.
+	err = jServer.SetTLFJournalEnabled(ctx, tlfID, false)
+	require.NoError(t, err)
+	_, err = jServer.JournalStatus(tlfID)
+	require.Error(t, err)
+	_, _, err = jServer.delegateBlockServer.Get(ctx, tlfID, bID, bCtx)
+	require.NoError(t, err)
+
+	// The journal stays off across a restart, even with
+	// auto-journaling on.
+	jServer = makeJournalServer(
+		config, jServer.log, tempdir, jServer.delegateBlockCache,
+		jServer.delegateDirtyBlockCache,
+		jServer.delegateBlockServer, jServer.delegateMDOps, nil, nil,
+		jServer.diskLimiter)
+	uid, verifyingKey, err :=
+		getCurrentUIDAndVerifyingKey(ctx, config.KBPKI())
+	require.NoError(t, err)
+	err = jServer.EnableExistingJournals(
+		ctx, uid, verifyingKey, TLFJournalBackgroundWorkPaused)
+	require.NoError(t, err)
+	_, err = jServer.JournalStatus(tlfID)
+	require.Error(t, err)
+
+	// Turning it back on works as usual.
+	err = jServer.SetTLFJournalEnabled(ctx, tlfID, true)
+	require.NoError(t, err)
+	_, err = jServer.JournalStatus(tlfID)
+	require.NoError(t, err)
+}
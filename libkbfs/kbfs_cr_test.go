@@ -304,6 +304,22 @@ func TestUnmergedAfterRestart(t *testing.T) {
 	checkStatus(t, ctx, kbfsOps2, false, userName2, nil,
 		rootNode2.GetFolderBranch(), "Node 2")
 
+	// User 1's sync is the only revision on its unmerged branch.
+	history, err := kbfsOps1.GetUnmergedHistory(
+		ctx, rootNode1.GetFolderBranch())
+	require.NoError(t, err)
+	require.NotEqual(t, "", history.BranchID)
+	require.Len(t, history.Updates, 1)
+	var opStrs []string
+	for _, op := range history.Updates[0].Ops {
+		opStrs = append(opStrs, op.Op)
+	}
+	require.Contains(t, opStrs, "sync [{off=0, len=1}]")
+	history, err = kbfsOps2.GetUnmergedHistory(
+		ctx, rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+	require.Len(t, history.Updates, 0)
+
 	// now re-login the users, and make sure 1 can see the changes,
 	// but 2 can't
 	config1B := ConfigAsUser(config1, userName1)
@@ -387,6 +403,103 @@ func TestUnmergedAfterRestart(t *testing.T) {
 
 // Tests that multiple users can write to the same file sequentially
 // without any problems.
+// Tests that when conflict resolution gives up on an unmerged branch,
+// the branch can still be read as a conflicted copy of the TLF until
+// it's cleared.
+func TestUnstageAfterFailedResolutionKeepsConflictedCopy(t *testing.T) {
+	// simulate two users
+	var userName1, userName2 libkb.NormalizedUsername = "u1", "u2"
+	config1, _, ctx, cancel := kbfsOpsConcurInit(t, userName1, userName2)
+	defer kbfsConcurTestShutdown(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, userName2)
+	defer CheckConfigAndShutdown(ctx, t, config2)
+
+	name := userName1.String() + "," + userName2.String()
+
+	// user1 creates a file in a shared dir
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, false)
+
+	kbfsOps1 := config1.KBFSOps()
+	fileNode1, _, err := kbfsOps1.CreateFile(ctx, rootNode1, "a", false, NoExcl)
+	require.NoError(t, err)
+
+	_, err = DisableUpdatesForTesting(config1, rootNode1.GetFolderBranch())
+	require.NoError(t, err)
+	DisableCRForTesting(config1, rootNode1.GetFolderBranch())
+
+	// then user2 writes to the file
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, name, false)
+
+	kbfsOps2 := config2.KBFSOps()
+	fileNode2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	data2 := []byte{2}
+	err = kbfsOps2.Write(ctx, fileNode2, data2, 0)
+	require.NoError(t, err)
+	err = kbfsOps2.Sync(ctx, fileNode2)
+	require.NoError(t, err)
+
+	// user1's conflicting write makes it unmerged.
+	data1 := []byte{1}
+	err = kbfsOps1.Write(ctx, fileNode1, data1, 0)
+	require.NoError(t, err)
+	err = kbfsOps1.Sync(ctx, fileNode1)
+	require.NoError(t, err)
+	checkStatus(t, ctx, kbfsOps1, true, userName1, nil,
+		rootNode1.GetFolderBranch(), "Node 1")
+
+	// Give up on the unmerged branch, as conflict resolution does
+	// after an unrecoverable failure.
+	ops1 := getOps(config1, rootNode1.GetFolderBranch().Tlf)
+	lState := makeFBOLockState()
+	err = ops1.unstageAfterFailedResolution(ctx, lState)
+	require.NoError(t, err)
+	checkStatus(t, ctx, kbfsOps1, false, userName1, nil,
+		rootNode1.GetFolderBranch(), "Node 1 (after unstage)")
+	readAndCompareData(t, config1, ctx, name, data2, userName2)
+
+	// The unmerged branch is listed as a conflicted copy.
+	info, err := tlf.NewHandleExtension(
+		tlf.HandleExtensionConflict, 1, "", config1.Clock().Now())
+	require.NoError(t, err)
+	conflictName := name + tlf.HandleExtensionSep + info.String()
+	favs, err := kbfsOps1.GetFavorites(ctx)
+	require.NoError(t, err)
+	conflictFav := Favorite{Name: conflictName, Public: false}
+	require.Contains(t, favs, conflictFav)
+
+	// It shows user1's write, and can't be written to.
+	h, err := ParseTlfHandle(ctx, config1.KBPKI(), conflictName, false)
+	require.NoError(t, err)
+	conflictRoot, _, err := kbfsOps1.GetRootNode(ctx, h, MasterBranch)
+	require.NoError(t, err)
+	require.NotEqual(t, rootNode1.GetFolderBranch(),
+		conflictRoot.GetFolderBranch())
+	conflictFile, _, err := kbfsOps1.Lookup(ctx, conflictRoot, "a")
+	require.NoError(t, err)
+	data := make([]byte, 1)
+	_, err = kbfsOps1.Read(ctx, conflictFile, data, 0)
+	require.NoError(t, err)
+	require.Equal(t, data1, data)
+	err = kbfsOps1.Write(ctx, conflictFile, data2, 0)
+	require.IsType(t, WriteUnsupportedError{}, err)
+	_, _, err = kbfsOps1.CreateFile(ctx, conflictRoot, "b", false, NoExcl)
+	require.IsType(t, WriteUnsupportedError{}, err)
+
+	// Clearing it releases its blocks and drops it from the list.
+	err = kbfsOps1.DeleteFavorite(ctx, conflictFav)
+	require.NoError(t, err)
+	favs, err = kbfsOps1.GetFavorites(ctx)
+	require.NoError(t, err)
+	require.NotContains(t, favs, conflictFav)
+
+	err = kbfsOps1.SyncFromServerForTesting(ctx, rootNode1.GetFolderBranch())
+	require.NoError(t, err)
+	err = kbfsOps2.SyncFromServerForTesting(ctx, rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+}
+
 func TestMultiUserWrite(t *testing.T) {
 	// simulate two users
 	var userName1, userName2 libkb.NormalizedUsername = "u1", "u2"
@@ -730,6 +843,99 @@ func TestBasicCRFileConflict(t *testing.T) {
 	}
 
 	require.Equal(t, children1, children2)
+
+	// The device that resolved the conflict lists the copy in its
+	// status.
+	status, _, err := kbfsOps2.FolderStatus(ctx, rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+	tlfPath := "/keybase/private/" + name
+	require.Equal(t, []string{
+		tlfPath + "/a/b -> " + tlfPath + "/a/" + expectedChildren[1],
+	}, status.ConflictedCopies)
+}
+
+// Tests that the file copied for a conflict, and the unembedded
+// block changes of the resolution, never carry a data version newer
+// than files need, even though the client can read indirect
+// directories.
+func TestCRFileConflictCopyDataVersion(t *testing.T) {
+	// simulate two users
+	var userName1, userName2 libkb.NormalizedUsername = "u1", "u2"
+	config1, _, ctx, cancel := kbfsOpsConcurInit(t, userName1, userName2)
+	defer kbfsConcurTestShutdown(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, userName2)
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	require.Equal(t, CompressedBlocksDataVer, config2.DataVersion())
+
+	bss1, ok1 := config1.BlockSplitter().(*BlockSplitterSimple)
+	require.True(t, ok1)
+	bss2, ok2 := config2.BlockSplitter().(*BlockSplitterSimple)
+	require.True(t, ok2)
+	bss1.blockChangeEmbedMaxSize = 3
+	bss2.blockChangeEmbedMaxSize = 3
+	// Make the file indirect, so the conflict copy is a deep copy.
+	bss1.maxSize = 2
+	bss2.maxSize = 2
+
+	clock, now := newTestClockAndTimeNow()
+	config2.SetClock(clock)
+
+	name := userName1.String() + "," + userName2.String()
+
+	// user1 creates a file in a shared dir
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, false)
+
+	kbfsOps1 := config1.KBFSOps()
+	fileB1, _, err := kbfsOps1.CreateFile(ctx, rootNode1, "b", false, NoExcl)
+	require.NoError(t, err)
+
+	// look it up on user2
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, name, false)
+
+	kbfsOps2 := config2.KBFSOps()
+	fileB2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "b")
+	require.NoError(t, err)
+
+	// disable updates on user 2
+	c, err := DisableUpdatesForTesting(config2, rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+	err = DisableCRForTesting(config2, rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+
+	// Both users write the file.
+	err = kbfsOps1.Write(ctx, fileB1, []byte{1, 2, 3, 4, 5}, 0)
+	require.NoError(t, err)
+	err = kbfsOps1.Sync(ctx, fileB1)
+	require.NoError(t, err)
+	err = kbfsOps2.Write(ctx, fileB2, []byte{5, 4, 3, 2, 1}, 0)
+	require.NoError(t, err)
+	err = kbfsOps2.Sync(ctx, fileB2)
+	require.NoError(t, err)
+
+	// re-enable updates, and wait for CR to complete
+	c <- struct{}{}
+	err = RestartCRForTesting(
+		BackgroundContextWithCancellationDelayer(), config2,
+		rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+	err = kbfsOps2.SyncFromServerForTesting(ctx, rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+
+	cre := WriterDeviceDateConflictRenamer{}
+	copyNode, _, err := kbfsOps2.Lookup(
+		ctx, rootNode2, cre.ConflictRenameHelper(now, "u2", "dev1", "b"))
+	require.NoError(t, err)
+	ops2 := getOps(config2, rootNode2.GetFolderBranch().Tlf)
+	copyPath := ops2.nodeCache.PathFromNode(copyNode)
+	copyPtr := copyPath.tailPointer()
+	require.True(t, copyPtr.DataVer <= maxFileDataVer, "%v", copyPtr)
+
+	md, err := config2.MDOps().GetForTLF(ctx, rootNode2.GetFolderBranch().Tlf)
+	require.NoError(t, err)
+	require.NotEqual(t, zeroPtr, md.data.cachedChanges.Info.BlockPointer)
+	changesPtr := md.data.cachedChanges.Info.BlockPointer
+	require.True(t, changesPtr.DataVer <= maxFileDataVer, "%v", changesPtr)
 }
 
 // Tests that two users can create the same file simultaneously, and
@@ -7,10 +7,13 @@ package libkbfs
 import (
 	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfsblock"
 	"github.com/keybase/kbfs/kbfscrypto"
 	"github.com/keybase/kbfs/tlf"
@@ -38,6 +41,10 @@ type KBFSOpsStandard struct {
 	favs *Favorites
 
 	currentStatus kbfsCurrentStatus
+
+	// webhook and reportChanges are protected by opsLock.
+	webhook       *webhookNotifier
+	reportChanges bool
 }
 
 var _ KBFSOps = (*KBFSOpsStandard)(nil)
@@ -109,6 +116,9 @@ func (fs *KBFSOpsStandard) Shutdown(ctx context.Context) error {
 	if err := fs.favs.Shutdown(); err != nil {
 		errors = append(errors, err)
 	}
+	// Finish posting to the webhook while the folders can still
+	// fetch the blocks needed to describe their revisions.
+	fs.webhook.Shutdown()
 	for _, ops := range fs.ops {
 		if err := ops.Shutdown(ctx); err != nil {
 			errors = append(errors, err)
@@ -124,6 +134,29 @@ func (fs *KBFSOpsStandard) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// getAllOps returns a snapshot of every known folder branch.
+func (fs *KBFSOpsStandard) getAllOps() []*folderBranchOps {
+	fs.opsLock.RLock()
+	defer fs.opsLock.RUnlock()
+	ops := make([]*folderBranchOps, 0, len(fs.ops))
+	for _, fbo := range fs.ops {
+		ops = append(ops, fbo)
+	}
+	return ops
+}
+
+// syncAllDirtyFiles syncs all dirty files in every known folder
+// branch, returning the first error encountered.
+func (fs *KBFSOpsStandard) syncAllDirtyFiles(ctx context.Context) error {
+	var firstErr error
+	for _, fbo := range fs.getAllOps() {
+		if err := fbo.syncAllDirtyFiles(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 // PushConnectionStatusChange pushes human readable connection status changes.
 func (fs *KBFSOpsStandard) PushConnectionStatusChange(
 	service string, newStatus error) {
@@ -162,11 +195,48 @@ func (fs *KBFSOpsStandard) ForceFastForward(ctx context.Context) {
 	}
 }
 
+// KickoffRekeysForUser implements the KBFSOps interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) KickoffRekeysForUser(
+	ctx context.Context, uid keybase1.UID) {
+	fs.opsLock.RLock()
+	defer fs.opsLock.RUnlock()
+
+	fs.log.CDebugf(ctx, "Kicking off rekeys for user %s in %d folders",
+		uid, len(fs.ops))
+	for fb, fbo := range fs.ops {
+		// We currently only support rekeys of master branches.
+		if fb.Branch != MasterBranch {
+			continue
+		}
+		fbo.KickoffRekeysForUser(ctx, uid)
+	}
+}
+
 // GetFavorites implements the KBFSOps interface for
 // KBFSOpsStandard.
 func (fs *KBFSOpsStandard) GetFavorites(ctx context.Context) (
 	[]Favorite, error) {
-	return fs.favs.Get(ctx)
+	favs, err := fs.favs.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// List the conflicted copies of any TLFs alongside them.
+	var conflicted []Favorite
+	for _, ops := range fs.getAllOps() {
+		if ops.branch() == MasterBranch {
+			conflicted = append(
+				conflicted, ops.getConflictedCopyFavorites()...)
+		}
+	}
+	if len(conflicted) == 0 {
+		return favs, nil
+	}
+	// Don't append to the cached list.
+	allFavs := make([]Favorite, 0, len(favs)+len(conflicted))
+	allFavs = append(allFavs, favs...)
+	return append(allFavs, conflicted...), nil
 }
 
 // RefreshCachedFavorites implements the KBFSOps interface for
@@ -196,6 +266,11 @@ func (fs *KBFSOpsStandard) AddFavorite(ctx context.Context,
 // KBFSOpsStandard.
 func (fs *KBFSOpsStandard) DeleteFavorite(ctx context.Context,
 	fav Favorite) error {
+	// Deleting a conflicted copy clears it for good.
+	if ops, cb, ok := fs.getConflictBranch(fav); ok {
+		return fs.clearConflictedCopy(ctx, ops, cb)
+	}
+
 	kbpki := fs.config.KBPKI()
 	_, _, err := kbpki.GetCurrentUserInfo(ctx)
 	isLoggedIn := err == nil
@@ -248,6 +323,12 @@ func (fs *KBFSOpsStandard) getOpsNoAdd(fb FolderBranch) *folderBranchOps {
 		// TODO: add some interface for specifying the type of the
 		// branch; for now assume online and read-write.
 		ops = newFolderBranchOps(fs.config, fb, standard)
+		ops.syncState = &fs.currentStatus
+		ops.webhook = fs.webhook
+		if fs.reportChanges {
+			ops.changeSubs.subscribe(nil, changeEventReporter{
+				fs.config, ops.nodeCache})
+		}
 		fs.ops[fb] = ops
 	}
 	return ops
@@ -264,6 +345,72 @@ func (fs *KBFSOpsStandard) getOps(
 	return ops
 }
 
+// getConflictBranch returns the conflict branch whose conflicted copy
+// has the given favorite, along with the ops of the master branch it
+// was split from, if any.
+func (fs *KBFSOpsStandard) getConflictBranch(fav Favorite) (
+	*folderBranchOps, conflictBranch, bool) {
+	for _, ops := range fs.getAllOps() {
+		if ops.branch() != MasterBranch {
+			continue
+		}
+		if cb, ok := ops.getConflictBranch(fav); ok {
+			return ops, cb, true
+		}
+	}
+	return nil, conflictBranch{}, false
+}
+
+// getConflictedCopyRootNode returns the root node of the read-only
+// branch showing the given conflict branch of masterOps' TLF.
+func (fs *KBFSOpsStandard) getConflictedCopyRootNode(ctx context.Context,
+	masterOps *folderBranchOps, cb conflictBranch) (Node, EntryInfo, error) {
+	fb := FolderBranch{Tlf: masterOps.id(), Branch: cb.branchName()}
+	ops := func() *folderBranchOps {
+		fs.opsLock.Lock()
+		defer fs.opsLock.Unlock()
+		ops, ok := fs.ops[fb]
+		if !ok {
+			ops = newFolderBranchOps(fs.config, fb, archive)
+			fs.ops[fb] = ops
+		}
+		return ops
+	}()
+
+	err := ops.setConflictedCopyHead(ctx, cb.head)
+	if err != nil {
+		return nil, EntryInfo{}, err
+	}
+	node, ei, _, err := ops.getRootNode(ctx)
+	if err != nil {
+		return nil, EntryInfo{}, err
+	}
+	return node, ei, nil
+}
+
+// clearConflictedCopy clears the given conflict branch of masterOps'
+// TLF, and shuts down the read-only branch showing it, if any.
+func (fs *KBFSOpsStandard) clearConflictedCopy(ctx context.Context,
+	masterOps *folderBranchOps, cb conflictBranch) error {
+	err := masterOps.clearConflictBranch(ctx, cb)
+	if err != nil {
+		return err
+	}
+
+	fb := FolderBranch{Tlf: masterOps.id(), Branch: cb.branchName()}
+	ops := func() *folderBranchOps {
+		fs.opsLock.Lock()
+		defer fs.opsLock.Unlock()
+		ops := fs.ops[fb]
+		delete(fs.ops, fb)
+		return ops
+	}()
+	if ops == nil {
+		return nil
+	}
+	return ops.Shutdown(ctx)
+}
+
 func (fs *KBFSOpsStandard) getOpsByNode(ctx context.Context,
 	node Node) *folderBranchOps {
 	return fs.getOps(ctx, node.GetFolderBranch())
@@ -390,6 +537,45 @@ func (fs *KBFSOpsStandard) getMDByHandle(ctx context.Context,
 	return rmd, nil
 }
 
+// GetAllTLFHandles implements the KBFSOps interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) GetAllTLFHandles(ctx context.Context) (
+	handles []*TlfHandle, err error) {
+	fs.log.CDebugf(ctx, "GetAllTLFHandles")
+	defer func() { fs.deferLog.CDebugf(ctx, "Done: %+v", err) }()
+
+	ids, err := fs.config.MDServer().GetTLFIDsForCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	handles = make([]*TlfHandle, 0, len(ids))
+	for _, id := range ids {
+		h, err := fs.GetTLFHandle(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		handles = append(handles, h)
+	}
+	sort.Sort(tlfHandlesByPath(handles))
+	return handles, nil
+}
+
+// tlfHandlesByPath sorts TLF handles by their canonical paths.
+type tlfHandlesByPath []*TlfHandle
+
+func (hs tlfHandlesByPath) Len() int {
+	return len(hs)
+}
+
+func (hs tlfHandlesByPath) Less(i, j int) bool {
+	return hs[i].GetCanonicalPath() < hs[j].GetCanonicalPath()
+}
+
+func (hs tlfHandlesByPath) Swap(i, j int) {
+	hs[i], hs[j] = hs[j], hs[i]
+}
+
 // GetTLFCryptKeys implements the KBFSOps interface for
 // KBFSOpsStandard
 func (fs *KBFSOpsStandard) GetTLFCryptKeys(
@@ -419,6 +605,24 @@ func (fs *KBFSOpsStandard) GetTLFID(ctx context.Context,
 	return rmd.TlfID(), err
 }
 
+// GetTLFHandle implements the KBFSOps interface for KBFSOpsStandard.
+func (fs *KBFSOpsStandard) GetTLFHandle(ctx context.Context, id tlf.ID) (
+	h *TlfHandle, err error) {
+	fs.log.CDebugf(ctx, "GetTLFHandle(%s)", id)
+	defer func() { fs.deferLog.CDebugf(ctx, "Done: %+v", err) }()
+
+	bareHandle, err := fs.config.MDOps().GetLatestHandleForTLF(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Local mdservers return an empty handle for unknown IDs.
+	if len(bareHandle.Writers) == 0 &&
+		len(bareHandle.UnresolvedWriters) == 0 {
+		return nil, NoSuchTlfHandleError{id}
+	}
+	return MakeTlfHandle(ctx, bareHandle, fs.config.KBPKI())
+}
+
 // getMaybeCreateRootNode is called for GetOrCreateRootNode and GetRootNode.
 func (fs *KBFSOpsStandard) getMaybeCreateRootNode(
 	ctx context.Context, h *TlfHandle, branch BranchName, create bool) (
@@ -427,6 +631,14 @@ func (fs *KBFSOpsStandard) getMaybeCreateRootNode(
 		h.GetCanonicalPath(), branch, create)
 	defer func() { fs.deferLog.CDebugf(ctx, "Done: %#v", err) }()
 
+	// Conflicted copies kept by conflict resolution only exist
+	// locally, so don't ask the server about their handles.
+	if h.ConflictInfo() != nil && branch == MasterBranch {
+		if ops, cb, ok := fs.getConflictBranch(h.ToFavorite()); ok {
+			return fs.getConflictedCopyRootNode(ctx, ops, cb)
+		}
+	}
+
 	// Do GetForHandle() unlocked -- no cache lookups, should be fine
 	mdops := fs.config.MDOps()
 	// TODO: only do this the first time, cache the folder ID after that
@@ -539,6 +751,14 @@ func (fs *KBFSOpsStandard) GetDirChildren(ctx context.Context, dir Node) (
 	return ops.GetDirChildren(ctx, dir)
 }
 
+// GetDirChildrenPage implements the KBFSOps interface for
+// KBFSOpsStandard
+func (fs *KBFSOpsStandard) GetDirChildrenPage(ctx context.Context,
+	dir Node, after string, maxEntries int) ([]DirChild, bool, error) {
+	ops := fs.getOpsByNode(ctx, dir)
+	return ops.GetDirChildrenPage(ctx, dir, after, maxEntries)
+}
+
 // Lookup implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) Lookup(ctx context.Context, dir Node, name string) (
 	Node, EntryInfo, error) {
@@ -635,6 +855,13 @@ func (fs *KBFSOpsStandard) SetEx(
 	return ops.SetEx(ctx, file, ex)
 }
 
+// SetMode implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) SetMode(
+	ctx context.Context, node Node, mode os.FileMode) error {
+	ops := fs.getOpsByNode(ctx, node)
+	return ops.SetMode(ctx, node, mode)
+}
+
 // SetMtime implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) SetMtime(
 	ctx context.Context, file Node, mtime *time.Time) error {
@@ -642,6 +869,34 @@ func (fs *KBFSOpsStandard) SetMtime(
 	return ops.SetMtime(ctx, file, mtime)
 }
 
+// GetXattr implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) GetXattr(
+	ctx context.Context, node Node, name string) ([]byte, error) {
+	ops := fs.getOpsByNode(ctx, node)
+	return ops.GetXattr(ctx, node, name)
+}
+
+// ListXattrs implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) ListXattrs(
+	ctx context.Context, node Node) ([]string, error) {
+	ops := fs.getOpsByNode(ctx, node)
+	return ops.ListXattrs(ctx, node)
+}
+
+// SetXattr implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) SetXattr(
+	ctx context.Context, node Node, name string, value []byte) error {
+	ops := fs.getOpsByNode(ctx, node)
+	return ops.SetXattr(ctx, node, name, value)
+}
+
+// RemoveXattr implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) RemoveXattr(
+	ctx context.Context, node Node, name string) error {
+	ops := fs.getOpsByNode(ctx, node)
+	return ops.RemoveXattr(ctx, node, name)
+}
+
 // Sync implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) Sync(ctx context.Context, file Node) error {
 	ops := fs.getOpsByNode(ctx, file)
@@ -696,6 +951,7 @@ func (fs *KBFSOpsStandard) Status(ctx context.Context) (
 		UsageBytes:      usageBytes,
 		LimitBytes:      limitBytes,
 		FailingServices: failures,
+		BlockCache:      fs.config.BlockCache().Status(),
 		JournalServer:   jServerStatus,
 	}, ch, err
 }
@@ -715,6 +971,21 @@ func (fs *KBFSOpsStandard) Rekey(ctx context.Context, id tlf.ID) error {
 	return ops.Rekey(ctx, id)
 }
 
+// RotateKey implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) RotateKey(ctx context.Context, id tlf.ID) error {
+	// We currently only support rekeys of master branches.
+	ops := fs.getOpsNoAdd(FolderBranch{Tlf: id, Branch: MasterBranch})
+	return ops.RotateKey(ctx, id)
+}
+
+// SetTlfSyncMode implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) SetTlfSyncMode(
+	ctx context.Context, id tlf.ID, mode TlfSyncMode) error {
+	// Sync modes only apply to master branches.
+	ops := fs.getOps(ctx, FolderBranch{Tlf: id, Branch: MasterBranch})
+	return ops.SetTlfSyncMode(ctx, id, mode)
+}
+
 // SyncFromServerForTesting implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) SyncFromServerForTesting(
 	ctx context.Context, folderBranch FolderBranch) error {
@@ -729,6 +1000,39 @@ func (fs *KBFSOpsStandard) GetUpdateHistory(ctx context.Context,
 	return ops.GetUpdateHistory(ctx, folderBranch)
 }
 
+// GetUnmergedHistory implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) GetUnmergedHistory(ctx context.Context,
+	folderBranch FolderBranch) (history TLFUpdateHistory, err error) {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.GetUnmergedHistory(ctx, folderBranch)
+}
+
+// SubscribeToChanges implements the KBFSOps interface for
+// KBFSOpsStandard
+func (fs *KBFSOpsStandard) SubscribeToChanges(ctx context.Context,
+	folderBranch FolderBranch, node Node, subscriber ChangeSubscriber) error {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.SubscribeToChanges(ctx, folderBranch, node, subscriber)
+}
+
+// SubscribeToFilteredChanges implements the KBFSOps interface for
+// KBFSOpsStandard
+func (fs *KBFSOpsStandard) SubscribeToFilteredChanges(ctx context.Context,
+	folderBranch FolderBranch, filter ChangeFilter,
+	subscriber ChangeSubscriber) error {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.SubscribeToFilteredChanges(
+		ctx, folderBranch, filter, subscriber)
+}
+
+// UnsubscribeFromChanges implements the KBFSOps interface for
+// KBFSOpsStandard
+func (fs *KBFSOpsStandard) UnsubscribeFromChanges(ctx context.Context,
+	folderBranch FolderBranch, subscriber ChangeSubscriber) error {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.UnsubscribeFromChanges(ctx, folderBranch, subscriber)
+}
+
 // GetEditHistory implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) GetEditHistory(ctx context.Context,
 	folderBranch FolderBranch) (edits TlfWriterEdits, err error) {
@@ -736,6 +1040,68 @@ func (fs *KBFSOpsStandard) GetEditHistory(ctx context.Context,
 	return ops.GetEditHistory(ctx, folderBranch)
 }
 
+// GetActivityLog implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) GetActivityLog(ctx context.Context,
+	folderBranch FolderBranch, since time.Time) (
+	[]TlfActivityEntry, error) {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.GetActivityLog(ctx, folderBranch, since)
+}
+
+// GetArchivedEntry implements the KBFSOps interface for
+// KBFSOpsStandard
+func (fs *KBFSOpsStandard) GetArchivedEntry(ctx context.Context,
+	folderBranch FolderBranch, rev MetadataRevision, p []string) (
+	EntryInfo, error) {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.GetArchivedEntry(ctx, folderBranch, rev, p)
+}
+
+// GetArchivedDirChildren implements the KBFSOps interface for
+// KBFSOpsStandard
+func (fs *KBFSOpsStandard) GetArchivedDirChildren(ctx context.Context,
+	folderBranch FolderBranch, rev MetadataRevision, p []string) (
+	map[string]EntryInfo, error) {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.GetArchivedDirChildren(ctx, folderBranch, rev, p)
+}
+
+// ReadArchived implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) ReadArchived(ctx context.Context,
+	folderBranch FolderBranch, rev MetadataRevision, p []string,
+	dest []byte, off int64) (int64, error) {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.ReadArchived(ctx, folderBranch, rev, p, dest, off)
+}
+
+// GetTlfSettings implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) GetTlfSettings(ctx context.Context,
+	folderBranch FolderBranch) (TlfSettings, error) {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.GetTlfSettings(ctx, folderBranch)
+}
+
+// SetTlfSettings implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) SetTlfSettings(ctx context.Context,
+	folderBranch FolderBranch, settings TlfSettings) error {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.SetTlfSettings(ctx, folderBranch, settings)
+}
+
+// Lock implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) Lock(ctx context.Context,
+	folderBranch FolderBranch, lockID LockID, wait bool) error {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.Lock(ctx, folderBranch, lockID, wait)
+}
+
+// Unlock implements the KBFSOps interface for KBFSOpsStandard
+func (fs *KBFSOpsStandard) Unlock(ctx context.Context,
+	folderBranch FolderBranch, lockID LockID) error {
+	ops := fs.getOps(ctx, folderBranch)
+	return ops.Unlock(ctx, folderBranch, lockID)
+}
+
 // GetNodeMetadata implements the KBFSOps interface for KBFSOpsStandard
 func (fs *KBFSOpsStandard) GetNodeMetadata(ctx context.Context, node Node) (
 	NodeMetadata, error) {
@@ -782,6 +1148,59 @@ func (fs *KBFSOpsStandard) UnregisterFromChanges(
 	return nil
 }
 
+// RegisterForFavoritesChanges implements the Notifer interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) RegisterForFavoritesChanges(
+	obs FavoritesObserver) {
+	fs.favs.registerForChanges(obs)
+}
+
+// UnregisterFromFavoritesChanges implements the Notifer interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) UnregisterFromFavoritesChanges(
+	obs FavoritesObserver) {
+	fs.favs.unregisterFromChanges(obs)
+}
+
+// RegisterForSyncStateChanges implements the Notifer interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) RegisterForSyncStateChanges(
+	obs SyncStateObserver) {
+	fs.currentStatus.registerForSyncStateChanges(obs)
+}
+
+// UnregisterFromSyncStateChanges implements the Notifer interface for
+// KBFSOpsStandard.
+func (fs *KBFSOpsStandard) UnregisterFromSyncStateChanges(
+	obs SyncStateObserver) {
+	fs.currentStatus.unregisterFromSyncStateChanges(obs)
+}
+
+// EnableWebhook makes every folder-branch loaded from now on post a
+// WebhookPayload to rawURL for each of its new revisions.  It must
+// be called at most once, before any folders are loaded.
+func (fs *KBFSOpsStandard) EnableWebhook(rawURL string) error {
+	wn, err := newWebhookNotifier(fs.config, rawURL)
+	if err != nil {
+		return err
+	}
+	fs.opsLock.Lock()
+	defer fs.opsLock.Unlock()
+	fs.webhook = wn
+	return nil
+}
+
+// EnableChangeNotifications makes every folder-branch loaded from
+// now on report each change to its files and directories as an
+// FSNotification, which the keybase service relays to any local
+// client registered for keybase.1.NotifyFS.  It must be called
+// before any folders are loaded.
+func (fs *KBFSOpsStandard) EnableChangeNotifications() {
+	fs.opsLock.Lock()
+	defer fs.opsLock.Unlock()
+	fs.reportChanges = true
+}
+
 func (fs *KBFSOpsStandard) onTLFBranchChange(tlfID tlf.ID, newBID BranchID) {
 	ops := fs.getOpsNoAdd(FolderBranch{Tlf: tlfID, Branch: MasterBranch})
 	ops.onTLFBranchChange(newBID) // folderBranchOps makes a goroutine
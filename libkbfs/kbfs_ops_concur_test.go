@@ -547,6 +547,13 @@ func (km *mdRecordingKeyManager) Rekey(
 	return km.delegate.Rekey(ctx, md, promptPaper)
 }
 
+func (km *mdRecordingKeyManager) RotateKey(
+	ctx context.Context, md *RootMetadata) (
+	bool, *kbfscrypto.TLFCryptKey, error) {
+	km.setLastKMD(md)
+	return km.delegate.RotateKey(ctx, md)
+}
+
 // Test that a sync can happen concurrently with a write. This is a
 // regression test for KBFS-558.
 func TestKBFSOpsConcurBlockSyncWrite(t *testing.T) {
@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"fmt"
 	"math/rand"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -110,7 +112,7 @@ func kbfsOpsInit(t *testing.T, changeMd bool) (mockCtrl *gomock.Controller,
 	config.mockBops.EXPECT().Archive(gomock.Any(), gomock.Any(),
 		gomock.Any()).AnyTimes().Return(nil)
 	// Ignore Prefetcher calls
-	config.mockBops.EXPECT().Prefetcher().AnyTimes().Return(newBlockPrefetcher(nil, &testBlockRetrievalConfig{nil, config.BlockCache(), nil, t}))
+	config.mockBops.EXPECT().Prefetcher().AnyTimes().Return(newBlockPrefetcher(nil, &testBlockRetrievalConfig{nil, config.BlockCache(), nil, nil, t}))
 
 	// Ignore key bundle ID creation calls for now
 	config.mockCrypto.EXPECT().MakeTLFWriterKeyBundleID(gomock.Any()).
@@ -5677,3 +5679,543 @@ func TestForceFastForwardOnEmptyTLF(t *testing.T) {
 		t.Fatalf("Couldn't wait for fast forward: %+v", err)
 	}
 }
+
+func TestKBFSOpsGetAllTLFHandles(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice", "bob")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	handles, err := config.KBFSOps().GetAllTLFHandles(ctx)
+	require.NoError(t, err)
+	require.Len(t, handles, 0)
+
+	GetRootNodeOrBust(ctx, t, config, "alice", true)
+	GetRootNodeOrBust(ctx, t, config, "alice,bob", false)
+
+	handles, err = config.KBFSOps().GetAllTLFHandles(ctx)
+	require.NoError(t, err)
+	var paths []string
+	for _, h := range handles {
+		paths = append(paths, h.GetCanonicalPath())
+	}
+	require.Equal(t, []string{
+		"/keybase/private/alice,bob",
+		"/keybase/public/alice",
+	}, paths)
+}
+
+func TestKBFSOpsGetTLFHandle(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice", "bob")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	h, err := ParseTlfHandle(ctx, config.KBPKI(), "alice,bob", false)
+	require.NoError(t, err)
+	id, err := config.KBFSOps().GetTLFID(ctx, h)
+	require.NoError(t, err)
+
+	h2, err := config.KBFSOps().GetTLFHandle(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, h.GetCanonicalPath(), h2.GetCanonicalPath())
+
+	unknownID := tlf.FakeID(100, false)
+	_, err = config.KBFSOps().GetTLFHandle(ctx, unknownID)
+	require.Equal(t, NoSuchTlfHandleError{unknownID}, err)
+}
+
+func TestKBFSOpsTlfSettings(t *testing.T) {
+	config1, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice", "bob")
+	defer kbfsTestShutdownNoMocks(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, "bob")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+
+	const name = "alice,bob"
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, false)
+	fb := rootNode1.GetFolderBranch()
+	kbfsOps1 := config1.KBFSOps()
+
+	settings, err := kbfsOps1.GetTlfSettings(ctx, fb)
+	require.NoError(t, err)
+	require.Equal(t, TlfSettings{}, settings)
+
+	err = kbfsOps1.SetTlfSettings(ctx, fb, TlfSettings{BlockSize: -1})
+	require.Error(t, err)
+
+	newSettings := TlfSettings{SyncEnabled: true, BlockSize: 1 << 16}
+	err = kbfsOps1.SetTlfSettings(ctx, fb, newSettings)
+	require.NoError(t, err)
+	settings, err = kbfsOps1.GetTlfSettings(ctx, fb)
+	require.NoError(t, err)
+	require.Equal(t, newSettings, settings)
+
+	// Later revisions should keep the settings.
+	_, _, err = kbfsOps1.CreateFile(ctx, rootNode1, "a", false, NoExcl)
+	require.NoError(t, err)
+	settings, err = kbfsOps1.GetTlfSettings(ctx, fb)
+	require.NoError(t, err)
+	require.Equal(t, newSettings, settings)
+
+	// The other user's device should see them too.
+	GetRootNodeOrBust(ctx, t, config2, name, false)
+	kbfsOps2 := config2.KBFSOps()
+	settings, err = kbfsOps2.GetTlfSettings(ctx, fb)
+	require.NoError(t, err)
+	require.Equal(t, newSettings, settings)
+
+	// And changes from that device should propagate back.
+	newSettings.JournalDisabled = true
+	err = kbfsOps2.SetTlfSettings(ctx, fb, newSettings)
+	require.NoError(t, err)
+	err = kbfsOps1.SyncFromServerForTesting(ctx, fb)
+	require.NoError(t, err)
+	settings, err = kbfsOps1.GetTlfSettings(ctx, fb)
+	require.NoError(t, err)
+	require.Equal(t, newSettings, settings)
+}
+
+func TestKBFSOpsXattrs(t *testing.T) {
+	config1, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice", "bob")
+	defer kbfsTestShutdownNoMocks(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, "bob")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+
+	const name = "alice,bob"
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, false)
+	kbfsOps1 := config1.KBFSOps()
+	fileNode1, _, err := kbfsOps1.CreateFile(
+		ctx, rootNode1, "a", false, NoExcl)
+	require.NoError(t, err)
+	dirNode1, _, err := kbfsOps1.CreateDir(ctx, rootNode1, "b")
+	require.NoError(t, err)
+
+	_, err = kbfsOps1.GetXattr(ctx, fileNode1, "user.tag")
+	require.Equal(t, NoSuchXattrError{"user.tag"}, err)
+	names, err := kbfsOps1.ListXattrs(ctx, fileNode1)
+	require.NoError(t, err)
+	require.Len(t, names, 0)
+
+	err = kbfsOps1.SetXattr(ctx, fileNode1, "user.tag", []byte("red"))
+	require.NoError(t, err)
+	err = kbfsOps1.SetXattr(ctx, fileNode1, "user.empty", []byte{})
+	require.NoError(t, err)
+	err = kbfsOps1.SetXattr(ctx, dirNode1, "user.tag", []byte("blue"))
+	require.NoError(t, err)
+
+	value, err := kbfsOps1.GetXattr(ctx, fileNode1, "user.tag")
+	require.NoError(t, err)
+	require.Equal(t, []byte("red"), value)
+	names, err = kbfsOps1.ListXattrs(ctx, fileNode1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"user.empty", "user.tag"}, names)
+
+	// Xattrs can't be set on the root, or be too big.
+	err = kbfsOps1.SetXattr(ctx, rootNode1, "user.tag", []byte("red"))
+	require.IsType(t, InvalidParentPathError{}, err)
+	err = kbfsOps1.SetXattr(ctx, fileNode1,
+		strings.Repeat("x", maxXattrNameBytes+1), []byte("red"))
+	require.IsType(t, XattrNameTooLongError{}, err)
+	err = kbfsOps1.SetXattr(ctx, fileNode1, "user.big",
+		make([]byte, maxXattrValueBytes+1))
+	require.IsType(t, XattrTooBigError{}, err)
+
+	err = kbfsOps1.RemoveXattr(ctx, fileNode1, "user.empty")
+	require.NoError(t, err)
+	err = kbfsOps1.RemoveXattr(ctx, fileNode1, "user.empty")
+	require.Equal(t, NoSuchXattrError{"user.empty"}, err)
+
+	// The other user's device should see the xattrs.
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, name, false)
+	kbfsOps2 := config2.KBFSOps()
+	fileNode2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	dirNode2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "b")
+	require.NoError(t, err)
+	names, err = kbfsOps2.ListXattrs(ctx, fileNode2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"user.tag"}, names)
+	value, err = kbfsOps2.GetXattr(ctx, dirNode2, "user.tag")
+	require.NoError(t, err)
+	require.Equal(t, []byte("blue"), value)
+}
+
+func TestKBFSOpsSetMode(t *testing.T) {
+	config1, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice", "bob")
+	defer kbfsTestShutdownNoMocks(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, "bob")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+
+	const name = "alice,bob"
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, false)
+	kbfsOps1 := config1.KBFSOps()
+	fileNode1, ei, err := kbfsOps1.CreateFile(
+		ctx, rootNode1, "a", false, NoExcl)
+	require.NoError(t, err)
+	_, ok := ei.PermMode()
+	require.False(t, ok)
+	dirNode1, _, err := kbfsOps1.CreateDir(ctx, rootNode1, "b")
+	require.NoError(t, err)
+
+	// The user-exec bit decides the file type; other bits are
+	// only stored.
+	err = kbfsOps1.SetMode(ctx, fileNode1, os.ModeSetuid|0750)
+	require.NoError(t, err)
+	ei, err = kbfsOps1.Stat(ctx, fileNode1)
+	require.NoError(t, err)
+	require.Equal(t, Exec, ei.Type)
+	perm, ok := ei.PermMode()
+	require.True(t, ok)
+	require.Equal(t, os.FileMode(0750), perm)
+
+	// SetEx keeps the stored bits in agreement.
+	err = kbfsOps1.SetEx(ctx, fileNode1, false)
+	require.NoError(t, err)
+	ei, err = kbfsOps1.Stat(ctx, fileNode1)
+	require.NoError(t, err)
+	require.Equal(t, File, ei.Type)
+	perm, ok = ei.PermMode()
+	require.True(t, ok)
+	require.Equal(t, os.FileMode(0640), perm)
+
+	err = kbfsOps1.SetMode(ctx, dirNode1, 0711)
+	require.NoError(t, err)
+	// The root has no entry to store a mode in.
+	err = kbfsOps1.SetMode(ctx, rootNode1, 0700)
+	require.NoError(t, err)
+
+	// The other user's device should see the modes.
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, name, false)
+	kbfsOps2 := config2.KBFSOps()
+	_, ei, err = kbfsOps2.Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	require.Equal(t, File, ei.Type)
+	perm, ok = ei.PermMode()
+	require.True(t, ok)
+	require.Equal(t, os.FileMode(0640), perm)
+	_, ei, err = kbfsOps2.Lookup(ctx, rootNode2, "b")
+	require.NoError(t, err)
+	require.Equal(t, Dir, ei.Type)
+	perm, ok = ei.PermMode()
+	require.True(t, ok)
+	require.Equal(t, os.FileMode(0711), perm)
+	ei, err = kbfsOps2.Stat(ctx, rootNode2)
+	require.NoError(t, err)
+	_, ok = ei.PermMode()
+	require.False(t, ok)
+
+	// A mode of 0000 is stored, rather than taken as unset.
+	err = kbfsOps1.SetMode(ctx, fileNode1, 0)
+	require.NoError(t, err)
+	err = kbfsOps2.SyncFromServerForTesting(ctx, rootNode2.GetFolderBranch())
+	require.NoError(t, err)
+	_, ei, err = kbfsOps2.Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	require.Equal(t, File, ei.Type)
+	perm, ok = ei.PermMode()
+	require.True(t, ok)
+	require.Equal(t, os.FileMode(0), perm)
+}
+
+func TestKBFSOpsAdvisoryLocks(t *testing.T) {
+	config1, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice", "bob")
+	defer kbfsTestShutdownNoMocks(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, "bob")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+
+	const name = "alice,bob"
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, false)
+	fb := rootNode1.GetFolderBranch()
+	GetRootNodeOrBust(ctx, t, config2, name, false)
+	kbfsOps1 := config1.KBFSOps()
+	kbfsOps2 := config2.KBFSOps()
+
+	const lockID LockID = "index.lock"
+	err := kbfsOps1.Lock(ctx, fb, lockID, false)
+	require.NoError(t, err)
+
+	// The other device can't take it, even after waiting a bit.
+	err = kbfsOps2.Lock(ctx, fb, lockID, false)
+	require.Equal(t, MDServerErrorLocked{}, err)
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer waitCancel()
+	err = kbfsOps2.Lock(waitCtx, fb, lockID, true)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	// A waiting device gets the lock once it's released.
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- kbfsOps2.Lock(ctx, fb, lockID, true)
+	}()
+	err = kbfsOps1.Unlock(ctx, fb, lockID)
+	require.NoError(t, err)
+	select {
+	case err = <-errCh:
+		require.NoError(t, err)
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+
+	err = kbfsOps1.Lock(ctx, fb, lockID, false)
+	require.Equal(t, MDServerErrorLocked{}, err)
+	err = kbfsOps2.Unlock(ctx, fb, lockID)
+	require.NoError(t, err)
+	err = kbfsOps1.Lock(ctx, fb, lockID, false)
+	require.NoError(t, err)
+}
+
+func TestKBFSOpsStreamCompletedBlocks(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "test_user")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	// Make the blocks small, with multiple levels of indirection.
+	blockSize := int64(5)
+	config.SetBlockSplitter(&BlockSplitterSimple{blockSize, 2, 100 * 1024})
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "test_user", false)
+	// Turn on streaming only after the folder has been initialized,
+	// so that no background flusher races with the test.
+	config.SetDoBackgroundFlushes(true)
+
+	kbfsOps := config.KBFSOps()
+	fileNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Sync(ctx, fileNode)
+	require.NoError(t, err)
+
+	bserver := config.BlockServer().(blockServerLocal)
+	tlfID := rootNode.GetFolderBranch().Tlf
+	refsBefore, err := bserver.getAllRefsForTest(ctx, tlfID)
+	require.NoError(t, err)
+
+	// Write the file one block at a time.
+	const numBlocks = 10
+	var data []byte
+	for i := 0; i < numBlocks; i++ {
+		chunk := make([]byte, blockSize)
+		for j := range chunk {
+			chunk[j] = byte(i*int(blockSize) + j)
+		}
+		err = kbfsOps.Write(ctx, fileNode, chunk, int64(len(data)))
+		require.NoError(t, err)
+		data = append(data, chunk...)
+	}
+
+	// The completed blocks should already be on the server.
+	refsAfterWrites, err := bserver.getAllRefsForTest(ctx, tlfID)
+	require.NoError(t, err)
+	require.True(t, len(refsAfterWrites) > len(refsBefore))
+
+	// Overwrite a streamed block, which must then be replaced
+	// during the sync.
+	data[0] = 0xff
+	err = kbfsOps.Write(ctx, fileNode, data[:1], 0)
+	require.NoError(t, err)
+
+	err = kbfsOps.Sync(ctx, fileNode)
+	require.NoError(t, err)
+
+	// A fresh device should read back exactly what was written.
+	config2 := ConfigAsUser(config, "test_user")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, "test_user", false)
+	fileNode2, _, err := config2.KBFSOps().Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	buf := make([]byte, len(data))
+	n, err := config2.KBFSOps().Read(ctx, fileNode2, buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.Equal(t, data, buf)
+}
+
+func TestKBFSOpsTruncateIndirectFile(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "test_user")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	// Make the blocks small, with multiple levels of indirection.
+	blockSize := int64(5)
+	config.SetBlockSplitter(&BlockSplitterSimple{blockSize, 2, 100 * 1024})
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "test_user", false)
+	kbfsOps := config.KBFSOps()
+	fileNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+	data := make([]byte, 4*blockSize+2)
+	for i := range data {
+		data[i] = byte(i + 1)
+	}
+	err = kbfsOps.Write(ctx, fileNode, data, 0)
+	require.NoError(t, err)
+	err = kbfsOps.Sync(ctx, fileNode)
+	require.NoError(t, err)
+
+	checkData := func(expected []byte) {
+		buf := make([]byte, len(expected)+1)
+		n, err := kbfsOps.Read(ctx, fileNode, buf, 0)
+		require.NoError(t, err)
+		require.Equal(t, expected, buf[:n])
+	}
+
+	// A small extension of an indirect file leaves a hole instead
+	// of writing zeroes.
+	data = append(data, make([]byte, 3)...)
+	err = kbfsOps.Truncate(ctx, fileNode, uint64(len(data)))
+	require.NoError(t, err)
+	checkData(data)
+	err = kbfsOps.Sync(ctx, fileNode)
+	require.NoError(t, err)
+	checkData(data)
+
+	// Shrink to a block boundary, and then into the middle of a
+	// block.
+	data = data[:2*blockSize]
+	err = kbfsOps.Truncate(ctx, fileNode, uint64(len(data)))
+	require.NoError(t, err)
+	checkData(data)
+	data = data[:blockSize+1]
+	err = kbfsOps.Truncate(ctx, fileNode, uint64(len(data)))
+	require.NoError(t, err)
+	checkData(data)
+	err = kbfsOps.Sync(ctx, fileNode)
+	require.NoError(t, err)
+
+	// Another device should see the same data.
+	config2 := ConfigAsUser(config, "test_user")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, "test_user", false)
+	fileNode2, _, err := config2.KBFSOps().Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	buf := make([]byte, len(data)+1)
+	n, err := config2.KBFSOps().Read(ctx, fileNode2, buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, data, buf[:n])
+}
+
+func TestKBFSOpsIndirectDir(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "test_user")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "test_user", false)
+	ops := getOps(config, rootNode.GetFolderBranch().Tlf)
+	ops.maxDirEntriesPerBlock = 4
+
+	kbfsOps := config.KBFSOps()
+	dirNode, _, err := kbfsOps.CreateDir(ctx, rootNode, "d")
+	require.NoError(t, err)
+	var names []string
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("f%02d", i)
+		_, _, err := kbfsOps.CreateFile(ctx, dirNode, name, false, NoExcl)
+		require.NoError(t, err)
+		names = append(names, name)
+	}
+
+	// Page through the directory.
+	checkPages := func(kbfsOps KBFSOps, dirNode Node, expected []string) {
+		var got []string
+		after := ""
+		for {
+			children, more, err := kbfsOps.GetDirChildrenPage(
+				ctx, dirNode, after, 3)
+			require.NoError(t, err)
+			require.True(t, len(children) <= 3)
+			for _, child := range children {
+				got = append(got, child.Name)
+				after = child.Name
+			}
+			if !more {
+				break
+			}
+		}
+		require.Equal(t, expected, got)
+	}
+	checkPages(kbfsOps, dirNode, names)
+
+	// The top block and its children are stamped with the indirect
+	// directory data version.
+	dirPtr := ops.nodeCache.PathFromNode(dirNode).tailPointer()
+	require.Equal(t, IndirectDirsDataVer, dirPtr.DataVer)
+	block, err := config.BlockCache().Get(dirPtr)
+	require.NoError(t, err)
+	dblock, ok := block.(*DirBlock)
+	require.True(t, ok)
+	require.NotEmpty(t, dblock.IPtrs)
+	for _, iptr := range dblock.IPtrs {
+		require.Equal(t, IndirectDirsDataVer, iptr.DataVer)
+	}
+
+	// Removing an entry only rewrites the child block holding it.
+	err = kbfsOps.RemoveEntry(ctx, dirNode, names[0])
+	require.NoError(t, err)
+	names = names[1:]
+	checkPages(kbfsOps, dirNode, names)
+
+	// A fresh device assembles the directory from its child blocks.
+	config2 := ConfigAsUser(config, "test_user")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, "test_user", false)
+	kbfsOps2 := config2.KBFSOps()
+	dirNode2, _, err := kbfsOps2.Lookup(ctx, rootNode2, "d")
+	require.NoError(t, err)
+	// Paging from the middle only needs the child blocks covering
+	// the page.
+	page, more, err := kbfsOps2.GetDirChildrenPage(
+		ctx, dirNode2, names[3], 2)
+	require.NoError(t, err)
+	require.True(t, more)
+	require.Len(t, page, 2)
+	require.Equal(t, names[4], page[0].Name)
+	require.Equal(t, names[5], page[1].Name)
+	children, err := kbfsOps2.GetDirChildren(ctx, dirNode2)
+	require.NoError(t, err)
+	require.Len(t, children, len(names))
+	_, _, err = kbfsOps2.Lookup(ctx, dirNode2, names[len(names)-1])
+	require.NoError(t, err)
+	checkPages(kbfsOps2, dirNode2, names)
+}
+
+func TestKBFSOpsSyncPreservesTimes(t *testing.T) {
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "test_user")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+	clock, t0 := newTestClockAndTimeNow()
+	config.SetClock(clock)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "test_user", false)
+	kbfsOps := config.KBFSOps()
+	fileNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+
+	// The mtime is that of the write, not of the sync.
+	clock.Add(1 * time.Minute)
+	writeTime := clock.Now()
+	err = kbfsOps.Write(ctx, fileNode, []byte{1, 2, 3}, 0)
+	require.NoError(t, err)
+	ei, err := kbfsOps.Stat(ctx, fileNode)
+	require.NoError(t, err)
+	require.Equal(t, writeTime.UnixNano(), ei.Mtime)
+
+	clock.Add(1 * time.Minute)
+	err = kbfsOps.Sync(ctx, fileNode)
+	require.NoError(t, err)
+	ei, err = kbfsOps.Stat(ctx, fileNode)
+	require.NoError(t, err)
+	require.Equal(t, writeTime.UnixNano(), ei.Mtime)
+
+	// An mtime set explicitly after a write survives the sync.
+	err = kbfsOps.Write(ctx, fileNode, []byte{4}, 3)
+	require.NoError(t, err)
+	mtime := t0.Add(-1 * time.Hour)
+	err = kbfsOps.SetMtime(ctx, fileNode, &mtime)
+	require.NoError(t, err)
+	clock.Add(1 * time.Minute)
+	err = kbfsOps.Sync(ctx, fileNode)
+	require.NoError(t, err)
+
+	config2 := ConfigAsUser(config, "test_user")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, "test_user", false)
+	_, ei, err = config2.KBFSOps().Lookup(ctx, rootNode2, "a")
+	require.NoError(t, err)
+	require.Equal(t, mtime.UnixNano(), ei.Mtime)
+	require.Equal(t, uint64(4), ei.Size)
+}
@@ -6,13 +6,17 @@ package libkbfs
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/client/go/logger"
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
 	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
 )
 
 // keybaseServiceOwner is a wrapper around a KeybaseService, to allow
@@ -30,6 +34,10 @@ type KBPKIClient struct {
 
 var _ KBPKI = (*KBPKIClient)(nil)
 
+// resolveUIDsParallelism is the maximum number of lookups that
+// ResolveUIDs makes at once.
+const resolveUIDsParallelism = 10
+
 // NewKBPKIClient returns a new KBPKIClient with the given service.
 func NewKBPKIClient(
 	serviceOwner keybaseServiceOwner, log logger.Logger) *KBPKIClient {
@@ -102,6 +110,65 @@ func (k *KBPKIClient) GetNormalizedUsername(ctx context.Context, uid keybase1.UI
 	return username, nil
 }
 
+// ResolveUIDs implements the KBPKI interface for KBPKIClient.
+func (k *KBPKIClient) ResolveUIDs(ctx context.Context, uids []keybase1.UID) (
+	map[keybase1.UID]libkb.NormalizedUsername, error) {
+	var namesLock sync.Mutex
+	names := make(map[keybase1.UID]libkb.NormalizedUsername, len(uids))
+	eg, groupCtx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, resolveUIDsParallelism)
+	seen := make(map[keybase1.UID]bool, len(uids))
+	for _, uid := range uids {
+		if seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		uid := uid
+		eg.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-groupCtx.Done():
+				return groupCtx.Err()
+			}
+			defer func() { <-sem }()
+
+			var name libkb.NormalizedUsername
+			var err error
+			if tlf.IsTeamID(uid) {
+				var info TeamInfo
+				info, err = k.GetTeamInfo(groupCtx, uid)
+				name = info.Name
+			} else {
+				name, err = k.GetNormalizedUsername(groupCtx, uid)
+			}
+			switch errors.Cause(err).(type) {
+			case nil:
+			case NoSuchUserError, NoSuchTeamError:
+				k.log.CDebugf(ctx, "Couldn't resolve %s: %+v", uid, err)
+				return nil
+			default:
+				return err
+			}
+
+			namesLock.Lock()
+			defer namesLock.Unlock()
+			names[uid] = name
+			return nil
+		})
+	}
+	err := eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// GetTeamInfo implements the KBPKI interface for KBPKIClient.
+func (k *KBPKIClient) GetTeamInfo(ctx context.Context, tid keybase1.UID) (
+	TeamInfo, error) {
+	return k.serviceOwner.KeybaseService().LoadTeam(ctx, tid)
+}
+
 func (k *KBPKIClient) hasVerifyingKey(ctx context.Context, uid keybase1.UID,
 	verifyingKey kbfscrypto.VerifyingKey, atServerTime time.Time) (bool, error) {
 	userInfo, err := k.loadUserPlusKeys(ctx, uid, verifyingKey.KID())
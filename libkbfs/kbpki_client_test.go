@@ -14,6 +14,7 @@ import (
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfscodec"
 	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 )
 
@@ -81,6 +82,26 @@ func TestKBPKIClientGetNormalizedUsername(t *testing.T) {
 	}
 }
 
+func TestKBPKIClientResolveUIDs(t *testing.T) {
+	c, _, users := makeTestKBPKIClient(t)
+	daemon := c.serviceOwner.KeybaseService().(*KeybaseDaemonLocal)
+	tid, err := daemon.addTeamForTest("t1", map[keybase1.UID]TeamRole{
+		users[0].UID: TeamRoleWriter,
+	})
+	require.NoError(t, err)
+
+	unknownUID := keybase1.MakeTestUID(100)
+	names, err := c.ResolveUIDs(context.Background(), []keybase1.UID{
+		users[0].UID, users[1].UID, users[0].UID, tid, unknownUID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[keybase1.UID]libkb.NormalizedUsername{
+		users[0].UID: users[0].Name,
+		users[1].UID: users[1].Name,
+		tid:          "t1",
+	}, names)
+}
+
 func TestKBPKIClientHasVerifyingKey(t *testing.T) {
 	c, _, localUsers := makeTestKBPKIClient(t)
 
@@ -0,0 +1,136 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// kbpkiContractUser is a user that a KBPKI under test must know
+// about, along with the keys of one of its devices.
+type kbpkiContractUser struct {
+	Name           libkb.NormalizedUsername
+	UID            keybase1.UID
+	VerifyingKey   kbfscrypto.VerifyingKey
+	CryptPublicKey kbfscrypto.CryptPublicKey
+}
+
+// testKBPKIContract checks the behavior that the rest of libkbfs
+// relies on from any KBPKI (see KBPKICn), given one that's logged in
+// as current, on the device with current's keys, and that also
+// knows about other.
+func testKBPKIContract(t *testing.T, kbpki KBPKI,
+	current, other kbpkiContractUser) {
+	ctx := context.Background()
+
+	// The current session must be consistent.
+	name, uid, err := kbpki.GetCurrentUserInfo(ctx)
+	require.NoError(t, err)
+	require.Equal(t, current.Name, name)
+	require.Equal(t, current.UID, uid)
+	verifyingKey, err := kbpki.GetCurrentVerifyingKey(ctx)
+	require.NoError(t, err)
+	require.Equal(t, current.VerifyingKey, verifyingKey)
+	cryptPublicKey, err := kbpki.GetCurrentCryptPublicKey(ctx)
+	require.NoError(t, err)
+	require.Equal(t, current.CryptPublicKey, cryptPublicKey)
+
+	// Names and UIDs must resolve to each other, and unknown ones
+	// must give a NoSuchUserError.
+	for _, assertion := range []string{
+		other.Name.String(), "uid:" + other.UID.String(),
+	} {
+		name, uid, err := kbpki.Resolve(ctx, assertion)
+		require.NoError(t, err)
+		require.Equal(t, other.Name, name)
+		require.Equal(t, other.UID, uid)
+	}
+	_, _, err = kbpki.Resolve(ctx, "kbpki_contract_nobody")
+	require.IsType(t, NoSuchUserError{}, errors.Cause(err))
+
+	name, err = kbpki.GetNormalizedUsername(ctx, other.UID)
+	require.NoError(t, err)
+	require.Equal(t, other.Name, name)
+	names, err := kbpki.ResolveUIDs(
+		ctx, []keybase1.UID{current.UID, other.UID})
+	require.NoError(t, err)
+	require.Equal(t, map[keybase1.UID]libkb.NormalizedUsername{
+		current.UID: current.Name,
+		other.UID:   other.Name,
+	}, names)
+
+	userInfo, err := kbpki.Identify(ctx, other.Name.String(), "contract")
+	require.NoError(t, err)
+	require.Equal(t, other.Name, userInfo.Name)
+	require.Equal(t, other.UID, userInfo.UID)
+
+	// Keys must belong to their users, and only to them.
+	err = kbpki.HasVerifyingKey(ctx, other.UID, other.VerifyingKey,
+		time.Now())
+	require.NoError(t, err)
+	err = kbpki.HasVerifyingKey(ctx, other.UID, current.VerifyingKey,
+		time.Now())
+	require.IsType(t, KeyNotFoundError{}, errors.Cause(err))
+	err = kbpki.HasUnverifiedVerifyingKey(ctx, other.UID, other.VerifyingKey)
+	require.NoError(t, err)
+
+	cryptPublicKeys, err := kbpki.GetCryptPublicKeys(ctx, other.UID)
+	require.NoError(t, err)
+	require.Contains(t, cryptPublicKeys, other.CryptPublicKey)
+	require.NotContains(t, cryptPublicKeys, current.CryptPublicKey)
+}
+
+func makeKBPKIContractUser(user LocalUser) kbpkiContractUser {
+	return kbpkiContractUser{
+		Name:           user.Name,
+		UID:            user.UID,
+		VerifyingKey:   user.GetCurrentVerifyingKey(),
+		CryptPublicKey: user.GetCurrentCryptPublicKey(),
+	}
+}
+
+func TestKBPKIClientContract(t *testing.T) {
+	c, _, users := makeTestKBPKIClient(t)
+	testKBPKIContract(t, c, makeKBPKIContractUser(users[0]),
+		makeKBPKIContractUser(users[1]))
+}
+
+// testKBPKICn is a KeybaseServiceCn that supplies its own KBPKI.
+type testKBPKICn struct {
+	keybaseDaemon
+	kbpki KBPKI
+}
+
+var _ KBPKICn = (*testKBPKICn)(nil)
+
+func (cn *testKBPKICn) NewKBPKI(config Config, params InitParams,
+	ctx Context, log logger.Logger) (KBPKI, error) {
+	return cn.kbpki, nil
+}
+
+func TestMakeKBPKI(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "alice")
+	defer CheckConfigAndShutdown(context.Background(), t, config)
+
+	k, err := makeKBPKI(config, InitParams{}, nil, &keybaseDaemon{},
+		config.MakeLogger(""))
+	require.NoError(t, err)
+	require.IsType(t, &KBPKIClient{}, k)
+
+	c, _, _ := makeTestKBPKIClient(t)
+	k, err = makeKBPKI(config, InitParams{}, nil, &testKBPKICn{kbpki: c},
+		config.MakeLogger(""))
+	require.NoError(t, err)
+	require.Equal(t, c, k)
+}
@@ -58,6 +58,11 @@ func (d *daemonKBPKI) GetNormalizedUsername(ctx context.Context, uid keybase1.UI
 	return userInfo.Name, nil
 }
 
+func (d *daemonKBPKI) GetTeamInfo(ctx context.Context, tid keybase1.UID) (
+	TeamInfo, error) {
+	return d.daemon.LoadTeam(ctx, tid)
+}
+
 // interposeDaemonKBPKI replaces the existing (mock) KBPKI with a
 // daemonKBPKI that handles all the username-related calls.
 //
@@ -59,6 +59,10 @@ func (km *KeyManagerStandard) GetTLFCryptKeyForBlockDecryption(
 func (km *KeyManagerStandard) GetTLFCryptKeyOfAllGenerations(
 	ctx context.Context, kmd KeyMetadata) (
 	keys []kbfscrypto.TLFCryptKey, err error) {
+	err = km.cacheUncachedTLFCryptKeys(ctx, kmd)
+	if err != nil {
+		return nil, err
+	}
 	for g := FirstValidKeyGen; g <= kmd.LatestKeyGeneration(); g++ {
 		var key kbfscrypto.TLFCryptKey
 		key, err = km.getTLFCryptKeyUsingCurrentDevice(ctx, kmd, g, true)
@@ -70,6 +74,69 @@ func (km *KeyManagerStandard) GetTLFCryptKeyOfAllGenerations(
 	return keys, nil
 }
 
+// cacheUncachedTLFCryptKeys gets the server halves of all the
+// uncached key generations of kmd using the current device from the
+// key server in one batch, and caches the unmasked keys. It does
+// nothing if the historic keys of kmd aren't encrypted per device,
+// since then they're all derived from the latest key.
+func (km *KeyManagerStandard) cacheUncachedTLFCryptKeys(
+	ctx context.Context, kmd KeyMetadata) error {
+	tlfID := kmd.TlfID()
+	if tlfID.IsPublic() {
+		return nil
+	}
+
+	kcache := km.config.KeyCache()
+	var keyGens []KeyGen
+	for g := FirstValidKeyGen; g <= kmd.LatestKeyGeneration(); g++ {
+		_, err := kcache.GetTLFCryptKey(tlfID, g)
+		switch err := err.(type) {
+		case nil:
+		case KeyCacheMissError:
+			keyGens = append(keyGens, g)
+		default:
+			return err
+		}
+	}
+	if len(keyGens) < 2 {
+		// Nothing to gain from batching.
+		return nil
+	}
+
+	username, uid, err := km.config.KBPKI().GetCurrentUserInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	clientHalves := make([]kbfscrypto.TLFCryptKeyClientHalf, len(keyGens))
+	serverHalfIDs := make([]TLFCryptKeyServerHalfID, len(keyGens))
+	var cryptPublicKey kbfscrypto.CryptPublicKey
+	for i, g := range keyGens {
+		clientHalves[i], serverHalfIDs[i], cryptPublicKey, err =
+			km.getTLFCryptKeyParams(ctx, kmd, g, uid, username, 0)
+		if _, ok := err.(TLFCryptKeyNotPerDeviceEncrypted); ok {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	serverHalves, err := km.config.KeyOps().GetTLFCryptKeyServerHalves(
+		ctx, serverHalfIDs, cryptPublicKey)
+	if err != nil {
+		return err
+	}
+
+	for i, g := range keyGens {
+		tlfCryptKey := kbfscrypto.UnmaskTLFCryptKey(
+			serverHalves[i], clientHalves[i])
+		if err := kcache.PutTLFCryptKey(tlfID, g, tlfCryptKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (km *KeyManagerStandard) getTLFCryptKeyUsingCurrentDevice(
 	ctx context.Context, kmd KeyMetadata, keyGen KeyGen, cache bool) (
 	tlfCryptKey kbfscrypto.TLFCryptKey, err error) {
@@ -326,19 +393,10 @@ func (km *KeyManagerStandard) updateKeyBundles(ctx context.Context,
 		return err
 	}
 
-	// Push new keys to the key server.
-	//
-	// TODO: Should accumulate the server halves across multiple
-	// key generations and push them all at once right before the
-	// MD push, although this only really matters for MDv2.
-	for _, serverHalvesGen := range serverHalves {
-		if err = km.config.KeyOps().
-			PutTLFCryptKeyServerHalves(ctx, serverHalvesGen); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	// Push the new keys of all key generations to the key server
+	// at once, which only really matters for MDv2.
+	return km.config.KeyOps().PutTLFCryptKeyServerHalvesBatch(
+		ctx, serverHalves)
 }
 
 func (km *KeyManagerStandard) usersWithNewDevices(ctx context.Context,
@@ -373,9 +431,8 @@ func (km *KeyManagerStandard) usersWithRemovedDevices(ctx context.Context,
 	for u, deviceKeys := range keys {
 		expectedDeviceKeys, ok := expectedKeys[u]
 		if !ok {
-			// Currently there probably shouldn't be any users removed
-			// from the handle, but don't error just in case we ever
-			// want to support that in the future.
+			// Users are only removed when they leave the team
+			// that owns the TLF.
 			km.log.CInfof(ctx, "Rekey %s: removing user %s", tlfID, u)
 			users[u] = true
 			continue
@@ -442,12 +499,31 @@ func (km *KeyManagerStandard) generateKeyMapForUsers(
 }
 
 // Rekey implements the KeyManager interface for KeyManagerStandard.
+func (km *KeyManagerStandard) Rekey(ctx context.Context, md *RootMetadata, promptPaper bool) (
+	mdChanged bool, cryptKey *kbfscrypto.TLFCryptKey, err error) {
+	return km.rekey(ctx, md, promptPaper, false)
+}
+
+// RotateKey implements the KeyManager interface for
+// KeyManagerStandard.
+func (km *KeyManagerStandard) RotateKey(ctx context.Context, md *RootMetadata) (
+	mdChanged bool, cryptKey *kbfscrypto.TLFCryptKey, err error) {
+	if md.TlfID().IsPublic() {
+		return false, nil, errors.Errorf(
+			"Can't rotate the key of public TLF %v", md.TlfID())
+	}
+	return km.rekey(ctx, md, false, true)
+}
+
+// rekey does the work for Rekey and RotateKey. If rotate is set, a
+// new key generation is added even if no devices were revoked.
 //
 // TODO: Make this less terrible. See KBFS-1799.
-func (km *KeyManagerStandard) Rekey(ctx context.Context, md *RootMetadata, promptPaper bool) (
+func (km *KeyManagerStandard) rekey(ctx context.Context, md *RootMetadata,
+	promptPaper, rotate bool) (
 	mdChanged bool, cryptKey *kbfscrypto.TLFCryptKey, err error) {
-	km.log.CDebugf(ctx, "Rekey %s (prompt for paper key: %t)",
-		md.TlfID(), promptPaper)
+	km.log.CDebugf(ctx, "Rekey %s (prompt for paper key: %t, rotate: %t)",
+		md.TlfID(), promptPaper, rotate)
 	defer func() { km.deferLog.CDebugf(ctx, "Rekey %s done: %+v", md.TlfID(), err) }()
 
 	currKeyGen := md.LatestKeyGeneration()
@@ -461,19 +537,29 @@ func (km *KeyManagerStandard) Rekey(ctx context.Context, md *RootMetadata, promp
 		return false, nil, errors.Errorf("promptPaper set for public TLF %v", md.TlfID())
 	}
 
-	handle := md.GetTlfHandle()
-
 	username, uid, err := km.config.KBPKI().GetCurrentUserInfo(ctx)
 	if err != nil {
 		return false, nil, err
 	}
 
+	// The membership of a team may have changed since the handle
+	// was made, so look it up again.
+	handle, err := md.GetTlfHandle().withCurrentTeam(ctx, km.config.KBPKI())
+	if err != nil {
+		return false, nil, err
+	}
+
 	resolvedHandle, err := handle.ResolveAgain(ctx, km.config.KBPKI())
 	if err != nil {
 		return false, nil, err
 	}
 
 	isWriter := resolvedHandle.IsWriter(uid)
+	if rotate && !isWriter {
+		// Only writers can add key generations.
+		return false, nil, NewWriteAccessError(
+			resolvedHandle, username, resolvedHandle.GetCanonicalPath())
+	}
 	if !md.TlfID().IsPublic() && !isWriter {
 		// If I was already a reader, there's nothing more to do
 		if handle.IsReader(uid) {
@@ -537,13 +623,13 @@ func (km *KeyManagerStandard) Rekey(ctx context.Context, md *RootMetadata, promp
 
 	// All writer keys in the desired keyset
 	updatedWriterKeys, err := km.generateKeyMapForUsers(
-		ctx, resolvedHandle.ResolvedWriters())
+		ctx, resolvedHandle.writerUsers())
 	if err != nil {
 		return false, nil, err
 	}
 	// All reader keys in the desired keyset
 	updatedReaderKeys, err := km.generateKeyMapForUsers(
-		ctx, resolvedHandle.ResolvedReaders())
+		ctx, resolvedHandle.readerUsers())
 	if err != nil {
 		return false, nil, err
 	}
@@ -601,7 +687,8 @@ func (km *KeyManagerStandard) Rekey(ctx context.Context, md *RootMetadata, promp
 			newWriterUsers[u] = true
 		}
 
-		incKeyGen = len(wRemoved) > 0 || (len(rRemoved) > len(readersToPromote))
+		incKeyGen = rotate || len(wRemoved) > 0 ||
+			(len(rRemoved) > len(readersToPromote))
 
 		if err := km.identifyUIDSets(ctx, md.TlfID(), newWriterUsers, newReaderUsers); err != nil {
 			return false, nil, err
@@ -764,7 +851,7 @@ func (km *KeyManagerStandard) Rekey(ctx context.Context, md *RootMetadata, promp
 			return false, nil, err
 		}
 
-		if len(allRemovalInfo) == 0 {
+		if len(allRemovalInfo) == 0 && !rotate {
 			return false, nil, errors.New(
 				"Didn't revoke any devices, but indicated incrementing the key generation")
 		}
@@ -162,7 +162,11 @@ func expectRekey(config *ConfigMock, bh tlf.Handle, numDevices int,
 	config.mockCrypto.EXPECT().EncryptTLFCryptKeyClientHalf(
 		kbfscrypto.TLFEphemeralPrivateKey{}, subkey, clientHalf).Return(
 		EncryptedTLFCryptKeyClientHalf{}, nil).Times(numDevices)
-	config.mockKops.EXPECT().PutTLFCryptKeyServerHalves(gomock.Any(), gomock.Any()).Return(nil)
+	if expectNewKeyGen {
+		config.mockKops.EXPECT().PutTLFCryptKeyServerHalves(gomock.Any(), gomock.Any()).Return(nil)
+	} else {
+		config.mockKops.EXPECT().PutTLFCryptKeyServerHalvesBatch(gomock.Any(), gomock.Any()).Return(nil)
+	}
 	config.mockCrypto.EXPECT().GetTLFCryptKeyServerHalfID(gomock.Any(), gomock.Any(), gomock.Any()).Return(TLFCryptKeyServerHalfID{}, nil).Times(numDevices)
 
 	// Ignore Notify and Flush calls for now
@@ -2144,6 +2148,69 @@ func testKeyManagerRekeyAddDeviceWithPromptViaFolderAccess(t *testing.T, ver Met
 	GetRootNodeOrBust(ctx, t, config2Dev2, name, false)
 }
 
+func testKeyManagerRotateKey(t *testing.T, ver MetadataVer) {
+	var u1, u2 libkb.NormalizedUsername = "u1", "u2"
+	config1, _, ctx, cancel := kbfsOpsConcurInit(t, u1, u2)
+	defer kbfsConcurTestShutdown(t, config1, ctx, cancel)
+
+	config1.SetMetadataVersion(ver)
+
+	config2 := ConfigAsUser(config1, u2)
+	defer CheckConfigAndShutdown(ctx, t, config2)
+
+	// Create a shared folder
+	name := u1.String() + "," + u2.String()
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, false)
+	kbfsOps1 := config1.KBFSOps()
+	tlfID := rootNode1.GetFolderBranch().Tlf
+
+	// user 1 creates a file
+	_, _, err := kbfsOps1.CreateFile(ctx, rootNode1, "a", false, NoExcl)
+	if err != nil {
+		t.Fatalf("Couldn't create file: %+v", err)
+	}
+
+	rmd, err := config1.MDOps().GetForTLF(ctx, tlfID)
+	if err != nil {
+		t.Fatalf("Couldn't get latest md: %+v", err)
+	}
+	keyGen := rmd.LatestKeyGeneration()
+
+	// Nothing has changed about the devices, but a rotation
+	// should still add a key generation.
+	err = kbfsOps1.RotateKey(ctx, tlfID)
+	if err != nil {
+		t.Fatalf("Couldn't rotate key: %+v", err)
+	}
+
+	rmd, err = config1.MDOps().GetForTLF(ctx, tlfID)
+	if err != nil {
+		t.Fatalf("Couldn't get latest md: %+v", err)
+	}
+	if g, e := rmd.LatestKeyGeneration(), keyGen+1; g != e {
+		t.Fatalf("Expected key generation %d, got %d", e, g)
+	}
+
+	// user 2 can still read the old data, and write new data.
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, name, false)
+	kbfsOps2 := config2.KBFSOps()
+	_, _, err = kbfsOps2.Lookup(ctx, rootNode2, "a")
+	if err != nil {
+		t.Fatalf("Couldn't lookup file: %+v", err)
+	}
+	_, _, err = kbfsOps2.CreateFile(ctx, rootNode2, "b", false, NoExcl)
+	if err != nil {
+		t.Fatalf("Couldn't create file: %+v", err)
+	}
+
+	// Public folders have no keys to rotate.
+	publicNode := GetRootNodeOrBust(ctx, t, config1, name, true)
+	err = kbfsOps1.RotateKey(ctx, publicNode.GetFolderBranch().Tlf)
+	if err == nil {
+		t.Fatal("Unexpectedly rotated the key of a public folder")
+	}
+}
+
 func TestKeyManager(t *testing.T) {
 	tests := []func(*testing.T, MetadataVer){
 		testKeyManagerPublicTLFCryptKey,
@@ -2172,6 +2239,7 @@ func TestKeyManager(t *testing.T) {
 		testKeyManagerRekeyAddDeviceWithPrompt,
 		testKeyManagerRekeyAddDeviceWithPromptAfterRestart,
 		testKeyManagerRekeyAddDeviceWithPromptViaFolderAccess,
+		testKeyManagerRotateKey,
 	}
 	runTestsOverMetadataVers(t, "testKeyManager", tests)
 }
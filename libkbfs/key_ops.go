@@ -7,6 +7,7 @@ package libkbfs
 import (
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/pkg/errors"
 	"golang.org/x/net/context"
 )
 
@@ -43,6 +44,38 @@ func (k *KeyOpsStandard) GetTLFCryptKeyServerHalf(ctx context.Context,
 	return serverHalf, nil
 }
 
+// GetTLFCryptKeyServerHalves is an implementation of the KeyOps interface.
+func (k *KeyOpsStandard) GetTLFCryptKeyServerHalves(ctx context.Context,
+	serverHalfIDs []TLFCryptKeyServerHalfID, key kbfscrypto.CryptPublicKey) (
+	[]kbfscrypto.TLFCryptKeyServerHalf, error) {
+	// get the key halves from the server
+	serverHalves, err := k.config.KeyServer().GetTLFCryptKeyServerHalves(
+		ctx, serverHalfIDs, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(serverHalves) != len(serverHalfIDs) {
+		return nil, errors.Errorf("Expected %d server halves, got %d",
+			len(serverHalfIDs), len(serverHalves))
+	}
+	// get current uid and deviceKID
+	_, uid, err := k.config.KBPKI().GetCurrentUserInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// verify we got the expected keys
+	crypto := k.config.Crypto()
+	for i, serverHalf := range serverHalves {
+		err = crypto.VerifyTLFCryptKeyServerHalfID(
+			serverHalfIDs[i], uid, key.KID(), serverHalf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return serverHalves, nil
+}
+
 // PutTLFCryptKeyServerHalves is an implementation of the KeyOps interface.
 func (k *KeyOpsStandard) PutTLFCryptKeyServerHalves(ctx context.Context,
 	keyServerHalves UserDeviceKeyServerHalves) error {
@@ -50,6 +83,15 @@ func (k *KeyOpsStandard) PutTLFCryptKeyServerHalves(ctx context.Context,
 	return k.config.KeyServer().PutTLFCryptKeyServerHalves(ctx, keyServerHalves)
 }
 
+// PutTLFCryptKeyServerHalvesBatch is an implementation of the KeyOps
+// interface.
+func (k *KeyOpsStandard) PutTLFCryptKeyServerHalvesBatch(ctx context.Context,
+	keyServerHalves []UserDeviceKeyServerHalves) error {
+	// upload the keys
+	return k.config.KeyServer().PutTLFCryptKeyServerHalvesBatch(
+		ctx, keyServerHalves)
+}
+
 // DeleteTLFCryptKeyServerHalf is an implementation of the KeyOps interface.
 func (k *KeyOpsStandard) DeleteTLFCryptKeyServerHalf(ctx context.Context,
 	uid keybase1.UID, kid keybase1.KID,
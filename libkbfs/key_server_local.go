@@ -15,6 +15,7 @@ import (
 	"github.com/keybase/kbfs/ioutil"
 	"github.com/keybase/kbfs/kbfscrypto"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/storage"
 	"golang.org/x/net/context"
 )
@@ -34,8 +35,9 @@ type KeyServerLocal struct {
 var _ KeyServer = (*KeyServerLocal)(nil)
 
 func newKeyServerLocal(config Config, storage storage.Storage,
-	shutdownFunc func(logger.Logger)) (*KeyServerLocal, error) {
-	db, err := leveldb.Open(storage, leveldbOptions)
+	options *opt.Options, shutdownFunc func(logger.Logger)) (
+	*KeyServerLocal, error) {
+	db, err := leveldb.Open(storage, options)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +49,8 @@ func newKeyServerLocal(config Config, storage storage.Storage,
 // NewKeyServerMemory returns a KeyServerLocal with an in-memory leveldb
 // instance.
 func NewKeyServerMemory(config Config) (*KeyServerLocal, error) {
-	return newKeyServerLocal(config, storage.NewMemStorage(), nil)
+	return newKeyServerLocal(
+		config, storage.NewMemStorage(), leveldbOptions, nil)
 }
 
 func newKeyServerDisk(
@@ -58,7 +61,14 @@ func newKeyServerDisk(
 	if err != nil {
 		return nil, err
 	}
-	return newKeyServerLocal(config, storage, shutdownFunc)
+	return newKeyServerLocal(config, storage, leveldbOptions, shutdownFunc)
+}
+
+// newKeyServerS3 constructs a new KeyServerLocal that stores its
+// data in the given S3-compatible bucket.
+func newKeyServerS3(config Config, bucket *s3Bucket) (*KeyServerLocal, error) {
+	return newKeyServerLocal(config,
+		newS3LevelDBStorage(bucket.withPrefix("keys")), s3LevelDBOptions, nil)
 }
 
 // NewKeyServerDir constructs a new KeyServerLocal that stores its
@@ -121,9 +131,60 @@ func (ks *KeyServerLocal) GetTLFCryptKeyServerHalf(ctx context.Context,
 	return serverHalf, nil
 }
 
+// GetTLFCryptKeyServerHalves implements the KeyServer interface for
+// KeyServerLocal.
+func (ks *KeyServerLocal) GetTLFCryptKeyServerHalves(ctx context.Context,
+	serverHalfIDs []TLFCryptKeyServerHalfID, key kbfscrypto.CryptPublicKey) (
+	[]kbfscrypto.TLFCryptKeyServerHalf, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	ks.shutdownLock.RLock()
+	defer ks.shutdownLock.RUnlock()
+	if *ks.shutdown {
+		return nil, errors.New("Key server already shut down")
+	}
+
+	_, uid, err := ks.config.KBPKI().GetCurrentUserInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	serverHalves := make(
+		[]kbfscrypto.TLFCryptKeyServerHalf, len(serverHalfIDs))
+	for i, serverHalfID := range serverHalfIDs {
+		buf, err := ks.db.Get(serverHalfID.ID.Bytes(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		err = ks.config.Codec().Decode(buf, &serverHalves[i])
+		if err != nil {
+			return nil, err
+		}
+
+		err = ks.config.Crypto().VerifyTLFCryptKeyServerHalfID(
+			serverHalfID, uid, key.KID(), serverHalves[i])
+		if err != nil {
+			ks.log.CDebugf(ctx, "error verifying server half ID: %s", err)
+			return nil, MDServerErrorUnauthorized{}
+		}
+	}
+	return serverHalves, nil
+}
+
 // PutTLFCryptKeyServerHalves implements the KeyOps interface for KeyServerLocal.
 func (ks *KeyServerLocal) PutTLFCryptKeyServerHalves(ctx context.Context,
 	keyServerHalves UserDeviceKeyServerHalves) error {
+	return ks.PutTLFCryptKeyServerHalvesBatch(
+		ctx, []UserDeviceKeyServerHalves{keyServerHalves})
+}
+
+// PutTLFCryptKeyServerHalvesBatch implements the KeyServer interface
+// for KeyServerLocal.
+func (ks *KeyServerLocal) PutTLFCryptKeyServerHalvesBatch(ctx context.Context,
+	keyServerHalves []UserDeviceKeyServerHalves) error {
 	if err := checkContext(ctx); err != nil {
 		return err
 	}
@@ -137,17 +198,20 @@ func (ks *KeyServerLocal) PutTLFCryptKeyServerHalves(ctx context.Context,
 	// batch up the writes such that they're atomic.
 	batch := &leveldb.Batch{}
 	crypto := ks.config.Crypto()
-	for uid, deviceMap := range keyServerHalves {
-		for deviceKID, serverHalf := range deviceMap {
-			buf, err := ks.config.Codec().Encode(serverHalf)
-			if err != nil {
-				return err
-			}
-			id, err := crypto.GetTLFCryptKeyServerHalfID(uid, deviceKID, serverHalf)
-			if err != nil {
-				return err
+	for _, serverHalvesGen := range keyServerHalves {
+		for uid, deviceMap := range serverHalvesGen {
+			for deviceKID, serverHalf := range deviceMap {
+				buf, err := ks.config.Codec().Encode(serverHalf)
+				if err != nil {
+					return err
+				}
+				id, err := crypto.GetTLFCryptKeyServerHalfID(
+					uid, deviceKID, serverHalf)
+				if err != nil {
+					return err
+				}
+				batch.Put(id.ID.Bytes(), buf)
 			}
-			batch.Put(id.ID.Bytes(), buf)
 		}
 	}
 	return ks.db.Write(batch, nil)
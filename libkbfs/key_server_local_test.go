@@ -9,6 +9,7 @@ import (
 
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 )
 
@@ -153,3 +154,84 @@ func TestKeyServerLocalTLFCryptKeyServerHalves(t *testing.T) {
 		t.Error("GetTLFCryptKeyServerHalf(id2, keyGen2, publicKey2) unexpectedly succeeded")
 	}
 }
+
+// Test that batched Put/Get works for TLF crypt key server halves,
+// with a key server made by makeKeyServer, or the default one if
+// it's nil.
+func testKeyServerLocalTLFCryptKeyServerHalvesBatch(t *testing.T,
+	makeKeyServer func(config Config) (*KeyServerLocal, error)) {
+	var userName1, userName2 libkb.NormalizedUsername = "u1", "u2"
+	config1, uid1, ctx, cancel := kbfsOpsConcurInit(t, userName1, userName2)
+	defer kbfsConcurTestShutdown(t, config1, ctx, cancel)
+	if makeKeyServer != nil {
+		ks, err := makeKeyServer(config1)
+		require.NoError(t, err)
+		config1.KeyServer().Shutdown()
+		config1.SetKeyServer(ks)
+	}
+
+	config2 := ConfigAsUser(config1, userName2)
+	defer CheckConfigAndShutdown(ctx, t, config2)
+	_, uid2, err := config2.KBPKI().GetCurrentUserInfo(ctx)
+	require.NoError(t, err)
+
+	publicKey1, err := config1.KBPKI().GetCurrentCryptPublicKey(ctx)
+	require.NoError(t, err)
+	publicKey2, err := config2.KBPKI().GetCurrentCryptPublicKey(ctx)
+	require.NoError(t, err)
+
+	// Write one key generation per server half, all at once.
+	serverHalves := []kbfscrypto.TLFCryptKeyServerHalf{
+		kbfscrypto.MakeTLFCryptKeyServerHalf([32]byte{1}),
+		kbfscrypto.MakeTLFCryptKeyServerHalf([32]byte{2}),
+		kbfscrypto.MakeTLFCryptKeyServerHalf([32]byte{3}),
+	}
+	serverHalf4 := kbfscrypto.MakeTLFCryptKeyServerHalf([32]byte{4})
+	var keyHalves []UserDeviceKeyServerHalves
+	for _, serverHalf := range serverHalves {
+		keyHalves = append(keyHalves, UserDeviceKeyServerHalves{
+			uid1: DeviceKeyServerHalves{publicKey1: serverHalf},
+		})
+	}
+	keyHalves[0][uid2] = DeviceKeyServerHalves{publicKey2: serverHalf4}
+	err = config1.KeyOps().PutTLFCryptKeyServerHalvesBatch(ctx, keyHalves)
+	require.NoError(t, err)
+
+	serverHalfIDs := make([]TLFCryptKeyServerHalfID, len(serverHalves))
+	for i, serverHalf := range serverHalves {
+		serverHalfIDs[i], err = config1.Crypto().GetTLFCryptKeyServerHalfID(
+			uid1, publicKey1, serverHalf)
+		require.NoError(t, err)
+	}
+	serverHalfID4, err := config1.Crypto().GetTLFCryptKeyServerHalfID(
+		uid2, publicKey2, serverHalf4)
+	require.NoError(t, err)
+
+	halves, err := config1.KeyOps().GetTLFCryptKeyServerHalves(
+		ctx, serverHalfIDs, publicKey1)
+	require.NoError(t, err)
+	require.Equal(t, serverHalves, halves)
+
+	halves, err = config2.KeyOps().GetTLFCryptKeyServerHalves(
+		ctx, []TLFCryptKeyServerHalfID{serverHalfID4}, publicKey2)
+	require.NoError(t, err)
+	require.Equal(t, []kbfscrypto.TLFCryptKeyServerHalf{serverHalf4}, halves)
+
+	// A single bad ID fails the whole batch.
+	_, err = config1.KeyOps().GetTLFCryptKeyServerHalves(ctx,
+		append(serverHalfIDs, serverHalfID4), publicKey1)
+	require.IsType(t, MDServerErrorUnauthorized{}, err)
+}
+
+func TestKeyServerLocalTLFCryptKeyServerHalvesBatch(t *testing.T) {
+	testKeyServerLocalTLFCryptKeyServerHalvesBatch(t, nil)
+}
+
+func TestKeyServerS3TLFCryptKeyServerHalvesBatch(t *testing.T) {
+	bucket, _, server := makeFakeS3BucketForTest(t)
+	defer server.Close()
+	testKeyServerLocalTLFCryptKeyServerHalvesBatch(t,
+		func(config Config) (*KeyServerLocal, error) {
+			return newKeyServerS3(config, bucket)
+		})
+}
@@ -14,10 +14,12 @@ import (
 // KeyServerMeasured delegates to another KeyServer instance but
 // also keeps track of stats.
 type KeyServerMeasured struct {
-	delegate    KeyServer
-	getTimer    metrics.Timer
-	putTimer    metrics.Timer
-	deleteTimer metrics.Timer
+	delegate     KeyServer
+	getCall      measuredCall
+	getBatchCall measuredCall
+	putCall      measuredCall
+	putBatchCall measuredCall
+	deleteCall   measuredCall
 }
 
 var _ KeyServer = KeyServerMeasured{}
@@ -25,14 +27,19 @@ var _ KeyServer = KeyServerMeasured{}
 // NewKeyServerMeasured creates and returns a new KeyServerMeasured
 // instance with the given delegate and registry.
 func NewKeyServerMeasured(delegate KeyServer, r metrics.Registry) KeyServerMeasured {
-	getTimer := metrics.GetOrRegisterTimer("KeyServer.GetTLFCryptKeyServerHalf", r)
-	putTimer := metrics.GetOrRegisterTimer("KeyServer.PutTLFCryptKeyServerHalves", r)
-	deleteTimer := metrics.GetOrRegisterTimer("KeyServer.DeleteTLFCryptKeyServerHalf", r)
+	getCall := makeMeasuredCall("KeyServer.GetTLFCryptKeyServerHalf", r)
+	getBatchCall := makeMeasuredCall("KeyServer.GetTLFCryptKeyServerHalves", r)
+	putCall := makeMeasuredCall("KeyServer.PutTLFCryptKeyServerHalves", r)
+	putBatchCall := makeMeasuredCall(
+		"KeyServer.PutTLFCryptKeyServerHalvesBatch", r)
+	deleteCall := makeMeasuredCall("KeyServer.DeleteTLFCryptKeyServerHalf", r)
 	return KeyServerMeasured{
-		delegate:    delegate,
-		getTimer:    getTimer,
-		putTimer:    putTimer,
-		deleteTimer: deleteTimer,
+		delegate:     delegate,
+		getCall:      getCall,
+		getBatchCall: getBatchCall,
+		putCall:      putCall,
+		putBatchCall: putBatchCall,
+		deleteCall:   deleteCall,
 	}
 }
 
@@ -41,18 +48,45 @@ func NewKeyServerMeasured(delegate KeyServer, r metrics.Registry) KeyServerMeasu
 func (b KeyServerMeasured) GetTLFCryptKeyServerHalf(ctx context.Context,
 	serverHalfID TLFCryptKeyServerHalfID, key kbfscrypto.CryptPublicKey) (
 	serverHalf kbfscrypto.TLFCryptKeyServerHalf, err error) {
-	b.getTimer.Time(func() {
+	b.getCall.time(func() error {
 		serverHalf, err = b.delegate.GetTLFCryptKeyServerHalf(ctx, serverHalfID, key)
+		return err
 	})
 	return serverHalf, err
 }
 
+// GetTLFCryptKeyServerHalves implements the KeyServer interface for
+// KeyServerMeasured.
+func (b KeyServerMeasured) GetTLFCryptKeyServerHalves(ctx context.Context,
+	serverHalfIDs []TLFCryptKeyServerHalfID, key kbfscrypto.CryptPublicKey) (
+	serverHalves []kbfscrypto.TLFCryptKeyServerHalf, err error) {
+	b.getBatchCall.time(func() error {
+		serverHalves, err = b.delegate.GetTLFCryptKeyServerHalves(
+			ctx, serverHalfIDs, key)
+		return err
+	})
+	return serverHalves, err
+}
+
 // PutTLFCryptKeyServerHalves implements the KeyServer interface for
 // KeyServerMeasured.
 func (b KeyServerMeasured) PutTLFCryptKeyServerHalves(ctx context.Context,
 	keyServerHalves UserDeviceKeyServerHalves) (err error) {
-	b.putTimer.Time(func() {
+	b.putCall.time(func() error {
 		err = b.delegate.PutTLFCryptKeyServerHalves(ctx, keyServerHalves)
+		return err
+	})
+	return err
+}
+
+// PutTLFCryptKeyServerHalvesBatch implements the KeyServer interface
+// for KeyServerMeasured.
+func (b KeyServerMeasured) PutTLFCryptKeyServerHalvesBatch(
+	ctx context.Context,
+	keyServerHalves []UserDeviceKeyServerHalves) (err error) {
+	b.putBatchCall.time(func() error {
+		err = b.delegate.PutTLFCryptKeyServerHalvesBatch(ctx, keyServerHalves)
+		return err
 	})
 	return err
 }
@@ -62,9 +96,10 @@ func (b KeyServerMeasured) PutTLFCryptKeyServerHalves(ctx context.Context,
 func (b KeyServerMeasured) DeleteTLFCryptKeyServerHalf(ctx context.Context,
 	uid keybase1.UID, kid keybase1.KID,
 	serverHalfID TLFCryptKeyServerHalfID) (err error) {
-	b.deleteTimer.Time(func() {
+	b.deleteCall.time(func() error {
 		err = b.delegate.DeleteTLFCryptKeyServerHalf(
 			ctx, uid, kid, serverHalfID)
+		return err
 	})
 	return err
 }
@@ -8,53 +8,82 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"sync"
 
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/kbfscrypto"
 )
 
 // keybaseDaemon is the default KeybaseServiceCn implementation, which
 // can use the RPC or local (for debug).
-type keybaseDaemon struct{}
+type keybaseDaemon struct {
+	// Deriving the paper keys is deliberately slow, so it's done
+	// once for both NewKeybaseService and NewCrypto.
+	paperKeyOnce         sync.Once
+	paperSigningKey      kbfscrypto.SigningKey
+	paperCryptPrivateKey kbfscrypto.CryptPrivateKey
+	paperKeyErr          error
+}
+
+func (k *keybaseDaemon) readPaperKeyFile(path string) (
+	kbfscrypto.SigningKey, kbfscrypto.CryptPrivateKey, error) {
+	k.paperKeyOnce.Do(func() {
+		k.paperSigningKey, k.paperCryptPrivateKey, k.paperKeyErr =
+			ReadPaperKeyFile(path)
+	})
+	return k.paperSigningKey, k.paperCryptPrivateKey, k.paperKeyErr
+}
 
-func (k keybaseDaemon) NewKeybaseService(config Config, params InitParams, ctx Context, log logger.Logger) (KeybaseService, error) {
+func (k *keybaseDaemon) NewKeybaseService(config Config, params InitParams, ctx Context, log logger.Logger) (KeybaseService, error) {
 	localUser := libkb.NewNormalizedUsername(params.LocalUser)
 	if len(localUser) == 0 {
 		err := ctx.ConfigureSocketInfo()
 		if err != nil {
 			return nil, err
 		}
-		return NewKeybaseDaemonRPC(config, ctx, log, params.Debug), nil
+		service := NewKeybaseDaemonRPC(config, ctx, log, params.Debug)
+		if params.OfflineIdentityRoot != "" {
+			err := service.EnableOfflineIdentityCache(
+				config.Codec(), params.OfflineIdentityRoot)
+			if err != nil {
+				// Another KBFS process may already be using
+				// the cache, so just go without it.
+				log.Warning("Couldn't enable the offline identity "+
+					"cache: %+v", err)
+			}
+		}
+		if params.PaperKeyFile == "" {
+			return service, nil
+		}
+		signingKey, cryptPrivateKey, err :=
+			k.readPaperKeyFile(params.PaperKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return keybaseServicePaperKey{
+			KeybaseService: service,
+			cryptPublicKey: cryptPrivateKey.GetPublicKey(),
+			verifyingKey:   signingKey.GetVerifyingKey(),
+		}, nil
 	}
 
-	users := []libkb.NormalizedUsername{
-		"strib", "max", "chris", "akalin", "jzila", "alness",
-		"jinyang", "songgao", "taru", "zanderz",
+	specs := params.LocalUsers
+	if len(specs) == 0 {
+		specs = defaultLocalUserSpecs
 	}
 	userIndex := -1
-	for i := range users {
-		if localUser == users[i] {
+	for i := range specs {
+		if localUser == specs[i].Name {
 			userIndex = i
 			break
 		}
 	}
 	if userIndex < 0 {
-		return nil, fmt.Errorf("user %s not in list %v", localUser, users)
+		return nil, fmt.Errorf("user %s not in list %v", localUser, specs)
 	}
 
-	localUsers := MakeLocalUsers(users)
-
-	// TODO: Auto-generate these, too?
-	localUsers[0].Asserts = []string{"github:strib"}
-	localUsers[1].Asserts = []string{"twitter:maxtaco"}
-	localUsers[2].Asserts = []string{"twitter:malgorithms"}
-	localUsers[3].Asserts = []string{"twitter:fakalin"}
-	localUsers[4].Asserts = []string{"twitter:jzila"}
-	localUsers[5].Asserts = []string{"github:aalness"}
-	localUsers[6].Asserts = []string{"github:jinyangli"}
-	localUsers[7].Asserts = []string{"github:songgao"}
-	// No asserts for 8.
-	localUsers[9].Asserts = []string{"github:zanderz"}
+	localUsers := MakeLocalUsersFromSpecs(specs)
 
 	localUID := localUsers[userIndex].UID
 	codec := config.Codec()
@@ -71,10 +100,18 @@ func (k keybaseDaemon) NewKeybaseService(config Config, params InitParams, ctx C
 	return nil, errors.New("Can't user localuser without LocalFavoriteStorage being 'memory' or 'dir:/path/to/dir'")
 }
 
-func (k keybaseDaemon) NewCrypto(config Config, params InitParams, ctx Context, log logger.Logger) (Crypto, error) {
+func (k *keybaseDaemon) NewCrypto(config Config, params InitParams, ctx Context, log logger.Logger) (Crypto, error) {
 	var crypto Crypto
 	localUser := libkb.NewNormalizedUsername(params.LocalUser)
-	if localUser == "" {
+	if localUser == "" && params.PaperKeyFile != "" {
+		signingKey, cryptPrivateKey, err :=
+			k.readPaperKeyFile(params.PaperKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		crypto = NewCryptoLocal(
+			config.Codec(), signingKey, cryptPrivateKey)
+	} else if localUser == "" {
 		crypto = NewCryptoClientRPC(config, ctx)
 	} else {
 		signingKey := MakeLocalUserSigningKeyOrBust(localUser)
@@ -16,6 +16,7 @@ import (
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfscodec"
 	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
@@ -30,6 +31,12 @@ func (m localUserMap) getLocalUser(uid keybase1.UID) (LocalUser, error) {
 	return user, nil
 }
 
+// localTeam is a fake keybase team, for testing.
+type localTeam struct {
+	name    libkb.NormalizedUsername
+	members map[keybase1.UID]TeamRole
+}
+
 type favoriteStore interface {
 	FavoriteAdd(uid keybase1.UID, folder keybase1.Folder) error
 	FavoriteDelete(uid keybase1.UID, folder keybase1.Folder) error
@@ -132,6 +139,7 @@ type KeybaseDaemonLocal struct {
 	// lock protects everything below.
 	lock          sync.Mutex
 	localUsers    localUserMap
+	localTeams    map[keybase1.UID]localTeam
 	currentUID    keybase1.UID
 	asserts       map[string]keybase1.UID
 	favoriteStore favoriteStore
@@ -146,6 +154,19 @@ func (k *KeybaseDaemonLocal) setCurrentUID(uid keybase1.UID) {
 	k.currentUID = uid
 }
 
+// getLocalUserByName returns the local user with the given name.
+func (k *KeybaseDaemonLocal) getLocalUserByName(
+	name libkb.NormalizedUsername) (LocalUser, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	for _, user := range k.localUsers {
+		if user.Name == name {
+			return user, nil
+		}
+	}
+	return LocalUser{}, NoSuchUserError{name.String()}
+}
+
 func (k *KeybaseDaemonLocal) assertionToUIDLocked(ctx context.Context,
 	assertion string) (uid keybase1.UID, err error) {
 	expr, err := externals.AssertionParseAndOnly(assertion)
@@ -197,7 +218,14 @@ func (k *KeybaseDaemonLocal) Resolve(ctx context.Context, assertion string) (
 		return libkb.NormalizedUsername(""), keybase1.UID(""), err
 	}
 
-	return k.localUsers[uid].Name, uid, nil
+	if team, ok := k.localTeams[uid]; ok {
+		return team.name, uid, nil
+	}
+	u, err := k.localUsers.getLocalUser(uid)
+	if err != nil {
+		return libkb.NormalizedUsername(""), keybase1.UID(""), err
+	}
+	return u.Name, uid, nil
 }
 
 // Identify implements KeybaseDaemon for KeybaseDaemonLocal.
@@ -263,6 +291,22 @@ func (k *KeybaseDaemonLocal) LoadUnverifiedKeys(ctx context.Context, uid keybase
 	return u.UnverifiedKeys, nil
 }
 
+// LoadTeam implements KeybaseDaemon for KeybaseDaemonLocal.
+func (k *KeybaseDaemonLocal) LoadTeam(ctx context.Context, tid keybase1.UID) (
+	TeamInfo, error) {
+	if err := checkContext(ctx); err != nil {
+		return TeamInfo{}, err
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	team, ok := k.localTeams[tid]
+	if !ok {
+		return TeamInfo{}, NoSuchTeamError{tid.String()}
+	}
+	return MakeTeamInfo(team.name, tid, team.members), nil
+}
+
 // CurrentSession implements KeybaseDaemon for KeybaseDaemonLocal.
 func (k *KeybaseDaemonLocal) CurrentSession(ctx context.Context, sessionID int) (
 	SessionInfo, error) {
@@ -326,6 +370,45 @@ func (k *KeybaseDaemonLocal) removeAssertionForTest(assertion string) {
 	delete(k.asserts, assertion)
 }
 
+// addTeamForTest adds a new team with the given name and members,
+// and returns its ID. The team name must not already resolve to a
+// user or team.
+func (k *KeybaseDaemonLocal) addTeamForTest(name libkb.NormalizedUsername,
+	members map[keybase1.UID]TeamRole) (keybase1.UID, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if _, ok := k.asserts[string(name)]; ok {
+		return keybase1.UID(""), fmt.Errorf("%s already exists", name)
+	}
+
+	tid := tlf.FakeTeamID(uint32(len(k.localTeams) + 1))
+	membersCopy := make(map[keybase1.UID]TeamRole, len(members))
+	for uid, role := range members {
+		membersCopy[uid] = role
+	}
+	k.localTeams[tid] = localTeam{name, membersCopy}
+	k.asserts[string(name)] = tid
+	return tid, nil
+}
+
+// setTeamRoleForTest changes the role of the given user in the given
+// team. A zero role removes the user from the team.
+func (k *KeybaseDaemonLocal) setTeamRoleForTest(
+	tid, uid keybase1.UID, role TeamRole) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	team, ok := k.localTeams[tid]
+	if !ok {
+		return NoSuchTeamError{tid.String()}
+	}
+	if role == 0 {
+		delete(team.members, uid)
+	} else {
+		team.members[uid] = role
+	}
+	return nil
+}
+
 type makeKeysFunc func(libkb.NormalizedUsername, int) (
 	kbfscrypto.CryptPublicKey, kbfscrypto.VerifyingKey)
 
@@ -536,6 +619,7 @@ func newKeybaseDaemonLocal(codec kbfscodec.Codec,
 	return &KeybaseDaemonLocal{
 		codec:         codec,
 		localUsers:    localUserMap,
+		localTeams:    make(map[keybase1.UID]localTeam),
 		asserts:       asserts,
 		currentUID:    currentUID,
 		favoriteStore: favoriteStore,
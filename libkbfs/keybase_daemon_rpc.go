@@ -38,6 +38,10 @@ var _ keybase1.NotifyKeyfamilyInterface = (*KeybaseDaemonRPC)(nil)
 
 var _ keybase1.NotifyPaperKeyInterface = (*KeybaseDaemonRPC)(nil)
 
+var _ keybase1.NotifyUsersInterface = (*KeybaseDaemonRPC)(nil)
+
+var _ keybase1.NotifyFavoritesInterface = (*KeybaseDaemonRPC)(nil)
+
 var _ rpc.ConnectionHandler = (*KeybaseDaemonRPC)(nil)
 
 var _ KeybaseService = (*KeybaseDaemonRPC)(nil)
@@ -47,9 +51,11 @@ var _ KeybaseService = (*KeybaseDaemonRPC)(nil)
 func NewKeybaseDaemonRPC(config Config, kbCtx Context, log logger.Logger, debug bool) *KeybaseDaemonRPC {
 	k := newKeybaseDaemonRPC(config, kbCtx, log)
 	k.config = config
-	k.daemonLog = logger.NewWithCallDepth("daemon", 1)
+	k.daemonLog = wrapLoggerForFormat(
+		logger.NewWithCallDepth("daemon", 1), "daemon")
 	if debug {
 		k.daemonLog.Configure("", true, "")
+		applyLogModuleLevel("daemon")
 	}
 	conn := NewSharedKeybaseConnection(kbCtx, config, k)
 	k.fillClients(conn.GetClient())
@@ -239,6 +245,8 @@ func (k *KeybaseDaemonRPC) OnConnect(ctx context.Context,
 		keybase1.NotifySessionProtocol(k),
 		keybase1.NotifyKeyfamilyProtocol(k),
 		keybase1.NotifyPaperKeyProtocol(k),
+		keybase1.NotifyUsersProtocol(k),
+		keybase1.NotifyFavoritesProtocol(k),
 		keybase1.NotifyFSRequestProtocol(k),
 		keybase1.TlfKeysProtocol(k),
 		keybase1.SimpleFSProtocol(&simplefs.SimpleFS{}),
@@ -264,6 +272,8 @@ func (k *KeybaseDaemonRPC) OnConnect(ctx context.Context,
 		Session:     true,
 		Paperkeys:   true,
 		Keyfamily:   true,
+		Users:       true,
+		Favorites:   true,
 		Kbfsrequest: true,
 	})
 	if err != nil {
@@ -283,6 +293,7 @@ func (k *KeybaseDaemonRPC) OnConnect(ctx context.Context,
 		return err
 	}
 
+	k.setOffline(false)
 	return nil
 }
 
@@ -290,6 +301,7 @@ func (k *KeybaseDaemonRPC) OnConnect(ctx context.Context,
 func (k *KeybaseDaemonRPC) OnConnectError(err error, wait time.Duration) {
 	k.log.Warning("KeybaseDaemonRPC: connection error: %q; retrying in %s",
 		err, wait)
+	k.setOffline(true)
 }
 
 // OnDoCommandError implements the ConnectionHandler interface.
@@ -306,6 +318,7 @@ func (k *KeybaseDaemonRPC) OnDisconnected(_ context.Context,
 	}
 
 	k.clearCaches()
+	k.setOffline(true)
 }
 
 // ShouldRetry implements the ConnectionHandler interface.
@@ -355,4 +368,5 @@ func (k *KeybaseDaemonRPC) Shutdown() {
 	if k.keepAliveCancel != nil {
 		k.keepAliveCancel()
 	}
+	k.shutdownOfflineCache()
 }
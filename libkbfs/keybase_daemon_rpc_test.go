@@ -6,6 +6,7 @@ package libkbfs
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -15,7 +16,10 @@ import (
 	"github.com/keybase/client/go/logger"
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/go-framed-msgpack-rpc/rpc"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfscodec"
 	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
@@ -58,6 +62,7 @@ type fakeKeybaseClient struct {
 	users                       map[keybase1.UID]UserInfo
 	currentSessionCalled        bool
 	identifyCalled              bool
+	resolveCalled               bool
 	loadUserPlusKeysCalled      bool
 	loadAllPublicKeysUnverified bool
 	editResponse                keybase1.FSEditListArg
@@ -103,6 +108,20 @@ func (c *fakeKeybaseClient) Call(ctx context.Context, s string, args interface{}
 		c.identifyCalled = true
 		return nil
 
+	case "keybase.1.identify.Resolve2":
+		arg := args.([]interface{})[0].(keybase1.Resolve2Arg)
+		c.resolveCalled = true
+		for uid, userInfo := range c.users {
+			if string(userInfo.Name) == arg.Assertion {
+				*res.(*keybase1.User) = keybase1.User{
+					Uid:      uid,
+					Username: string(userInfo.Name),
+				}
+				return nil
+			}
+		}
+		return libkb.NotFoundError{}
+
 	case "keybase.1.user.loadUserPlusKeys":
 		arg := args.([]interface{})[0].(keybase1.LoadUserPlusKeysArg)
 
@@ -241,6 +260,80 @@ func testIdentify(
 	assert.Equal(t, expectedCalled, client.identifyCalled)
 }
 
+func testResolve(
+	t *testing.T, client *fakeKeybaseClient, c *KeybaseDaemonRPC,
+	assertion string, expectedUID keybase1.UID, expectedCalled bool) {
+	client.resolveCalled = false
+
+	ctx := context.Background()
+	_, uid, err := c.Resolve(ctx, assertion)
+	if expectedUID == keybase1.UID("") {
+		require.Equal(t, NoSuchUserError{assertion}, err)
+	} else {
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, expectedUID, uid)
+	assert.Equal(t, expectedCalled, client.resolveCalled)
+}
+
+// Test that resolutions, including failed ones, are cached and
+// invalidated as expected.
+func TestKeybaseDaemonResolveCache(t *testing.T) {
+	uid1 := keybase1.UID("uid1")
+	name1 := libkb.NewNormalizedUsername("name1")
+	users := map[keybase1.UID]UserInfo{
+		uid1: {Name: name1},
+	}
+	client := &fakeKeybaseClient{users: users}
+	c := newKeybaseDaemonRPCWithClient(
+		nil, client, logger.NewTestLogger(t))
+
+	// Should fill cache.
+	testResolve(t, client, c, "name1", uid1, expectCall)
+	testResolve(t, client, c, "name2", keybase1.UID(""), expectCall)
+
+	// Should be cached, even the failure.
+	testResolve(t, client, c, "name1", uid1, expectCached)
+	testResolve(t, client, c, "name2", keybase1.UID(""), expectCached)
+
+	// A change to some other user should invalidate only the
+	// failure, since they might have just proven it.
+	uid2 := keybase1.UID("uid2")
+	users[uid2] = UserInfo{Name: "name2"}
+	err := c.UserChanged(context.Background(), uid2)
+	require.NoError(t, err)
+	testResolve(t, client, c, "name1", uid1, expectCached)
+	testResolve(t, client, c, "name2", uid2, expectCall)
+
+	// Should invalidate cache for uid1.
+	err = c.UserChanged(context.Background(), uid1)
+	require.NoError(t, err)
+	testResolve(t, client, c, "name1", uid1, expectCall)
+	testResolve(t, client, c, "name2", uid2, expectCached)
+
+	// Entries should expire after the TTL.
+	config := NewConfigLocal(func(module string) logger.Logger {
+		return logger.NewTestLogger(t)
+	})
+	clock := newTestClockNow()
+	config.SetClock(clock)
+	c.config = config
+	testResolve(t, client, c, "name1", uid1, expectCall)
+	testLoadUserPlusKeys(t, client, c, uid1, name1, expectCall)
+	clock.Add(config.IdentityCacheTTL() - time.Second)
+	testResolve(t, client, c, "name1", uid1, expectCached)
+	testLoadUserPlusKeys(t, client, c, uid1, name1, expectCached)
+	clock.Add(time.Second)
+	testResolve(t, client, c, "name1", uid1, expectCall)
+	testLoadUserPlusKeys(t, client, c, uid1, name1, expectCall)
+
+	// A zero TTL disables caching.
+	config.SetIdentityCacheTTL(0)
+	testResolve(t, client, c, "name1", uid1, expectCall)
+	testResolve(t, client, c, "name1", uid1, expectCall)
+}
+
 // Test that the user cache works and is invalidated as expected.
 func TestKeybaseDaemonUserCache(t *testing.T) {
 	uid1 := keybase1.UID("uid1")
@@ -330,7 +423,7 @@ func TestKeybaseDaemonUserCache(t *testing.T) {
 	testLoadUnverifiedKeys(t, client, c, uid2, name2, expectCall)
 
 	// Test that CheckForRekey gets called only if the logged-in user
-	// changes.
+	// changes, but that rekeys are kicked off for any user.
 	session := SessionInfo{
 		UID: uid1,
 	}
@@ -348,13 +441,116 @@ func TestKeybaseDaemonUserCache(t *testing.T) {
 		func(ctx context.Context) {
 			errChan <- nil
 		}).Return(errChan)
+	config.mockKbfs.EXPECT().KickoffRekeysForUser(gomock.Any(), uid1)
 	err = c.KeyfamilyChanged(context.Background(), uid1)
 	require.NoError(t, err)
 	<-errChan
+	config.mockKbfs.EXPECT().KickoffRekeysForUser(gomock.Any(), uid2)
 	// This one shouldn't trigger CheckForRekeys; if it does, the mock
 	// controller will catch it during Finish.
 	err = c.KeyfamilyChanged(context.Background(), uid2)
 	require.NoError(t, err)
+
+	// A user change (e.g., a new proof) kicks off rekeys too, but
+	// never triggers CheckForRekeys.
+	config.mockKbfs.EXPECT().KickoffRekeysForUser(gomock.Any(), uid1)
+	err = c.UserChanged(context.Background(), uid1)
+	require.NoError(t, err)
+}
+
+// Test that teams aren't loaded from anything but a verified team
+// loader, which the service doesn't have yet.
+func TestKeybaseDaemonLoadTeam(t *testing.T) {
+	client := &fakeKeybaseClient{}
+	c := newKeybaseDaemonRPCWithClient(
+		nil, client, logger.NewTestLogger(t))
+
+	tid := tlf.FakeTeamID(1)
+	_, err := c.LoadTeam(context.Background(), tid)
+	require.Equal(t, TeamLoadUnsupportedError{tid}, err)
+}
+
+// Test that the last-known-good identity data is used while the
+// service is unreachable.
+func TestKeybaseDaemonOfflineIdentityCache(t *testing.T) {
+	uid1 := keybase1.UID("uid1")
+	name1 := libkb.NewNormalizedUsername("name1")
+	users := map[keybase1.UID]UserInfo{
+		uid1: {Name: name1},
+	}
+	sessionName := libkb.NormalizedUsername("fake username")
+	session := SessionInfo{
+		Name:           sessionName,
+		UID:            keybase1.UID("fake uid"),
+		Token:          "fake token",
+		CryptPublicKey: MakeLocalUserCryptPublicKeyOrBust(sessionName),
+		VerifyingKey:   MakeLocalUserVerifyingKeyOrBust(sessionName),
+	}
+	client := &fakeKeybaseClient{session: session, users: users}
+	c := newKeybaseDaemonRPCWithClient(
+		nil, client, logger.NewTestLogger(t))
+
+	tempdir, err := ioutil.TempDir(os.TempDir(), "offline_identity")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		assert.NoError(t, err)
+	}()
+	err = c.EnableOfflineIdentityCache(kbfscodec.NewMsgpack(), tempdir)
+	require.NoError(t, err)
+	defer c.shutdownOfflineCache()
+
+	ctx := context.Background()
+	testResolve(t, client, c, "name1", uid1, expectCall)
+	testLoadUserPlusKeys(t, client, c, uid1, name1, expectCall)
+	testIdentify(t, client, c, uid1, name1, expectCall)
+	testCurrentSession(t, client, c, session, expectCall)
+
+	// Nothing is served from disk while the service is reachable.
+	userInfo, err := c.LoadUserPlusKeys(ctx, uid1, "")
+	require.NoError(t, err)
+	require.True(t, userInfo.LastKnownGoodAt.IsZero())
+
+	// Once it's unreachable, the memory caches are gone, and the
+	// fake client can't answer anymore.
+	c.OnDisconnected(ctx, rpc.StartingNonFirstConnection)
+	client.users = nil
+
+	testResolve(t, client, c, "name1", uid1, expectCached)
+	testLoadUserPlusKeys(t, client, c, uid1, name1, expectCached)
+	userInfo, err = c.LoadUserPlusKeys(ctx, uid1, "")
+	require.NoError(t, err)
+	require.False(t, userInfo.LastKnownGoodAt.IsZero())
+
+	// Only assertions that were identified can be identified
+	// offline; having resolved one doesn't count.
+	testIdentify(t, client, c, uid1, name1, expectCached)
+	_, err = c.Identify(ctx, "name1", "")
+	require.Error(t, err)
+
+	// The session comes back without its token.
+	client.currentSessionCalled = false
+	s, err := c.CurrentSession(ctx, 0)
+	require.NoError(t, err)
+	require.False(t, client.currentSessionCalled)
+	require.Equal(t, session.UID, s.UID)
+	require.Equal(t, session.CryptPublicKey, s.CryptPublicKey)
+	require.Equal(t, session.VerifyingKey, s.VerifyingKey)
+	require.Equal(t, "", s.Token)
+
+	// A key family change (e.g., a revoked device) makes the
+	// cached user untrustworthy.
+	err = c.KeyfamilyChanged(ctx, uid1)
+	require.NoError(t, err)
+	_, err = c.LoadUserPlusKeys(ctx, uid1, "")
+	require.Error(t, err)
+
+	// Logging out forgets the session.
+	err = c.LoggedOut(ctx)
+	require.NoError(t, err)
+	_, _, ok, err := c.offlineCache.getSession()
+	require.NoError(t, err)
+	require.False(t, ok)
 }
 
 // truncateNotificationTimestamps is a helper function to truncate
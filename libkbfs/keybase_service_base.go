@@ -6,11 +6,14 @@ package libkbfs
 
 import (
 	"sync"
+	"time"
 
 	"github.com/keybase/client/go/libkb"
 	"github.com/keybase/client/go/logger"
 	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfscodec"
 	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/pkg/errors"
 	"golang.org/x/net/context"
 )
 
@@ -33,23 +36,49 @@ type KeybaseServiceBase struct {
 	cachedCurrentSession SessionInfo
 
 	userCacheLock sync.RWMutex
-	// Map entries are removed when invalidated.
-	userCache               map[keybase1.UID]UserInfo
+	// Map entries are removed when invalidated, and ignored once
+	// they're older than the identity cache TTL.
+	userCache               map[keybase1.UID]cachedUserInfo
 	userCacheUnverifiedKeys map[keybase1.UID][]keybase1.PublicKey
+	resolveCache            map[string]cachedResolution
+
+	offlineLock sync.RWMutex
+	// offlineCache, if non-nil, keeps the identity data verified
+	// by the service on disk, for use while offline is true.
+	offlineCache *offlineIdentityCache
+	// offline is true while the service is unreachable.
+	offline bool
 
 	lastNotificationFilenameLock sync.Mutex
 	lastNotificationFilename     string
 	lastSyncNotificationPath     string
 }
 
+// cachedUserInfo is the info of a user, along with when it was
+// cached.
+type cachedUserInfo struct {
+	info     UserInfo
+	cachedAt time.Time
+}
+
+// cachedResolution is the result of resolving an assertion, along
+// with when it was cached. If the assertion didn't resolve to any
+// user, name and uid are empty.
+type cachedResolution struct {
+	name     libkb.NormalizedUsername
+	uid      keybase1.UID
+	cachedAt time.Time
+}
+
 // NewKeybaseServiceBase makes a new KeybaseService.
 func NewKeybaseServiceBase(config Config, kbCtx Context, log logger.Logger) *KeybaseServiceBase {
 	k := KeybaseServiceBase{
 		config:                  config,
 		context:                 kbCtx,
 		log:                     log,
-		userCache:               make(map[keybase1.UID]UserInfo),
+		userCache:               make(map[keybase1.UID]cachedUserInfo),
 		userCacheUnverifiedKeys: make(map[keybase1.UID][]keybase1.PublicKey),
+		resolveCache:            make(map[string]cachedResolution),
 	}
 	return &k
 }
@@ -185,10 +214,33 @@ func (k *KeybaseServiceBase) setCachedCurrentSession(s SessionInfo) {
 	k.cachedCurrentSession = s
 }
 
+// now returns the current time, according to the clock of k's
+// config if it has one.
+func (k *KeybaseServiceBase) now() time.Time {
+	if k.config == nil {
+		return wallClock{}.Now()
+	}
+	return k.config.Clock().Now()
+}
+
+// isCacheEntryValid returns whether a cache entry made at the given
+// time is still young enough to use.
+func (k *KeybaseServiceBase) isCacheEntryValid(cachedAt time.Time) bool {
+	ttl := identityCacheTTLDefault
+	if k.config != nil {
+		ttl = k.config.IdentityCacheTTL()
+	}
+	return k.now().Sub(cachedAt) < ttl
+}
+
 func (k *KeybaseServiceBase) getCachedUserInfo(uid keybase1.UID) UserInfo {
 	k.userCacheLock.RLock()
 	defer k.userCacheLock.RUnlock()
-	return k.userCache[uid]
+	cached, ok := k.userCache[uid]
+	if !ok || !k.isCacheEntryValid(cached.cachedAt) {
+		return UserInfo{}
+	}
+	return cached.info
 }
 
 func (k *KeybaseServiceBase) setCachedUserInfo(uid keybase1.UID, info UserInfo) {
@@ -197,7 +249,41 @@ func (k *KeybaseServiceBase) setCachedUserInfo(uid keybase1.UID, info UserInfo)
 	if info.Name == libkb.NormalizedUsername("") {
 		delete(k.userCache, uid)
 	} else {
-		k.userCache[uid] = info
+		k.userCache[uid] = cachedUserInfo{info, k.now()}
+	}
+}
+
+// getCachedResolution returns the cached result of resolving the
+// given assertion, if there is one. If the assertion is known not
+// to resolve, the returned name and UID are empty.
+func (k *KeybaseServiceBase) getCachedResolution(assertion string) (
+	libkb.NormalizedUsername, keybase1.UID, bool) {
+	k.userCacheLock.RLock()
+	defer k.userCacheLock.RUnlock()
+	cached, ok := k.resolveCache[assertion]
+	if !ok || !k.isCacheEntryValid(cached.cachedAt) {
+		return libkb.NormalizedUsername(""), keybase1.UID(""), false
+	}
+	return cached.name, cached.uid, true
+}
+
+func (k *KeybaseServiceBase) setCachedResolution(assertion string,
+	name libkb.NormalizedUsername, uid keybase1.UID) {
+	k.userCacheLock.Lock()
+	defer k.userCacheLock.Unlock()
+	k.resolveCache[assertion] = cachedResolution{name, uid, k.now()}
+}
+
+// clearCachedResolutions forgets every assertion that resolved to
+// the given user, along with every assertion that didn't resolve,
+// since the user may have just proven it.
+func (k *KeybaseServiceBase) clearCachedResolutions(uid keybase1.UID) {
+	k.userCacheLock.Lock()
+	defer k.userCacheLock.Unlock()
+	for assertion, cached := range k.resolveCache {
+		if cached.uid == uid || cached.uid == keybase1.UID("") {
+			delete(k.resolveCache, assertion)
+		}
 	}
 }
 
@@ -227,8 +313,58 @@ func (k *KeybaseServiceBase) clearCaches() {
 	k.setCachedCurrentSession(SessionInfo{})
 	k.userCacheLock.Lock()
 	defer k.userCacheLock.Unlock()
-	k.userCache = make(map[keybase1.UID]UserInfo)
+	k.userCache = make(map[keybase1.UID]cachedUserInfo)
 	k.userCacheUnverifiedKeys = make(map[keybase1.UID][]keybase1.PublicKey)
+	k.resolveCache = make(map[string]cachedResolution)
+}
+
+// EnableOfflineIdentityCache keeps the identity data verified by
+// the keybase service in the given directory, so that it can be
+// used (as last-known-good data) while the service is unreachable.
+func (k *KeybaseServiceBase) EnableOfflineIdentityCache(
+	codec kbfscodec.Codec, dirPath string) error {
+	k.offlineLock.Lock()
+	defer k.offlineLock.Unlock()
+	if k.offlineCache != nil {
+		return errors.New("Offline identity cache already enabled")
+	}
+	cache, err := newOfflineIdentityCache(codec, dirPath)
+	if err != nil {
+		return err
+	}
+	k.offlineCache = cache
+	return nil
+}
+
+// setOffline records whether the keybase service is unreachable.
+func (k *KeybaseServiceBase) setOffline(offline bool) {
+	k.offlineLock.Lock()
+	defer k.offlineLock.Unlock()
+	k.offline = offline
+}
+
+// getOfflineCache returns the offline identity cache (or nil if it
+// isn't enabled), and whether the service is unreachable, in which
+// case the cache should stand in for it.
+func (k *KeybaseServiceBase) getOfflineCache() (
+	cache *offlineIdentityCache, offline bool) {
+	k.offlineLock.RLock()
+	defer k.offlineLock.RUnlock()
+	return k.offlineCache, k.offline && k.offlineCache != nil
+}
+
+func (k *KeybaseServiceBase) shutdownOfflineCache() {
+	k.offlineLock.Lock()
+	defer k.offlineLock.Unlock()
+	if k.offlineCache == nil {
+		return
+	}
+	err := k.offlineCache.shutdown()
+	if err != nil {
+		k.log.Warning("Couldn't shut down the offline identity cache: %+v",
+			err)
+	}
+	k.offlineCache = nil
 }
 
 // LoggedIn implements keybase1.NotifySessionInterface.
@@ -247,6 +383,13 @@ func (k *KeybaseServiceBase) LoggedIn(ctx context.Context, name string) error {
 func (k *KeybaseServiceBase) LoggedOut(ctx context.Context) error {
 	k.log.CDebugf(ctx, "Current session logged out")
 	k.setCachedCurrentSession(SessionInfo{})
+	if cache, _ := k.getOfflineCache(); cache != nil {
+		err := cache.clearSession()
+		if err != nil {
+			k.log.CWarningf(ctx, "Couldn't clear the offline session: %+v",
+				err)
+		}
+	}
 	if k.config != nil {
 		serviceLoggedOut(ctx, k.config)
 	}
@@ -260,12 +403,64 @@ func (k *KeybaseServiceBase) KeyfamilyChanged(ctx context.Context,
 	k.setCachedUserInfo(uid, UserInfo{})
 	k.clearCachedUnverifiedKeys(uid)
 
+	// One of the user's devices may have been revoked, in which
+	// case we shouldn't keep trusting its keys if the service
+	// becomes unreachable before we reload the user.
+	if cache, _ := k.getOfflineCache(); cache != nil {
+		err := cache.deleteUser(uid)
+		if err != nil {
+			k.log.CWarningf(ctx, "Couldn't delete the offline info of "+
+				"user %s: %+v", uid, err)
+		}
+	}
+
+	if k.config == nil {
+		return nil
+	}
+
 	if k.getCachedCurrentSession().UID == uid {
 		// Ignore any errors for now, we don't want to block this
 		// notification and it's not worth spawning a goroutine for.
 		k.config.MDServer().CheckForRekeys(context.Background())
 	}
 
+	// The mdserver only knows to ask us to rekey after our own
+	// devices change, so also rekey any folders we have open
+	// that this user can read -- as a writer we may be able to
+	// add their new device, or remove their revoked one.
+	k.config.KBFSOps().KickoffRekeysForUser(context.Background(), uid)
+
+	return nil
+}
+
+// UserChanged implements keybase1.NotifyUsersInterface.
+func (k *KeybaseServiceBase) UserChanged(ctx context.Context,
+	uid keybase1.UID) error {
+	k.log.CDebugf(ctx, "User %s changed", uid)
+	k.setCachedUserInfo(uid, UserInfo{})
+	k.clearCachedResolutions(uid)
+
+	// The user may have just proven a social assertion that's
+	// still unresolved in one of the folders we have open, in
+	// which case a writer needs to rekey it for them.
+	if k.config != nil {
+		k.config.KBFSOps().KickoffRekeysForUser(
+			context.Background(), uid)
+	}
+
+	return nil
+}
+
+// FavoritesChanged implements keybase1.NotifyFavoritesInterface.
+func (k *KeybaseServiceBase) FavoritesChanged(ctx context.Context,
+	uid keybase1.UID) error {
+	k.log.CDebugf(ctx, "Favorites for user %s changed", uid)
+	if k.config == nil || k.getCachedCurrentSession().UID != uid {
+		return nil
+	}
+	// Another device changed our favorites, so fetch the new list
+	// (which notifies any favorites observers).
+	k.config.KBFSOps().RefreshCachedFavorites(context.Background())
 	return nil
 }
 
@@ -304,12 +499,48 @@ func ConvertIdentifyError(assertion string, err error) error {
 // Resolve implements the KeybaseService interface for KeybaseServiceBase.
 func (k *KeybaseServiceBase) Resolve(ctx context.Context, assertion string) (
 	libkb.NormalizedUsername, keybase1.UID, error) {
+	if name, uid, ok := k.getCachedResolution(assertion); ok {
+		if uid == keybase1.UID("") {
+			return libkb.NormalizedUsername(""), keybase1.UID(""),
+				NoSuchUserError{assertion}
+		}
+		return name, uid, nil
+	}
+
+	cache, offline := k.getOfflineCache()
+	if offline {
+		name, uid, verifiedAt, ok, err := cache.getResolution(assertion)
+		if err != nil {
+			k.log.CDebugf(ctx, "Couldn't get the offline resolution "+
+				"of %s: %+v", assertion, err)
+		} else if ok {
+			k.log.CWarningf(ctx, "Keybase service unreachable; using "+
+				"the last-known-good resolution of %s to %s from %s",
+				assertion, name, verifiedAt)
+			return name, uid, nil
+		}
+	}
+
 	user, err := k.identifyClient.Resolve2(ctx, assertion)
 	if err != nil {
-		return libkb.NormalizedUsername(""), keybase1.UID(""),
-			ConvertIdentifyError(assertion, err)
+		err = ConvertIdentifyError(assertion, err)
+		// Only cache definite failures, not e.g. network errors.
+		if _, ok := err.(NoSuchUserError); ok {
+			k.setCachedResolution(assertion,
+				libkb.NormalizedUsername(""), keybase1.UID(""))
+		}
+		return libkb.NormalizedUsername(""), keybase1.UID(""), err
+	}
+	name := libkb.NewNormalizedUsername(user.Username)
+	k.setCachedResolution(assertion, name, user.Uid)
+	if cache != nil {
+		err := cache.putResolution(assertion, name, user.Uid, k.now())
+		if err != nil {
+			k.log.CDebugf(ctx, "Couldn't save the offline resolution "+
+				"of %s: %+v", assertion, err)
+		}
 	}
-	return libkb.NewNormalizedUsername(user.Username), user.Uid, nil
+	return name, user.Uid, nil
 }
 
 // Identify implements the KeybaseService interface for KeybaseServiceBase.
@@ -330,6 +561,25 @@ func (k *KeybaseServiceBase) Identify(ctx context.Context, assertion, reason str
 	ei := getExtendedIdentify(ctx)
 	arg.IdentifyBehavior = ei.behavior
 
+	cache, offline := k.getOfflineCache()
+	if offline {
+		userInfo, trackBreaks, ok, err :=
+			k.getOfflineIdentity(cache, assertion)
+		if err != nil {
+			k.log.CDebugf(ctx, "Couldn't get the offline identity "+
+				"of %s: %+v", assertion, err)
+		} else if ok {
+			k.log.CWarningf(ctx, "Keybase service unreachable; using "+
+				"the last-known-good identity of %s (%s) from %s",
+				assertion, userInfo.Name, userInfo.LastKnownGoodAt)
+			// Report the track breaks found by the identify that
+			// was cached, since they haven't been fixed as far as
+			// we know.
+			ei.userBreak(userInfo.Name, userInfo.UID, trackBreaks)
+			return userInfo, nil
+		}
+	}
+
 	res, err := k.identifyClient.Identify2(ctx, arg)
 	// Identify2 still returns keybase1.UserPlusKeys data (sans keys),
 	// even if it gives a NoSigChainError, and in KBFS it's fine if
@@ -348,6 +598,15 @@ func (k *KeybaseServiceBase) Identify(ctx context.Context, assertion, reason str
 		return UserInfo{}, err
 	}
 
+	if cache != nil {
+		err := cache.putIdentify(assertion, userInfo.Name, userInfo.UID,
+			res.TrackBreaks, k.now())
+		if err != nil {
+			k.log.CDebugf(ctx, "Couldn't save the offline identity "+
+				"of %s: %+v", assertion, err)
+		}
+	}
+
 	// This is required for every identify call. The userBreak function will take
 	// care of checking if res.TrackBreaks is nil or not.
 	ei.userBreak(userInfo.Name, userInfo.UID, res.TrackBreaks)
@@ -355,6 +614,23 @@ func (k *KeybaseServiceBase) Identify(ctx context.Context, assertion, reason str
 	return userInfo, nil
 }
 
+// getOfflineIdentity returns the last-known-good info of the user
+// that the given assertion was last successfully identified as, the
+// track breaks found by that identify, and whether there is any.
+func (k *KeybaseServiceBase) getOfflineIdentity(
+	cache *offlineIdentityCache, assertion string) (
+	UserInfo, *keybase1.IdentifyTrackBreaks, bool, error) {
+	uid, trackBreaks, ok, err := cache.getIdentify(assertion)
+	if !ok || err != nil {
+		return UserInfo{}, nil, false, err
+	}
+	userInfo, ok, err := cache.getUser(uid)
+	if !ok || err != nil {
+		return UserInfo{}, nil, false, err
+	}
+	return userInfo, trackBreaks, true, nil
+}
+
 // LoadUserPlusKeys implements the KeybaseService interface for KeybaseServiceBase.
 func (k *KeybaseServiceBase) LoadUserPlusKeys(ctx context.Context,
 	uid keybase1.UID, pollForKID keybase1.KID) (UserInfo, error) {
@@ -363,6 +639,19 @@ func (k *KeybaseServiceBase) LoadUserPlusKeys(ctx context.Context,
 		return cachedUserInfo, nil
 	}
 
+	if cache, offline := k.getOfflineCache(); offline {
+		userInfo, ok, err := cache.getUser(uid)
+		if err != nil {
+			k.log.CDebugf(ctx, "Couldn't get the offline info of "+
+				"user %s: %+v", uid, err)
+		} else if ok {
+			k.log.CWarningf(ctx, "Keybase service unreachable; using "+
+				"the last-known-good info of user %s (%s) from %s",
+				uid, userInfo.Name, userInfo.LastKnownGoodAt)
+			return userInfo, nil
+		}
+	}
+
 	arg := keybase1.LoadUserPlusKeysArg{Uid: uid, PollForKID: pollForKID}
 	res, err := k.userClient.LoadUserPlusKeys(ctx, arg)
 	if err != nil {
@@ -402,6 +691,13 @@ func (k *KeybaseServiceBase) processUserPlusKeys(upk keybase1.UserPlusKeys) (
 	}
 
 	k.setCachedUserInfo(upk.Uid, u)
+	if cache, _ := k.getOfflineCache(); cache != nil {
+		err := cache.putUser(u, k.now())
+		if err != nil {
+			k.log.Debug("Couldn't save the offline info of user %s: %+v",
+				upk.Uid, err)
+		}
+	}
 	return u, nil
 }
 
@@ -422,6 +718,16 @@ func (k *KeybaseServiceBase) LoadUnverifiedKeys(ctx context.Context, uid keybase
 	return keys, nil
 }
 
+// LoadTeam implements the KeybaseService interface for KeybaseServiceBase.
+func (k *KeybaseServiceBase) LoadTeam(ctx context.Context, tid keybase1.UID) (
+	TeamInfo, error) {
+	// Team membership decides who may write and read team TLFs,
+	// so it must come from the service's sigchain-verified team
+	// loader, and never from unsigned API server responses. This
+	// version of the service protocol has no such loader.
+	return TeamInfo{}, TeamLoadUnsupportedError{tid}
+}
+
 // CurrentSession implements the KeybaseService interface for KeybaseServiceBase.
 func (k *KeybaseServiceBase) CurrentSession(ctx context.Context, sessionID int) (
 	SessionInfo, error) {
@@ -430,6 +736,19 @@ func (k *KeybaseServiceBase) CurrentSession(ctx context.Context, sessionID int)
 		return cachedCurrentSession, nil
 	}
 
+	cache, offline := k.getOfflineCache()
+	if offline {
+		s, verifiedAt, ok, err := cache.getSession()
+		if err != nil {
+			k.log.CDebugf(ctx, "Couldn't get the offline session: %+v", err)
+		} else if ok {
+			k.log.CWarningf(ctx, "Keybase service unreachable; using "+
+				"the last-known-good session of %s from %s",
+				s.Name, verifiedAt)
+			return s, nil
+		}
+	}
+
 	res, err := k.sessionClient.CurrentSession(ctx, sessionID)
 	if err != nil {
 		if ncs := (NoCurrentSessionError{}); err.Error() ==
@@ -452,6 +771,13 @@ func (k *KeybaseServiceBase) CurrentSession(ctx context.Context, sessionID int)
 		s.Name, s.UID, s.CryptPublicKey, s.VerifyingKey)
 
 	k.setCachedCurrentSession(s)
+	if cache != nil {
+		err := cache.putSession(s, k.now())
+		if err != nil {
+			k.log.CDebugf(ctx, "Couldn't save the offline session: %+v",
+				err)
+		}
+	}
 
 	return s, nil
 }
@@ -518,6 +844,7 @@ func (k *KeybaseServiceBase) FlushUserFromLocalCache(ctx context.Context,
 	uid keybase1.UID) {
 	k.log.CDebugf(ctx, "Flushing cache for user %s", uid)
 	k.setCachedUserInfo(uid, UserInfo{})
+	k.clearCachedResolutions(uid)
 }
 
 // FlushUserUnverifiedKeysFromLocalCache implements the KeybaseService interface for
@@ -544,17 +871,8 @@ const CtxKeybaseServiceOpID = "KSID"
 
 func (k *KeybaseServiceBase) getHandleFromFolderName(ctx context.Context,
 	tlfName string, public bool) (*TlfHandle, error) {
-	for {
-		tlfHandle, err := ParseTlfHandle(ctx, k.config.KBPKI(), tlfName, public)
-		switch e := err.(type) {
-		case TlfNameNotCanonical:
-			tlfName = e.NameToTry
-		case nil:
-			return tlfHandle, nil
-		default:
-			return nil, err
-		}
-	}
+	return ParseTlfHandleFollowingRedirects(
+		ctx, k.config.KBPKI(), tlfName, public)
 }
 
 // FSEditListRequest implements keybase1.NotifyFSRequestInterface for
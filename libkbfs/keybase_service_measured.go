@@ -19,6 +19,7 @@ type KeybaseServiceMeasured struct {
 	identifyTimer           metrics.Timer
 	loadUserPlusKeysTimer   metrics.Timer
 	loadUnverifiedKeysTimer metrics.Timer
+	loadTeamTimer           metrics.Timer
 	currentSessionTimer     metrics.Timer
 	favoriteAddTimer        metrics.Timer
 	favoriteDeleteTimer     metrics.Timer
@@ -35,6 +36,7 @@ func NewKeybaseServiceMeasured(delegate KeybaseService, r metrics.Registry) Keyb
 	identifyTimer := metrics.GetOrRegisterTimer("KeybaseService.Identify", r)
 	loadUserPlusKeysTimer := metrics.GetOrRegisterTimer("KeybaseService.LoadUserPlusKeys", r)
 	loadUnverifiedKeysTimer := metrics.GetOrRegisterTimer("KeybaseService.LoadUnverifiedKeys", r)
+	loadTeamTimer := metrics.GetOrRegisterTimer("KeybaseService.LoadTeam", r)
 	currentSessionTimer := metrics.GetOrRegisterTimer("KeybaseService.CurrentSession", r)
 	favoriteAddTimer := metrics.GetOrRegisterTimer("KeybaseService.FavoriteAdd", r)
 	favoriteDeleteTimer := metrics.GetOrRegisterTimer("KeybaseService.FavoriteDelete", r)
@@ -46,6 +48,7 @@ func NewKeybaseServiceMeasured(delegate KeybaseService, r metrics.Registry) Keyb
 		identifyTimer:           identifyTimer,
 		loadUserPlusKeysTimer:   loadUserPlusKeysTimer,
 		loadUnverifiedKeysTimer: loadUnverifiedKeysTimer,
+		loadTeamTimer:           loadTeamTimer,
 		currentSessionTimer:     currentSessionTimer,
 		favoriteAddTimer:        favoriteAddTimer,
 		favoriteDeleteTimer:     favoriteDeleteTimer,
@@ -90,6 +93,16 @@ func (k KeybaseServiceMeasured) LoadUnverifiedKeys(ctx context.Context, uid keyb
 	return keys, err
 }
 
+// LoadTeam implements the KeybaseService interface for
+// KeybaseServiceMeasured.
+func (k KeybaseServiceMeasured) LoadTeam(ctx context.Context, tid keybase1.UID) (
+	teamInfo TeamInfo, err error) {
+	k.loadTeamTimer.Time(func() {
+		teamInfo, err = k.delegate.LoadTeam(ctx, tid)
+	})
+	return teamInfo, err
+}
+
 // CurrentSession implements the KeybaseService interface for
 // KeybaseServiceMeasured.
 func (k KeybaseServiceMeasured) CurrentSession(ctx context.Context, sessionID int) (
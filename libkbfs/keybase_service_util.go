@@ -4,7 +4,11 @@
 
 package libkbfs
 
-import "golang.org/x/net/context"
+import (
+	"github.com/keybase/client/go/libkb"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
 
 // serviceLoggedIn should be called when a new user logs in. It
 // shouldn't be called again until after serviceLoggedOut is called.
@@ -51,3 +55,36 @@ func serviceLoggedOut(ctx context.Context, config Config) {
 	// call always comes before a logged-in call.
 	config.KBFSOps().ClearPrivateFolderMD(ctx)
 }
+
+// SwitchLocalUser logs out the current user of the given config,
+// which must be running in local mode, and logs in the local user
+// with the given name instead, on that user's current device. All
+// of the previous user's state (caches, journals, cached private
+// MD, and favorites) is torn down in between, just as if the
+// service had logged out one user and logged in another.
+func SwitchLocalUser(ctx context.Context, config Config,
+	name libkb.NormalizedUsername) error {
+	kbd, ok := config.KeybaseService().(*KeybaseDaemonLocal)
+	if !ok {
+		return errors.New("Users can only be switched in local mode")
+	}
+	if _, ok := config.Crypto().(CryptoLocal); !ok {
+		return errors.New("Users can only be switched with local crypto")
+	}
+	user, err := kbd.getLocalUserByName(name)
+	if err != nil {
+		return err
+	}
+
+	serviceLoggedOut(ctx, config)
+
+	kbd.setCurrentUID(user.UID)
+	keySalt := keySaltForUserDevice(user.Name, user.CurrentVerifyingKeyIndex)
+	config.SetCrypto(NewCryptoLocal(config.Codec(),
+		MakeLocalUserSigningKeyOrBust(keySalt),
+		MakeLocalUserCryptPrivateKeyOrBust(keySalt)))
+
+	serviceLoggedIn(
+		ctx, config, string(user.Name), TLFJournalBackgroundWorkEnabled)
+	return nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwitchLocalUser(t *testing.T) {
+	var u1, u2 libkb.NormalizedUsername = "u1", "u2"
+	config, uid1, ctx, cancel := kbfsOpsInitNoMocks(t, u1, u2)
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, u1.String(), false)
+	kbfsOps := config.KBFSOps()
+	_, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+
+	err = SwitchLocalUser(ctx, config, u2)
+	require.NoError(t, err)
+	name, uid2, err := config.KBPKI().GetCurrentUserInfo(ctx)
+	require.NoError(t, err)
+	require.Equal(t, u2, name)
+	require.NotEqual(t, uid1, uid2)
+
+	// u2 can't read u1's private folder, but has one of its own.
+	_, err = GetRootNodeForTest(ctx, config, u1.String(), false)
+	require.Error(t, err)
+	GetRootNodeOrBust(ctx, t, config, u2.String(), false)
+
+	err = SwitchLocalUser(ctx, config, "u3")
+	require.Error(t, err)
+
+	err = SwitchLocalUser(ctx, config, u1)
+	require.NoError(t, err)
+	rootNode = GetRootNodeOrBust(ctx, t, config, u1.String(), false)
+	children, err := kbfsOps.GetDirChildren(ctx, rootNode)
+	require.NoError(t, err)
+	require.Contains(t, children, "a")
+}
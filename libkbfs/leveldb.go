@@ -4,7 +4,11 @@
 
 package libkbfs
 
-import "github.com/syndtr/goleveldb/leveldb/opt"
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
 
 var leveldbOptions = &opt.Options{
 	Compression: opt.NoCompression,
@@ -13,3 +17,42 @@ var leveldbOptions = &opt.Options{
 	// number since we have multiple leveldb instances.
 	OpenFilesCacheCapacity: 10,
 }
+
+// levelDB is a leveldb that closes its storage when it is closed,
+// like one opened with leveldb.OpenFile does.
+type levelDB struct {
+	*leveldb.DB
+	storage storage.Storage
+}
+
+// openLevelDB opens a leveldb on the given storage, which is closed
+// if that fails.
+func openLevelDB(stor storage.Storage, options *opt.Options) (
+	*levelDB, error) {
+	db, err := leveldb.Open(stor, options)
+	if err != nil {
+		stor.Close()
+		return nil, err
+	}
+	return &levelDB{db, stor}, nil
+}
+
+// openLevelDBFile opens a leveldb in the given directory, creating
+// it if necessary.
+func openLevelDBFile(path string) (*levelDB, error) {
+	stor, err := storage.OpenFile(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return openLevelDB(stor, leveldbOptions)
+}
+
+// Close closes the leveldb and its storage.
+func (db *levelDB) Close() error {
+	err := db.DB.Close()
+	storageErr := db.storage.Close()
+	if err != nil {
+		return err
+	}
+	return storageErr
+}
@@ -0,0 +1,273 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"golang.org/x/net/context"
+)
+
+// s3LevelDBOptions are the options for leveldbs stored in an
+// s3LevelDBStorage. The write buffer bounds the size of the journal,
+// which is re-uploaded on every write, so it's much smaller than
+// usual.
+var s3LevelDBOptions = &opt.Options{
+	Compression: opt.NoCompression,
+	WriteBuffer: 256 * opt.KiB,
+}
+
+const s3LevelDBCurrentKey = "CURRENT"
+
+// s3LevelDBStorage is a leveldb storage.Storage that keeps each file
+// of a leveldb as an object in an s3Bucket.
+//
+// Files are read whole when opened, and written whole: tables when
+// they're synced or closed, and the journal and manifest, which
+// leveldb keeps appending to, after every write. That way everything
+// leveldb has written is always in the bucket, and a server using
+// this storage can be restarted anywhere.
+//
+// Only one leveldb may use a given bucket prefix at a time; Lock only
+// guards against other users in the same process.
+type s3LevelDBStorage struct {
+	bucket *s3Bucket
+
+	lock   sync.Mutex
+	locked bool
+}
+
+var _ storage.Storage = (*s3LevelDBStorage)(nil)
+
+func newS3LevelDBStorage(bucket *s3Bucket) *s3LevelDBStorage {
+	return &s3LevelDBStorage{bucket: bucket}
+}
+
+type s3LevelDBStorageLock struct {
+	s *s3LevelDBStorage
+}
+
+func (l s3LevelDBStorageLock) Release() {
+	l.s.lock.Lock()
+	defer l.s.lock.Unlock()
+	l.s.locked = false
+}
+
+// parseLevelDBFileName is the inverse of storage.FileDesc.String.
+func parseLevelDBFileName(name string) (fd storage.FileDesc, ok bool) {
+	var tail string
+	_, err := fmt.Sscanf(name, "%d.%s", &fd.Num, &tail)
+	if err == nil {
+		switch tail {
+		case "log":
+			fd.Type = storage.TypeJournal
+		case "ldb", "sst":
+			fd.Type = storage.TypeTable
+		case "tmp":
+			fd.Type = storage.TypeTemp
+		default:
+			return storage.FileDesc{}, false
+		}
+		return fd, true
+	}
+	n, _ := fmt.Sscanf(name, "MANIFEST-%d%s", &fd.Num, &tail)
+	if n == 1 {
+		fd.Type = storage.TypeManifest
+		return fd, true
+	}
+	return storage.FileDesc{}, false
+}
+
+// Lock implements the storage.Storage interface for s3LevelDBStorage.
+func (s *s3LevelDBStorage) Lock() (storage.Lock, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.locked {
+		return nil, storage.ErrLocked
+	}
+	s.locked = true
+	return s3LevelDBStorageLock{s}, nil
+}
+
+// Log implements the storage.Storage interface for s3LevelDBStorage.
+func (s *s3LevelDBStorage) Log(str string) {}
+
+// SetMeta implements the storage.Storage interface for
+// s3LevelDBStorage.
+func (s *s3LevelDBStorage) SetMeta(fd storage.FileDesc) error {
+	if !storage.FileDescOk(fd) {
+		return storage.ErrInvalidFile
+	}
+	// Object puts are atomic, so unlike on disk there's no need
+	// for a temporary file.
+	return s.bucket.put(context.Background(), s3LevelDBCurrentKey,
+		[]byte(fd.String()+"\n"))
+}
+
+// GetMeta implements the storage.Storage interface for
+// s3LevelDBStorage.
+func (s *s3LevelDBStorage) GetMeta() (storage.FileDesc, error) {
+	buf, err := s.bucket.get(context.Background(), s3LevelDBCurrentKey)
+	if isS3NoSuchKey(err) {
+		return storage.FileDesc{}, os.ErrNotExist
+	} else if err != nil {
+		return storage.FileDesc{}, err
+	}
+	name := strings.TrimSuffix(string(buf), "\n")
+	fd, ok := parseLevelDBFileName(name)
+	if !ok || fd.Type != storage.TypeManifest {
+		return storage.FileDesc{}, &storage.ErrCorrupted{
+			Err: fmt.Errorf("Invalid manifest name %q", name),
+		}
+	}
+	return fd, nil
+}
+
+// List implements the storage.Storage interface for s3LevelDBStorage.
+func (s *s3LevelDBStorage) List(ft storage.FileType) (
+	[]storage.FileDesc, error) {
+	keys, err := s.bucket.list(context.Background(), "")
+	if err != nil {
+		return nil, err
+	}
+	var fds []storage.FileDesc
+	for _, key := range keys {
+		fd, ok := parseLevelDBFileName(key)
+		if ok && fd.Type&ft != 0 {
+			fds = append(fds, fd)
+		}
+	}
+	return fds, nil
+}
+
+type s3LevelDBReader struct {
+	*bytes.Reader
+}
+
+func (r s3LevelDBReader) Close() error {
+	return nil
+}
+
+// Open implements the storage.Storage interface for s3LevelDBStorage.
+func (s *s3LevelDBStorage) Open(fd storage.FileDesc) (storage.Reader, error) {
+	if !storage.FileDescOk(fd) {
+		return nil, storage.ErrInvalidFile
+	}
+	buf, err := s.bucket.get(context.Background(), fd.String())
+	if isS3NoSuchKey(err) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	return s3LevelDBReader{bytes.NewReader(buf)}, nil
+}
+
+type s3LevelDBWriter struct {
+	bucket *s3Bucket
+	key    string
+	// uploadOnWrite is set for files that leveldb appends to
+	// and relies on after every write.
+	uploadOnWrite bool
+	buf           bytes.Buffer
+	closed        bool
+}
+
+func (w *s3LevelDBWriter) upload() error {
+	return w.bucket.put(context.Background(), w.key, w.buf.Bytes())
+}
+
+func (w *s3LevelDBWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, storage.ErrClosed
+	}
+	n, _ := w.buf.Write(p)
+	if w.uploadOnWrite {
+		err := w.upload()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func (w *s3LevelDBWriter) Sync() error {
+	if w.closed {
+		return storage.ErrClosed
+	}
+	return w.upload()
+}
+
+func (w *s3LevelDBWriter) Close() error {
+	if w.closed {
+		return storage.ErrClosed
+	}
+	w.closed = true
+	return w.upload()
+}
+
+// Create implements the storage.Storage interface for
+// s3LevelDBStorage.
+func (s *s3LevelDBStorage) Create(fd storage.FileDesc) (
+	storage.Writer, error) {
+	if !storage.FileDescOk(fd) {
+		return nil, storage.ErrInvalidFile
+	}
+	w := &s3LevelDBWriter{
+		bucket: s.bucket,
+		key:    fd.String(),
+		uploadOnWrite: fd.Type == storage.TypeJournal ||
+			fd.Type == storage.TypeManifest,
+	}
+	// Like creating a file, this truncates any existing object.
+	err := w.upload()
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Remove implements the storage.Storage interface for
+// s3LevelDBStorage.
+func (s *s3LevelDBStorage) Remove(fd storage.FileDesc) error {
+	if !storage.FileDescOk(fd) {
+		return storage.ErrInvalidFile
+	}
+	return s.bucket.delete(context.Background(), fd.String())
+}
+
+// Rename implements the storage.Storage interface for
+// s3LevelDBStorage.
+func (s *s3LevelDBStorage) Rename(oldfd, newfd storage.FileDesc) error {
+	if !storage.FileDescOk(oldfd) || !storage.FileDescOk(newfd) {
+		return storage.ErrInvalidFile
+	}
+	if oldfd == newfd {
+		return nil
+	}
+	ctx := context.Background()
+	buf, err := s.bucket.get(ctx, oldfd.String())
+	if isS3NoSuchKey(err) {
+		return os.ErrNotExist
+	} else if err != nil {
+		return err
+	}
+	err = s.bucket.put(ctx, newfd.String(), buf)
+	if err != nil {
+		return err
+	}
+	return s.bucket.delete(ctx, oldfd.String())
+}
+
+// Close implements the storage.Storage interface for
+// s3LevelDBStorage.
+func (s *s3LevelDBStorage) Close() error {
+	return nil
+}
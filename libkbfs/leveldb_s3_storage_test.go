@@ -0,0 +1,56 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+func TestParseLevelDBFileName(t *testing.T) {
+	for _, fd := range []storage.FileDesc{
+		{Type: storage.TypeJournal, Num: 3},
+		{Type: storage.TypeTable, Num: 10},
+		{Type: storage.TypeTemp, Num: 7},
+		{Type: storage.TypeManifest, Num: 2},
+	} {
+		parsed, ok := parseLevelDBFileName(fd.String())
+		require.True(t, ok, fd.String())
+		require.Equal(t, fd, parsed)
+	}
+
+	for _, name := range []string{"CURRENT", "LOCK", "LOG", "3.foo"} {
+		_, ok := parseLevelDBFileName(name)
+		require.False(t, ok, name)
+	}
+}
+
+func TestS3LevelDBStorage(t *testing.T) {
+	bucket, _, server := makeFakeS3BucketForTest(t)
+	defer server.Close()
+
+	db, err := openLevelDB(newS3LevelDBStorage(bucket), s3LevelDBOptions)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		err = db.Put([]byte(fmt.Sprintf("key%d", i)),
+			[]byte(fmt.Sprintf("value%d", i)), nil)
+		require.NoError(t, err)
+	}
+	err = db.Close()
+	require.NoError(t, err)
+
+	// Everything should still be there after reopening.
+	db, err = openLevelDB(newS3LevelDBStorage(bucket), s3LevelDBOptions)
+	require.NoError(t, err)
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		value, err := db.Get([]byte(fmt.Sprintf("key%d", i)), nil)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("value%d", i), string(value))
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfscrypto"
+)
+
+// LocalUserFixture builds a set of LocalUsers, with any number of
+// devices and assertions each, for use by tests and local mode. All
+// keys are generated deterministically, so two fixtures built the
+// same way have the same users and keys.
+//
+// The first device of each user has the same keys as the user made
+// by MakeLocalUsers, and device i (before any revocations or key
+// changes) has the same keys as the device made by the i-th call to
+// AddDeviceForLocalUserOrBust, so the two can be mixed.
+type LocalUserFixture struct {
+	users []LocalUser
+	// deviceSalts holds, for each user, the name that the keys of
+	// each of its current devices were generated from, parallel
+	// to its VerifyingKeys and CryptPublicKeys.
+	deviceSalts [][]libkb.NormalizedUsername
+	// keyCounts holds, for each user, how many sets of device
+	// keys have been generated for it, so that new keys never
+	// repeat old ones.
+	keyCounts []int
+}
+
+// NewLocalUserFixture returns an empty LocalUserFixture.
+func NewLocalUserFixture() *LocalUserFixture {
+	return &LocalUserFixture{}
+}
+
+// AddUser adds a user with the given name and assertions and a
+// single device, and returns its UID. The UID of the i-th user
+// added (starting from 1) is keybase1.MakeTestUID(i).
+func (f *LocalUserFixture) AddUser(
+	name libkb.NormalizedUsername, asserts ...string) keybase1.UID {
+	uid := keybase1.MakeTestUID(uint32(len(f.users) + 1))
+	f.users = append(f.users, LocalUser{
+		UserInfo: UserInfo{
+			Name:     name,
+			UID:      uid,
+			KIDNames: make(map[keybase1.KID]string),
+		},
+		Asserts: asserts,
+	})
+	f.deviceSalts = append(f.deviceSalts, nil)
+	f.keyCounts = append(f.keyCounts, 0)
+	f.addDevice(len(f.users) - 1)
+	return uid
+}
+
+// AddUsers adds n users named "user<i>", each with a GitHub and a
+// Twitter assertion of the same name and the given number of
+// devices (at least one), and returns their UIDs.
+func (f *LocalUserFixture) AddUsers(n, devices int) []keybase1.UID {
+	uids := make([]keybase1.UID, 0, n)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("user%d", len(f.users)+1)
+		uid := f.AddUser(libkb.NewNormalizedUsername(name),
+			"github:"+name, "twitter:"+name)
+		for j := 1; j < devices; j++ {
+			f.addDevice(len(f.users) - 1)
+		}
+		uids = append(uids, uid)
+	}
+	return uids
+}
+
+// AddUsersFromSpecs adds a user with a single device for each of the
+// given specs, and returns their UIDs.
+func (f *LocalUserFixture) AddUsersFromSpecs(
+	specs []LocalUserSpec) []keybase1.UID {
+	uids := make([]keybase1.UID, 0, len(specs))
+	for _, spec := range specs {
+		uids = append(uids, f.AddUser(spec.Name, spec.Asserts...))
+	}
+	return uids
+}
+
+func (f *LocalUserFixture) userIndex(uid keybase1.UID) (int, error) {
+	for i, user := range f.users {
+		if user.UID == uid {
+			return i, nil
+		}
+	}
+	return 0, NoSuchUserError{uid.String()}
+}
+
+func (f *LocalUserFixture) deviceIndex(
+	uid keybase1.UID, index int) (int, error) {
+	i, err := f.userIndex(uid)
+	if err != nil {
+		return 0, err
+	}
+	if index < 0 || index >= len(f.deviceSalts[i]) {
+		return 0, fmt.Errorf("No device %d for user %s", index, uid)
+	}
+	return i, nil
+}
+
+// makeDeviceKeys generates the next set of device keys for the i-th
+// user, and returns them along with the name they were generated
+// from.
+func (f *LocalUserFixture) makeDeviceKeys(i int) (
+	libkb.NormalizedUsername, kbfscrypto.CryptPublicKey,
+	kbfscrypto.VerifyingKey) {
+	salt := keySaltForUserDevice(f.users[i].Name, f.keyCounts[i])
+	f.keyCounts[i]++
+	return salt, MakeLocalUserCryptPublicKeyOrBust(salt),
+		MakeLocalUserVerifyingKeyOrBust(salt)
+}
+
+func (f *LocalUserFixture) addDevice(i int) int {
+	user := &f.users[i]
+	salt, cryptPublicKey, verifyingKey := f.makeDeviceKeys(i)
+	user.VerifyingKeys = append(user.VerifyingKeys, verifyingKey)
+	user.CryptPublicKeys = append(user.CryptPublicKeys, cryptPublicKey)
+	user.KIDNames[verifyingKey.KID()] = fmt.Sprintf("dev%d", f.keyCounts[i])
+	f.deviceSalts[i] = append(f.deviceSalts[i], salt)
+	return len(f.deviceSalts[i]) - 1
+}
+
+// AddDevice adds a new device for the given user, and returns its
+// index.
+func (f *LocalUserFixture) AddDevice(uid keybase1.UID) (int, error) {
+	i, err := f.userIndex(uid)
+	if err != nil {
+		return 0, err
+	}
+	return f.addDevice(i), nil
+}
+
+// AddAssertion makes the given assertion resolve to the given user.
+func (f *LocalUserFixture) AddAssertion(
+	uid keybase1.UID, assertion string) error {
+	i, err := f.userIndex(uid)
+	if err != nil {
+		return err
+	}
+	for _, user := range f.users {
+		for _, a := range user.Asserts {
+			if a == assertion {
+				return fmt.Errorf("%s already resolves to %s",
+					assertion, user.Name)
+			}
+		}
+	}
+	f.users[i].Asserts = append(f.users[i].Asserts, assertion)
+	return nil
+}
+
+func (f *LocalUserFixture) revokeKeys(i, index int, revokedAt time.Time) {
+	user := &f.users[i]
+	if user.RevokedVerifyingKeys == nil {
+		user.RevokedVerifyingKeys =
+			make(map[kbfscrypto.VerifyingKey]keybase1.KeybaseTime)
+	}
+	if user.RevokedCryptPublicKeys == nil {
+		user.RevokedCryptPublicKeys =
+			make(map[kbfscrypto.CryptPublicKey]keybase1.KeybaseTime)
+	}
+
+	kbtime := keybase1.KeybaseTime{
+		Unix:  keybase1.ToTime(revokedAt),
+		Chain: 100,
+	}
+	user.RevokedVerifyingKeys[user.VerifyingKeys[index]] = kbtime
+	user.RevokedCryptPublicKeys[user.CryptPublicKeys[index]] = kbtime
+}
+
+// RevokeDevice revokes the device of the given user with the given
+// index, as of revokedAt. The indices of the user's later devices
+// shift down by one. The current device of a user can't be revoked.
+func (f *LocalUserFixture) RevokeDevice(
+	uid keybase1.UID, index int, revokedAt time.Time) error {
+	i, err := f.deviceIndex(uid, index)
+	if err != nil {
+		return err
+	}
+	user := &f.users[i]
+	if index == user.CurrentVerifyingKeyIndex {
+		return fmt.Errorf("Can't revoke the current device of %s",
+			user.Name)
+	}
+
+	f.revokeKeys(i, index, revokedAt)
+	user.VerifyingKeys = append(user.VerifyingKeys[:index],
+		user.VerifyingKeys[index+1:]...)
+	user.CryptPublicKeys = append(user.CryptPublicKeys[:index],
+		user.CryptPublicKeys[index+1:]...)
+	f.deviceSalts[i] = append(f.deviceSalts[i][:index],
+		f.deviceSalts[i][index+1:]...)
+	if index < user.CurrentVerifyingKeyIndex {
+		user.CurrentVerifyingKeyIndex--
+		user.CurrentCryptPublicKeyIndex--
+	}
+	return nil
+}
+
+// ChangeDeviceKeys gives the device of the given user with the given
+// index new keys, as if it had been reprovisioned; the old keys are
+// revoked as of changedAt.
+func (f *LocalUserFixture) ChangeDeviceKeys(
+	uid keybase1.UID, index int, changedAt time.Time) error {
+	i, err := f.deviceIndex(uid, index)
+	if err != nil {
+		return err
+	}
+	user := &f.users[i]
+
+	f.revokeKeys(i, index, changedAt)
+	deviceName := user.KIDNames[user.VerifyingKeys[index].KID()]
+	salt, cryptPublicKey, verifyingKey := f.makeDeviceKeys(i)
+	user.VerifyingKeys[index] = verifyingKey
+	user.CryptPublicKeys[index] = cryptPublicKey
+	user.KIDNames[verifyingKey.KID()] = deviceName
+	f.deviceSalts[i][index] = salt
+	return nil
+}
+
+// SetCurrentDevice makes the device of the given user with the given
+// index its current one.
+func (f *LocalUserFixture) SetCurrentDevice(
+	uid keybase1.UID, index int) error {
+	i, err := f.deviceIndex(uid, index)
+	if err != nil {
+		return err
+	}
+	f.users[i].CurrentVerifyingKeyIndex = index
+	f.users[i].CurrentCryptPublicKeyIndex = index
+	return nil
+}
+
+// DeviceKeys returns the private keys of the device of the given user
+// with the given index, e.g. to make a CryptoLocal for it.
+func (f *LocalUserFixture) DeviceKeys(uid keybase1.UID, index int) (
+	kbfscrypto.SigningKey, kbfscrypto.CryptPrivateKey, error) {
+	i, err := f.deviceIndex(uid, index)
+	if err != nil {
+		return kbfscrypto.SigningKey{}, kbfscrypto.CryptPrivateKey{}, err
+	}
+	salt := f.deviceSalts[i][index]
+	return MakeLocalUserSigningKeyOrBust(salt),
+		MakeLocalUserCryptPrivateKeyOrBust(salt), nil
+}
+
+// Users returns a copy of the users built so far, in the order they
+// were added, suitable to use with KBPKILocal.
+func (f *LocalUserFixture) Users() []LocalUser {
+	users := make([]LocalUser, len(f.users))
+	for i, user := range f.users {
+		users[i] = user.deepCopy()
+	}
+	return users
+}
+
+// Specs returns the name and assertions of each of the users built
+// so far.
+func (f *LocalUserFixture) Specs() []LocalUserSpec {
+	specs := make([]LocalUserSpec, len(f.users))
+	for i, user := range f.users {
+		specs[i] = LocalUserSpec{
+			Name:    user.Name,
+			Asserts: append([]string(nil), user.Asserts...),
+		}
+	}
+	return specs
+}
+
+func (lu LocalUser) deepCopy() LocalUser {
+	c := lu
+	if lu.Asserts != nil {
+		c.Asserts = append([]string(nil), lu.Asserts...)
+	}
+	c.VerifyingKeys = append(
+		[]kbfscrypto.VerifyingKey(nil), lu.VerifyingKeys...)
+	c.CryptPublicKeys = append(
+		[]kbfscrypto.CryptPublicKey(nil), lu.CryptPublicKeys...)
+	if lu.KIDNames != nil {
+		c.KIDNames = make(map[keybase1.KID]string, len(lu.KIDNames))
+		for kid, name := range lu.KIDNames {
+			c.KIDNames[kid] = name
+		}
+	}
+	if lu.RevokedVerifyingKeys != nil {
+		c.RevokedVerifyingKeys = make(
+			map[kbfscrypto.VerifyingKey]keybase1.KeybaseTime,
+			len(lu.RevokedVerifyingKeys))
+		for key, t := range lu.RevokedVerifyingKeys {
+			c.RevokedVerifyingKeys[key] = t
+		}
+	}
+	if lu.RevokedCryptPublicKeys != nil {
+		c.RevokedCryptPublicKeys = make(
+			map[kbfscrypto.CryptPublicKey]keybase1.KeybaseTime,
+			len(lu.RevokedCryptPublicKeys))
+		for key, t := range lu.RevokedCryptPublicKeys {
+			c.RevokedCryptPublicKeys[key] = t
+		}
+	}
+	if lu.UnverifiedKeys != nil {
+		c.UnverifiedKeys = append(
+			[]keybase1.PublicKey(nil), lu.UnverifiedKeys...)
+	}
+	return c
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/stretchr/testify/require"
+)
+
+func requireDeviceKeys(t *testing.T, f *LocalUserFixture, uid keybase1.UID,
+	user LocalUser, index int) {
+	signingKey, cryptPrivateKey, err := f.DeviceKeys(uid, index)
+	require.NoError(t, err)
+	require.Equal(t, user.VerifyingKeys[index],
+		signingKey.GetVerifyingKey())
+	require.Equal(t, user.CryptPublicKeys[index],
+		cryptPrivateKey.GetPublicKey())
+}
+
+func TestLocalUserFixtureMatchesMakeLocalUsers(t *testing.T) {
+	names := []libkb.NormalizedUsername{"alice", "bob"}
+	f := NewLocalUserFixture()
+	for _, name := range names {
+		f.AddUser(name)
+	}
+	require.Equal(t, MakeLocalUsers(names), f.Users())
+
+	// Extra devices match the ones added to a running daemon.
+	users := f.Users()
+	kbd := NewKeybaseDaemonMemory(
+		users[0].UID, users, kbfscodec.NewMsgpack())
+	index, err := kbd.addDeviceForTesting(users[1].UID, makeFakeKeys)
+	require.NoError(t, err)
+	index2, err := f.AddDevice(users[1].UID)
+	require.NoError(t, err)
+	require.Equal(t, index, index2)
+	require.Equal(t, kbd.localUsers[users[1].UID].VerifyingKeys,
+		f.Users()[1].VerifyingKeys)
+}
+
+func TestLocalUserFixtureAddUsers(t *testing.T) {
+	f := NewLocalUserFixture()
+	uids := f.AddUsers(3, 2)
+	require.Len(t, uids, 3)
+
+	users := f.Users()
+	for i, user := range users {
+		require.Equal(t, keybase1.MakeTestUID(uint32(i+1)), user.UID)
+		require.Equal(t, uids[i], user.UID)
+		require.Len(t, user.VerifyingKeys, 2)
+		require.Len(t, user.CryptPublicKeys, 2)
+		require.Len(t, user.Asserts, 2)
+		for j := range user.VerifyingKeys {
+			requireDeviceKeys(t, f, user.UID, user, j)
+		}
+	}
+	require.Equal(t, "user2", users[1].Name.String())
+	require.Equal(t, []string{"github:user2", "twitter:user2"},
+		users[1].Asserts)
+
+	err := f.AddAssertion(uids[0], "github:user2")
+	require.Error(t, err)
+	err = f.AddAssertion(uids[0], "reddit:user1")
+	require.NoError(t, err)
+	require.Equal(t, LocalUserSpec{
+		Name:    "user1",
+		Asserts: []string{"github:user1", "twitter:user1", "reddit:user1"},
+	}, f.Specs()[0])
+}
+
+func TestLocalUserFixtureRevokeAndChangeKeys(t *testing.T) {
+	f := NewLocalUserFixture()
+	uid := f.AddUser("alice")
+	for i := 0; i < 2; i++ {
+		_, err := f.AddDevice(uid)
+		require.NoError(t, err)
+	}
+	before := f.Users()[0]
+
+	// The current device can't be revoked.
+	now := time.Now()
+	err := f.RevokeDevice(uid, 0, now)
+	require.Error(t, err)
+
+	err = f.SetCurrentDevice(uid, 2)
+	require.NoError(t, err)
+	err = f.RevokeDevice(uid, 1, now)
+	require.NoError(t, err)
+	after := f.Users()[0]
+	require.Equal(t, []kbfscrypto.VerifyingKey{
+		before.VerifyingKeys[0], before.VerifyingKeys[2]},
+		after.VerifyingKeys)
+	require.Equal(t, 1, after.CurrentVerifyingKeyIndex)
+	require.Equal(t, 1, after.CurrentCryptPublicKeyIndex)
+	require.Contains(t, after.RevokedVerifyingKeys, before.VerifyingKeys[1])
+	require.Contains(t, after.RevokedCryptPublicKeys,
+		before.CryptPublicKeys[1])
+	requireDeviceKeys(t, f, uid, after, 1)
+
+	err = f.ChangeDeviceKeys(uid, 0, now)
+	require.NoError(t, err)
+	changed := f.Users()[0]
+	require.NotEqual(t, after.VerifyingKeys[0], changed.VerifyingKeys[0])
+	require.NotEqual(t, after.CryptPublicKeys[0], changed.CryptPublicKeys[0])
+	require.Contains(t, changed.RevokedVerifyingKeys, after.VerifyingKeys[0])
+	require.Equal(t, "dev1",
+		changed.KIDNames[changed.VerifyingKeys[0].KID()])
+	requireDeviceKeys(t, f, uid, changed, 0)
+
+	// Users returns copies.
+	changed.VerifyingKeys[0] = after.VerifyingKeys[0]
+	require.NotEqual(t, after.VerifyingKeys[0],
+		f.Users()[0].VerifyingKeys[0])
+}
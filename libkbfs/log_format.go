@@ -0,0 +1,230 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	logging "github.com/keybase/go-logging"
+	"github.com/keybase/kbfs/tlf"
+)
+
+const (
+	// LogFormatText is the default, human-readable log format.
+	LogFormatText = "text"
+	// LogFormatJSON logs one JSON object per line, suitable for
+	// ingestion into log aggregation systems.
+	LogFormatJSON = "json"
+)
+
+func checkLogFormat(format string) error {
+	switch format {
+	case "", LogFormatText, LogFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("Unknown log format %q", format)
+	}
+}
+
+// jsonLogRecord is the structure of each line written by
+// jsonLogFormatter.
+type jsonLogRecord struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Module  string    `json:"module"`
+	File    string    `json:"file,omitempty"`
+	Message string    `json:"msg"`
+	// Tags holds the context log tags (e.g., operation IDs like
+	// FBOID) attached to the message, keyed by tag name.
+	Tags map[string]string `json:"tags,omitempty"`
+	// TLF, Op and LatencyMs come from a logOpFields argument of
+	// the message, if there is one.
+	TLF       string  `json:"tlf,omitempty"`
+	Op        string  `json:"op,omitempty"`
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+}
+
+// logOpFields describes a finished operation on a TLF. Passed as an
+// argument to a log call, it is printed inline by the text format,
+// and becomes the tlf, op and latency_ms fields of the record in the
+// JSON format.
+type logOpFields struct {
+	TLF     tlf.ID
+	Op      string
+	Latency time.Duration
+}
+
+func (f logOpFields) String() string {
+	return fmt.Sprintf("[tlf=%s op=%s latency=%s]", f.TLF, f.Op, f.Latency)
+}
+
+// findLogOpFields returns the first logOpFields among args, if any.
+func findLogOpFields(args []interface{}) (logOpFields, bool) {
+	for _, arg := range args {
+		if f, ok := arg.(logOpFields); ok {
+			return f, true
+		}
+	}
+	return logOpFields{}, false
+}
+
+// logTagsPrefix is the marker logger.Standard uses to append context
+// log tags to a formatted message.
+const logTagsPrefix = " [tags:"
+
+// splitLogTags splits the tags that logger.Standard appends to
+// context-based messages back out of msg.
+func splitLogTags(msg string) (string, map[string]string) {
+	i := strings.LastIndex(msg, logTagsPrefix)
+	if i < 0 || !strings.HasSuffix(msg, "]") {
+		return msg, nil
+	}
+	tagStr := msg[i+len(logTagsPrefix) : len(msg)-1]
+	tags := make(map[string]string)
+	for _, kv := range strings.Split(tagStr, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			// Not something we generated; leave the message alone.
+			return msg, nil
+		}
+		tags[parts[0]] = parts[1]
+	}
+	return msg[:i], tags
+}
+
+// jsonLogFormatter is a go-logging Formatter that renders each
+// record as a single line of JSON.
+type jsonLogFormatter struct{}
+
+var _ logging.Formatter = jsonLogFormatter{}
+
+// Format implements the logging.Formatter interface for
+// jsonLogFormatter.
+func (jsonLogFormatter) Format(
+	calldepth int, r *logging.Record, w io.Writer) error {
+	msg, tags := splitLogTags(r.Message())
+	rec := jsonLogRecord{
+		Time:    r.Time,
+		Level:   r.Level.String(),
+		Module:  r.Module,
+		Message: msg,
+		Tags:    tags,
+	}
+	if f, ok := findLogOpFields(r.Args); ok {
+		// The fields are in the record already, so drop them
+		// from the message.
+		rec.Message = strings.Replace(msg, " "+f.String(), "", 1)
+		rec.TLF = f.TLF.String()
+		rec.Op = f.Op
+		rec.LatencyMs = float64(f.Latency) / float64(time.Millisecond)
+	}
+	if _, file, line, ok := runtime.Caller(calldepth + 1); ok {
+		rec.File = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+var logFormatLock sync.Mutex
+
+// logFormat is the log format in use by the whole process, since
+// the go-logging formatter is global.
+var logFormat string
+
+// setLogFormat switches the global log formatter to the given
+// format. It must be called after any direct calls to Configure()
+// on loggers not wrapped by wrapLoggerForFormat, since those reset
+// the formatter.
+func setLogFormat(format string) {
+	logFormatLock.Lock()
+	defer logFormatLock.Unlock()
+	logFormat = format
+	if format == LogFormatJSON {
+		logging.SetFormatter(jsonLogFormatter{})
+	}
+}
+
+func getLogFormat() string {
+	logFormatLock.Lock()
+	defer logFormatLock.Unlock()
+	return logFormat
+}
+
+// jsonLogger wraps a logger.Logger so that calls to Configure only
+// adjust the debug level, instead of resetting the global JSON
+// formatter.
+type jsonLogger struct {
+	logger.Logger
+	module string
+}
+
+// Configure implements the logger.Logger interface for jsonLogger.
+func (l jsonLogger) Configure(style string, debug bool, filename string) {
+	if debug {
+		logging.SetLevel(logging.DEBUG, l.module)
+	}
+	applyLogModuleLevel(l.module)
+}
+
+// CloneWithAddedDepth implements the logger.Logger interface for
+// jsonLogger.
+func (l jsonLogger) CloneWithAddedDepth(depth int) logger.Logger {
+	return jsonLogger{l.Logger.CloneWithAddedDepth(depth), l.module}
+}
+
+// logModules holds the names of all the modules for which loggers
+// have been made by wrapLoggerForFormat, so that their levels can be
+// changed later.
+var logModules = make(map[string]bool)
+
+func getLogModules() []string {
+	logFormatLock.Lock()
+	defer logFormatLock.Unlock()
+	modules := make([]string, 0, len(logModules))
+	for module := range logModules {
+		modules = append(modules, module)
+	}
+	return modules
+}
+
+// setLogDebugForAllModules turns debug logging on or off for every
+// module that has a logger, except for those with an explicit level
+// set by setLogModuleLevels.
+func setLogDebugForAllModules(debug bool) {
+	level := logging.INFO
+	if debug {
+		level = logging.DEBUG
+	}
+	for _, module := range getLogModules() {
+		if hasLogModuleLevel(module) {
+			continue
+		}
+		logging.SetLevel(level, module)
+	}
+}
+
+// wrapLoggerForFormat returns a logger for the given module that
+// preserves the current log format across calls to Configure.
+func wrapLoggerForFormat(lg logger.Logger, module string) logger.Logger {
+	logFormatLock.Lock()
+	logModules[module] = true
+	logFormatLock.Unlock()
+	if getLogFormat() != LogFormatJSON {
+		return lg
+	}
+	return jsonLogger{lg, module}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	logging "github.com/keybase/go-logging"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitLogTags(t *testing.T) {
+	msg, tags := splitLogTags("Lookup foo [tags:FBOID=abc,CRID=def]")
+	require.Equal(t, "Lookup foo", msg)
+	require.Equal(t, map[string]string{"FBOID": "abc", "CRID": "def"}, tags)
+
+	msg, tags = splitLogTags("no tags here")
+	require.Equal(t, "no tags here", msg)
+	require.Nil(t, tags)
+
+	msg, tags = splitLogTags("weird [tags:nope]")
+	require.Equal(t, "weird [tags:nope]", msg)
+	require.Nil(t, tags)
+}
+
+func TestJSONLogFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	backend := logging.NewLogBackend(&buf, "", 0)
+	log := logging.MustGetLogger("kbfs(test)")
+	log.SetBackend(logging.AddModuleLevel(
+		logging.NewBackendFormatter(backend, jsonLogFormatter{})))
+
+	log.Infof("Hello %s [tags:FBOID=xyz]", "world")
+
+	var rec jsonLogRecord
+	err := json.Unmarshal(buf.Bytes(), &rec)
+	require.NoError(t, err)
+	require.Equal(t, "INFO", rec.Level)
+	require.Equal(t, "kbfs(test)", rec.Module)
+	require.Equal(t, "Hello world", rec.Message)
+	require.Equal(t, map[string]string{"FBOID": "xyz"}, rec.Tags)
+	require.Contains(t, rec.File, "log_format_test.go")
+}
+
+func TestJSONLogFormatterOpFields(t *testing.T) {
+	var buf bytes.Buffer
+	backend := logging.NewLogBackend(&buf, "", 0)
+	log := logging.MustGetLogger("kbfs(test)")
+	log.SetBackend(logging.AddModuleLevel(
+		logging.NewBackendFormatter(backend, jsonLogFormatter{})))
+
+	tlfID := tlf.FakeID(1, false)
+	fields := logOpFields{
+		TLF:     tlfID,
+		Op:      "Lookup",
+		Latency: 1500 * time.Microsecond,
+	}
+	log.Infof("Lookup foo done: %+v %s [tags:FBOID=xyz]", nil, fields)
+
+	var rec jsonLogRecord
+	err := json.Unmarshal(buf.Bytes(), &rec)
+	require.NoError(t, err)
+	require.Equal(t, "Lookup foo done: <nil>", rec.Message)
+	require.Equal(t, map[string]string{"FBOID": "xyz"}, rec.Tags)
+	require.Equal(t, tlfID.String(), rec.TLF)
+	require.Equal(t, "Lookup", rec.Op)
+	require.Equal(t, 1.5, rec.LatencyMs)
+}
@@ -0,0 +1,185 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	logging "github.com/keybase/go-logging"
+)
+
+var logLevelsLock sync.Mutex
+
+// logModuleLevels holds the log levels that have been set explicitly
+// for individual modules, which take precedence over the global
+// debug setting.
+var logModuleLevels = make(map[string]logging.Level)
+
+// parseLogModuleLevels checks that every value in levels is a valid
+// go-logging level name (e.g., "debug" or "warning"), and returns
+// the parsed levels.
+func parseLogModuleLevels(levels map[string]string) (
+	map[string]logging.Level, error) {
+	parsed := make(map[string]logging.Level, len(levels))
+	for module, levelStr := range levels {
+		if module == "" {
+			return nil, fmt.Errorf("Empty log module name")
+		}
+		level, err := logging.LogLevel(levelStr)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Invalid log level %q for module %s", levelStr, module)
+		}
+		parsed[module] = level
+	}
+	return parsed, nil
+}
+
+// setLogModuleLevels replaces the set of explicit per-module log
+// levels with the given one, and applies it. Modules that previously
+// had an explicit level but are not in levels keep their current
+// level until the next global debug change.
+func setLogModuleLevels(levels map[string]string) error {
+	parsed, err := parseLogModuleLevels(levels)
+	if err != nil {
+		return err
+	}
+	logLevelsLock.Lock()
+	defer logLevelsLock.Unlock()
+	logModuleLevels = parsed
+	for module, level := range parsed {
+		logging.SetLevel(level, module)
+	}
+	return nil
+}
+
+// updateLogModuleLevels applies the difference between two sets of
+// explicit per-module log levels, as from two versions of a config
+// file. Modules whose level is the same in both, or that are in
+// neither (like those set at runtime by setLogModuleLevel), are left
+// alone. Modules dropped from newLevels lose their explicit level,
+// and go back to the global one on the next call to
+// setLogDebugForAllModules.
+func updateLogModuleLevels(oldLevels, newLevels map[string]string) error {
+	parsed, err := parseLogModuleLevels(newLevels)
+	if err != nil {
+		return err
+	}
+	logLevelsLock.Lock()
+	defer logLevelsLock.Unlock()
+	for module := range oldLevels {
+		if _, ok := newLevels[module]; !ok {
+			delete(logModuleLevels, module)
+		}
+	}
+	for module, level := range parsed {
+		if oldLevels[module] == newLevels[module] {
+			continue
+		}
+		logModuleLevels[module] = level
+		logging.SetLevel(level, module)
+	}
+	return nil
+}
+
+// setLogModuleLevel sets the log level for a single module, and
+// remembers it so that it survives later calls to Configure and to
+// setLogDebugForAllModules.
+func setLogModuleLevel(module, levelStr string) error {
+	parsed, err := parseLogModuleLevels(map[string]string{module: levelStr})
+	if err != nil {
+		return err
+	}
+	logLevelsLock.Lock()
+	defer logLevelsLock.Unlock()
+	logModuleLevels[module] = parsed[module]
+	logging.SetLevel(parsed[module], module)
+	return nil
+}
+
+// applyLogModuleLevel re-applies the explicit level for the given
+// module, if there is one. It should be called after any call to
+// Configure on a logger for that module, since that may have
+// changed its level.
+func applyLogModuleLevel(module string) {
+	logLevelsLock.Lock()
+	defer logLevelsLock.Unlock()
+	if level, ok := logModuleLevels[module]; ok {
+		logging.SetLevel(level, module)
+	}
+}
+
+func hasLogModuleLevel(module string) bool {
+	logLevelsLock.Lock()
+	defer logLevelsLock.Unlock()
+	_, ok := logModuleLevels[module]
+	return ok
+}
+
+// getLogModuleLevels returns the current log level of every module
+// that has a logger or an explicit level.
+func getLogModuleLevels() map[string]string {
+	modules := getLogModules()
+	logLevelsLock.Lock()
+	for module := range logModuleLevels {
+		modules = append(modules, module)
+	}
+	logLevelsLock.Unlock()
+
+	levels := make(map[string]string, len(modules))
+	for _, module := range modules {
+		levels[module] = logging.GetLevel(module).String()
+	}
+	return levels
+}
+
+// LogLevelsFlag is for specifying per-module log levels with the
+// flag package, as a comma-separated list of module=level pairs,
+// e.g. "kbfs(BSR)=debug,kbfs=warning".
+type LogLevelsFlag struct {
+	v *map[string]string
+}
+
+// Get for flag interface.
+func (lf LogLevelsFlag) Get() interface{} { return *lf.v }
+
+// String for flag interface.
+func (lf LogLevelsFlag) String() string {
+	// This happens when isZeroValue() from flag.go makes a zero
+	// value from the type of a flag.
+	if lf.v == nil {
+		return ""
+	}
+	strs := make([]string, 0, len(*lf.v))
+	for module, level := range *lf.v {
+		strs = append(strs, module+"="+level)
+	}
+	sort.Strings(strs)
+	return strings.Join(strs, ",")
+}
+
+// Set for flag interface.
+func (lf LogLevelsFlag) Set(raw string) error {
+	levels := make(map[string]string)
+	if raw != "" {
+		for _, entry := range strings.Split(raw, ",") {
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf(
+					"Invalid syntax: %q, expected module=level", entry)
+			}
+			levels[strings.TrimSpace(parts[0])] =
+				strings.TrimSpace(parts[1])
+		}
+	}
+	if _, err := parseLogModuleLevels(levels); err != nil {
+		return err
+	}
+	*lf.v = levels
+	return nil
+}
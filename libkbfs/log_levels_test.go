@@ -0,0 +1,57 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"flag"
+	"testing"
+
+	logging "github.com/keybase/go-logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogLevelsFlag(t *testing.T) {
+	var levels map[string]string
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(LogLevelsFlag{&levels}, "log-levels", "")
+	err := fs.Parse([]string{"-log-levels", "kbfs(BSR)=debug, kbfs=warning"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"kbfs(BSR)": "debug",
+		"kbfs":      "warning",
+	}, levels)
+	require.Equal(t, "kbfs(BSR)=debug,kbfs=warning",
+		LogLevelsFlag{&levels}.String())
+
+	err = LogLevelsFlag{&levels}.Set("kbfs")
+	require.Error(t, err)
+	err = LogLevelsFlag{&levels}.Set("kbfs=loud")
+	require.Error(t, err)
+}
+
+func TestSetLogModuleLevels(t *testing.T) {
+	const module = "kbfs(leveltest)"
+	defer func() {
+		err := setLogModuleLevels(nil)
+		require.NoError(t, err)
+	}()
+
+	// Levels are set from flags before any loggers are made, and
+	// must survive making them, with or without debugging.
+	err := setLogModuleLevels(map[string]string{module: "warning"})
+	require.NoError(t, err)
+	newModuleLogger(module, false)
+	require.Equal(t, logging.WARNING, logging.GetLevel(module))
+	newModuleLogger(module, true)
+	require.Equal(t, logging.WARNING, logging.GetLevel(module))
+
+	// The explicit level wins over the global debug setting.
+	setLogDebugForAllModules(true)
+	require.Equal(t, logging.WARNING, logging.GetLevel(module))
+
+	err = setLogModuleLevel(module, "debug")
+	require.NoError(t, err)
+	require.Equal(t, "DEBUG", getLogModuleLevels()[module])
+}
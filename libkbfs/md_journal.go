@@ -443,7 +443,10 @@ func (j mdJournal) getMDAndExtra(entry mdIDJournalEntry, verifyBranchID bool) (
 		return nil, nil, time.Time{}, err
 	}
 
-	err = rmd.IsValidAndSigned(j.codec, j.crypto, extra)
+	// Everything in the journal was made by this device, so there's
+	// no need to look up the members of a team TLF; the server
+	// checks them when the journal is flushed.
+	err = rmd.IsValidAndSigned(context.TODO(), j.codec, j.crypto, nil, extra)
 	if err != nil {
 		return nil, nil, time.Time{}, err
 	}
@@ -562,7 +565,8 @@ func (j mdJournal) checkGetParams() (ImmutableBareRootMetadata, error) {
 		return ImmutableBareRootMetadata{}, nil
 	}
 
-	ok, err := isReader(j.uid, head.BareRootMetadata, head.extra)
+	ok, err := isReader(
+		context.TODO(), nil, j.uid, head.BareRootMetadata, head.extra)
 	if err != nil {
 		return ImmutableBareRootMetadata{}, err
 	}
@@ -1144,7 +1148,7 @@ func (j *mdJournal) put(
 	// Check permissions and consistency with head, if it exists.
 	if head != (ImmutableBareRootMetadata{}) {
 		ok, err := isWriterOrValidRekey(
-			j.codec, j.uid, head.BareRootMetadata, rmd.bareMd,
+			ctx, nil, j.codec, j.uid, head.BareRootMetadata, rmd.bareMd,
 			head.extra, rmd.extra)
 		if err != nil {
 			return MdID{}, err
@@ -1190,7 +1194,8 @@ func (j *mdJournal) put(
 		return MdID{}, err
 	}
 
-	err = rmd.bareMd.IsValidAndSigned(j.codec, j.crypto, rmd.extra)
+	err = rmd.bareMd.IsValidAndSigned(
+		ctx, j.codec, j.crypto, nil, rmd.extra)
 	if err != nil {
 		return MdID{}, err
 	}
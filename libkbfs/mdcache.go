@@ -5,14 +5,13 @@
 package libkbfs
 
 import (
-	lru "github.com/hashicorp/golang-lru"
 	"github.com/keybase/kbfs/tlf"
 )
 
 // MDCacheStandard implements a simple LRU cache for per-folder
 // metadata objects.
 type MDCacheStandard struct {
-	lru *lru.Cache
+	lru evictingCache
 }
 
 type mdCacheKey struct {
@@ -26,7 +25,14 @@ const defaultMDCacheCapacity = 5000
 // NewMDCacheStandard constructs a new MDCacheStandard using the given
 // cache capacity.
 func NewMDCacheStandard(capacity int) *MDCacheStandard {
-	tmp, err := lru.New(capacity)
+	return NewMDCacheStandardWithPolicy(capacity, LRUCacheEviction)
+}
+
+// NewMDCacheStandardWithPolicy constructs a new MDCacheStandard using
+// the given cache capacity and eviction policy.
+func NewMDCacheStandardWithPolicy(
+	capacity int, policy CacheEvictionPolicy) *MDCacheStandard {
+	tmp, err := newEvictingCache(policy, capacity, nil)
 	if err != nil {
 		return nil
 	}
@@ -18,10 +18,16 @@ import (
 	"github.com/keybase/kbfs/tlf"
 	"github.com/pkg/errors"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 	"golang.org/x/net/context"
 )
 
 type mdServerDiskShared struct {
+	// openDB opens the leveldb with the given slash-separated
+	// name: "handles", "branches", or "<TLF ID>/md.db".
+	openDB func(name string) (*levelDB, error)
+	// dirPath is the directory the leveldbs are in, or empty if
+	// they're not on local disk.
 	dirPath string
 
 	// Protects handleDb, branchDb, tlfStorage, and
@@ -29,21 +35,27 @@ type mdServerDiskShared struct {
 	// branchDb, tlfStorage, and truncateLockManager are nil.
 	lock sync.RWMutex
 	// Bare TLF handle -> TLF ID
-	handleDb *leveldb.DB
+	handleDb *levelDB
 	// (TLF ID, device KID) -> branch ID
-	branchDb   *leveldb.DB
+	branchDb   *levelDB
 	tlfStorage map[tlf.ID]*mdServerTlfStorage
 	// Always use memory for the lock storage, so it gets wiped
 	// after a restart.
 	truncateLockManager *mdServerLocalTruncateLockManager
+	lockManager         *mdServerLocalLockManager
 
 	updateManager *mdServerLocalUpdateManager
 
+	// Closed on shutdown, to stop any background history
+	// compaction.
+	shutdownCh chan struct{}
+
+	unlock       func() error
 	shutdownFunc func(logger.Logger)
 }
 
-// MDServerDisk stores all info on disk, either in levelDBs, or disk
-// journals and flat files for the actual MDs.
+// MDServerDisk stores all info in levelDBs, either on local disk or
+// in an S3-compatible bucket.
 type MDServerDisk struct {
 	config mdServerLocalConfig
 	log    logger.Logger
@@ -53,36 +65,68 @@ type MDServerDisk struct {
 
 var _ mdServerLocal = (*MDServerDisk)(nil)
 
-func newMDServerDisk(config mdServerLocalConfig, dirPath string,
+// newMDServerLevelDB constructs a new MDServerDisk that stores its
+// data in the leveldbs opened by openDB. unlock is called on
+// shutdown.
+func newMDServerLevelDB(config mdServerLocalConfig,
+	openDB func(name string) (*levelDB, error), unlock func() error,
 	shutdownFunc func(logger.Logger)) (*MDServerDisk, error) {
-	handlePath := filepath.Join(dirPath, "handles")
-	handleDb, err := leveldb.OpenFile(handlePath, leveldbOptions)
+	handleDb, err := openDB("handles")
 	if err != nil {
 		return nil, err
 	}
 
-	branchPath := filepath.Join(dirPath, "branches")
-	branchDb, err := leveldb.OpenFile(branchPath, leveldbOptions)
+	branchDb, err := openDB("branches")
 	if err != nil {
+		handleDb.Close()
 		return nil, err
 	}
 	log := config.MakeLogger("MDSD")
 	truncateLockManager := newMDServerLocalTruncatedLockManager()
+	lockManager := newMDServerLocalLockManager()
 	shared := mdServerDiskShared{
-		dirPath:             dirPath,
+		openDB:              openDB,
 		handleDb:            handleDb,
 		branchDb:            branchDb,
 		tlfStorage:          make(map[tlf.ID]*mdServerTlfStorage),
 		truncateLockManager: &truncateLockManager,
+		lockManager:         &lockManager,
 		updateManager:       newMDServerLocalUpdateManager(),
+		shutdownCh:          make(chan struct{}),
+		unlock:              unlock,
 		shutdownFunc:        shutdownFunc,
 	}
 	mdserv := &MDServerDisk{config, log, &shared}
 	return mdserv, nil
 }
 
+func newMDServerDisk(config mdServerLocalConfig, dirPath string,
+	shutdownFunc func(logger.Logger)) (mdserv *MDServerDisk, err error) {
+	unlockDir, err := lockDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			unlockDir()
+		}
+	}()
+
+	openDB := func(name string) (*levelDB, error) {
+		return openLevelDBFile(
+			filepath.Join(dirPath, filepath.FromSlash(name)))
+	}
+	mdserv, err = newMDServerLevelDB(config, openDB, unlockDir, shutdownFunc)
+	if err != nil {
+		return nil, err
+	}
+	mdserv.dirPath = dirPath
+	return mdserv, nil
+}
+
 // NewMDServerDir constructs a new MDServerDisk that stores its data
-// in the given directory.
+// in the given directory. It returns a DirInUseError if another
+// process is already using that directory.
 func NewMDServerDir(
 	config mdServerLocalConfig, dirPath string) (*MDServerDisk, error) {
 	return newMDServerDisk(config, dirPath, nil)
@@ -103,6 +147,35 @@ func NewMDServerTempDir(config mdServerLocalConfig) (*MDServerDisk, error) {
 	})
 }
 
+// newMDServerS3 constructs a new MDServerDisk that stores its data
+// in the given S3-compatible bucket, so that the server itself keeps
+// no state. Only one server may use a bucket prefix at a time.
+func newMDServerS3(
+	config mdServerLocalConfig, bucket *s3Bucket) (*MDServerDisk, error) {
+	openDB := func(name string) (*levelDB, error) {
+		return openLevelDB(newS3LevelDBStorage(bucket.withPrefix(name)),
+			s3LevelDBOptions)
+	}
+	return newMDServerLevelDB(config, openDB, func() error { return nil }, nil)
+}
+
+// MDHistoryCompactionPolicy says which revisions of each TLF's merged
+// history a local MD server may delete. A revision is deleted if
+// either limit says so, but the head revision is always kept.
+type MDHistoryCompactionPolicy struct {
+	// KeepRevisions, if positive, is the number of most recent
+	// revisions to keep.
+	KeepRevisions int
+	// MaxAge, if positive, is how long after it was put to keep
+	// a revision.
+	MaxAge time.Duration
+}
+
+// IsSet returns whether the policy would ever delete anything.
+func (p MDHistoryCompactionPolicy) IsSet() bool {
+	return p.KeepRevisions > 0 || p.MaxAge > 0
+}
+
 type errMDServerDiskShutdown struct{}
 
 func (e errMDServerDiskShutdown) Error() string {
@@ -146,10 +219,27 @@ func (md *MDServerDisk) getStorage(tlfID tlf.ID) (*mdServerTlfStorage, error) {
 		return storage, nil
 	}
 
-	path := filepath.Join(md.dirPath, tlfID.String())
+	db, err := md.openDB(tlfID.String() + "/md.db")
+	if err != nil {
+		return nil, err
+	}
+	if md.dirPath != "" {
+		migrated, err := migrateOldMDServerTlfDir(md.config.Codec(),
+			filepath.Join(md.dirPath, tlfID.String()), db)
+		if err != nil {
+			db.Close()
+			return nil, errors.WithMessage(err,
+				"Couldn't migrate MD server data from the old layout")
+		}
+		if migrated {
+			md.log.Debug("Migrated MD server data of %s from the old "+
+				"layout", tlfID)
+		}
+	}
 	storage = makeMDServerTlfStorage(
 		tlfID, md.config.Codec(), md.config.cryptoPure(),
-		md.config.Clock(), md.config.MetadataVersion(), path)
+		md.config.teamInfoGetter(), md.config.Clock(),
+		md.config.MetadataVersion(), db)
 
 	md.tlfStorage[tlfID] = storage
 	return storage, nil
@@ -347,7 +437,7 @@ func (md *MDServerDisk) GetForTLF(ctx context.Context, id tlf.ID,
 		return nil, err
 	}
 
-	return tlfStorage.getForTLF(currentUID, bid)
+	return tlfStorage.getForTLF(ctx, currentUID, bid)
 }
 
 // GetRange implements the MDServer interface for MDServerDisk.
@@ -382,7 +472,7 @@ func (md *MDServerDisk) GetRange(ctx context.Context, id tlf.ID,
 		return nil, err
 	}
 
-	return tlfStorage.getRange(currentUID, bid, start, stop)
+	return tlfStorage.getRange(ctx, currentUID, bid, start, stop)
 }
 
 // Put implements the MDServer interface for MDServerDisk.
@@ -404,7 +494,7 @@ func (md *MDServerDisk) Put(ctx context.Context, rmds *RootMetadataSigned,
 	}
 
 	recordBranchID, err := tlfStorage.put(
-		currentUID, currentVerifyingKey, rmds, extra)
+		ctx, currentUID, currentVerifyingKey, rmds, extra)
 	if err != nil {
 		return err
 	}
@@ -452,6 +542,57 @@ func (md *MDServerDisk) PruneBranch(ctx context.Context, id tlf.ID, bid BranchID
 	return md.deleteBranchID(ctx, id)
 }
 
+// TruncateHistoryAfter implements the mdServerLocal interface for
+// MDServerDisk.
+func (md *MDServerDisk) TruncateHistoryAfter(
+	ctx context.Context, id tlf.ID, rev MetadataRevision) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+
+	_, currentUID, err := md.config.currentInfoGetter().GetCurrentUserInfo(ctx)
+	if err != nil {
+		return MDServerError{err}
+	}
+
+	tlfStorage, err := md.getStorage(id)
+	if err != nil {
+		return err
+	}
+
+	removed, err := tlfStorage.truncateHistoryAfter(ctx, currentUID, rev)
+	if err != nil {
+		return err
+	}
+	md.log.CDebugf(ctx, "Truncated %s to revision %d, deleting %d revisions",
+		id, rev, removed)
+
+	// Any unmerged branch may be based on a deleted revision, so
+	// forget all of them. Like in PruneBranch, the unmerged
+	// history itself is left in place.
+	md.lock.Lock()
+	defer md.lock.Unlock()
+	err = md.checkShutdownLocked()
+	if err != nil {
+		return err
+	}
+
+	iter := md.branchDb.NewIterator(util.BytesPrefix(id.Bytes()), nil)
+	defer iter.Release()
+	var batch leveldb.Batch
+	for iter.Next() {
+		batch.Delete(iter.Key())
+	}
+	if err := iter.Error(); err != nil {
+		return MDServerError{err}
+	}
+	err = md.branchDb.Write(&batch, nil)
+	if err != nil {
+		return MDServerError{err}
+	}
+	return nil
+}
+
 func (md *MDServerDisk) getCurrentMergedHeadRevision(
 	ctx context.Context, id tlf.ID) (rev MetadataRevision, err error) {
 	head, err := md.GetForTLF(ctx, id, NullBranchID, Merged)
@@ -531,6 +672,52 @@ func (md *MDServerDisk) TruncateUnlock(ctx context.Context, id tlf.ID) (
 	return md.truncateLockManager.truncateUnlock(key.KID(), id)
 }
 
+// Lock implements the MDServer interface for MDServerDisk.
+func (md *MDServerDisk) Lock(ctx context.Context, id tlf.ID,
+	lockID LockID) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+
+	key, err := md.config.currentInfoGetter().GetCurrentCryptPublicKey(ctx)
+	if err != nil {
+		return MDServerError{err}
+	}
+
+	md.lock.Lock()
+	defer md.lock.Unlock()
+	err = md.checkShutdownLocked()
+	if err != nil {
+		return err
+	}
+
+	return md.lockManager.lock(
+		key.KID(), id, lockID, md.config.Clock().Now())
+}
+
+// ReleaseLock implements the MDServer interface for MDServerDisk.
+func (md *MDServerDisk) ReleaseLock(ctx context.Context, id tlf.ID,
+	lockID LockID) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+
+	key, err := md.config.currentInfoGetter().GetCurrentCryptPublicKey(ctx)
+	if err != nil {
+		return MDServerError{err}
+	}
+
+	md.lock.Lock()
+	defer md.lock.Unlock()
+	err = md.checkShutdownLocked()
+	if err != nil {
+		return err
+	}
+
+	return md.lockManager.releaseLock(
+		key.KID(), id, lockID, md.config.Clock().Now())
+}
+
 // Shutdown implements the MDServer interface for MDServerDisk.
 func (md *MDServerDisk) Shutdown() {
 	md.lock.Lock()
@@ -554,6 +741,12 @@ func (md *MDServerDisk) Shutdown() {
 		s.shutdown()
 	}
 
+	close(md.shutdownCh)
+
+	if err := md.unlock(); err != nil {
+		md.log.Warning("Couldn't unlock the MD server's storage: %+v", err)
+	}
+
 	if md.shutdownFunc != nil {
 		md.shutdownFunc(md.log)
 	}
@@ -673,6 +866,57 @@ func (md *MDServerDisk) GetLatestHandleForTLF(ctx context.Context, id tlf.ID) (
 	return handle, nil
 }
 
+// GetTLFIDsForCurrentUser implements the MDServer interface for
+// MDServerDisk.
+func (md *MDServerDisk) GetTLFIDsForCurrentUser(
+	ctx context.Context) ([]tlf.ID, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	_, uid, err := md.config.currentInfoGetter().GetCurrentUserInfo(ctx)
+	if err != nil {
+		return nil, MDServerError{err}
+	}
+
+	md.lock.RLock()
+	defer md.lock.RUnlock()
+	err = md.checkShutdownLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	// A TLF may have more than one handle, e.g. after an assertion
+	// in it is resolved, so list it if the user is in any of them.
+	found := make(map[tlf.ID]bool)
+	var ids []tlf.ID
+	iter := md.handleDb.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		var id tlf.ID
+		err := id.UnmarshalBinary(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if found[id] {
+			continue
+		}
+		var handle tlf.Handle
+		err = md.config.Codec().Decode(iter.Key(), &handle)
+		if err != nil {
+			return nil, err
+		}
+		if isMemberOfHandle(uid, handle) {
+			found[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 // OffsetFromServerTime implements the MDServer interface for
 // MDServerDisk.
 func (md *MDServerDisk) OffsetFromServerTime() (time.Duration, bool) {
@@ -694,3 +938,91 @@ func (md *MDServerDisk) GetKeyBundles(ctx context.Context,
 
 	return tlfStorage.getKeyBundles(tlfID, wkbID, rkbID)
 }
+
+// getAllTlfIDs returns the IDs of all TLFs that have a handle, which
+// includes all TLFs with any MD.
+func (md *MDServerDisk) getAllTlfIDs() ([]tlf.ID, error) {
+	md.lock.RLock()
+	defer md.lock.RUnlock()
+	err := md.checkShutdownLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[tlf.ID]bool)
+	var tlfIDs []tlf.ID
+	iter := md.handleDb.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		var id tlf.ID
+		err := id.UnmarshalBinary(iter.Value())
+		if err != nil {
+			return nil, MDServerError{err}
+		}
+		// Several handles may map to the same TLF.
+		if !seen[id] {
+			seen[id] = true
+			tlfIDs = append(tlfIDs, id)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, MDServerError{err}
+	}
+	return tlfIDs, nil
+}
+
+// CompactHistory deletes old revisions of every TLF's merged history,
+// according to policy. Clients that fall behind the deleted
+// revisions can no longer catch up from them, so this is meant for
+// long-lived local servers with few clients.
+func (md *MDServerDisk) CompactHistory(
+	ctx context.Context, policy MDHistoryCompactionPolicy) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	if !policy.IsSet() {
+		return nil
+	}
+
+	tlfIDs, err := md.getAllTlfIDs()
+	if err != nil {
+		return err
+	}
+	now := md.config.Clock().Now()
+	for _, tlfID := range tlfIDs {
+		storage, err := md.getStorage(tlfID)
+		if err != nil {
+			return err
+		}
+		removed, err := storage.compactHistory(policy, now)
+		if err != nil {
+			return err
+		}
+		if removed > 0 {
+			md.log.CDebugf(ctx, "Deleted %d old revisions of %s",
+				removed, tlfID)
+		}
+	}
+	return nil
+}
+
+// StartHistoryCompaction runs CompactHistory with the given policy
+// every interval, until the server is shut down.
+func (md *MDServerDisk) StartHistoryCompaction(
+	policy MDHistoryCompactionPolicy, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := md.CompactHistory(context.Background(), policy)
+				if err != nil {
+					md.log.Warning("MD history compaction failed: %+v", err)
+				}
+			case <-md.shutdownCh:
+				return
+			}
+		}
+	}()
+}
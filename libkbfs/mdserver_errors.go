@@ -158,7 +158,8 @@ func (e MDServerErrorConflictDiskUsage) Error() string {
 	return "MDServerErrorConflictDiskUsage{" + e.Desc + "}"
 }
 
-// MDServerErrorLocked is returned when the folder truncation lock is acquired by someone else.
+// MDServerErrorLocked is returned when the folder truncation lock,
+// or an advisory lock, is acquired by someone else.
 type MDServerErrorLocked struct {
 }
 
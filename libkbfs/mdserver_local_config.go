@@ -14,6 +14,7 @@ type mdServerLocalConfig interface {
 	Clock() Clock
 	Codec() kbfscodec.Codec
 	currentInfoGetter() currentInfoGetter
+	teamInfoGetter() teamInfoGetter
 	MetadataVersion() MetadataVer
 	logMaker
 	cryptoPureGetter
@@ -28,3 +29,7 @@ type mdServerLocalConfigAdapter struct {
 func (ca mdServerLocalConfigAdapter) currentInfoGetter() currentInfoGetter {
 	return ca.Config.KBPKI()
 }
+
+func (ca mdServerLocalConfigAdapter) teamInfoGetter() teamInfoGetter {
+	return ca.Config.KBPKI()
+}
@@ -77,6 +77,11 @@ func (c testMDServerLocalConfig) currentInfoGetter() currentInfoGetter {
 	return c.cig
 }
 
+func (c testMDServerLocalConfig) teamInfoGetter() teamInfoGetter {
+	// None of the tests using this config have team TLFs.
+	return nil
+}
+
 func (c testMDServerLocalConfig) MetadataVersion() MetadataVer {
 	return defaultClientMetadataVer
 }
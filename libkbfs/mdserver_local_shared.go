@@ -6,11 +6,13 @@ package libkbfs
 
 import (
 	"sync"
+	"time"
 
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfscodec"
 	"github.com/keybase/kbfs/tlf"
 	"github.com/pkg/errors"
+	"golang.org/x/net/context"
 )
 
 // TODO: Have the functions below wrap their errors.
@@ -18,30 +20,53 @@ import (
 // Helper to aid in enforcement that only specified public keys can
 // access TLF metadata. mergedMasterHead can be nil, in which case
 // true is returned.
-func isReader(currentUID keybase1.UID, mergedMasterHead BareRootMetadata,
+func isReader(ctx context.Context, teamGetter teamInfoGetter,
+	currentUID keybase1.UID, mergedMasterHead BareRootMetadata,
 	extra ExtraMetadata) (bool, error) {
 	h, err := mergedMasterHead.MakeBareTlfHandle(extra)
 	if err != nil {
 		return false, err
 	}
-	return h.IsReader(currentUID), nil
+	return isHandleReader(ctx, teamGetter, h, currentUID)
+}
+
+// Helper to aid in enforcement that only writers of a TLF can
+// perform administrative operations on it, like truncating its
+// history.
+func isWriter(ctx context.Context, teamGetter teamInfoGetter,
+	currentUID keybase1.UID, mergedMasterHead BareRootMetadata,
+	extra ExtraMetadata) (bool, error) {
+	h, err := mergedMasterHead.MakeBareTlfHandle(extra)
+	if err != nil {
+		return false, err
+	}
+	return isHandleWriter(ctx, teamGetter, h, currentUID)
 }
 
 // Helper to aid in enforcement that only specified public keys can
 // access TLF metadata. mergedMasterHead can be nil, in which case
 // true is returned.
-func isWriterOrValidRekey(codec kbfscodec.Codec, currentUID keybase1.UID,
+func isWriterOrValidRekey(ctx context.Context, teamGetter teamInfoGetter,
+	codec kbfscodec.Codec, currentUID keybase1.UID,
 	mergedMasterHead, newMd BareRootMetadata, prevExtra, extra ExtraMetadata) (
 	bool, error) {
 	h, err := mergedMasterHead.MakeBareTlfHandle(prevExtra)
 	if err != nil {
 		return false, err
 	}
-	if h.IsWriter(currentUID) {
+	isWriter, err := isHandleWriter(ctx, teamGetter, h, currentUID)
+	if err != nil {
+		return false, err
+	}
+	if isWriter {
 		return true, nil
 	}
 
-	if h.IsReader(currentUID) {
+	isReader, err := isHandleReader(ctx, teamGetter, h, currentUID)
+	if err != nil {
+		return false, err
+	}
+	if isReader {
 		// if this is a reader, are they acting within their
 		// restrictions?
 		return newMd.IsValidRekeyRequest(
@@ -51,6 +76,15 @@ func isWriterOrValidRekey(codec kbfscodec.Codec, currentUID keybase1.UID,
 	return false, nil
 }
 
+// Helper to decide which TLFs to list for a user: the ones whose
+// handle names the user as a writer, or as a reader of a private
+// TLF. Team TLFs are never listed, since team membership isn't known
+// to a handle.
+func isMemberOfHandle(currentUID keybase1.UID, h tlf.Handle) bool {
+	return h.IsWriter(currentUID) ||
+		(!h.IsPublic() && h.IsReader(currentUID))
+}
+
 // mdServerLocalTruncateLockManager manages the truncate locks for a
 // set of TLFs. Note that it is not goroutine-safe.
 type mdServerLocalTruncateLockManager struct {
@@ -98,6 +132,71 @@ func (m mdServerLocalTruncateLockManager) truncateUnlock(
 	return false, MDServerErrorLocked{}
 }
 
+// mdServerLocalLockLease is how long a lock taken through
+// mdServerLocalLockManager stays held without being renewed.
+const mdServerLocalLockLease = time.Minute
+
+type mdServerLocalLock struct {
+	deviceKID keybase1.KID
+	expiry    time.Time
+}
+
+// mdServerLocalLockManager manages the advisory locks for a set of
+// TLFs. Note that it is not goroutine-safe.
+type mdServerLocalLockManager struct {
+	// TLF ID -> lock ID -> holder.
+	locksDb map[tlf.ID]map[LockID]mdServerLocalLock
+}
+
+func newMDServerLocalLockManager() mdServerLocalLockManager {
+	return mdServerLocalLockManager{
+		locksDb: make(map[tlf.ID]map[LockID]mdServerLocalLock),
+	}
+}
+
+func (m mdServerLocalLockManager) lock(deviceKID keybase1.KID,
+	id tlf.ID, lockID LockID, now time.Time) error {
+	locks := m.locksDb[id]
+	if l, ok := locks[lockID]; ok && l.deviceKID != deviceKID &&
+		now.Before(l.expiry) {
+		// Locked by someone else.
+		return MDServerErrorLocked{}
+	}
+
+	if locks == nil {
+		locks = make(map[LockID]mdServerLocalLock)
+		m.locksDb[id] = locks
+	}
+	// Taking a lock we already hold just renews the lease.
+	locks[lockID] = mdServerLocalLock{
+		deviceKID: deviceKID,
+		expiry:    now.Add(mdServerLocalLockLease),
+	}
+	return nil
+}
+
+func (m mdServerLocalLockManager) releaseLock(deviceKID keybase1.KID,
+	id tlf.ID, lockID LockID, now time.Time) error {
+	locks := m.locksDb[id]
+	l, ok := locks[lockID]
+	if !ok || !now.Before(l.expiry) {
+		// Already unlocked.
+		delete(locks, lockID)
+		return nil
+	}
+
+	if l.deviceKID != deviceKID {
+		// Locked by someone else.
+		return MDServerErrorLocked{}
+	}
+
+	delete(locks, lockID)
+	if len(locks) == 0 {
+		delete(m.locksDb, id)
+	}
+	return nil
+}
+
 // mdServerLocalUpdateManager manages the observers for a set of TLFs
 // referenced by multiple mdServerLocal instances sharing the same
 // data. It is goroutine-safe.
@@ -0,0 +1,246 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"time"
+
+	"github.com/keybase/kbfs/tlf"
+	metrics "github.com/rcrowley/go-metrics"
+	"golang.org/x/net/context"
+)
+
+// MDServerMeasured delegates to another MDServer instance but also
+// keeps track of stats.
+type MDServerMeasured struct {
+	delegate                  MDServer
+	getForHandleCall          measuredCall
+	getForTLFCall             measuredCall
+	getRangeCall              measuredCall
+	putCall                   measuredCall
+	pruneBranchCall           measuredCall
+	getLatestHandleForTLFCall measuredCall
+	getTLFIDsCall             measuredCall
+	getKeyBundlesCall         measuredCall
+	truncateLockCall          measuredCall
+	truncateUnlockCall        measuredCall
+	lockCall                  measuredCall
+	releaseLockCall           measuredCall
+}
+
+var _ MDServer = MDServerMeasured{}
+
+// NewMDServerMeasured creates and returns a new MDServerMeasured
+// instance with the given delegate and registry.
+func NewMDServerMeasured(delegate MDServer, r metrics.Registry) MDServerMeasured {
+	getForHandleCall := makeMeasuredCall("MDServer.GetForHandle", r)
+	getForTLFCall := makeMeasuredCall("MDServer.GetForTLF", r)
+	getRangeCall := makeMeasuredCall("MDServer.GetRange", r)
+	putCall := makeMeasuredCall("MDServer.Put", r)
+	pruneBranchCall := makeMeasuredCall("MDServer.PruneBranch", r)
+	getLatestHandleForTLFCall := makeMeasuredCall("MDServer.GetLatestHandleForTLF", r)
+	getTLFIDsCall := makeMeasuredCall("MDServer.GetTLFIDsForCurrentUser", r)
+	getKeyBundlesCall := makeMeasuredCall("MDServer.GetKeyBundles", r)
+	truncateLockCall := makeMeasuredCall("MDServer.TruncateLock", r)
+	truncateUnlockCall := makeMeasuredCall("MDServer.TruncateUnlock", r)
+	lockCall := makeMeasuredCall("MDServer.Lock", r)
+	releaseLockCall := makeMeasuredCall("MDServer.ReleaseLock", r)
+	return MDServerMeasured{
+		delegate:                  delegate,
+		getForHandleCall:          getForHandleCall,
+		getForTLFCall:             getForTLFCall,
+		getRangeCall:              getRangeCall,
+		putCall:                   putCall,
+		pruneBranchCall:           pruneBranchCall,
+		getLatestHandleForTLFCall: getLatestHandleForTLFCall,
+		getTLFIDsCall:             getTLFIDsCall,
+		getKeyBundlesCall:         getKeyBundlesCall,
+		truncateLockCall:          truncateLockCall,
+		truncateUnlockCall:        truncateUnlockCall,
+		lockCall:                  lockCall,
+		releaseLockCall:           releaseLockCall,
+	}
+}
+
+// RefreshAuthToken implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) RefreshAuthToken(ctx context.Context) {
+	m.delegate.RefreshAuthToken(ctx)
+}
+
+// GetForHandle implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) GetForHandle(ctx context.Context,
+	handle tlf.Handle, mStatus MergeStatus) (
+	tlfID tlf.ID, rmds *RootMetadataSigned, err error) {
+	m.getForHandleCall.time(func() error {
+		tlfID, rmds, err = m.delegate.GetForHandle(ctx, handle, mStatus)
+		return err
+	})
+	return tlfID, rmds, err
+}
+
+// GetForTLF implements the MDServer interface for MDServerMeasured.
+func (m MDServerMeasured) GetForTLF(ctx context.Context, id tlf.ID,
+	bid BranchID, mStatus MergeStatus) (
+	rmds *RootMetadataSigned, err error) {
+	m.getForTLFCall.time(func() error {
+		rmds, err = m.delegate.GetForTLF(ctx, id, bid, mStatus)
+		return err
+	})
+	return rmds, err
+}
+
+// GetRange implements the MDServer interface for MDServerMeasured.
+func (m MDServerMeasured) GetRange(ctx context.Context, id tlf.ID,
+	bid BranchID, mStatus MergeStatus, start, stop MetadataRevision) (
+	rmdses []*RootMetadataSigned, err error) {
+	m.getRangeCall.time(func() error {
+		rmdses, err = m.delegate.GetRange(
+			ctx, id, bid, mStatus, start, stop)
+		return err
+	})
+	return rmdses, err
+}
+
+// Put implements the MDServer interface for MDServerMeasured.
+func (m MDServerMeasured) Put(ctx context.Context,
+	rmds *RootMetadataSigned, extra ExtraMetadata) (err error) {
+	m.putCall.time(func() error {
+		err = m.delegate.Put(ctx, rmds, extra)
+		return err
+	})
+	return err
+}
+
+// PruneBranch implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) PruneBranch(ctx context.Context, id tlf.ID,
+	bid BranchID) (err error) {
+	m.pruneBranchCall.time(func() error {
+		err = m.delegate.PruneBranch(ctx, id, bid)
+		return err
+	})
+	return err
+}
+
+// RegisterForUpdate implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) RegisterForUpdate(ctx context.Context, id tlf.ID,
+	currHead MetadataRevision) (<-chan error, error) {
+	return m.delegate.RegisterForUpdate(ctx, id, currHead)
+}
+
+// CancelRegistration implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) CancelRegistration(ctx context.Context, id tlf.ID) {
+	m.delegate.CancelRegistration(ctx, id)
+}
+
+// CheckForRekeys implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) CheckForRekeys(ctx context.Context) <-chan error {
+	return m.delegate.CheckForRekeys(ctx)
+}
+
+// TruncateLock implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) TruncateLock(ctx context.Context, id tlf.ID) (
+	locked bool, err error) {
+	m.truncateLockCall.time(func() error {
+		locked, err = m.delegate.TruncateLock(ctx, id)
+		return err
+	})
+	return locked, err
+}
+
+// TruncateUnlock implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) TruncateUnlock(ctx context.Context, id tlf.ID) (
+	unlocked bool, err error) {
+	m.truncateUnlockCall.time(func() error {
+		unlocked, err = m.delegate.TruncateUnlock(ctx, id)
+		return err
+	})
+	return unlocked, err
+}
+
+// Lock implements the MDServer interface for MDServerMeasured.
+func (m MDServerMeasured) Lock(ctx context.Context, id tlf.ID,
+	lockID LockID) (err error) {
+	m.lockCall.time(func() error {
+		err = m.delegate.Lock(ctx, id, lockID)
+		return err
+	})
+	return err
+}
+
+// ReleaseLock implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) ReleaseLock(ctx context.Context, id tlf.ID,
+	lockID LockID) (err error) {
+	m.releaseLockCall.time(func() error {
+		err = m.delegate.ReleaseLock(ctx, id, lockID)
+		return err
+	})
+	return err
+}
+
+// DisableRekeyUpdatesForTesting implements the MDServer interface
+// for MDServerMeasured.
+func (m MDServerMeasured) DisableRekeyUpdatesForTesting() {
+	m.delegate.DisableRekeyUpdatesForTesting()
+}
+
+// Shutdown implements the MDServer interface for MDServerMeasured.
+func (m MDServerMeasured) Shutdown() {
+	m.delegate.Shutdown()
+}
+
+// IsConnected implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) IsConnected() bool {
+	return m.delegate.IsConnected()
+}
+
+// GetLatestHandleForTLF implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) GetLatestHandleForTLF(ctx context.Context,
+	id tlf.ID) (handle tlf.Handle, err error) {
+	m.getLatestHandleForTLFCall.time(func() error {
+		handle, err = m.delegate.GetLatestHandleForTLF(ctx, id)
+		return err
+	})
+	return handle, err
+}
+
+// GetTLFIDsForCurrentUser implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) GetTLFIDsForCurrentUser(
+	ctx context.Context) (ids []tlf.ID, err error) {
+	m.getTLFIDsCall.time(func() error {
+		ids, err = m.delegate.GetTLFIDsForCurrentUser(ctx)
+		return err
+	})
+	return ids, err
+}
+
+// OffsetFromServerTime implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) OffsetFromServerTime() (time.Duration, bool) {
+	return m.delegate.OffsetFromServerTime()
+}
+
+// GetKeyBundles implements the MDServer interface for
+// MDServerMeasured.
+func (m MDServerMeasured) GetKeyBundles(ctx context.Context,
+	tlfID tlf.ID, wkbID TLFWriterKeyBundleID, rkbID TLFReaderKeyBundleID) (
+	wkb *TLFWriterKeyBundleV3, rkb *TLFReaderKeyBundleV3, err error) {
+	m.getKeyBundlesCall.time(func() error {
+		wkb, rkb, err = m.delegate.GetKeyBundles(ctx, tlfID, wkbID, rkbID)
+		return err
+	})
+	return wkb, rkb, err
+}
@@ -6,6 +6,7 @@ package libkbfs
 
 import (
 	"bytes"
+	"fmt"
 	"reflect"
 	"sync"
 	"time"
@@ -53,9 +54,9 @@ type mdBlockMemList struct {
 }
 
 type mdServerMemShared struct {
-	// Protects all *db variables and truncateLockManager. After
-	// Shutdown() is called, all *db variables and
-	// truncateLockManager are nil.
+	// Protects all *db variables, truncateLockManager, and
+	// lockManager. After Shutdown() is called, all *db variables,
+	// truncateLockManager, and lockManager are nil.
 	lock sync.RWMutex
 	// Bare TLF handle -> TLF ID
 	handleDb map[mdHandleKey]tlf.ID
@@ -70,6 +71,7 @@ type mdServerMemShared struct {
 	// (TLF ID, device KID) -> branch ID
 	branchDb            map[mdBranchKey]BranchID
 	truncateLockManager *mdServerLocalTruncateLockManager
+	lockManager         *mdServerLocalLockManager
 
 	updateManager *mdServerLocalUpdateManager
 }
@@ -95,6 +97,7 @@ func NewMDServerMemory(config mdServerLocalConfig) (*MDServerMemory, error) {
 	readerKeyBundleDb := make(map[mdExtraReaderKey]TLFReaderKeyBundleV3)
 	log := config.MakeLogger("MDSM")
 	truncateLockManager := newMDServerLocalTruncatedLockManager()
+	lockManager := newMDServerLocalLockManager()
 	shared := mdServerMemShared{
 		handleDb:            handleDb,
 		latestHandleDb:      latestHandleDb,
@@ -103,6 +106,7 @@ func NewMDServerMemory(config mdServerLocalConfig) (*MDServerMemory, error) {
 		writerKeyBundleDb:   writerKeyBundleDb,
 		readerKeyBundleDb:   readerKeyBundleDb,
 		truncateLockManager: &truncateLockManager,
+		lockManager:         &lockManager,
 		updateManager:       newMDServerLocalUpdateManager(),
 	}
 	mdserv := &MDServerMemory{config, log, &shared}
@@ -211,7 +215,8 @@ func (md *MDServerMemory) checkGetParams(
 		if err != nil {
 			return NullBranchID, MDServerError{err}
 		}
-		ok, err := isReader(currentUID, mergedMasterHead.MD, extra)
+		ok, err := isReader(ctx, md.config.teamInfoGetter(), currentUID,
+			mergedMasterHead.MD, extra)
 		if err != nil {
 			return NullBranchID, MDServerError{err}
 		}
@@ -388,8 +393,8 @@ func (md *MDServerMemory) Put(ctx context.Context, rmds *RootMetadataSigned,
 		return MDServerError{err}
 	}
 
-	err = rmds.IsValidAndSigned(
-		md.config.Codec(), md.config.cryptoPure(), extra)
+	err = rmds.IsValidAndSigned(ctx, md.config.Codec(),
+		md.config.cryptoPure(), md.config.teamInfoGetter(), extra)
 	if err != nil {
 		return MDServerErrorBadRequest{Reason: err.Error()}
 	}
@@ -417,7 +422,7 @@ func (md *MDServerMemory) Put(ctx context.Context, rmds *RootMetadataSigned,
 			return MDServerError{err}
 		}
 		ok, err := isWriterOrValidRekey(
-			md.config.Codec(), currentUID,
+			ctx, md.config.teamInfoGetter(), md.config.Codec(), currentUID,
 			mergedMasterHead.MD, rmds.MD,
 			prevExtra, extra)
 		if err != nil {
@@ -568,6 +573,73 @@ func (md *MDServerMemory) PruneBranch(ctx context.Context, id tlf.ID, bid Branch
 	return nil
 }
 
+// TruncateHistoryAfter implements the mdServerLocal interface for
+// MDServerMemory.
+func (md *MDServerMemory) TruncateHistoryAfter(
+	ctx context.Context, id tlf.ID, rev MetadataRevision) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+
+	// Check permissions
+
+	mergedMasterHead, err :=
+		md.getHeadForTLF(ctx, id, NullBranchID, Merged)
+	if err != nil {
+		return MDServerError{err}
+	}
+	if mergedMasterHead == nil {
+		return MDServerErrorBadRequest{Reason: "TLF has no history"}
+	}
+
+	_, currentUID, err := md.config.currentInfoGetter().GetCurrentUserInfo(ctx)
+	if err != nil {
+		return MDServerError{err}
+	}
+
+	extra, err := getExtraMetadata(md.getKeyBundles, mergedMasterHead.MD)
+	if err != nil {
+		return MDServerError{err}
+	}
+	ok, err := isWriter(ctx, md.config.teamInfoGetter(), currentUID,
+		mergedMasterHead.MD, extra)
+	if err != nil {
+		return MDServerError{err}
+	}
+	if !ok {
+		return MDServerErrorUnauthorized{}
+	}
+
+	md.lock.Lock()
+	defer md.lock.Unlock()
+	err = md.checkShutdownLocked()
+	if err != nil {
+		return err
+	}
+
+	key := mdBlockKey{id, NullBranchID}
+	blockList := md.mdDb[key]
+	head := blockList.initialRevision +
+		MetadataRevision(len(blockList.blocks)) - 1
+	if rev < blockList.initialRevision || rev > head {
+		return MDServerErrorBadRequest{
+			Reason: fmt.Sprintf("Revision %d doesn't exist", rev)}
+	}
+	blockList.blocks =
+		blockList.blocks[:rev-blockList.initialRevision+1]
+	md.mdDb[key] = blockList
+
+	// Any unmerged branch may be based on a deleted revision, so
+	// forget all of them. Like in PruneBranch, the unmerged
+	// history itself is left in place.
+	for branchKey := range md.branchDb {
+		if branchKey.tlfID == id {
+			delete(md.branchDb, branchKey)
+		}
+	}
+	return nil
+}
+
 func (md *MDServerMemory) getBranchID(ctx context.Context, id tlf.ID) (BranchID, error) {
 	branchKey, err := md.getBranchKey(ctx, id)
 	if err != nil {
@@ -668,6 +740,51 @@ func (md *MDServerMemory) TruncateUnlock(ctx context.Context, id tlf.ID) (
 	return md.truncateLockManager.truncateUnlock(myKID, id)
 }
 
+// Lock implements the MDServer interface for MDServerMemory.
+func (md *MDServerMemory) Lock(ctx context.Context, id tlf.ID,
+	lockID LockID) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+
+	md.lock.Lock()
+	defer md.lock.Unlock()
+	err := md.checkShutdownLocked()
+	if err != nil {
+		return err
+	}
+
+	myKID, err := md.getCurrentDeviceKID(ctx)
+	if err != nil {
+		return err
+	}
+
+	return md.lockManager.lock(myKID, id, lockID, md.config.Clock().Now())
+}
+
+// ReleaseLock implements the MDServer interface for MDServerMemory.
+func (md *MDServerMemory) ReleaseLock(ctx context.Context, id tlf.ID,
+	lockID LockID) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+
+	md.lock.Lock()
+	defer md.lock.Unlock()
+	err := md.checkShutdownLocked()
+	if err != nil {
+		return err
+	}
+
+	myKID, err := md.getCurrentDeviceKID(ctx)
+	if err != nil {
+		return err
+	}
+
+	return md.lockManager.releaseLock(
+		myKID, id, lockID, md.config.Clock().Now())
+}
+
 // Shutdown implements the MDServer interface for MDServerMemory.
 func (md *MDServerMemory) Shutdown() {
 	md.lock.Lock()
@@ -676,6 +793,7 @@ func (md *MDServerMemory) Shutdown() {
 	md.latestHandleDb = nil
 	md.branchDb = nil
 	md.truncateLockManager = nil
+	md.lockManager = nil
 }
 
 // IsConnected implements the MDServer interface for MDServerMemory.
@@ -778,6 +896,35 @@ func (md *MDServerMemory) GetLatestHandleForTLF(
 	return md.latestHandleDb[id], nil
 }
 
+// GetTLFIDsForCurrentUser implements the MDServer interface for
+// MDServerMemory.
+func (md *MDServerMemory) GetTLFIDsForCurrentUser(
+	ctx context.Context) ([]tlf.ID, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	_, uid, err := md.config.currentInfoGetter().GetCurrentUserInfo(ctx)
+	if err != nil {
+		return nil, MDServerError{err}
+	}
+
+	md.lock.RLock()
+	defer md.lock.RUnlock()
+	err = md.checkShutdownLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []tlf.ID
+	for id, handle := range md.latestHandleDb {
+		if isMemberOfHandle(uid, handle) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
 // OffsetFromServerTime implements the MDServer interface for
 // MDServerMemory.
 func (md *MDServerMemory) OffsetFromServerTime() (time.Duration, bool) {
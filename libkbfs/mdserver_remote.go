@@ -18,6 +18,7 @@ import (
 	"github.com/keybase/kbfs/tlf"
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -93,7 +94,7 @@ func NewMDServerRemote(config Config, srvAddr string,
 		TagsFunc:         LogTagsFromContext,
 		ReconnectBackoff: backoff.NewConstantBackOff(RPCReconnectInterval),
 	}
-	conn := rpc.NewTLSConnection(srvAddr, kbfscrypto.GetRootCerts(srvAddr),
+	conn := newServerTLSConnection(srvAddr, config.ServerTLSConfig(),
 		MDServerErrorUnwrapper{}, mdServer, rpcLogFactory, config.MakeLogger(""), opts)
 	mdServer.conn = conn
 	mdServer.client = keybase1.MetadataClient{Cli: conn.GetClient()}
@@ -314,8 +315,7 @@ func (md *MDServerRemote) resetPingTicker(intervalSeconds int) {
 func (md *MDServerRemote) OnConnectError(err error, wait time.Duration) {
 	md.log.Warning("MDServerRemote: connection error: %q; retrying in %s",
 		err, wait)
-	// TODO: it might make sense to show something to the user if this is
-	// due to authentication, for example.
+	alertUserOnConnectError(md.config, MDServiceName, err)
 	md.cancelObservers()
 	md.resetPingTicker(0)
 	if md.authToken != nil {
@@ -717,6 +717,27 @@ func (md *MDServerRemote) TruncateUnlock(ctx context.Context, id tlf.ID) (
 	return md.client.TruncateUnlock(ctx, id.String())
 }
 
+// lockArg is the argument to the mdserver's lock and releaseLock
+// RPCs, which aren't in the vendored protocol yet.
+type lockArg struct {
+	FolderID string `codec:"folderID" json:"folderID"`
+	LockID   string `codec:"lockID" json:"lockID"`
+}
+
+// Lock implements the MDServer interface for MDServerRemote.
+func (md *MDServerRemote) Lock(ctx context.Context, id tlf.ID,
+	lockID LockID) error {
+	return md.client.Cli.Call(ctx, "keybase.1.metadata.lock",
+		[]interface{}{lockArg{id.String(), string(lockID)}}, nil)
+}
+
+// ReleaseLock implements the MDServer interface for MDServerRemote.
+func (md *MDServerRemote) ReleaseLock(ctx context.Context, id tlf.ID,
+	lockID LockID) error {
+	return md.client.Cli.Call(ctx, "keybase.1.metadata.releaseLock",
+		[]interface{}{lockArg{id.String(), string(lockID)}}, nil)
+}
+
 // GetLatestHandleForTLF implements the MDServer interface for MDServerRemote.
 func (md *MDServerRemote) GetLatestHandleForTLF(ctx context.Context, id tlf.ID) (
 	tlf.Handle, error) {
@@ -731,6 +752,31 @@ func (md *MDServerRemote) GetLatestHandleForTLF(ctx context.Context, id tlf.ID)
 	return handle, nil
 }
 
+// getFolderIDsForUserArg is the argument to the mdserver's
+// getFolderIDsForUser RPC, which isn't in the vendored protocol yet.
+type getFolderIDsForUserArg struct{}
+
+// GetTLFIDsForCurrentUser implements the MDServer interface for
+// MDServerRemote.
+func (md *MDServerRemote) GetTLFIDsForCurrentUser(
+	ctx context.Context) ([]tlf.ID, error) {
+	var folderIDs []string
+	err := md.client.Cli.Call(ctx, "keybase.1.metadata.getFolderIDsForUser",
+		[]interface{}{getFolderIDsForUserArg{}}, &folderIDs)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]tlf.ID, 0, len(folderIDs))
+	for _, folderID := range folderIDs {
+		id, err := tlf.ParseID(folderID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // OffsetFromServerTime implements the MDServer interface for
 // MDServerRemote.
 func (md *MDServerRemote) OffsetFromServerTime() (time.Duration, bool) {
@@ -837,23 +883,60 @@ func (md *MDServerRemote) GetTLFCryptKeyServerHalf(ctx context.Context,
 	return
 }
 
+// GetTLFCryptKeyServerHalves is an implementation of the KeyServer
+// interface.
+func (md *MDServerRemote) GetTLFCryptKeyServerHalves(ctx context.Context,
+	serverHalfIDs []TLFCryptKeyServerHalfID,
+	cryptKey kbfscrypto.CryptPublicKey) (
+	[]kbfscrypto.TLFCryptKeyServerHalf, error) {
+	// The protocol has no batch get, so issue all the gets at
+	// once, so that they share a single round trip's worth of
+	// latency.
+	serverHalves := make(
+		[]kbfscrypto.TLFCryptKeyServerHalf, len(serverHalfIDs))
+	eg, groupCtx := errgroup.WithContext(ctx)
+	for i, serverHalfID := range serverHalfIDs {
+		i, serverHalfID := i, serverHalfID
+		eg.Go(func() (err error) {
+			serverHalves[i], err = md.GetTLFCryptKeyServerHalf(
+				groupCtx, serverHalfID, cryptKey)
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return serverHalves, nil
+}
+
 // PutTLFCryptKeyServerHalves is an implementation of the KeyServer interface.
 func (md *MDServerRemote) PutTLFCryptKeyServerHalves(ctx context.Context,
 	keyServerHalves UserDeviceKeyServerHalves) error {
-	// flatten out the map into an array
+	return md.PutTLFCryptKeyServerHalvesBatch(
+		ctx, []UserDeviceKeyServerHalves{keyServerHalves})
+}
+
+// PutTLFCryptKeyServerHalvesBatch is an implementation of the
+// KeyServer interface.
+func (md *MDServerRemote) PutTLFCryptKeyServerHalvesBatch(
+	ctx context.Context,
+	keyServerHalves []UserDeviceKeyServerHalves) error {
+	// flatten out the maps into an array
 	var keyHalves []keybase1.KeyHalf
-	for user, deviceMap := range keyServerHalves {
-		for devicePubKey, serverHalf := range deviceMap {
-			keyHalf, err := md.config.Codec().Encode(serverHalf)
-			if err != nil {
-				return err
+	for _, serverHalvesGen := range keyServerHalves {
+		for user, deviceMap := range serverHalvesGen {
+			for devicePubKey, serverHalf := range deviceMap {
+				keyHalf, err := md.config.Codec().Encode(serverHalf)
+				if err != nil {
+					return err
+				}
+				keyHalves = append(keyHalves,
+					keybase1.KeyHalf{
+						User:      user,
+						DeviceKID: devicePubKey.KID(),
+						Key:       keyHalf,
+					})
 			}
-			keyHalves = append(keyHalves,
-				keybase1.KeyHalf{
-					User:      user,
-					DeviceKID: devicePubKey.KID(),
-					Key:       keyHalf,
-				})
 		}
 	}
 	// put the keys
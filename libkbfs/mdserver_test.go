@@ -50,13 +50,8 @@ func signRMDSForTest(
 }
 
 // This should pass for both local and remote servers.
-func TestMDServerBasics(t *testing.T) {
-	// setup
+func testMDServerBasics(t *testing.T, config Config, mdServer MDServer) {
 	ctx := context.Background()
-	config := MakeTestConfigOrBust(t, "test_user")
-	defer config.Shutdown(ctx)
-	mdServer := config.MDServer()
-
 	_, uid, err := config.KBPKI().GetCurrentUserInfo(ctx)
 	require.NoError(t, err)
 
@@ -159,6 +154,23 @@ func TestMDServerBasics(t *testing.T) {
 	}
 }
 
+func TestMDServerBasics(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "test_user")
+	defer config.Shutdown(context.Background())
+	testMDServerBasics(t, config, config.MDServer())
+}
+
+func TestMDServerS3Basics(t *testing.T) {
+	bucket, _, server := makeFakeS3BucketForTest(t)
+	defer server.Close()
+	config := MakeTestConfigOrBust(t, "test_user")
+	defer config.Shutdown(context.Background())
+	mdServer, err := newMDServerS3(mdServerLocalConfigAdapter{config}, bucket)
+	require.NoError(t, err)
+	defer mdServer.Shutdown()
+	testMDServerBasics(t, config, mdServer)
+}
+
 // This should pass for both local and remote servers. Make sure that
 // registering multiple TLFs for updates works. This is a regression
 // test for https://keybase.atlassian.net/browse/KBFS-467 .
@@ -194,3 +206,112 @@ func TestMDServerRegisterForUpdate(t *testing.T) {
 	_, err = mdServer.RegisterForUpdate(ctx, id2, MetadataRevisionInitial)
 	require.NoError(t, err)
 }
+
+func testMDServerGetTLFIDsForCurrentUser(
+	t *testing.T, config Config, mdServer MDServer) {
+	ctx := context.Background()
+	_, uid, err := config.KBPKI().GetCurrentUserInfo(ctx)
+	require.NoError(t, err)
+	otherUID := keybase1.MakeTestUID(2)
+	require.NotEqual(t, uid, otherUID)
+
+	ids, err := mdServer.GetTLFIDsForCurrentUser(ctx)
+	require.NoError(t, err)
+	require.Len(t, ids, 0)
+
+	var expectedIDs []tlf.ID
+	for _, h := range []struct {
+		writers, readers []keybase1.UID
+	}{
+		{[]keybase1.UID{uid}, nil},
+		{[]keybase1.UID{uid}, []keybase1.UID{keybase1.PublicUID}},
+		{[]keybase1.UID{otherUID}, []keybase1.UID{uid}},
+	} {
+		bh, err := tlf.MakeHandle(h.writers, h.readers, nil, nil, nil)
+		require.NoError(t, err)
+		id, _, err := mdServer.GetForHandle(ctx, bh, Merged)
+		require.NoError(t, err)
+		expectedIDs = append(expectedIDs, id)
+	}
+
+	// Anyone can create a public TLF, but it's only listed for
+	// its writers.
+	bh, err := tlf.MakeHandle([]keybase1.UID{otherUID},
+		[]keybase1.UID{keybase1.PublicUID}, nil, nil, nil)
+	require.NoError(t, err)
+	_, _, err = mdServer.GetForHandle(ctx, bh, Merged)
+	require.NoError(t, err)
+
+	ids, err = mdServer.GetTLFIDsForCurrentUser(ctx)
+	require.NoError(t, err)
+	require.Len(t, ids, len(expectedIDs))
+	for _, id := range expectedIDs {
+		require.Contains(t, ids, id)
+	}
+}
+
+func TestMDServerMemoryGetTLFIDsForCurrentUser(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "test_user", "other_user")
+	defer config.Shutdown(context.Background())
+	testMDServerGetTLFIDsForCurrentUser(t, config, config.MDServer())
+}
+
+func TestMDServerDiskGetTLFIDsForCurrentUser(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "test_user", "other_user")
+	defer config.Shutdown(context.Background())
+	mdServer, err := NewMDServerTempDir(mdServerLocalConfigAdapter{config})
+	require.NoError(t, err)
+	defer mdServer.Shutdown()
+	testMDServerGetTLFIDsForCurrentUser(t, config, mdServer)
+}
+
+func TestMDServerS3GetTLFIDsForCurrentUser(t *testing.T) {
+	bucket, _, server := makeFakeS3BucketForTest(t)
+	defer server.Close()
+	config := MakeTestConfigOrBust(t, "test_user", "other_user")
+	defer config.Shutdown(context.Background())
+	mdServer, err := newMDServerS3(mdServerLocalConfigAdapter{config}, bucket)
+	require.NoError(t, err)
+	defer mdServer.Shutdown()
+	testMDServerGetTLFIDsForCurrentUser(t, config, mdServer)
+}
+
+func TestMDServerLocalLockManager(t *testing.T) {
+	m := newMDServerLocalLockManager()
+	kid1 := keybase1.KID("kid1")
+	kid2 := keybase1.KID("kid2")
+	id := tlf.FakeID(1, false)
+	now := time.Now()
+
+	err := m.lock(kid1, id, "a", now)
+	require.NoError(t, err)
+	// Re-locking from the same device renews the lease.
+	err = m.lock(kid1, id, "a", now)
+	require.NoError(t, err)
+
+	// Other devices can't take or release it, but can take
+	// different locks.
+	err = m.lock(kid2, id, "a", now)
+	require.Equal(t, MDServerErrorLocked{}, err)
+	err = m.releaseLock(kid2, id, "a", now)
+	require.Equal(t, MDServerErrorLocked{}, err)
+	err = m.lock(kid2, id, "b", now)
+	require.NoError(t, err)
+	err = m.lock(kid2, tlf.FakeID(2, false), "a", now)
+	require.NoError(t, err)
+
+	// Once released, anyone can take it.
+	err = m.releaseLock(kid1, id, "a", now)
+	require.NoError(t, err)
+	err = m.releaseLock(kid1, id, "a", now)
+	require.NoError(t, err)
+	err = m.lock(kid2, id, "a", now)
+	require.NoError(t, err)
+
+	// And once the lease expires, too.
+	later := now.Add(mdServerLocalLockLease)
+	err = m.lock(kid1, id, "a", later)
+	require.NoError(t, err)
+	err = m.releaseLock(kid2, id, "a", later)
+	require.Equal(t, MDServerErrorLocked{}, err)
+}
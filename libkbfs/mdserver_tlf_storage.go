@@ -5,7 +5,11 @@
 package libkbfs
 
 import (
+	"bytes"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -13,107 +17,97 @@ import (
 	"github.com/keybase/kbfs/ioutil"
 	"github.com/keybase/kbfs/kbfscodec"
 	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/kbfshash"
 	"github.com/keybase/kbfs/tlf"
 	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"golang.org/x/net/context"
 )
 
 // mdServerTlfStorage stores an ordered list of metadata IDs for each
 // branch of a single TLF, along with the associated metadata objects,
-// in flat files on disk.
+// in a leveldb.
 //
-// The directory layout looks like:
+// The key layout looks like:
 //
-// dir/md_branch_journals/00..00/EARLIEST
-// dir/md_branch_journals/00..00/LATEST
-// dir/md_branch_journals/00..00/0...001
-// dir/md_branch_journals/00..00/0...002
-// dir/md_branch_journals/00..00/0...fff
-// dir/md_branch_journals/5f..3d/EARLIEST
-// dir/md_branch_journals/5f..3d/LATEST
-// dir/md_branch_journals/5f..3d/0...0ff
-// dir/md_branch_journals/5f..3d/0...100
-// dir/md_branch_journals/5f..3d/0...fff
-// dir/mds/0100/0...01
-// ...
-// dir/mds/01ff/f...ff
-// dir/wkbv3/0100...01
-// ...
-// dir/wkbv3/0100...ff
-// dir/rkbv3/0100...01
-// ...
-// dir/rkbv3/0100...ff
+// md:<MdID>                    -> serializedRMDS
+// rev:<branch ID>:<revision>   -> MdID
+// wkbv3:<writer key bundle ID> -> TLFWriterKeyBundleV3
+// rkbv3:<reader key bundle ID> -> TLFReaderKeyBundleV3
 //
-// Each branch has its own subdirectory with a journal; the journal
-// ordinals are just MetadataRevisions, and the journal entries are
-// just MdIDs. (Branches are usually temporary, so no need to splay
-// them.)
-//
-// The Metadata objects are stored separately in dir/mds. Each block
-// has its own subdirectory with its ID as a name. The MD
-// subdirectories are splayed over (# of possible hash types) * 256
-// subdirectories -- one byte for the hash type (currently only one)
-// plus the first byte of the hash data -- using the first four
-// characters of the name to keep the number of directories in dir
-// itself to a manageable number, similar to git.
-//
-// Writer (reader) key bundles for V3 metadata objects are stored
-// separately in dir/wkbv3 (dir/rkbv3). The number of bundles is
-// small, so no need to splay them.
+// Revisions are written as fixed-width hex, so that the revisions of
+// each branch sort in order, and range queries are prefix scans. All
+// the writes for a single put go into one batch, so a crash can't
+// leave a revision pointing to a missing MD or key bundle.
 type mdServerTlfStorage struct {
-	tlfID  tlf.ID
-	codec  kbfscodec.Codec
-	crypto cryptoPure
-	clock  Clock
-	mdVer  MetadataVer
-	dir    string
-
-	// Protects any IO operations in dir or any of its children,
-	// as well as branchJournals and its contents.
-	lock           sync.RWMutex
-	branchJournals map[BranchID]mdIDJournal
+	tlfID      tlf.ID
+	codec      kbfscodec.Codec
+	crypto     cryptoPure
+	teamGetter teamInfoGetter
+	clock      Clock
+	mdVer      MetadataVer
+
+	// Protects any IO operations on db. After shutdown() is
+	// called, db is nil.
+	lock sync.RWMutex
+	db   *levelDB
 }
 
+// makeMDServerTlfStorage returns an mdServerTlfStorage that keeps
+// its data in the given leveldb, which it closes on shutdown.
 func makeMDServerTlfStorage(tlfID tlf.ID, codec kbfscodec.Codec,
-	crypto cryptoPure, clock Clock, mdVer MetadataVer,
-	dir string) *mdServerTlfStorage {
-	journal := &mdServerTlfStorage{
-		tlfID:          tlfID,
-		codec:          codec,
-		crypto:         crypto,
-		clock:          clock,
-		mdVer:          mdVer,
-		dir:            dir,
-		branchJournals: make(map[BranchID]mdIDJournal),
-	}
-	return journal
+	crypto cryptoPure, teamGetter teamInfoGetter, clock Clock,
+	mdVer MetadataVer, db *levelDB) *mdServerTlfStorage {
+	return &mdServerTlfStorage{
+		tlfID:      tlfID,
+		codec:      codec,
+		crypto:     crypto,
+		teamGetter: teamGetter,
+		clock:      clock,
+		mdVer:      mdVer,
+		db:         db,
+	}
 }
 
-// The functions below are for building various paths.
+// The functions below are for building various keys.
 
-func (s *mdServerTlfStorage) branchJournalsPath() string {
-	return filepath.Join(s.dir, "md_branch_journals")
+func mdKey(id MdID) []byte {
+	return []byte("md:" + id.String())
 }
 
-func (s *mdServerTlfStorage) mdsPath() string {
-	return filepath.Join(s.dir, "mds")
+func branchRevisionsPrefix(bid BranchID) []byte {
+	return []byte("rev:" + bid.String() + ":")
 }
 
-func (s *mdServerTlfStorage) writerKeyBundleV3Path(
-	id TLFWriterKeyBundleID) string {
-	return filepath.Join(s.dir, "wkbv3", id.String())
+func revisionKey(bid BranchID, r MetadataRevision) []byte {
+	return append(branchRevisionsPrefix(bid),
+		fmt.Sprintf("%016x", uint64(r))...)
 }
 
-func (s *mdServerTlfStorage) readerKeyBundleV3Path(
-	id TLFReaderKeyBundleID) string {
-	return filepath.Join(s.dir, "rkbv3", id.String())
+func revisionFromKey(bid BranchID, key []byte) (MetadataRevision, error) {
+	prefix := branchRevisionsPrefix(bid)
+	if !bytes.HasPrefix(key, prefix) {
+		return MetadataRevisionUninitialized, errors.Errorf(
+			"Unexpected revision key %q", key)
+	}
+	r, err := strconv.ParseUint(string(key[len(prefix):]), 16, 64)
+	if err != nil {
+		return MetadataRevisionUninitialized, errors.WithStack(err)
+	}
+	return MetadataRevision(r), nil
 }
 
-func (s *mdServerTlfStorage) mdPath(id MdID) string {
-	idStr := id.String()
-	return filepath.Join(s.mdsPath(), idStr[:4], idStr[4:])
+func writerKeyBundleV3Key(id TLFWriterKeyBundleID) []byte {
+	return []byte("wkbv3:" + id.String())
 }
 
-// serializedRMDS is the structure stored in mdPath(id).
+func readerKeyBundleV3Key(id TLFReaderKeyBundleID) []byte {
+	return []byte("rkbv3:" + id.String())
+}
+
+// serializedRMDS is the structure stored under mdKey(id).
 type serializedRMDS struct {
 	EncodedRMDS []byte
 	Timestamp   time.Time
@@ -126,10 +120,13 @@ type serializedRMDS struct {
 // TODO: Verify signature?
 func (s *mdServerTlfStorage) getMDReadLocked(id MdID) (
 	*RootMetadataSigned, error) {
-	// Read file.
+	buf, err := s.db.Get(mdKey(id), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
 
 	var srmds serializedRMDS
-	err := kbfscodec.DeserializeFromFile(s.codec, s.mdPath(id), &srmds)
+	err = s.codec.Decode(buf, &srmds)
 	if err != nil {
 		return nil, err
 	}
@@ -157,20 +154,20 @@ func (s *mdServerTlfStorage) getMDReadLocked(id MdID) (
 	return rmds, nil
 }
 
+// putMDLocked adds the given MD to batch, unless it's already
+// stored.
 func (s *mdServerTlfStorage) putMDLocked(
-	rmds *RootMetadataSigned) (MdID, error) {
+	batch *leveldb.Batch, rmds *RootMetadataSigned) (MdID, error) {
 	id, err := s.crypto.MakeMdID(rmds.MD)
 	if err != nil {
 		return MdID{}, err
 	}
 
-	_, err = s.getMDReadLocked(id)
-	if ioutil.IsNotExist(err) {
-		// Continue on.
-	} else if err != nil {
+	exists, err := s.db.Has(mdKey(id), nil)
+	if err != nil {
 		return MdID{}, err
-	} else {
-		// Entry exists, so nothing else to do.
+	}
+	if exists {
 		return id, nil
 	}
 
@@ -185,50 +182,94 @@ func (s *mdServerTlfStorage) putMDLocked(
 		Version:     rmds.MD.Version(),
 	}
 
-	err = kbfscodec.SerializeToFileIfNotExist(s.codec, srmds, s.mdPath(id))
+	buf, err := s.codec.Encode(srmds)
 	if err != nil {
 		return MdID{}, err
 	}
-
+	batch.Put(mdKey(id), buf)
 	return id, nil
 }
 
-func (s *mdServerTlfStorage) getOrCreateBranchJournalLocked(
-	bid BranchID) (mdIDJournal, error) {
-	j, ok := s.branchJournals[bid]
-	if ok {
-		return j, nil
+// getRevisionRangeReadLocked returns the MdIDs of the revisions of
+// the given branch from start to stop inclusive, along with the
+// first revision returned.
+func (s *mdServerTlfStorage) getRevisionRangeReadLocked(
+	bid BranchID, start, stop MetadataRevision) (
+	MetadataRevision, []MdID, error) {
+	if stop < start {
+		return MetadataRevisionUninitialized, nil, nil
+	}
+	if start < MetadataRevisionInitial {
+		start = MetadataRevisionInitial
+	}
+	iter := s.db.NewIterator(&util.Range{
+		Start: revisionKey(bid, start),
+		Limit: util.BytesPrefix(branchRevisionsPrefix(bid)).Limit,
+	}, nil)
+	defer iter.Release()
+
+	realStart := MetadataRevisionUninitialized
+	var ids []MdID
+	for iter.Next() {
+		r, err := revisionFromKey(bid, iter.Key())
+		if err != nil {
+			return MetadataRevisionUninitialized, nil, err
+		}
+		if r > stop {
+			break
+		}
+		if realStart == MetadataRevisionUninitialized {
+			realStart = r
+		}
+		var id MdID
+		err = id.UnmarshalBinary(iter.Value())
+		if err != nil {
+			return MetadataRevisionUninitialized, nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := iter.Error(); err != nil {
+		return MetadataRevisionUninitialized, nil, err
 	}
+	return realStart, ids, nil
+}
 
-	dir := filepath.Join(s.branchJournalsPath(), bid.String())
-	err := ioutil.MkdirAll(dir, 0700)
+// getLatestRevisionReadLocked returns the latest revision of the
+// given branch and its MdID. exists is false if the branch has no
+// revisions.
+func (s *mdServerTlfStorage) getLatestRevisionReadLocked(bid BranchID) (
+	r MetadataRevision, id MdID, exists bool, err error) {
+	iter := s.db.NewIterator(
+		util.BytesPrefix(branchRevisionsPrefix(bid)), nil)
+	defer iter.Release()
+	if !iter.Last() {
+		return MetadataRevisionUninitialized, MdID{}, false, iter.Error()
+	}
+	r, err = revisionFromKey(bid, iter.Key())
 	if err != nil {
-		return mdIDJournal{}, err
+		return MetadataRevisionUninitialized, MdID{}, false, err
 	}
-
-	j = makeMdIDJournal(s.codec, dir)
-	s.branchJournals[bid] = j
-	return j, nil
+	err = id.UnmarshalBinary(iter.Value())
+	if err != nil {
+		return MetadataRevisionUninitialized, MdID{}, false, err
+	}
+	return r, id, true, nil
 }
 
 func (s *mdServerTlfStorage) getHeadForTLFReadLocked(bid BranchID) (
 	rmds *RootMetadataSigned, err error) {
-	j, ok := s.branchJournals[bid]
-	if !ok {
-		return nil, nil
-	}
-	entry, exists, err := j.getLatestEntry()
+	_, id, exists, err := s.getLatestRevisionReadLocked(bid)
 	if err != nil {
 		return nil, err
 	}
 	if !exists {
 		return nil, nil
 	}
-	return s.getMDReadLocked(entry.ID)
+	return s.getMDReadLocked(id)
 }
 
 func (s *mdServerTlfStorage) checkGetParamsReadLocked(
-	currentUID keybase1.UID, bid BranchID) error {
+	ctx context.Context, currentUID keybase1.UID, bid BranchID) error {
 	mergedMasterHead, err := s.getHeadForTLFReadLocked(NullBranchID)
 	if err != nil {
 		return MDServerError{err}
@@ -240,7 +281,8 @@ func (s *mdServerTlfStorage) checkGetParamsReadLocked(
 		if err != nil {
 			return MDServerError{err}
 		}
-		ok, err := isReader(currentUID, mergedMasterHead.MD, extra)
+		ok, err := isReader(
+			ctx, s.teamGetter, currentUID, mergedMasterHead.MD, extra)
 		if err != nil {
 			return MDServerError{err}
 		}
@@ -252,27 +294,22 @@ func (s *mdServerTlfStorage) checkGetParamsReadLocked(
 	return nil
 }
 
-func (s *mdServerTlfStorage) getRangeReadLocked(
+func (s *mdServerTlfStorage) getRangeReadLocked(ctx context.Context,
 	currentUID keybase1.UID, bid BranchID, start, stop MetadataRevision) (
 	[]*RootMetadataSigned, error) {
-	err := s.checkGetParamsReadLocked(currentUID, bid)
+	err := s.checkGetParamsReadLocked(ctx, currentUID, bid)
 	if err != nil {
 		return nil, err
 	}
 
-	j, ok := s.branchJournals[bid]
-	if !ok {
-		return nil, nil
-	}
-
-	realStart, entries, err := j.getEntryRange(start, stop)
+	realStart, ids, err := s.getRevisionRangeReadLocked(bid, start, stop)
 	if err != nil {
 		return nil, err
 	}
 	var rmdses []*RootMetadataSigned
-	for i, entry := range entries {
+	for i, id := range ids {
 		expectedRevision := realStart + MetadataRevision(i)
-		rmds, err := s.getMDReadLocked(entry.ID)
+		rmds, err := s.getMDReadLocked(id)
 		if err != nil {
 			return nil, MDServerError{err}
 		}
@@ -286,8 +323,9 @@ func (s *mdServerTlfStorage) getRangeReadLocked(
 	return rmdses, nil
 }
 
-func (s *mdServerTlfStorage) putExtraMetadataLocked(rmds *RootMetadataSigned,
-	extra ExtraMetadata) error {
+// putExtraMetadataLocked adds any new key bundles in extra to batch.
+func (s *mdServerTlfStorage) putExtraMetadataLocked(batch *leveldb.Batch,
+	rmds *RootMetadataSigned, extra ExtraMetadata) error {
 	if extra == nil {
 		return nil
 	}
@@ -302,11 +340,11 @@ func (s *mdServerTlfStorage) putExtraMetadataLocked(rmds *RootMetadataSigned,
 		if wkbID == (TLFWriterKeyBundleID{}) {
 			panic("writer key bundle ID is empty")
 		}
-		err := kbfscodec.SerializeToFileIfNotExist(
-			s.codec, extraV3.wkb, s.writerKeyBundleV3Path(wkbID))
+		buf, err := s.codec.Encode(extraV3.wkb)
 		if err != nil {
 			return err
 		}
+		batch.Put(writerKeyBundleV3Key(wkbID), buf)
 	}
 
 	if extraV3.rkbNew {
@@ -314,11 +352,11 @@ func (s *mdServerTlfStorage) putExtraMetadataLocked(rmds *RootMetadataSigned,
 		if rkbID == (TLFReaderKeyBundleID{}) {
 			panic("reader key bundle ID is empty")
 		}
-		err := kbfscodec.SerializeToFileIfNotExist(
-			s.codec, extraV3.rkb, s.readerKeyBundleV3Path(rkbID))
+		buf, err := s.codec.Encode(extraV3.rkb)
 		if err != nil {
 			return err
 		}
+		batch.Put(readerKeyBundleV3Key(rkbID), buf)
 	}
 	return nil
 }
@@ -330,7 +368,7 @@ func (e errMDServerTlfStorageShutdown) Error() string {
 }
 
 func (s *mdServerTlfStorage) checkShutdownReadLocked() error {
-	if s.branchJournals == nil {
+	if s.db == nil {
 		return errors.WithStack(errMDServerTlfStorageShutdown{})
 	}
 	return nil
@@ -346,15 +384,27 @@ func (s *mdServerTlfStorage) journalLength(bid BranchID) (uint64, error) {
 		return 0, err
 	}
 
-	j, ok := s.branchJournals[bid]
-	if !ok {
-		return 0, nil
+	iter := s.db.NewIterator(
+		util.BytesPrefix(branchRevisionsPrefix(bid)), nil)
+	defer iter.Release()
+	if !iter.First() {
+		return 0, iter.Error()
 	}
-
-	return j.length()
+	earliest, err := revisionFromKey(bid, iter.Key())
+	if err != nil {
+		return 0, err
+	}
+	if !iter.Last() {
+		return 0, iter.Error()
+	}
+	latest, err := revisionFromKey(bid, iter.Key())
+	if err != nil {
+		return 0, err
+	}
+	return uint64(latest - earliest + 1), nil
 }
 
-func (s *mdServerTlfStorage) getForTLF(
+func (s *mdServerTlfStorage) getForTLF(ctx context.Context,
 	currentUID keybase1.UID, bid BranchID) (*RootMetadataSigned, error) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
@@ -363,7 +413,7 @@ func (s *mdServerTlfStorage) getForTLF(
 		return nil, err
 	}
 
-	err = s.checkGetParamsReadLocked(currentUID, bid)
+	err = s.checkGetParamsReadLocked(ctx, currentUID, bid)
 	if err != nil {
 		return nil, err
 	}
@@ -375,7 +425,7 @@ func (s *mdServerTlfStorage) getForTLF(
 	return rmds, nil
 }
 
-func (s *mdServerTlfStorage) getRange(
+func (s *mdServerTlfStorage) getRange(ctx context.Context,
 	currentUID keybase1.UID, bid BranchID, start, stop MetadataRevision) (
 	[]*RootMetadataSigned, error) {
 	s.lock.RLock()
@@ -385,10 +435,10 @@ func (s *mdServerTlfStorage) getRange(
 		return nil, err
 	}
 
-	return s.getRangeReadLocked(currentUID, bid, start, stop)
+	return s.getRangeReadLocked(ctx, currentUID, bid, start, stop)
 }
 
-func (s *mdServerTlfStorage) put(
+func (s *mdServerTlfStorage) put(ctx context.Context,
 	currentUID keybase1.UID, currentVerifyingKey kbfscrypto.VerifyingKey,
 	rmds *RootMetadataSigned, extra ExtraMetadata) (
 	recordBranchID bool, err error) {
@@ -399,7 +449,7 @@ func (s *mdServerTlfStorage) put(
 		return false, err
 	}
 
-	err = rmds.IsValidAndSigned(s.codec, s.crypto, extra)
+	err = rmds.IsValidAndSigned(ctx, s.codec, s.crypto, s.teamGetter, extra)
 	if err != nil {
 		return false, MDServerErrorBadRequest{Reason: err.Error()}
 	}
@@ -424,7 +474,7 @@ func (s *mdServerTlfStorage) put(
 			return false, MDServerError{err}
 		}
 		ok, err := isWriterOrValidRekey(
-			s.codec, currentUID,
+			ctx, s.teamGetter, s.codec, currentUID,
 			mergedMasterHead.MD, rmds.MD,
 			prevExtra, extra)
 		if err != nil {
@@ -447,7 +497,7 @@ func (s *mdServerTlfStorage) put(
 		// currHead for unmerged history might be on the main branch
 		prevRev := rmds.MD.RevisionNumber() - 1
 		rmdses, err := s.getRangeReadLocked(
-			currentUID, NullBranchID, prevRev, prevRev)
+			ctx, currentUID, NullBranchID, prevRev, prevRev)
 		if err != nil {
 			return false, MDServerError{err}
 		}
@@ -473,22 +523,24 @@ func (s *mdServerTlfStorage) put(
 		}
 	}
 
-	id, err := s.putMDLocked(rmds)
+	var batch leveldb.Batch
+	id, err := s.putMDLocked(&batch, rmds)
 	if err != nil {
 		return false, MDServerError{err}
 	}
 
-	err = s.putExtraMetadataLocked(rmds, extra)
+	err = s.putExtraMetadataLocked(&batch, rmds, extra)
 	if err != nil {
 		return false, MDServerError{err}
 	}
 
-	j, err := s.getOrCreateBranchJournalLocked(bid)
+	idBytes, err := id.MarshalBinary()
 	if err != nil {
-		return false, err
+		return false, MDServerError{err}
 	}
+	batch.Put(revisionKey(bid, rmds.MD.RevisionNumber()), idBytes)
 
-	err = j.append(rmds.MD.RevisionNumber(), mdIDJournalEntry{ID: id})
+	err = s.db.Write(&batch, nil)
 	if err != nil {
 		return false, MDServerError{err}
 	}
@@ -496,6 +548,158 @@ func (s *mdServerTlfStorage) put(
 	return recordBranchID, nil
 }
 
+// compactHistory deletes the oldest revisions of the merged branch,
+// and their MDs, as long as they fall outside what policy says to
+// keep. The head is always kept, and what remains is contiguous.
+// Returns the number of revisions deleted.
+func (s *mdServerTlfStorage) compactHistory(
+	policy MDHistoryCompactionPolicy, now time.Time) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.checkShutdownReadLocked()
+	if err != nil {
+		return 0, err
+	}
+
+	latest, _, exists, err := s.getLatestRevisionReadLocked(NullBranchID)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	iter := s.db.NewIterator(
+		util.BytesPrefix(branchRevisionsPrefix(NullBranchID)), nil)
+	defer iter.Release()
+	var batch leveldb.Batch
+	removed := 0
+	for iter.Next() {
+		r, err := revisionFromKey(NullBranchID, iter.Key())
+		if err != nil {
+			return 0, err
+		}
+		if r >= latest {
+			break
+		}
+		var id MdID
+		err = id.UnmarshalBinary(iter.Value())
+		if err != nil {
+			return 0, err
+		}
+
+		tooMany := policy.KeepRevisions > 0 &&
+			r <= latest-MetadataRevision(policy.KeepRevisions)
+		tooOld := false
+		if !tooMany && policy.MaxAge > 0 {
+			buf, err := s.db.Get(mdKey(id), nil)
+			if err != nil {
+				return 0, errors.WithStack(err)
+			}
+			var srmds serializedRMDS
+			err = s.codec.Decode(buf, &srmds)
+			if err != nil {
+				return 0, err
+			}
+			tooOld = now.Sub(srmds.Timestamp) > policy.MaxAge
+		}
+		if !tooMany && !tooOld {
+			break
+		}
+
+		batch.Delete(iter.Key())
+		batch.Delete(mdKey(id))
+		removed++
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	err = s.db.Write(&batch, nil)
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// truncateHistoryAfter deletes every revision of the merged branch
+// after rev, and their MDs, so that rev becomes the new head. Only
+// writers of the TLF may do this. Returns the number of revisions
+// deleted.
+func (s *mdServerTlfStorage) truncateHistoryAfter(ctx context.Context,
+	currentUID keybase1.UID, rev MetadataRevision) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.checkShutdownReadLocked()
+	if err != nil {
+		return 0, err
+	}
+
+	mergedMasterHead, err := s.getHeadForTLFReadLocked(NullBranchID)
+	if err != nil {
+		return 0, MDServerError{err}
+	}
+	if mergedMasterHead == nil {
+		return 0, MDServerErrorBadRequest{Reason: "TLF has no history"}
+	}
+	extra, err := getExtraMetadata(
+		s.getKeyBundlesReadLocked, mergedMasterHead.MD)
+	if err != nil {
+		return 0, MDServerError{err}
+	}
+	ok, err := isWriter(
+		ctx, s.teamGetter, currentUID, mergedMasterHead.MD, extra)
+	if err != nil {
+		return 0, MDServerError{err}
+	}
+	if !ok {
+		return 0, MDServerErrorUnauthorized{}
+	}
+
+	// The new head must still exist.
+	_, ids, err := s.getRevisionRangeReadLocked(NullBranchID, rev, rev)
+	if err != nil {
+		return 0, MDServerError{err}
+	}
+	if len(ids) != 1 {
+		return 0, MDServerErrorBadRequest{
+			Reason: fmt.Sprintf("Revision %d doesn't exist", rev)}
+	}
+
+	iter := s.db.NewIterator(&util.Range{
+		Start: revisionKey(NullBranchID, rev+1),
+		Limit: util.BytesPrefix(branchRevisionsPrefix(NullBranchID)).Limit,
+	}, nil)
+	defer iter.Release()
+	var batch leveldb.Batch
+	removed := 0
+	for iter.Next() {
+		var id MdID
+		err = id.UnmarshalBinary(iter.Value())
+		if err != nil {
+			return 0, MDServerError{err}
+		}
+		batch.Delete(iter.Key())
+		batch.Delete(mdKey(id))
+		removed++
+	}
+	if err := iter.Error(); err != nil {
+		return 0, MDServerError{err}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	err = s.db.Write(&batch, nil)
+	if err != nil {
+		return 0, MDServerError{err}
+	}
+	return removed, nil
+}
+
 func (s *mdServerTlfStorage) getKeyBundlesReadLocked(tlfID tlf.ID,
 	wkbID TLFWriterKeyBundleID, rkbID TLFReaderKeyBundleID) (
 	*TLFWriterKeyBundleV3, *TLFReaderKeyBundleV3, error) {
@@ -506,8 +710,12 @@ func (s *mdServerTlfStorage) getKeyBundlesReadLocked(tlfID tlf.ID,
 
 	var wkb *TLFWriterKeyBundleV3
 	if wkbID != (TLFWriterKeyBundleID{}) {
-		foundWKB, err := DeserializeTLFWriterKeyBundleV3(
-			s.codec, s.writerKeyBundleV3Path(wkbID))
+		buf, err := s.db.Get(writerKeyBundleV3Key(wkbID), nil)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		var foundWKB TLFWriterKeyBundleV3
+		err = s.codec.Decode(buf, &foundWKB)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -521,8 +729,12 @@ func (s *mdServerTlfStorage) getKeyBundlesReadLocked(tlfID tlf.ID,
 
 	var rkb *TLFReaderKeyBundleV3
 	if rkbID != (TLFReaderKeyBundleID{}) {
-		foundRKB, err := DeserializeTLFReaderKeyBundleV3(
-			s.codec, s.readerKeyBundleV3Path(rkbID))
+		buf, err := s.db.Get(readerKeyBundleV3Key(rkbID), nil)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		var foundRKB TLFReaderKeyBundleV3
+		err = s.codec.Decode(buf, &foundRKB)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -549,5 +761,143 @@ func (s *mdServerTlfStorage) getKeyBundles(tlfID tlf.ID,
 func (s *mdServerTlfStorage) shutdown() {
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	s.branchJournals = nil
+	if s.db == nil {
+		return
+	}
+	s.db.Close()
+	s.db = nil
+}
+
+// oldMDServerTlfDirs are the subdirectories of a TLF's directory in
+// which older versions of the disk MD server kept their data, as flat
+// files:
+//
+// dir/md_branch_journals/<branch ID>/<mdIDJournal>
+// dir/mds/<first 4 chars of MdID>/<rest of MdID> -> serializedRMDS
+// dir/wkbv3/<writer key bundle ID>               -> TLFWriterKeyBundleV3
+// dir/rkbv3/<reader key bundle ID>               -> TLFReaderKeyBundleV3
+var oldMDServerTlfDirs = []string{"md_branch_journals", "mds", "wkbv3", "rkbv3"}
+
+// readDirIfExists is like ioutil.ReadDir, but returns nothing if dir
+// doesn't exist.
+func readDirIfExists(dir string) ([]os.FileInfo, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if ioutil.IsNotExist(err) {
+		return nil, nil
+	}
+	return fileInfos, err
+}
+
+// migrateOldMDServerTlfDir copies the data that an older version of
+// the disk MD server kept in flat files under the TLF directory dir
+// into db, and then deletes those files. The MD and key bundle files
+// hold exactly what's now stored under their keys, so they're copied
+// verbatim. It returns whether there was anything to migrate.
+func migrateOldMDServerTlfDir(
+	codec kbfscodec.Codec, dir string, db *levelDB) (bool, error) {
+	found := false
+	for _, name := range oldMDServerTlfDirs {
+		_, err := ioutil.Stat(filepath.Join(dir, name))
+		if err == nil {
+			found = true
+		} else if !ioutil.IsNotExist(err) {
+			return false, err
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	var batch leveldb.Batch
+	mdsDir := filepath.Join(dir, "mds")
+	splayInfos, err := readDirIfExists(mdsDir)
+	if err != nil {
+		return false, err
+	}
+	for _, splayInfo := range splayInfos {
+		splayDir := filepath.Join(mdsDir, splayInfo.Name())
+		fileInfos, err := ioutil.ReadDir(splayDir)
+		if err != nil {
+			return false, err
+		}
+		for _, fi := range fileInfos {
+			h, err := kbfshash.HashFromString(splayInfo.Name() + fi.Name())
+			if err != nil {
+				return false, err
+			}
+			buf, err := ioutil.ReadFile(filepath.Join(splayDir, fi.Name()))
+			if err != nil {
+				return false, err
+			}
+			batch.Put(mdKey(MdID{h}), buf)
+		}
+	}
+
+	for _, kb := range []struct {
+		name string
+		key  func(h kbfshash.Hash) []byte
+	}{
+		{"wkbv3", func(h kbfshash.Hash) []byte {
+			return writerKeyBundleV3Key(TLFWriterKeyBundleID{h})
+		}},
+		{"rkbv3", func(h kbfshash.Hash) []byte {
+			return readerKeyBundleV3Key(TLFReaderKeyBundleID{h})
+		}},
+	} {
+		kbDir := filepath.Join(dir, kb.name)
+		fileInfos, err := readDirIfExists(kbDir)
+		if err != nil {
+			return false, err
+		}
+		for _, fi := range fileInfos {
+			h, err := kbfshash.HashFromString(fi.Name())
+			if err != nil {
+				return false, err
+			}
+			buf, err := ioutil.ReadFile(filepath.Join(kbDir, fi.Name()))
+			if err != nil {
+				return false, err
+			}
+			batch.Put(kb.key(h), buf)
+		}
+	}
+
+	journalsDir := filepath.Join(dir, "md_branch_journals")
+	branchInfos, err := readDirIfExists(journalsDir)
+	if err != nil {
+		return false, err
+	}
+	for _, branchInfo := range branchInfos {
+		bid, err := ParseBranchID(branchInfo.Name())
+		if err != nil {
+			return false, err
+		}
+		j := makeMdIDJournal(
+			codec, filepath.Join(journalsDir, branchInfo.Name()))
+		start, entries, err := j.getEntryRange(
+			MetadataRevisionInitial, MetadataRevision(1<<63-1))
+		if err != nil {
+			return false, err
+		}
+		for i, entry := range entries {
+			buf, err := entry.ID.MarshalBinary()
+			if err != nil {
+				return false, err
+			}
+			batch.Put(revisionKey(bid, start+MetadataRevision(i)), buf)
+		}
+	}
+
+	// Make sure everything is on disk before the old files go.
+	err = db.Write(&batch, &opt.WriteOptions{Sync: true})
+	if err != nil {
+		return false, err
+	}
+	for _, name := range oldMDServerTlfDirs {
+		err := ioutil.RemoveAll(filepath.Join(dir, name))
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
 }
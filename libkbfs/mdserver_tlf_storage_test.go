@@ -6,7 +6,9 @@ package libkbfs
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/ioutil"
@@ -14,6 +16,7 @@ import (
 	"github.com/keybase/kbfs/kbfscrypto"
 	"github.com/keybase/kbfs/tlf"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
 )
 
 func getMDStorageLength(t *testing.T, s *mdServerTlfStorage, bid BranchID) int {
@@ -25,6 +28,8 @@ func getMDStorageLength(t *testing.T, s *mdServerTlfStorage, bid BranchID) int {
 // TestMDServerTlfStorageBasic copies TestMDServerBasics, but for a
 // single mdServerTlfStorage.
 func TestMDServerTlfStorageBasic(t *testing.T) {
+	ctx := context.Background()
+
 	codec := kbfscodec.NewMsgpack()
 	crypto := MakeCryptoCommon(codec)
 	signingKey := kbfscrypto.MakeFakeSigningKeyOrBust("test key")
@@ -39,8 +44,10 @@ func TestMDServerTlfStorageBasic(t *testing.T) {
 	}()
 
 	tlfID := tlf.FakeID(1, false)
-	s := makeMDServerTlfStorage(tlfID, codec, crypto, wallClock{},
-		defaultClientMetadataVer, tempdir)
+	db, err := openLevelDBFile(tempdir)
+	require.NoError(t, err)
+	s := makeMDServerTlfStorage(tlfID, codec, crypto, nil, wallClock{},
+		defaultClientMetadataVer, db)
 	defer s.shutdown()
 
 	require.Equal(t, 0, getMDStorageLength(t, s, NullBranchID))
@@ -51,7 +58,7 @@ func TestMDServerTlfStorageBasic(t *testing.T) {
 
 	// (1) Validate merged branch is empty.
 
-	head, err := s.getForTLF(uid, NullBranchID)
+	head, err := s.getForTLF(ctx, uid, NullBranchID)
 	require.NoError(t, err)
 	require.Nil(t, head)
 
@@ -65,7 +72,7 @@ func TestMDServerTlfStorageBasic(t *testing.T) {
 		brmd := makeBRMDForTest(t, codec, crypto, tlfID, h, i, uid, prevRoot)
 		rmds := signRMDSForTest(t, codec, signer, brmd)
 		// MDv3 TODO: pass extra metadata
-		recordBranchID, err := s.put(uid, verifyingKey, rmds, nil)
+		recordBranchID, err := s.put(ctx, uid, verifyingKey, rmds, nil)
 		require.NoError(t, err)
 		require.False(t, recordBranchID)
 		prevRoot, err = crypto.MakeMdID(rmds.MD)
@@ -82,7 +89,7 @@ func TestMDServerTlfStorageBasic(t *testing.T) {
 	brmd := makeBRMDForTest(t, codec, crypto, tlfID, h, 10, uid, prevRoot)
 	rmds := signRMDSForTest(t, codec, signer, brmd)
 	// MDv3 TODO: pass extra metadata
-	_, err = s.put(uid, verifyingKey, rmds, nil)
+	_, err = s.put(ctx, uid, verifyingKey, rmds, nil)
 	require.IsType(t, MDServerErrorConflictRevision{}, err)
 
 	require.Equal(t, 10, getMDStorageLength(t, s, NullBranchID))
@@ -98,7 +105,7 @@ func TestMDServerTlfStorageBasic(t *testing.T) {
 		brmd.SetBranchID(bid)
 		rmds := signRMDSForTest(t, codec, signer, brmd)
 		// MDv3 TODO: pass extra metadata
-		recordBranchID, err := s.put(uid, verifyingKey, rmds, nil)
+		recordBranchID, err := s.put(ctx, uid, verifyingKey, rmds, nil)
 		require.NoError(t, err)
 		require.Equal(t, i == MetadataRevision(6), recordBranchID)
 		prevRoot, err = crypto.MakeMdID(rmds.MD)
@@ -110,7 +117,7 @@ func TestMDServerTlfStorageBasic(t *testing.T) {
 
 	// (5) Check for proper unmerged head.
 
-	head, err = s.getForTLF(uid, bid)
+	head, err = s.getForTLF(ctx, uid, bid)
 	require.NoError(t, err)
 	require.NotNil(t, head)
 	require.Equal(t, MetadataRevision(40), head.MD.RevisionNumber())
@@ -120,7 +127,7 @@ func TestMDServerTlfStorageBasic(t *testing.T) {
 
 	// (6) Try to get unmerged range.
 
-	rmdses, err := s.getRange(uid, bid, 1, 100)
+	rmdses, err := s.getRange(ctx, uid, bid, 1, 100)
 	require.NoError(t, err)
 	require.Equal(t, 35, len(rmdses))
 	for i := MetadataRevision(6); i < 16; i++ {
@@ -131,14 +138,14 @@ func TestMDServerTlfStorageBasic(t *testing.T) {
 
 	// (10) Check for proper merged head.
 
-	head, err = s.getForTLF(uid, NullBranchID)
+	head, err = s.getForTLF(ctx, uid, NullBranchID)
 	require.NoError(t, err)
 	require.NotNil(t, head)
 	require.Equal(t, MetadataRevision(10), head.MD.RevisionNumber())
 
 	// (11) Try to get merged range.
 
-	rmdses, err = s.getRange(uid, NullBranchID, 1, 100)
+	rmdses, err = s.getRange(ctx, uid, NullBranchID, 1, 100)
 	require.NoError(t, err)
 	require.Equal(t, 10, len(rmdses))
 	for i := MetadataRevision(1); i <= 10; i++ {
@@ -147,4 +154,237 @@ func TestMDServerTlfStorageBasic(t *testing.T) {
 
 	require.Equal(t, 10, getMDStorageLength(t, s, NullBranchID))
 	require.Equal(t, 35, getMDStorageLength(t, s, bid))
+
+	// (12) Everything should still be there after reopening the
+	// storage.
+
+	s.shutdown()
+	db, err = openLevelDBFile(tempdir)
+	require.NoError(t, err)
+	s = makeMDServerTlfStorage(tlfID, codec, crypto, nil, wallClock{},
+		defaultClientMetadataVer, db)
+	defer s.shutdown()
+
+	require.Equal(t, 10, getMDStorageLength(t, s, NullBranchID))
+	require.Equal(t, 35, getMDStorageLength(t, s, bid))
+
+	head, err = s.getForTLF(ctx, uid, bid)
+	require.NoError(t, err)
+	require.NotNil(t, head)
+	require.Equal(t, MetadataRevision(40), head.MD.RevisionNumber())
+
+	rmdses, err = s.getRange(ctx, uid, NullBranchID, 3, 5)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(rmdses))
+	for i := MetadataRevision(3); i <= 5; i++ {
+		require.Equal(t, i, rmdses[i-3].MD.RevisionNumber())
+	}
+}
+
+func TestMDServerTlfStorageCompactHistory(t *testing.T) {
+	ctx := context.Background()
+
+	codec := kbfscodec.NewMsgpack()
+	crypto := MakeCryptoCommon(codec)
+	signingKey := kbfscrypto.MakeFakeSigningKeyOrBust("test key")
+	verifyingKey := kbfscrypto.MakeFakeVerifyingKeyOrBust("test key")
+	signer := kbfscrypto.SigningKeySigner{Key: signingKey}
+
+	tempdir, err := ioutil.TempDir(os.TempDir(), "mdserver_tlf_storage")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	clock := newTestClockNow()
+	tlfID := tlf.FakeID(1, false)
+	db, err := openLevelDBFile(tempdir)
+	require.NoError(t, err)
+	s := makeMDServerTlfStorage(tlfID, codec, crypto, nil, clock,
+		defaultClientMetadataVer, db)
+	defer s.shutdown()
+
+	uid := keybase1.MakeTestUID(1)
+	h, err := tlf.MakeHandle([]keybase1.UID{uid}, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	// Put revisions 1 through 10, an hour apart.
+	prevRoot := MdID{}
+	for i := MetadataRevision(1); i <= 10; i++ {
+		brmd := makeBRMDForTest(t, codec, crypto, tlfID, h, i, uid, prevRoot)
+		rmds := signRMDSForTest(t, codec, signer, brmd)
+		_, err := s.put(ctx, uid, verifyingKey, rmds, nil)
+		require.NoError(t, err)
+		prevRoot, err = crypto.MakeMdID(rmds.MD)
+		require.NoError(t, err)
+		clock.Add(time.Hour)
+	}
+
+	// Keep the latest 8 revisions.
+	removed, err := s.compactHistory(
+		MDHistoryCompactionPolicy{KeepRevisions: 8}, clock.Now())
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+	require.Equal(t, 8, getMDStorageLength(t, s, NullBranchID))
+
+	// Revision 10 was put an hour ago, and revision 5 six hours
+	// ago.
+	removed, err = s.compactHistory(
+		MDHistoryCompactionPolicy{MaxAge: 5*time.Hour + time.Minute},
+		clock.Now())
+	require.NoError(t, err)
+	require.Equal(t, 3, removed)
+
+	rmdses, err := s.getRange(ctx, uid, NullBranchID, 1, 100)
+	require.NoError(t, err)
+	require.Equal(t, 5, len(rmdses))
+	for i, rmds := range rmdses {
+		require.Equal(t, MetadataRevision(i+6), rmds.MD.RevisionNumber())
+	}
+
+	// The head is always kept.
+	removed, err = s.compactHistory(
+		MDHistoryCompactionPolicy{MaxAge: time.Nanosecond}, clock.Now())
+	require.NoError(t, err)
+	require.Equal(t, 4, removed)
+
+	head, err := s.getForTLF(ctx, uid, NullBranchID)
+	require.NoError(t, err)
+	require.Equal(t, MetadataRevision(10), head.MD.RevisionNumber())
+	require.Equal(t, 1, getMDStorageLength(t, s, NullBranchID))
+}
+
+func TestMDServerTlfStorageTruncateHistoryAfter(t *testing.T) {
+	ctx := context.Background()
+
+	codec := kbfscodec.NewMsgpack()
+	crypto := MakeCryptoCommon(codec)
+	signingKey := kbfscrypto.MakeFakeSigningKeyOrBust("test key")
+	verifyingKey := kbfscrypto.MakeFakeVerifyingKeyOrBust("test key")
+	signer := kbfscrypto.SigningKeySigner{Key: signingKey}
+
+	tempdir, err := ioutil.TempDir(os.TempDir(), "mdserver_tlf_storage")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	tlfID := tlf.FakeID(1, false)
+	db, err := openLevelDBFile(tempdir)
+	require.NoError(t, err)
+	s := makeMDServerTlfStorage(tlfID, codec, crypto, nil, wallClock{},
+		defaultClientMetadataVer, db)
+	defer s.shutdown()
+
+	uid := keybase1.MakeTestUID(1)
+	h, err := tlf.MakeHandle([]keybase1.UID{uid}, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	prevRoot := MdID{}
+	var revs []MdID
+	for i := MetadataRevision(1); i <= 10; i++ {
+		brmd := makeBRMDForTest(t, codec, crypto, tlfID, h, i, uid, prevRoot)
+		rmds := signRMDSForTest(t, codec, signer, brmd)
+		_, err := s.put(ctx, uid, verifyingKey, rmds, nil)
+		require.NoError(t, err)
+		prevRoot, err = crypto.MakeMdID(rmds.MD)
+		require.NoError(t, err)
+		revs = append(revs, prevRoot)
+	}
+
+	// Only writers may truncate.
+	_, err = s.truncateHistoryAfter(ctx, keybase1.MakeTestUID(2), 5)
+	require.IsType(t, MDServerErrorUnauthorized{}, err)
+
+	// The new head must exist.
+	_, err = s.truncateHistoryAfter(ctx, uid, 11)
+	require.IsType(t, MDServerErrorBadRequest{}, err)
+
+	removed, err := s.truncateHistoryAfter(ctx, uid, 5)
+	require.NoError(t, err)
+	require.Equal(t, 5, removed)
+	require.Equal(t, 5, getMDStorageLength(t, s, NullBranchID))
+
+	head, err := s.getForTLF(ctx, uid, NullBranchID)
+	require.NoError(t, err)
+	require.Equal(t, MetadataRevision(5), head.MD.RevisionNumber())
+
+	// New revisions can be put on top of the new head.
+	brmd := makeBRMDForTest(t, codec, crypto, tlfID, h, 6, uid, revs[4])
+	rmds := signRMDSForTest(t, codec, signer, brmd)
+	_, err = s.put(ctx, uid, verifyingKey, rmds, nil)
+	require.NoError(t, err)
+	require.Equal(t, 6, getMDStorageLength(t, s, NullBranchID))
+}
+
+func TestMDServerTlfStorageMigrateOldLayout(t *testing.T) {
+	ctx := context.Background()
+
+	codec := kbfscodec.NewMsgpack()
+	crypto := MakeCryptoCommon(codec)
+	signingKey := kbfscrypto.MakeFakeSigningKeyOrBust("test key")
+	signer := kbfscrypto.SigningKeySigner{Key: signingKey}
+
+	tempdir, err := ioutil.TempDir(os.TempDir(), "mdserver_tlf_storage")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	tlfID := tlf.FakeID(1, false)
+	uid := keybase1.MakeTestUID(1)
+	h, err := tlf.MakeHandle([]keybase1.UID{uid}, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	// Lay out a few revisions the way older versions did.
+	j := makeMdIDJournal(
+		codec, filepath.Join(tempdir, "md_branch_journals",
+			NullBranchID.String()))
+	prevRoot := MdID{}
+	for i := MetadataRevision(1); i <= 3; i++ {
+		brmd := makeBRMDForTest(t, codec, crypto, tlfID, h, i, uid, prevRoot)
+		rmds := signRMDSForTest(t, codec, signer, brmd)
+		encodedRMDS, err := EncodeRootMetadataSigned(codec, rmds)
+		require.NoError(t, err)
+		id, err := crypto.MakeMdID(rmds.MD)
+		require.NoError(t, err)
+		idStr := id.String()
+		err = kbfscodec.SerializeToFile(codec, serializedRMDS{
+			EncodedRMDS: encodedRMDS,
+			Timestamp:   time.Now(),
+			Version:     rmds.MD.Version(),
+		}, filepath.Join(tempdir, "mds", idStr[:4], idStr[4:]))
+		require.NoError(t, err)
+		err = j.append(i, mdIDJournalEntry{ID: id})
+		require.NoError(t, err)
+		prevRoot = id
+	}
+
+	db, err := openLevelDBFile(filepath.Join(tempdir, "md.db"))
+	require.NoError(t, err)
+	migrated, err := migrateOldMDServerTlfDir(codec, tempdir, db)
+	require.NoError(t, err)
+	require.True(t, migrated)
+	s := makeMDServerTlfStorage(tlfID, codec, crypto, nil, wallClock{},
+		defaultClientMetadataVer, db)
+	defer s.shutdown()
+
+	rmdses, err := s.getRange(ctx, uid, NullBranchID, 1, 100)
+	require.NoError(t, err)
+	require.Len(t, rmdses, 3)
+	head, err := s.getForTLF(ctx, uid, NullBranchID)
+	require.NoError(t, err)
+	require.Equal(t, MetadataRevision(3), head.MD.RevisionNumber())
+
+	// The old files are gone, so there's nothing left to migrate.
+	for _, name := range oldMDServerTlfDirs {
+		_, err := ioutil.Stat(filepath.Join(tempdir, name))
+		require.True(t, ioutil.IsNotExist(err))
+	}
+	migrated, err = migrateOldMDServerTlfDir(codec, tempdir, db)
+	require.NoError(t, err)
+	require.False(t, migrated)
 }
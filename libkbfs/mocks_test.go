@@ -4,6 +4,7 @@
 package libkbfs
 
 import (
+	tls "crypto/tls"
 	gomock "github.com/golang/mock/gomock"
 	libkb "github.com/keybase/client/go/libkb"
 	logger "github.com/keybase/client/go/logger"
@@ -14,6 +15,7 @@ import (
 	tlf "github.com/keybase/kbfs/tlf"
 	go_metrics "github.com/rcrowley/go-metrics"
 	context "golang.org/x/net/context"
+	os "os"
 	time "time"
 )
 
@@ -234,6 +236,97 @@ func (_mr *_MockcryptoPureGetterRecorder) cryptoPure() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "cryptoPure")
 }
 
+// Mock of blockCompressionGetter interface
+type MockblockCompressionGetter struct {
+	ctrl     *gomock.Controller
+	recorder *_MockblockCompressionGetterRecorder
+}
+
+// Recorder for MockblockCompressionGetter (not exported)
+type _MockblockCompressionGetterRecorder struct {
+	mock *MockblockCompressionGetter
+}
+
+func NewMockblockCompressionGetter(ctrl *gomock.Controller) *MockblockCompressionGetter {
+	mock := &MockblockCompressionGetter{ctrl: ctrl}
+	mock.recorder = &_MockblockCompressionGetterRecorder{mock}
+	return mock
+}
+
+func (_m *MockblockCompressionGetter) EXPECT() *_MockblockCompressionGetterRecorder {
+	return _m.recorder
+}
+
+func (_m *MockblockCompressionGetter) BlockCompression() BlockCompressionType {
+	ret := _m.ctrl.Call(_m, "BlockCompression")
+	ret0, _ := ret[0].(BlockCompressionType)
+	return ret0
+}
+
+func (_mr *_MockblockCompressionGetterRecorder) BlockCompression() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "BlockCompression")
+}
+
+// Mock of blockTransferTrackerGetter interface
+type MockblockTransferTrackerGetter struct {
+	ctrl     *gomock.Controller
+	recorder *_MockblockTransferTrackerGetterRecorder
+}
+
+// Recorder for MockblockTransferTrackerGetter (not exported)
+type _MockblockTransferTrackerGetterRecorder struct {
+	mock *MockblockTransferTrackerGetter
+}
+
+func NewMockblockTransferTrackerGetter(ctrl *gomock.Controller) *MockblockTransferTrackerGetter {
+	mock := &MockblockTransferTrackerGetter{ctrl: ctrl}
+	mock.recorder = &_MockblockTransferTrackerGetterRecorder{mock}
+	return mock
+}
+
+func (_m *MockblockTransferTrackerGetter) EXPECT() *_MockblockTransferTrackerGetterRecorder {
+	return _m.recorder
+}
+
+func (_m *MockblockTransferTrackerGetter) blockTransferTracker() *blockTransferTracker {
+	ret := _m.ctrl.Call(_m, "blockTransferTracker")
+	ret0, _ := ret[0].(*blockTransferTracker)
+	return ret0
+}
+
+func (_mr *_MockblockTransferTrackerGetterRecorder) blockTransferTracker() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "blockTransferTracker")
+}
+
+// Mock of BlockTransferObserver interface
+type MockBlockTransferObserver struct {
+	ctrl     *gomock.Controller
+	recorder *_MockBlockTransferObserverRecorder
+}
+
+// Recorder for MockBlockTransferObserver (not exported)
+type _MockBlockTransferObserverRecorder struct {
+	mock *MockBlockTransferObserver
+}
+
+func NewMockBlockTransferObserver(ctrl *gomock.Controller) *MockBlockTransferObserver {
+	mock := &MockBlockTransferObserver{ctrl: ctrl}
+	mock.recorder = &_MockBlockTransferObserverRecorder{mock}
+	return mock
+}
+
+func (_m *MockBlockTransferObserver) EXPECT() *_MockBlockTransferObserverRecorder {
+	return _m.recorder
+}
+
+func (_m *MockBlockTransferObserver) BlockTransferProgress(ctx context.Context, progress BlockTransferProgress) {
+	_m.ctrl.Call(_m, "BlockTransferProgress", ctx, progress)
+}
+
+func (_mr *_MockBlockTransferObserverRecorder) BlockTransferProgress(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "BlockTransferProgress", arg0, arg1)
+}
+
 // Mock of Block interface
 type MockBlock struct {
 	ctrl     *gomock.Controller
@@ -393,6 +486,17 @@ func (_mr *_MockNodeRecorder) GetBasename() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetBasename")
 }
 
+func (_m *MockNode) GetPathPlaintextSansTlf() (string, bool) {
+	ret := _m.ctrl.Call(_m, "GetPathPlaintextSansTlf")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+func (_mr *_MockNodeRecorder) GetPathPlaintextSansTlf() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetPathPlaintextSansTlf")
+}
+
 // Mock of KBFSOps interface
 type MockKBFSOps struct {
 	ctrl     *gomock.Controller
@@ -453,6 +557,17 @@ func (_mr *_MockKBFSOpsRecorder) DeleteFavorite(arg0, arg1 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteFavorite", arg0, arg1)
 }
 
+func (_m *MockKBFSOps) GetAllTLFHandles(ctx context.Context) ([]*TlfHandle, error) {
+	ret := _m.ctrl.Call(_m, "GetAllTLFHandles", ctx)
+	ret0, _ := ret[0].([]*TlfHandle)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBFSOpsRecorder) GetAllTLFHandles(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetAllTLFHandles", arg0)
+}
+
 func (_m *MockKBFSOps) GetTLFCryptKeys(ctx context.Context, tlfHandle *TlfHandle) ([]kbfscrypto.TLFCryptKey, tlf.ID, error) {
 	ret := _m.ctrl.Call(_m, "GetTLFCryptKeys", ctx, tlfHandle)
 	ret0, _ := ret[0].([]kbfscrypto.TLFCryptKey)
@@ -476,6 +591,17 @@ func (_mr *_MockKBFSOpsRecorder) GetTLFID(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFID", arg0, arg1)
 }
 
+func (_m *MockKBFSOps) GetTLFHandle(ctx context.Context, id tlf.ID) (*TlfHandle, error) {
+	ret := _m.ctrl.Call(_m, "GetTLFHandle", ctx, id)
+	ret0, _ := ret[0].(*TlfHandle)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBFSOpsRecorder) GetTLFHandle(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFHandle", arg0, arg1)
+}
+
 func (_m *MockKBFSOps) GetOrCreateRootNode(ctx context.Context, h *TlfHandle, branch BranchName) (Node, EntryInfo, error) {
 	ret := _m.ctrl.Call(_m, "GetOrCreateRootNode", ctx, h, branch)
 	ret0, _ := ret[0].(Node)
@@ -511,6 +637,18 @@ func (_mr *_MockKBFSOpsRecorder) GetDirChildren(arg0, arg1 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetDirChildren", arg0, arg1)
 }
 
+func (_m *MockKBFSOps) GetDirChildrenPage(ctx context.Context, dir Node, after string, maxEntries int) ([]DirChild, bool, error) {
+	ret := _m.ctrl.Call(_m, "GetDirChildrenPage", ctx, dir, after, maxEntries)
+	ret0, _ := ret[0].([]DirChild)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockKBFSOpsRecorder) GetDirChildrenPage(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetDirChildrenPage", arg0, arg1, arg2, arg3)
+}
+
 func (_m *MockKBFSOps) Lookup(ctx context.Context, dir Node, name string) (Node, EntryInfo, error) {
 	ret := _m.ctrl.Call(_m, "Lookup", ctx, dir, name)
 	ret0, _ := ret[0].(Node)
@@ -640,6 +778,16 @@ func (_mr *_MockKBFSOpsRecorder) SetEx(arg0, arg1, arg2 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetEx", arg0, arg1, arg2)
 }
 
+func (_m *MockKBFSOps) SetMode(ctx context.Context, node Node, mode os.FileMode) error {
+	ret := _m.ctrl.Call(_m, "SetMode", ctx, node, mode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKBFSOpsRecorder) SetMode(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetMode", arg0, arg1, arg2)
+}
+
 func (_m *MockKBFSOps) SetMtime(ctx context.Context, file Node, mtime *time.Time) error {
 	ret := _m.ctrl.Call(_m, "SetMtime", ctx, file, mtime)
 	ret0, _ := ret[0].(error)
@@ -650,6 +798,48 @@ func (_mr *_MockKBFSOpsRecorder) SetMtime(arg0, arg1, arg2 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetMtime", arg0, arg1, arg2)
 }
 
+func (_m *MockKBFSOps) GetXattr(ctx context.Context, node Node, name string) ([]byte, error) {
+	ret := _m.ctrl.Call(_m, "GetXattr", ctx, node, name)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBFSOpsRecorder) GetXattr(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetXattr", arg0, arg1, arg2)
+}
+
+func (_m *MockKBFSOps) ListXattrs(ctx context.Context, node Node) ([]string, error) {
+	ret := _m.ctrl.Call(_m, "ListXattrs", ctx, node)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBFSOpsRecorder) ListXattrs(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ListXattrs", arg0, arg1)
+}
+
+func (_m *MockKBFSOps) SetXattr(ctx context.Context, node Node, name string, value []byte) error {
+	ret := _m.ctrl.Call(_m, "SetXattr", ctx, node, name, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKBFSOpsRecorder) SetXattr(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetXattr", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockKBFSOps) RemoveXattr(ctx context.Context, node Node, name string) error {
+	ret := _m.ctrl.Call(_m, "RemoveXattr", ctx, node, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKBFSOpsRecorder) RemoveXattr(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RemoveXattr", arg0, arg1, arg2)
+}
+
 func (_m *MockKBFSOps) Sync(ctx context.Context, file Node) error {
 	ret := _m.ctrl.Call(_m, "Sync", ctx, file)
 	ret0, _ := ret[0].(error)
@@ -704,6 +894,26 @@ func (_mr *_MockKBFSOpsRecorder) Rekey(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Rekey", arg0, arg1)
 }
 
+func (_m *MockKBFSOps) RotateKey(ctx context.Context, id tlf.ID) error {
+	ret := _m.ctrl.Call(_m, "RotateKey", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKBFSOpsRecorder) RotateKey(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RotateKey", arg0, arg1)
+}
+
+func (_m *MockKBFSOps) SetTlfSyncMode(_param0 context.Context, _param1 tlf.ID, _param2 TlfSyncMode) error {
+	ret := _m.ctrl.Call(_m, "SetTlfSyncMode", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKBFSOpsRecorder) SetTlfSyncMode(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetTlfSyncMode", arg0, arg1, arg2)
+}
+
 func (_m *MockKBFSOps) SyncFromServerForTesting(ctx context.Context, folderBranch FolderBranch) error {
 	ret := _m.ctrl.Call(_m, "SyncFromServerForTesting", ctx, folderBranch)
 	ret0, _ := ret[0].(error)
@@ -725,6 +935,47 @@ func (_mr *_MockKBFSOpsRecorder) GetUpdateHistory(arg0, arg1 interface{}) *gomoc
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUpdateHistory", arg0, arg1)
 }
 
+func (_m *MockKBFSOps) GetUnmergedHistory(ctx context.Context, folderBranch FolderBranch) (TLFUpdateHistory, error) {
+	ret := _m.ctrl.Call(_m, "GetUnmergedHistory", ctx, folderBranch)
+	ret0, _ := ret[0].(TLFUpdateHistory)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBFSOpsRecorder) GetUnmergedHistory(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUnmergedHistory", arg0, arg1)
+}
+
+func (_m *MockKBFSOps) SubscribeToChanges(ctx context.Context, folderBranch FolderBranch, node Node, subscriber ChangeSubscriber) error {
+	ret := _m.ctrl.Call(_m, "SubscribeToChanges", ctx, folderBranch, node, subscriber)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKBFSOpsRecorder) SubscribeToChanges(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SubscribeToChanges", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockKBFSOps) SubscribeToFilteredChanges(ctx context.Context, folderBranch FolderBranch, filter ChangeFilter, subscriber ChangeSubscriber) error {
+	ret := _m.ctrl.Call(_m, "SubscribeToFilteredChanges", ctx, folderBranch, filter, subscriber)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKBFSOpsRecorder) SubscribeToFilteredChanges(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SubscribeToFilteredChanges", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockKBFSOps) UnsubscribeFromChanges(ctx context.Context, folderBranch FolderBranch, subscriber ChangeSubscriber) error {
+	ret := _m.ctrl.Call(_m, "UnsubscribeFromChanges", ctx, folderBranch, subscriber)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKBFSOpsRecorder) UnsubscribeFromChanges(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UnsubscribeFromChanges", arg0, arg1, arg2)
+}
+
 func (_m *MockKBFSOps) GetEditHistory(ctx context.Context, folderBranch FolderBranch) (TlfWriterEdits, error) {
 	ret := _m.ctrl.Call(_m, "GetEditHistory", ctx, folderBranch)
 	ret0, _ := ret[0].(TlfWriterEdits)
@@ -736,6 +987,91 @@ func (_mr *_MockKBFSOpsRecorder) GetEditHistory(arg0, arg1 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetEditHistory", arg0, arg1)
 }
 
+func (_m *MockKBFSOps) GetActivityLog(ctx context.Context, folderBranch FolderBranch, since time.Time) ([]TlfActivityEntry, error) {
+	ret := _m.ctrl.Call(_m, "GetActivityLog", ctx, folderBranch, since)
+	ret0, _ := ret[0].([]TlfActivityEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBFSOpsRecorder) GetActivityLog(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetActivityLog", arg0, arg1, arg2)
+}
+
+func (_m *MockKBFSOps) GetArchivedEntry(ctx context.Context, folderBranch FolderBranch, rev MetadataRevision, p []string) (EntryInfo, error) {
+	ret := _m.ctrl.Call(_m, "GetArchivedEntry", ctx, folderBranch, rev, p)
+	ret0, _ := ret[0].(EntryInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBFSOpsRecorder) GetArchivedEntry(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetArchivedEntry", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockKBFSOps) GetArchivedDirChildren(ctx context.Context, folderBranch FolderBranch, rev MetadataRevision, p []string) (map[string]EntryInfo, error) {
+	ret := _m.ctrl.Call(_m, "GetArchivedDirChildren", ctx, folderBranch, rev, p)
+	ret0, _ := ret[0].(map[string]EntryInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBFSOpsRecorder) GetArchivedDirChildren(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetArchivedDirChildren", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockKBFSOps) ReadArchived(ctx context.Context, folderBranch FolderBranch, rev MetadataRevision, p []string, dest []byte, off int64) (int64, error) {
+	ret := _m.ctrl.Call(_m, "ReadArchived", ctx, folderBranch, rev, p, dest, off)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBFSOpsRecorder) ReadArchived(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ReadArchived", arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+func (_m *MockKBFSOps) GetTlfSettings(ctx context.Context, folderBranch FolderBranch) (TlfSettings, error) {
+	ret := _m.ctrl.Call(_m, "GetTlfSettings", ctx, folderBranch)
+	ret0, _ := ret[0].(TlfSettings)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBFSOpsRecorder) GetTlfSettings(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTlfSettings", arg0, arg1)
+}
+
+func (_m *MockKBFSOps) SetTlfSettings(ctx context.Context, folderBranch FolderBranch, settings TlfSettings) error {
+	ret := _m.ctrl.Call(_m, "SetTlfSettings", ctx, folderBranch, settings)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKBFSOpsRecorder) SetTlfSettings(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetTlfSettings", arg0, arg1, arg2)
+}
+
+func (_m *MockKBFSOps) Lock(ctx context.Context, folderBranch FolderBranch, lockID LockID, wait bool) error {
+	ret := _m.ctrl.Call(_m, "Lock", ctx, folderBranch, lockID, wait)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKBFSOpsRecorder) Lock(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Lock", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockKBFSOps) Unlock(ctx context.Context, folderBranch FolderBranch, lockID LockID) error {
+	ret := _m.ctrl.Call(_m, "Unlock", ctx, folderBranch, lockID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKBFSOpsRecorder) Unlock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Unlock", arg0, arg1, arg2)
+}
+
 func (_m *MockKBFSOps) GetNodeMetadata(ctx context.Context, node Node) (NodeMetadata, error) {
 	ret := _m.ctrl.Call(_m, "GetNodeMetadata", ctx, node)
 	ret0, _ := ret[0].(NodeMetadata)
@@ -789,6 +1125,14 @@ func (_mr *_MockKBFSOpsRecorder) ForceFastForward(arg0 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "ForceFastForward", arg0)
 }
 
+func (_m *MockKBFSOps) KickoffRekeysForUser(ctx context.Context, uid keybase1.UID) {
+	_m.ctrl.Call(_m, "KickoffRekeysForUser", ctx, uid)
+}
+
+func (_mr *_MockKBFSOpsRecorder) KickoffRekeysForUser(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "KickoffRekeysForUser", arg0, arg1)
+}
+
 // Mock of KeybaseService interface
 type MockKeybaseService struct {
 	ctrl     *gomock.Controller
@@ -822,6 +1166,17 @@ func (_mr *_MockKeybaseServiceRecorder) Resolve(arg0, arg1 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Resolve", arg0, arg1)
 }
 
+func (_m *MockKeybaseService) LoadTeam(ctx context.Context, tid keybase1.UID) (TeamInfo, error) {
+	ret := _m.ctrl.Call(_m, "LoadTeam", ctx, tid)
+	ret0, _ := ret[0].(TeamInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKeybaseServiceRecorder) LoadTeam(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "LoadTeam", arg0, arg1)
+}
+
 func (_m *MockKeybaseService) Identify(ctx context.Context, assertion string, reason string) (UserInfo, error) {
 	ret := _m.ctrl.Call(_m, "Identify", ctx, assertion, reason)
 	ret0, _ := ret[0].(UserInfo)
@@ -1258,6 +1613,28 @@ func (_mr *_MockKBPKIRecorder) GetNormalizedUsername(arg0, arg1 interface{}) *go
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetNormalizedUsername", arg0, arg1)
 }
 
+func (_m *MockKBPKI) ResolveUIDs(ctx context.Context, uids []keybase1.UID) (map[keybase1.UID]libkb.NormalizedUsername, error) {
+	ret := _m.ctrl.Call(_m, "ResolveUIDs", ctx, uids)
+	ret0, _ := ret[0].(map[keybase1.UID]libkb.NormalizedUsername)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBPKIRecorder) ResolveUIDs(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ResolveUIDs", arg0, arg1)
+}
+
+func (_m *MockKBPKI) GetTeamInfo(ctx context.Context, tid keybase1.UID) (TeamInfo, error) {
+	ret := _m.ctrl.Call(_m, "GetTeamInfo", ctx, tid)
+	ret0, _ := ret[0].(TeamInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKBPKIRecorder) GetTeamInfo(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTeamInfo", arg0, arg1)
+}
+
 func (_m *MockKBPKI) HasVerifyingKey(ctx context.Context, uid keybase1.UID, verifyingKey kbfscrypto.VerifyingKey, atServerTime time.Time) error {
 	ret := _m.ctrl.Call(_m, "HasVerifyingKey", ctx, uid, verifyingKey, atServerTime)
 	ret0, _ := ret[0].(error)
@@ -1643,6 +2020,18 @@ func (_mr *_MockKeyManagerRecorder) Rekey(arg0, arg1, arg2 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Rekey", arg0, arg1, arg2)
 }
 
+func (_m *MockKeyManager) RotateKey(ctx context.Context, md *RootMetadata) (bool, *kbfscrypto.TLFCryptKey, error) {
+	ret := _m.ctrl.Call(_m, "RotateKey", ctx, md)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(*kbfscrypto.TLFCryptKey)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockKeyManagerRecorder) RotateKey(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RotateKey", arg0, arg1)
+}
+
 // Mock of Reporter interface
 type MockReporter struct {
 	ctrl     *gomock.Controller
@@ -1706,6 +2095,35 @@ func (_mr *_MockReporterRecorder) Shutdown() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Shutdown")
 }
 
+// Mock of UserAlerter interface
+type MockUserAlerter struct {
+	ctrl     *gomock.Controller
+	recorder *_MockUserAlerterRecorder
+}
+
+// Recorder for MockUserAlerter (not exported)
+type _MockUserAlerterRecorder struct {
+	mock *MockUserAlerter
+}
+
+func NewMockUserAlerter(ctrl *gomock.Controller) *MockUserAlerter {
+	mock := &MockUserAlerter{ctrl: ctrl}
+	mock.recorder = &_MockUserAlerterRecorder{mock}
+	return mock
+}
+
+func (_m *MockUserAlerter) EXPECT() *_MockUserAlerterRecorder {
+	return _m.recorder
+}
+
+func (_m *MockUserAlerter) AlertUser(ctx context.Context, alert UserAlert) {
+	_m.ctrl.Call(_m, "AlertUser", ctx, alert)
+}
+
+func (_mr *_MockUserAlerterRecorder) AlertUser(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AlertUser", arg0, arg1)
+}
+
 // Mock of MDCache interface
 type MockMDCache struct {
 	ctrl     *gomock.Controller
@@ -1974,6 +2392,16 @@ func (_mr *_MockBlockCacheRecorder) GetCleanBytesCapacity() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetCleanBytesCapacity")
 }
 
+func (_m *MockBlockCache) Status() BlockCacheStatus {
+	ret := _m.ctrl.Call(_m, "Status")
+	ret0, _ := ret[0].(BlockCacheStatus)
+	return ret0
+}
+
+func (_mr *_MockBlockCacheRecorder) Status() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Status")
+}
+
 // Mock of DirtyBlockCache interface
 type MockDirtyBlockCache struct {
 	ctrl     *gomock.Controller
@@ -2288,6 +2716,30 @@ func (_mr *_MockcryptoPureRecorder) EncryptBlock(arg0, arg1 interface{}) *gomock
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "EncryptBlock", arg0, arg1)
 }
 
+func (_m *MockcryptoPure) EncryptCompressedBlock(block Block, key kbfscrypto.BlockCryptKey, compression BlockCompressionType) (int, EncryptedBlock, error) {
+	ret := _m.ctrl.Call(_m, "EncryptCompressedBlock", block, key, compression)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(EncryptedBlock)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockcryptoPureRecorder) EncryptCompressedBlock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "EncryptCompressedBlock", arg0, arg1, arg2)
+}
+
+func (_m *MockcryptoPure) MakeUnencryptedBlock(block Block, compression BlockCompressionType) (int, EncryptedBlock, error) {
+	ret := _m.ctrl.Call(_m, "MakeUnencryptedBlock", block, compression)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(EncryptedBlock)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockcryptoPureRecorder) MakeUnencryptedBlock(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MakeUnencryptedBlock", arg0, arg1)
+}
+
 func (_m *MockcryptoPure) DecryptBlock(encryptedBlock EncryptedBlock, key kbfscrypto.BlockCryptKey, block Block) error {
 	ret := _m.ctrl.Call(_m, "DecryptBlock", encryptedBlock, key, block)
 	ret0, _ := ret[0].(error)
@@ -2564,6 +3016,30 @@ func (_mr *_MockCryptoRecorder) EncryptBlock(arg0, arg1 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "EncryptBlock", arg0, arg1)
 }
 
+func (_m *MockCrypto) EncryptCompressedBlock(block Block, key kbfscrypto.BlockCryptKey, compression BlockCompressionType) (int, EncryptedBlock, error) {
+	ret := _m.ctrl.Call(_m, "EncryptCompressedBlock", block, key, compression)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(EncryptedBlock)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockCryptoRecorder) EncryptCompressedBlock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "EncryptCompressedBlock", arg0, arg1, arg2)
+}
+
+func (_m *MockCrypto) MakeUnencryptedBlock(block Block, compression BlockCompressionType) (int, EncryptedBlock, error) {
+	ret := _m.ctrl.Call(_m, "MakeUnencryptedBlock", block, compression)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(EncryptedBlock)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockCryptoRecorder) MakeUnencryptedBlock(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MakeUnencryptedBlock", arg0, arg1)
+}
+
 func (_m *MockCrypto) DecryptBlock(encryptedBlock EncryptedBlock, key kbfscrypto.BlockCryptKey, block Block) error {
 	ret := _m.ctrl.Call(_m, "DecryptBlock", encryptedBlock, key, block)
 	ret0, _ := ret[0].(error)
@@ -2888,6 +3364,17 @@ func (_mr *_MockKeyOpsRecorder) GetTLFCryptKeyServerHalf(arg0, arg1, arg2 interf
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFCryptKeyServerHalf", arg0, arg1, arg2)
 }
 
+func (_m *MockKeyOps) GetTLFCryptKeyServerHalves(ctx context.Context, serverHalfIDs []TLFCryptKeyServerHalfID, cryptPublicKey kbfscrypto.CryptPublicKey) ([]kbfscrypto.TLFCryptKeyServerHalf, error) {
+	ret := _m.ctrl.Call(_m, "GetTLFCryptKeyServerHalves", ctx, serverHalfIDs, cryptPublicKey)
+	ret0, _ := ret[0].([]kbfscrypto.TLFCryptKeyServerHalf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKeyOpsRecorder) GetTLFCryptKeyServerHalves(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFCryptKeyServerHalves", arg0, arg1, arg2)
+}
+
 func (_m *MockKeyOps) PutTLFCryptKeyServerHalves(ctx context.Context, keyServerHalves UserDeviceKeyServerHalves) error {
 	ret := _m.ctrl.Call(_m, "PutTLFCryptKeyServerHalves", ctx, keyServerHalves)
 	ret0, _ := ret[0].(error)
@@ -2898,6 +3385,16 @@ func (_mr *_MockKeyOpsRecorder) PutTLFCryptKeyServerHalves(arg0, arg1 interface{
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "PutTLFCryptKeyServerHalves", arg0, arg1)
 }
 
+func (_m *MockKeyOps) PutTLFCryptKeyServerHalvesBatch(ctx context.Context, keyServerHalves []UserDeviceKeyServerHalves) error {
+	ret := _m.ctrl.Call(_m, "PutTLFCryptKeyServerHalvesBatch", ctx, keyServerHalves)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKeyOpsRecorder) PutTLFCryptKeyServerHalvesBatch(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PutTLFCryptKeyServerHalvesBatch", arg0, arg1)
+}
+
 func (_m *MockKeyOps) DeleteTLFCryptKeyServerHalf(ctx context.Context, uid keybase1.UID, kid keybase1.KID, serverHalfID TLFCryptKeyServerHalfID) error {
 	ret := _m.ctrl.Call(_m, "DeleteTLFCryptKeyServerHalf", ctx, uid, kid, serverHalfID)
 	ret0, _ := ret[0].(error)
@@ -3213,6 +3710,26 @@ func (_mr *_MockMDServerRecorder) TruncateUnlock(arg0, arg1 interface{}) *gomock
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "TruncateUnlock", arg0, arg1)
 }
 
+func (_m *MockMDServer) Lock(ctx context.Context, id tlf.ID, lockID LockID) error {
+	ret := _m.ctrl.Call(_m, "Lock", ctx, id, lockID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMDServerRecorder) Lock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Lock", arg0, arg1, arg2)
+}
+
+func (_m *MockMDServer) ReleaseLock(ctx context.Context, id tlf.ID, lockID LockID) error {
+	ret := _m.ctrl.Call(_m, "ReleaseLock", ctx, id, lockID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMDServerRecorder) ReleaseLock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ReleaseLock", arg0, arg1, arg2)
+}
+
 func (_m *MockMDServer) DisableRekeyUpdatesForTesting() {
 	_m.ctrl.Call(_m, "DisableRekeyUpdatesForTesting")
 }
@@ -3250,6 +3767,17 @@ func (_mr *_MockMDServerRecorder) GetLatestHandleForTLF(arg0, arg1 interface{})
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLatestHandleForTLF", arg0, arg1)
 }
 
+func (_m *MockMDServer) GetTLFIDsForCurrentUser(ctx context.Context) ([]tlf.ID, error) {
+	ret := _m.ctrl.Call(_m, "GetTLFIDsForCurrentUser", ctx)
+	ret0, _ := ret[0].([]tlf.ID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMDServerRecorder) GetTLFIDsForCurrentUser(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFIDsForCurrentUser", arg0)
+}
+
 func (_m *MockMDServer) OffsetFromServerTime() (time.Duration, bool) {
 	ret := _m.ctrl.Call(_m, "OffsetFromServerTime")
 	ret0, _ := ret[0].(time.Duration)
@@ -3407,6 +3935,26 @@ func (_mr *_MockmdServerLocalRecorder) TruncateUnlock(arg0, arg1 interface{}) *g
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "TruncateUnlock", arg0, arg1)
 }
 
+func (_m *MockmdServerLocal) Lock(ctx context.Context, id tlf.ID, lockID LockID) error {
+	ret := _m.ctrl.Call(_m, "Lock", ctx, id, lockID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockmdServerLocalRecorder) Lock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Lock", arg0, arg1, arg2)
+}
+
+func (_m *MockmdServerLocal) ReleaseLock(ctx context.Context, id tlf.ID, lockID LockID) error {
+	ret := _m.ctrl.Call(_m, "ReleaseLock", ctx, id, lockID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockmdServerLocalRecorder) ReleaseLock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ReleaseLock", arg0, arg1, arg2)
+}
+
 func (_m *MockmdServerLocal) DisableRekeyUpdatesForTesting() {
 	_m.ctrl.Call(_m, "DisableRekeyUpdatesForTesting")
 }
@@ -3444,6 +3992,17 @@ func (_mr *_MockmdServerLocalRecorder) GetLatestHandleForTLF(arg0, arg1 interfac
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLatestHandleForTLF", arg0, arg1)
 }
 
+func (_m *MockmdServerLocal) GetTLFIDsForCurrentUser(ctx context.Context) ([]tlf.ID, error) {
+	ret := _m.ctrl.Call(_m, "GetTLFIDsForCurrentUser", ctx)
+	ret0, _ := ret[0].([]tlf.ID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockmdServerLocalRecorder) GetTLFIDsForCurrentUser(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFIDsForCurrentUser", arg0)
+}
+
 func (_m *MockmdServerLocal) OffsetFromServerTime() (time.Duration, bool) {
 	ret := _m.ctrl.Call(_m, "OffsetFromServerTime")
 	ret0, _ := ret[0].(time.Duration)
@@ -3488,6 +4047,16 @@ func (_mr *_MockmdServerLocalRecorder) getCurrentMergedHeadRevision(arg0, arg1 i
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "getCurrentMergedHeadRevision", arg0, arg1)
 }
 
+func (_m *MockmdServerLocal) TruncateHistoryAfter(ctx context.Context, id tlf.ID, rev MetadataRevision) error {
+	ret := _m.ctrl.Call(_m, "TruncateHistoryAfter", ctx, id, rev)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockmdServerLocalRecorder) TruncateHistoryAfter(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "TruncateHistoryAfter", arg0, arg1, arg2)
+}
+
 func (_m *MockmdServerLocal) isShutdown() bool {
 	ret := _m.ctrl.Call(_m, "isShutdown")
 	ret0, _ := ret[0].(bool)
@@ -3620,6 +4189,17 @@ func (_mr *_MockBlockServerRecorder) GetUserQuotaInfo(arg0 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUserQuotaInfo", arg0)
 }
 
+func (_m *MockBlockServer) GetTLFUsageInfo(ctx context.Context, tlfID tlf.ID) (*kbfsblock.UsageStat, error) {
+	ret := _m.ctrl.Call(_m, "GetTLFUsageInfo", ctx, tlfID)
+	ret0, _ := ret[0].(*kbfsblock.UsageStat)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockBlockServerRecorder) GetTLFUsageInfo(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFUsageInfo", arg0, arg1)
+}
+
 // Mock of blockServerLocal interface
 type MockblockServerLocal struct {
 	ctrl     *gomock.Controller
@@ -3732,6 +4312,17 @@ func (_mr *_MockblockServerLocalRecorder) GetUserQuotaInfo(arg0 interface{}) *go
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetUserQuotaInfo", arg0)
 }
 
+func (_m *MockblockServerLocal) GetTLFUsageInfo(ctx context.Context, tlfID tlf.ID) (*kbfsblock.UsageStat, error) {
+	ret := _m.ctrl.Call(_m, "GetTLFUsageInfo", ctx, tlfID)
+	ret0, _ := ret[0].(*kbfsblock.UsageStat)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockblockServerLocalRecorder) GetTLFUsageInfo(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFUsageInfo", arg0, arg1)
+}
+
 func (_m *MockblockServerLocal) getAllRefsForTest(ctx context.Context, tlfID tlf.ID) (map[kbfsblock.ID]blockRefMap, error) {
 	ret := _m.ctrl.Call(_m, "getAllRefsForTest", ctx, tlfID)
 	ret0, _ := ret[0].(map[kbfsblock.ID]blockRefMap)
@@ -3836,6 +4427,17 @@ func (_mr *_MockKeyServerRecorder) GetTLFCryptKeyServerHalf(arg0, arg1, arg2 int
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFCryptKeyServerHalf", arg0, arg1, arg2)
 }
 
+func (_m *MockKeyServer) GetTLFCryptKeyServerHalves(ctx context.Context, serverHalfIDs []TLFCryptKeyServerHalfID, cryptPublicKey kbfscrypto.CryptPublicKey) ([]kbfscrypto.TLFCryptKeyServerHalf, error) {
+	ret := _m.ctrl.Call(_m, "GetTLFCryptKeyServerHalves", ctx, serverHalfIDs, cryptPublicKey)
+	ret0, _ := ret[0].([]kbfscrypto.TLFCryptKeyServerHalf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockKeyServerRecorder) GetTLFCryptKeyServerHalves(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFCryptKeyServerHalves", arg0, arg1, arg2)
+}
+
 func (_m *MockKeyServer) PutTLFCryptKeyServerHalves(ctx context.Context, keyServerHalves UserDeviceKeyServerHalves) error {
 	ret := _m.ctrl.Call(_m, "PutTLFCryptKeyServerHalves", ctx, keyServerHalves)
 	ret0, _ := ret[0].(error)
@@ -3846,6 +4448,16 @@ func (_mr *_MockKeyServerRecorder) PutTLFCryptKeyServerHalves(arg0, arg1 interfa
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "PutTLFCryptKeyServerHalves", arg0, arg1)
 }
 
+func (_m *MockKeyServer) PutTLFCryptKeyServerHalvesBatch(ctx context.Context, keyServerHalves []UserDeviceKeyServerHalves) error {
+	ret := _m.ctrl.Call(_m, "PutTLFCryptKeyServerHalvesBatch", ctx, keyServerHalves)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockKeyServerRecorder) PutTLFCryptKeyServerHalvesBatch(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PutTLFCryptKeyServerHalvesBatch", arg0, arg1)
+}
+
 func (_m *MockKeyServer) DeleteTLFCryptKeyServerHalf(ctx context.Context, uid keybase1.UID, kid keybase1.KID, serverHalfID TLFCryptKeyServerHalfID) error {
 	ret := _m.ctrl.Call(_m, "DeleteTLFCryptKeyServerHalf", ctx, uid, kid, serverHalfID)
 	ret0, _ := ret[0].(error)
@@ -3950,6 +4562,38 @@ func (_mr *_MockNotifierRecorder) UnregisterFromChanges(arg0, arg1 interface{})
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "UnregisterFromChanges", arg0, arg1)
 }
 
+func (_m *MockNotifier) RegisterForFavoritesChanges(obs FavoritesObserver) {
+	_m.ctrl.Call(_m, "RegisterForFavoritesChanges", obs)
+}
+
+func (_mr *_MockNotifierRecorder) RegisterForFavoritesChanges(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RegisterForFavoritesChanges", arg0)
+}
+
+func (_m *MockNotifier) UnregisterFromFavoritesChanges(obs FavoritesObserver) {
+	_m.ctrl.Call(_m, "UnregisterFromFavoritesChanges", obs)
+}
+
+func (_mr *_MockNotifierRecorder) UnregisterFromFavoritesChanges(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UnregisterFromFavoritesChanges", arg0)
+}
+
+func (_m *MockNotifier) RegisterForSyncStateChanges(obs SyncStateObserver) {
+	_m.ctrl.Call(_m, "RegisterForSyncStateChanges", obs)
+}
+
+func (_mr *_MockNotifierRecorder) RegisterForSyncStateChanges(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RegisterForSyncStateChanges", arg0)
+}
+
+func (_m *MockNotifier) UnregisterFromSyncStateChanges(obs SyncStateObserver) {
+	_m.ctrl.Call(_m, "UnregisterFromSyncStateChanges", obs)
+}
+
+func (_mr *_MockNotifierRecorder) UnregisterFromSyncStateChanges(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UnregisterFromSyncStateChanges", arg0)
+}
+
 // Mock of Clock interface
 type MockClock struct {
 	ctrl     *gomock.Controller
@@ -4104,6 +4748,216 @@ func (_mr *_MockConfigRecorder) keyGetter() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "keyGetter")
 }
 
+func (_m *MockConfig) BlockCompression() BlockCompressionType {
+	ret := _m.ctrl.Call(_m, "BlockCompression")
+	ret0, _ := ret[0].(BlockCompressionType)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) BlockCompression() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "BlockCompression")
+}
+
+func (_m *MockConfig) SetBlockCompression(_param0 BlockCompressionType) {
+	_m.ctrl.Call(_m, "SetBlockCompression", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetBlockCompression(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetBlockCompression", arg0)
+}
+
+func (_m *MockConfig) PublicBlocksUnencrypted() bool {
+	ret := _m.ctrl.Call(_m, "PublicBlocksUnencrypted")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) PublicBlocksUnencrypted() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PublicBlocksUnencrypted")
+}
+
+func (_m *MockConfig) SetPublicBlocksUnencrypted(_param0 bool) {
+	_m.ctrl.Call(_m, "SetPublicBlocksUnencrypted", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetPublicBlocksUnencrypted(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetPublicBlocksUnencrypted", arg0)
+}
+
+func (_m *MockConfig) BlockRetryPolicy() BlockRetryPolicy {
+	ret := _m.ctrl.Call(_m, "BlockRetryPolicy")
+	ret0, _ := ret[0].(BlockRetryPolicy)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) BlockRetryPolicy() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "BlockRetryPolicy")
+}
+
+func (_m *MockConfig) SetBlockRetryPolicy(_param0 BlockRetryPolicy) {
+	_m.ctrl.Call(_m, "SetBlockRetryPolicy", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetBlockRetryPolicy(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetBlockRetryPolicy", arg0)
+}
+
+func (_m *MockConfig) BlockBandwidthLimits() BlockBandwidthLimits {
+	ret := _m.ctrl.Call(_m, "BlockBandwidthLimits")
+	ret0, _ := ret[0].(BlockBandwidthLimits)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) BlockBandwidthLimits() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "BlockBandwidthLimits")
+}
+
+func (_m *MockConfig) SetBlockBandwidthLimits(_param0 BlockBandwidthLimits) {
+	_m.ctrl.Call(_m, "SetBlockBandwidthLimits", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetBlockBandwidthLimits(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetBlockBandwidthLimits", arg0)
+}
+
+func (_m *MockConfig) ServerTLSConfig() *tls.Config {
+	ret := _m.ctrl.Call(_m, "ServerTLSConfig")
+	ret0, _ := ret[0].(*tls.Config)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) ServerTLSConfig() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ServerTLSConfig")
+}
+
+func (_m *MockConfig) SetServerTLSConfig(_param0 *tls.Config) {
+	_m.ctrl.Call(_m, "SetServerTLSConfig", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetServerTLSConfig(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetServerTLSConfig", arg0)
+}
+
+func (_m *MockConfig) ReadAhead() ReadAheadConfig {
+	ret := _m.ctrl.Call(_m, "ReadAhead")
+	ret0, _ := ret[0].(ReadAheadConfig)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) ReadAhead() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ReadAhead")
+}
+
+func (_m *MockConfig) SetReadAhead(_param0 ReadAheadConfig) {
+	_m.ctrl.Call(_m, "SetReadAhead", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetReadAhead(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetReadAhead", arg0)
+}
+
+func (_m *MockConfig) CacheLimits() CacheLimits {
+	ret := _m.ctrl.Call(_m, "CacheLimits")
+	ret0, _ := ret[0].(CacheLimits)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) CacheLimits() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CacheLimits")
+}
+
+func (_m *MockConfig) SetCacheLimits(_param0 CacheLimits) {
+	_m.ctrl.Call(_m, "SetCacheLimits", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetCacheLimits(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetCacheLimits", arg0)
+}
+
+func (_m *MockConfig) JournalLimits() JournalLimits {
+	ret := _m.ctrl.Call(_m, "JournalLimits")
+	ret0, _ := ret[0].(JournalLimits)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) JournalLimits() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "JournalLimits")
+}
+
+func (_m *MockConfig) SetJournalLimits(_param0 JournalLimits) {
+	_m.ctrl.Call(_m, "SetJournalLimits", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetJournalLimits(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetJournalLimits", arg0)
+}
+
+func (_m *MockConfig) blockTransferTracker() *blockTransferTracker {
+	ret := _m.ctrl.Call(_m, "blockTransferTracker")
+	ret0, _ := ret[0].(*blockTransferTracker)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) blockTransferTracker() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "blockTransferTracker")
+}
+
+func (_m *MockConfig) tlfSyncCache() *tlfSyncCache {
+	ret := _m.ctrl.Call(_m, "tlfSyncCache")
+	ret0, _ := ret[0].(*tlfSyncCache)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) tlfSyncCache() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "tlfSyncCache")
+}
+
+func (_m *MockConfig) tlfActivityLog() *tlfActivityLog {
+	ret := _m.ctrl.Call(_m, "tlfActivityLog")
+	ret0, _ := ret[0].(*tlfActivityLog)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) tlfActivityLog() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "tlfActivityLog")
+}
+
+func (_m *MockConfig) BlockTransferObserver() BlockTransferObserver {
+	ret := _m.ctrl.Call(_m, "BlockTransferObserver")
+	ret0, _ := ret[0].(BlockTransferObserver)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) BlockTransferObserver() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "BlockTransferObserver")
+}
+
+func (_m *MockConfig) SetBlockTransferObserver(_param0 BlockTransferObserver) {
+	_m.ctrl.Call(_m, "SetBlockTransferObserver", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetBlockTransferObserver(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetBlockTransferObserver", arg0)
+}
+
+func (_m *MockConfig) MaxParallelBlockPuts() int {
+	ret := _m.ctrl.Call(_m, "MaxParallelBlockPuts")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) MaxParallelBlockPuts() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "MaxParallelBlockPuts")
+}
+
+func (_m *MockConfig) SetMaxParallelBlockPuts(_param0 int) {
+	_m.ctrl.Call(_m, "SetMaxParallelBlockPuts", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetMaxParallelBlockPuts(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetMaxParallelBlockPuts", arg0)
+}
+
 func (_m *MockConfig) KBFSOps() KBFSOps {
 	ret := _m.ctrl.Call(_m, "KBFSOps")
 	ret0, _ := ret[0].(KBFSOps)
@@ -4176,6 +5030,24 @@ func (_mr *_MockConfigRecorder) SetReporter(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetReporter", arg0)
 }
 
+func (_m *MockConfig) UserAlerter() UserAlerter {
+	ret := _m.ctrl.Call(_m, "UserAlerter")
+	ret0, _ := ret[0].(UserAlerter)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) UserAlerter() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "UserAlerter")
+}
+
+func (_m *MockConfig) SetUserAlerter(_param0 UserAlerter) {
+	_m.ctrl.Call(_m, "SetUserAlerter", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetUserAlerter(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetUserAlerter", arg0)
+}
+
 func (_m *MockConfig) MDCache() MDCache {
 	ret := _m.ctrl.Call(_m, "MDCache")
 	ret0, _ := ret[0].(MDCache)
@@ -4664,6 +5536,42 @@ func (_mr *_MockConfigRecorder) SetTLFValidDuration(arg0 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetTLFValidDuration", arg0)
 }
 
+func (_m *MockConfig) IdentityCacheTTL() time.Duration {
+	ret := _m.ctrl.Call(_m, "IdentityCacheTTL")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) IdentityCacheTTL() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "IdentityCacheTTL")
+}
+
+func (_m *MockConfig) NotificationDebounce() time.Duration {
+	ret := _m.ctrl.Call(_m, "NotificationDebounce")
+	ret0, _ := ret[0].(time.Duration)
+	return ret0
+}
+
+func (_mr *_MockConfigRecorder) NotificationDebounce() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "NotificationDebounce")
+}
+
+func (_m *MockConfig) SetNotificationDebounce(_param0 time.Duration) {
+	_m.ctrl.Call(_m, "SetNotificationDebounce", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetNotificationDebounce(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetNotificationDebounce", arg0)
+}
+
+func (_m *MockConfig) SetIdentityCacheTTL(_param0 time.Duration) {
+	_m.ctrl.Call(_m, "SetIdentityCacheTTL", _param0)
+}
+
+func (_mr *_MockConfigRecorder) SetIdentityCacheTTL(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetIdentityCacheTTL", arg0)
+}
+
 func (_m *MockConfig) Shutdown(_param0 context.Context) error {
 	ret := _m.ctrl.Call(_m, "Shutdown", _param0)
 	ret0, _ := ret[0].(error)
@@ -5111,14 +6019,14 @@ func (_mr *_MockBareRootMetadataRecorder) GetTLFCryptKeyParams(arg0, arg1, arg2,
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFCryptKeyParams", arg0, arg1, arg2, arg3)
 }
 
-func (_m *MockBareRootMetadata) IsValidAndSigned(codec kbfscodec.Codec, crypto cryptoPure, extra ExtraMetadata) error {
-	ret := _m.ctrl.Call(_m, "IsValidAndSigned", codec, crypto, extra)
+func (_m *MockBareRootMetadata) IsValidAndSigned(ctx context.Context, codec kbfscodec.Codec, crypto cryptoPure, teamGetter teamInfoGetter, extra ExtraMetadata) error {
+	ret := _m.ctrl.Call(_m, "IsValidAndSigned", ctx, codec, crypto, teamGetter, extra)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockBareRootMetadataRecorder) IsValidAndSigned(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "IsValidAndSigned", arg0, arg1, arg2)
+func (_mr *_MockBareRootMetadataRecorder) IsValidAndSigned(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "IsValidAndSigned", arg0, arg1, arg2, arg3, arg4)
 }
 
 func (_m *MockBareRootMetadata) IsLastModifiedBy(uid keybase1.UID, key kbfscrypto.VerifyingKey) error {
@@ -5527,14 +6435,14 @@ func (_mr *_MockMutableBareRootMetadataRecorder) GetTLFCryptKeyParams(arg0, arg1
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTLFCryptKeyParams", arg0, arg1, arg2, arg3)
 }
 
-func (_m *MockMutableBareRootMetadata) IsValidAndSigned(codec kbfscodec.Codec, crypto cryptoPure, extra ExtraMetadata) error {
-	ret := _m.ctrl.Call(_m, "IsValidAndSigned", codec, crypto, extra)
+func (_m *MockMutableBareRootMetadata) IsValidAndSigned(ctx context.Context, codec kbfscodec.Codec, crypto cryptoPure, teamGetter teamInfoGetter, extra ExtraMetadata) error {
+	ret := _m.ctrl.Call(_m, "IsValidAndSigned", ctx, codec, crypto, teamGetter, extra)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockMutableBareRootMetadataRecorder) IsValidAndSigned(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "IsValidAndSigned", arg0, arg1, arg2)
+func (_mr *_MockMutableBareRootMetadataRecorder) IsValidAndSigned(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "IsValidAndSigned", arg0, arg1, arg2, arg3, arg4)
 }
 
 func (_m *MockMutableBareRootMetadata) IsLastModifiedBy(uid keybase1.UID, key kbfscrypto.VerifyingKey) error {
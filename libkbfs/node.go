@@ -7,6 +7,7 @@ package libkbfs
 import (
 	"fmt"
 	"runtime"
+	"strings"
 )
 
 // nodeCore holds info shared among one or more nodeStandard objects.
@@ -75,3 +76,19 @@ func (n *nodeStandard) GetBasename() string {
 	}
 	return n.core.pathNode.Name
 }
+
+func (n *nodeStandard) GetPathPlaintextSansTlf() (string, bool) {
+	if len(n.core.cachedPath.path) > 0 {
+		// Must be unlinked.
+		return "", false
+	}
+	p := n.core.cache.PathFromNode(n)
+	if len(p.path) == 0 {
+		return "", false
+	}
+	names := make([]string, 0, len(p.path)-1)
+	for _, pn := range p.path[1:] {
+		names = append(names, pn.Name)
+	}
+	return "/" + strings.Join(names, "/"), true
+}
@@ -369,6 +369,31 @@ func TestNodeCachePathFromNode(t *testing.T) {
 	checkNodeCachePath(t, id, branch, path, path2)
 }
 
+// Tests that GetPathPlaintextSansTlf works correctly, including for
+// unlinked nodes.
+func TestNodeCacheGetPathPlaintextSansTlf(t *testing.T) {
+	id := tlf.FakeID(42, false)
+	branch := BranchName("testBranch")
+	ncs, parentNode, _, childNode2, _, path2 :=
+		setupNodeCache(t, id, branch, false)
+
+	if p, ok := parentNode.GetPathPlaintextSansTlf(); !ok || p != "/" {
+		t.Errorf("Unexpected root path: %q, %t", p, ok)
+	}
+	if p, ok := childNode2.GetPathPlaintextSansTlf(); !ok ||
+		p != "/child1/child2" {
+		t.Errorf("Unexpected child path: %q, %t", p, ok)
+	}
+
+	childPtr2 := path2[2].BlockPointer
+	if !ncs.Unlink(childPtr2.Ref(), ncs.PathFromNode(childNode2)) {
+		t.Fatalf("Couldn't unlink")
+	}
+	if _, ok := childNode2.GetPathPlaintextSansTlf(); ok {
+		t.Errorf("Unexpectedly got a path for an unlinked node")
+	}
+}
+
 // Make sure that (simulated) GC works as expected.
 func TestNodeCacheGCBasic(t *testing.T) {
 	ncs, parentNode, _, childNode2, _, _ :=
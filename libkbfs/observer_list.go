@@ -6,18 +6,37 @@ package libkbfs
 
 import (
 	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 )
 
+// maxNotificationDebounceFactor caps how long a steady stream of
+// remote changes can hold back notifications, as a multiple of the
+// debounce duration.
+const maxNotificationDebounceFactor = 10
+
 // observerList is a thread-safe list of observers.
 type observerList struct {
 	lock      sync.RWMutex
 	observers []Observer
+
+	// debounce, if non-nil, returns how long batchRemoteChanges
+	// waits for more changes before passing them on.
+	debounce func() time.Duration
+
+	pendingLock    sync.Mutex
+	pendingCtx     context.Context
+	pendingChanges []NodeChange
+	pendingSince   time.Time
+	pendingTimer   *time.Timer
+	// pendingGen is bumped every time pending changes are passed
+	// on or dropped, so that stale timers do nothing.
+	pendingGen uint64
 }
 
-func newObserverList() *observerList {
-	return &observerList{}
+func newObserverList(debounce func() time.Duration) *observerList {
+	return &observerList{debounce: debounce}
 }
 
 // It's the caller's responsibility to make sure add isn't called
@@ -57,6 +76,135 @@ func (ol *observerList) batchChanges(
 	}
 }
 
+// batchRemoteChanges is like batchChanges, but for changes made by
+// other devices.  If debouncing is on, it holds the changes back
+// until no more have come in for the debounce duration, coalescing
+// them into one batch, so that a burst of remote revisions doesn't
+// cause a storm of notifications.
+func (ol *observerList) batchRemoteChanges(
+	ctx context.Context, changes []NodeChange) {
+	var debounce time.Duration
+	if ol.debounce != nil {
+		debounce = ol.debounce()
+	}
+	if debounce <= 0 {
+		ol.batchChanges(ctx, changes)
+		return
+	}
+
+	ol.pendingLock.Lock()
+	defer ol.pendingLock.Unlock()
+	if ol.pendingTimer == nil {
+		gen := ol.pendingGen
+		ol.pendingCtx = ctx
+		ol.pendingSince = time.Now()
+		ol.pendingTimer = time.AfterFunc(debounce, func() {
+			ol.flushPendingChanges(gen)
+		})
+	} else if time.Since(ol.pendingSince) <
+		maxNotificationDebounceFactor*debounce {
+		ol.pendingTimer.Reset(debounce)
+	}
+	ol.pendingChanges = coalesceNodeChanges(ol.pendingChanges, changes)
+}
+
+func (ol *observerList) flushPendingChanges(gen uint64) {
+	ctx, changes := func() (context.Context, []NodeChange) {
+		ol.pendingLock.Lock()
+		defer ol.pendingLock.Unlock()
+		if gen != ol.pendingGen {
+			return nil, nil
+		}
+		ctx, changes := ol.pendingCtx, ol.pendingChanges
+		ol.resetPendingLocked()
+		return ctx, changes
+	}()
+	if len(changes) > 0 {
+		ol.batchChanges(ctx, changes)
+	}
+}
+
+func (ol *observerList) resetPendingLocked() {
+	if ol.pendingTimer != nil {
+		ol.pendingTimer.Stop()
+	}
+	ol.pendingCtx = nil
+	ol.pendingChanges = nil
+	ol.pendingTimer = nil
+	ol.pendingGen++
+}
+
+// dropPendingChanges forgets any changes held back by
+// batchRemoteChanges.
+func (ol *observerList) dropPendingChanges() {
+	ol.pendingLock.Lock()
+	defer ol.pendingLock.Unlock()
+	ol.resetPendingLocked()
+}
+
+type nodeChangeKind int
+
+const (
+	nodeChangeAttr nodeChangeKind = iota
+	nodeChangeDir
+	nodeChangeFile
+)
+
+type nodeChangeKey struct {
+	id   NodeID
+	kind nodeChangeKind
+}
+
+func getNodeChangeKey(c NodeChange) nodeChangeKey {
+	kind := nodeChangeAttr
+	switch {
+	case len(c.DirUpdated) > 0:
+		kind = nodeChangeDir
+	case len(c.FileUpdated) > 0:
+		kind = nodeChangeFile
+	}
+	return nodeChangeKey{c.Node.GetID(), kind}
+}
+
+// coalesceNodeChanges merges newChanges into changes, so that there
+// is at most one NodeChange of each kind (directory entries, file
+// contents, or attributes) per node.
+func coalesceNodeChanges(changes, newChanges []NodeChange) []NodeChange {
+	indices := make(map[nodeChangeKey]int, len(changes))
+	for i, c := range changes {
+		indices[getNodeChangeKey(c)] = i
+	}
+	for _, c := range newChanges {
+		key := getNodeChangeKey(c)
+		i, ok := indices[key]
+		if !ok {
+			indices[key] = len(changes)
+			changes = append(changes, NodeChange{
+				Node:        c.Node,
+				DirUpdated:  append([]string(nil), c.DirUpdated...),
+				FileUpdated: append([]WriteRange(nil), c.FileUpdated...),
+			})
+			continue
+		}
+		for _, name := range c.DirUpdated {
+			if !stringInSlice(name, changes[i].DirUpdated) {
+				changes[i].DirUpdated = append(changes[i].DirUpdated, name)
+			}
+		}
+		changes[i].FileUpdated = append(changes[i].FileUpdated, c.FileUpdated...)
+	}
+	return changes
+}
+
+func stringInSlice(s string, ss []string) bool {
+	for _, t := range ss {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
+
 func (ol *observerList) tlfHandleChange(
 	ctx context.Context, newHandle *TlfHandle) {
 	ol.lock.RLock()
@@ -0,0 +1,87 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+type batchChangesObserver struct {
+	c chan []NodeChange
+}
+
+func (o batchChangesObserver) LocalChange(
+	ctx context.Context, node Node, write WriteRange) {
+}
+
+func (o batchChangesObserver) BatchChanges(
+	ctx context.Context, changes []NodeChange) {
+	o.c <- changes
+}
+
+func (o batchChangesObserver) TlfHandleChange(
+	ctx context.Context, newHandle *TlfHandle) {
+}
+
+func TestObserverListDebounce(t *testing.T) {
+	ctx := context.Background()
+	_, dirNode, fileNode, _, _, _ :=
+		setupNodeCache(t, tlf.FakeID(1, false), MasterBranch, true)
+
+	debounce := time.Hour
+	ol := newObserverList(func() time.Duration { return debounce })
+	obs := batchChangesObserver{make(chan []NodeChange, 10)}
+	ol.add(obs)
+
+	// A burst of remote changes is held back, and coalesced.
+	ol.batchRemoteChanges(ctx, []NodeChange{
+		{Node: dirNode, DirUpdated: []string{"a"}},
+		{Node: fileNode, FileUpdated: []WriteRange{{Off: 0, Len: 1}}},
+	})
+	ol.batchRemoteChanges(ctx, []NodeChange{
+		{Node: dirNode, DirUpdated: []string{"a", "b"}},
+		{Node: fileNode},
+	})
+	ol.batchRemoteChanges(ctx, []NodeChange{
+		{Node: fileNode, FileUpdated: []WriteRange{{Off: 1, Len: 1}}},
+	})
+	select {
+	case changes := <-obs.c:
+		t.Fatalf("Unexpected early changes: %v", changes)
+	default:
+	}
+
+	// Local changes aren't held back.
+	ol.batchChanges(ctx, []NodeChange{{Node: dirNode}})
+	require.Len(t, <-obs.c, 1)
+
+	ol.flushPendingChanges(ol.pendingGen)
+	changes := <-obs.c
+	require.Len(t, changes, 3)
+	require.Equal(t, []string{"a", "b"}, changes[0].DirUpdated)
+	require.Len(t, changes[1].FileUpdated, 2)
+	require.Equal(t, fileNode, changes[2].Node)
+	require.Len(t, changes[2].FileUpdated, 0)
+
+	// Stale timers don't flush anything.
+	ol.batchRemoteChanges(ctx, []NodeChange{{Node: dirNode}})
+	ol.flushPendingChanges(ol.pendingGen - 1)
+	ol.dropPendingChanges()
+	select {
+	case changes := <-obs.c:
+		t.Fatalf("Unexpected dropped changes: %v", changes)
+	default:
+	}
+
+	// With no debounce, remote changes go out right away.
+	debounce = 0
+	ol.batchRemoteChanges(ctx, []NodeChange{{Node: dirNode}})
+	require.Len(t, <-obs.c, 1)
+}
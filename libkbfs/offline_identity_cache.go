@@ -0,0 +1,267 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"time"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	offlineIdentityUserPrefix      = "u:"
+	offlineIdentityAssertionPrefix = "a:"
+	offlineIdentityIdentifyPrefix  = "i:"
+	offlineIdentitySessionKey      = "s"
+)
+
+// offlineUserEntry is the last-known-good summary of a user's
+// sigchain, as verified by the keybase service.
+type offlineUserEntry struct {
+	Name                   libkb.NormalizedUsername
+	UID                    keybase1.UID
+	VerifyingKeys          []keybase1.KID
+	CryptPublicKeys        []keybase1.KID
+	KIDNames               map[keybase1.KID]string
+	RevokedVerifyingKeys   map[keybase1.KID]keybase1.KeybaseTime
+	RevokedCryptPublicKeys map[keybase1.KID]keybase1.KeybaseTime
+	VerifiedAt             keybase1.Time
+}
+
+// offlineAssertionEntry is the user that an assertion last resolved
+// to, according to the keybase service.
+type offlineAssertionEntry struct {
+	Name       libkb.NormalizedUsername
+	UID        keybase1.UID
+	VerifiedAt keybase1.Time
+}
+
+// offlineIdentifyEntry is the user that an assertion was last
+// successfully identified as by the keybase service, along with the
+// track breaks that identify found. It's kept apart from
+// offlineAssertionEntry, since resolving an assertion doesn't check
+// any proofs.
+type offlineIdentifyEntry struct {
+	Name        libkb.NormalizedUsername
+	UID         keybase1.UID
+	TrackBreaks *keybase1.IdentifyTrackBreaks
+	VerifiedAt  keybase1.Time
+}
+
+// offlineSessionEntry is the last session that the keybase service
+// reported. The session token isn't kept.
+type offlineSessionEntry struct {
+	Name           libkb.NormalizedUsername
+	UID            keybase1.UID
+	CryptPublicKey keybase1.KID
+	VerifyingKey   keybase1.KID
+	VerifiedAt     keybase1.Time
+}
+
+// offlineIdentityCache keeps the identity data that the keybase
+// service has verified on disk, so that it can stand in for the
+// service while it's unreachable. Everything it returns is only
+// last-known-good data; it's never consulted while the service is
+// reachable.
+type offlineIdentityCache struct {
+	codec kbfscodec.Codec
+	db    *levelDB
+}
+
+// newOfflineIdentityCache opens (creating if necessary) the offline
+// identity cache in the given directory.
+func newOfflineIdentityCache(codec kbfscodec.Codec, dirPath string) (
+	*offlineIdentityCache, error) {
+	db, err := openLevelDBFile(dirPath)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"Couldn't open the offline identity cache in %s", dirPath)
+	}
+	return &offlineIdentityCache{codec, db}, nil
+}
+
+func (c *offlineIdentityCache) put(key string, entry interface{}) error {
+	buf, err := c.codec.Encode(entry)
+	if err != nil {
+		return err
+	}
+	return c.db.Put([]byte(key), buf, nil)
+}
+
+// get decodes the entry with the given key into entry, and returns
+// whether there was one.
+func (c *offlineIdentityCache) get(key string, entry interface{}) (
+	bool, error) {
+	buf, err := c.db.Get([]byte(key), nil)
+	if err == leveldb.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	err = c.codec.Decode(buf, entry)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *offlineIdentityCache) putUser(
+	info UserInfo, verifiedAt time.Time) error {
+	entry := offlineUserEntry{
+		Name:     info.Name,
+		UID:      info.UID,
+		KIDNames: info.KIDNames,
+		RevokedVerifyingKeys: make(
+			map[keybase1.KID]keybase1.KeybaseTime,
+			len(info.RevokedVerifyingKeys)),
+		RevokedCryptPublicKeys: make(
+			map[keybase1.KID]keybase1.KeybaseTime,
+			len(info.RevokedCryptPublicKeys)),
+		VerifiedAt: keybase1.ToTime(verifiedAt),
+	}
+	for _, key := range info.VerifyingKeys {
+		entry.VerifyingKeys = append(entry.VerifyingKeys, key.KID())
+	}
+	for _, key := range info.CryptPublicKeys {
+		entry.CryptPublicKeys = append(entry.CryptPublicKeys, key.KID())
+	}
+	for key, t := range info.RevokedVerifyingKeys {
+		entry.RevokedVerifyingKeys[key.KID()] = t
+	}
+	for key, t := range info.RevokedCryptPublicKeys {
+		entry.RevokedCryptPublicKeys[key.KID()] = t
+	}
+	return c.put(offlineIdentityUserPrefix+info.UID.String(), entry)
+}
+
+// getUser returns the last-known-good info of the given user, with
+// LastKnownGoodAt set, and whether there was any.
+func (c *offlineIdentityCache) getUser(uid keybase1.UID) (
+	UserInfo, bool, error) {
+	var entry offlineUserEntry
+	ok, err := c.get(offlineIdentityUserPrefix+uid.String(), &entry)
+	if !ok || err != nil {
+		return UserInfo{}, false, err
+	}
+
+	info := UserInfo{
+		Name:     entry.Name,
+		UID:      entry.UID,
+		KIDNames: entry.KIDNames,
+		RevokedVerifyingKeys: make(
+			map[kbfscrypto.VerifyingKey]keybase1.KeybaseTime,
+			len(entry.RevokedVerifyingKeys)),
+		RevokedCryptPublicKeys: make(
+			map[kbfscrypto.CryptPublicKey]keybase1.KeybaseTime,
+			len(entry.RevokedCryptPublicKeys)),
+		LastKnownGoodAt: keybase1.FromTime(entry.VerifiedAt),
+	}
+	for _, kid := range entry.VerifyingKeys {
+		info.VerifyingKeys = append(
+			info.VerifyingKeys, kbfscrypto.MakeVerifyingKey(kid))
+	}
+	for _, kid := range entry.CryptPublicKeys {
+		info.CryptPublicKeys = append(
+			info.CryptPublicKeys, kbfscrypto.MakeCryptPublicKey(kid))
+	}
+	for kid, t := range entry.RevokedVerifyingKeys {
+		info.RevokedVerifyingKeys[kbfscrypto.MakeVerifyingKey(kid)] = t
+	}
+	for kid, t := range entry.RevokedCryptPublicKeys {
+		info.RevokedCryptPublicKeys[kbfscrypto.MakeCryptPublicKey(kid)] = t
+	}
+	return info, true, nil
+}
+
+// deleteUser forgets the last-known-good info of the given user,
+// e.g. after one of their devices is revoked.
+func (c *offlineIdentityCache) deleteUser(uid keybase1.UID) error {
+	return c.db.Delete([]byte(offlineIdentityUserPrefix+uid.String()), nil)
+}
+
+func (c *offlineIdentityCache) putResolution(assertion string,
+	name libkb.NormalizedUsername, uid keybase1.UID,
+	verifiedAt time.Time) error {
+	return c.put(offlineIdentityAssertionPrefix+assertion,
+		offlineAssertionEntry{name, uid, keybase1.ToTime(verifiedAt)})
+}
+
+// getResolution returns the user that the given assertion last
+// resolved to, when that was verified, and whether it was ever
+// resolved.
+func (c *offlineIdentityCache) getResolution(assertion string) (
+	libkb.NormalizedUsername, keybase1.UID, time.Time, bool, error) {
+	var entry offlineAssertionEntry
+	ok, err := c.get(offlineIdentityAssertionPrefix+assertion, &entry)
+	if !ok || err != nil {
+		return libkb.NormalizedUsername(""), keybase1.UID(""),
+			time.Time{}, false, err
+	}
+	return entry.Name, entry.UID, keybase1.FromTime(entry.VerifiedAt),
+		true, nil
+}
+
+func (c *offlineIdentityCache) putIdentify(assertion string,
+	name libkb.NormalizedUsername, uid keybase1.UID,
+	trackBreaks *keybase1.IdentifyTrackBreaks, verifiedAt time.Time) error {
+	return c.put(offlineIdentityIdentifyPrefix+assertion,
+		offlineIdentifyEntry{
+			name, uid, trackBreaks, keybase1.ToTime(verifiedAt)})
+}
+
+// getIdentify returns the user that the given assertion was last
+// successfully identified as, the track breaks found then, and
+// whether it was ever identified.
+func (c *offlineIdentityCache) getIdentify(assertion string) (
+	keybase1.UID, *keybase1.IdentifyTrackBreaks, bool, error) {
+	var entry offlineIdentifyEntry
+	ok, err := c.get(offlineIdentityIdentifyPrefix+assertion, &entry)
+	if !ok || err != nil {
+		return keybase1.UID(""), nil, false, err
+	}
+	return entry.UID, entry.TrackBreaks, true, nil
+}
+
+func (c *offlineIdentityCache) putSession(
+	s SessionInfo, verifiedAt time.Time) error {
+	return c.put(offlineIdentitySessionKey, offlineSessionEntry{
+		Name:           s.Name,
+		UID:            s.UID,
+		CryptPublicKey: s.CryptPublicKey.KID(),
+		VerifyingKey:   s.VerifyingKey.KID(),
+		VerifiedAt:     keybase1.ToTime(verifiedAt),
+	})
+}
+
+// getSession returns the last session the keybase service reported
+// (without its token), when that was, and whether there was any.
+func (c *offlineIdentityCache) getSession() (
+	SessionInfo, time.Time, bool, error) {
+	var entry offlineSessionEntry
+	ok, err := c.get(offlineIdentitySessionKey, &entry)
+	if !ok || err != nil {
+		return SessionInfo{}, time.Time{}, false, err
+	}
+	return SessionInfo{
+		Name:           entry.Name,
+		UID:            entry.UID,
+		CryptPublicKey: kbfscrypto.MakeCryptPublicKey(entry.CryptPublicKey),
+		VerifyingKey:   kbfscrypto.MakeVerifyingKey(entry.VerifyingKey),
+	}, keybase1.FromTime(entry.VerifiedAt), true, nil
+}
+
+// clearSession forgets the last session, e.g. after a logout.
+func (c *offlineIdentityCache) clearSession() error {
+	return c.db.Delete([]byte(offlineIdentitySessionKey), nil)
+}
+
+func (c *offlineIdentityCache) shutdown() error {
+	return c.db.Close()
+}
@@ -61,6 +61,7 @@ const (
 	resolutionOpCode
 	rekeyOpCode
 	gcOpCode // for deleting old blocks during an MD history truncation
+	settingsOpCode
 )
 
 // blockUpdate represents a block that was updated to have a new
@@ -924,6 +925,8 @@ const (
 	exAttr attrChange = iota
 	mtimeAttr
 	sizeAttr // only used during conflict resolution
+	xattrAttr
+	modeAttr
 )
 
 func (ac attrChange) String() string {
@@ -934,6 +937,10 @@ func (ac attrChange) String() string {
 		return "mtime"
 	case sizeAttr:
 		return "size"
+	case xattrAttr:
+		return "xattr"
+	case modeAttr:
+		return "mode"
 	}
 	return "<invalid attrChange>"
 }
@@ -1015,7 +1022,11 @@ func (sao *setAttrOp) checkConflict(
 	isFile bool) (crAction, error) {
 	switch realMergedOp := mergedOp.(type) {
 	case *setAttrOp:
-		if realMergedOp.Attr == sao.Attr {
+		// Extended attributes and permission bits never
+		// conflict; the unmerged values just replace the merged
+		// ones.
+		if realMergedOp.Attr == sao.Attr && sao.Attr != xattrAttr &&
+			sao.Attr != modeAttr {
 			var symPath string
 			var causedByAttr attrChange
 			if !isFile {
@@ -1203,6 +1214,57 @@ func (gco *GCOp) getDefaultAction(mergedPath path) crAction {
 	return nil
 }
 
+// settingsOp is an op that represents a change to the settings of a
+// TLF. It holds the complete new settings, which are also set in the
+// private metadata of the revision that contains it.
+type settingsOp struct {
+	OpCommon
+
+	Settings TlfSettings `codec:"s"`
+}
+
+func newSettingsOp(settings TlfSettings) *settingsOp {
+	so := &settingsOp{
+		Settings: settings,
+	}
+	return so
+}
+
+func (so *settingsOp) SizeExceptUpdates() uint64 {
+	return 0
+}
+
+func (so *settingsOp) allUpdates() []blockUpdate {
+	return so.Updates
+}
+
+func (so *settingsOp) checkValid() error {
+	if err := so.Settings.checkValid(); err != nil {
+		return err
+	}
+	return so.checkUpdatesValid()
+}
+
+func (so *settingsOp) String() string {
+	return fmt.Sprintf("settings %s", so.Settings)
+}
+
+func (so *settingsOp) StringWithRefs(numRefIndents int) string {
+	res := so.String() + "\n"
+	res += so.stringWithRefs(numRefIndents)
+	return res
+}
+
+func (so *settingsOp) checkConflict(
+	ctx context.Context, renamer ConflictRenamer, mergedOp op,
+	isFile bool) (crAction, error) {
+	return nil, nil
+}
+
+func (so *settingsOp) getDefaultAction(mergedPath path) crAction {
+	return nil
+}
+
 // invertOpForLocalNotifications returns an operation that represents
 // an undoing of the effect of the given op.  These are intended to be
 // used for local notifications only, and would not be useful for
@@ -1252,6 +1314,8 @@ func invertOpForLocalNotifications(oldOp op) (newOp op, err error) {
 		}
 	case *GCOp:
 		newOp = op
+	case *settingsOp:
+		newOp = op
 	}
 
 	// Now reverse all the block updates.  Don't bother with bare Refs
@@ -1291,6 +1355,8 @@ func opPointerizer(iface interface{}) reflect.Value {
 		return reflect.ValueOf(&op)
 	case GCOp:
 		return reflect.ValueOf(&op)
+	case settingsOp:
+		return reflect.ValueOf(&op)
 	}
 }
 
@@ -1304,6 +1370,7 @@ func RegisterOps(codec kbfscodec.Codec) {
 	codec.RegisterType(reflect.TypeOf(resolutionOp{}), resolutionOpCode)
 	codec.RegisterType(reflect.TypeOf(rekeyOp{}), rekeyOpCode)
 	codec.RegisterType(reflect.TypeOf(GCOp{}), gcOpCode)
+	codec.RegisterType(reflect.TypeOf(settingsOp{}), settingsOpCode)
 	codec.RegisterIfaceSliceType(reflect.TypeOf(opsList{}), opsListCode,
 		opPointerizer)
 }
@@ -179,6 +179,8 @@ func opPointerizerFuture(iface interface{}) reflect.Value {
 		return reflect.ValueOf(&op)
 	case gcOpFuture:
 		return reflect.ValueOf(&op)
+	case settingsOpFuture:
+		return reflect.ValueOf(&op)
 	}
 }
 
@@ -191,6 +193,7 @@ func registerOpsFuture(codec kbfscodec.Codec) {
 	codec.RegisterType(reflect.TypeOf(resolutionOpFuture{}), resolutionOpCode)
 	codec.RegisterType(reflect.TypeOf(rekeyOpFuture{}), rekeyOpCode)
 	codec.RegisterType(reflect.TypeOf(gcOpFuture{}), gcOpCode)
+	codec.RegisterType(reflect.TypeOf(settingsOpFuture{}), settingsOpCode)
 	codec.RegisterIfaceSliceType(reflect.TypeOf(opsList{}), opsListCode,
 		opPointerizerFuture)
 }
@@ -470,6 +473,37 @@ func TestGcOpUnknownFields(t *testing.T) {
 	testStructUnknownFields(t, makeFakeGcOpFuture(t))
 }
 
+type settingsOpFuture struct {
+	settingsOp
+	kbfscodec.Extra
+}
+
+func (sof settingsOpFuture) toCurrent() settingsOp {
+	return sof.settingsOp
+}
+
+func (sof settingsOpFuture) ToCurrentStruct() kbfscodec.CurrentStruct {
+	return sof.toCurrent()
+}
+
+func makeFakeSettingsOpFuture(t *testing.T) settingsOpFuture {
+	sof := settingsOpFuture{
+		settingsOp{
+			makeFakeOpCommon(t, false),
+			TlfSettings{
+				SyncEnabled: true,
+				BlockSize:   1 << 16,
+			},
+		},
+		kbfscodec.MakeExtraOrBust("settingsOp", t),
+	}
+	return sof
+}
+
+func TestSettingsOpUnknownFields(t *testing.T) {
+	testStructUnknownFields(t, makeFakeSettingsOpFuture(t))
+}
+
 type testOps struct {
 	Ops []interface{}
 }
@@ -0,0 +1,133 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/net/context"
+)
+
+// makePaperKeys derives the signing and crypt private keys of the
+// paper device with the given phrase, the same way the keybase
+// service does when it provisions a paper key.
+func makePaperKeys(phrase libkb.PaperKeyPhrase) (
+	kbfscrypto.SigningKey, kbfscrypto.CryptPrivateKey, error) {
+	version, err := phrase.Version()
+	if err != nil {
+		return kbfscrypto.SigningKey{}, kbfscrypto.CryptPrivateKey{}, err
+	}
+	if version != libkb.PaperKeyVersion {
+		return kbfscrypto.SigningKey{}, kbfscrypto.CryptPrivateKey{},
+			errors.WithStack(libkb.KeyVersionError{})
+	}
+
+	key, err := scrypt.Key(phrase.Bytes(), nil,
+		libkb.PaperKeyScryptCost, libkb.PaperKeyScryptR,
+		libkb.PaperKeyScryptP, libkb.PaperKeyScryptKeylen)
+	if err != nil {
+		return kbfscrypto.SigningKey{}, kbfscrypto.CryptPrivateKey{}, err
+	}
+	stream := libkb.NewPassphraseStream(key)
+
+	var sigSecret [libkb.NaclSigningKeySecretSize]byte
+	copy(sigSecret[:], stream.EdDSASeed())
+	sigKP, err := libkb.MakeNaclSigningKeyPairFromSecret(sigSecret)
+	if err != nil {
+		return kbfscrypto.SigningKey{}, kbfscrypto.CryptPrivateKey{}, err
+	}
+
+	var dhSecret [libkb.NaclDHKeySecretSize]byte
+	copy(dhSecret[:], stream.DHSeed())
+	dhKP, err := libkb.MakeNaclDHKeyPairFromSecret(dhSecret)
+	if err != nil {
+		return kbfscrypto.SigningKey{}, kbfscrypto.CryptPrivateKey{}, err
+	}
+
+	return kbfscrypto.NewSigningKey(sigKP),
+		kbfscrypto.NewCryptPrivateKey(dhKP), nil
+}
+
+// ReadPaperKeyFile reads a paper key phrase from the given file, and
+// returns the keys derived from it.
+func ReadPaperKeyFile(path string) (
+	kbfscrypto.SigningKey, kbfscrypto.CryptPrivateKey, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return kbfscrypto.SigningKey{}, kbfscrypto.CryptPrivateKey{}, err
+	}
+	signingKey, cryptPrivateKey, err :=
+		makePaperKeys(libkb.NewPaperKeyPhrase(string(buf)))
+	if err != nil {
+		return kbfscrypto.SigningKey{}, kbfscrypto.CryptPrivateKey{},
+			errors.Wrapf(err, "Invalid paper key in %s", path)
+	}
+	return signingKey, cryptPrivateKey, nil
+}
+
+// keybaseServicePaperKey is a KeybaseService that reports the public
+// keys of a paper key as those of the current session, so that KBFS
+// can sign and decrypt with the paper key instead of the device keys
+// held by the keybase service.  The paper key must belong to the
+// logged-in user.
+type keybaseServicePaperKey struct {
+	KeybaseService
+	cryptPublicKey kbfscrypto.CryptPublicKey
+	verifyingKey   kbfscrypto.VerifyingKey
+}
+
+var _ KeybaseService = keybaseServicePaperKey{}
+
+// CurrentSession implements the KeybaseService interface for
+// keybaseServicePaperKey.
+func (k keybaseServicePaperKey) CurrentSession(
+	ctx context.Context, sessionID int) (SessionInfo, error) {
+	session, err := k.KeybaseService.CurrentSession(ctx, sessionID)
+	if err != nil {
+		return SessionInfo{}, err
+	}
+
+	userInfo, err := k.KeybaseService.LoadUserPlusKeys(
+		ctx, session.UID, "")
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	if !userHasPaperKeys(
+		userInfo, k.verifyingKey, k.cryptPublicKey) {
+		return SessionInfo{}, errors.Errorf(
+			"Paper key with verifying key %s isn't a key of user %s",
+			k.verifyingKey, session.Name)
+	}
+
+	session.CryptPublicKey = k.cryptPublicKey
+	session.VerifyingKey = k.verifyingKey
+	return session, nil
+}
+
+// userHasPaperKeys returns whether both of the given keys are
+// current keys of the given user.
+func userHasPaperKeys(userInfo UserInfo,
+	verifyingKey kbfscrypto.VerifyingKey,
+	cryptPublicKey kbfscrypto.CryptPublicKey) bool {
+	hasVerifyingKey := false
+	for _, key := range userInfo.VerifyingKeys {
+		if key == verifyingKey {
+			hasVerifyingKey = true
+			break
+		}
+	}
+	if !hasVerifyingKey {
+		return false
+	}
+	for _, key := range userInfo.CryptPublicKeys {
+		if key == cryptPublicKey {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestMakePaperKeys(t *testing.T) {
+	phrase, err := libkb.MakePaperKeyPhrase(libkb.PaperKeyVersion)
+	require.NoError(t, err)
+	signingKey, cryptPrivateKey, err := makePaperKeys(phrase)
+	require.NoError(t, err)
+
+	// The derivation must be deterministic.
+	signingKey2, cryptPrivateKey2, err := makePaperKeys(phrase)
+	require.NoError(t, err)
+	require.Equal(t, signingKey, signingKey2)
+	require.Equal(t, cryptPrivateKey, cryptPrivateKey2)
+
+	otherPhrase, err := libkb.MakePaperKeyPhrase(libkb.PaperKeyVersion)
+	require.NoError(t, err)
+	otherSigningKey, otherCryptPrivateKey, err := makePaperKeys(otherPhrase)
+	require.NoError(t, err)
+	require.NotEqual(t, signingKey.GetVerifyingKey(),
+		otherSigningKey.GetVerifyingKey())
+	require.NotEqual(t, cryptPrivateKey.GetPublicKey(),
+		otherCryptPrivateKey.GetPublicKey())
+
+	badPhrase, err := libkb.MakePaperKeyPhrase(libkb.PaperKeyVersion + 1)
+	require.NoError(t, err)
+	_, _, err = makePaperKeys(badPhrase)
+	require.Equal(t, libkb.KeyVersionError{}, errors.Cause(err))
+
+	_, _, err = makePaperKeys(libkb.NewPaperKeyPhrase(""))
+	require.Error(t, err)
+}
+
+func TestReadPaperKeyFile(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "paper_key")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	phrase, err := libkb.MakePaperKeyPhrase(libkb.PaperKeyVersion)
+	require.NoError(t, err)
+	signingKey, cryptPrivateKey, err := makePaperKeys(phrase)
+	require.NoError(t, err)
+
+	// Case and extra whitespace shouldn't matter.
+	path := filepath.Join(tempdir, "paperkey")
+	err = ioutil.WriteFile(path, []byte(
+		"  "+strings.ToUpper(phrase.String())+"\n"), 0600)
+	require.NoError(t, err)
+	fileSigningKey, fileCryptPrivateKey, err := ReadPaperKeyFile(path)
+	require.NoError(t, err)
+	require.Equal(t, signingKey, fileSigningKey)
+	require.Equal(t, cryptPrivateKey, fileCryptPrivateKey)
+
+	_, _, err = ReadPaperKeyFile(filepath.Join(tempdir, "missing"))
+	require.True(t, ioutil.IsNotExist(err))
+}
+
+func TestKeybaseServicePaperKey(t *testing.T) {
+	codec := kbfscodec.NewMsgpack()
+	phrase, err := libkb.MakePaperKeyPhrase(libkb.PaperKeyVersion)
+	require.NoError(t, err)
+	signingKey, cryptPrivateKey, err := makePaperKeys(phrase)
+	require.NoError(t, err)
+
+	// The paper key isn't one of alice's keys yet.
+	localUsers := MakeLocalUsers([]libkb.NormalizedUsername{"alice"})
+	uid := localUsers[0].UID
+	daemon := NewKeybaseDaemonMemory(uid, localUsers, codec)
+	service := keybaseServicePaperKey{
+		KeybaseService: daemon,
+		cryptPublicKey: cryptPrivateKey.GetPublicKey(),
+		verifyingKey:   signingKey.GetVerifyingKey(),
+	}
+	ctx := context.Background()
+	_, err = service.CurrentSession(ctx, 0)
+	require.Error(t, err)
+
+	localUsers[0].VerifyingKeys = append(
+		localUsers[0].VerifyingKeys, signingKey.GetVerifyingKey())
+	localUsers[0].CryptPublicKeys = append(
+		localUsers[0].CryptPublicKeys, cryptPrivateKey.GetPublicKey())
+	service.KeybaseService = NewKeybaseDaemonMemory(uid, localUsers, codec)
+	session, err := service.CurrentSession(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, uid, session.UID)
+	require.Equal(t, libkb.NormalizedUsername("alice"), session.Name)
+	require.Equal(t, cryptPrivateKey.GetPublicKey(), session.CryptPublicKey)
+	require.Equal(t, signingKey.GetVerifyingKey(), session.VerifyingKey)
+}
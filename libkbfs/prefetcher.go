@@ -19,13 +19,42 @@ const (
 	fileIndirectBlockPrefetchPriority   int = -100
 	dirEntryPrefetchPriority            int = -200
 	updatePointerPrefetchPriority       int = 0
+	readAheadPrefetchPriority           int = -50
 	defaultPrefetchPriority             int = -1024
+	defaultReadAheadBlockCount          int = 10
 )
 
+// ReadAheadConfig controls how far ahead of a file read KBFS
+// prefetches the following blocks of the file.
+type ReadAheadConfig struct {
+	// Blocks is the number of blocks after the last one read to
+	// prefetch. Zero or less turns read-ahead off.
+	Blocks int
+	// Priority is the retrieval priority of read-ahead requests.
+	// It should stay below defaultOnDemandRequestPriority, so that
+	// blocks that are actually being read are fetched first.
+	Priority int
+}
+
+// DefaultReadAheadConfig returns the read-ahead configuration used
+// unless one is set explicitly.
+func DefaultReadAheadConfig() ReadAheadConfig {
+	return ReadAheadConfig{
+		Blocks:   defaultReadAheadBlockCount,
+		Priority: readAheadPrefetchPriority,
+	}
+}
+
+type readAheadConfigGetter interface {
+	// ReadAhead returns the current read-ahead configuration.
+	ReadAhead() ReadAheadConfig
+}
+
 type prefetcherConfig interface {
 	dataVersioner
 	logMaker
 	blockCacher
+	tlfSyncCacheGetter
 }
 
 type prefetchRequest struct {
@@ -114,6 +143,10 @@ func (p *blockPrefetcher) run() {
 }
 
 func (p *blockPrefetcher) request(priority int, kmd KeyMetadata, ptr BlockPointer, block Block, entryName string) error {
+	if p.config.tlfSyncCache().mode(kmd.TlfID()) == TlfSyncModeExcluded {
+		// Only fetch blocks of excluded TLFs when they're read.
+		return nil
+	}
 	if _, err := p.config.BlockCache().Get(ptr); err == nil {
 		return nil
 	}
@@ -129,8 +162,9 @@ func (p *blockPrefetcher) request(priority int, kmd KeyMetadata, ptr BlockPointe
 }
 
 func (p *blockPrefetcher) prefetchIndirectFileBlock(b *FileBlock, kmd KeyMetadata) {
-	// Prefetch the first <n> indirect block pointers.
-	// TODO: do something smart with subsequent blocks.
+	// Prefetch the first <n> indirect block pointers. Subsequent
+	// blocks are prefetched by read-ahead as the file is read (see
+	// folderBlockOps.readAheadLocked).
 	numIPtrs := len(b.IPtrs)
 	if numIPtrs > defaultIndirectPointerPrefetchCount {
 		numIPtrs = defaultIndirectPointerPrefetchCount
@@ -6,9 +6,13 @@ package libkbfs
 
 import (
 	"context"
+	"os"
 	"testing"
 
+	"github.com/keybase/client/go/logger"
 	"github.com/keybase/go-codec/codec"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfscodec"
 	"github.com/stretchr/testify/require"
 )
 
@@ -28,7 +32,9 @@ func makeRandomDirEntry(t *testing.T, typ EntryType, size uint64, path string) D
 			path,
 			101,
 			102,
+			0,
 		},
+		nil,
 		codec.UnknownFieldSetHandler{},
 	}
 }
@@ -410,3 +416,44 @@ func TestPrefetcherNoRepeatedPrefetch(t *testing.T) {
 	_, err = cache.Get(childPtr)
 	require.EqualError(t, err, NoSuchBlockError{childPtr.ID}.Error())
 }
+
+func TestPrefetcherExcludedTlf(t *testing.T) {
+	t.Log("Test that blocks of excluded TLFs aren't prefetched.")
+	q, bg, config := initPrefetcherTest(t)
+	defer shutdownPrefetcherTest(q)
+
+	tempdir, err := ioutil.TempDir(os.TempDir(), "prefetcher_excluded")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+	config.syncCache, err = makeTlfSyncCache(
+		kbfscodec.NewMsgpack(), logger.NewTestLogger(t), tempdir)
+	require.NoError(t, err)
+	kmd := makeKMD()
+	err = config.syncCache.setMode(kmd.TlfID(), TlfSyncModeExcluded)
+	require.NoError(t, err)
+
+	t.Log("Initialize a direct dir block with an entry pointing to 1 file.")
+	file1 := makeFakeFileBlock(t, true)
+	ptr1 := makeRandomBlockPointer(t)
+	dir1 := &DirBlock{Children: map[string]DirEntry{
+		"a": makeRandomDirEntry(t, File, 60, "a"),
+	}}
+	_, continueCh1 := bg.setBlockToReturn(ptr1, dir1)
+	_, _ = bg.setBlockToReturn(dir1.Children["a"].BlockPointer, file1)
+
+	var block Block = &DirBlock{}
+	ch := q.Request(context.Background(), defaultOnDemandRequestPriority, kmd, ptr1, block, TransientEntry)
+	continueCh1 <- nil
+	err = <-ch
+	require.NoError(t, err)
+	require.Equal(t, dir1, block)
+
+	t.Log("Shutdown the prefetcher and wait until it's done prefetching." +
+		" This shouldn't hang, indicating that no prefetches were triggered.")
+	<-q.Prefetcher().Shutdown()
+	_, err = config.BlockCache().Get(dir1.Children["a"].BlockPointer)
+	require.IsType(t, NoSuchBlockError{}, err)
+}
@@ -100,3 +100,86 @@ func TestRekeyQueueBasic(t *testing.T) {
 		_ = GetRootNodeOrBust(ctx, t, config2Dev2, name, false)
 	}
 }
+
+func TestRekeyQueueKickoffForUser(t *testing.T) {
+	var u1, u2 libkb.NormalizedUsername = "u1", "u2"
+	config1, _, ctx, cancel := kbfsOpsConcurInit(t, u1, u2)
+	defer kbfsConcurTestShutdown(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, u2)
+	defer config2.Shutdown(ctx)
+	_, uid2, err := config2.KBPKI().GetCurrentUserInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// user 1 creates a shared folder, and a file in it
+	name := u1.String() + "," + u2.String()
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, false)
+	_, _, err = config1.KBFSOps().CreateFile(
+		ctx, rootNode1, "a", false, NoExcl)
+	if err != nil {
+		t.Fatalf("Couldn't create file: %v", err)
+	}
+
+	// Create a new device for user 2
+	config2Dev2 := ConfigAsUser(config1, u2)
+	defer config2Dev2.Shutdown(ctx)
+	AddDeviceForLocalUserOrBust(t, config1, uid2)
+	AddDeviceForLocalUserOrBust(t, config2, uid2)
+	devIndex := AddDeviceForLocalUserOrBust(t, config2Dev2, uid2)
+	SwitchDeviceForLocalUserOrBust(t, config2Dev2, devIndex)
+
+	_, err = GetRootNodeForTest(ctx, config2Dev2, name, false)
+	if _, ok := err.(NeedSelfRekeyError); !ok {
+		t.Fatalf("Got unexpected error when reading with new key: %v", err)
+	}
+
+	// user 1 learns about user 2's new device, and should rekey
+	// the folder without being asked to explicitly.
+	config1.KBFSOps().KickoffRekeysForUser(ctx, uid2)
+	if err := config1.RekeyQueue().Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// user 2's new device should be able to read now
+	_ = GetRootNodeOrBust(ctx, t, config2Dev2, name, false)
+}
+
+func TestRekeyQueueKickoffForResolvedAssertion(t *testing.T) {
+	var u1, u2 libkb.NormalizedUsername = "u1", "u2"
+	config1, _, ctx, cancel := kbfsOpsConcurInit(t, u1, u2)
+	defer kbfsConcurTestShutdown(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, u2)
+	defer config2.Shutdown(ctx)
+	_, uid2, err := config2.KBPKI().GetCurrentUserInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// user 1 creates a folder shared with an assertion that user 2
+	// hasn't proven yet, and a file in it
+	name := u1.String() + "," + u2.String() + "@twitter"
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, name, false)
+	_, _, err = config1.KBFSOps().CreateFile(
+		ctx, rootNode1, "a", false, NoExcl)
+	if err != nil {
+		t.Fatalf("Couldn't create file: %v", err)
+	}
+
+	// user 2 proves the assertion
+	AddNewAssertionForTestOrBust(t, config1, u2.String(), "u2@twitter")
+	AddNewAssertionForTestOrBust(t, config2, u2.String(), "u2@twitter")
+
+	// user 1 learns that user 2 changed, and should rekey the
+	// folder without being asked to explicitly.
+	config1.KBFSOps().KickoffRekeysForUser(ctx, uid2)
+	if err := config1.RekeyQueue().Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// user 2 should be able to read now
+	_ = GetRootNodeOrBust(
+		ctx, t, config2, u1.String()+","+u2.String(), false)
+}
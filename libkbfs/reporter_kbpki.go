@@ -28,6 +28,7 @@ const (
 	errorParamRenameOldFilename = "oldFilename"
 	errorParamFoldersCreated    = "foldersCreated"
 	errorParamFolderLimit       = "folderLimit"
+	errorParamConflictedFrom    = "conflictedFrom"
 
 	// error operation modes
 	errorModeRead  = "read"
@@ -94,6 +95,15 @@ func (r *ReporterKBPKI) ReportErr(ctx context.Context,
 	tlfName CanonicalTlfName, public bool, mode ErrorModeType, err error) {
 	r.ReporterSimple.ReportErr(ctx, tlfName, public, mode, err)
 
+	if alertType, ok := userAlertTypeForReportedErr(err); ok {
+		r.config.UserAlerter().AlertUser(ctx, UserAlert{
+			Type:    alertType,
+			TlfName: tlfName,
+			Public:  public,
+			Err:     err,
+		})
+	}
+
 	// Fire off error popups
 	params := make(map[string]string)
 	filename := ""
@@ -320,6 +330,19 @@ func fileRenameNotification(oldFile path, newFile path, writer keybase1.UID,
 	return n
 }
 
+// conflictedCopyNotification creates FSNotifications for conflicted
+// copies that conflict resolution made of files it couldn't merge.
+// The user needs to reconcile the copy with the original by hand.
+func conflictedCopyNotification(original path, copyPath path,
+	writer keybase1.UID, localTime time.Time) *keybase1.FSNotification {
+	n := baseFileEditNotification(copyPath, writer, localTime)
+	n.NotificationType = keybase1.FSNotificationType_FILE_CREATED
+	n.Params = map[string]string{
+		errorParamConflictedFrom: original.CanonicalPathString(),
+	}
+	return n
+}
+
 // connectionNotification creates FSNotifications based on whether
 // or not KBFS is online.
 func connectionNotification(status keybase1.FSStatusCode) *keybase1.FSNotification {
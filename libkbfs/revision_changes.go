@@ -0,0 +1,251 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/keybase/client/go/logger"
+	"golang.org/x/net/context"
+)
+
+// revisionChange is a single change made by a revision, as a path
+// rather than as block pointers.
+type revisionChange struct {
+	Type ChangeEventType
+	Path path
+	// OldPath is the path the entry was renamed from, for
+	// ChangeEventRename.
+	OldPath path
+}
+
+type revisionChangesByPath []revisionChange
+
+func (rcs revisionChangesByPath) Len() int {
+	return len(rcs)
+}
+
+func (rcs revisionChangesByPath) Less(i, j int) bool {
+	pi, pj := rcs[i].Path.String(), rcs[j].Path.String()
+	if pi != pj {
+		return pi < pj
+	}
+	return rcs[i].Type < rcs[j].Type
+}
+
+func (rcs revisionChangesByPath) Swap(i, j int) {
+	rcs[i], rcs[j] = rcs[j], rcs[i]
+}
+
+type renameKey struct {
+	originalParent BlockPointer
+	name           string
+}
+
+// chainPath returns the final path of the given chain, if any of its
+// ops has a valid one.
+func chainPath(chain *crChain) (path, bool) {
+	if chain == nil {
+		return path{}, false
+	}
+	for _, op := range chain.ops {
+		if p := op.getFinalPath(); p.isValid() {
+			return p, true
+		}
+	}
+	return path{}, false
+}
+
+// getRevisionChanges returns the changes made by the single revision
+// rmd of fbo's folder, sorted by path.  It may need to fetch
+// directory blocks to find the paths, so it shouldn't be called with
+// any fbo locks held.
+func getRevisionChanges(ctx context.Context, config Config,
+	log logger.Logger, fbo *folderBranchOps, rmd ImmutableRootMetadata) (
+	[]revisionChange, error) {
+	chains, err := newCRChainsForIRMDs(ctx, config.Codec(),
+		[]ImmutableRootMetadata{rmd}, &fbo.blocks, false)
+	if err != nil {
+		return nil, err
+	}
+	_, err = chains.getPaths(ctx, &fbo.blocks, log, fbo.nodeCache, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Renames are split into an rmOp in the old parent's chain and
+	// a createOp in the new one's; pair them back up.
+	renamesByNew := make(map[renameKey]path)
+	renamedFrom := make(map[renameKey]bool)
+	for _, ri := range chains.renamedOriginals {
+		oldParent, ok := chainPath(chains.byOriginal[ri.originalOldParent])
+		if !ok {
+			continue
+		}
+		renamesByNew[renameKey{ri.originalNewParent, ri.newName}] =
+			oldParent.ChildPathNoPtr(ri.oldName)
+		renamedFrom[renameKey{ri.originalOldParent, ri.oldName}] = true
+	}
+
+	var changes []revisionChange
+	for original, chain := range chains.byOriginal {
+		for _, op := range chain.ops {
+			p := op.getFinalPath()
+			if !p.isValid() {
+				continue
+			}
+			switch realOp := op.(type) {
+			case *createOp:
+				change := revisionChange{
+					Type: ChangeEventCreate,
+					Path: p.ChildPathNoPtr(realOp.NewName),
+				}
+				if realOp.renamed {
+					oldPath, ok := renamesByNew[renameKey{
+						original, realOp.NewName}]
+					if ok {
+						change.Type = ChangeEventRename
+						change.OldPath = oldPath
+					}
+				}
+				changes = append(changes, change)
+			case *rmOp:
+				if renamedFrom[renameKey{original, realOp.OldName}] {
+					continue
+				}
+				changes = append(changes, revisionChange{
+					Type: ChangeEventDelete,
+					Path: p.ChildPathNoPtr(realOp.OldName),
+				})
+			case *syncOp:
+				// The final path is the file's own path.
+				changes = append(changes, revisionChange{
+					Type: ChangeEventWrite,
+					Path: p,
+				})
+			case *setAttrOp:
+				changes = append(changes, revisionChange{
+					Type: ChangeEventAttr,
+					Path: p,
+				})
+			}
+		}
+	}
+	sort.Sort(revisionChangesByPath(changes))
+	return changes, nil
+}
+
+type revisionJob struct {
+	fbo  *folderBranchOps
+	rmds []ImmutableRootMetadata
+}
+
+// revisionQueue calls process, in the background and one at a time,
+// for each new revision handed to revisionsApplied.  If process falls
+// too far behind, new revisions are dropped rather than holding up
+// the folder.
+type revisionQueue struct {
+	log     logger.Logger
+	name    string
+	process func(ctx context.Context, fbo *folderBranchOps,
+		rmd ImmutableRootMetadata) error
+	// ctx is the parent of every process call; cancel aborts the
+	// one in progress, and makes the loop drop the rest.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lock     sync.Mutex
+	queue    chan revisionJob
+	shutdown bool
+	done     chan struct{}
+}
+
+func newRevisionQueue(log logger.Logger, name string, size int,
+	process func(ctx context.Context, fbo *folderBranchOps,
+		rmd ImmutableRootMetadata) error) *revisionQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	rq := &revisionQueue{
+		log:     log,
+		name:    name,
+		process: process,
+		ctx:     ctx,
+		cancel:  cancel,
+		queue:   make(chan revisionJob, size),
+		done:    make(chan struct{}),
+	}
+	go rq.loop()
+	return rq
+}
+
+// revisionsApplied queues up the given new revisions of fbo's folder.
+func (rq *revisionQueue) revisionsApplied(ctx context.Context,
+	fbo *folderBranchOps, rmds []ImmutableRootMetadata) {
+	if len(rmds) == 0 {
+		return
+	}
+	rq.lock.Lock()
+	defer rq.lock.Unlock()
+	if rq.shutdown {
+		return
+	}
+	select {
+	case rq.queue <- revisionJob{fbo, rmds}:
+	default:
+		rq.log.CWarningf(ctx, "The %s queue is full; dropping "+
+			"%d revision(s) of %s", rq.name, len(rmds), fbo.id())
+	}
+}
+
+func (rq *revisionQueue) loop() {
+	defer close(rq.done)
+	dropped := 0
+	for job := range rq.queue {
+		if rq.ctx.Err() != nil {
+			dropped += len(job.rmds)
+			continue
+		}
+		ctx := ctxWithRandomIDReplayable(
+			rq.ctx, CtxFBOIDKey, CtxFBOOpID, rq.log)
+		for i, rmd := range job.rmds {
+			if rq.ctx.Err() != nil {
+				dropped += len(job.rmds) - i
+				break
+			}
+			err := rq.process(ctx, job.fbo, rmd)
+			if err != nil {
+				rq.log.CWarningf(ctx, "Couldn't process revision %d "+
+					"of %s for the %s: %+v",
+					rmd.Revision(), rmd.TlfID(), rq.name, err)
+			}
+		}
+	}
+	if dropped > 0 {
+		rq.log.CDebugf(nil, "Dropped %d queued revision(s) for the %s "+
+			"on shutdown", dropped, rq.name)
+	}
+}
+
+// shutdownAndWait stops taking new revisions, and waits for the
+// queued ones to be processed.
+func (rq *revisionQueue) shutdownAndWait() {
+	func() {
+		rq.lock.Lock()
+		defer rq.lock.Unlock()
+		if rq.shutdown {
+			return
+		}
+		rq.shutdown = true
+		close(rq.queue)
+	}()
+	<-rq.done
+}
+
+// shutdownAndCancel stops taking new revisions, cancels the one being
+// processed, and drops the rest of the queue.
+func (rq *revisionQueue) shutdownAndCancel() {
+	rq.cancel()
+	rq.shutdownAndWait()
+}
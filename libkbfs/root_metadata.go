@@ -75,6 +75,10 @@ type PrivateMetadata struct {
 	// was performed on this TLF.
 	LastGCRevision MetadataRevision `codec:"lgc"`
 
+	// The settings of the TLF as of this revision, or nil for the
+	// defaults.
+	Settings *TlfSettings `codec:"ts,omitempty"`
+
 	codec.UnknownFieldSetHandler
 
 	// When the above Changes field gets unembedded into its own
@@ -390,6 +394,19 @@ func (md *RootMetadata) SetLastGCRevision(rev MetadataRevision) {
 	md.data.LastGCRevision = rev
 }
 
+// TlfSettings returns the settings of the TLF as of this revision.
+func (md *RootMetadata) TlfSettings() TlfSettings {
+	if md.data.Settings == nil {
+		return TlfSettings{}
+	}
+	return *md.data.Settings
+}
+
+// SetTlfSettings sets the settings of the TLF as of this revision.
+func (md *RootMetadata) SetTlfSettings(settings TlfSettings) {
+	md.data.Settings = &settings
+}
+
 // updateFromTlfHandle updates the current RootMetadata's fields to
 // reflect the given handle, which must be the result of running the
 // current handle with ResolveAgain().
@@ -1079,7 +1096,8 @@ func (rmds *RootMetadataSigned) MakeFinalCopy(
 // validated, either by comparing to the current device key (using
 // IsLastModifiedBy), or by checking with KBPKI.
 func (rmds *RootMetadataSigned) IsValidAndSigned(
-	codec kbfscodec.Codec, crypto cryptoPure, extra ExtraMetadata) error {
+	ctx context.Context, codec kbfscodec.Codec, crypto cryptoPure,
+	teamGetter teamInfoGetter, extra ExtraMetadata) error {
 	// Optimization -- if the RootMetadata signature is nil, it
 	// will fail verification.
 	if rmds.SigInfo.IsNil() {
@@ -1091,7 +1109,7 @@ func (rmds *RootMetadataSigned) IsValidAndSigned(
 		return errors.New("Missing WriterMetadata signature")
 	}
 
-	err := rmds.MD.IsValidAndSigned(codec, crypto, extra)
+	err := rmds.MD.IsValidAndSigned(ctx, codec, crypto, teamGetter, extra)
 	if err != nil {
 		return err
 	}
@@ -56,6 +56,7 @@ func makeFakePrivateMetadataFuture(t *testing.T) privateMetadataFuture {
 	resolutionOp := makeFakeResolutionOpFuture(t)
 	rekeyOp := makeFakeRekeyOpFuture(t)
 	gcOp := makeFakeGcOpFuture(t)
+	settingsOp := makeFakeSettingsOpFuture(t)
 
 	pmf := privateMetadataFuture{
 		PrivateMetadata{
@@ -72,10 +73,12 @@ func makeFakePrivateMetadataFuture(t *testing.T) privateMetadataFuture {
 					&resolutionOp,
 					&rekeyOp,
 					&gcOp,
+					&settingsOp,
 				},
 				0,
 			},
 			0,
+			nil,
 			codec.UnknownFieldSetHandler{},
 			BlockChanges{},
 		},
@@ -611,8 +614,8 @@ func TestRootMetadataReaderUpconversionPrivate(t *testing.T) {
 		configReader.Codec(), configReader.Crypto(), configReader.Crypto(),
 		rmd2.bareMd, configReader.Clock().Now())
 	require.NoError(t, err)
-	err = rmds.IsValidAndSigned(configReader.Codec(), configReader.Crypto(),
-		rmd2.extra)
+	err = rmds.IsValidAndSigned(context.Background(), configReader.Codec(),
+		configReader.Crypto(), configReader.KBPKI(), rmd2.extra)
 	require.NoError(t, err)
 }
 
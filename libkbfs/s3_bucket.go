@@ -0,0 +1,259 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+const s3AddrPrefix = "s3:"
+
+// s3RequestTimeout bounds each request to the object store, so that
+// one that stops responding can't hang the server using it forever.
+const s3RequestTimeout = 1 * time.Minute
+
+// defaultS3Region is the region requests are signed for, unless
+// AWS_REGION says otherwise. Most S3-compatible stores ignore it.
+const defaultS3Region = "us-east-1"
+
+// s3Error is returned for any request that an S3-compatible store
+// rejects.
+type s3Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e s3Error) Error() string {
+	return fmt.Sprintf("S3 error %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// isS3NoSuchKey returns whether err says that the requested object
+// doesn't exist.
+func isS3NoSuchKey(err error) bool {
+	s3Err, ok := errors.Cause(err).(s3Error)
+	return ok && s3Err.StatusCode == http.StatusNotFound
+}
+
+// s3Bucket is a minimal client for the objects under a prefix of a
+// bucket on an S3-compatible object store. It uses path-style
+// requests signed with AWS signature version 4, which both S3 and
+// most self-hosted stores accept.
+type s3Bucket struct {
+	client   *http.Client
+	endpoint *url.URL
+	name     string
+	// prefix, if non-empty, is prepended to every key along
+	// with a slash.
+	prefix string
+	signer *aws.V4Signer
+}
+
+func newS3Bucket(client *http.Client, endpoint *url.URL, name, prefix string,
+	auth *aws.Auth, region string) *s3Bucket {
+	return &s3Bucket{
+		client:   client,
+		endpoint: endpoint,
+		name:     name,
+		prefix:   strings.Trim(prefix, "/"),
+		signer:   aws.NewV4Signer(auth, "s3", aws.Region{Name: region}),
+	}
+}
+
+// parseS3Addr parses an address of the form
+// s3:<endpoint URL>/<bucket>[/<prefix>], e.g.
+// s3:https://s3.amazonaws.com/my-bucket/kbfs.
+func parseS3Addr(addr string) (
+	endpoint *url.URL, bucket, prefix string, ok bool) {
+	if !strings.HasPrefix(addr, s3AddrPrefix) {
+		return nil, "", "", false
+	}
+	u, err := url.Parse(addr[len(s3AddrPrefix):])
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, "", "", false
+	}
+	parts := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		return nil, "", "", false
+	}
+	bucket = parts[0]
+	if len(parts) > 1 {
+		prefix = parts[1]
+	}
+	return &url.URL{Scheme: u.Scheme, Host: u.Host}, bucket, prefix, true
+}
+
+// makeS3BucketFromAddr returns an s3Bucket for the given s3: address,
+// if it is one. Credentials are looked up the usual AWS way: from
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, then from
+// ~/.aws/credentials, then from the instance metadata.
+func makeS3BucketFromAddr(addr string) (bucket *s3Bucket, ok bool, err error) {
+	endpoint, name, prefix, ok := parseS3Addr(addr)
+	if !ok {
+		return nil, false, nil
+	}
+	auth, err := aws.GetAuth("", "", "", time.Time{})
+	if err != nil {
+		return nil, true, errors.WithStack(err)
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = defaultS3Region
+	}
+	client := &http.Client{Timeout: s3RequestTimeout}
+	return newS3Bucket(client, endpoint, name, prefix,
+		auth, region), true, nil
+}
+
+// withPrefix returns an s3Bucket for the objects under the given
+// prefix of b.
+func (b *s3Bucket) withPrefix(prefix string) *s3Bucket {
+	bCopy := *b
+	bCopy.prefix = b.fullKey(strings.Trim(prefix, "/"))
+	return &bCopy
+}
+
+func (b *s3Bucket) String() string {
+	return fmt.Sprintf("s3:%s/%s/%s", b.endpoint, b.name, b.prefix)
+}
+
+func (b *s3Bucket) fullKey(key string) string {
+	if b.prefix == "" {
+		return key
+	}
+	return b.prefix + "/" + key
+}
+
+func (b *s3Bucket) do(ctx context.Context, method, key string,
+	query url.Values, body []byte) (*http.Response, error) {
+	u := *b.endpoint
+	u.Path = "/" + b.name + "/"
+	if key != "" {
+		u.Path += key
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	hash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	b.signer.Sign(req)
+	if len(body) == 0 {
+		// Signing replaces the body with a reader of unknown
+		// length, which would make bodyless requests chunked.
+		req.Body = nil
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	s3Err := s3Error{StatusCode: resp.StatusCode}
+	// The body is empty for HEAD requests, and for some errors.
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err == nil {
+		_ = xml.Unmarshal(buf, &s3Err)
+	}
+	return nil, errors.WithStack(s3Err)
+}
+
+// get returns the contents of the object with the given key. The
+// returned error satisfies isS3NoSuchKey if there's no such object.
+func (b *s3Bucket) get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := b.do(ctx, "GET", b.fullKey(key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// put creates or replaces the object with the given key.
+func (b *s3Bucket) put(ctx context.Context, key string, data []byte) error {
+	resp, err := b.do(ctx, "PUT", b.fullKey(key), nil, data)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// delete deletes the object with the given key. It's not an error
+// if there's no such object.
+func (b *s3Bucket) delete(ctx context.Context, key string) error {
+	resp, err := b.do(ctx, "DELETE", b.fullKey(key), nil, nil)
+	if isS3NoSuchKey(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// list returns the keys of all objects whose keys start with the
+// given prefix, relative to the prefix of b, in lexical order.
+func (b *s3Bucket) list(ctx context.Context, prefix string) ([]string, error) {
+	fullPrefix := b.fullKey(prefix)
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", fullPrefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := b.do(ctx, "GET", "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		buf, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListBucketResult
+		err = xml.Unmarshal(buf, &result)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, c := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(
+				c.Key, b.fullKey("")))
+		}
+		if !result.IsTruncated {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// fakeS3Server implements just enough of the S3 API, for a single
+// bucket, to test s3Bucket and everything built on it. It returns
+// at most fakeS3ListPageSize keys per list request, to exercise
+// pagination.
+type fakeS3Server struct {
+	t      *testing.T
+	bucket string
+
+	lock    sync.Mutex
+	objects map[string][]byte
+}
+
+const fakeS3ListPageSize = 2
+
+func (s *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(s.t, err)
+	hash := sha256.Sum256(body)
+	require.Equal(s.t, hex.EncodeToString(hash[:]),
+		r.Header.Get("X-Amz-Content-Sha256"))
+
+	prefix := "/" + s.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := r.URL.Path[len(prefix):]
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch {
+	case r.Method == "GET" && key == "":
+		s.list(w, r.URL.Query())
+	case r.Method == "GET":
+		data, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<Error><Code>NoSuchKey</Code></Error>"))
+			return
+		}
+		w.Write(data)
+	case r.Method == "PUT":
+		s.objects[key] = body
+	case r.Method == "DELETE":
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeS3Server) list(w http.ResponseWriter, query url.Values) {
+	require.Equal(s.t, "2", query.Get("list-type"))
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) &&
+			key > query.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var result s3ListBucketResult
+	if len(keys) > fakeS3ListPageSize {
+		keys = keys[:fakeS3ListPageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		result.Contents = append(result.Contents, struct{ Key string }{key})
+	}
+	buf, err := xml.Marshal(result)
+	require.NoError(s.t, err)
+	w.Write(buf)
+}
+
+func (s *fakeS3Server) numObjects() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.objects)
+}
+
+// makeFakeS3BucketForTest returns an s3Bucket for a new fake S3
+// server, along with the server, which the caller must close.
+func makeFakeS3BucketForTest(t *testing.T) (
+	*s3Bucket, *fakeS3Server, *httptest.Server) {
+	fake := &fakeS3Server{
+		t:       t,
+		bucket:  "test-bucket",
+		objects: make(map[string][]byte),
+	}
+	server := httptest.NewServer(fake)
+	endpoint, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	auth := aws.NewAuth("access key", "secret key", "", time.Time{})
+	bucket := newS3Bucket(server.Client(), endpoint, fake.bucket, "prefix",
+		auth, defaultS3Region)
+	return bucket, fake, server
+}
+
+func TestParseS3Addr(t *testing.T) {
+	endpoint, bucket, prefix, ok :=
+		parseS3Addr("s3:https://s3.example.com:9000/bucket/some/prefix/")
+	require.True(t, ok)
+	require.Equal(t, "https://s3.example.com:9000", endpoint.String())
+	require.Equal(t, "bucket", bucket)
+	require.Equal(t, "some/prefix", prefix)
+
+	_, bucket, prefix, ok = parseS3Addr("s3:http://localhost/bucket")
+	require.True(t, ok)
+	require.Equal(t, "bucket", bucket)
+	require.Equal(t, "", prefix)
+
+	for _, addr := range []string{
+		"dir:/path/to/dir", "s3:", "s3:localhost/bucket",
+		"s3:https://s3.example.com", "s3:https://s3.example.com/",
+	} {
+		_, _, _, ok := parseS3Addr(addr)
+		require.False(t, ok, addr)
+	}
+}
+
+func TestS3Bucket(t *testing.T) {
+	bucket, fake, server := makeFakeS3BucketForTest(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	_, err := bucket.get(ctx, "a")
+	require.True(t, isS3NoSuchKey(err))
+
+	err = bucket.put(ctx, "a", []byte("data a"))
+	require.NoError(t, err)
+	data, err := bucket.get(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, []byte("data a"), data)
+
+	// Empty objects are fine.
+	sub := bucket.withPrefix("sub/")
+	err = sub.put(ctx, "b", nil)
+	require.NoError(t, err)
+	data, err = sub.get(ctx, "b")
+	require.NoError(t, err)
+	require.Len(t, data, 0)
+
+	for _, key := range []string{"c1", "c2", "c3"} {
+		err = sub.put(ctx, key, []byte(key))
+		require.NoError(t, err)
+	}
+	require.Equal(t, 5, fake.numObjects())
+
+	keys, err := sub.list(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "c1", "c2", "c3"}, keys)
+	keys, err = sub.list(ctx, "c")
+	require.NoError(t, err)
+	require.Equal(t, []string{"c1", "c2", "c3"}, keys)
+
+	err = sub.delete(ctx, "c2")
+	require.NoError(t, err)
+	// Deleting a missing object isn't an error.
+	err = sub.delete(ctx, "c2")
+	require.NoError(t, err)
+	keys, err = bucket.list(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "sub/b", "sub/c1", "sub/c3"}, keys)
+}
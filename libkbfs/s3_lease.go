@@ -0,0 +1,160 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// s3LeaseKey is the name of the object that lockS3Prefix keeps under
+// each locked bucket prefix.
+const s3LeaseKey = "LEASE"
+
+// s3LeaseDuration is how long a lease taken by lockS3Prefix lasts
+// without being renewed, e.g. after its server dies.
+const s3LeaseDuration = 1 * time.Minute
+
+// s3Lease is the contents of the lease object.
+type s3Lease struct {
+	Owner   string
+	Expires time.Time
+}
+
+func readS3Lease(ctx context.Context, bucket *s3Bucket) (
+	lease s3Lease, ok bool, err error) {
+	buf, err := bucket.get(ctx, s3LeaseKey)
+	if isS3NoSuchKey(err) {
+		return s3Lease{}, false, nil
+	} else if err != nil {
+		return s3Lease{}, false, err
+	}
+	err = json.Unmarshal(buf, &lease)
+	if err != nil {
+		return s3Lease{}, false, errors.WithStack(err)
+	}
+	return lease, true, nil
+}
+
+func writeS3Lease(ctx context.Context, bucket *s3Bucket, owner string,
+	duration time.Duration) error {
+	buf, err := json.Marshal(s3Lease{
+		Owner:   owner,
+		Expires: time.Now().Add(duration),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return bucket.put(ctx, s3LeaseKey, buf)
+}
+
+func makeS3LeaseOwner() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	nonce := make([]byte, 8)
+	err = kbfscrypto.RandRead(nonce)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%d/%s",
+		hostname, os.Getpid(), hex.EncodeToString(nonce)), nil
+}
+
+// lockS3Prefix takes a lease on the prefix of the given bucket, so
+// that two servers can't use the same bucket storage at once. It
+// returns an S3PrefixInUseError right away if another server holds
+// an unexpired lease. The lease is renewed in the background until
+// unlock is called, and otherwise expires after duration.
+//
+// S3 has no conditional writes, so two servers starting at the same
+// moment might both write the lease; reading it back after writing
+// makes all but the last writer fail, but can't fully rule that out.
+func lockS3Prefix(log logger.Logger, bucket *s3Bucket,
+	duration time.Duration) (unlock func() error, err error) {
+	ctx := context.Background()
+	lease, ok, err := readS3Lease(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if ok && time.Now().Before(lease.Expires) {
+		return nil, errors.WithStack(
+			S3PrefixInUseError{bucket.String(), lease.Owner})
+	}
+
+	owner, err := makeS3LeaseOwner()
+	if err != nil {
+		return nil, err
+	}
+	err = writeS3Lease(ctx, bucket, owner, duration)
+	if err != nil {
+		return nil, err
+	}
+	lease, ok, err = readS3Lease(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || lease.Owner != owner {
+		return nil, errors.WithStack(
+			S3PrefixInUseError{bucket.String(), lease.Owner})
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		renewInterval := duration / 3
+		ticker := time.NewTicker(renewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-stopCh:
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(
+				context.Background(), renewInterval)
+			lease, ok, err := readS3Lease(ctx, bucket)
+			if err == nil && ok && lease.Owner != owner {
+				cancel()
+				log.Error("Lost the lease on %s to %s; only one "+
+					"server may use it at a time", bucket, lease.Owner)
+				return
+			}
+			if err == nil {
+				err = writeS3Lease(ctx, bucket, owner, duration)
+			}
+			cancel()
+			if err != nil {
+				log.Warning("Couldn't renew the lease on %s: %+v",
+					bucket, err)
+			}
+		}
+	}()
+
+	return func() error {
+		close(stopCh)
+		<-doneCh
+		lease, ok, err := readS3Lease(ctx, bucket)
+		if err != nil {
+			return err
+		}
+		if !ok || lease.Owner != owner {
+			// Someone else has it now; leave theirs alone.
+			return nil
+		}
+		return bucket.delete(ctx, s3LeaseKey)
+	}, nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import metrics "github.com/rcrowley/go-metrics"
+
+// measuredCall keeps track of the latencies and the number of
+// failures of one kind of server call. The latency histogram is
+// registered under the given name, and the failure count under the
+// name plus ".Errors".
+type measuredCall struct {
+	timer  metrics.Timer
+	errors metrics.Counter
+}
+
+func makeMeasuredCall(name string, r metrics.Registry) measuredCall {
+	return measuredCall{
+		timer:  metrics.GetOrRegisterTimer(name, r),
+		errors: metrics.GetOrRegisterCounter(name+".Errors", r),
+	}
+}
+
+// time runs f, recording how long it took, and whether it failed.
+func (c measuredCall) time(f func() error) {
+	var err error
+	c.timer.Time(func() {
+		err = f()
+	})
+	if err != nil {
+		c.errors.Inc(1)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+
+	"github.com/keybase/go-framed-msgpack-rpc/rpc"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/pkg/errors"
+)
+
+// certPinPrefix is the prefix of a certificate pin, which is the
+// base64-encoded SHA-256 hash of a certificate's
+// SubjectPublicKeyInfo, as in HTTP public key pinning.
+const certPinPrefix = "sha256/"
+
+type serverTLSConfigGetter interface {
+	// ServerTLSConfig returns the TLS configuration to use for
+	// connections to remote block and metadata servers, or nil to
+	// use the built-in root certificates for each server address.
+	ServerTLSConfig() *tls.Config
+}
+
+func parseCertPin(pin string) ([]byte, error) {
+	if !strings.HasPrefix(pin, certPinPrefix) {
+		return nil, errors.Errorf(
+			"certificate pin %q doesn't start with %q", pin, certPinPrefix)
+	}
+	hash, err := base64.StdEncoding.DecodeString(
+		strings.TrimPrefix(pin, certPinPrefix))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid certificate pin %q", pin)
+	}
+	if len(hash) != sha256.Size {
+		return nil, errors.Errorf(
+			"certificate pin %q is not a SHA-256 hash", pin)
+	}
+	return hash, nil
+}
+
+// MakeServerTLSConfig returns a TLS configuration for connections to
+// remote servers, for deployments that don't use the Keybase
+// servers. If rootCertsPEM is non-empty, server certificates must
+// chain to one of those root certificates instead of the built-in
+// ones for each server address. If pins is non-empty, some certificate in the verified chain
+// must also have a public key matching one of the pins, each of the
+// form "sha256/<base64 SHA-256 of the SubjectPublicKeyInfo>". If
+// both are empty, it returns nil.
+func MakeServerTLSConfig(
+	rootCertsPEM []byte, pins []string) (*tls.Config, error) {
+	if len(rootCertsPEM) == 0 && len(pins) == 0 {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	if len(rootCertsPEM) != 0 {
+		certs := x509.NewCertPool()
+		if !certs.AppendCertsFromPEM(rootCertsPEM) {
+			return nil, errors.New("no valid root certificates found")
+		}
+		config.RootCAs = certs
+	}
+
+	if len(pins) != 0 {
+		hashes := make([][]byte, 0, len(pins))
+		for _, pin := range pins {
+			hash, err := parseCertPin(pin)
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, hash)
+		}
+		config.VerifyPeerCertificate = func(
+			_ [][]byte, chains [][]*x509.Certificate) error {
+			return checkCertPins(chains, hashes)
+		}
+	}
+	return config, nil
+}
+
+// checkCertPins is called after the usual verification, so chains
+// holds only trusted chains.
+func checkCertPins(chains [][]*x509.Certificate, hashes [][]byte) error {
+	for _, chain := range chains {
+		for _, cert := range chain {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, h := range hashes {
+				if bytes.Equal(hash[:], h) {
+					return nil
+				}
+			}
+		}
+	}
+	return errors.New("server certificate doesn't match any pinned key")
+}
+
+// withDefaultRootCerts returns tlsConfig if it has its own root
+// certificates, or a copy of it that uses the built-in root
+// certificates for srvAddr otherwise.  Without this, a configuration
+// with only certificate pins would verify servers against the system
+// root certificates, which don't include the Keybase CAs.
+func withDefaultRootCerts(
+	tlsConfig *tls.Config, srvAddr string) *tls.Config {
+	if tlsConfig.RootCAs != nil {
+		return tlsConfig
+	}
+	certs := x509.NewCertPool()
+	// If this fails, the pool stays empty and no server
+	// certificate will verify.
+	certs.AppendCertsFromPEM(kbfscrypto.GetRootCerts(srvAddr))
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.RootCAs = certs
+	return tlsConfig
+}
+
+// newServerTLSConnection returns a connection to srvAddr that uses
+// tlsConfig if it's non-nil, or the built-in root certificates for
+// srvAddr otherwise.  If tlsConfig has no root certificates of its
+// own, the built-in ones for srvAddr are used with it.
+func newServerTLSConnection(srvAddr string, tlsConfig *tls.Config,
+	errorUnwrapper rpc.ErrorUnwrapper, handler rpc.ConnectionHandler,
+	logFactory rpc.LogFactory, logOutput rpc.LogOutput,
+	opts rpc.ConnectionOpts) *rpc.Connection {
+	if tlsConfig == nil {
+		return rpc.NewTLSConnection(srvAddr,
+			kbfscrypto.GetRootCerts(srvAddr), errorUnwrapper, handler,
+			logFactory, logOutput, opts)
+	}
+	tlsConfig = withDefaultRootCerts(tlsConfig, srvAddr)
+	return rpc.NewTLSConnectionWithTLSConfig(srvAddr, tlsConfig,
+		errorUnwrapper, handler, logFactory, logOutput, opts)
+}
+
+// CertPinsFlag is for specifying a comma-separated list of
+// certificate pins with the flag package.
+type CertPinsFlag struct {
+	v *[]string
+}
+
+// Get for flag interface.
+func (cf CertPinsFlag) Get() interface{} { return *cf.v }
+
+// String for flag interface.
+func (cf CertPinsFlag) String() string {
+	// This happens when isZeroValue() from flag.go makes a zero
+	// value from the type of a flag.
+	if cf.v == nil {
+		return ""
+	}
+	return strings.Join(*cf.v, ",")
+}
+
+// Set for flag interface.
+func (cf CertPinsFlag) Set(raw string) error {
+	var pins []string
+	for _, pin := range strings.Split(raw, ",") {
+		pin = strings.TrimSpace(pin)
+		if len(pin) == 0 {
+			continue
+		}
+		if _, err := parseCertPin(pin); err != nil {
+			return err
+		}
+		pins = append(pins, pin)
+	}
+	*cf.v = pins
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func makeTestCert(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kbfs test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func makeTestCertPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return certPinPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func TestMakeServerTLSConfig(t *testing.T) {
+	tlsConfig, err := MakeServerTLSConfig(nil, nil)
+	require.NoError(t, err)
+	require.Nil(t, tlsConfig)
+
+	cert := makeTestCert(t)
+	certPEM := pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	tlsConfig, err = MakeServerTLSConfig(certPEM, nil)
+	require.NoError(t, err)
+	require.NotNil(t, tlsConfig.RootCAs)
+	require.Nil(t, tlsConfig.VerifyPeerCertificate)
+
+	_, err = MakeServerTLSConfig([]byte("not a cert"), nil)
+	require.Error(t, err)
+	_, err = MakeServerTLSConfig(nil, []string{"md5/abcd"})
+	require.Error(t, err)
+	_, err = MakeServerTLSConfig(nil, []string{certPinPrefix + "YWJjZA=="})
+	require.Error(t, err)
+}
+
+func TestServerTLSConfigCertPins(t *testing.T) {
+	cert := makeTestCert(t)
+	otherCert := makeTestCert(t)
+	chains := [][]*x509.Certificate{{cert}}
+
+	tlsConfig, err := MakeServerTLSConfig(
+		nil, []string{makeTestCertPin(otherCert), makeTestCertPin(cert)})
+	require.NoError(t, err)
+	require.Nil(t, tlsConfig.RootCAs)
+	require.NoError(t, tlsConfig.VerifyPeerCertificate(nil, chains))
+
+	tlsConfig, err = MakeServerTLSConfig(
+		nil, []string{makeTestCertPin(otherCert)})
+	require.NoError(t, err)
+	require.Error(t, tlsConfig.VerifyPeerCertificate(nil, chains))
+}
+
+func TestServerTLSConfigDefaultRootCerts(t *testing.T) {
+	cert := makeTestCert(t)
+	tlsConfig, err := MakeServerTLSConfig(
+		nil, []string{makeTestCertPin(cert)})
+	require.NoError(t, err)
+
+	// With only pins, the built-in root certificates are used,
+	// without modifying the shared configuration.
+	withRoots := withDefaultRootCerts(tlsConfig, "kbfs.keybase.io:443")
+	require.NotNil(t, withRoots.RootCAs)
+	require.NotNil(t, withRoots.VerifyPeerCertificate)
+	require.Nil(t, tlsConfig.RootCAs)
+
+	certPEM := pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	tlsConfig, err = MakeServerTLSConfig(
+		certPEM, []string{makeTestCertPin(cert)})
+	require.NoError(t, err)
+	require.True(t, tlsConfig ==
+		withDefaultRootCerts(tlsConfig, "kbfs.keybase.io:443"))
+}
+
+func TestCertPinsFlag(t *testing.T) {
+	cert := makeTestCert(t)
+	pin := makeTestCertPin(cert)
+	var pins []string
+	f := CertPinsFlag{&pins}
+	require.NoError(t, f.Set(pin+", "+pin))
+	require.Equal(t, []string{pin, pin}, pins)
+	require.Equal(t, pin+","+pin, f.String())
+	require.Error(t, f.Set("bogus"))
+}
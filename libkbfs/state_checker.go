@@ -58,6 +58,11 @@ func (sc *StateChecker) findAllBlocksInPath(ctx context.Context,
 		return err
 	}
 
+	// The child blocks of an indirect directory.
+	for _, iptr := range dblock.IPtrs {
+		blockSizes[iptr.BlockPointer] = iptr.EncodedSize
+	}
+
 	for name, de := range dblock.Children {
 		if de.Type == Sym {
 			continue
@@ -0,0 +1,66 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// symmetricCipher is an authenticated symmetric encryption scheme
+// with 32-byte keys, which is used to encrypt blocks, private
+// metadata, and other data keyed by a TLF or block crypt key.
+type symmetricCipher interface {
+	// nonceSize returns the length in bytes of the nonces that
+	// seal and open take.
+	nonceSize() int
+	// seal encrypts and authenticates data.
+	seal(data, nonce []byte, key [32]byte) []byte
+	// open authenticates and decrypts data sealed with the same
+	// nonce and key, and returns false if that fails.
+	open(sealedData, nonce []byte, key [32]byte) ([]byte, bool)
+}
+
+// symmetricCiphers maps each EncryptionVer that can be used for
+// symmetric encryption to its implementation. The version is stored
+// alongside the encrypted data, so data encrypted with any
+// registered version can always be decrypted. To roll out a new
+// cipher, register it here first, and only switch
+// defaultEncryptionVer to it once enough clients can decrypt it.
+var symmetricCiphers = map[EncryptionVer]symmetricCipher{
+	EncryptionSecretbox: secretboxCipher{},
+}
+
+// defaultEncryptionVer is the version used to encrypt new data.
+const defaultEncryptionVer = EncryptionSecretbox
+
+// getSymmetricCipher returns the cipher for the given version.
+func getSymmetricCipher(ver EncryptionVer) (symmetricCipher, error) {
+	cipher, ok := symmetricCiphers[ver]
+	if !ok {
+		return nil, UnknownEncryptionVer{ver}
+	}
+	return cipher, nil
+}
+
+// secretboxCipher implements symmetricCipher with
+// nacl/secretbox, i.e. XSalsa20 and Poly1305.
+type secretboxCipher struct{}
+
+func (secretboxCipher) nonceSize() int {
+	return 24
+}
+
+func (secretboxCipher) seal(data, nonce []byte, key [32]byte) []byte {
+	var n [24]byte
+	copy(n[:], nonce)
+	return secretbox.Seal(nil, data, &n, &key)
+}
+
+func (secretboxCipher) open(
+	sealedData, nonce []byte, key [32]byte) ([]byte, bool) {
+	var n [24]byte
+	copy(n[:], nonce)
+	return secretbox.Open(nil, sealedData, &n, &key)
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+
+	"github.com/keybase/kbfs/tlf"
+	"golang.org/x/net/context"
+)
+
+// SyncStateEventType says what kind of transition a SyncStateEvent
+// describes.
+type SyncStateEventType int
+
+const (
+	// SyncStateOffline means a server became unreachable while all
+	// of them were reachable.
+	SyncStateOffline SyncStateEventType = iota
+	// SyncStateOnline means every server is reachable again.
+	SyncStateOnline
+	// SyncStateReconnecting means the connection to a server was
+	// lost, and KBFS is trying to reconnect.
+	SyncStateReconnecting
+	// SyncStateReconnected means the connection to a server was
+	// reestablished.
+	SyncStateReconnected
+	// SyncStateCatchingUp means a TLF started applying updates
+	// made by other devices.
+	SyncStateCatchingUp
+	// SyncStateCaughtUp means a TLF finished applying updates made
+	// by other devices, successfully or not.
+	SyncStateCaughtUp
+)
+
+func (t SyncStateEventType) String() string {
+	switch t {
+	case SyncStateOffline:
+		return "offline"
+	case SyncStateOnline:
+		return "online"
+	case SyncStateReconnecting:
+		return "reconnecting"
+	case SyncStateReconnected:
+		return "reconnected"
+	case SyncStateCatchingUp:
+		return "catching up"
+	case SyncStateCaughtUp:
+		return "caught up"
+	default:
+		return fmt.Sprintf("SyncStateEventType(%d)", int(t))
+	}
+}
+
+// SyncStateEvent describes a change in KBFS's connection to its
+// servers, or in whether a TLF is up to date with them.  It is
+// suitable for encoding directly as JSON.
+type SyncStateEvent struct {
+	Type SyncStateEventType
+	// Service is the name of the server, for connection events
+	// (e.g., MDServiceName).
+	Service string `json:",omitempty"`
+	// TlfID is the TLF, for catching-up events.
+	TlfID tlf.ID
+	// Revision is the newest revision being applied, for
+	// SyncStateCatchingUp, or the head revision once done, for
+	// SyncStateCaughtUp.
+	Revision MetadataRevision `json:",omitempty"`
+	// Err is the error that took a server offline, or that
+	// stopped a TLF from catching up.
+	Err string `json:",omitempty"`
+}
+
+// SyncStateObserver can be notified of SyncStateEvents, so that UIs
+// can show whether KBFS is connected and up to date.  The
+// notification callback should not block, or make any calls to the
+// Notifier interface.
+type SyncStateObserver interface {
+	SyncStateChanged(ctx context.Context, event SyncStateEvent)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+type testSyncStateObserver struct {
+	lock   sync.Mutex
+	events []SyncStateEvent
+}
+
+func (o *testSyncStateObserver) SyncStateChanged(
+	ctx context.Context, event SyncStateEvent) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.events = append(o.events, event)
+}
+
+func (o *testSyncStateObserver) takeEventTypes() (
+	types []SyncStateEventType) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for _, e := range o.events {
+		types = append(types, e.Type)
+	}
+	o.events = nil
+	return types
+}
+
+func TestSyncStateConnectionEvents(t *testing.T) {
+	var kcs kbfsCurrentStatus
+	kcs.Init()
+	obs := &testSyncStateObserver{}
+	kcs.registerForSyncStateChanges(obs)
+
+	err := errors.New("connection lost")
+	kcs.PushConnectionStatusChange(MDServiceName, err)
+	require.Equal(t, []SyncStateEventType{
+		SyncStateReconnecting, SyncStateOffline}, obs.takeEventTypes())
+
+	// Already offline, and still failing.
+	kcs.PushConnectionStatusChange(KeybaseServiceName, err)
+	kcs.PushConnectionStatusChange(KeybaseServiceName, err)
+	require.Equal(t, []SyncStateEventType{SyncStateReconnecting},
+		obs.takeEventTypes())
+
+	kcs.PushConnectionStatusChange(MDServiceName, nil)
+	require.Equal(t, []SyncStateEventType{SyncStateReconnected},
+		obs.takeEventTypes())
+	kcs.PushConnectionStatusChange(KeybaseServiceName, nil)
+	require.Equal(t, []SyncStateEventType{
+		SyncStateReconnected, SyncStateOnline}, obs.takeEventTypes())
+
+	// Nothing changes.
+	kcs.PushConnectionStatusChange(KeybaseServiceName, nil)
+	require.Len(t, obs.takeEventTypes(), 0)
+
+	kcs.unregisterFromSyncStateChanges(obs)
+	kcs.PushConnectionStatusChange(MDServiceName, err)
+	require.Len(t, obs.takeEventTypes(), 0)
+}
+
+func TestSyncStateTLFCatchUp(t *testing.T) {
+	config1, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice")
+	defer kbfsTestShutdownNoMocks(t, config1, ctx, cancel)
+
+	config2 := ConfigAsUser(config1, "alice")
+	defer CheckConfigAndShutdown(ctx, t, config2)
+
+	rootNode1 := GetRootNodeOrBust(ctx, t, config1, "alice", false)
+	fb := rootNode1.GetFolderBranch()
+	_, err := DisableUpdatesForTesting(config1, fb)
+	require.NoError(t, err)
+
+	obs := &testSyncStateObserver{}
+	config1.Notifier().RegisterForSyncStateChanges(obs)
+	defer config1.Notifier().UnregisterFromSyncStateChanges(obs)
+
+	rootNode2 := GetRootNodeOrBust(ctx, t, config2, "alice", false)
+	_, _, err = config2.KBFSOps().CreateFile(
+		ctx, rootNode2, "a", false, NoExcl)
+	require.NoError(t, err)
+
+	err = config1.KBFSOps().SyncFromServerForTesting(ctx, fb)
+	require.NoError(t, err)
+
+	obs.lock.Lock()
+	defer obs.lock.Unlock()
+	require.Len(t, obs.events, 2)
+	require.Equal(t, SyncStateCatchingUp, obs.events[0].Type)
+	require.Equal(t, SyncStateCaughtUp, obs.events[1].Type)
+	require.Equal(t, fb.Tlf, obs.events[1].TlfID)
+	require.Equal(t, obs.events[0].Revision, obs.events[1].Revision)
+	require.Equal(t, "", obs.events[1].Err)
+}
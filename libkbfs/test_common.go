@@ -80,7 +80,7 @@ func MakeTestBlockServerOrBust(t logger.TestLogBackend, codec kbfscodec.Codec,
 		return blockServer
 
 	case len(bserverAddr) != 0:
-		return NewBlockServerRemote(codec, signer, cig,
+		return NewBlockServerRemote(codec, signer, cig, nil,
 			log, bserverAddr, rpcLogFactory)
 
 	default:
@@ -201,6 +201,14 @@ func MakeTestConfigOrBust(t logger.TestLogBackend,
 func ConfigAsUser(config *ConfigLocal, loggedInUser libkb.NormalizedUsername) *ConfigLocal {
 	c := newConfigForTest(config.loggerFn)
 	c.SetMetadataVersion(config.MetadataVersion())
+	c.SetBlockCompression(config.BlockCompression())
+	c.SetPublicBlocksUnencrypted(config.PublicBlocksUnencrypted())
+	c.SetMaxParallelBlockPuts(config.MaxParallelBlockPuts())
+	c.SetBlockRetryPolicy(config.BlockRetryPolicy())
+	c.SetBlockBandwidthLimits(config.BlockBandwidthLimits())
+	c.SetServerTLSConfig(config.ServerTLSConfig())
+	c.SetReadAhead(config.ReadAhead())
+	c.SetCacheLimits(config.CacheLimits())
 	c.SetRekeyWithPromptWaitTime(config.RekeyWithPromptWaitTime())
 
 	kbfsOps := NewKBFSOpsStandard(c)
@@ -234,7 +242,7 @@ func ConfigAsUser(config *ConfigLocal, loggedInUser libkb.NormalizedUsername) *C
 	if s, ok := config.BlockServer().(*BlockServerRemote); ok {
 		bserverLog := config.MakeLogger("BSR")
 		blockServer := NewBlockServerRemote(c.Codec(), c.Crypto(),
-			c.KBPKI(), bserverLog, s.RemoteAddress(),
+			c.KBPKI(), c, bserverLog, s.RemoteAddress(),
 			env.NewContext().NewRPCLogFactory())
 		c.SetBlockServer(blockServer)
 	} else {
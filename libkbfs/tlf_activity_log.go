@@ -0,0 +1,277 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+const (
+	// tlfActivityLogMaxEntries is how many entries are kept for
+	// each TLF; older ones are dropped.
+	tlfActivityLogMaxEntries = 10000
+	// How many batches of new revisions may wait to be logged
+	// before new ones are dropped.
+	tlfActivityQueueSize = 1000
+)
+
+// TlfActivityEntry is a single operation recorded in the activity log
+// of a TLF.
+type TlfActivityEntry struct {
+	// Time is when the revision containing the operation was
+	// made, by the local clock.
+	Time     time.Time        `json:"time"`
+	Revision MetadataRevision `json:"revision"`
+	Writer   string           `json:"writer"`
+	// Device is the name of the writer's device, if known.
+	Device string `json:"device,omitempty"`
+	// Op is one of "create", "write", "rename", "delete" or
+	// "attr", as returned by ChangeEventType.String.
+	Op string `json:"op"`
+	// Path is the canonical path of the entry operated on, and
+	// OldPath is where it was renamed from, for renames.
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+}
+
+// tlfActivityLog keeps a bounded, append-only log of the operations
+// in every revision of every TLF loaded on this device, so users can
+// see what changed in a folder and when.
+//
+// The directory layout looks like:
+//
+// dir/<tlf ID>.log
+//
+// where each file holds one JSON-encoded TlfActivityEntry per line,
+// in the order they were logged.  Once a file holds more than maxEntries entries, the
+// oldest quarter is dropped.
+//
+// A nil *tlfActivityLog is valid, and logs nothing.
+type tlfActivityLog struct {
+	config     Config
+	log        logger.Logger
+	dir        string
+	maxEntries int
+	queue      *revisionQueue
+
+	// lock protects the log files and counts.
+	lock sync.Mutex
+	// counts holds the number of entries in each log file that
+	// has been appended to since startup.
+	counts map[tlf.ID]int
+}
+
+func makeTlfActivityLog(config Config, log logger.Logger, dir string,
+	maxEntries int) (*tlfActivityLog, error) {
+	err := ioutil.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	l := &tlfActivityLog{
+		config:     config,
+		log:        log,
+		dir:        dir,
+		maxEntries: maxEntries,
+		counts:     make(map[tlf.ID]int),
+	}
+	l.queue = newRevisionQueue(
+		log, "activity log", tlfActivityQueueSize, l.addRevision)
+	return l, nil
+}
+
+func (l *tlfActivityLog) logPath(tlfID tlf.ID) string {
+	return filepath.Join(l.dir, tlfID.String()+".log")
+}
+
+// revisionsApplied queues up the given new revisions of fbo's folder
+// to be logged.
+func (l *tlfActivityLog) revisionsApplied(ctx context.Context,
+	fbo *folderBranchOps, rmds []ImmutableRootMetadata) {
+	if l == nil {
+		return
+	}
+	l.queue.revisionsApplied(ctx, fbo, rmds)
+}
+
+func (l *tlfActivityLog) addRevision(ctx context.Context,
+	fbo *folderBranchOps, rmd ImmutableRootMetadata) error {
+	changes, err := getRevisionChanges(ctx, l.config, l.log, fbo, rmd)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	ui, err := l.config.KeybaseService().LoadUserPlusKeys(
+		ctx, rmd.LastModifyingWriter(), "")
+	if err != nil {
+		return err
+	}
+	device := ui.KIDNames[rmd.LastModifyingWriterVerifyingKey().KID()]
+
+	entries := make([]TlfActivityEntry, 0, len(changes))
+	for _, change := range changes {
+		entry := TlfActivityEntry{
+			Time:     rmd.localTimestamp,
+			Revision: rmd.Revision(),
+			Writer:   string(ui.Name),
+			Device:   device,
+			Op:       change.Type.String(),
+			Path:     change.Path.CanonicalPathString(),
+		}
+		if change.Type == ChangeEventRename {
+			entry.OldPath = change.OldPath.CanonicalPathString()
+		}
+		entries = append(entries, entry)
+	}
+	return l.append(rmd.TlfID(), entries)
+}
+
+// readLocked returns every entry in the log of the given TLF.
+func (l *tlfActivityLog) readLocked(tlfID tlf.ID) (
+	[]TlfActivityEntry, error) {
+	data, err := ioutil.ReadFile(l.logPath(tlfID))
+	if ioutil.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []TlfActivityEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry TlfActivityEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			// Probably a partial line from a crash; skip it.
+			l.log.CDebugf(context.Background(),
+				"Skipping bad activity log line for %s: %+v", tlfID, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func encodeTlfActivityEntries(entries []TlfActivityEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		// Encode adds a newline after each entry.
+		if err := encoder.Encode(entry); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// append adds the given entries to the log of the given TLF,
+// dropping old entries if there are too many.
+func (l *tlfActivityLog) append(
+	tlfID tlf.ID, entries []TlfActivityEntry) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	count, ok := l.counts[tlfID]
+	if !ok {
+		existing, err := l.readLocked(tlfID)
+		if err != nil {
+			return err
+		}
+		count = len(existing)
+	}
+
+	if count+len(entries) > l.maxEntries {
+		existing, err := l.readLocked(tlfID)
+		if err != nil {
+			return err
+		}
+		all := append(existing, entries...)
+		keep := l.maxEntries * 3 / 4
+		if keep < len(entries) {
+			keep = len(entries)
+		}
+		if len(all) > keep {
+			all = all[len(all)-keep:]
+		}
+		data, err := encodeTlfActivityEntries(all)
+		if err != nil {
+			return err
+		}
+		// Write the trimmed log next to the old one and swap it
+		// in, so a crash can't lose the whole log.
+		tmpPath := l.logPath(tlfID) + ".tmp"
+		err = ioutil.WriteFile(tmpPath, data, 0600)
+		if err != nil {
+			return err
+		}
+		err = ioutil.Rename(tmpPath, l.logPath(tlfID))
+		if err != nil {
+			return err
+		}
+		l.counts[tlfID] = len(all)
+		return nil
+	}
+
+	data, err := encodeTlfActivityEntries(entries)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.OpenFile(l.logPath(tlfID),
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	l.counts[tlfID] = count + len(entries)
+	return nil
+}
+
+// get returns the entries in the log of the given TLF made at or
+// after since, in the order they were logged.
+func (l *tlfActivityLog) get(tlfID tlf.ID, since time.Time) (
+	[]TlfActivityEntry, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	entries, err := l.readLocked(tlfID)
+	if err != nil {
+		return nil, err
+	}
+	// Revisions from other devices may be logged out of time
+	// order, so check every entry.
+	var recent []TlfActivityEntry
+	for _, entry := range entries {
+		if !entry.Time.Before(since) {
+			recent = append(recent, entry)
+		}
+	}
+	return recent, nil
+}
+
+// shutdown waits for any queued revisions to be logged.
+func (l *tlfActivityLog) shutdown() {
+	if l == nil {
+		return
+	}
+	l.queue.shutdownAndWait()
+}
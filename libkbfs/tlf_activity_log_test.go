@@ -0,0 +1,112 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestTlfActivityLogTrim(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "tlf_activity_log")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	config := MakeTestConfigOrBust(t, "alice")
+	defer CheckConfigAndShutdown(context.Background(), t, config)
+	l, err := makeTlfActivityLog(config, config.MakeLogger(""), tempdir, 8)
+	require.NoError(t, err)
+	defer l.shutdown()
+
+	tlfID := tlf.FakeID(1, false)
+	start := time.Unix(1000, 0)
+	for i := 0; i < 10; i++ {
+		err := l.append(tlfID, []TlfActivityEntry{{
+			Time:     start.Add(time.Duration(i) * time.Hour),
+			Revision: MetadataRevision(i),
+			Op:       "write",
+		}})
+		require.NoError(t, err)
+	}
+
+	// Going over 8 entries trimmed the log down to 6, and then
+	// one more was added.
+	entries, err := l.get(tlfID, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, entries, 7)
+	require.Equal(t, MetadataRevision(3), entries[0].Revision)
+	require.Equal(t, MetadataRevision(9), entries[6].Revision)
+
+	entries, err = l.get(tlfID, start.Add(8*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// A new log picks up the old entries.
+	l2, err := makeTlfActivityLog(config, config.MakeLogger(""), tempdir, 8)
+	require.NoError(t, err)
+	defer l2.shutdown()
+	entries, err = l2.get(tlfID, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, entries, 7)
+
+	entries, err = l2.get(tlf.FakeID(2, false), time.Time{})
+	require.NoError(t, err)
+	require.Len(t, entries, 0)
+}
+
+func TestGetActivityLog(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "tlf_activity_log")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		require.NoError(t, err)
+	}()
+
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+	require.NoError(t, config.EnableTlfActivityLog(tempdir))
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "alice", false)
+	kbfsOps := config.KBFSOps()
+	fb := rootNode.GetFolderBranch()
+	dirNode, _, err := kbfsOps.CreateDir(ctx, rootNode, "dir")
+	require.NoError(t, err)
+	fileNode, _, err := kbfsOps.CreateFile(ctx, dirNode, "a", false, NoExcl)
+	require.NoError(t, err)
+	require.NoError(t, kbfsOps.Write(ctx, fileNode, []byte{1, 2, 3}, 0))
+	require.NoError(t, kbfsOps.Sync(ctx, fileNode))
+	require.NoError(t, kbfsOps.Rename(ctx, dirNode, "a", rootNode, "b"))
+	require.NoError(t, kbfsOps.RemoveEntry(ctx, rootNode, "b"))
+
+	// Wait for everything queued to be logged.
+	config.tlfActivityLog().shutdown()
+
+	entries, err := kbfsOps.GetActivityLog(ctx, fb, time.Time{})
+	require.NoError(t, err)
+	type opPath struct {
+		op, path, oldPath string
+	}
+	var got []opPath
+	for _, e := range entries {
+		require.Equal(t, "alice", e.Writer)
+		got = append(got, opPath{e.Op, e.Path, e.OldPath})
+	}
+	require.Equal(t, []opPath{
+		{"create", "/keybase/private/alice/dir", ""},
+		{"create", "/keybase/private/alice/dir/a", ""},
+		{"write", "/keybase/private/alice/dir/a", ""},
+		{"rename", "/keybase/private/alice/b", "/keybase/private/alice/dir/a"},
+		{"delete", "/keybase/private/alice/b", ""},
+	}, got)
+}
@@ -42,6 +42,10 @@ type TlfHandle struct {
 	// name can be computed from the other fields, but is cached
 	// for speed.
 	name CanonicalTlfName
+	// team, if non-nil, is the membership of the team that owns
+	// this TLF (which is then the only resolved writer), as of
+	// when this handle was resolved.
+	team *TeamInfo
 }
 
 // IsPublic returns whether or not this TlfHandle represents a public
@@ -50,9 +54,23 @@ func (h TlfHandle) IsPublic() bool {
 	return h.public
 }
 
+// TeamID returns the ID of the team that owns the top-level folder
+// represented by this TlfHandle, and true, or false if the folder
+// isn't owned by a team.
+func (h TlfHandle) TeamID() (keybase1.UID, bool) {
+	if h.team == nil {
+		return keybase1.UID(""), false
+	}
+	return h.team.TID, true
+}
+
 // IsWriter returns whether or not the given user is a writer for the
-// top-level folder represented by this TlfHandle.
+// top-level folder represented by this TlfHandle. For a team folder,
+// that's any member of the team whose role lets them write.
 func (h TlfHandle) IsWriter(user keybase1.UID) bool {
+	if h.team != nil {
+		return h.team.Writers[user]
+	}
 	_, ok := h.resolvedWriters[user]
 	return ok
 }
@@ -63,10 +81,42 @@ func (h TlfHandle) IsReader(user keybase1.UID) bool {
 	if h.public || h.IsWriter(user) {
 		return true
 	}
+	if h.team != nil {
+		return h.team.Readers[user]
+	}
 	_, ok := h.resolvedReaders[user]
 	return ok
 }
 
+// writerUsers returns the users whose devices get writer keys for
+// the top-level folder represented by this TlfHandle, i.e. the
+// writers of the owning team for a team folder, and the resolved
+// writers otherwise.
+func (h TlfHandle) writerUsers() []keybase1.UID {
+	if h.team == nil {
+		return h.ResolvedWriters()
+	}
+	writers := make([]keybase1.UID, 0, len(h.team.Writers))
+	for uid := range h.team.Writers {
+		writers = append(writers, uid)
+	}
+	sort.Sort(tlf.UIDList(writers))
+	return writers
+}
+
+// readerUsers is like writerUsers, but for reader keys.
+func (h TlfHandle) readerUsers() []keybase1.UID {
+	if h.team == nil {
+		return h.ResolvedReaders()
+	}
+	readers := make([]keybase1.UID, 0, len(h.team.Readers))
+	for uid := range h.team.Readers {
+		readers = append(readers, uid)
+	}
+	sort.Sort(tlf.UIDList(readers))
+	return readers
+}
+
 func (h TlfHandle) unsortedResolvedWriters() []keybase1.UID {
 	if len(h.resolvedWriters) == 0 {
 		return nil
@@ -217,7 +267,7 @@ func (h TlfHandle) Extensions() (extensions []tlf.HandleExtension) {
 }
 
 func init() {
-	if reflect.ValueOf(TlfHandle{}).NumField() != 8 {
+	if reflect.ValueOf(TlfHandle{}).NumField() != 9 {
 		panic(errors.New(
 			"Unexpected number of fields in TlfHandle; " +
 				"please update TlfHandle.Equals() for your " +
@@ -225,7 +275,9 @@ func init() {
 	}
 }
 
-// EqualsIgnoreName returns whether h and other contain the same info ignoring the name.
+// EqualsIgnoreName returns whether h and other contain the same info
+// ignoring the name. The membership of the owning team, if any, is
+// ignored too, since it isn't part of the identity of the TLF.
 func (h TlfHandle) EqualsIgnoreName(
 	codec kbfscodec.Codec, other TlfHandle) (bool, error) {
 	if h.public != other.public {
@@ -311,6 +363,9 @@ func (h TlfHandle) deepCopy() *TlfHandle {
 		unresolvedReaders: h.UnresolvedReaders(),
 		conflictInfo:      h.ConflictInfo(),
 		finalizedInfo:     h.FinalizedInfo(),
+		// TeamInfo objects are never modified, so they can
+		// be shared.
+		team: h.team,
 	}
 
 	hCopy.resolvedWriters = make(map[keybase1.UID]libkb.NormalizedUsername, len(h.resolvedWriters))
@@ -131,6 +131,20 @@ func makeTlfHandleHelper(
 		canonicalName += ReaderSep + strings.Join(readerNames, ",")
 	}
 
+	// A team can only be the sole writer of a TLF.
+	for uid := range usedWNames {
+		if tlf.IsTeamID(uid) && (len(usedWNames) > 1 ||
+			len(unresolvedWriters) > 0 || len(usedRNames) > 0 ||
+			len(unresolvedReaders) > 0) {
+			return nil, BadTLFNameError{canonicalName}
+		}
+	}
+	for uid := range usedRNames {
+		if tlf.IsTeamID(uid) {
+			return nil, BadTLFNameError{canonicalName}
+		}
+	}
+
 	extensionList := tlf.HandleExtensionList(extensions)
 	sort.Sort(extensionList)
 	canonicalName += extensionList.Suffix()
@@ -172,14 +186,59 @@ func (rsa resolvableSocialAssertion) resolve(ctx context.Context) (nameUIDPair,
 	return nameUIDPair{}, keybase1.SocialAssertion(rsa), nil
 }
 
+// loadTeam loads the current membership of the team that owns the
+// TLF of h, if any, into h.
+func (h *TlfHandle) loadTeam(ctx context.Context, tig teamInfoGetter) error {
+	if len(h.resolvedWriters) != 1 {
+		return nil
+	}
+	for uid := range h.resolvedWriters {
+		if !tlf.IsTeamID(uid) {
+			return nil
+		}
+		info, err := tig.GetTeamInfo(ctx, uid)
+		if err != nil {
+			return err
+		}
+		h.team = &info
+	}
+	return nil
+}
+
+// withCurrentTeam returns a copy of h with the current membership of
+// the team that owns the TLF of h. As an optimization, if h isn't
+// owned by a team, it just returns itself.
+func (h *TlfHandle) withCurrentTeam(ctx context.Context,
+	tig teamInfoGetter) (*TlfHandle, error) {
+	if h.team == nil {
+		return h, nil
+	}
+	newH := h.deepCopy()
+	err := newH.loadTeam(ctx, tig)
+	if err != nil {
+		return nil, err
+	}
+	return newH, nil
+}
+
 // MakeTlfHandle creates a TlfHandle from the given tlf.Handle and the
-// given normalizedUsernameGetter (which is usually a KBPKI).
+// given tlfHandleNameGetter (which is usually a KBPKI).
 func MakeTlfHandle(
 	ctx context.Context, bareHandle tlf.Handle,
-	nug normalizedUsernameGetter) (*TlfHandle, error) {
+	nug tlfHandleNameGetter) (*TlfHandle, error) {
+	var team *TeamInfo
 	writers := make([]resolvableUser, 0, len(bareHandle.Writers)+len(bareHandle.UnresolvedWriters))
-	for _, w := range bareHandle.Writers {
-		writers = append(writers, resolvableUID{nug, w})
+	if tid, ok := bareHandle.TeamID(); ok {
+		info, err := nug.GetTeamInfo(ctx, tid)
+		if err != nil {
+			return nil, err
+		}
+		team = &info
+		writers = append(writers, resolvableNameUIDPair{info.Name, tid})
+	} else {
+		for _, w := range bareHandle.Writers {
+			writers = append(writers, resolvableUID{nug, w})
+		}
 	}
 	for _, uw := range bareHandle.UnresolvedWriters {
 		writers = append(writers, resolvableSocialAssertion(uw))
@@ -200,6 +259,7 @@ func MakeTlfHandle(
 	if err != nil {
 		return nil, err
 	}
+	h.team = team
 
 	newHandle, err := h.ToBareHandle()
 	if err != nil {
@@ -492,6 +552,11 @@ func parseTlfHandleLoose(
 		return nil, err
 	}
 
+	err = h.loadTeam(ctx, kbpki)
+	if err != nil {
+		return nil, err
+	}
+
 	if !public {
 		currentUsername, currentUID, err := kbpki.GetCurrentUserInfo(ctx)
 		if err != nil {
@@ -559,6 +624,30 @@ func ParseTlfHandle(
 	return h, nil
 }
 
+// maxTlfNameRedirects is the most TlfNameNotCanonical redirects that
+// ParseTlfHandleFollowingRedirects will follow before giving up.
+const maxTlfNameRedirects = 5
+
+// ParseTlfHandleFollowingRedirects is like ParseTlfHandle, except
+// that when the given name isn't canonical (e.g., its writers are out
+// of order, or it names a user by a non-primary assertion) it follows
+// the name to try in the TlfNameNotCanonical error until it gets to
+// the canonical name, and returns the handle for that. Use this when
+// the caller has no way to surface the redirect itself, unlike the
+// mount layers, which show it as a symlink.
+func ParseTlfHandleFollowingRedirects(
+	ctx context.Context, kbpki KBPKI, name string, public bool) (
+	*TlfHandle, error) {
+	for i := 0; ; i++ {
+		h, err := ParseTlfHandle(ctx, kbpki, name, public)
+		e, ok := err.(TlfNameNotCanonical)
+		if !ok || i >= maxTlfNameRedirects {
+			return h, err
+		}
+		name = e.NameToTry
+	}
+}
+
 // ParseTlfHandlePreferred returns TlfNameNotCanonical if not
 // in the preferred format.
 // Preferred format means that the users own username (from kbpki)
@@ -13,6 +13,7 @@ import (
 	"github.com/keybase/client/go/protocol/keybase1"
 	"github.com/keybase/kbfs/kbfscodec"
 	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -168,6 +169,57 @@ func TestParseTlfHandleAssertionPublicSuccess(t *testing.T) {
 	assert.Equal(t, CanonicalTlfName(name), h2.GetCanonicalName())
 }
 
+func TestParseTlfHandleTeam(t *testing.T) {
+	ctx := context.Background()
+
+	localUsers := MakeLocalUsers([]libkb.NormalizedUsername{"u1", "u2", "u3"})
+	currentUID := localUsers[0].UID
+	daemon := NewKeybaseDaemonMemory(
+		currentUID, localUsers, kbfscodec.NewMsgpack())
+	tid, err := daemon.addTeamForTest("t1", map[keybase1.UID]TeamRole{
+		localUsers[0].UID: TeamRoleAdmin,
+		localUsers[1].UID: TeamRoleReader,
+	})
+	require.NoError(t, err)
+
+	kbpki := &identifyCountingKBPKI{
+		KBPKI: &daemonKBPKI{
+			daemon: daemon,
+		},
+	}
+
+	h, err := ParseTlfHandle(ctx, kbpki, "t1", false)
+	require.NoError(t, err)
+	require.Equal(t, CanonicalTlfName("t1"), h.GetCanonicalName())
+	hTID, ok := h.TeamID()
+	require.True(t, ok)
+	require.Equal(t, tid, hTID)
+	require.True(t, h.IsWriter(localUsers[0].UID))
+	require.False(t, h.IsWriter(localUsers[1].UID))
+	require.True(t, h.IsReader(localUsers[1].UID))
+	require.False(t, h.IsReader(localUsers[2].UID))
+	require.Equal(t, []keybase1.UID{localUsers[0].UID}, h.writerUsers())
+
+	// A team can't share a TLF with anyone else.
+	_, err = ParseTlfHandle(ctx, kbpki, "t1,u3", false)
+	require.IsType(t, BadTLFNameError{}, errors.Cause(err))
+	_, err = ParseTlfHandle(ctx, kbpki, "u1#t1", false)
+	require.IsType(t, BadTLFNameError{}, errors.Cause(err))
+
+	// Membership changes show up in a refreshed handle.
+	err = daemon.setTeamRoleForTest(tid, localUsers[2].UID, TeamRoleWriter)
+	require.NoError(t, err)
+	require.False(t, h.IsWriter(localUsers[2].UID))
+	h2, err := h.withCurrentTeam(ctx, kbpki)
+	require.NoError(t, err)
+	require.True(t, h2.IsWriter(localUsers[2].UID))
+
+	h3, err := MakeTlfHandle(ctx, h2.ToBareHandleOrBust(), kbpki)
+	require.NoError(t, err)
+	require.Equal(t, CanonicalTlfName("t1"), h3.GetCanonicalName())
+	require.True(t, h3.IsWriter(localUsers[2].UID))
+}
+
 func TestTlfHandleAccessorsPrivate(t *testing.T) {
 	ctx := context.Background()
 
@@ -514,6 +566,42 @@ func TestTlfHandlEqual(t *testing.T) {
 	}, "in everything but name")
 }
 
+func TestParseTlfHandleFollowingRedirects(t *testing.T) {
+	ctx := context.Background()
+
+	localUsers := MakeLocalUsers([]libkb.NormalizedUsername{"u1", "u2"})
+	localUsers[1].Asserts = []string{"u2@twitter"}
+	currentUID := localUsers[0].UID
+	daemon := NewKeybaseDaemonMemory(
+		currentUID, localUsers, kbfscodec.NewMsgpack())
+	kbpki := &daemonKBPKI{
+		daemon: daemon,
+	}
+
+	name := "u1,u2"
+	h, err := ParseTlfHandle(ctx, kbpki, name, false)
+	require.NoError(t, err)
+
+	// Out-of-order writers and non-primary assertions all end up
+	// at the same handle.
+	for _, nonCanonicalName := range []string{
+		"u2,u1", "u1,u2@twitter", "u2@twitter,u1",
+	} {
+		_, err := ParseTlfHandle(ctx, kbpki, nonCanonicalName, false)
+		require.IsType(t, TlfNameNotCanonical{}, err)
+
+		h2, err := ParseTlfHandleFollowingRedirects(
+			ctx, kbpki, nonCanonicalName, false)
+		require.NoError(t, err)
+		require.Equal(t, h.GetCanonicalName(), h2.GetCanonicalName())
+		require.Equal(t, h.ToBareHandleOrBust(), h2.ToBareHandleOrBust())
+	}
+
+	// Other errors are passed through.
+	_, err = ParseTlfHandleFollowingRedirects(ctx, kbpki, "u1,u3", false)
+	require.IsType(t, NoSuchUserError{}, errors.Cause(err))
+}
+
 func TestParseTlfHandleSocialAssertion(t *testing.T) {
 	ctx := context.Background()
 
@@ -39,9 +39,12 @@ type tlfJournalConfig interface {
 	encryptionKeyGetter() encryptionKeyGetter
 	mdDecryptionKeyGetter() mdDecryptionKeyGetter
 	MDServer() MDServer
-	usernameGetter() normalizedUsernameGetter
+	usernameGetter() tlfHandleNameGetter
 	MakeLogger(module string) logger.Logger
+	MaxParallelBlockPuts() int
+	blockTransferTracker() *blockTransferTracker
 	diskLimitTimeout() time.Duration
+	JournalLimits() JournalLimits
 }
 
 // tlfJournalConfigWrapper is an adapter for Config objects to the
@@ -58,7 +61,7 @@ func (ca tlfJournalConfigAdapter) mdDecryptionKeyGetter() mdDecryptionKeyGetter
 	return ca.Config.KeyManager()
 }
 
-func (ca tlfJournalConfigAdapter) usernameGetter() normalizedUsernameGetter {
+func (ca tlfJournalConfigAdapter) usernameGetter() tlfHandleNameGetter {
 	return ca.Config.KBPKI()
 }
 
@@ -93,7 +96,13 @@ type TLFJournalStatus struct {
 	RevisionStart MetadataRevision
 	RevisionEnd   MetadataRevision
 	BranchID      string
-	BlockOpCount  uint64
+	// OnConflictBranch is true when the journal's MDs are on a
+	// branch that conflicts with the server, and so are waiting
+	// for conflict resolution before they can be flushed.
+	OnConflictBranch bool
+	BlockOpCount     uint64
+	// MDOpCount is the number of MD revisions not yet flushed.
+	MDOpCount uint64
 	// The byte counters below are signed because
 	// os.FileInfo.Size() is signed. The file counter is signed
 	// for consistency.
@@ -102,6 +111,10 @@ type TLFJournalStatus struct {
 	UnflushedBytes int64
 	UnflushedPaths []string
 	LastFlushErr   string `json:",omitempty"`
+	// LastFlushTime is when this journal last flushed an entry
+	// to the servers, or the zero time if it hasn't since it was
+	// enabled.
+	LastFlushTime time.Time
 }
 
 // TLFJournalBackgroundWorkStatus indicates whether a journal should
@@ -192,6 +205,10 @@ type tlfJournal struct {
 	// blockJournal.getStoredFiles() until shutdown.
 	diskLimiter diskLimiter
 
+	// flushScheduler, if non-nil, orders background flushes
+	// between this and the other journals.
+	flushScheduler *journalFlushScheduler
+
 	// All the channels below are used as simple on/off
 	// signals. They're buffered for one object, and all sends are
 	// asynchronous, so multiple sends get collapsed into one
@@ -226,6 +243,7 @@ type tlfJournal struct {
 	mdJournal      *mdJournal
 	disabled       bool
 	lastFlushErr   error
+	lastFlushTime  time.Time
 	unflushedPaths unflushedPathCache
 
 	bwDelegate tlfJournalBWDelegate
@@ -266,7 +284,8 @@ func makeTLFJournal(
 	dir string, tlfID tlf.ID, config tlfJournalConfig,
 	delegateBlockServer BlockServer, bws TLFJournalBackgroundWorkStatus,
 	bwDelegate tlfJournalBWDelegate, onBranchChange branchChangeListener,
-	onMDFlush mdFlushListener, diskLimiter diskLimiter) (
+	onMDFlush mdFlushListener, diskLimiter diskLimiter,
+	flushScheduler *journalFlushScheduler) (
 	*tlfJournal, error) {
 	if uid == keybase1.UID("") {
 		return nil, errors.New("Empty user")
@@ -312,6 +331,10 @@ func makeTLFJournal(
 
 	log := config.MakeLogger("TLFJ")
 
+	if tlfByteLimit := config.JournalLimits().TLFByteLimit; tlfByteLimit > 0 {
+		diskLimiter = newTLFDiskLimiter(tlfByteLimit, diskLimiter)
+	}
+
 	blockJournal, err := makeBlockJournal(ctx, config.Codec(), dir, log)
 	if err != nil {
 		return nil, err
@@ -336,6 +359,7 @@ func makeTLFJournal(
 		onBranchChange:       onBranchChange,
 		onMDFlush:            onMDFlush,
 		diskLimiter:          diskLimiter,
+		flushScheduler:       flushScheduler,
 		hasWorkCh:            make(chan struct{}, 1),
 		needPauseCh:          make(chan struct{}, 1),
 		needResumeCh:         make(chan struct{}, 1),
@@ -584,12 +608,24 @@ func (j *tlfJournal) doBackgroundWork(ctx context.Context) <-chan error {
 	// TODO: Handle panics.
 	go func() {
 		defer j.wg.Done()
-		errCh <- j.flush(ctx)
+		errCh <- j.backgroundFlush(ctx)
 		close(errCh)
 	}()
 	return errCh
 }
 
+// backgroundFlush flushes the journal once no journal with a higher
+// flush priority is flushing.
+func (j *tlfJournal) backgroundFlush(ctx context.Context) error {
+	done, err := j.flushScheduler.startFlush(ctx, j.tlfID)
+	if err != nil {
+		j.log.CDebugf(ctx, "Flush canceled while waiting: %+v", err)
+		return nil
+	}
+	defer done()
+	return j.flush(ctx)
+}
+
 // We don't guarantee that background pause/resume requests will be
 // processed in strict FIFO order. In particular, multiple pause
 // requests are collapsed into one (also multiple resume requests), so
@@ -688,6 +724,9 @@ func (j *tlfJournal) flush(ctx context.Context) (err error) {
 		}
 		j.journalLock.Lock()
 		j.lastFlushErr = err
+		if flushedBlockEntries > 0 || flushedMDEntries > 0 {
+			j.lastFlushTime = j.config.Clock().Now()
+		}
 		j.journalLock.Unlock()
 	}()
 
@@ -856,7 +895,8 @@ func (j *tlfJournal) flushBlockEntries(
 	var tlfName CanonicalTlfName
 	err = flushBlockEntries(ctx, j.log, j.delegateBlockServer,
 		j.config.BlockCache(), j.config.Reporter(),
-		j.tlfID, tlfName, entries)
+		j.tlfID, tlfName, entries, j.config.MaxParallelBlockPuts(),
+		j.config.blockTransferTracker())
 	if err != nil {
 		return 0, MetadataRevisionUninitialized, err
 	}
@@ -1143,16 +1183,24 @@ func (j *tlfJournal) getJournalStatusLocked() (TLFJournalStatus, error) {
 	storedBytes := j.blockJournal.getStoredBytes()
 	storedFiles := j.blockJournal.getStoredFiles()
 	unflushedBytes := j.blockJournal.getUnflushedBytes()
+	var mdEntryCount uint64
+	if latestRevision != MetadataRevisionUninitialized {
+		mdEntryCount = uint64(latestRevision - earliestRevision + 1)
+	}
+	bid := j.mdJournal.getBranchID()
 	return TLFJournalStatus{
-		Dir:            j.dir,
-		BranchID:       j.mdJournal.getBranchID().String(),
-		RevisionStart:  earliestRevision,
-		RevisionEnd:    latestRevision,
-		BlockOpCount:   blockEntryCount,
-		StoredBytes:    storedBytes,
-		StoredFiles:    storedFiles,
-		UnflushedBytes: unflushedBytes,
-		LastFlushErr:   lastFlushErr,
+		Dir:              j.dir,
+		BranchID:         bid.String(),
+		OnConflictBranch: bid != NullBranchID,
+		RevisionStart:    earliestRevision,
+		RevisionEnd:      latestRevision,
+		BlockOpCount:     blockEntryCount,
+		MDOpCount:        mdEntryCount,
+		StoredBytes:      storedBytes,
+		StoredFiles:      storedFiles,
+		UnflushedBytes:   unflushedBytes,
+		LastFlushErr:     lastFlushErr,
+		LastFlushTime:    j.lastFlushTime,
 	}, nil
 }
 
@@ -1341,18 +1389,6 @@ func (j *tlfJournal) getJournalStatusWithPaths(ctx context.Context,
 	return jStatus, nil
 }
 
-func (j *tlfJournal) getByteCounts() (
-	storedBytes, storedFiles, unflushedBytes int64, err error) {
-	j.journalLock.RLock()
-	defer j.journalLock.RUnlock()
-	if err := j.checkEnabledLocked(); err != nil {
-		return 0, 0, 0, err
-	}
-
-	return j.blockJournal.getStoredBytes(), j.blockJournal.getStoredFiles(),
-		j.blockJournal.getUnflushedBytes(), nil
-}
-
 func (j *tlfJournal) shutdown(ctx context.Context) {
 	select {
 	case j.needShutdownCh <- struct{}{}:
@@ -1484,6 +1520,12 @@ func (j *tlfJournal) putBlockData(
 	// journal lock.
 
 	timeout := j.config.diskLimitTimeout()
+	fullPolicy := j.config.JournalLimits().FullPolicy
+	if fullPolicy == JournalFullFail {
+		// An already-expired context makes the disk limiter
+		// take the space only if it's there right away.
+		timeout = 0
+	}
 	acquireCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -1494,6 +1536,9 @@ func (j *tlfJournal) putBlockData(
 	case nil:
 		// Continue.
 	case context.DeadlineExceeded:
+		if fullPolicy == JournalFullFail && ctx.Err() == nil {
+			return errors.WithStack(ErrJournalFull{bufLen, availableBytes})
+		}
 		return errors.WithStack(ErrDiskLimitTimeout{
 			timeout, bufLen, filesPerBlockMax,
 			availableBytes, availableFiles, err,
@@ -84,9 +84,10 @@ type testTLFJournalConfig struct {
 	uid          keybase1.UID
 	verifyingKey kbfscrypto.VerifyingKey
 	ekg          singleEncryptionKeyGetter
-	nug          normalizedUsernameGetter
+	nug          tlfHandleNameGetter
 	mdserver     MDServer
 	dlTimeout    time.Duration
+	limits       JournalLimits
 }
 
 func (c testTLFJournalConfig) BlockSplitter() BlockSplitter {
@@ -137,7 +138,7 @@ func (c testTLFJournalConfig) mdDecryptionKeyGetter() mdDecryptionKeyGetter {
 	return c.ekg
 }
 
-func (c testTLFJournalConfig) usernameGetter() normalizedUsernameGetter {
+func (c testTLFJournalConfig) usernameGetter() tlfHandleNameGetter {
 	return c.nug
 }
 
@@ -149,10 +150,22 @@ func (c testTLFJournalConfig) MakeLogger(module string) logger.Logger {
 	return c.log
 }
 
+func (c testTLFJournalConfig) MaxParallelBlockPuts() int {
+	return maxParallelBlockPuts
+}
+
+func (c testTLFJournalConfig) blockTransferTracker() *blockTransferTracker {
+	return nil
+}
+
 func (c testTLFJournalConfig) diskLimitTimeout() time.Duration {
 	return c.dlTimeout
 }
 
+func (c testTLFJournalConfig) JournalLimits() JournalLimits {
+	return c.limits
+}
+
 func (c testTLFJournalConfig) makeBlock(data []byte) (
 	kbfsblock.ID, kbfsblock.Context, kbfscrypto.BlockCryptKeyServerHalf) {
 	id, err := kbfsblock.MakePermanentID(data)
@@ -176,7 +189,8 @@ func (c testTLFJournalConfig) checkMD(rmds *RootMetadataSigned,
 	checkBRMD(c.t, c.uid, verifyingKey, c.Codec(), c.Crypto(),
 		rmds.MD, extra, expectedRevision, expectedPrevRoot,
 		expectedMergeStatus, expectedBranchID)
-	err := rmds.IsValidAndSigned(c.Codec(), c.Crypto(), extra)
+	err := rmds.IsValidAndSigned(
+		context.Background(), c.Codec(), c.Crypto(), nil, extra)
 	require.NoError(c.t, err)
 	err = rmds.IsLastModifiedBy(c.uid, verifyingKey)
 	require.NoError(c.t, err)
@@ -228,6 +242,7 @@ func setupTLFJournalTest(
 		t, log, tlf.FakeID(1, false), bsplitter, codec, crypto,
 		nil, nil, NewMDCacheStandard(10), ver,
 		NewReporterSimple(newTestClockNow(), 10), uid, verifyingKey, ekg, nil, mdserver, defaultDiskLimitMaxDelay + time.Second,
+		DefaultJournalLimits(),
 	}
 
 	ctx, cancel = context.WithTimeout(
@@ -265,7 +280,7 @@ func setupTLFJournalTest(
 	diskLimitSemaphore := newSemaphoreDiskLimiter(math.MaxInt64)
 	tlfJournal, err = makeTLFJournal(ctx, uid, verifyingKey,
 		tempdir, config.tlfID, config, delegateBlockServer,
-		bwStatus, delegate, nil, nil, diskLimitSemaphore)
+		bwStatus, delegate, nil, nil, diskLimitSemaphore, nil)
 	require.NoError(t, err)
 
 	switch bwStatus {
@@ -571,6 +586,26 @@ func testTLFJournalBlockOpDiskLimitTimeout(t *testing.T, ver MetadataVer) {
 	}, timeoutErr)
 }
 
+func testTLFJournalBlockOpDiskLimitFail(t *testing.T, ver MetadataVer) {
+	tempdir, config, ctx, cancel, tlfJournal, delegate :=
+		setupTLFJournalTest(t, ver, TLFJournalBackgroundWorkPaused)
+	defer teardownTLFJournalTest(
+		tempdir, config, ctx, cancel, tlfJournal, delegate)
+
+	tlfJournal.diskLimiter.onJournalEnable(ctx, math.MaxInt64, 0)
+	config.limits.FullPolicy = JournalFullFail
+
+	data := []byte{1, 2, 3, 4}
+	id, bCtx, serverHalf := config.makeBlock(data)
+	err := tlfJournal.putBlockData(ctx, id, bCtx, data, serverHalf)
+	require.Equal(t, ErrJournalFull{int64(len(data)), 0}, errors.Cause(err))
+
+	// Once there's room, the put goes through right away.
+	tlfJournal.diskLimiter.onJournalDisable(ctx, int64(len(data)), 0)
+	err = tlfJournal.putBlockData(ctx, id, bCtx, data, serverHalf)
+	require.NoError(t, err)
+}
+
 func testTLFJournalBlockOpDiskLimitPutFailure(t *testing.T, ver MetadataVer) {
 	tempdir, config, ctx, cancel, tlfJournal, delegate :=
 		setupTLFJournalTest(t, ver, TLFJournalBackgroundWorkPaused)
@@ -1198,6 +1233,7 @@ func TestTLFJournal(t *testing.T) {
 		testTLFJournalBlockOpDiskLimitDuplicate,
 		testTLFJournalBlockOpDiskLimitCancel,
 		testTLFJournalBlockOpDiskLimitTimeout,
+		testTLFJournalBlockOpDiskLimitFail,
 		testTLFJournalBlockOpDiskLimitPutFailure,
 		testTLFJournalFlushMDBasic,
 		testTLFJournalFlushMDConflict,
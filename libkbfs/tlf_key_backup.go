@@ -0,0 +1,132 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/net/context"
+)
+
+// TLFKeyBackup holds the crypt keys of every generation of a private
+// TLF, encrypted for a backup key (e.g., the crypt key of one of the
+// user's paper keys), so that they can be escrowed and later
+// restored on a device that hasn't been given access to the TLF.
+type TLFKeyBackup struct {
+	Tlf tlf.ID
+	// BackupKey is the public key that the TLF crypt keys are
+	// encrypted for.
+	BackupKey kbfscrypto.CryptPublicKey
+	// EPubKey is the ephemeral public key that, along with the
+	// private key of BackupKey, decrypts Keys.
+	EPubKey kbfscrypto.TLFEphemeralPublicKey
+	// Keys holds the TLF crypt keys, in order, starting from
+	// FirstValidKeyGen.
+	Keys EncryptedTLFCryptKeys
+}
+
+// makeTLFKeyBackupKey returns the symmetric key that the keys of a
+// TLFKeyBackup are encrypted with, given one party's public key and
+// the other party's private key.
+func makeTLFKeyBackupKey(
+	publicKey [32]byte, privateKey [32]byte) kbfscrypto.TLFCryptKey {
+	var sharedKey [32]byte
+	box.Precompute(&sharedKey, &publicKey, &privateKey)
+	return kbfscrypto.MakeTLFCryptKey(sharedKey)
+}
+
+// ExportTLFKeys returns the crypt keys of all generations of the
+// given private TLF, encrypted for backupKey. The current device
+// must be able to read the TLF.
+func ExportTLFKeys(ctx context.Context, config Config, tlfID tlf.ID,
+	backupKey kbfscrypto.CryptPublicKey) (TLFKeyBackup, error) {
+	if tlfID.IsPublic() {
+		return TLFKeyBackup{}, errors.Errorf(
+			"Public TLF %s has no keys to back up", tlfID)
+	}
+
+	head, err := config.MDOps().GetForTLF(ctx, tlfID)
+	if err != nil {
+		return TLFKeyBackup{}, err
+	}
+	if head == (ImmutableRootMetadata{}) {
+		return TLFKeyBackup{}, errors.WithStack(NoMergedMDError{tlfID})
+	}
+
+	keys, err := config.KeyManager().GetTLFCryptKeyOfAllGenerations(
+		ctx, head)
+	if err != nil {
+		return TLFKeyBackup{}, err
+	}
+
+	keypair, err := libkb.ImportKeypairFromKID(backupKey.KID())
+	if err != nil {
+		return TLFKeyBackup{}, errors.WithStack(err)
+	}
+	dhKeyPair, ok := keypair.(libkb.NaclDHKeyPair)
+	if !ok {
+		return TLFKeyBackup{}, errors.WithStack(
+			libkb.KeyCannotEncryptError{})
+	}
+
+	crypto := config.Crypto()
+	ePubKey, ePrivKey, err := crypto.MakeRandomTLFEphemeralKeys()
+	if err != nil {
+		return TLFKeyBackup{}, err
+	}
+	encryptedKeys, err := crypto.EncryptTLFCryptKeys(keys,
+		makeTLFKeyBackupKey(dhKeyPair.Public, ePrivKey.Data()))
+	if err != nil {
+		return TLFKeyBackup{}, err
+	}
+
+	return TLFKeyBackup{
+		Tlf:       tlfID,
+		BackupKey: backupKey,
+		EPubKey:   ePubKey,
+		Keys:      encryptedKeys,
+	}, nil
+}
+
+// ImportTLFKeys decrypts the keys in the given backup with the
+// private key it was made for, and puts them in the key cache, so
+// that the current device can read the TLF even if it has no keys
+// of its own for it. The keys are only kept in memory; to give the
+// current device permanent access, the TLF must then be rekeyed by
+// a writer, e.g. by calling KBFSOps.Rekey on this device. Returns
+// the number of key generations imported.
+func ImportTLFKeys(ctx context.Context, config Config, backup TLFKeyBackup,
+	backupKey kbfscrypto.CryptPrivateKey) (int, error) {
+	if backup.Tlf.IsPublic() {
+		return 0, errors.Errorf(
+			"Backup is for public TLF %s, which has no keys", backup.Tlf)
+	}
+	if backupKey.GetPublicKey() != backup.BackupKey {
+		return 0, errors.Errorf(
+			"Backup of TLF %s is for key %s, not %s", backup.Tlf,
+			backup.BackupKey, backupKey.GetPublicKey())
+	}
+
+	keys, err := config.Crypto().DecryptTLFCryptKeys(backup.Keys,
+		makeTLFKeyBackupKey(backup.EPubKey.Data(), backupKey.Data()))
+	if err != nil {
+		return 0, err
+	}
+
+	kcache := config.KeyCache()
+	for i, key := range keys {
+		err := kcache.PutTLFCryptKey(
+			backup.Tlf, FirstValidKeyGen+KeyGen(i), key)
+		if err != nil {
+			return 0, err
+		}
+	}
+	config.MakeLogger("").CDebugf(ctx, "Imported %d key generations "+
+		"for TLF %s", len(keys), backup.Tlf)
+	return len(keys), nil
+}
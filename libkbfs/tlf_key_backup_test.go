@@ -0,0 +1,63 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLFKeyBackup(t *testing.T) {
+	var userName libkb.NormalizedUsername = "test_user"
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, userName)
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, userName.String(), false)
+	tlfID := rootNode.GetFolderBranch().Tlf
+	err := config.KBFSOps().RotateKey(ctx, tlfID)
+	require.NoError(t, err)
+
+	head, err := config.MDOps().GetForTLF(ctx, tlfID)
+	require.NoError(t, err)
+	require.Equal(t, FirstValidKeyGen+1, head.LatestKeyGeneration())
+	expectedKeys, err := config.KeyManager().GetTLFCryptKeyOfAllGenerations(
+		ctx, head)
+	require.NoError(t, err)
+
+	kp, err := libkb.GenerateNaclDHKeyPair()
+	require.NoError(t, err)
+	backupKey := kbfscrypto.NewCryptPrivateKey(kp)
+	backup, err := ExportTLFKeys(ctx, config, tlfID, backupKey.GetPublicKey())
+	require.NoError(t, err)
+	require.Equal(t, tlfID, backup.Tlf)
+
+	// The backup must survive encoding.
+	buf, err := config.Codec().Encode(backup)
+	require.NoError(t, err)
+	var decodedBackup TLFKeyBackup
+	err = config.Codec().Decode(buf, &decodedBackup)
+	require.NoError(t, err)
+
+	// Only the right key can restore the backup.
+	kp2, err := libkb.GenerateNaclDHKeyPair()
+	require.NoError(t, err)
+	_, err = ImportTLFKeys(ctx, config, decodedBackup,
+		kbfscrypto.NewCryptPrivateKey(kp2))
+	require.Error(t, err)
+
+	config.SetKeyCache(NewKeyCacheStandard(100))
+	n, err := ImportTLFKeys(ctx, config, decodedBackup, backupKey)
+	require.NoError(t, err)
+	require.Equal(t, len(expectedKeys), n)
+	for i, expectedKey := range expectedKeys {
+		key, err := config.KeyCache().GetTLFCryptKey(
+			tlfID, FirstValidKeyGen+KeyGen(i))
+		require.NoError(t, err)
+		require.Equal(t, expectedKey, key)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+
+	"github.com/keybase/go-codec/codec"
+)
+
+// TlfSettings holds the settings of a TLF that are shared by all of
+// the devices that access it. They're kept in the (encrypted) private
+// metadata of each revision, and changed with a settingsOp, so they
+// propagate to other devices along with the rest of the TLF's
+// updates. The zero value means the defaults for everything.
+//
+// NOTE: Don't change the meaning of the zero value of any field
+// without considering how old clients will handle it.
+type TlfSettings struct {
+	// SyncEnabled is whether devices should keep a full copy of
+	// the TLF locally, rather than fetching blocks on demand.
+	SyncEnabled bool `codec:"s,omitempty"`
+	// BlockSize is the preferred maximum size of the TLF's file
+	// blocks, in bytes, or 0 to use the configured block
+	// splitter's default.
+	BlockSize int64 `codec:"bs,omitempty"`
+	// JournalDisabled is whether writes to the TLF should skip
+	// the local journal (when journaling is otherwise enabled)
+	// and go straight to the servers.
+	JournalDisabled bool `codec:"jd,omitempty"`
+
+	codec.UnknownFieldSetHandler
+}
+
+func (s TlfSettings) checkValid() error {
+	if s.BlockSize < 0 {
+		return fmt.Errorf("Negative block size %d", s.BlockSize)
+	}
+	return nil
+}
+
+func (s TlfSettings) String() string {
+	return fmt.Sprintf("{SyncEnabled: %t, BlockSize: %d, "+
+		"JournalDisabled: %t}", s.SyncEnabled, s.BlockSize,
+		s.JournalDisabled)
+}
@@ -0,0 +1,399 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/pkg/errors"
+)
+
+// TlfSyncMode says how much of a TLF is kept on this device.
+type TlfSyncMode int
+
+const (
+	// TlfSyncModeCached is the default mode. Blocks are fetched
+	// on demand, along with prefetched blocks that are likely to
+	// be read next, and are only kept in memory (or, for writes,
+	// in the journal until they're flushed).
+	TlfSyncModeCached TlfSyncMode = iota
+	// TlfSyncModeFull keeps all of the TLF's blocks on local
+	// disk, and keeps them up to date as the TLF changes, so that
+	// it can be read while offline.
+	TlfSyncModeFull
+	// TlfSyncModeExcluded keeps as little of the TLF on this
+	// device as possible: blocks are only fetched when they're
+	// actually read, nothing is prefetched, and writes don't go
+	// through an automatically-enabled journal.
+	TlfSyncModeExcluded
+)
+
+func (m TlfSyncMode) String() string {
+	switch m {
+	case TlfSyncModeCached:
+		return "cached"
+	case TlfSyncModeFull:
+		return "full"
+	case TlfSyncModeExcluded:
+		return "excluded"
+	default:
+		return fmt.Sprintf("TlfSyncMode(%d)", int(m))
+	}
+}
+
+// tlfSyncCacheConfig is the part of a tlfSyncCache's state that
+// isn't implied by its block stores.
+type tlfSyncCacheConfig struct {
+	Excluded []tlf.ID
+}
+
+// tlfSyncStore is the block store of one synced TLF.
+type tlfSyncStore struct {
+	// lock serializes access to store, which isn't goroutine-safe.
+	lock  sync.RWMutex
+	store *blockDiskStore
+	// removed is set once the TLF stops being synced, and its
+	// blocks are about to be deleted. Protected by lock.
+	removed bool
+}
+
+// tlfSyncCache keeps track of the sync mode of every TLF on this
+// device, and keeps the encrypted blocks of the TLFs that are fully
+// synced to this device ("pinned") on local disk, so that those TLFs
+// stay readable while offline.
+//
+// The directory layout looks like:
+//
+// dir/config.json
+// dir/<tlf ID>/<block store>
+//
+// where each block store is a blockDiskStore. A TLF is fully synced
+// exactly when its directory exists, so the set of synced TLFs
+// survives restarts without any extra state. config.json lists the
+// excluded TLFs; every other TLF is in TlfSyncModeCached.
+//
+// Blocks are deleted again once an applied revision of their TLF
+// unreferences them. Revisions that are skipped over, e.g. when the
+// head is fast-forwarded, can leave blocks behind until the TLF is
+// synced again.
+//
+// Like the journal, this only ever stores blocks as they come from
+// the block server, i.e. encrypted. Decrypting them also needs the
+// TLF crypt key, which is never written to disk, so the cache doesn't
+// add a layer of encryption of its own.
+//
+// A nil *tlfSyncCache is valid, and has every TLF in
+// TlfSyncModeCached.
+type tlfSyncCache struct {
+	codec kbfscodec.Codec
+	log   logger.Logger
+	dir   string
+
+	// modeLock serializes mode changes, including the disk IO
+	// they do outside of lock.
+	modeLock sync.Mutex
+
+	// lock protects everything below. No disk IO happens while
+	// it's held; each store has a lock of its own for that.
+	lock     sync.RWMutex
+	stores   map[tlf.ID]*tlfSyncStore
+	excluded map[tlf.ID]bool
+	// generations changes every time a TLF becomes synced, so
+	// that anyone tracking which blocks are on disk can tell
+	// when the TLF's blocks were deleted in the meantime.
+	generations    map[tlf.ID]uint64
+	lastGeneration uint64
+}
+
+// makeTlfSyncCache returns a tlfSyncCache rooted at dir, picking up
+// any TLFs that were synced by a previous run.
+func makeTlfSyncCache(codec kbfscodec.Codec, log logger.Logger,
+	dir string) (*tlfSyncCache, error) {
+	err := ioutil.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &tlfSyncCache{
+		codec:       codec,
+		log:         log,
+		dir:         dir,
+		stores:      make(map[tlf.ID]*tlfSyncStore),
+		excluded:    make(map[tlf.ID]bool),
+		generations: make(map[tlf.ID]uint64),
+	}
+	var config tlfSyncCacheConfig
+	err = ioutil.DeserializeFromJSONFile(c.configPath(), &config)
+	switch {
+	case ioutil.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		for _, tlfID := range config.Excluded {
+			c.excluded[tlfID] = true
+		}
+	}
+	for _, fi := range fileInfos {
+		if !fi.IsDir() {
+			continue
+		}
+		tlfID, err := tlf.ParseID(fi.Name())
+		if err != nil {
+			log.Debug("Skipping non-TLF dir %q in %s", fi.Name(), dir)
+			continue
+		}
+		c.stores[tlfID] = &tlfSyncStore{store: makeBlockDiskStore(
+			codec, filepath.Join(dir, tlfID.String()))}
+		c.lastGeneration++
+		c.generations[tlfID] = c.lastGeneration
+	}
+	return c, nil
+}
+
+func (c *tlfSyncCache) tlfDir(tlfID tlf.ID) string {
+	return filepath.Join(c.dir, tlfID.String())
+}
+
+func (c *tlfSyncCache) configPath() string {
+	return filepath.Join(c.dir, "config.json")
+}
+
+// writeConfig must be called with modeLock held.
+func (c *tlfSyncCache) writeConfig() error {
+	c.lock.RLock()
+	config := tlfSyncCacheConfig{
+		Excluded: make([]tlf.ID, 0, len(c.excluded)),
+	}
+	for tlfID := range c.excluded {
+		config.Excluded = append(config.Excluded, tlfID)
+	}
+	c.lock.RUnlock()
+	return ioutil.SerializeToJSONFile(config, c.configPath())
+}
+
+func (c *tlfSyncCache) modeLocked(tlfID tlf.ID) TlfSyncMode {
+	if _, ok := c.stores[tlfID]; ok {
+		return TlfSyncModeFull
+	}
+	if c.excluded[tlfID] {
+		return TlfSyncModeExcluded
+	}
+	return TlfSyncModeCached
+}
+
+// mode returns the sync mode of the given TLF on this device.
+func (c *tlfSyncCache) mode(tlfID tlf.ID) TlfSyncMode {
+	if c == nil {
+		return TlfSyncModeCached
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.modeLocked(tlfID)
+}
+
+// isSynced returns whether the given TLF is fully synced to this
+// device.
+func (c *tlfSyncCache) isSynced(tlfID tlf.ID) bool {
+	return c.mode(tlfID) == TlfSyncModeFull
+}
+
+// generation returns a number that changes every time the given TLF
+// becomes synced, or 0 if it isn't synced.
+func (c *tlfSyncCache) generation(tlfID tlf.ID) uint64 {
+	if c == nil {
+		return 0
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.generations[tlfID]
+}
+
+// setMode changes the sync mode of the given TLF on this
+// device. Leaving TlfSyncModeFull deletes all the TLF's blocks from
+// disk.
+func (c *tlfSyncCache) setMode(tlfID tlf.ID, mode TlfSyncMode) error {
+	switch mode {
+	case TlfSyncModeCached, TlfSyncModeFull, TlfSyncModeExcluded:
+	default:
+		return errors.Errorf("Unknown sync mode %s", mode)
+	}
+	if c == nil {
+		if mode == TlfSyncModeCached {
+			return nil
+		}
+		return errors.New("Syncing TLFs to this device isn't enabled")
+	}
+	c.modeLock.Lock()
+	defer c.modeLock.Unlock()
+	oldMode := c.mode(tlfID)
+	if oldMode == mode {
+		return nil
+	}
+
+	dir := c.tlfDir(tlfID)
+	switch oldMode {
+	case TlfSyncModeFull:
+		c.lock.Lock()
+		s := c.stores[tlfID]
+		delete(c.stores, tlfID)
+		delete(c.generations, tlfID)
+		c.lock.Unlock()
+		// Wait out anyone still using the store.
+		s.lock.Lock()
+		s.removed = true
+		s.lock.Unlock()
+		err := ioutil.RemoveAll(dir)
+		if err != nil {
+			return err
+		}
+	case TlfSyncModeExcluded:
+		c.lock.Lock()
+		delete(c.excluded, tlfID)
+		c.lock.Unlock()
+		err := c.writeConfig()
+		if err != nil {
+			return err
+		}
+	}
+
+	switch mode {
+	case TlfSyncModeFull:
+		err := ioutil.MkdirAll(dir, 0700)
+		if err != nil {
+			return err
+		}
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.stores[tlfID] = &tlfSyncStore{
+			store: makeBlockDiskStore(c.codec, dir),
+		}
+		c.lastGeneration++
+		c.generations[tlfID] = c.lastGeneration
+	case TlfSyncModeExcluded:
+		c.lock.Lock()
+		c.excluded[tlfID] = true
+		c.lock.Unlock()
+		return c.writeConfig()
+	}
+	return nil
+}
+
+// getStore returns the store of the given TLF, or nil if the TLF
+// isn't synced. The caller must check that it hasn't been removed
+// once it has locked it.
+func (c *tlfSyncCache) getStore(tlfID tlf.ID) *tlfSyncStore {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.stores[tlfID]
+}
+
+// get returns the encrypted data and server half of the given block,
+// if the block's TLF is synced and the block is on disk. ok is false
+// if it isn't.
+func (c *tlfSyncCache) get(tlfID tlf.ID, ptr BlockPointer) (
+	buf []byte, serverHalf kbfscrypto.BlockCryptKeyServerHalf,
+	ok bool, err error) {
+	if c == nil {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, false, nil
+	}
+	s := c.getStore(tlfID)
+	if s == nil {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, false, nil
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.removed {
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, false, nil
+	}
+	buf, serverHalf, err = s.store.getData(ptr.ID)
+	switch errors.Cause(err).(type) {
+	case nil:
+		return buf, serverHalf, true, nil
+	case blockNonExistentError:
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, false, nil
+	default:
+		return nil, kbfscrypto.BlockCryptKeyServerHalf{}, false, err
+	}
+}
+
+// put stores the given encrypted block on disk, if its TLF is
+// synced. Otherwise it does nothing.
+func (c *tlfSyncCache) put(tlfID tlf.ID, ptr BlockPointer, buf []byte,
+	serverHalf kbfscrypto.BlockCryptKeyServerHalf) error {
+	if c == nil {
+		return nil
+	}
+	s := c.getStore(tlfID)
+	if s == nil {
+		return nil
+	}
+	// Block stores write files, so take the write lock.
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.removed {
+		return nil
+	}
+	_, err := s.store.put(ptr.ID, ptr.Context, buf, serverHalf, "")
+	return err
+}
+
+// remove drops the references of the given pointers from the blocks
+// on disk, if their TLF is synced, and deletes the blocks that are
+// left without any. It returns the IDs of the deleted blocks.
+func (c *tlfSyncCache) remove(tlfID tlf.ID, ptrs []BlockPointer) (
+	removed []kbfsblock.ID, err error) {
+	if c == nil || len(ptrs) == 0 {
+		return nil, nil
+	}
+	s := c.getStore(tlfID)
+	if s == nil {
+		return nil, nil
+	}
+	contexts := make(map[kbfsblock.ID][]kbfsblock.Context)
+	for _, ptr := range ptrs {
+		contexts[ptr.ID] = append(contexts[ptr.ID], ptr.Context)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.removed {
+		return nil, nil
+	}
+	for id, idContexts := range contexts {
+		hasRef, err := s.store.hasAnyRef(id)
+		if err != nil {
+			return removed, err
+		}
+		if !hasRef {
+			// Never synced, or already gone.
+			continue
+		}
+		liveCount, err := s.store.removeReferences(id, idContexts, "")
+		if err != nil {
+			return removed, err
+		}
+		if liveCount > 0 {
+			continue
+		}
+		err = s.store.remove(id)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, id)
+	}
+	return removed, nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/client/go/protocol/keybase1"
+	"github.com/keybase/kbfs/ioutil"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscodec"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/keybase/kbfs/tlf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTlfSyncCache(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "tlf_sync_cache")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		assert.NoError(t, err)
+	}()
+
+	codec := kbfscodec.NewMsgpack()
+	log := logger.NewTestLogger(t)
+	c, err := makeTlfSyncCache(codec, log, tempdir)
+	require.NoError(t, err)
+
+	data := []byte{1, 2, 3, 4}
+	id, err := kbfsblock.MakePermanentID(data)
+	require.NoError(t, err)
+	ptr := BlockPointer{
+		ID:      id,
+		Context: kbfsblock.MakeFirstContext(keybase1.MakeTestUID(1)),
+	}
+	serverHalf, err := kbfscrypto.MakeRandomBlockCryptKeyServerHalf()
+	require.NoError(t, err)
+
+	// Blocks of unsynced TLFs aren't kept.
+	tlfID := tlf.FakeID(1, false)
+	require.False(t, c.isSynced(tlfID))
+	require.Equal(t, uint64(0), c.generation(tlfID))
+	err = c.put(tlfID, ptr, data, serverHalf)
+	require.NoError(t, err)
+	_, _, ok, err := c.get(tlfID, ptr)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	err = c.setMode(tlfID, TlfSyncModeFull)
+	require.NoError(t, err)
+	require.True(t, c.isSynced(tlfID))
+	gen := c.generation(tlfID)
+	require.NotEqual(t, uint64(0), gen)
+	_, _, ok, err = c.get(tlfID, ptr)
+	require.NoError(t, err)
+	require.False(t, ok)
+	err = c.put(tlfID, ptr, data, serverHalf)
+	require.NoError(t, err)
+	gotData, gotServerHalf, ok, err := c.get(tlfID, ptr)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, data, gotData)
+	require.Equal(t, serverHalf, gotServerHalf)
+
+	// A new cache on the same dir picks up the synced TLF.
+	c2, err := makeTlfSyncCache(codec, log, tempdir)
+	require.NoError(t, err)
+	require.True(t, c2.isSynced(tlfID))
+	_, _, ok, err = c2.get(tlfID, ptr)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Unsyncing deletes the blocks, and re-syncing starts a new
+	// generation.
+	err = c.setMode(tlfID, TlfSyncModeCached)
+	require.NoError(t, err)
+	require.False(t, c.isSynced(tlfID))
+	err = c.setMode(tlfID, TlfSyncModeFull)
+	require.NoError(t, err)
+	require.NotEqual(t, gen, c.generation(tlfID))
+	_, _, ok, err = c.get(tlfID, ptr)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// A nil cache has nothing synced, and can't sync anything.
+	var nilCache *tlfSyncCache
+	require.False(t, nilCache.isSynced(tlfID))
+	require.Equal(t, TlfSyncModeCached, nilCache.mode(tlfID))
+	require.NoError(t, nilCache.put(tlfID, ptr, data, serverHalf))
+	require.Error(t, nilCache.setMode(tlfID, TlfSyncModeFull))
+	require.Error(t, nilCache.setMode(tlfID, TlfSyncModeExcluded))
+	require.NoError(t, nilCache.setMode(tlfID, TlfSyncModeCached))
+}
+
+func TestTlfSyncCacheExcluded(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "tlf_sync_cache")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		assert.NoError(t, err)
+	}()
+
+	codec := kbfscodec.NewMsgpack()
+	log := logger.NewTestLogger(t)
+	c, err := makeTlfSyncCache(codec, log, tempdir)
+	require.NoError(t, err)
+
+	tlfID := tlf.FakeID(1, false)
+	otherTlfID := tlf.FakeID(2, false)
+	require.Equal(t, TlfSyncModeCached, c.mode(tlfID))
+
+	err = c.setMode(tlfID, TlfSyncModeExcluded)
+	require.NoError(t, err)
+	require.Equal(t, TlfSyncModeExcluded, c.mode(tlfID))
+	require.False(t, c.isSynced(tlfID))
+	err = c.setMode(otherTlfID, TlfSyncModeFull)
+	require.NoError(t, err)
+
+	// A new cache on the same dir picks up both modes.
+	c2, err := makeTlfSyncCache(codec, log, tempdir)
+	require.NoError(t, err)
+	require.Equal(t, TlfSyncModeExcluded, c2.mode(tlfID))
+	require.Equal(t, TlfSyncModeFull, c2.mode(otherTlfID))
+
+	// Going straight from excluded to fully synced works, and
+	// isn't excluded any more after a restart.
+	err = c2.setMode(tlfID, TlfSyncModeFull)
+	require.NoError(t, err)
+	require.Equal(t, TlfSyncModeFull, c2.mode(tlfID))
+	require.NotEqual(t, uint64(0), c2.generation(tlfID))
+	c3, err := makeTlfSyncCache(codec, log, tempdir)
+	require.NoError(t, err)
+	require.Equal(t, TlfSyncModeFull, c3.mode(tlfID))
+
+	err = c3.setMode(tlfID, TlfSyncMode(100))
+	require.Error(t, err)
+}
+
+func TestTlfSyncCacheRemove(t *testing.T) {
+	tempdir, err := ioutil.TempDir(os.TempDir(), "tlf_sync_cache")
+	require.NoError(t, err)
+	defer func() {
+		err := ioutil.RemoveAll(tempdir)
+		assert.NoError(t, err)
+	}()
+
+	c, err := makeTlfSyncCache(
+		kbfscodec.NewMsgpack(), logger.NewTestLogger(t), tempdir)
+	require.NoError(t, err)
+	tlfID := tlf.FakeID(1, false)
+	err = c.setMode(tlfID, TlfSyncModeFull)
+	require.NoError(t, err)
+
+	data := []byte{1, 2, 3, 4}
+	id, err := kbfsblock.MakePermanentID(data)
+	require.NoError(t, err)
+	uid := keybase1.MakeTestUID(1)
+	ptr := BlockPointer{ID: id, Context: kbfsblock.MakeFirstContext(uid)}
+	nonce, err := kbfsblock.MakeRefNonce()
+	require.NoError(t, err)
+	dedupPtr := BlockPointer{
+		ID: id, Context: kbfsblock.MakeContext(uid, uid, nonce),
+	}
+	serverHalf, err := kbfscrypto.MakeRandomBlockCryptKeyServerHalf()
+	require.NoError(t, err)
+	err = c.put(tlfID, ptr, data, serverHalf)
+	require.NoError(t, err)
+	err = c.put(tlfID, dedupPtr, data, serverHalf)
+	require.NoError(t, err)
+
+	// The block stays as long as any pointer to it is left.
+	removed, err := c.remove(tlfID, []BlockPointer{ptr})
+	require.NoError(t, err)
+	require.Len(t, removed, 0)
+	_, _, ok, err := c.get(tlfID, dedupPtr)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	removed, err = c.remove(tlfID, []BlockPointer{dedupPtr})
+	require.NoError(t, err)
+	require.Equal(t, []kbfsblock.ID{id}, removed)
+	_, _, ok, err = c.get(tlfID, dedupPtr)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Removing blocks that aren't on disk is fine.
+	removed, err = c.remove(tlfID, []BlockPointer{ptr})
+	require.NoError(t, err)
+	require.Len(t, removed, 0)
+}
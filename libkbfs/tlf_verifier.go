@@ -0,0 +1,295 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/tlf"
+	"golang.org/x/net/context"
+)
+
+// TlfVerifyReport describes the problems, if any, that a TlfVerifier
+// found with a TLF.
+type TlfVerifyReport struct {
+	// Head is the latest merged revision of the TLF, or
+	// MetadataRevisionUninitialized if it has no history.
+	Head MetadataRevision
+	// BadRevisions maps each revision that couldn't be fetched
+	// or verified (e.g., because its signature is bad), or that
+	// isn't a valid successor of the previous revision, to the
+	// corresponding error.
+	BadRevisions map[MetadataRevision]error
+	// NumCheckedBlocks is the number of block references that
+	// were checked against the block server.
+	NumCheckedBlocks int
+	// MissingBlocks maps each block referenced by the MD history
+	// that the block server doesn't have, or whose data doesn't
+	// match its ID, to the corresponding error.
+	MissingBlocks map[BlockPointer]error
+	// CheckedOrphans is whether the block server could be asked
+	// for all the blocks it has for the TLF. Only local block
+	// servers support this.
+	CheckedOrphans bool
+	// OrphanedBlocks lists the blocks the block server has for
+	// the TLF which aren't referenced by the MD history, if
+	// CheckedOrphans is set.
+	OrphanedBlocks []kbfsblock.ID
+}
+
+// IsConsistent returns whether no problems were found.
+func (r TlfVerifyReport) IsConsistent() bool {
+	return len(r.BadRevisions) == 0 && len(r.MissingBlocks) == 0 &&
+		len(r.OrphanedBlocks) == 0
+}
+
+// TlfVerifier verifies the server-side state of a TLF: that its
+// merged MD history is a properly-signed hash chain, and that every
+// block referenced by that history is present on the block server.
+// Unlike StateChecker, it doesn't depend on any client-side state,
+// so it can be run against remote servers; however, it still keeps
+// the set of referenced blocks in memory.
+type TlfVerifier struct {
+	config Config
+	log    logger.Logger
+}
+
+// NewTlfVerifier returns a new TlfVerifier instance.
+func NewTlfVerifier(config Config) *TlfVerifier {
+	return &TlfVerifier{config, config.MakeLogger("")}
+}
+
+// getRange returns the merged MD objects for the given range,
+// indexed by revision. MDOps verifies the signatures of everything
+// it returns, so if fetching the whole range fails, each revision is
+// fetched separately to find out which ones are bad.
+func (v *TlfVerifier) getRange(ctx context.Context, tlfID tlf.ID,
+	start, end MetadataRevision, report *TlfVerifyReport) (
+	map[MetadataRevision]ImmutableRootMetadata, error) {
+	rmds, err := v.config.MDOps().GetRange(ctx, tlfID, start, end)
+	if err != nil {
+		v.log.CDebugf(ctx, "Couldn't get revisions %d to %d; "+
+			"fetching them one at a time: %+v", start, end, err)
+		rmds = nil
+		for rev := start; rev <= end; rev++ {
+			revRmds, err := v.config.MDOps().GetRange(
+				ctx, tlfID, rev, rev)
+			if err := checkContext(ctx); err != nil {
+				return nil, err
+			}
+			if err != nil {
+				report.BadRevisions[rev] = err
+				continue
+			}
+			rmds = append(rmds, revRmds...)
+		}
+	}
+
+	rmdsByRev := make(map[MetadataRevision]ImmutableRootMetadata)
+	for _, rmd := range rmds {
+		rmdsByRev[rmd.Revision()] = rmd
+	}
+	for rev := start; rev <= end; rev++ {
+		if _, ok := rmdsByRev[rev]; !ok && report.BadRevisions[rev] == nil {
+			report.BadRevisions[rev] = fmt.Errorf(
+				"Revision %d is missing", rev)
+		}
+	}
+	return rmdsByRev, nil
+}
+
+type blockIDList []kbfsblock.ID
+
+func (l blockIDList) Len() int           { return len(l) }
+func (l blockIDList) Less(i, j int) bool { return l[i].String() < l[j].String() }
+func (l blockIDList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// tlfVerifierBlocks tracks the blocks referenced by an MD history as
+// it's replayed, much like StateChecker.CheckMergedState.
+type tlfVerifierBlocks struct {
+	// live maps each block that's referenced by the latest
+	// revision seen so far to the revision that referenced it.
+	live map[BlockPointer]MetadataRevision
+	// archived maps each block that's been unreferenced, but not
+	// yet garbage-collected, to the revision that unreferenced it.
+	archived map[BlockPointer]MetadataRevision
+}
+
+func (b tlfVerifierBlocks) unref(
+	ptr BlockPointer, rev MetadataRevision, deleted bool) {
+	delete(b.live, ptr)
+	if ptr == zeroPtr {
+		return
+	}
+	if deleted {
+		delete(b.archived, ptr)
+	} else {
+		b.archived[ptr] = rev
+	}
+}
+
+func (b tlfVerifierBlocks) replay(rmd ImmutableRootMetadata) {
+	// Copies don't change anything.
+	if rmd.IsWriterMetadataCopiedSet() {
+		return
+	}
+
+	for _, op := range rmd.Data().Changes.Ops {
+		if gcOp, ok := op.(*GCOp); ok {
+			// Garbage-collected blocks are deleted from
+			// the block server.
+			for _, ptr := range gcOp.Unrefs() {
+				delete(b.archived, ptr)
+			}
+			continue
+		}
+
+		opRefs := make(map[BlockPointer]bool)
+		for _, ptr := range op.Refs() {
+			if ptr != zeroPtr {
+				b.live[ptr] = rmd.Revision()
+				opRefs[ptr] = true
+			}
+		}
+		for _, ptr := range op.Unrefs() {
+			// A pointer referenced and unreferenced by
+			// the same op indicates a failed and retried
+			// sync, and its block is already cleaned up.
+			b.unref(ptr, rmd.Revision(), opRefs[ptr])
+		}
+		for _, update := range op.allUpdates() {
+			if update.Ref != update.Unref {
+				b.unref(update.Unref, rmd.Revision(), false)
+			}
+			if update.Ref != zeroPtr {
+				b.live[update.Ref] = rmd.Revision()
+			}
+		}
+	}
+}
+
+// checkBlock makes sure the block server has the given block
+// reference, and that the block's data matches its ID.
+func (v *TlfVerifier) checkBlock(
+	ctx context.Context, tlfID tlf.ID, ptr BlockPointer) error {
+	buf, _, err := v.config.BlockServer().Get(ctx, tlfID, ptr.ID, ptr.Context)
+	if err != nil {
+		return err
+	}
+	return kbfsblock.VerifyID(buf, ptr.ID)
+}
+
+// getLocalBlockServer returns the block server, if it can list all
+// the blocks it has for a TLF.
+func (v *TlfVerifier) getLocalBlockServer() (blockServerLocal, bool) {
+	bserver := v.config.BlockServer()
+	if jbs, ok := bserver.(journalBlockServer); ok {
+		bserver = jbs.BlockServer
+	}
+	bserverLocal, ok := bserver.(blockServerLocal)
+	return bserverLocal, ok
+}
+
+// Verify walks the whole merged MD history of the given TLF, and
+// returns a report of everything wrong with it. An error is returned
+// only if the verification itself couldn't be done.
+func (v *TlfVerifier) Verify(ctx context.Context, tlfID tlf.ID) (
+	TlfVerifyReport, error) {
+	report := TlfVerifyReport{
+		Head:          MetadataRevisionUninitialized,
+		BadRevisions:  make(map[MetadataRevision]error),
+		MissingBlocks: make(map[BlockPointer]error),
+	}
+
+	head, err := v.config.MDOps().GetForTLF(ctx, tlfID)
+	if err != nil {
+		return TlfVerifyReport{}, err
+	}
+	if head == (ImmutableRootMetadata{}) {
+		v.log.CDebugf(ctx, "No history to verify for folder %s", tlfID)
+		return report, nil
+	}
+	report.Head = head.Revision()
+
+	blocks := tlfVerifierBlocks{
+		live:     make(map[BlockPointer]MetadataRevision),
+		archived: make(map[BlockPointer]MetadataRevision),
+	}
+	var prev ImmutableRootMetadata
+	for start := MetadataRevisionInitial; start <= report.Head; start += maxMDsAtATime {
+		end := start + maxMDsAtATime - 1 // range is inclusive
+		if end > report.Head {
+			end = report.Head
+		}
+		rmdsByRev, err := v.getRange(ctx, tlfID, start, end, &report)
+		if err != nil {
+			return TlfVerifyReport{}, err
+		}
+
+		for rev := start; rev <= end; rev++ {
+			rmd, ok := rmdsByRev[rev]
+			if !ok {
+				continue
+			}
+			// If the previous revision is bad, it's
+			// already been reported, and there's nothing
+			// to check this one against.
+			if prev != (ImmutableRootMetadata{}) &&
+				prev.Revision() == rev-1 {
+				err := prev.CheckValidSuccessor(
+					prev.MdID(), rmd.ReadOnly())
+				if err != nil {
+					report.BadRevisions[rev] = err
+				}
+			}
+			blocks.replay(rmd)
+			prev = rmd
+		}
+	}
+
+	v.log.CDebugf(ctx, "Folder %s has %d live and %d archived blocks "+
+		"as of revision %d", tlfID, len(blocks.live),
+		len(blocks.archived), report.Head)
+
+	referencedIDs := make(map[kbfsblock.ID]bool)
+	for _, ptrs := range []map[BlockPointer]MetadataRevision{
+		blocks.live, blocks.archived} {
+		for ptr, rev := range ptrs {
+			referencedIDs[ptr.ID] = true
+			report.NumCheckedBlocks++
+			err := v.checkBlock(ctx, tlfID, ptr)
+			if err := checkContext(ctx); err != nil {
+				return TlfVerifyReport{}, err
+			}
+			if err != nil {
+				v.log.CDebugf(ctx, "Block %v (last changed in "+
+					"revision %d) is bad: %+v", ptr, rev, err)
+				report.MissingBlocks[ptr] = err
+			}
+		}
+	}
+
+	bserverLocal, ok := v.getLocalBlockServer()
+	if !ok {
+		v.log.CDebugf(ctx, "Not checking for orphaned blocks "+
+			"with block server %T", v.config.BlockServer())
+		return report, nil
+	}
+	knownRefs, err := bserverLocal.getAllRefsForTest(ctx, tlfID)
+	if err != nil {
+		return TlfVerifyReport{}, err
+	}
+	report.CheckedOrphans = true
+	for id := range knownRefs {
+		if !referencedIDs[id] {
+			report.OrphanedBlocks = append(report.OrphanedBlocks, id)
+		}
+	}
+	sort.Sort(blockIDList(report.OrphanedBlocks))
+	return report, nil
+}
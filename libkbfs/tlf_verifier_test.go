@@ -0,0 +1,69 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"github.com/keybase/client/go/libkb"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/keybase/kbfs/kbfscrypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTlfVerifier(t *testing.T) {
+	var userName libkb.NormalizedUsername = "test_user"
+	config, uid, ctx, cancel := kbfsOpsInitNoMocks(t, userName)
+	// The state is deliberately broken below.
+	defer kbfsTestShutdownNoMocksNoCheck(t, config, ctx, cancel)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, userName.String(), false)
+	kbfsOps := config.KBFSOps()
+	fileNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+	err = kbfsOps.Write(ctx, fileNode, []byte("hello"), 0)
+	require.NoError(t, err)
+	err = kbfsOps.Sync(ctx, fileNode)
+	require.NoError(t, err)
+	_, _, err = kbfsOps.CreateDir(ctx, rootNode, "b")
+	require.NoError(t, err)
+
+	tlfID := rootNode.GetFolderBranch().Tlf
+	v := NewTlfVerifier(config)
+	report, err := v.Verify(ctx, tlfID)
+	require.NoError(t, err)
+	require.True(t, report.IsConsistent(), "%+v", report)
+	require.True(t, report.CheckedOrphans)
+	require.NotZero(t, report.NumCheckedBlocks)
+
+	// Remove the current root block from the block server, and
+	// add a block that isn't referenced by anything.
+	md, err := config.MDOps().GetForTLF(ctx, tlfID)
+	require.NoError(t, err)
+	require.Equal(t, md.Revision(), report.Head)
+	rootPtr := md.Data().Dir.BlockPointer
+	_, err = config.BlockServer().RemoveBlockReferences(ctx, tlfID,
+		map[kbfsblock.ID][]kbfsblock.Context{
+			rootPtr.ID: {rootPtr.Context},
+		})
+	require.NoError(t, err)
+
+	data := []byte{1, 2, 3, 4}
+	orphanID, err := kbfsblock.MakePermanentID(data)
+	require.NoError(t, err)
+	serverHalf, err := kbfscrypto.MakeRandomBlockCryptKeyServerHalf()
+	require.NoError(t, err)
+	err = config.BlockServer().Put(ctx, tlfID, orphanID,
+		kbfsblock.MakeFirstContext(uid), data, serverHalf)
+	require.NoError(t, err)
+
+	report, err = v.Verify(ctx, tlfID)
+	require.NoError(t, err)
+	require.False(t, report.IsConsistent())
+	require.Len(t, report.BadRevisions, 0)
+	require.Len(t, report.MissingBlocks, 1)
+	require.Contains(t, report.MissingBlocks, rootPtr)
+	require.Equal(t, []kbfsblock.ID{orphanID}, report.OrphanedBlocks)
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"fmt"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// UserAlertType says which condition a UserAlert is about.
+type UserAlertType int
+
+const (
+	// UserAlertAuthFailed means KBFS couldn't authenticate to one
+	// of its servers, e.g. because the user is logged out or the
+	// device was revoked.
+	UserAlertAuthFailed UserAlertType = iota
+	// UserAlertOverQuota means a write went over the user's
+	// storage quota.
+	UserAlertOverQuota
+	// UserAlertRekeyNeeded means a TLF can't be read until it is
+	// rekeyed, either by this user or by another one.
+	UserAlertRekeyNeeded
+	// UserAlertConflictCreated means conflict resolution made a
+	// conflicted copy of a file, which the user has to reconcile
+	// with the original by hand.
+	UserAlertConflictCreated
+)
+
+func (t UserAlertType) String() string {
+	switch t {
+	case UserAlertAuthFailed:
+		return "auth failed"
+	case UserAlertOverQuota:
+		return "over quota"
+	case UserAlertRekeyNeeded:
+		return "rekey needed"
+	case UserAlertConflictCreated:
+		return "conflict created"
+	default:
+		return fmt.Sprintf("UserAlertType(%d)", int(t))
+	}
+}
+
+// UserAlert describes a condition the user can do something about.
+type UserAlert struct {
+	Type UserAlertType
+	// Service is the server involved, for UserAlertAuthFailed.
+	Service string
+	// TlfName and Public identify the TLF involved, if any.
+	TlfName CanonicalTlfName
+	Public  bool
+	// Filename is the canonical path of the file involved, if
+	// any; for UserAlertConflictCreated, it is the path of the
+	// conflicted copy, and Original is the path of the file it
+	// conflicts with.
+	Filename string
+	Original string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// UserAlerterLog is a UserAlerter that just logs every alert.  It is
+// the default until a frontend sets its own.
+type UserAlerterLog struct {
+	log logger.Logger
+}
+
+var _ UserAlerter = UserAlerterLog{}
+
+// NewUserAlerterLog makes a new UserAlerterLog.
+func NewUserAlerterLog(log logger.Logger) UserAlerterLog {
+	return UserAlerterLog{log}
+}
+
+// AlertUser implements the UserAlerter interface for UserAlerterLog.
+func (u UserAlerterLog) AlertUser(ctx context.Context, alert UserAlert) {
+	u.log.CWarningf(ctx, "User alert (%s): %+v", alert.Type, alert)
+}
+
+// isAuthError returns whether err means a server rejected our
+// credentials, or that we have none.
+func isAuthError(err error) bool {
+	switch errors.Cause(err).(type) {
+	case MDServerErrorUnauthorized, kbfsblock.BServerErrorUnauthorized,
+		NoCurrentSessionError:
+		return true
+	default:
+		return false
+	}
+}
+
+// alertUserOnConnectError raises a UserAlertAuthFailed if err, from
+// a failed connection to the given service, is an authentication
+// error.
+func alertUserOnConnectError(
+	config userAlerterGetter, service string, err error) {
+	if config == nil || !isAuthError(err) {
+		return
+	}
+	config.UserAlerter().AlertUser(context.Background(), UserAlert{
+		Type:    UserAlertAuthFailed,
+		Service: service,
+		Err:     err,
+	})
+}
+
+// userAlertTypeForReportedErr returns the type of alert to raise for
+// an error passed to Reporter.ReportErr, if any.
+func userAlertTypeForReportedErr(err error) (UserAlertType, bool) {
+	switch err.(type) {
+	case OverQuotaWarning:
+		return UserAlertOverQuota, true
+	case NeedSelfRekeyError, NeedOtherRekeyError:
+		return UserAlertRekeyNeeded, true
+	case NoCurrentSessionError:
+		return UserAlertAuthFailed, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"testing"
+
+	"github.com/keybase/kbfs/kbfsblock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+type recordingUserAlerter struct {
+	alerts []UserAlert
+}
+
+func (u *recordingUserAlerter) AlertUser(_ context.Context, alert UserAlert) {
+	u.alerts = append(u.alerts, alert)
+}
+
+func TestIsAuthError(t *testing.T) {
+	require.True(t, isAuthError(MDServerErrorUnauthorized{}))
+	require.True(t, isAuthError(
+		errors.WithStack(kbfsblock.BServerErrorUnauthorized{})))
+	require.True(t, isAuthError(NoCurrentSessionError{}))
+	require.False(t, isAuthError(errors.New("connection refused")))
+}
+
+func TestUserAlerts(t *testing.T) {
+	config := MakeTestConfigOrBust(t, "alice")
+	defer CheckConfigAndShutdown(context.Background(), t, config)
+	alerter := &recordingUserAlerter{}
+	config.SetUserAlerter(alerter)
+
+	alertUserOnConnectError(config, MDServiceName, MDServerErrorUnauthorized{})
+	alertUserOnConnectError(config, BServiceName, errors.New("timeout"))
+	require.Len(t, alerter.alerts, 1)
+	require.Equal(t, UserAlertAuthFailed, alerter.alerts[0].Type)
+	require.Equal(t, MDServiceName, alerter.alerts[0].Service)
+
+	ctx := context.Background()
+	r := NewReporterKBPKI(config, 10, 10)
+	defer r.Shutdown()
+	r.ReportErr(ctx, "alice", false, WriteMode, OverQuotaWarning{10, 5})
+	r.ReportErr(ctx, "alice,bob", false, ReadMode,
+		NeedOtherRekeyError{"alice,bob", nil})
+	r.ReportErr(ctx, "alice", false, ReadMode, errors.New("EIO"))
+	require.Len(t, alerter.alerts, 3)
+	require.Equal(t, UserAlertOverQuota, alerter.alerts[1].Type)
+	require.Equal(t, CanonicalTlfName("alice"), alerter.alerts[1].TlfName)
+	require.Equal(t, UserAlertRekeyNeeded, alerter.alerts[2].Type)
+	require.Equal(t, CanonicalTlfName("alice,bob"), alerter.alerts[2].TlfName)
+}
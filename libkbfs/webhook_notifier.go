@@ -0,0 +1,163 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+const (
+	// How many batches of new revisions may wait to be posted
+	// before new ones are dropped.
+	webhookQueueSize = 100
+	// How long to wait for the webhook server to answer.
+	webhookTimeout = 30 * time.Second
+)
+
+// WebhookPayload is the JSON body posted to the webhook URL for each
+// new revision of a folder.
+type WebhookPayload struct {
+	TlfID    string           `json:"tlf_id"`
+	TlfName  string           `json:"tlf_name"`
+	Revision MetadataRevision `json:"revision"`
+	Writer   string           `json:"writer"`
+	// Paths are the canonical paths (e.g.,
+	// "/keybase/private/alice/notes.txt") of the entries that
+	// were created, written, removed, renamed or had their
+	// attributes changed in this revision.
+	Paths []string `json:"paths"`
+}
+
+// webhookNotifier posts a WebhookPayload to a configured URL for
+// every new revision of every folder this device has loaded, made by
+// this device or another one.  Posts happen in the background, one
+// at a time.
+type webhookNotifier struct {
+	config Config
+	url    string
+	client *http.Client
+	log    logger.Logger
+	queue  *revisionQueue
+}
+
+// parseWebhookURL checks that rawURL is usable as a webhook URL.
+func parseWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid webhook URL %q", rawURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf(
+			"Webhook URL %q must be an http or https URL", rawURL)
+	}
+	return nil
+}
+
+func newWebhookNotifier(config Config, rawURL string) (
+	*webhookNotifier, error) {
+	if err := parseWebhookURL(rawURL); err != nil {
+		return nil, err
+	}
+	wn := &webhookNotifier{
+		config: config,
+		url:    rawURL,
+		client: &http.Client{Timeout: webhookTimeout},
+		log:    config.MakeLogger("WHN"),
+	}
+	wn.queue = newRevisionQueue(wn.log, "webhook", webhookQueueSize, wn.post)
+	return wn, nil
+}
+
+// revisionsApplied queues up posts for the given new revisions of
+// fbo's folder.  wn may be nil, in which case nothing happens.
+func (wn *webhookNotifier) revisionsApplied(ctx context.Context,
+	fbo *folderBranchOps, rmds []ImmutableRootMetadata) {
+	if wn == nil {
+		return
+	}
+	wn.queue.revisionsApplied(ctx, fbo, rmds)
+}
+
+func (wn *webhookNotifier) makePayload(ctx context.Context,
+	fbo *folderBranchOps, rmd ImmutableRootMetadata) (
+	WebhookPayload, error) {
+	writer, err := wn.config.KBPKI().GetNormalizedUsername(
+		ctx, rmd.LastModifyingWriter())
+	if err != nil {
+		return WebhookPayload{}, err
+	}
+
+	changes, err := getRevisionChanges(ctx, wn.config, wn.log, fbo, rmd)
+	if err != nil {
+		return WebhookPayload{}, err
+	}
+	paths := make(map[string]bool)
+	for _, change := range changes {
+		paths[change.Path.CanonicalPathString()] = true
+		if change.Type == ChangeEventRename {
+			paths[change.OldPath.CanonicalPathString()] = true
+		}
+	}
+
+	payload := WebhookPayload{
+		TlfID:    rmd.TlfID().String(),
+		TlfName:  string(rmd.GetTlfHandle().GetCanonicalName()),
+		Revision: rmd.Revision(),
+		Writer:   string(writer),
+		Paths:    make([]string, 0, len(paths)),
+	}
+	for p := range paths {
+		payload.Paths = append(payload.Paths, p)
+	}
+	sort.Strings(payload.Paths)
+	return payload, nil
+}
+
+func (wn *webhookNotifier) post(ctx context.Context,
+	fbo *folderBranchOps, rmd ImmutableRootMetadata) error {
+	payload, err := wn.makePayload(ctx, fbo, rmd)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", wn.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := wn.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("Webhook returned %s", resp.Status)
+	}
+	wn.log.CDebugf(ctx, "Posted revision %d of %s (%d paths)",
+		payload.Revision, payload.TlfName, len(payload.Paths))
+	return nil
+}
+
+// Shutdown stops taking new revisions, cancels the post in
+// progress, and drops the ones still queued, so that a slow or
+// unreachable webhook server can't hold up shutdown.  wn may be nil.
+func (wn *webhookNotifier) Shutdown() {
+	if wn == nil {
+		return
+	}
+	wn.queue.shutdownAndCancel()
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package libkbfs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keybase/client/go/logger"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestParseWebhookURL(t *testing.T) {
+	require.NoError(t, parseWebhookURL("https://example.com/hook"))
+	require.NoError(t, parseWebhookURL("http://localhost:8080/"))
+	require.Error(t, parseWebhookURL("ftp://example.com/hook"))
+	require.Error(t, parseWebhookURL("example.com/hook"))
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	payloads := make(chan WebhookPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var p WebhookPayload
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			payloads <- p
+		}))
+	defer server.Close()
+
+	config, _, ctx, cancel := kbfsOpsInitNoMocks(t, "alice")
+	defer kbfsTestShutdownNoMocks(t, config, ctx, cancel)
+	err := config.KBFSOps().(*KBFSOpsStandard).EnableWebhook(server.URL)
+	require.NoError(t, err)
+
+	rootNode := GetRootNodeOrBust(ctx, t, config, "alice", false)
+	kbfsOps := config.KBFSOps()
+	fileNode, _, err := kbfsOps.CreateFile(ctx, rootNode, "a", false, NoExcl)
+	require.NoError(t, err)
+	require.NoError(t, kbfsOps.Write(ctx, fileNode, []byte{1, 2, 3}, 0))
+	require.NoError(t, kbfsOps.Sync(ctx, fileNode))
+
+	getPayload := func() WebhookPayload {
+		select {
+		case p := <-payloads:
+			return p
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+			return WebhookPayload{}
+		}
+	}
+	// The first revision just sets up the TLF.
+	p := getPayload()
+	require.Equal(t, rootNode.GetFolderBranch().Tlf.String(), p.TlfID)
+	require.Equal(t, "alice", p.TlfName)
+	require.Equal(t, "alice", p.Writer)
+
+	expectedPath := "/keybase/private/alice/a"
+	p = getPayload()
+	require.Equal(t, []string{expectedPath}, p.Paths)
+	created := p.Revision
+	p = getPayload()
+	require.Equal(t, created+1, p.Revision)
+	require.Equal(t, []string{expectedPath}, p.Paths)
+}
+
+func TestRevisionQueueShutdownAndCancel(t *testing.T) {
+	started := make(chan struct{})
+	processed := 0
+	rq := newRevisionQueue(logger.NewTestLogger(t), "test", 10,
+		func(ctx context.Context, _ *folderBranchOps,
+			_ ImmutableRootMetadata) error {
+			processed++
+			if processed == 1 {
+				close(started)
+			}
+			// Stand in for a webhook server that never answers.
+			<-ctx.Done()
+			return nil
+		})
+	ctx := context.Background()
+	rq.revisionsApplied(ctx, nil, make([]ImmutableRootMetadata, 3))
+	rq.revisionsApplied(ctx, nil, make([]ImmutableRootMetadata, 2))
+	<-started
+
+	// Shutting down must cancel the revision in progress and drop
+	// the rest, rather than wait for all of them.
+	rq.shutdownAndCancel()
+	require.Equal(t, 1, processed)
+}
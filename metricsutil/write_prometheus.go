@@ -0,0 +1,88 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package metricsutil
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// PrometheusContentType is the HTTP content type of the output of
+// WritePrometheus.
+const PrometheusContentType = "text/plain; version=0.0.4"
+
+var prometheusQuantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// prometheusName turns a go-metrics name like "BlockServer.Get" into
+// a valid Prometheus metric name like "kbfs_BlockServer_Get".
+func prometheusName(prefix, name string) string {
+	mapped := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	return prefix + "_" + mapped
+}
+
+func writePrometheusSummary(w io.Writer, name string, count int64,
+	mean float64, ps []float64, scale float64) {
+	fmt.Fprintf(w, "# TYPE %s summary\n", name)
+	for i, q := range prometheusQuantiles {
+		fmt.Fprintf(w, "%s{quantile=\"%g\"} %g\n", name, q, ps[i]/scale)
+	}
+	// go-metrics only keeps a sample of the values, so the sum is
+	// estimated from the sample mean.
+	fmt.Fprintf(w, "%s_sum %g\n", name, mean*float64(count)/scale)
+	fmt.Fprintf(w, "%s_count %d\n", name, count)
+}
+
+// WritePrometheus writes the metrics in the given registry to the
+// given io.Writer in the Prometheus text exposition format, with
+// every metric name prefixed by prefix. Timers are reported as
+// summaries in seconds, and meters as counters.
+func WritePrometheus(r metrics.Registry, prefix string, w io.Writer) {
+	var namedMetrics namedMetricSlice
+	r.Each(func(name string, i interface{}) {
+		namedMetrics = append(namedMetrics, namedMetric{name, i})
+	})
+
+	sort.Sort(namedMetrics)
+	for _, namedMetric := range namedMetrics {
+		name := prometheusName(prefix, namedMetric.name)
+		switch metric := namedMetric.m.(type) {
+		case metrics.Counter:
+			fmt.Fprintf(w, "# TYPE %s counter\n", name)
+			fmt.Fprintf(w, "%s %d\n", name, metric.Count())
+		case metrics.Gauge:
+			fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+			fmt.Fprintf(w, "%s %d\n", name, metric.Value())
+		case metrics.GaugeFloat64:
+			fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+			fmt.Fprintf(w, "%s %g\n", name, metric.Value())
+		case metrics.Histogram:
+			h := metric.Snapshot()
+			writePrometheusSummary(w, name, h.Count(), h.Mean(),
+				h.Percentiles(prometheusQuantiles), 1)
+		case metrics.Meter:
+			m := metric.Snapshot()
+			fmt.Fprintf(w, "# TYPE %s counter\n", name)
+			fmt.Fprintf(w, "%s %d\n", name, m.Count())
+		case metrics.Timer:
+			t := metric.Snapshot()
+			writePrometheusSummary(w, name+"_seconds", t.Count(),
+				t.Mean(), t.Percentiles(prometheusQuantiles),
+				float64(time.Second))
+		}
+	}
+}
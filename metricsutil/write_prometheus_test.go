@@ -0,0 +1,34 @@
+// Copyright 2017 Keybase Inc. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package metricsutil
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("Foo.Count", r).Inc(3)
+	metrics.GetOrRegisterGauge("Foo.Gauge", r).Update(7)
+	timer := metrics.GetOrRegisterTimer("BlockServer.Get", r)
+	timer.Update(2 * time.Second)
+	timer.Update(2 * time.Second)
+
+	var buf bytes.Buffer
+	WritePrometheus(r, "kbfs", &buf)
+	out := buf.String()
+
+	require.Contains(t, out, "# TYPE kbfs_Foo_Count counter\nkbfs_Foo_Count 3\n")
+	require.Contains(t, out, "# TYPE kbfs_Foo_Gauge gauge\nkbfs_Foo_Gauge 7\n")
+	require.Contains(t, out, "# TYPE kbfs_BlockServer_Get_seconds summary\n")
+	require.Contains(t, out, "kbfs_BlockServer_Get_seconds{quantile=\"0.5\"} 2\n")
+	require.Contains(t, out, "kbfs_BlockServer_Get_seconds_sum 4\n")
+	require.Contains(t, out, "kbfs_BlockServer_Get_seconds_count 2\n")
+}
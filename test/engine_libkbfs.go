@@ -173,24 +173,9 @@ func (k *LibKBFS) GetUID(u User) (uid keybase1.UID) {
 
 func parseTlfHandle(
 	ctx context.Context, kbpki libkbfs.KBPKI, tlfName string, isPublic bool) (
-	h *libkbfs.TlfHandle, err error) {
-	// Limit to one non-canonical name for now.
-outer:
-	for i := 0; i < 2; i++ {
-		h, err = libkbfs.ParseTlfHandle(ctx, kbpki, tlfName, isPublic)
-		switch err := err.(type) {
-		case nil:
-			break outer
-		case libkbfs.TlfNameNotCanonical:
-			tlfName = err.NameToTry
-		default:
-			return nil, err
-		}
-	}
-	if err != nil {
-		return nil, err
-	}
-	return h, nil
+	*libkbfs.TlfHandle, error) {
+	return libkbfs.ParseTlfHandleFollowingRedirects(
+		ctx, kbpki, tlfName, isPublic)
 }
 
 // GetFavorites implements the Engine interface.
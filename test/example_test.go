@@ -52,11 +52,11 @@ func TestConflict(t *testing.T) {
 		as(bob, noSync(),
 			write("a/b", "uh oh"),
 			reenableUpdates(),
-			lsdir("a/", m{"b$": "FILE", "b.conflict.*": "FILE"}),
+			lsdir("a/", m{"b$": "FILE", "b \\(conflicted copy.*": "FILE"}),
 			read("a/b", "world"),
 		),
 		as(alice,
-			lsdir("a/", m{"b$": "FILE", "b.conflict.*": "FILE"}),
+			lsdir("a/", m{"b$": "FILE", "b \\(conflicted copy.*": "FILE"}),
 			read("a/b", "world"),
 		),
 	)
@@ -1,6 +1,7 @@
 package tlf
 
 import (
+	"encoding/hex"
 	"errors"
 	"sort"
 
@@ -32,6 +33,26 @@ var errInvalidWriter = errors.New("Cannot make TLF handle with invalid writer")
 // is passed an invalid reader.
 var errInvalidReader = errors.New("Cannot make TLF handle with invalid reader")
 
+// errInvalidTeamHandle is the error returned by MakeHandle if it is
+// passed a team along with other writers, or with readers.
+var errInvalidTeamHandle = errors.New(
+	"A team TLF handle must have the team as its only writer, and no readers")
+
+// TeamIDSuffix is the last byte of every team ID. Team IDs have the
+// same format as UIDs, but with this suffix instead of a UID suffix,
+// which lets a team take the place of a user in a handle.
+const TeamIDSuffix = 0x24
+
+// IsTeamID returns whether or not the given ID is the ID of a team,
+// rather than that of a user.
+func IsTeamID(id keybase1.UID) bool {
+	b, err := hex.DecodeString(string(id))
+	if err != nil || len(b) != keybase1.UID_LEN {
+		return false
+	}
+	return b[len(b)-1] == TeamIDSuffix
+}
+
 // UIDList can be used to lexicographically sort UIDs.
 type UIDList []keybase1.UID
 
@@ -81,6 +102,19 @@ func MakeHandle(
 		if w == keybase1.PUBLIC_UID {
 			return Handle{}, errInvalidWriter
 		}
+		// A team owns its TLFs on its own, and can't share them
+		// with anyone else, except the public.
+		if IsTeamID(w) && (len(writers) > 1 ||
+			len(unresolvedWriters) > 0 || len(unresolvedReaders) > 0 ||
+			(len(readers) > 0 && readers[0] != keybase1.PUBLIC_UID)) {
+			return Handle{}, errInvalidTeamHandle
+		}
+	}
+
+	for _, r := range readers {
+		if IsTeamID(r) {
+			return Handle{}, errInvalidTeamHandle
+		}
 	}
 
 	if (len(readers) + len(unresolvedReaders)) > 1 {
@@ -149,8 +183,20 @@ func (h Handle) findUserInList(user keybase1.UID,
 	return false
 }
 
+// TeamID returns the ID of the team that owns the top-level folder
+// represented by this Handle, and true, or false if the folder isn't
+// owned by a team.
+func (h Handle) TeamID() (keybase1.UID, bool) {
+	if len(h.Writers) == 1 && IsTeamID(h.Writers[0]) {
+		return h.Writers[0], true
+	}
+	return keybase1.UID(""), false
+}
+
 // IsWriter returns whether or not the given user is a writer for the
-// top-level folder represented by this Handle.
+// top-level folder represented by this Handle. Team membership isn't
+// known to a Handle, so for a team folder, this is only true for the
+// team ID itself.
 func (h Handle) IsWriter(user keybase1.UID) bool {
 	return h.findUserInList(user, h.Writers)
 }
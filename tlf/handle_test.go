@@ -104,6 +104,47 @@ func TestMakeHandleFailures(t *testing.T) {
 	assert.Equal(t, errInvalidReader, err)
 }
 
+func TestMakeHandleTeam(t *testing.T) {
+	tid := FakeTeamID(1)
+	require.True(t, IsTeamID(tid))
+	require.False(t, IsTeamID(keybase1.MakeTestUID(1)))
+	require.False(t, IsTeamID(keybase1.PUBLIC_UID))
+
+	h, err := MakeHandle([]keybase1.UID{tid}, nil, nil, nil, nil)
+	require.NoError(t, err)
+	teamID, ok := h.TeamID()
+	require.True(t, ok)
+	require.Equal(t, tid, teamID)
+
+	h, err = MakeHandle([]keybase1.UID{tid},
+		[]keybase1.UID{keybase1.PUBLIC_UID}, nil, nil, nil)
+	require.NoError(t, err)
+	require.True(t, h.IsPublic())
+	_, ok = h.TeamID()
+	require.True(t, ok)
+
+	h, err = MakeHandle(
+		[]keybase1.UID{keybase1.MakeTestUID(1)}, nil, nil, nil, nil)
+	require.NoError(t, err)
+	_, ok = h.TeamID()
+	require.False(t, ok)
+
+	// A team can't share its folder with anyone.
+	_, err = MakeHandle([]keybase1.UID{tid, keybase1.MakeTestUID(1)},
+		nil, nil, nil, nil)
+	require.Equal(t, errInvalidTeamHandle, err)
+	_, err = MakeHandle([]keybase1.UID{tid},
+		[]keybase1.UID{keybase1.MakeTestUID(1)}, nil, nil, nil)
+	require.Equal(t, errInvalidTeamHandle, err)
+	_, err = MakeHandle([]keybase1.UID{tid}, nil, nil,
+		[]keybase1.SocialAssertion{{User: "user5", Service: "service3"}},
+		nil)
+	require.Equal(t, errInvalidTeamHandle, err)
+	_, err = MakeHandle([]keybase1.UID{keybase1.MakeTestUID(1)},
+		[]keybase1.UID{tid}, nil, nil, nil)
+	require.Equal(t, errInvalidTeamHandle, err)
+}
+
 func TestHandleAccessorsPrivate(t *testing.T) {
 	w := []keybase1.UID{
 		keybase1.MakeTestUID(4),
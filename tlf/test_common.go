@@ -4,6 +4,13 @@
 
 package tlf
 
+import (
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/keybase/client/go/protocol/keybase1"
+)
+
 // FakeID creates a fake public or private TLF ID from the given
 // byte.
 func FakeID(b byte, public bool) ID {
@@ -21,3 +28,11 @@ func FakeID(b byte, public bool) ID {
 func FakeIDByte(id ID) byte {
 	return id.id[0]
 }
+
+// FakeTeamID creates a fake team ID from the given number.
+func FakeTeamID(n uint32) keybase1.UID {
+	var bytes [keybase1.UID_LEN]byte
+	binary.BigEndian.PutUint32(bytes[:], n)
+	bytes[keybase1.UID_LEN-1] = TeamIDSuffix
+	return keybase1.UID(hex.EncodeToString(bytes[:]))
+}